@@ -0,0 +1,94 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// exportHandler answers everything kept about the player authenticated as
+// a zip archive: their account in account.json, and every game they
+// finished in games/{id}.json as a gameDocument with its comments
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	player.Password, player.Verification, player.Reset = "", "", ""
+	for i := range player.Sessions {
+		player.Sessions[i].Hash = ""
+	}
+	for i := range player.AccessTokens {
+		player.AccessTokens[i].Hash = ""
+	}
+	for i := range player.Webhooks {
+		player.Webhooks[i].Secret = ""
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+player.ID+`.zip"`)
+	archive := zip.NewWriter(w)
+	defer archive.Close()
+	if err := writeArchived(archive, "account.json", player); err != nil {
+		log.Printf("cannot export player %s: %v", player.ID, err)
+		return
+	}
+	reader := newCommentReader(r)
+	for _, game := range player.Games {
+		events, err := archiveStore.Load(game.ID)
+		if errors.Is(err, ErrGameNotFound) {
+			continue
+		}
+		var list []Comment
+		if err == nil {
+			list, err = comments.Load(game.ID)
+		}
+		if err == nil {
+			doc := newGameDocument(Replay(events), events)
+			doc.Comments = reader.visible(list)
+			err = writeArchived(archive, "games/"+game.ID+".json", doc)
+		}
+		// the archive has been partly sent, it can only be cut short
+		if err != nil {
+			log.Printf("cannot export game %s of player %s: %v", game.ID, player.ID, err)
+			return
+		}
+	}
+}
+
+func writeArchived(archive *zip.Writer, name string, v any) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// deletePlayerHandler deletes the account of the player authenticated.
+// Their games stay, for the archives of their opponents, but the player
+// they refer to is left with nothing but its ID, as in anonymous; every
+// session is logged out and no identity logs in as it anymore
+func deletePlayerHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	for _, identity := range player.Identities {
+		if err := players.Unlink(identity); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	err := players.Update(player.ID, func(p *Player) error {
+		*p = Player{ID: p.ID, Name: "anonymous", CreatedAt: p.CreatedAt, Deleted: true}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
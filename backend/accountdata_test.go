@@ -0,0 +1,95 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExportAndDeletePlayer(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	create := func(name string) Player {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("POST", "/players?name="+name, nil))
+		player := Player{}
+		json.Unmarshal(w.Body.Bytes(), &player)
+		return player
+	}
+	ana, bo := create("ana"), create("bo")
+	players.Link("github:1", ana.ID)
+	players.Update(ana.ID, func(player *Player) error {
+		player.Identities = []string{"github:1"}
+		return nil
+	})
+	white, black := newTestPlayer(t), newTestPlayer(t)
+	goOnline(white.conn, ana.ID)
+	goOnline(black.conn, bo.ID)
+	for _, player := range []*testPlayer{white, black} {
+		if err := games.Pair(context.Background(), player.conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := white.expect("start")
+	black.expect("start")
+	white.send(Message{Type: "resign"})
+	black.expect("game_over")
+	waitFor(t, func() bool {
+		player, _ := players.Load(ana.ID)
+		return len(player.Games) == 1
+	})
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		newPublicMux().ServeHTTP(w, r)
+		return w
+	}
+	if w := do("GET", "/players/"+ana.ID+"/export", bo.Token); w.Code != http.StatusForbidden {
+		t.Errorf("got %d exporting somebody else", w.Code)
+	}
+	w := do("GET", "/players/"+ana.ID+"/export", ana.Token)
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	if len(files) != 2 || files["account.json"] == nil || files["games/"+start.GameID+".json"] == nil {
+		t.Fatalf("got %v", files)
+	}
+	f, _ := files["account.json"].Open()
+	account := Player{}
+	json.NewDecoder(f).Decode(&account)
+	if account.Name != "ana" || len(account.Sessions) != 1 || account.Sessions[0].Hash != "" {
+		t.Errorf("exported %+v", account)
+	}
+
+	if w := do("DELETE", "/players/"+ana.ID, ana.Token); w.Code != http.StatusNoContent {
+		t.Fatalf("got %d deleting", w.Code)
+	}
+	if _, err := authenticate(ana.Token); err == nil {
+		t.Error("the deleted player is still logged in")
+	}
+	if _, err := players.Linked("github:1"); err == nil {
+		t.Error("the identity still logs in as the deleted player")
+	}
+	w = httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/"+ana.ID, nil))
+	p := profile{}
+	json.Unmarshal(w.Body.Bytes(), &p)
+	if !p.Deleted || p.Name != "anonymous" || p.Count.All != 0 {
+		t.Errorf("got %+v", p)
+	}
+	// the opponent keeps the game, against the player now anonymous
+	if player, _ := players.Load(bo.ID); len(player.Games) != 1 || player.Games[0].Opponent != ana.ID {
+		t.Errorf("got %+v", player.Games)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordAccounts(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	defer func(cost int) { passwordCost = cost }(passwordCost)
+	passwordCost = bcrypt.MinCost
+	defer func(send func(to, subject, body string) error) { sendMail = send }(sendMail)
+	mailed := map[string]string{}
+	sendMail = func(to, subject, body string) error {
+		mailed[to] = body
+		return nil
+	}
+	// link is the token of the last link mailed to to
+	link := func(to string) string {
+		match := regexp.MustCompile(`(token|reset)=([^\s&]+)`).FindStringSubmatch(mailed[to])
+		if match == nil {
+			t.Fatalf("no link in %q", mailed[to])
+		}
+		token, _ := url.QueryUnescape(match[2])
+		return token
+	}
+	post := func(path, body string) (int, Player) {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		player := Player{}
+		json.Unmarshal(w.Body.Bytes(), &player)
+		return w.Code, player
+	}
+
+	code, registered := post("/accounts", `{"name":"ana","email":"Ana@Example.com","password":"correct horse"}`)
+	if code != http.StatusOK || registered.Token != "" || registered.Password != "" || registered.Email != "ana@example.com" {
+		t.Fatalf("got %d %+v", code, registered)
+	}
+	if code, _ := post("/accounts", `{"name":"other","email":"ana@example.com","password":"correct horse"}`); code != http.StatusConflict {
+		t.Errorf("got %d registering the email again", code)
+	}
+	if code, _ := post("/accounts", `{"name":"bo","email":"bo@example.com","password":"short"}`); code != http.StatusBadRequest {
+		t.Errorf("got %d for a short password", code)
+	}
+	if code, _ := post("/accounts/login", `{"email":"ana@example.com","password":"correct horse"}`); code != http.StatusForbidden {
+		t.Errorf("got %d before verifying the email", code)
+	}
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/accounts/verify?token="+url.QueryEscape(link("ana@example.com")), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d verifying", w.Code)
+	}
+	if code, _ := post("/accounts/login", `{"email":"ana@example.com","password":"wrong horse"}`); code != http.StatusForbidden {
+		t.Errorf("got %d with a wrong password", code)
+	}
+	code, player := post("/accounts/login", `{"email":"ANA@example.com","password":"correct horse"}`)
+	if code != http.StatusOK || player.ID != registered.ID || player.Token == "" || player.Password != "" {
+		t.Fatalf("got %d %+v", code, player)
+	}
+
+	// resetting the password logs out the old token
+	if code, _ := post("/accounts/reset", `{"email":"nobody@example.com"}`); code != http.StatusNoContent {
+		t.Errorf("got %d for an unknown email", code)
+	}
+	post("/accounts/reset", `{"email":"ana@example.com"}`)
+	reset := link("ana@example.com")
+	if code, _ := post("/accounts/reset/confirm", `{"token":"`+reset+`x","password":"battery staple"}`); code != http.StatusBadRequest {
+		t.Errorf("got %d with a wrong reset token", code)
+	}
+	code, again := post("/accounts/reset/confirm", `{"token":"`+reset+`","password":"battery staple"}`)
+	if code != http.StatusOK || again.Token == player.Token {
+		t.Fatalf("got %d %+v", code, again)
+	}
+	if _, err := authenticate(player.Token); err == nil {
+		t.Error("the old token still works")
+	}
+	if code, _ := post("/accounts/reset/confirm", `{"token":"`+reset+`","password":"battery staple"}`); code != http.StatusBadRequest {
+		t.Errorf("got %d reusing the reset link", code)
+	}
+	if code, _ := post("/accounts/login", `{"email":"ana@example.com","password":"battery staple"}`); code != http.StatusOK {
+		t.Errorf("got %d with the new password", code)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// the events of a player achievements are unlocked for, once each
+const (
+	achievementFirstWin     = "first_win"
+	achievementWinStreak    = "win_streak"
+	achievementKingMarch    = "king_march"
+	achievementKnightMate   = "knight_promotion_mate"
+	achievementHundredGames = "hundred_games"
+)
+
+// winStreak is how many wins in a row unlock achievementWinStreak
+const winStreak = 10
+
+// Achievement is one unlocked by a player, finishing Game
+type Achievement struct {
+	ID         string    `json:"id"`
+	Game       string    `json:"game"`
+	UnlockedAt time.Time `json:"unlockedAt"`
+}
+
+// achievements are checked against the player whose color finished the
+// game of state, with the game already among their games
+var achievements = []struct {
+	id       string
+	unlocked func(player *Player, state GameState, color string) bool
+}{
+	{achievementFirstWin, func(player *Player, _ GameState, _ string) bool {
+		return won(player) && wins(player.Games) == 1
+	}},
+	{achievementWinStreak, func(player *Player, _ GameState, _ string) bool {
+		if len(player.Games) < winStreak {
+			return false
+		}
+		return wins(player.Games[len(player.Games)-winStreak:]) == winStreak
+	}},
+	{achievementKingMarch, func(player *Player, state GameState, color string) bool {
+		return won(player) && kingMarched(state, chessColor(color))
+	}},
+	{achievementKnightMate, func(player *Player, state GameState, _ string) bool {
+		return won(player) && knightPromotionMate(state)
+	}},
+	{achievementHundredGames, func(player *Player, _ GameState, _ string) bool {
+		return len(player.Games) == 100
+	}},
+}
+
+func wins(games []PlayerGame) int {
+	n := 0
+	for _, game := range games {
+		if game.Result == "win" {
+			n++
+		}
+	}
+	return n
+}
+
+// won tells whether the player won the game they just finished
+func won(player *Player) bool {
+	return player.Games[len(player.Games)-1].Result == "win"
+}
+
+// kingMarched tells whether the king of color got to the back rank of its
+// opponent in the game of state
+func kingMarched(state GameState, color chess.Color) bool {
+	position := startPosition(state.FEN)
+	backRank := 7
+	if color == chess.Black {
+		backRank = 0
+	}
+	for _, m := range state.Moves {
+		parsed, err := chess.ParseMove(m.UCI())
+		if err != nil || !position.IsLegal(parsed) {
+			return false
+		}
+		piece := position.PieceAt(parsed.From)
+		if piece.Type() == chess.King && piece.Color() == color && parsed.To.Rank() == backRank {
+			return true
+		}
+		position = position.Apply(parsed)
+	}
+	return false
+}
+
+// knightPromotionMate tells whether the game of state ended mating with
+// a pawn promoted to a knight
+func knightPromotionMate(state GameState) bool {
+	if len(state.Moves) == 0 || state.Moves[len(state.Moves)-1].Promotion != "n" {
+		return false
+	}
+	position, played := positionAfter(state.FEN, state.Moves)
+	return played == len(state.Moves) && position.Status() == chess.Checkmate
+}
+
+// unlockAchievements adds to player, of color in the game of state just
+// recorded, the achievements it unlocks, returning them
+func unlockAchievements(player *Player, state GameState, color string, now time.Time) []Achievement {
+	has := map[string]bool{}
+	for _, a := range player.Achievements {
+		has[a.ID] = true
+	}
+	var unlocked []Achievement
+	for _, a := range achievements {
+		if !has[a.id] && a.unlocked(player, state, color) {
+			unlocked = append(unlocked, Achievement{ID: a.id, Game: state.ID, UnlockedAt: now})
+		}
+	}
+	player.Achievements = append(player.Achievements, unlocked...)
+	return unlocked
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// unlockedIDs are the IDs of the achievements of player id
+func unlockedIDs(t *testing.T, id string) []string {
+	t.Helper()
+	player, err := players.Load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, a := range player.Achievements {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+func TestAchievements(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	players.Create(Player{ID: "ana", Name: "ana"})
+	players.Create(Player{ID: "bo", Name: "bo"})
+	finished := func(id, result, fen string, moves ...Move) {
+		recordPlayerGames(GameState{ID: id, Finished: true, Result: result, FEN: fen, Moves: moves, Players: map[string]string{"white": "ana", "black": "bo"}})
+	}
+
+	finished("g1", "1-0", "")
+	if got := unlockedIDs(t, "ana"); !slices.Equal(got, []string{achievementFirstWin}) {
+		t.Errorf("got %v", got)
+	}
+	if got := unlockedIDs(t, "bo"); len(got) != 0 {
+		t.Errorf("got %v for a loss", got)
+	}
+	// an achievement is only unlocked the once
+	finished("g2", "1-0", "")
+	if got := unlockedIDs(t, "ana"); len(got) != 1 {
+		t.Errorf("got %v", got)
+	}
+
+	// the king of white walks up to the eighth rank, then f8=N mates
+	finished("g3", "1-0", "k7/4K3/8/8/8/8/8/8 w - - 0 1", Move{From: "e7", To: "e8"})
+	finished("g4", "1-0", "6br/5Ppk/6pp/8/8/8/8/K7 w - - 0 1", Move{From: "f7", To: "f8", Promotion: "n"})
+	if got := unlockedIDs(t, "ana"); !slices.Equal(got, []string{achievementFirstWin, achievementKingMarch, achievementKnightMate}) {
+		t.Errorf("got %v", got)
+	}
+	// a king stepping forward without winning is no march
+	finished("g5", "1/2-1/2", "k7/4K3/8/8/8/8/8/8 w - - 0 1", Move{From: "e7", To: "e8"})
+
+	for i := 0; i < winStreak; i++ {
+		finished("streak", "1-0", "")
+	}
+	player, _ := players.Load("ana")
+	if got := player.Achievements[len(player.Achievements)-1]; got.ID != achievementWinStreak || got.Game != "streak" {
+		t.Errorf("got %+v", got)
+	}
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/bo", nil))
+	got := profile{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Achievements == nil || len(got.Achievements) != 0 {
+		t.Errorf("got %+v", got.Achievements)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func newAdminMux(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /metrics", expvar.Handler())
+	mux.HandleFunc("GET /games", listGamesHandler)
+	mux.HandleFunc("GET /games/{id}/audit", auditLogHandler)
+	mux.HandleFunc("GET /games/{id}/state", gameStateHandler)
+	mux.HandleFunc("POST /games/{id}/kick", kickHandler)
+	mux.HandleFunc("POST /games/{id}/abort", abortHandler)
+	mux.HandleFunc("POST /games/{id}/handoff", handoffHandler)
+	mux.HandleFunc("DELETE /games/{id}/comments/{comment}", moderateCommentHandler)
+	mux.HandleFunc("DELETE /brackets/{id}/chat/{comment}", moderateBracketChatHandler)
+	mux.HandleFunc("GET /bans", listBansHandler)
+	mux.HandleFunc("PUT /bans/{ip}", banHandler)
+	mux.HandleFunc("DELETE /bans/{ip}", unbanHandler)
+	mux.HandleFunc("GET /shadow-mutes", listShadowMutesHandler)
+	mux.HandleFunc("PUT /shadow-mutes/{client}", shadowMuteHandler)
+	mux.HandleFunc("DELETE /shadow-mutes/{client}", unshadowMuteHandler)
+	mux.HandleFunc("GET /reviews", listReviewsHandler)
+	mux.HandleFunc("DELETE /reviews/{player}", clearReviewHandler)
+	mux.HandleFunc("POST /exhibitions", exhibitionHandler)
+	mux.HandleFunc("POST /imports", importGamesHandler)
+	mux.HandleFunc("GET /drain", drainHandler)
+	mux.HandleFunc("PUT /drain", drainHandler)
+	mux.HandleFunc("DELETE /drain", drainHandler)
+	return requireToken(token, mux)
+}
+
+func listGamesHandler(w http.ResponseWriter, r *http.Request) {
+	ids, err := archiveStore.GameIDs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slices.Sort(ids)
+	writeJSON(w, ids)
+}
+
+func auditLogHandler(w http.ResponseWriter, r *http.Request) {
+	events, ok := loadEvents(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, events)
+}
+
+// gameStateHandler rebuilds the state of a game, or with ?event=N the state
+// it had right after its Nth event
+func gameStateHandler(w http.ResponseWriter, r *http.Request) {
+	events, ok := loadEvents(w, r)
+	if !ok {
+		return
+	}
+	if at := r.URL.Query().Get("event"); at != "" {
+		n, err := strconv.Atoi(at)
+		if err != nil || n < 0 || n > len(events) {
+			http.Error(w, "invalid event number", http.StatusBadRequest)
+			return
+		}
+		events = events[:n]
+	}
+	writeJSON(w, Replay(events))
+}
+
+// kickHandler disconnects the players of an active game,
+// only the one of ?color=white or black if given
+func kickHandler(w http.ResponseWriter, r *http.Request) {
+	game, ok := games.Find(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch color := r.URL.Query().Get("color"); color {
+	case "":
+		game.Kick("white")
+		game.Kick("black")
+	case "white", "black":
+		game.Kick(color)
+	default:
+		http.Error(w, "invalid color", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// abortHandler ends an active game without a result
+func abortHandler(w http.ResponseWriter, r *http.Request) {
+	game, ok := games.Find(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	game.Abort()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func listBansHandler(w http.ResponseWriter, r *http.Request) {
+	ips := listBans()
+	slices.Sort(ips)
+	writeJSON(w, ips)
+}
+
+func banHandler(w http.ResponseWriter, r *http.Request) {
+	if net.ParseIP(r.PathValue("ip")) == nil {
+		http.Error(w, "invalid IP address", http.StatusBadRequest)
+		return
+	}
+	ban(r.PathValue("ip"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func unbanHandler(w http.ResponseWriter, r *http.Request) {
+	unban(r.PathValue("ip"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listShadowMutesHandler(w http.ResponseWriter, r *http.Request) {
+	clients := listShadowMutes()
+	slices.Sort(clients)
+	writeJSON(w, clients)
+}
+
+// shadowMuteHandler shadow mutes a client, player:ID for an account or
+// ip:address for whoever comes from an IP address
+func shadowMuteHandler(w http.ResponseWriter, r *http.Request) {
+	client := r.PathValue("client")
+	id, isPlayer := strings.CutPrefix(client, "player:")
+	ip, isIP := strings.CutPrefix(client, "ip:")
+	if isPlayer && id == "" || isIP && net.ParseIP(ip) == nil || !isPlayer && !isIP {
+		http.Error(w, "clients are player:ID or ip:address", http.StatusBadRequest)
+		return
+	}
+	shadowMute(client)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func unshadowMuteHandler(w http.ResponseWriter, r *http.Request) {
+	unshadowMute(r.PathValue("client"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// drainStatus is the progress of drain mode
+type drainStatus struct {
+	Draining bool `json:"draining"`
+	// Games is how many games are still being played
+	Games int `json:"games"`
+	// Deadline is when the server exits at the latest, if it is to exit
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// HandedOff is how many games were just handed off to other instances
+	HandedOff int `json:"handedOff,omitempty"`
+}
+
+// drainHandler turns drain mode on with PUT and off with DELETE,
+// answering how far along draining is. With PUT ?deadline=10m the
+// server also exits once its games are over, or when the deadline passes;
+// with ?handoff=true as well its games are handed off to the other
+// instances right away, see HandOff, for a rolling restart to end none
+func drainHandler(w http.ResponseWriter, r *http.Request) {
+	handed := 0
+	switch r.Method {
+	case http.MethodPut:
+		timeout := time.Duration(0)
+		if value := r.URL.Query().Get("deadline"); value != "" {
+			var err error
+			if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+				http.Error(w, "invalid deadline", http.StatusBadRequest)
+				return
+			}
+		}
+		startDrain(timeout)
+		if handoff, _ := strconv.ParseBool(r.URL.Query().Get("handoff")); handoff {
+			handed = handOffGames()
+		}
+	case http.MethodDelete:
+		stopDrain()
+	}
+	status := drainStatus{Draining: draining.Load(), Games: len(games.List()), HandedOff: handed}
+	if deadline := drainDeadlineAt(); !deadline.IsZero() {
+		status.Deadline = &deadline
+	}
+	writeJSON(w, status)
+}
+
+func loadEvents(w http.ResponseWriter, r *http.Request) ([]Event, bool) {
+	events, err := store.Load(r.PathValue("id"))
+	if errors.Is(err, ErrGameNotFound) {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return events, true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
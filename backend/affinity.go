@@ -0,0 +1,215 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// instanceURL is the URL the clients reach this instance at, as in
+// https://eu.chess.example.com, when several share a storage; the games
+// it owns are found there. Empty for a server of its own
+var instanceURL string
+
+// GameRegistry is the instance that owns every game being played, shared
+// by the instances of a deployment for both players and spectators to be
+// sent to that one, see gameElsewhere
+type GameRegistry interface {
+	// Claim makes instance the owner of game
+	Claim(game, instance string) error
+	// Owner is the instance that owns game, empty if none does
+	Owner(game string) (string, error)
+	// Release leaves game without an owner, if instance still owns it
+	Release(game, instance string) error
+	// Heartbeat records that instance is up at
+	Heartbeat(instance string, at time.Time) error
+	// Members are the instances up since, see watchMembership
+	Members(since time.Time) ([]string, error)
+	// HandOff makes instance the owner of game, to pick it up from
+	// snapshot with Adopt
+	HandOff(game, instance string, snapshot []byte) error
+	// Adopt is the snapshot of game handed off to instance, nil if there
+	// is none; it is only ever adopted once
+	Adopt(game, instance string) ([]byte, error)
+	// HandedOff are the games handed off to instance yet to be adopted
+	HandedOff(instance string) ([]string, error)
+}
+
+var registry GameRegistry = newMemoryRegistry()
+
+type memoryRegistry struct {
+	mu        sync.Mutex
+	owners    map[string]string
+	seen      map[string]time.Time
+	snapshots map[string][]byte
+}
+
+func newMemoryRegistry() *memoryRegistry {
+	return &memoryRegistry{owners: map[string]string{}, seen: map[string]time.Time{}, snapshots: map[string][]byte{}}
+}
+
+func (m *memoryRegistry) Claim(game, instance string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.owners[game] = instance
+	delete(m.snapshots, game)
+	return nil
+}
+
+func (m *memoryRegistry) Owner(game string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.owners[game], nil
+}
+
+func (m *memoryRegistry) Release(game, instance string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.owners[game] == instance {
+		delete(m.owners, game)
+		delete(m.snapshots, game)
+	}
+	return nil
+}
+
+func (m *memoryRegistry) Heartbeat(instance string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seen[instance] = at
+	return nil
+}
+
+func (m *memoryRegistry) Members(since time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var members []string
+	for instance, at := range m.seen {
+		if !at.Before(since) {
+			members = append(members, instance)
+		}
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func (m *memoryRegistry) HandOff(game, instance string, snapshot []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.owners[game], m.snapshots[game] = instance, snapshot
+	return nil
+}
+
+func (m *memoryRegistry) Adopt(game, instance string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.owners[game] != instance {
+		return nil, nil
+	}
+	snapshot := m.snapshots[game]
+	delete(m.snapshots, game)
+	return snapshot, nil
+}
+
+func (m *memoryRegistry) HandedOff(instance string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var handed []string
+	for game := range m.snapshots {
+		if m.owners[game] == instance {
+			handed = append(handed, game)
+		}
+	}
+	sort.Strings(handed)
+	return handed, nil
+}
+
+// claimGame records that this instance owns game, in a deployment of
+// several, until release is called once it is over. A game hashing to it
+// on the ring is found without, see rebalance for those that stop to
+func claimGame(game *ChessGame) (release func()) {
+	instance, registry := instanceURL, registry
+	if instance == "" {
+		return func() {}
+	}
+	if currentRing().owner(game.id) == instance {
+		return func() {
+			if err := registry.Release(game.id, instance); err != nil {
+				log.Printf("cannot release game %s: %v", game.id, err)
+			}
+		}
+	}
+	if err := registry.Claim(game.id, instance); err != nil {
+		log.Printf("cannot claim game %s: %v", game.id, err)
+	}
+	return func() {
+		if err := registry.Release(game.id, instance); err != nil {
+			log.Printf("cannot release game %s: %v", game.id, err)
+		}
+	}
+}
+
+// gameElsewhere is the instance owning the game id, if another one does:
+// the one that claimed it while up, else the one it hashes to on the ring
+func gameElsewhere(id string) (string, bool) {
+	if instanceURL == "" {
+		return "", false
+	}
+	if _, ok := games.Find(id); ok {
+		return "", false
+	}
+	r := currentRing()
+	owner, err := registry.Owner(id)
+	if err != nil {
+		log.Printf("cannot find the owner of game %s: %v", id, err)
+	}
+	if owner == "" || !r.has(owner) {
+		owner = r.owner(id)
+	}
+	return owner, owner != "" && owner != instanceURL
+}
+
+// instanceLocation is where r goes on instance, with the ws or wss scheme
+// for a websocket
+func instanceLocation(instance string, r *http.Request, websocket bool) string {
+	return remoteLocation(instance, r.URL.Path, r.URL.RawQuery, websocket)
+}
+
+// remoteLocation is path with query on instance
+func remoteLocation(instance, path, query string, websocket bool) string {
+	u, err := url.Parse(instance)
+	if err != nil {
+		return instance
+	}
+	if websocket {
+		u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = query
+	return u.String()
+}
+
+// redirectGame has conn, asking for the game id owned by another instance,
+// connect there instead, reporting whether it does
+func redirectGame(conn *connection, r *http.Request, id string) bool {
+	owner, elsewhere := gameElsewhere(id)
+	if elsewhere {
+		redirectTo(conn, id, instanceLocation(owner, r, true))
+	}
+	return elsewhere
+}
+
+// withGameAffinity sends requests for a game owned by another instance,
+// the live events of its spectators among them, to that instance
+func withGameAffinity(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if owner, elsewhere := gameElsewhere(r.PathValue("id")); elsewhere {
+			http.Redirect(w, r, instanceLocation(owner, r, false), http.StatusTemporaryRedirect)
+			return
+		}
+		h(w, r)
+	}
+}
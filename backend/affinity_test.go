@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGameAffinity(t *testing.T) {
+	defer func(u string, r GameRegistry) { instanceURL, registry = u, r }(instanceURL, registry)
+	instanceURL, registry = "https://us.chess.example.com", newMemoryRegistry()
+	defer ring.Store(ring.Load())
+	ring.Store(newHashRing([]string{instanceURL, "https://eu.chess.example.com/"}))
+	registry.Claim("far", "https://eu.chess.example.com/")
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/games/far/events?since=3", nil))
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "https://eu.chess.example.com/games/far/events?since=3" {
+		t.Errorf("got %d to %s", w.Code, w.Header().Get("Location"))
+	}
+
+	player := newTestPlayer(t)
+	r := httptest.NewRequest("GET", "/ws?game=far&token=t&seq=4", nil)
+	if !redirectGame(player.conn, r, "far") {
+		t.Fatal("not redirected")
+	}
+	if got := player.expect("redirect"); got.URL != "wss://eu.chess.example.com/ws?game=far&token=t&seq=4" {
+		t.Errorf("got %+v", got)
+	}
+
+	// the games of the instance are its own, the others those of the
+	// instance they hash to unless one up claimed them
+	game, _, _ := startTestGame(t)
+	registry.Claim(game.id, "https://eu.chess.example.com/")
+	if _, elsewhere := gameElsewhere(game.id); elsewhere {
+		t.Errorf("game %s sent elsewhere", game.id)
+	}
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		if owner, _ := gameElsewhere(id); owner != ring.Load().owner(id) {
+			t.Errorf("game %s sent to %s", id, owner)
+		}
+	}
+	registry.Claim("gone", "https://asia.chess.example.com")
+	if owner, _ := gameElsewhere("gone"); owner != ring.Load().owner("gone") {
+		t.Errorf("game of an instance down sent to %s", owner)
+	}
+}
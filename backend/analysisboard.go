@@ -0,0 +1,499 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+var ErrBoardNotFound = errors.New("analysis board not found")
+
+// maxBoardNodes bounds the moves of the variation tree of an analysis
+// board, maxCommentLength, maxArrows and maxNAGs the annotations of each
+const (
+	maxBoardNodes    = 5000
+	maxCommentLength = 2000
+	maxArrows        = 32
+	maxNAGs          = 8
+)
+
+// BoardNode is a move of the variation tree of an analysis board, in UCI
+// notation and in SAN, played after Parent. NAGs are the numeric annotation
+// glyphs of PGN, 1 for ! and so on; Arrows are drawn on the board after it
+// from one square to another, as in e2e4
+type BoardNode struct {
+	ID      int      `json:"id"`
+	Parent  int      `json:"parent,omitempty"`
+	Move    string   `json:"move"`
+	SAN     string   `json:"san"`
+	NAGs    []int    `json:"nags,omitempty"`
+	Comment string   `json:"comment,omitempty"`
+	Arrows  []string `json:"arrows,omitempty"`
+}
+
+// BoardMember is someone connected to an analysis board, as an owner,
+// writer or reader
+type BoardMember struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+// analysisBoard is a free-form board analysed together by everyone
+// connected to it: any move is played from any position of its variation
+// tree, by whoever may write to it. Its owner, who has its token, decides
+// who may. Boards are kept in memory while somebody is connected
+//
+// Operations name the revision of the tree they were made on. Nodes are
+// never given the ID of another, so one made on an older revision than
+// the latest still applies to the tree as it is now: a move the tree has
+// already is the node it has, deleting a node that is gone does nothing,
+// and a move after a node that is gone conflicts. Resetting the tree
+// conflicts with anything made since the revision it was made on, so does
+// any operation made on a tree that was reset since
+type analysisBoard struct {
+	id    string
+	token string
+	// study is the study the board is chapter number chapter of, it is
+	// saved to it as it changes
+	study   string
+	chapter int
+
+	mu     sync.Mutex
+	root   chess.Position
+	nodes  map[int]*boardNode
+	lastID int
+	rev    int
+	// resetRev is the revision the tree was last reset at
+	resetRev int
+	members  map[*connection]*BoardMember
+	// lastMember numbers the members; defaultRole is the role of who joins
+	lastMember  int
+	defaultRole string
+	closed      bool
+}
+
+type boardNode struct {
+	BoardNode
+	// position is the position after the move
+	position chess.Position
+	children []int
+}
+
+// OpenAnalysisBoard creates an analysis board at the starting position,
+// whoever connects with its token owns it
+func (m *gameManager) OpenAnalysisBoard() (*analysisBoard, error) {
+	if draining.Load() {
+		return nil, ErrDraining
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := newAnalysisBoard(newGameID(), newToken(), chess.NewPosition())
+	m.boards[b.id] = b
+	return b, nil
+}
+
+func newAnalysisBoard(id, token string, root chess.Position) *analysisBoard {
+	return &analysisBoard{
+		id:          id,
+		token:       token,
+		root:        root,
+		nodes:       map[int]*boardNode{},
+		members:     map[*connection]*BoardMember{},
+		defaultRole: "reader",
+	}
+}
+
+// restore puts nodes in the tree, each after its parent, reporting false
+// if one is not a legal move there
+func (b *analysisBoard) restore(nodes []BoardNode) bool {
+	for _, node := range nodes {
+		position := b.root
+		if node.Parent != 0 {
+			parent, ok := b.nodes[node.Parent]
+			if !ok {
+				return false
+			}
+			position = parent.position
+			parent.children = append(parent.children, node.ID)
+		}
+		m, err := chess.ParseMove(node.Move)
+		if err != nil || !position.IsLegal(m) || node.ID <= b.lastID {
+			return false
+		}
+		b.nodes[node.ID] = &boardNode{BoardNode: node, position: position.Apply(m)}
+		b.lastID = node.ID
+	}
+	return true
+}
+
+// tree is every node of the tree, parents before their children in the
+// order nodes were made; b.mu must be held
+func (b *analysisBoard) tree() []BoardNode {
+	nodes := []BoardNode{}
+	for id := 1; id <= b.lastID; id++ {
+		if node, ok := b.nodes[id]; ok {
+			nodes = append(nodes, node.BoardNode)
+		}
+	}
+	return nodes
+}
+
+func (m *gameManager) FindAnalysisBoard(id string) (*analysisBoard, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.boards[id]
+	return b, ok
+}
+
+// joinAnalysisBoard handles the connections to the analysis board id, a
+// new one owned by conn if id is new
+func joinAnalysisBoard(conn *connection, id, token string) {
+	var b *analysisBoard
+	if id == "new" {
+		var err error
+		if b, err = games.OpenAnalysisBoard(); err != nil {
+			closeWithError(conn, err)
+			return
+		}
+		token = b.token
+	} else if found, ok := games.FindAnalysisBoard(id); ok {
+		b = found
+	}
+	if b == nil || !b.join(conn, token) {
+		closeWithError(conn, ErrBoardNotFound, id)
+		return
+	}
+	go b.listen(conn)
+}
+
+// join adds conn to the members of b, as its owner if token is that of b,
+// reporting false if everyone left b before
+func (b *analysisBoard) join(conn *connection, token string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return false
+	}
+	b.lastMember++
+	member := &BoardMember{ID: strconv.Itoa(b.lastMember), Role: b.defaultRole}
+	if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(b.token)) == 1 {
+		member.Role = "owner"
+	}
+	b.broadcast(Message{Type: "board_joined", BoardID: b.id, Participant: member.ID, Role: member.Role})
+	b.members[conn] = member
+	b.welcome(conn)
+	return true
+}
+
+// welcome writes the whole board to conn, the token along for its owners;
+// b.mu must be held
+func (b *analysisBoard) welcome(conn *connection) {
+	member := b.members[conn]
+	welcome := Message{Type: "board", BoardID: b.id, Participant: member.ID, Role: member.Role, FEN: b.root.FEN(), Rev: b.rev}
+	if member.Role == "owner" {
+		welcome.Token = b.token
+	}
+	welcome.Nodes = b.tree()
+	for _, m := range b.members {
+		welcome.Members = append(welcome.Members, *m)
+	}
+	conn.Write(welcome)
+}
+
+// listen reads the operations of conn until it leaves
+func (b *analysisBoard) listen(conn *connection) {
+	defer b.leave(conn)
+	for {
+		message, err := conn.Read()
+		if errors.Is(err, ErrInvalidPayload) {
+			conn.Write(errorMessage(CodeInvalidPayload))
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if invalid := validateMessage(message); invalid != nil {
+			conn.Write(*invalid)
+			continue
+		}
+		b.handle(conn, message)
+	}
+}
+
+func (b *analysisBoard) leave(conn *connection) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	member, ok := b.members[conn]
+	if !ok {
+		return
+	}
+	delete(b.members, conn)
+	conn.Close("")
+	b.broadcast(Message{Type: "board_left", BoardID: b.id, Participant: member.ID})
+	if len(b.members) == 0 && !b.closed {
+		b.closed = true
+		games.mu.Lock()
+		delete(games.boards, b.id)
+		games.mu.Unlock()
+	}
+}
+
+// save saves the tree to the chapter of the study of b, if any; b.mu must
+// be held
+func (b *analysisBoard) save() {
+	if b.study == "" {
+		return
+	}
+	err := studies.Update(b.study, func(study *Study) error {
+		if b.chapter > len(study.Chapters) {
+			return ErrStudyNotFound
+		}
+		chapter := &study.Chapters[b.chapter-1]
+		chapter.FEN, chapter.Nodes = b.root.FEN(), b.tree()
+		return nil
+	})
+	if err != nil {
+		log.Println("saving study", b.study, err)
+	}
+}
+
+// handle applies the operation in message, made by conn
+func (b *analysisBoard) handle(conn *connection, message Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	member := b.members[conn]
+	switch {
+	case message.Type == "board_grant":
+		b.grant(conn, member, message)
+		return
+	case message.Type == "validate_fen":
+		conn.Write(validateFENMessage(message.FEN))
+		return
+	case message.Type != "board_move" && message.Type != "board_delete" && message.Type != "board_reset" && message.Type != "board_annotate":
+		conn.Write(errorMessage(CodeWrongRole))
+		return
+	case member.Role == "reader":
+		conn.Write(errorMessage(CodeReadOnlyBoard))
+		return
+	case message.Rev > b.rev || message.Rev < b.resetRev:
+		b.conflict(conn)
+		return
+	}
+	rev := b.rev
+	defer func() {
+		if b.rev != rev {
+			b.save()
+		}
+	}()
+	switch message.Type {
+	case "board_move":
+		b.move(conn, member, message)
+	case "board_delete":
+		node, ok := b.nodes[message.Node]
+		if !ok {
+			if message.Node > b.lastID || message.Node < 0 {
+				conn.Write(errorMessage(CodeInvalidMessage, "node", "exists"))
+				return
+			}
+			// deleted by somebody else already
+			conn.Write(Message{Type: "board_delete", BoardID: b.id, Node: message.Node, Rev: b.rev, Participant: member.ID})
+			return
+		}
+		b.delete(node)
+		b.rev++
+		b.broadcast(Message{Type: "board_delete", BoardID: b.id, Node: message.Node, Rev: b.rev, Participant: member.ID})
+	case "board_reset":
+		// resetting would throw away what was made meanwhile
+		if message.Rev < b.rev {
+			b.conflict(conn)
+			return
+		}
+		root, err := parseLegalFEN(message.FEN)
+		if errors.Is(err, chess.ErrIllegalPosition) {
+			conn.Write(errorMessage(CodeIllegalPosition, positionProblems[err]))
+			return
+		}
+		if err != nil {
+			conn.Write(errorMessage(CodeInvalidMessage, "fen", "fen"))
+			return
+		}
+		b.root, b.nodes = root, map[int]*boardNode{}
+		b.rev++
+		b.resetRev = b.rev
+		b.broadcast(Message{Type: "board_reset", BoardID: b.id, FEN: root.FEN(), Rev: b.rev, Participant: member.ID})
+	case "board_annotate":
+		b.annotate(conn, member, message)
+	}
+}
+
+// annotate replaces the glyphs, comment and arrows of the node in message; b.mu
+// must be held
+func (b *analysisBoard) annotate(conn *connection, member *BoardMember, message Message) {
+	node, ok := b.nodes[message.Node]
+	if !ok {
+		b.conflict(conn)
+		return
+	}
+	if len(message.Comment) > maxCommentLength {
+		conn.Write(errorMessage(CodeInvalidMessage, "comment", "max"))
+		return
+	}
+	if len(message.Arrows) > maxArrows {
+		conn.Write(errorMessage(CodeInvalidMessage, "arrows", "max"))
+		return
+	}
+	if len(message.NAGs) > maxNAGs {
+		conn.Write(errorMessage(CodeInvalidMessage, "nags", "max"))
+		return
+	}
+	for _, nag := range message.NAGs {
+		if nag < 1 || nag > 255 {
+			conn.Write(errorMessage(CodeInvalidMessage, "nags", "nag"))
+			return
+		}
+	}
+	for _, arrow := range message.Arrows {
+		if !validArrow(arrow) {
+			conn.Write(errorMessage(CodeInvalidMessage, "arrows", "arrow"))
+			return
+		}
+	}
+	node.NAGs, node.Comment, node.Arrows = message.NAGs, message.Comment, message.Arrows
+	b.rev++
+	b.broadcast(Message{Type: "board_annotate", BoardID: b.id, Nodes: []BoardNode{node.BoardNode}, Rev: b.rev, Participant: member.ID})
+}
+
+// validArrow reports whether arrow goes from a square to another one
+func validArrow(arrow string) bool {
+	if len(arrow) != 4 || arrow[:2] == arrow[2:] {
+		return false
+	}
+	_, fromErr := chess.ParseSquare(arrow[:2])
+	_, toErr := chess.ParseSquare(arrow[2:])
+	return fromErr == nil && toErr == nil
+}
+
+// move plays the move in message after its parent; b.mu must be held
+func (b *analysisBoard) move(conn *connection, member *BoardMember, message Message) {
+	position := b.root
+	var parent *boardNode
+	if message.Parent != 0 {
+		found, ok := b.nodes[message.Parent]
+		if !ok {
+			b.conflict(conn)
+			return
+		}
+		parent, position = found, found.position
+	}
+	m, err := chess.ParseMove(message.Move().UCI())
+	if err != nil || !position.IsLegal(m) {
+		conn.Write(errorMessage(CodeIllegalMove))
+		return
+	}
+	uci := m.String()
+	for _, id := range b.children(parent) {
+		if b.nodes[id].Move == uci {
+			// made by somebody else already, it is the same node
+			conn.Write(Message{Type: "board_move", BoardID: b.id, Nodes: []BoardNode{b.nodes[id].BoardNode}, Rev: b.rev, MoveID: message.MoveID, Participant: member.ID})
+			return
+		}
+	}
+	if len(b.nodes) >= maxBoardNodes {
+		conn.Write(errorMessage(CodeBoardFull, strconv.Itoa(maxBoardNodes)))
+		return
+	}
+	b.lastID++
+	node := &boardNode{BoardNode: BoardNode{ID: b.lastID, Parent: message.Parent, Move: uci, SAN: position.SAN(m)}, position: position.Apply(m)}
+	b.nodes[node.ID] = node
+	if parent != nil {
+		parent.children = append(parent.children, node.ID)
+	}
+	b.rev++
+	b.broadcast(Message{Type: "board_move", BoardID: b.id, Nodes: []BoardNode{node.BoardNode}, Rev: b.rev, MoveID: message.MoveID, Participant: member.ID})
+}
+
+// children are the nodes played after parent, the root if it is nil;
+// b.mu must be held
+func (b *analysisBoard) children(parent *boardNode) []int {
+	if parent != nil {
+		return parent.children
+	}
+	var children []int
+	for id, node := range b.nodes {
+		if node.Parent == 0 {
+			children = append(children, id)
+		}
+	}
+	return children
+}
+
+// delete removes node and every node after it; b.mu must be held
+func (b *analysisBoard) delete(node *boardNode) {
+	for _, id := range node.children {
+		b.delete(b.nodes[id])
+	}
+	delete(b.nodes, node.ID)
+	if parent, ok := b.nodes[node.Parent]; ok {
+		for i, id := range parent.children {
+			if id == node.ID {
+				parent.children = append(parent.children[:i], parent.children[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// grant gives the member named in message the role in it, or everyone who
+// is not an owner if none is named; only owners grant roles
+func (b *analysisBoard) grant(conn *connection, member *BoardMember, message Message) {
+	if member.Role != "owner" {
+		conn.Write(errorMessage(CodeWrongRole))
+		return
+	}
+	if message.Role != "writer" && message.Role != "reader" {
+		conn.Write(errorMessage(CodeInvalidMessage, "role", "oneof"))
+		return
+	}
+	if message.Participant == "" {
+		b.defaultRole = message.Role
+	}
+	granted := false
+	for _, m := range b.members {
+		if m.Role != "owner" && (message.Participant == "" || m.ID == message.Participant) {
+			m.Role, granted = message.Role, true
+		}
+	}
+	if !granted && message.Participant != "" {
+		conn.Write(errorMessage(CodeInvalidMessage, "participant", "exists"))
+		return
+	}
+	b.broadcast(Message{Type: "board_access", BoardID: b.id, Participant: message.Participant, Role: message.Role})
+}
+
+// conflict refuses an operation made on a revision it cannot be applied
+// to, telling conn what the board is now; b.mu must be held
+func (b *analysisBoard) conflict(conn *connection) {
+	conn.Write(errorMessage(CodeBoardConflict))
+	b.welcome(conn)
+}
+
+// broadcast writes message to every member; b.mu must be held
+func (b *analysisBoard) broadcast(message Message) {
+	for conn := range b.members {
+		conn.Write(message)
+	}
+}
+
+// hangUp closes b, hanging up on every member
+func (b *analysisBoard) hangUp(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for conn := range b.members {
+		closeWithError(conn, err)
+	}
+}
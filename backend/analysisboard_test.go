@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestAnalysisBoard(t *testing.T) {
+	owner, guest := newTestPlayer(t), newTestPlayer(t)
+	joinAnalysisBoard(owner.conn, "new", "")
+	welcome := owner.expect("board")
+	if welcome.Role != "owner" || welcome.Token == "" || welcome.FEN != "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1" {
+		t.Fatalf("got %+v", welcome)
+	}
+	id := welcome.BoardID
+	joinAnalysisBoard(guest.conn, id, "")
+	if got := guest.expect("board"); got.Role != "reader" || got.Token != "" || len(got.Members) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	joined := owner.expect("board_joined")
+
+	guest.send(Message{Type: "board_move", From: "e2", To: "e4"})
+	guest.expect("error", CodeReadOnlyBoard)
+	guest.send(Message{Type: "board_grant", Participant: joined.Participant, Role: "writer"})
+	guest.expect("error", CodeWrongRole)
+	owner.send(Message{Type: "board_grant", Participant: joined.Participant, Role: "writer"})
+	owner.expect("board_access")
+	guest.expect("board_access")
+
+	// either side moves, in any variation
+	owner.send(Message{Type: "board_move", From: "e2", To: "e4", MoveID: "a"})
+	e4 := owner.expect("board_move").Nodes[0]
+	guest.expect("board_move")
+	guest.send(Message{Type: "board_move", Parent: e4.ID, From: "c7", To: "c5", Rev: 1})
+	owner.expect("board_move")
+	guest.expect("board_move")
+	owner.send(Message{Type: "board_move", From: "d2", To: "d4", Rev: 2})
+	owner.expect("board_move")
+	guest.expect("board_move")
+	owner.send(Message{Type: "board_move", Parent: e4.ID, From: "e2", To: "e4", Rev: 3})
+	owner.expect("error", CodeIllegalMove)
+
+	// made on an older revision, the same move is the same node
+	guest.send(Message{Type: "board_move", From: "e2", To: "e4", Rev: 1, MoveID: "b"})
+	if got := guest.expect("board_move"); got.Nodes[0].ID != e4.ID || got.Rev != 3 || got.MoveID != "b" {
+		t.Fatalf("got %+v", got)
+	}
+	owner.send(Message{Type: "board_delete", Node: e4.ID, Rev: 3})
+	owner.expect("board_delete")
+	guest.expect("board_delete")
+	guest.send(Message{Type: "board_move", Parent: e4.ID + 1, From: "g1", To: "f3", Rev: 3})
+	guest.expect("error", CodeBoardConflict)
+	if got := guest.expect("board"); got.Rev != 4 || len(got.Nodes) != 1 || got.Nodes[0].SAN != "d4" {
+		t.Fatalf("got %+v", got)
+	}
+	guest.send(Message{Type: "board_delete", Node: e4.ID, Rev: 3})
+	guest.expect("board_delete")
+
+	// a reset made on an older revision would throw away moves
+	guest.send(Message{Type: "board_reset", FEN: "8/8/8/8/8/8/8/K6k w - - 0 1", Rev: 3})
+	guest.expect("error", CodeBoardConflict)
+	guest.expect("board")
+	guest.send(Message{Type: "board_reset", FEN: "8/8/8/8/8/8/8/K6k w - - 0 1", Rev: 4})
+	owner.expect("board_reset")
+	if got := guest.expect("board_reset"); got.Rev != 5 {
+		t.Fatalf("got %+v", got)
+	}
+
+	guest.disconnect()
+	owner.expect("board_left")
+	owner.disconnect()
+	waitFor(t, func() bool {
+		_, ok := games.FindAnalysisBoard(id)
+		return !ok
+	})
+	late := newTestPlayer(t)
+	joinAnalysisBoard(late.conn, id, "")
+	late.expect("error", CodeBoardNotFound)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+	"github.com/alvaronaschez/simple-chess/engine"
+)
+
+// analysisWorkers are how many analyses run at once, analysisRate how many
+// a minute a client may ask for, in a burst if it likes
+var (
+	analysisWorkers = runtime.NumCPU()
+	analysisRate    = 10
+)
+
+// the lines and depth of an analysis unless asked otherwise, the most
+// that can be, and how long the engine thinks at most
+const (
+	defaultAnalysisLines = 3
+	maxAnalysisLines     = 5
+	defaultAnalysisDepth = 4
+	maxAnalysisDepth     = 6
+	analysisTime         = 2 * time.Second
+)
+
+type analysisRequest struct {
+	FEN   string `json:"fen"`
+	Lines int    `json:"lines,omitempty"`
+	Depth int    `json:"depth,omitempty"`
+}
+
+type analysisLine struct {
+	Moves []string `json:"moves"`
+	SAN   []string `json:"san"`
+	// Score is in centipawns for the side to move, Mate the moves to a
+	// forced mate instead, negative if the side to move is mated
+	Score int `json:"score"`
+	Mate  int `json:"mate,omitempty"`
+}
+
+type analysisResponse struct {
+	FEN   string         `json:"fen"`
+	Depth int            `json:"depth"`
+	Lines []analysisLine `json:"lines"`
+}
+
+// analyzeHandler answers the best lines the engine finds in the position
+// of a FEN posted as an analysisRequest
+func analyzeHandler(w http.ResponseWriter, r *http.Request) {
+	if ok, retry := analysisLimiter.allow(clientIP(r), time.Now()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		http.Error(w, "too many analyses, try again later", http.StatusTooManyRequests)
+		return
+	}
+	var req analysisRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid analysis request", http.StatusBadRequest)
+		return
+	}
+	position, err := parseLegalFEN(req.FEN)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Lines == 0 {
+		req.Lines = defaultAnalysisLines
+	}
+	if req.Depth == 0 {
+		req.Depth = defaultAnalysisDepth
+	}
+	if req.Lines < 1 || req.Lines > maxAnalysisLines || req.Depth < 1 || req.Depth > maxAnalysisDepth {
+		http.Error(w, fmt.Sprintf("an analysis has from 1 to %d lines and a depth from 1 to %d", maxAnalysisLines, maxAnalysisDepth), http.StatusBadRequest)
+		return
+	}
+
+	job := analysisJob{ctx: r.Context(), position: position, lines: req.Lines, depth: req.Depth, done: make(chan []engine.Line, 1)}
+	if !analyses.submit(job) {
+		http.Error(w, "every engine is busy, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	var lines []engine.Line
+	select {
+	case lines = <-job.done:
+	case <-r.Context().Done():
+		return
+	}
+	resp := analysisResponse{FEN: position.FEN(), Depth: req.Depth, Lines: []analysisLine{}}
+	for _, line := range lines {
+		out := analysisLine{Score: line.Score, Mate: line.Mate}
+		played := position
+		for _, m := range line.Moves {
+			out.Moves = append(out.Moves, m.String())
+			out.SAN = append(out.SAN, played.SAN(m))
+			played = played.Apply(m)
+		}
+		resp.Lines = append(resp.Lines, out)
+	}
+	writeJSON(w, resp)
+}
+
+// analysisJob is an analysis waiting for a worker, which hands its lines to done
+type analysisJob struct {
+	ctx      context.Context
+	position chess.Position
+	lines    int
+	depth    int
+	done     chan []engine.Line
+}
+
+// analysisPool runs the analyses on analysisWorkers workers, started on
+// the first one, queueing a few for each
+type analysisPool struct {
+	once sync.Once
+	jobs chan analysisJob
+}
+
+var analyses = &analysisPool{}
+
+// submit queues job, reporting false if the queue is full
+func (pool *analysisPool) submit(job analysisJob) bool {
+	pool.once.Do(func() {
+		workers := max(analysisWorkers, 1)
+		pool.jobs = make(chan analysisJob, 4*workers)
+		for range workers {
+			go pool.work()
+		}
+	})
+	select {
+	case pool.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+func (pool *analysisPool) work() {
+	for job := range pool.jobs {
+		// whoever asked for it may have given up while it was queued
+		if job.ctx.Err() != nil {
+			continue
+		}
+		job.done <- engine.Analyze(job.ctx, job.position, job.lines, job.depth, analysisTime)
+	}
+}
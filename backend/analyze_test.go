@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyze(t *testing.T) {
+	defer func(rate int) { analysisRate = rate }(analysisRate)
+	analysisRate = 0
+
+	w := httptest.NewRecorder()
+	body := `{"fen": "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "lines": 2, "depth": 3}`
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("POST", "/analyze", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var resp analysisResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Lines) != 2 {
+		t.Fatalf("got %+v", resp)
+	}
+	if best := resp.Lines[0]; best.Mate != 1 || best.Moves[0] != "a1a8" || best.SAN[0] != "Ra8#" {
+		t.Errorf("got %+v, want Ra8#", best)
+	}
+	if resp.Lines[1].Mate == 1 {
+		t.Errorf("got a second mate in one %+v", resp.Lines[1])
+	}
+
+	for _, body := range []string{
+		`{"fen": "not a fen"}`,
+		`{"fen": "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "lines": 6}`,
+		`{"fen": "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "depth": 7}`,
+		`not json`,
+	} {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("POST", "/analyze", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", body, w.Code)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	defer func(rate int) { analysisRate = rate }(analysisRate)
+	analysisRate = 2
+	l := &rateLimiter{rate: &analysisRate, buckets: map[string]*rateBucket{}}
+	now := time.Now()
+	for i := range 2 {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Fatalf("request %d refused", i)
+		}
+	}
+	ok, retry := l.allow("a", now)
+	if ok || retry != 30*time.Second {
+		t.Errorf("got %v, retry after %v", ok, retry)
+	}
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("another client refused")
+	}
+	if ok, _ := l.allow("a", now.Add(30*time.Second)); !ok {
+		t.Error("refused once refilled")
+	}
+}
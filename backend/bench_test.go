@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// discardTransport accepts every frame and never has any to read
+type discardTransport struct{}
+
+func (discardTransport) WriteFrame(frameType int, data []byte) error { return nil }
+func (discardTransport) ReadFrame() ([]byte, error)                  { select {} }
+func (discardTransport) Close(reason string) error                   { return nil }
+func (discardTransport) SupportsBinary() bool                        { return true }
+
+var benchmarkMove = Message{Type: "move", Seq: 42, MoveID: "3f9a1c2e", From: "e2", To: "e4", ServerTime: 1760400000000}
+
+func BenchmarkWriteMove(b *testing.B) {
+	for name, c := range codecs {
+		b.Run(name, func(b *testing.B) {
+			conn := newConnection(discardTransport{}, protocolVersion, c, defaultLanguage)
+			defer conn.Close("")
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := conn.write(benchmarkMove); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkForwardMove measures a move going through the game loop,
+// from the reader of one player to the transport of the other
+func BenchmarkForwardMove(b *testing.B) {
+	// the knights go back and forth, in games short enough for their
+	// length not to matter
+	moves := [][2]string{{"g1", "f3"}, {"g8", "f6"}, {"f3", "g1"}, {"f6", "g8"}}
+	const plies = 100
+	var players []*testPlayer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if i%plies == 0 {
+			b.StopTimer()
+			for _, player := range players {
+				player.disconnect()
+			}
+			_, white, black := startTestGame(b)
+			players = []*testPlayer{white, black}
+			b.StartTimer()
+		}
+		move := moves[i%len(moves)]
+		players[i%2].transport.toServer <- []byte(fmt.Sprintf(`{"type":"move","moveId":"%d","from":"%s","to":"%s"}`, i, move[0], move[1]))
+		<-players[(i+1)%2].transport.toClient
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// pieceMasks are the shapes the pieces are drawn with, x marks what is covered
+var pieceMasks = map[chess.PieceType][16]string{
+	chess.Pawn: {
+		"................",
+		"................",
+		"................",
+		"......xxxx......",
+		".....xxxxxx.....",
+		".....xxxxxx.....",
+		"......xxxx......",
+		".....xxxxxx.....",
+		"......xxxx......",
+		"......xxxx......",
+		".....xxxxxx.....",
+		"....xxxxxxxx....",
+		"...xxxxxxxxxx...",
+		"...xxxxxxxxxx...",
+		"................",
+		"................",
+	},
+	chess.Knight: {
+		"................",
+		"................",
+		".......xx.......",
+		"......xxxxx.....",
+		".....xxxxxxx....",
+		"....xxxxxxxxx...",
+		"...xxxxxxxxxx...",
+		"...xxx..xxxxx...",
+		"........xxxxx...",
+		".......xxxxxx...",
+		"......xxxxxx....",
+		".....xxxxxxx....",
+		"...xxxxxxxxxx...",
+		"...xxxxxxxxxx...",
+		"................",
+		"................",
+	},
+	chess.Bishop: {
+		"................",
+		".......xx.......",
+		"......xxxx......",
+		".....xxx.xx.....",
+		".....xx.xxx.....",
+		"....xxxxxxxx....",
+		"....xxxxxxxx....",
+		".....xxxxxx.....",
+		"......xxxx......",
+		"......xxxx......",
+		".....xxxxxx.....",
+		"....xxxxxxxx....",
+		"...xxxxxxxxxx...",
+		"...xxxxxxxxxx...",
+		"................",
+		"................",
+	},
+	chess.Rook: {
+		"................",
+		"................",
+		"...xx.xxxx.xx...",
+		"...xxxxxxxxxx...",
+		"...xxxxxxxxxx...",
+		"....xxxxxxxx....",
+		".....xxxxxx.....",
+		".....xxxxxx.....",
+		".....xxxxxx.....",
+		".....xxxxxx.....",
+		"....xxxxxxxx....",
+		"...xxxxxxxxxx...",
+		"..xxxxxxxxxxxx..",
+		"..xxxxxxxxxxxx..",
+		"................",
+		"................",
+	},
+	chess.Queen: {
+		"................",
+		"..x....xx....x..",
+		"..xx..xxxx..xx..",
+		"...xx.xxxx.xx...",
+		"...xxxxxxxxxx...",
+		"....xxxxxxxx....",
+		"....xxxxxxxx....",
+		".....xxxxxx.....",
+		".....xxxxxx.....",
+		"....xxxxxxxx....",
+		"...xxxxxxxxxx...",
+		"..xxxxxxxxxxxx..",
+		"..xxxxxxxxxxxx..",
+		"................",
+		"................",
+		"................",
+	},
+	chess.King: {
+		"................",
+		".......xx.......",
+		"......xxxx......",
+		".......xx.......",
+		"..xxx..xx..xxx..",
+		".xxxxxxxxxxxxxx.",
+		".xxxxxxxxxxxxxx.",
+		"..xxxxxxxxxxxx..",
+		"...xxxxxxxxxx...",
+		"....xxxxxxxx....",
+		"....xxxxxxxx....",
+		"...xxxxxxxxxx...",
+		"..xxxxxxxxxxxx..",
+		"..xxxxxxxxxxxx..",
+		"................",
+		"................",
+	},
+}
+
+// maskSize is the side of a square in the units the pieces are drawn in
+const maskSize = 16
+
+// the indexes of the colors of boardPalette
+const (
+	lightSquare = iota
+	darkSquare
+	lightHighlight
+	darkHighlight
+	whitePiece
+	blackPiece
+	pieceOutline
+)
+
+var boardPalette = color.Palette{
+	color.RGBA{0xf0, 0xd9, 0xb5, 0xff},
+	color.RGBA{0xb5, 0x88, 0x63, 0xff},
+	color.RGBA{0xcd, 0xd2, 0x6a, 0xff},
+	color.RGBA{0xaa, 0xa2, 0x3a, 0xff},
+	color.RGBA{0xff, 0xff, 0xff, 0xff},
+	color.RGBA{0x33, 0x33, 0x33, 0xff},
+	color.RGBA{0x00, 0x00, 0x00, 0xff},
+}
+
+// boardView is a position as it is drawn: from the side of a color,
+// with the squares of the last move highlighted
+type boardView struct {
+	position chess.Position
+	flipped  bool
+	// last is the move that led to position, if any
+	last *chess.Move
+}
+
+// cells are the palette indexes of a board maskSize units a square,
+// from its top left corner, which both the SVG and the images are drawn from
+func (view boardView) cells() [8 * maskSize][8 * maskSize]uint8 {
+	var cells [8 * maskSize][8 * maskSize]uint8
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			sq := chess.NewSquare(col, 7-row)
+			if view.flipped {
+				sq = chess.NewSquare(7-col, row)
+			}
+			background := uint8(lightSquare)
+			if (row+col)%2 == 1 {
+				background = darkSquare
+			}
+			if view.last != nil && (sq == view.last.From || sq == view.last.To) {
+				background += lightHighlight
+			}
+			piece := view.position.PieceAt(sq)
+			mask := pieceMasks[piece.Type()]
+			fill := uint8(whitePiece)
+			if piece.Color() == chess.Black {
+				fill = blackPiece
+			}
+			for y := 0; y < maskSize; y++ {
+				for x := 0; x < maskSize; x++ {
+					cell := background
+					switch {
+					case piece == chess.NoPiece || mask[y][x] != 'x':
+					case isMaskEdge(mask, x, y):
+						cell = pieceOutline
+					default:
+						cell = fill
+					}
+					cells[row*maskSize+y][col*maskSize+x] = cell
+				}
+			}
+		}
+	}
+	return cells
+}
+
+// isMaskEdge reports whether the covered point x, y of mask touches one that is not
+func isMaskEdge(mask [16]string, x, y int) bool {
+	for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+		nx, ny := x+d[0], y+d[1]
+		if nx < 0 || ny < 0 || nx >= maskSize || ny >= maskSize || mask[ny][nx] != 'x' {
+			return true
+		}
+	}
+	return false
+}
+
+// image draws the board scale pixels a unit, so a square is scale*maskSize wide
+func (view boardView) image(scale int) *image.Paletted {
+	side := 8 * maskSize * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), boardPalette)
+	cells := view.cells()
+	for y := 0; y < side; y++ {
+		row := cells[y/scale]
+		for x := 0; x < side; x++ {
+			img.Pix[y*img.Stride+x] = row[x/scale]
+		}
+	}
+	return img
+}
+
+// writeSVG draws the board with a path for every color, in runs of cells
+func (view boardView) writeSVG(w io.Writer, size int) error {
+	cells := view.cells()
+	paths := make([]strings.Builder, len(boardPalette))
+	for y, row := range cells {
+		for x := 0; x < len(row); {
+			end := x
+			for end < len(row) && row[end] == row[x] {
+				end++
+			}
+			fmt.Fprintf(&paths[row[x]], "M%d %dh%dv1h-%dz", x, y, end-x, end-x)
+			x = end
+		}
+	}
+	side := 8 * maskSize
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, side, side)
+	for i := range paths {
+		if err != nil || paths[i].Len() == 0 {
+			continue
+		}
+		r, g, b, _ := boardPalette[i].RGBA()
+		_, err = fmt.Fprintf(w, `<path fill="#%02x%02x%02x" d="%s"/>`, r>>8, g>>8, b>>8, paths[i].String())
+	}
+	if err == nil {
+		_, err = io.WriteString(w, "</svg>\n")
+	}
+	return err
+}
+
+const (
+	defaultBoardSize = 384
+	maxBoardSize     = 1024
+)
+
+// loadBoardView rebuilds the position a board image is asked for: the
+// current one, or after ?ply=N half-moves, seen from ?orientation=white or black
+func loadBoardView(w http.ResponseWriter, r *http.Request) (boardView, bool) {
+	state, ok := loadWatchedGame(w, r)
+	if !ok || notModified(w, r, state) {
+		return boardView{}, false
+	}
+	moves := state.Moves
+	if value := r.URL.Query().Get("ply"); value != "" {
+		ply, err := strconv.Atoi(value)
+		if err != nil || ply < 0 || ply > len(moves) {
+			http.Error(w, "invalid ply", http.StatusBadRequest)
+			return boardView{}, false
+		}
+		moves = moves[:ply]
+	}
+	flipped, ok := boardFlipped(w, r)
+	if !ok {
+		return boardView{}, false
+	}
+	view := boardView{flipped: flipped}
+	var played int
+	view.position, played = positionAfter(state.FEN, moves)
+	if played > 0 {
+		m := moves[played-1]
+		if last, err := chess.ParseMove(m.UCI()); err == nil {
+			view.last = &last
+		}
+	}
+	return view, true
+}
+
+// boardFlipped reports whether the board is seen from black, ?orientation=black
+func boardFlipped(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	switch r.URL.Query().Get("orientation") {
+	case "", "white":
+		return false, true
+	case "black":
+		return true, true
+	}
+	http.Error(w, "invalid orientation", http.StatusBadRequest)
+	return false, false
+}
+
+// boardSize is the ?size=N in pixels of a board image, at most maxBoardSize
+func boardSize(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("size")
+	if value == "" {
+		return defaultBoardSize, true
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 8*maskSize || size > maxBoardSize {
+		http.Error(w, "invalid size", http.StatusBadRequest)
+		return 0, false
+	}
+	return size, true
+}
+
+func boardSVGHandler(w http.ResponseWriter, r *http.Request) {
+	size, ok := boardSize(w, r)
+	if !ok {
+		return
+	}
+	view, ok := loadBoardView(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	view.writeSVG(w, size)
+}
+
+// boardPNGHandler draws the board as close to ?size as whole units allow
+func boardPNGHandler(w http.ResponseWriter, r *http.Request) {
+	size, ok := boardSize(w, r)
+	if !ok {
+		return
+	}
+	view, ok := loadBoardView(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, view.image(size/(8*maskSize)))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func getBoard(t *testing.T, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestBoardImages(t *testing.T) {
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	waitFor(t, func() bool { return len(game.recorder.State().Moves) == 1 })
+
+	w := getBoard(t, "/games/"+game.id+"/board.png?size=256&orientation=black")
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 256 {
+		t.Errorf("got a %v image", img.Bounds())
+	}
+
+	w = getBoard(t, "/games/"+game.id+"/board.svg?ply=0")
+	if w.Header().Get("Content-Type") != "image/svg+xml" || !strings.HasPrefix(w.Body.String(), "<svg") {
+		t.Errorf("got %s", w.Body)
+	}
+	// nothing was moved yet, so nothing is highlighted
+	if strings.Contains(w.Body.String(), "#cdd26a") {
+		t.Error("a move is highlighted before the first one")
+	}
+	for _, query := range []string{"ply=2", "size=10", "orientation=up"} {
+		if w := getBoard(t, "/games/"+game.id+"/board.svg?"+query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", query, w.Code)
+		}
+	}
+}
+
+func TestGameGIF(t *testing.T) {
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	if w := getBoard(t, "/games/"+game.id+"/gif"); w.Code != http.StatusConflict {
+		t.Errorf("got %d for a game being played", w.Code)
+	}
+	black.send(Message{Type: "resign"})
+	white.expect("game_over")
+	waitFor(t, func() bool { return game.recorder.State().Finished })
+
+	w := getBoard(t, "/games/"+game.id+"/gif?delay=500ms&size=128")
+	animation, err := gif.DecodeAll(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(animation.Image) != 2 || animation.Delay[0] != 50 || animation.Delay[1] != 50*gifFinalPause {
+		t.Errorf("got %d frames, delays %v", len(animation.Image), animation.Delay)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+)
+
+// bracketChat is the key of the chat of the bracket id among the comments,
+// kept apart from those on games
+func bracketChat(id string) string {
+	return "bracket-" + id
+}
+
+// bracketChatHandler leaves a chat message posted as a commentRequest in
+// the chat of a bracket, moderated as comments and kibitz on games are:
+// the comment hooks run on it, and banned clients cannot post, shadow
+// muted ones only to themselves. Everyone following the bracket is shown
+// it, those taking part and spectators alike, unless they muted its
+// author. It is answered with its token, which removes it
+func bracketChatHandler(w http.ResponseWriter, r *http.Request) {
+	if isBanned(r) {
+		http.Error(w, ErrBanned.Error(), http.StatusForbidden)
+		return
+	}
+	b, ok := games.FindBracket(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	comment, ok := readComment(w, r, bracketChat(b.id))
+	if ok && addComment(w, bracketChat(b.id), &comment) {
+		published := comment
+		published.Token = ""
+		bracketFeed.publish(b.id, bracketNews{message: Message{Type: "bracket_chat", BracketID: b.id}, comment: &published})
+		writeJSON(w, postedComment(comment))
+	}
+}
+
+// deleteBracketChatHandler removes a chat message for its author, as
+// deleteCommentHandler does, and moderateBracketChatHandler any, for the
+// admins; those following the bracket are told with bracket_chat_removed
+func deleteBracketChatHandler(w http.ResponseWriter, r *http.Request) {
+	removeBracketChat(w, r, byAuthor(r))
+}
+
+func moderateBracketChatHandler(w http.ResponseWriter, r *http.Request) {
+	removeBracketChat(w, r, func(Comment) bool { return true })
+}
+
+func removeBracketChat(w http.ResponseWriter, r *http.Request, allowed func(Comment) bool) {
+	id := r.PathValue("id")
+	var removed Comment
+	ok := removeComment(w, r, bracketChat(id), func(comment Comment) bool {
+		removed = comment
+		return allowed(comment)
+	})
+	if ok {
+		bracketFeed.publish(id, bracketNews{message: Message{Type: "bracket_chat_removed", BracketID: id, Chat: &Comment{ID: removed.ID, Removed: true}}})
+	}
+}
+
+// chatSoFar is the chat of the bracket id reader is shown, without the
+// messages removed
+func chatSoFar(reader commentReader, id string) ([]Comment, error) {
+	list, err := comments.Load(bracketChat(id))
+	if err != nil {
+		return nil, err
+	}
+	list = slices.DeleteFunc(list, func(c Comment) bool { return c.Removed })
+	return reader.visible(list), nil
+}
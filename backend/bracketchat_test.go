@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBracketChat(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	troll := Player{ID: "troll", Name: "troll"}
+	startSession(&troll, "test")
+	players.Create(troll)
+	b := openTestBracket(t, singleElimination, "a", "b")
+
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, r)
+		return w
+	}
+	player := newTestPlayer(t)
+	joinBracket(player.conn, b.id, commentReader{client: "player:a", muted: []string{"troll"}})
+	player.expect("bracket_match")
+
+	w := request("POST", "/brackets/"+b.id+"/chat", "", `{"author":"ana","text":"good luck"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	posted := Comment{}
+	if err := json.Unmarshal(w.Body.Bytes(), &posted); err != nil || posted.Token == "" {
+		t.Fatalf("got %s", w.Body)
+	}
+	if got := player.expect("bracket_chat"); got.Chat == nil || got.Chat.Text != "good luck" || got.Chat.Poster != "" {
+		t.Errorf("got %+v", got.Chat)
+	}
+	// those muted are not shown to whoever mutes them
+	if w := request("POST", "/brackets/"+b.id+"/chat", troll.Token, `{"author":"troll","text":"boo"}`); w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+
+	spectator := newTestPlayer(t)
+	joinBracket(spectator.conn, b.id, commentReader{client: "ip:192.0.2.1"})
+	spectator.expect("bracket_match")
+	spectator.expect("bracket_chat")
+	if got := spectator.expect("bracket_chat"); got.Chat.Text != "boo" {
+		t.Errorf("got %+v", got.Chat)
+	}
+
+	path := "/brackets/" + b.id + "/chat/1"
+	if w := request("DELETE", path, "wrong", ""); w.Code != http.StatusForbidden {
+		t.Errorf("got %d removing with a wrong token", w.Code)
+	}
+	if w := request("DELETE", path, posted.Token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	for _, follower := range []*testPlayer{player, spectator} {
+		if got := follower.expect("bracket_chat_removed"); got.Chat == nil || got.Chat.ID != 1 {
+			t.Errorf("got %+v", got)
+		}
+	}
+	if w := request("POST", "/brackets/nope/chat", "", `{"author":"ana","text":"hi"}`); w.Code != http.StatusNotFound {
+		t.Errorf("got %d in a bracket that is not there", w.Code)
+	}
+}
@@ -0,0 +1,790 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBracketNotFound    = errors.New("bracket not found")
+	ErrInvalidBracket     = errors.New("invalid bracket")
+	ErrBracketFull        = errors.New("bracket full")
+	ErrRegistrationClosed = errors.New("bracket registration closed")
+)
+
+// the formats of a bracket: a player is out after losing a match in a
+// single elimination one, after losing two in a double elimination one
+const (
+	singleElimination = "single"
+	doubleElimination = "double"
+)
+
+// maxBracketPlayers bounds the players of a bracket, and maxBracketDelay
+// how far ahead a bracket may be scheduled
+const (
+	maxBracketPlayers = 64
+	maxBracketDelay   = 30 * 24 * time.Hour
+)
+
+// bracketReminder is how long before a scheduled bracket starts its
+// players are reminded of it
+var bracketReminder = 15 * time.Minute
+
+// bracketSlot is where a player of a match comes from: the seed, counting
+// from 1, or the winner or the loser of an earlier match
+type bracketSlot struct {
+	seed   int
+	winner *bracketMatch
+	loser  *bracketMatch
+}
+
+// bracketMatch is a pairing of the winners or losers section of a bracket,
+// or of its final, played until a game of it is decisive: a drawn or
+// aborted game is played again with colors reversed. A player against
+// nobody, as seeded against a bye, goes through without playing, Bye set
+type bracketMatch struct {
+	ID      int      `json:"id"`
+	Section string   `json:"section"`
+	Round   int      `json:"round"`
+	Players []string `json:"players"`
+	Games   []string `json:"games"`
+	Decided bool     `json:"decided"`
+	Winner  string   `json:"winner,omitempty"`
+	Bye     bool     `json:"bye,omitempty"`
+
+	from  [2]bracketSlot
+	loser string
+	// reset is the second game of the grand final, only played if the
+	// first one is won by the player coming from the losers section
+	reset bool
+	// game is the one being played, its white player white
+	game  *ChessGame
+	white string
+}
+
+// bracket is a knockout tournament between players by account, seeded best
+// first: the first round takes as many as the power of two above them,
+// the best seeds getting byes for the players missing, and the winners of
+// every match meet in the next round until one is left. In a double
+// elimination bracket the losers of the winners section play on in the
+// losers section, whose winner meets that of the winners section in the
+// grand final. Every game is created for its players to join with the
+// token of their seat, see CreateGame, and the bracket advances as they end.
+// A bracket scheduled for startsAt is open for players to register until
+// then, and seeds them by rating as it starts; one starting with fewer than
+// two players is cancelled. Players registering late, for lateJoin after it
+// starts, take the byes left in the first round, whose matches wait for them
+type bracket struct {
+	id       string
+	format   string
+	options  GameOptions
+	startsAt time.Time
+	lateJoin time.Duration
+
+	mu sync.Mutex
+	// seeds are the players registered, best first once started
+	seeds     []string
+	started   bool
+	cancelled bool
+	lateUntil time.Time
+	// awarded is set once the trophies of the podium are, see award
+	awarded bool
+	// matches are in the order they are played, those a match comes from
+	// before it, the last one deciding the bracket
+	matches []*bracketMatch
+	// over is when the janitor found the bracket over, zero until then
+	over time.Time
+}
+
+// bracketNews is a message about a bracket, sent only to player if set,
+// or carrying comment of its chat to those who see it
+type bracketNews struct {
+	message Message
+	player  string
+	comment *Comment
+}
+
+// bracketFeed hands what goes on in brackets to the connections following
+// them, by bracket
+var bracketFeed = newEventFeeds[bracketNews]()
+
+func init() {
+	bus.subscribe(busGameFinished, func(event busEvent) {
+		for _, b := range games.Brackets() {
+			b.gameFinished(event.State)
+		}
+	})
+}
+
+// OpenBracket registers b, starting it now unless it is scheduled, and
+// then at b.startsAt, its players reminded of it bracketReminder before
+func (m *gameManager) OpenBracket(b *bracket) error {
+	m.mu.Lock()
+	if err := m.canCreate(); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.brackets[b.id] = b
+	m.mu.Unlock()
+	wait := time.Until(b.startsAt)
+	if wait <= 0 {
+		b.start()
+		return nil
+	}
+	time.AfterFunc(wait, b.start)
+	if wait > bracketReminder {
+		time.AfterFunc(wait-bracketReminder, b.remind)
+	}
+	return nil
+}
+
+func (m *gameManager) FindBracket(id string) (*bracket, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.brackets[id]
+	return b, ok
+}
+
+func (m *gameManager) Brackets() []*bracket {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]*bracket, 0, len(m.brackets))
+	for _, b := range m.brackets {
+		list = append(list, b)
+	}
+	return list
+}
+
+// newBracket is a bracket of format between seeds, best first, its games
+// created with options
+func newBracket(format string, seeds []string, options GameOptions) *bracket {
+	return &bracket{id: newGameID(), format: format, seeds: seeds, options: options}
+}
+
+// start closes the registration of b and lays out its matches, starting
+// the games of those ready to be played
+func (b *bracket) start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.started {
+		return
+	}
+	b.started = true
+	if !b.startsAt.IsZero() {
+		b.seedByRating()
+	}
+	if len(b.seeds) < 2 {
+		b.cancelled = true
+		bracketFeed.publish(b.id, bracketNews{message: b.overNews()})
+		return
+	}
+	b.layout()
+	if b.lateJoin > 0 {
+		b.lateUntil = time.Now().Add(b.lateJoin)
+		time.AfterFunc(b.lateJoin, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.advance()
+		})
+	}
+	for _, m := range b.matches {
+		b.known(m)
+		b.publish(m)
+	}
+	b.advance()
+}
+
+// seedByRating sorts the seeds of b by their rating in the pool of its
+// games, the best first
+func (b *bracket) seedByRating() {
+	tc, ok := b.options.clock()
+	if !ok {
+		tc = timeControl
+	}
+	pool := ratingPool(GameState{TimeControl: tc})
+	ratings := map[string]int{}
+	for _, player := range b.seeds {
+		ratings[player], _ = poolRating(player, pool)
+	}
+	slices.SortStableFunc(b.seeds, func(x, y string) int { return ratings[y] - ratings[x] })
+}
+
+// remind tells the players of b, by webhook, and those following it that
+// it starts soon
+func (b *bracket) remind() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.started {
+		return
+	}
+	for _, player := range b.seeds {
+		notifyWebhooks(player, webhookBracketStarting, startingBracket{ID: b.id, StartsAt: b.startsAt})
+		notify(players, player, Notification{Kind: notificationBracketStarting, Bracket: b.id})
+	}
+	bracketFeed.publish(b.id, bracketNews{message: Message{Type: "bracket_reminder", BracketID: b.id, Deadline: b.startsAt.UnixMilli()}})
+}
+
+// Register adds player to b: up to maxBracketPlayers before it starts,
+// and to take a bye of the first round for lateJoin after it does
+func (b *bracket) Register(player string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if slices.Contains(b.seeds, player) {
+		return nil
+	}
+	switch {
+	case !b.started && len(b.seeds) >= maxBracketPlayers:
+		return ErrBracketFull
+	case b.started && (b.cancelled || !time.Now().Before(b.lateUntil)):
+		return ErrRegistrationClosed
+	case b.started && len(b.seeds) >= b.size():
+		return ErrBracketFull
+	}
+	b.seeds = append(b.seeds, player)
+	bracketFeed.publish(b.id, bracketNews{message: Message{Type: "bracket_registered", BracketID: b.id, Participant: player}})
+	if b.started {
+		b.advance()
+	}
+	return nil
+}
+
+// Withdraw takes player out of b before it starts
+func (b *bracket) Withdraw(player string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.started {
+		return ErrRegistrationClosed
+	}
+	if i := slices.Index(b.seeds, player); i >= 0 {
+		b.seeds = slices.Delete(b.seeds, i, i+1)
+		bracketFeed.publish(b.id, bracketNews{message: Message{Type: "bracket_withdrawn", BracketID: b.id, Participant: player}})
+	}
+	return nil
+}
+
+// size is how many players the first round of b takes, byes included
+func (b *bracket) size() int {
+	n := 0
+	for _, m := range b.matches {
+		if m.Section == "winners" && m.Round == 1 {
+			n += 2
+		}
+	}
+	return n
+}
+
+// layout lays out the matches of b between its seeds. Seeds are paired in
+// the first round as the best and the worst one left, their matches in the
+// order keeping the best seeds apart until the end
+func (b *bracket) layout() {
+	order := []int{1, 2}
+	for len(order) < len(b.seeds) {
+		next := make([]int, 0, 2*len(order))
+		for _, seed := range order {
+			next = append(next, seed, 2*len(order)+1-seed)
+		}
+		order = next
+	}
+	round := []*bracketMatch{}
+	for i := 0; i < len(order); i += 2 {
+		round = append(round, b.add("winners", 1, bracketSlot{seed: order[i]}, bracketSlot{seed: order[i+1]}))
+	}
+	winners := [][]*bracketMatch{round}
+	for r := 2; len(round) > 1; r++ {
+		round = b.addRound("winners", r, round)
+		winners = append(winners, round)
+	}
+	if b.format == singleElimination {
+		return
+	}
+	// the losers of the first round play each other, those left in the
+	// losers section then take on the losers of every next round of the
+	// winners section, playing each other in between to halve again
+	champion := bracketSlot{winner: round[0]}
+	contender := bracketSlot{loser: round[0]}
+	if len(winners) > 1 {
+		round = []*bracketMatch{}
+		for i := 0; i < len(winners[0]); i += 2 {
+			round = append(round, b.add("losers", 1, bracketSlot{loser: winners[0][i]}, bracketSlot{loser: winners[0][i+1]}))
+		}
+		r := 2
+		for _, dropped := range winners[1:] {
+			next := []*bracketMatch{}
+			for i, m := range round {
+				next = append(next, b.add("losers", r, bracketSlot{winner: m}, bracketSlot{loser: dropped[i]}))
+			}
+			round = next
+			r++
+			if len(round) > 1 {
+				round = b.addRound("losers", r, round)
+				r++
+			}
+		}
+		contender = bracketSlot{winner: round[0]}
+	}
+	final := b.add("final", 1, champion, contender)
+	b.add("final", 2, bracketSlot{winner: final}, bracketSlot{loser: final}).reset = true
+}
+
+// add appends the match of section and round between the players of from
+func (b *bracket) add(section string, round int, from ...bracketSlot) *bracketMatch {
+	m := &bracketMatch{ID: len(b.matches) + 1, Section: section, Round: round, Players: []string{"", ""}, Games: []string{}, from: [2]bracketSlot(from)}
+	b.matches = append(b.matches, m)
+	return m
+}
+
+// addRound appends the round of section between the winners of the
+// matches of the one before, two by two
+func (b *bracket) addRound(section string, round int, before []*bracketMatch) []*bracketMatch {
+	matches := []*bracketMatch{}
+	for i := 0; i < len(before); i += 2 {
+		matches = append(matches, b.add(section, round, bracketSlot{winner: before[i]}, bracketSlot{winner: before[i+1]}))
+	}
+	return matches
+}
+
+// player is who slot stands for, nobody for a bye, and whether it is
+// known yet: a bye is not while players may still register late
+func (b *bracket) player(slot bracketSlot) (string, bool) {
+	switch {
+	case slot.winner != nil:
+		return slot.winner.Winner, slot.winner.Decided
+	case slot.loser != nil:
+		return slot.loser.loser, slot.loser.Decided
+	case slot.seed <= len(b.seeds):
+		return b.seeds[slot.seed-1], true
+	}
+	return "", !time.Now().Before(b.lateUntil)
+}
+
+// known fills in the players of m known, reporting whether both are
+func (b *bracket) known(m *bracketMatch) bool {
+	known := true
+	for i, slot := range m.from {
+		player, ok := b.player(slot)
+		m.Players[i], known = player, known && ok
+	}
+	return known
+}
+
+// advance decides the matches whose players are known without playing
+// them, if they may, and starts a game of the others waiting for one. A
+// game that cannot be created, with the server draining, is left to the
+// janitor to try again; b.mu must be held
+func (b *bracket) advance() {
+	for _, m := range b.matches {
+		if m.Decided || m.game != nil {
+			continue
+		}
+		if !b.known(m) {
+			continue
+		}
+		first := m.from[0].winner
+		switch {
+		case m.reset && first.Winner == first.Players[0]:
+			// the grand final was won from the winners section
+			m.decide(m.Players[0])
+			m.Bye = true
+		case m.Players[0] == "" || m.Players[1] == "":
+			m.decide(m.Players[0] + m.Players[1])
+			m.Bye = true
+		default:
+			b.play(m)
+			continue
+		}
+		b.publish(m)
+	}
+	if _, over := b.champion(); over && !b.awarded {
+		b.awarded = true
+		b.award()
+		bracketFeed.publish(b.id, bracketNews{message: b.overNews()})
+	}
+}
+
+// overNews tells the champion of b, or that it was cancelled
+func (b *bracket) overNews() Message {
+	champion, _ := b.champion()
+	news := Message{Type: "bracket_over", BracketID: b.id, Participant: champion}
+	if b.cancelled {
+		news.Reason = "cancelled"
+	}
+	return news
+}
+
+// play creates the next game of m, the first player white in the first
+// one and colors reversed every game, and hands its players their seats
+func (b *bracket) play(m *bracketMatch) {
+	game, err := games.CreateGame(b.options)
+	if err != nil {
+		return
+	}
+	m.game, m.white = game, m.Players[len(m.Games)%2]
+	m.Games = append(m.Games, game.id)
+	b.publish(m)
+	for _, player := range m.Players {
+		bracketFeed.publish(b.id, bracketNews{message: b.gameNews(m, player), player: player})
+	}
+}
+
+// gameNews tells player the game of m they are to play, and the token of
+// their seat
+func (b *bracket) gameNews(m *bracketMatch, player string) Message {
+	color := "white"
+	if player != m.white {
+		color = "black"
+	}
+	return Message{Type: "bracket_game", BracketID: b.id, Board: m.ID, GameID: m.game.id, Color: color, Token: m.game.tokens[color]}
+}
+
+// playing is the match of b player is playing a game of now, if any;
+// b.mu must be held
+func (b *bracket) playing(player string) (*bracketMatch, bool) {
+	for _, m := range b.matches {
+		if m.game != nil && slices.Contains(m.Players, player) {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// gameFinished decides the match state is a game of as it ends: a player
+// goes through winning it, or by showing up to it alone, and nobody if
+// neither did. advance plays it again otherwise
+func (b *bracket) gameFinished(state GameState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, m := range b.matches {
+		if m.game == nil || m.game.id != state.ID {
+			continue
+		}
+		m.game = nil
+		black := m.opponent(m.white)
+		switch {
+		case state.Result == "1-0", state.Result == "" && state.White && !state.Black:
+			m.decide(m.white)
+		case state.Result == "0-1", state.Result == "" && state.Black && !state.White:
+			m.decide(black)
+		case state.Result == "" && !state.White:
+			m.decide("")
+		}
+		b.publish(m)
+		b.advance()
+		return
+	}
+}
+
+func (m *bracketMatch) decide(winner string) {
+	m.Decided, m.Winner = true, winner
+	if winner != "" {
+		m.loser = m.opponent(winner)
+	}
+}
+
+// opponent is the other player of m than player
+func (m *bracketMatch) opponent(player string) string {
+	if m.Players[0] == player {
+		return m.Players[1]
+	}
+	return m.Players[0]
+}
+
+// champion is the winner of b, nobody if every player failed to show up,
+// and whether it is over, as it is once cancelled
+func (b *bracket) champion() (string, bool) {
+	if len(b.matches) == 0 {
+		return "", b.cancelled
+	}
+	last := b.matches[len(b.matches)-1]
+	return last.Winner, last.Decided
+}
+
+func (b *bracket) publish(m *bracketMatch) {
+	view := m.view()
+	bracketFeed.publish(b.id, bracketNews{message: Message{Type: "bracket_match", BracketID: b.id, BracketMatch: &view}})
+}
+
+// view is a copy of m as it is now
+func (m *bracketMatch) view() bracketMatch {
+	return bracketMatch{ID: m.ID, Section: m.Section, Round: m.Round, Players: slices.Clone(m.Players), Games: slices.Clone(m.Games), Decided: m.Decided, Winner: m.Winner, Bye: m.Bye}
+}
+
+// bracketView answers GET /brackets/{id}: the players registered until it
+// starts, and the matches once it does
+type bracketView struct {
+	ID       string         `json:"id"`
+	Format   string         `json:"format"`
+	Seeds    []string       `json:"seeds"`
+	Rules    GameOptions    `json:"rules"`
+	StartsAt *time.Time     `json:"startsAt,omitempty"`
+	Started  bool           `json:"started"`
+	LateJoin string         `json:"lateJoin,omitempty"`
+	Matches  []bracketMatch `json:"matches"`
+	Over     bool           `json:"over"`
+	Champion string         `json:"champion,omitempty"`
+	// Cancelled brackets started with fewer than two players
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+func (b *bracket) view() bracketView {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	view := bracketView{ID: b.id, Format: b.format, Seeds: slices.Clone(b.seeds), Rules: b.options, Started: b.started, Matches: []bracketMatch{}, Cancelled: b.cancelled}
+	if !b.startsAt.IsZero() {
+		startsAt := b.startsAt
+		view.StartsAt = &startsAt
+	}
+	if b.lateJoin > 0 {
+		view.LateJoin = shortDuration(b.lateJoin)
+	}
+	for _, m := range b.matches {
+		view.Matches = append(view.Matches, m.view())
+	}
+	view.Champion, view.Over = b.champion()
+	return view
+}
+
+// seat is the seat of player in the game they are to play in b now
+func (b *bracket) seat(player string) (gameSeat, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m, ok := b.playing(player)
+	if !ok {
+		return gameSeat{}, false
+	}
+	return m.game.seat(b.gameNews(m, player).Color), true
+}
+
+// sweep reports whether b has been over for finishedGrace at now, and how
+// many games it played; one not over is advanced, for the games that could
+// not be created to be
+func (b *bracket) sweep(now time.Time) (bool, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, over := b.champion(); !over {
+		b.advance()
+		b.over = time.Time{}
+		return false, 0
+	}
+	if b.over.IsZero() {
+		b.over = now
+	}
+	played := 0
+	for _, m := range b.matches {
+		played += len(m.Games)
+	}
+	return now.Sub(b.over) >= finishedGrace, played
+}
+
+// maxLateJoin bounds how long after a bracket starts players may register
+const maxLateJoin = time.Hour
+
+// bracketRequest is the body of POST /brackets: the players by account,
+// best first, and the options of every game. A bracket starting later, at
+// StartsAt, takes players registering until then, and after it for
+// LateJoin, as in 10m
+type bracketRequest struct {
+	Format   string      `json:"format"`
+	Players  []string    `json:"players"`
+	Options  GameOptions `json:"options"`
+	StartsAt time.Time   `json:"startsAt"`
+	LateJoin string      `json:"lateJoin"`
+}
+
+// createBracketHandler opens the bracket posted by the player
+// authenticated, see OpenBracket
+func createBracketHandler(w http.ResponseWriter, r *http.Request) {
+	player, err := requestPlayer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	request := bracketRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if field := request.check(player.ID); field != "" {
+		http.Error(w, ErrInvalidBracket.Error()+": "+field, http.StatusBadRequest)
+		return
+	}
+	b := newBracket(request.Format, request.Players, request.Options)
+	b.startsAt = request.StartsAt
+	if request.LateJoin != "" {
+		b.lateJoin, _ = time.ParseDuration(request.LateJoin)
+	}
+	err = games.OpenBracket(b)
+	switch {
+	case errors.Is(err, ErrDraining), errors.Is(err, ErrServerFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, b.view())
+}
+
+// check is the field of request at fault, if any: the format must be
+// known, the players up to maxBracketPlayers accounts each listed once, at
+// least 2 unless players register later, the start within maxBracketDelay
+// and the options those of a game created by player
+func (request bracketRequest) check(player string) string {
+	if request.Format != singleElimination && request.Format != doubleElimination {
+		return "format"
+	}
+	if until := time.Until(request.StartsAt); !request.StartsAt.IsZero() && (until <= 0 || until > maxBracketDelay) {
+		return "startsAt"
+	}
+	if len(request.Players) < 2 && request.StartsAt.IsZero() || len(request.Players) > maxBracketPlayers {
+		return "players"
+	}
+	if request.LateJoin != "" {
+		if d, err := time.ParseDuration(request.LateJoin); err != nil || d < 0 || d > maxLateJoin {
+			return "lateJoin"
+		}
+	}
+	for i, id := range request.Players {
+		if slices.Contains(request.Players[:i], id) {
+			return "players"
+		}
+		if _, err := players.Load(id); err != nil {
+			return "players"
+		}
+	}
+	if field := request.Options.checkCreated(player); field != "" {
+		return "options." + field
+	}
+	return ""
+}
+
+func bracketHandler(w http.ResponseWriter, r *http.Request) {
+	b, ok := games.FindBracket(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, b.view())
+}
+
+// bracketRegisterHandler registers the player authenticated in the
+// bracket, see Register, and bracketWithdrawHandler takes them out of it
+func bracketRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	bracketRegistration(w, r, (*bracket).Register)
+}
+
+func bracketWithdrawHandler(w http.ResponseWriter, r *http.Request) {
+	bracketRegistration(w, r, (*bracket).Withdraw)
+}
+
+func bracketRegistration(w http.ResponseWriter, r *http.Request, change func(*bracket, string) error) {
+	player, err := requestPlayer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	b, ok := games.FindBracket(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if err := change(b, player.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, b.view())
+}
+
+// bracketSeatHandler answers the player authenticated with their seat in
+// the game they are to play in the bracket, not found between games
+func bracketSeatHandler(w http.ResponseWriter, r *http.Request) {
+	player, err := requestPlayer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	b, ok := games.FindBracket(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	seat, ok := b.seat(player.ID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, seat)
+}
+
+// joinBracket has conn follow the bracket id: it is sent every match of
+// it, then every match as it changes, and, if its player is in it, the
+// seat of every game they are to play, as bracket_game with the token to
+// resume it with. bracket_over tells the champion, nobody if no player
+// showed up. It is in the chat of the bracket as well, sent the messages
+// left so far reader sees, then those left and removed, see
+// bracketChatHandler. A connection falling behind is closed, to reconnect
+// and start over
+func joinBracket(conn *connection, id string, reader commentReader) {
+	b, ok := games.FindBracket(id)
+	if !ok {
+		closeWithError(conn, ErrBracketNotFound, id)
+		return
+	}
+	news, cancel := bracketFeed.subscribe(id)
+	said, err := chatSoFar(reader, id)
+	if err != nil {
+		cancel()
+		closeWithError(conn, err)
+		return
+	}
+	b.mu.Lock()
+	for _, m := range b.matches {
+		view := m.view()
+		conn.Write(Message{Type: "bracket_match", BracketID: id, BracketMatch: &view})
+	}
+	if m, ok := b.playing(conn.player); ok && conn.player != "" {
+		conn.Write(b.gameNews(m, conn.player))
+	}
+	if !b.started {
+		conn.Write(Message{Type: "bracket_scheduled", BracketID: id, Deadline: b.startsAt.UnixMilli()})
+	}
+	if _, over := b.champion(); over {
+		conn.Write(b.overNews())
+	}
+	b.mu.Unlock()
+	// what is left while loading comes again from the feed
+	lastSaid := 0
+	for _, comment := range said {
+		conn.Write(Message{Type: "bracket_chat", BracketID: id, Chat: &comment})
+		lastSaid = comment.ID
+	}
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case item, ok := <-news:
+				if !ok {
+					conn.Close(errSlowClient.Error())
+					return
+				}
+				if c := item.comment; c != nil {
+					if c.ID <= lastSaid || !reader.sees(*c) {
+						continue
+					}
+					item.message.Chat = &publicComments([]Comment{*c})[0]
+				}
+				if item.player == "" || item.player == conn.player {
+					conn.Write(item.message)
+				}
+			case <-conn.closed:
+				return
+			}
+		}
+	}()
+	go listenOnly(conn)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewBracket(t *testing.T) {
+	b := newBracket(singleElimination, []string{"a", "b", "c", "d", "e"}, GameOptions{})
+	b.layout()
+	if len(b.matches) != 7 {
+		t.Fatalf("got %d matches", len(b.matches))
+	}
+	// the best seeds are kept apart until the end
+	for i, want := range [][2]int{{1, 8}, {4, 5}, {2, 7}, {3, 6}} {
+		if from := b.matches[i].from; from[0].seed != want[0] || from[1].seed != want[1] {
+			t.Errorf("match %d between seeds %d and %d", i+1, from[0].seed, from[1].seed)
+		}
+	}
+
+	b = newBracket(doubleElimination, []string{"a", "b", "c", "d", "e", "f", "g", "h"}, GameOptions{})
+	b.layout()
+	sections := map[string]int{}
+	for _, m := range b.matches {
+		sections[m.Section]++
+	}
+	if sections["winners"] != 7 || sections["losers"] != 6 || sections["final"] != 2 {
+		t.Errorf("got %v", sections)
+	}
+	// the loser of the final of the winners section plays the last round
+	// of the losers section
+	winnersFinal := b.matches[6]
+	if last := b.matches[12]; last.Round != 4 || last.from[1].loser != winnersFinal {
+		t.Errorf("got %+v", last)
+	}
+}
+
+// openTestBracket is OpenBracket for a bracket the janitor of the other
+// tests does not see
+func openTestBracket(t *testing.T, format string, seeds ...string) *bracket {
+	t.Helper()
+	b := newBracket(format, seeds, GameOptions{})
+	if err := games.OpenBracket(b); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		games.mu.Lock()
+		defer games.mu.Unlock()
+		delete(games.brackets, b.id)
+	})
+	return b
+}
+
+// playBracketGame has the players of the game of match id of b take their
+// seats, returned by color
+func playBracketGame(t *testing.T, b *bracket, id int) (white, black *testPlayer) {
+	t.Helper()
+	b.mu.Lock()
+	game := b.matches[id-1].game
+	b.mu.Unlock()
+	if game == nil {
+		t.Fatalf("match %d has no game", id)
+	}
+	white, black = newTestPlayer(t), newTestPlayer(t)
+	for color, player := range map[string]*testPlayer{"white": white, "black": black} {
+		if err := game.Resume(context.Background(), player.conn, game.tokens[color], -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	white.expect("start")
+	black.expect("start")
+	return white, black
+}
+
+func TestBracketAdvances(t *testing.T) {
+	b := openTestBracket(t, singleElimination, "a", "b", "c")
+	follower := newTestPlayer(t)
+	follower.conn.player = "b"
+	joinBracket(follower.conn, b.id, commentReader{})
+	if got := follower.expect("bracket_match"); !got.BracketMatch.Bye || got.BracketMatch.Winner != "a" {
+		t.Errorf("got %+v, want a through on a bye", got.BracketMatch)
+	}
+	follower.expect("bracket_match")
+	follower.expect("bracket_match")
+	if got := follower.expect("bracket_game"); got.Board != 2 || got.Color != "white" || got.Token == "" {
+		t.Errorf("got %+v", got)
+	}
+
+	// b, seeded above c, plays white and wins
+	_, black := playBracketGame(t, b, 2)
+	black.send(Message{Type: "resign"})
+	if got := follower.expect("bracket_match"); got.BracketMatch.ID != 2 || got.BracketMatch.Winner != "b" {
+		t.Errorf("got %+v", got.BracketMatch)
+	}
+	if got := follower.expect("bracket_match"); got.BracketMatch.ID != 3 || got.BracketMatch.Players[1] != "b" {
+		t.Errorf("got %+v", got.BracketMatch)
+	}
+	follower.expect("bracket_game")
+
+	// a drawn final is played again with colors reversed
+	white, black := playBracketGame(t, b, 3)
+	white.send(Message{Type: "draw_offer"})
+	black.expect("draw_offer")
+	black.send(Message{Type: "draw_offer"})
+	follower.expect("bracket_match")
+	if got := follower.expect("bracket_match"); len(got.BracketMatch.Games) != 2 {
+		t.Errorf("got %+v", got.BracketMatch)
+	}
+	if got := follower.expect("bracket_game"); got.Color != "white" {
+		t.Errorf("b got %s for the second game", got.Color)
+	}
+	white, _ = playBracketGame(t, b, 3)
+	white.send(Message{Type: "resign"})
+	follower.expect("bracket_match")
+	if got := follower.expect("bracket_over"); got.Participant != "a" {
+		t.Errorf("got champion %q", got.Participant)
+	}
+	if view := b.view(); !view.Over || view.Champion != "a" || len(view.Matches) != 3 {
+		t.Errorf("got %+v", view)
+	}
+}
+
+func TestDoubleEliminationBracket(t *testing.T) {
+	b := openTestBracket(t, doubleElimination, "a", "b")
+	// a loses the winners final to b, and gets even in the grand final
+	white, _ := playBracketGame(t, b, 1)
+	white.send(Message{Type: "resign"})
+	waitFor(t, func() bool { return b.view().Matches[1].Players[1] == "a" })
+	white, _ = playBracketGame(t, b, 2)
+	white.send(Message{Type: "resign"})
+	waitFor(t, func() bool { return b.view().Matches[1].Decided })
+	if view := b.view(); view.Over || view.Matches[2].Players[0] != "a" {
+		t.Fatalf("got %+v, want the grand final played again", view.Matches)
+	}
+	white, _ = playBracketGame(t, b, 3)
+	white.send(Message{Type: "resign"})
+	waitFor(t, func() bool { return b.view().Over })
+	if view := b.view(); view.Champion != "b" {
+		t.Errorf("got champion %q", view.Champion)
+	}
+}
+
+func TestCreateBracket(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	host := Player{ID: "host", Name: "host"}
+	startSession(&host, "test")
+	players.Create(host)
+	for _, id := range []string{"a", "b"} {
+		players.Create(Player{ID: id, Name: id})
+	}
+
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, r)
+		return w
+	}
+	if w := request("POST", "/brackets", "", `{}`); w.Code != http.StatusForbidden {
+		t.Errorf("got %d without an account", w.Code)
+	}
+	for _, body := range []string{
+		`{"format":"swiss","players":["a","b"]}`,
+		`{"format":"single","players":["a"]}`,
+		`{"format":"single","players":["a","a"]}`,
+		`{"format":"single","players":["a","nobody"]}`,
+		`{"format":"single","players":["a","b"],"options":{"color":"white"}}`,
+	} {
+		if w := request("POST", "/brackets", host.Token, body); w.Code != http.StatusBadRequest {
+			t.Errorf("got %d creating %s", w.Code, body)
+		}
+	}
+
+	w := request("POST", "/brackets", host.Token, `{"format":"single","players":["a","host"],"options":{"draws":"never"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	created := bracketView{}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Matches) != 1 || len(created.Matches[0].Games) != 1 || created.Rules.Draws != "never" {
+		t.Errorf("got %+v", created)
+	}
+	defer func() {
+		games.mu.Lock()
+		defer games.mu.Unlock()
+		delete(games.brackets, created.ID)
+	}()
+	if w := request("GET", "/brackets/"+created.ID, "", ""); w.Code != http.StatusOK {
+		t.Errorf("got %d viewing the bracket", w.Code)
+	}
+	w = request("GET", "/brackets/"+created.ID+"/seat", host.Token, "")
+	seat := gameSeat{}
+	if err := json.Unmarshal(w.Body.Bytes(), &seat); err != nil || seat.Token == "" {
+		t.Errorf("got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestScheduledBracket(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	pool := ratingPool(GameState{TimeControl: timeControl})
+	players.Create(Player{ID: "a", Name: "a"})
+	players.Create(Player{ID: "b", Name: "b", Ratings: map[string]Rating{pool: {Rating: 1800}}})
+	defer func(d time.Duration) { bracketReminder = d }(bracketReminder)
+	bracketReminder = 150 * time.Millisecond
+
+	b := newBracket(singleElimination, nil, GameOptions{})
+	b.startsAt = time.Now().Add(200 * time.Millisecond)
+	if err := games.OpenBracket(b); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		games.mu.Lock()
+		defer games.mu.Unlock()
+		delete(games.brackets, b.id)
+	})
+	follower := newTestPlayer(t)
+	joinBracket(follower.conn, b.id, commentReader{})
+	if got := follower.expect("bracket_scheduled"); got.Deadline != b.startsAt.UnixMilli() {
+		t.Errorf("got %+v", got)
+	}
+	for _, player := range []string{"a", "b"} {
+		if err := b.Register(player); err != nil {
+			t.Fatal(err)
+		}
+		follower.expect("bracket_registered")
+	}
+	follower.expect("bracket_reminder")
+	// b is rated above a, seeded first as the bracket starts
+	if got := follower.expect("bracket_match"); got.BracketMatch.Players[0] != "b" {
+		t.Errorf("got %+v", got.BracketMatch)
+	}
+	if err := b.Withdraw("a"); err != ErrRegistrationClosed {
+		t.Errorf("got %v withdrawing once started", err)
+	}
+
+	// one with too few players is cancelled
+	lonely := newBracket(doubleElimination, []string{"a"}, GameOptions{})
+	lonely.startsAt = time.Now()
+	lonely.start()
+	if view := lonely.view(); !view.Over || !view.Cancelled {
+		t.Errorf("got %+v", view)
+	}
+}
+
+func TestBracketLateJoin(t *testing.T) {
+	b := newBracket(singleElimination, []string{"a", "b", "c"}, GameOptions{})
+	b.lateJoin = time.Hour
+	if err := games.OpenBracket(b); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		games.mu.Lock()
+		defer games.mu.Unlock()
+		delete(games.brackets, b.id)
+	})
+	// the bye of a waits for a late player
+	if view := b.view(); view.Matches[0].Decided {
+		t.Fatalf("got %+v", view.Matches[0])
+	}
+	if err := b.Register("d"); err != nil {
+		t.Fatal(err)
+	}
+	if view := b.view(); view.Matches[0].Players[1] != "d" || len(view.Matches[0].Games) != 1 {
+		t.Errorf("got %+v", view.Matches[0])
+	}
+	if err := b.Register("e"); err != ErrBracketFull {
+		t.Errorf("got %v registering with no bye left", err)
+	}
+}
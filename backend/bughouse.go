@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// bughouseMatch is two games played by two teams, each with a player at
+// either board and with opposite colors: what a player takes is handed to
+// their partner to drop, and the first board to end decides the match
+type bughouseMatch struct {
+	boards  [2]*ChessGame
+	decided sync.Once
+}
+
+func init() {
+	registerVariant(bughouse, variantKind{
+		pair:    (*gameManager).PairBughouse,
+		newGame: func(game *ChessGame) variant { return bughouseBoard{game: game} },
+	})
+}
+
+// bughouseBoard is the variant of a board of a bughouse match, the match
+// itself is the one of the game
+type bughouseBoard struct {
+	standard
+	game *ChessGame
+}
+
+// pocketed is a piece handed to color by their partner, who took it on
+// the other board of a bughouse match
+type pocketed struct {
+	color string
+	piece string
+}
+
+func (message pocketed) deliver(game *ChessGame) bool {
+	game.recorder.RecordPocketed(game.ctx, message.color, message.piece)
+	for _, box := range game.outboxes() {
+		box.Send(Message{Type: "pocket", Color: message.color, Drop: message.piece})
+	}
+	return false
+}
+
+// partnerEnded is the other board of a bughouse match being over with
+// result, empty if it was abandoned
+type partnerEnded struct {
+	result string
+}
+
+func (message partnerEnded) deliver(game *ChessGame) bool {
+	game.partnerEnded(message.result)
+	return true
+}
+
+// PairBughouse puts conn in the queue for a bughouse match, which starts
+// once four players are in it
+func (m *gameManager) PairBughouse(ctx context.Context, conn *connection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.canCreate(); err != nil {
+		return err
+	}
+	players, err := m.enqueue(bughouse, conn)
+	if players == nil {
+		return err
+	}
+
+	// the first two players are a team, white at the first board and
+	// black at the second, against the other two
+	b := &bughouseMatch{}
+	b.boards[0] = openGame(ctx, players[0], bughouse, nil, b, 1)
+	b.boards[1] = openGame(ctx, players[3], bughouse, nil, b, 2)
+	for i, black := range []*connection{players[2], players[1]} {
+		game := b.boards[i]
+		// registered first, as paired games are
+		m.active[game.id] = game
+		if err := game.Join(ctx, black); err != nil {
+			delete(m.active, game.id)
+			// the opponent left while queued, black waits for the next match
+			// and the partner board ends along with the one abandoned
+			m.queues[bughouse] = append(m.queues[bughouse], black)
+		}
+	}
+	return nil
+}
+
+// partner is the other board of the match
+func (b *bughouseMatch) partner(game *ChessGame) *ChessGame {
+	if b.boards[0] == game {
+		return b.boards[1]
+	}
+	return b.boards[0]
+}
+
+// pass hands a piece of type t taken at game to color at the other board,
+// the partner of whoever took it
+func (b *bughouseMatch) pass(game *ChessGame, color string, t chess.PieceType) {
+	b.send(b.partner(game), pocketed{color: color, piece: t.String()})
+}
+
+// boardDone decides the match once the loop of game returned with the game
+// over, its partners win or lose at the other board too. It does nothing
+// outside matches nor for games stopped with the server
+func (b *bughouseMatch) boardDone(game *ChessGame) {
+	if b == nil {
+		return
+	}
+	state := game.recorder.State()
+	if !state.Finished {
+		return
+	}
+	b.decided.Do(func() {
+		b.send(b.partner(game), partnerEnded{result: state.Result})
+	})
+}
+
+// send posts message to the loop of game once it started, from a goroutine
+// of its own so that the boards never wait on the mailbox of each other
+func (b *bughouseMatch) send(game *ChessGame, message any) {
+	go func() {
+		select {
+		case <-game.joined:
+			game.post(message)
+		case <-game.done:
+		}
+	}()
+}
+
+// partnerEnded ends a bughouse game along with the other board of its match,
+// which ended with result: the winners there have their partners here, who
+// play the other color
+func (game *ChessGame) partnerEnded(result string) {
+	switch result {
+	case "":
+		game.recorder.Record(game.ctx, GameAbandoned, "", nil)
+	case "1-0":
+		game.recorder.Record(game.ctx, BughouseDecided, "white", nil)
+	case "0-1":
+		game.recorder.Record(game.ctx, BughouseDecided, "black", nil)
+	default:
+		game.recorder.Record(game.ctx, BughouseDecided, "", nil)
+	}
+	game.end("other_board")
+}
+
+// position has the pieces handed to the players in their pockets
+func (board bughouseBoard) position(state GameState) (chess.Position, int) {
+	position, pocketed := chess.NewPosition().WithDrops(), state.Pocketed
+	pocket := func(ply int) {
+		for ; len(pocketed) > 0 && pocketed[0].Ply <= ply; pocketed = pocketed[1:] {
+			t, _ := chess.ParsePieceType(pocketed[0].Piece)
+			position = position.AddToPocket(chessColor(pocketed[0].Color), t)
+		}
+	}
+	for i, m := range state.Moves {
+		pocket(i)
+		parsed, err := chess.ParseMove(m.UCI())
+		if err != nil || !position.IsLegal(parsed) {
+			return position, i
+		}
+		position = position.Apply(parsed)
+	}
+	pocket(len(state.Moves))
+	return position, len(state.Moves)
+}
+
+// check plays bughouse by the rules, to know what is taken and when a board
+// is mated. A mate stands even if a piece the partner is yet to take could
+// have been dropped to block it
+func (board bughouseBoard) check(state GameState, m *Move) (string, chess.Status) {
+	position, played := board.position(state)
+	parsed, err := chess.ParseMove(m.UCI())
+	if played < len(state.Moves) || err != nil || !position.IsLegal(parsed) {
+		return CodeIllegalMove, chess.Ongoing
+	}
+	return "", position.Apply(parsed).Status()
+}
+
+// moved hands what the move took to the partner of the player taken from
+func (board bughouseBoard) moved(color string, message Message, before GameState) {
+	position, _ := board.position(before)
+	// the move was checked
+	parsed, _ := chess.ParseMove(message.Move().UCI())
+	if captured := position.Captured(parsed); captured != chess.NoPieceType {
+		board.game.match.pass(board.game, opponent(color), captured)
+	}
+}
+
+// finished decides the match if this board is over
+func (board bughouseBoard) finished() {
+	board.game.match.boardDone(board.game)
+}
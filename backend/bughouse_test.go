@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// startTestBughouse queues four test players for a bughouse match, the
+// boards are played by players[0] and players[2], then players[3] and
+// players[1], white first
+func startTestBughouse(t *testing.T) [4]*testPlayer {
+	t.Helper()
+	players := [4]*testPlayer{}
+	for i := range players {
+		players[i] = newTestPlayer(t)
+		if err := games.PairBughouse(context.Background(), players[i].conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range []struct {
+		color string
+		board int
+	}{{"white", 1}, {"black", 2}, {"black", 1}, {"white", 2}} {
+		got := players[i].expect("start")
+		if got.Color != want.color || got.Board != want.board || got.Variant != bughouse {
+			t.Fatalf("player %d got %+v", i, got)
+		}
+	}
+	return players
+}
+
+func TestBughouseCapturesGoToThePartner(t *testing.T) {
+	players := startTestBughouse(t)
+	white1, black2, black1, white2 := players[0], players[1], players[2], players[3]
+
+	white1.send(move("1", "e2", "e4"))
+	black1.expect("move")
+	black1.send(move("2", "d7", "d5"))
+	white1.expect("move")
+	white1.send(move("3", "e4", "d5"))
+	black1.expect("move")
+	for _, player := range []*testPlayer{white2, black2} {
+		if got := player.expect("pocket"); got.Color != "black" || got.Drop != "p" {
+			t.Fatalf("got %+v", got)
+		}
+	}
+
+	white2.send(move("4", "e2", "e5"))
+	white2.expect("error", CodeIllegalMove)
+	white2.send(move("5", "e2", "e4"))
+	black2.expect("move")
+	black2.send(Message{Type: "drop", MoveID: "6", Drop: "p", To: "d6"})
+	if got := white2.expect("drop"); got.Drop != "p" || got.To != "d6" {
+		t.Errorf("got %+v", got)
+	}
+	// the pawn was dropped already
+	white2.send(move("7", "d2", "d4"))
+	black2.expect("move")
+	black2.send(Message{Type: "drop", MoveID: "8", Drop: "p", To: "d5"})
+	black2.expect("error", CodeIllegalMove)
+
+	// white on the second board loses along with its partner
+	black1.send(Message{Type: "resign"})
+	white1.expect("game_over")
+	for _, player := range []*testPlayer{white2, black2} {
+		if got := player.expect("game_over"); got.Result != "0-1" || got.Reason != "other_board" {
+			t.Errorf("got %+v", got)
+		}
+	}
+}
+
+func TestBughouseMateDecidesTheMatch(t *testing.T) {
+	players := startTestBughouse(t)
+	white1, black2, black1, white2 := players[0], players[1], players[2], players[3]
+
+	for i, m := range []Message{move("1", "f2", "f3"), move("2", "e7", "e5"), move("3", "g2", "g4")} {
+		mover, opponent := white1, black1
+		if i%2 == 1 {
+			mover, opponent = black1, white1
+		}
+		mover.send(m)
+		opponent.expect("move")
+	}
+	black1.send(move("4", "d8", "h4"))
+	white1.expect("move")
+	for _, player := range []*testPlayer{white1, black1} {
+		if got := player.expect("game_over"); got.Result != "0-1" || got.Reason != "checkmate" {
+			t.Errorf("got %+v", got)
+		}
+	}
+	for _, player := range []*testPlayer{white2, black2} {
+		if got := player.expect("game_over"); got.Result != "1-0" || got.Reason != "other_board" {
+			t.Errorf("got %+v", got)
+		}
+	}
+}
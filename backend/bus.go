@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// the kinds of events published on the bus
+type busEventType string
+
+const (
+	busGameStarted   busEventType = "GameStarted"
+	busMovePlayed    busEventType = "MovePlayed"
+	busGameFinished  busEventType = "GameFinished"
+	busUserConnected busEventType = "UserConnected"
+)
+
+// busEvent is something that happened on the server as subsystems are told
+// about it. GameID is that of the game of the event, if any; State is the
+// game as it started or finished, Move and Color the move played and who
+// played it, Player the account that connected
+type busEvent struct {
+	Type   busEventType
+	Time   time.Time
+	GameID string
+	State  GameState
+	Color  string
+	Move   *Move
+	Player string
+}
+
+type busHandler struct {
+	id      int
+	handler func(busEvent)
+}
+
+// eventBus hands what the game loop and the transports publish to the
+// subsystems subscribed to it, ratings and webhooks among them, for
+// neither side to know about the other
+type eventBus struct {
+	mu       sync.Mutex
+	next     int
+	handlers map[busEventType][]busHandler
+}
+
+var bus = &eventBus{handlers: map[busEventType][]busHandler{}}
+
+// subscribe calls handler with every event of type t published from now
+// on, until cancel is called. Handlers are called in the order they
+// subscribed, by the goroutine publishing, so they must not block it: slow
+// work, as looking up webhooks and posting to them, goes on in the
+// background
+func (b *eventBus) subscribe(t busEventType, handler func(busEvent)) (cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next++
+	id := b.next
+	b.handlers[t] = append(b.handlers[t], busHandler{id: id, handler: handler})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, h := range b.handlers[t] {
+			if h.id == id {
+				b.handlers[t] = append(b.handlers[t][:i:i], b.handlers[t][i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// publish calls the handlers of the type of event, stamping it with the
+// time if it has none
+func (b *eventBus) publish(event busEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	b.mu.Lock()
+	handlers := b.handlers[event.Type]
+	b.mu.Unlock()
+	for _, h := range handlers {
+		h.handler(event)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestEventBus(t *testing.T) {
+	b := &eventBus{handlers: map[busEventType][]busHandler{}}
+	var got []string
+	cancel := b.subscribe(busMovePlayed, func(event busEvent) { got = append(got, "first "+event.GameID) })
+	b.subscribe(busMovePlayed, func(event busEvent) { got = append(got, "second "+event.GameID) })
+	b.subscribe(busGameStarted, func(event busEvent) { got = append(got, "started") })
+	b.publish(busEvent{Type: busMovePlayed, GameID: "a"})
+	cancel()
+	b.publish(busEvent{Type: busMovePlayed, GameID: "b"})
+	if want := []string{"first a", "second a", "second b"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGameLoopPublishesOnTheBus(t *testing.T) {
+	var mu sync.Mutex
+	published := map[string][]busEventType{}
+	for _, kind := range []busEventType{busGameStarted, busMovePlayed, busGameFinished} {
+		defer bus.subscribe(kind, func(event busEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			published[event.GameID] = append(published[event.GameID], event.Type)
+		})()
+	}
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.send(Message{Type: "resign"})
+	white.expect("game_over")
+	<-game.done
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := published[game.id], []busEventType{busGameStarted, busMovePlayed, busGameFinished}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
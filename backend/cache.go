@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// responseCache keeps the answers of the read endpoints the most asked
+// for, as they were encoded, until they are invalidated or for cacheTTL
+type responseCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(keys ...string)
+}
+
+// cache is off unless main opens one, see openCache
+var cache responseCache = noCache{}
+
+// cacheTTL is how long an answer is kept at most, invalidated or not
+var cacheTTL = 30 * time.Second
+
+type noCache struct{}
+
+func (noCache) Get(string) ([]byte, bool)         { return nil, false }
+func (noCache) Set(string, []byte, time.Duration) {}
+func (noCache) Delete(...string)                  {}
+
+// memoryCache is the cache of an instance of its own
+type memoryCache struct{ entries *ttlStore[[]byte] }
+
+func newMemoryCache() memoryCache {
+	return memoryCache{newTTLStore(func(string, []byte) {})}
+}
+
+func (c memoryCache) Get(key string) ([]byte, bool) { return c.entries.Get(key) }
+
+func (c memoryCache) Set(key string, value []byte, ttl time.Duration) {
+	c.entries.Put(key, value, ttl)
+}
+
+func (c memoryCache) Delete(keys ...string) {
+	for _, key := range keys {
+		c.entries.Delete(key)
+	}
+}
+
+// redisCache is shared by the instances of a deployment, invalidated by
+// whichever changes what it keeps. It speaks just enough RESP for GET, SET
+// and DEL, over a few connections it keeps open
+type redisCache struct {
+	addr, password, prefix string
+	idle                   chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// redisTimeout bounds every command, a cache too slow is a cache missed
+const redisTimeout = 500 * time.Millisecond
+
+func (c *redisCache) Get(key string) ([]byte, bool) {
+	value, err := c.do("GET", c.prefix+key)
+	if err != nil {
+		log.Printf("cache: %v", err)
+	}
+	return value, value != nil
+}
+
+func (c *redisCache) Set(key string, value []byte, ttl time.Duration) {
+	if _, err := c.do("SET", c.prefix+key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10)); err != nil {
+		log.Printf("cache: %v", err)
+	}
+}
+
+func (c *redisCache) Delete(keys ...string) {
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, c.prefix+key)
+	}
+	if _, err := c.do(args...); err != nil {
+		log.Printf("cache: %v", err)
+	}
+}
+
+// do runs the command args, answering its bulk string reply, nil for none
+func (c *redisCache) do(args ...string) ([]byte, error) {
+	conn, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(args...)
+	if err != nil {
+		conn.conn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+	return reply, nil
+}
+
+func (c *redisCache) conn() (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+	nc, err := net.DialTimeout("tcp", c.addr, redisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: nc, r: bufio.NewReader(nc)}
+	if c.password != "" {
+		if _, err := conn.do("AUTH", c.password); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (conn *redisConn) do(args ...string) ([]byte, error) {
+	conn.conn.SetDeadline(time.Now().Add(redisTimeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := conn.conn.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+	line, err := conn.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil, nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(conn.r, value); err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
+
+// openCache opens the cache of target: memory, off, or
+// redis://[:password@]host:port/prefix
+func openCache(target string) (responseCache, error) {
+	switch target {
+	case "", "off":
+		return noCache{}, nil
+	case "memory":
+		return newMemoryCache(), nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("invalid cache %q, expected memory, off or redis://host:port/prefix", target)
+	}
+	c := &redisCache{addr: u.Host, prefix: strings.Trim(u.Path, "/"), idle: make(chan *redisConn, 8)}
+	if c.prefix == "" {
+		c.prefix = "chess"
+	}
+	c.prefix += ":"
+	if password, ok := u.User.Password(); ok {
+		c.password = password
+	}
+	if _, err := c.do("PING"); err != nil {
+		return nil, fmt.Errorf("connecting to Redis: %w", err)
+	}
+	return c, nil
+}
+
+// the keys of what is cached about a player
+func playerCacheKeys(id string) []string {
+	return []string{"profile:" + id, "stats:" + id, "repertoire:" + id}
+}
+
+// invalidatePlayer drops what is cached about the player id
+func invalidatePlayer(id string) {
+	cache.Delete(playerCacheKeys(id)...)
+}
+
+// invalidatingPlayerStore invalidates what is cached about the players it
+// updates, however they were
+type invalidatingPlayerStore struct{ PlayerStore }
+
+func (s invalidatingPlayerStore) Update(id string, change func(*Player) error) error {
+	err := s.PlayerStore.Update(id, change)
+	invalidatePlayer(id)
+	return err
+}
+
+// serveCached answers with the JSON of what build builds, or what it built
+// under key less than cacheTTL ago; a player not found is not found
+func serveCached(w http.ResponseWriter, r *http.Request, key string, build func() (any, error)) {
+	data, ok := cache.Get(key)
+	if !ok {
+		v, err := build()
+		if errors.Is(err, ErrPlayerNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err == nil {
+			data, err = json.Marshal(v)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data = append(data, '\n')
+		cache.Set(key, data, cacheTTL)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
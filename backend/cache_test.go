@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCachedProfiles(t *testing.T) {
+	defer func(s PlayerStore, c responseCache) { players, cache = s, c }(players, cache)
+	store := newMemoryPlayerStore()
+	players, cache = invalidatingPlayerStore{store}, newMemoryCache()
+	players.Create(Player{ID: "ana", Name: "ana"})
+	name := func() string {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/ana", nil))
+		got := profile{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%v: %s", err, w.Body)
+		}
+		return got.Name
+	}
+	if got := name(); got != "ana" {
+		t.Fatalf("got %s", got)
+	}
+	// what goes around the store is only seen once the cache expires
+	store.Update("ana", func(p *Player) error { p.Name = "ana b"; return nil })
+	if got := name(); got != "ana" {
+		t.Errorf("got %s from the cache", got)
+	}
+	players.Update("ana", func(p *Player) error { p.Name = "ana c"; return nil })
+	if got := name(); got != "ana c" {
+		t.Errorf("got %s once invalidated", got)
+	}
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/nobody/stats", nil))
+	if w.Code != 404 {
+		t.Errorf("got %d", w.Code)
+	}
+}
+
+// fakeRedis answers GET, SET, DEL and PING as Redis does, keeping the
+// commands it got
+func fakeRedis(t *testing.T) (addr string, commands func() []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	var mu sync.Mutex
+	values, got := map[string]string{}, []string{}
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			args := make([]string, n)
+			for i := range args {
+				header, _ := r.ReadString('\n')
+				size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+				arg := make([]byte, size+2)
+				io.ReadFull(r, arg)
+				args[i] = string(arg[:size])
+			}
+			mu.Lock()
+			got = append(got, strings.Join(args, " "))
+			switch args[0] {
+			case "GET":
+				if v, ok := values[args[1]]; ok {
+					fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+				} else {
+					fmt.Fprint(conn, "$-1\r\n")
+				}
+			case "SET":
+				values[args[1]] = args[2]
+				fmt.Fprint(conn, "+OK\r\n")
+			case "DEL":
+				for _, key := range args[1:] {
+					delete(values, key)
+				}
+				fmt.Fprintf(conn, ":%d\r\n", len(args)-1)
+			default:
+				fmt.Fprint(conn, "+PONG\r\n")
+			}
+			mu.Unlock()
+		}
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return l.Addr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), got...)
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	addr, commands := fakeRedis(t)
+	c, err := openCache("redis://" + addr + "/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("profile:ana"); ok {
+		t.Error("got a value never set")
+	}
+	c.Set("profile:ana", []byte("{\"name\":\"ana\"}\n"), cacheTTL)
+	if got, ok := c.Get("profile:ana"); !ok || string(got) != "{\"name\":\"ana\"}\n" {
+		t.Errorf("got %q", got)
+	}
+	c.Delete(playerCacheKeys("ana")...)
+	if _, ok := c.Get("profile:ana"); ok {
+		t.Error("got a value deleted")
+	}
+	want := []string{"PING", "GET test:profile:ana", "SET test:profile:ana {\"name\":\"ana\"}\n PX 30000", "GET test:profile:ana", "DEL test:profile:ana test:stats:ana test:repertoire:ana", "GET test:profile:ana"}
+	if got := commands(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := openCache("memcached://localhost"); err == nil {
+		t.Error("opened a cache of an unknown kind")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrServerFull   = errors.New("server full")
+	ErrTooManyGames = errors.New("too many games")
+	ErrTooManySeeks = errors.New("too many seeks")
+)
+
+// limits on what the server takes on at once, none when 0; those per
+// client are on the games each account, or IP address for guests, plays at
+// once and the seeks it waits in
+var (
+	maxConnections    int64
+	maxGames          int
+	maxGamesPerClient int
+	maxSeeksPerClient int
+)
+
+// openConnections counts the connections not closed yet,
+// refused ones included until they are
+var openConnections atomic.Int64
+
+// connectionsFull reports whether a new connection would be one too many
+func connectionsFull() bool {
+	return maxConnections > 0 && openConnections.Load() >= maxConnections
+}
+
+// seatedClients holds the games the clients are seated in, as connection
+// client tells them, until the games are unregistered
+var seatedClients = struct {
+	sync.Mutex
+	games   map[string][]*ChessGame
+	clients map[*ChessGame][]string
+}{games: map[string][]*ChessGame{}, clients: map[*ChessGame][]string{}}
+
+func seatClient(client string, game *ChessGame) {
+	seatedClients.Lock()
+	defer seatedClients.Unlock()
+	if slices.Contains(seatedClients.games[client], game) {
+		return
+	}
+	seatedClients.games[client] = append(seatedClients.games[client], game)
+	seatedClients.clients[game] = append(seatedClients.clients[game], client)
+}
+
+func unseatClients(game *ChessGame) {
+	seatedClients.Lock()
+	defer seatedClients.Unlock()
+	for _, client := range seatedClients.clients[game] {
+		games := slices.DeleteFunc(seatedClients.games[client], func(g *ChessGame) bool { return g == game })
+		if len(games) == 0 {
+			delete(seatedClients.games, client)
+		} else {
+			seatedClients.games[client] = games
+		}
+	}
+	delete(seatedClients.clients, game)
+}
+
+// clientLimit tells why client cannot seek another game, if so: it plays
+// maxGamesPerClient games already, or waits in maxSeeksPerClient seeks,
+// those of the queues among them. m.mu must be held, by the same hold that
+// creates or joins the seek, for two connections arriving at once not to
+// both be let in
+func (m *gameManager) clientLimit(client string) error {
+	if maxGamesPerClient == 0 && maxSeeksPerClient == 0 {
+		return nil
+	}
+	seatedClients.Lock()
+	seated := slices.Clone(seatedClients.games[client])
+	seatedClients.Unlock()
+	playing, seeking := 0, 0
+	for _, game := range seated {
+		if slices.Contains(m.seeks, game) {
+			seeking++
+		} else {
+			playing++
+		}
+	}
+	for _, seeker := range m.quick {
+		if seeker.conn.client == client {
+			seeking++
+		}
+	}
+	for _, queue := range m.queues {
+		for _, conn := range queue {
+			if conn.client == client {
+				seeking++
+			}
+		}
+	}
+	if maxGamesPerClient > 0 && playing >= maxGamesPerClient {
+		return ErrTooManyGames
+	}
+	if maxSeeksPerClient > 0 && seeking >= maxSeeksPerClient {
+		return ErrTooManySeeks
+	}
+	return nil
+}
+
+// clientLimitArgs are the arguments of the error message for err,
+// the limit reached if clientLimit refused the seek
+func clientLimitArgs(err error) []string {
+	switch err {
+	case ErrTooManyGames:
+		return []string{strconv.Itoa(maxGamesPerClient)}
+	case ErrTooManySeeks:
+		return []string{strconv.Itoa(maxSeeksPerClient)}
+	}
+	return nil
+}
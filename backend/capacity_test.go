@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientLimits(t *testing.T) {
+	defer func(games, seeks int) {
+		maxGamesPerClient, maxSeeksPerClient = games, seeks
+	}(maxGamesPerClient, maxSeeksPerClient)
+	maxGamesPerClient, maxSeeksPerClient = 1, 1
+	ctx := context.Background()
+	connect := func(ip string) *testPlayer {
+		t.Helper()
+		transport := newMemTransport()
+		player := &testPlayer{t: t, transport: transport}
+		t.Cleanup(player.disconnect)
+		_, span := tracer.Start(ctx, "test")
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.RemoteAddr = ip + ":1234"
+		admit(ctx, span, r, transport)
+		return player
+	}
+
+	white := newTestPlayer(t)
+	white.conn.client = "ip:192.0.2.10"
+	if err := games.Pair(ctx, white.conn); err != nil {
+		t.Fatal(err)
+	}
+	connect("192.0.2.10").expect("error", CodeTooManySeeks)
+
+	black := newTestPlayer(t)
+	black.conn.client = "ip:192.0.2.11"
+	if err := games.Pair(ctx, black.conn); err != nil {
+		t.Fatal(err)
+	}
+	white.expect("start")
+	black.expect("start")
+	if got := connect("192.0.2.10").expect("error", CodeTooManyGames); got.Text != "You already play the most games at once you may, 1; finish one first." {
+		t.Fatalf("got %+v", got)
+	}
+
+	// the game over, its players may seek again
+	white.send(Message{Type: "resign"})
+	black.expect("game_over")
+	waitFor(t, func() bool {
+		games.mu.Lock()
+		defer games.mu.Unlock()
+		return games.clientLimit("ip:192.0.2.10") == nil
+	})
+}
+
+func TestClientLimitsOfConcurrentConnections(t *testing.T) {
+	defer func(games, seeks int) {
+		maxGamesPerClient, maxSeeksPerClient = games, seeks
+	}(maxGamesPerClient, maxSeeksPerClient)
+	maxGamesPerClient, maxSeeksPerClient = 1, 1
+	ctx := context.Background()
+
+	// of those connecting at once from one address, one seeks and the
+	// others are refused rather than seek or join it
+	players := make([]*testPlayer, 10)
+	var wg sync.WaitGroup
+	for i := range players {
+		transport := newMemTransport()
+		players[i] = &testPlayer{t: t, transport: transport}
+		t.Cleanup(players[i].disconnect)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, span := tracer.Start(ctx, "test")
+			r := httptest.NewRequest("GET", "/ws", nil)
+			r.RemoteAddr = "192.0.2.20:1234"
+			admit(ctx, span, r, transport)
+		}()
+	}
+	wg.Wait()
+	seatedClients.Lock()
+	seated := len(seatedClients.games["ip:192.0.2.20"])
+	seatedClients.Unlock()
+	if seated != 1 {
+		t.Fatalf("%d connections seek", seated)
+	}
+	var seeker *testPlayer
+	for _, player := range players {
+		select {
+		case <-player.transport.done:
+			player.expect("error", CodeTooManySeeks)
+		case <-time.After(100 * time.Millisecond):
+			if seeker != nil {
+				t.Fatal("two connections still open")
+			}
+			seeker = player
+		}
+	}
+	seeker.disconnect()
+	waitFor(t, func() bool {
+		games.mu.Lock()
+		defer games.mu.Unlock()
+		return games.clientLimit("ip:192.0.2.20") == nil
+	})
+}
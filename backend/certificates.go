@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCertificate = errors.New("invalid result certificate")
+
+// resultKey signs the result certificates, for those verifying them with
+// its public key; a random one unless configured, the certificates signed
+// with it then verifying only until the server restarts
+var resultKey = func() ed25519.PrivateKey {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	return key
+}()
+
+// resultRecord is the result of a rated game as certified: the accounts
+// that played it, the SHA-256 of its moves in UCI notation separated by
+// spaces, played from FEN if it did not start at the starting position,
+// its result, rating pool and when it was decided
+type resultRecord struct {
+	Game      string    `json:"game"`
+	White     string    `json:"white"`
+	Black     string    `json:"black"`
+	FEN       string    `json:"fen,omitempty"`
+	Moves     int       `json:"moves"`
+	MovesHash string    `json:"movesHash"`
+	Result    string    `json:"result"`
+	Pool      string    `json:"pool"`
+	DecidedAt time.Time `json:"decidedAt"`
+}
+
+// resultCertificate is a resultRecord signed with resultKey: Payload is the
+// record as signed, in base64url, Signature its Ed25519 signature and Key
+// the ID of the key, see resultKeyID
+type resultCertificate struct {
+	Record    resultRecord `json:"record"`
+	Payload   string       `json:"payload"`
+	Signature string       `json:"signature"`
+	Key       string       `json:"key"`
+}
+
+// resultKeyDoc is the public key the certificates verify with
+type resultKeyDoc struct {
+	Algorithm string `json:"algorithm"`
+	Key       string `json:"key"`
+	PublicKey string `json:"publicKey"`
+}
+
+// resultKeyID tells the keys apart, as the start of the SHA-256 of the
+// public key
+func resultKeyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
+
+// movesHash is the SHA-256 of moves as resultRecord has it
+func movesHash(moves []Move) string {
+	sum := sha256.Sum256([]byte(strings.Join(uciMoves(moves), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// resultRecordOf is the record of the game of events, not ok unless it is
+// a rated game that was decided and whose moves were all played by the rules
+func resultRecordOf(events []Event) (record resultRecord, ok bool) {
+	state := GameState{Moves: []Move{}}
+	for _, event := range events {
+		state.Apply(event)
+		if state.Finished {
+			record.DecidedAt = event.Time
+			break
+		}
+	}
+	if state.Result == "" || !isRated(state) {
+		return resultRecord{}, false
+	}
+	if _, played := variantRules(state.Variant).position(state); played < len(state.Moves) {
+		return resultRecord{}, false
+	}
+	record.Game, record.FEN, record.Result, record.Pool = state.ID, state.FEN, state.Result, ratingPool(state)
+	record.White, record.Black = state.Players["white"], state.Players["black"]
+	record.Moves, record.MovesHash = len(state.Moves), movesHash(state.Moves)
+	return record, true
+}
+
+// certify signs record with resultKey. The signatures of Ed25519 being
+// deterministic, a record is certified the same every time, which lets the
+// certificates be built from the event logs whenever they are asked for
+func certify(record resultRecord) resultCertificate {
+	payload, _ := json.Marshal(record)
+	public := resultKey.Public().(ed25519.PublicKey)
+	return resultCertificate{
+		Record:    record,
+		Payload:   base64.RawURLEncoding.EncodeToString(payload),
+		Signature: base64.RawURLEncoding.EncodeToString(ed25519.Sign(resultKey, payload)),
+		Key:       resultKeyID(public),
+	}
+}
+
+// verifyCertificate checks that cert was signed with the key public, and
+// answers the record that was
+func verifyCertificate(cert resultCertificate, public ed25519.PublicKey) (resultRecord, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(cert.Payload)
+	if err != nil {
+		return resultRecord{}, ErrInvalidCertificate
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(cert.Signature)
+	if err != nil || !ed25519.Verify(public, payload, signature) {
+		return resultRecord{}, ErrInvalidCertificate
+	}
+	var record resultRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return resultRecord{}, ErrInvalidCertificate
+	}
+	return record, nil
+}
+
+// certificateHandler serves the result certificate of a rated game once it
+// is decided
+func certificateHandler(w http.ResponseWriter, r *http.Request) {
+	_, events, ok := loadWatchedEvents(w, r)
+	if !ok {
+		return
+	}
+	record, ok := resultRecordOf(events)
+	if !ok {
+		http.Error(w, "only rated games have a result certificate, once decided", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, certify(record))
+}
+
+// resultKeyHandler serves the public key to verify the result certificates
+// with, in base64
+func resultKeyHandler(w http.ResponseWriter, r *http.Request) {
+	public := resultKey.Public().(ed25519.PublicKey)
+	writeJSON(w, resultKeyDoc{Algorithm: "Ed25519", Key: resultKeyID(public), PublicKey: base64.StdEncoding.EncodeToString(public)})
+}
+
+// verifyCertificateHandler answers the record of the certificate posted if
+// resultKey signed it
+func verifyCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	var cert resultCertificate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&cert); err != nil {
+		http.Error(w, "invalid result certificate request", http.StatusBadRequest)
+		return
+	}
+	record, err := verifyCertificate(cert, resultKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, record)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResultCertificate(t *testing.T) {
+	decided := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, event := range []Event{
+		{Type: GameCreated},
+		{Type: PlayerJoined, Color: "white", Player: "ana"},
+		{Type: PlayerJoined, Color: "black", Player: "bo"},
+		{Type: GameStarted},
+		{Type: MoveMade, Color: "white", Move: &Move{From: "e2", To: "e4"}},
+		{Type: GameResigned, Color: "black", Time: decided},
+		{Type: SpectatorTokenIssued, Color: "white", Token: "later"},
+	} {
+		event.GameID, event.Seq = "certified", i+1
+		store.Append(context.Background(), event)
+	}
+	mux := newPublicMux()
+	get := func(path string, v any) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code == http.StatusOK {
+			json.NewDecoder(w.Body).Decode(v)
+		}
+		return w.Code
+	}
+
+	var cert resultCertificate
+	if code := get("/games/certified/certificate", &cert); code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+	want := resultRecord{Game: "certified", White: "ana", Black: "bo", Moves: 1, MovesHash: movesHash([]Move{{From: "e2", To: "e4"}}), Result: "1-0", Pool: "correspondence", DecidedAt: decided}
+	if cert.Record != want {
+		t.Fatalf("got %+v, want %+v", cert.Record, want)
+	}
+	var key resultKeyDoc
+	get("/certificates/key", &key)
+	public, _ := base64.StdEncoding.DecodeString(key.PublicKey)
+	if record, err := verifyCertificate(cert, public); err != nil || record != want || key.Key != cert.Key {
+		t.Fatalf("got %+v, %v", record, err)
+	}
+
+	// a record changed no longer verifies
+	tampered := want
+	tampered.Result = "0-1"
+	payload, _ := json.Marshal(tampered)
+	forged := cert
+	forged.Payload = base64.RawURLEncoding.EncodeToString(payload)
+	if _, err := verifyCertificate(forged, public); err != ErrInvalidCertificate {
+		t.Fatalf("got %v", err)
+	}
+	for body, code := range map[*resultCertificate]int{&cert: http.StatusOK, &forged: http.StatusUnprocessableEntity} {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", "/certificates/verify", bytes.NewReader(b)))
+		if w.Code != code {
+			t.Errorf("verifying %+v: got %d, want %d", body.Record, w.Code, code)
+		}
+	}
+	other, _, _ := ed25519.GenerateKey(nil)
+	if _, err := verifyCertificate(cert, other); err != ErrInvalidCertificate {
+		t.Fatalf("got %v", err)
+	}
+
+	// nor do games with a move that breaks the rules
+	for i, event := range []Event{
+		{Type: GameCreated},
+		{Type: PlayerJoined, Color: "white", Player: "ana"},
+		{Type: PlayerJoined, Color: "black", Player: "bo"},
+		{Type: GameStarted},
+		{Type: MoveMade, Color: "white", Move: &Move{From: "e2", To: "e5"}},
+		{Type: GameResigned, Color: "black", Time: decided},
+	} {
+		event.GameID, event.Seq = "illegal", i+1
+		store.Append(context.Background(), event)
+	}
+	if code := get("/games/illegal/certificate", nil); code != http.StatusNotFound {
+		t.Fatalf("got %d for a game with an illegal move", code)
+	}
+
+	// casual games and those still played have none
+	game, white, _ := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	waitFor(t, func() bool { return len(game.recorder.State().Moves) == 1 })
+	if code := get("/games/"+game.id+"/certificate", nil); code != http.StatusNotFound {
+		t.Fatalf("got %d", code)
+	}
+}
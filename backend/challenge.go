@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrChallengeFailed = errors.New("challenge failed")
+
+// seekChallenge is what connections seeking a game without an account
+// prove first, for bots not to flood the lobby: nothing if empty, pow a
+// proof of work powDifficulty bits hard, see checkProofOfWork, captcha a
+// CAPTCHA solved, as captchaVerifyURL tells with captchaSecret. Clients
+// get what to solve from GET /challenge, and captchaSiteKey for captcha
+var (
+	seekChallenge    string
+	powDifficulty    = 20
+	captchaVerifyURL string
+	captchaSecret    string
+	captchaSiteKey   string
+)
+
+// challengeKey signs the challenges, for any instance sharing it to check
+// those another handed out; a random one unless configured
+var challengeKey = func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+// powTTL is how long a proof of work challenge may be solved for
+const powTTL = 2 * time.Minute
+
+var captchaClient = &http.Client{Timeout: 10 * time.Second}
+
+// solvedChallenges are those already used, until they expire, for a
+// solution to pair a single connection
+var solvedChallenges = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: map[string]time.Time{}}
+
+// newChallenge is a proof of work challenge expiring at expires: when, a
+// nonce and their signature
+func newChallenge(expires time.Time) string {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	signed := fmt.Sprintf("%d.%x", expires.Unix(), nonce)
+	return signed + "." + signChallenge(signed)
+}
+
+func signChallenge(signed string) string {
+	mac := hmac.New(sha256.New, challengeKey)
+	mac.Write([]byte(signed))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// checkProofOfWork tells whether solution solves challenge at now: the
+// SHA-256 of the challenge followed by the solution starts with
+// powDifficulty zero bits, the challenge was handed out and neither
+// expired nor solved yet
+func checkProofOfWork(challenge, solution string, now time.Time) bool {
+	signed, signature, ok := cutLast(challenge, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signChallenge(signed))) {
+		return false
+	}
+	at, _, _ := strings.Cut(signed, ".")
+	unix, err := strconv.ParseInt(at, 10, 64)
+	if err != nil || now.After(time.Unix(unix, 0)) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(challenge + solution))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	if zeros < powDifficulty {
+		return false
+	}
+	solvedChallenges.Lock()
+	defer solvedChallenges.Unlock()
+	if _, solved := solvedChallenges.expires[challenge]; solved {
+		return false
+	}
+	for used, expires := range solvedChallenges.expires {
+		if now.After(expires) {
+			delete(solvedChallenges.expires, used)
+		}
+	}
+	solvedChallenges.expires[challenge] = time.Unix(unix, 0)
+	return true
+}
+
+// cutLast is s around the last sep in it
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// verifyCaptcha tells whether the CAPTCHA response of the client at ip was
+// solved, as the siteverify APIs of hCaptcha, Turnstile and reCAPTCHA alike
+// answer
+func verifyCaptcha(ctx context.Context, response, ip string) bool {
+	if response == "" {
+		return false
+	}
+	form := url.Values{"secret": {captchaSecret}, "response": {response}, "remoteip": {ip}}
+	req, err := http.NewRequestWithContext(ctx, "POST", captchaVerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		log.Printf("cannot verify CAPTCHA: %v", err)
+		return false
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := captchaClient.Do(req)
+	if err != nil {
+		log.Printf("cannot verify CAPTCHA: %v", err)
+		return false
+	}
+	defer resp.Body.Close()
+	var verified struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&verified); err != nil {
+		log.Printf("cannot verify CAPTCHA: %v", err)
+		return false
+	}
+	return verified.Success
+}
+
+// passesChallenge tells whether the connection requested by r proved what
+// seekChallenge asks, with ?challenge= and its ?solution= or ?captcha=
+func passesChallenge(r *http.Request) bool {
+	query := r.URL.Query()
+	switch seekChallenge {
+	case "pow":
+		return checkProofOfWork(query.Get("challenge"), query.Get("solution"), time.Now())
+	case "captcha":
+		return verifyCaptcha(r.Context(), query.Get("captcha"), clientIP(r))
+	}
+	return true
+}
+
+// seekChallengeDoc is what a client seeking a game without an account
+// proves: Kind is seekChallenge, Challenge what to find a solution to, for
+// the SHA-256 of both to start with Difficulty zero bits, until Expires
+type seekChallengeDoc struct {
+	Kind       string    `json:"kind"`
+	Challenge  string    `json:"challenge,omitempty"`
+	Difficulty int       `json:"difficulty,omitempty"`
+	Expires    time.Time `json:"expires,omitempty"`
+	SiteKey    string    `json:"siteKey,omitempty"`
+}
+
+func challengeHandler(w http.ResponseWriter, r *http.Request) {
+	doc := seekChallengeDoc{Kind: seekChallenge}
+	switch seekChallenge {
+	case "pow":
+		doc.Expires = time.Now().Add(powTTL).Truncate(time.Second).UTC()
+		doc.Challenge, doc.Difficulty = newChallenge(doc.Expires), powDifficulty
+	case "captcha":
+		doc.SiteKey = captchaSiteKey
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, doc)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"math/bits"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// solve finds the solution to challenge, as clients do
+func solve(challenge string) string {
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(challenge + solution))
+		zeros := 0
+		for _, b := range sum {
+			zeros += bits.LeadingZeros8(b)
+			if b != 0 {
+				break
+			}
+		}
+		if zeros >= powDifficulty {
+			return solution
+		}
+	}
+}
+
+func TestProofOfWork(t *testing.T) {
+	defer func(difficulty int) { powDifficulty = difficulty }(powDifficulty)
+	powDifficulty = 8
+	now := time.Now()
+	challenge := newChallenge(now.Add(time.Minute))
+	solution := solve(challenge)
+	if checkProofOfWork(challenge+"0", solution, now) {
+		t.Error("a challenge not handed out solved")
+	}
+	if checkProofOfWork(challenge, solution, now.Add(2*time.Minute)) {
+		t.Error("an expired challenge solved")
+	}
+	if !checkProofOfWork(challenge, solution, now) {
+		t.Fatal("the challenge not solved")
+	}
+	if checkProofOfWork(challenge, solution, now) {
+		t.Error("the challenge solved twice")
+	}
+}
+
+func TestSeekChallenge(t *testing.T) {
+	defer func(kind string, difficulty int) {
+		seekChallenge, powDifficulty = kind, difficulty
+	}(seekChallenge, powDifficulty)
+	seekChallenge, powDifficulty = "pow", 8
+	connect := func(query string) *testPlayer {
+		t.Helper()
+		transport := newMemTransport()
+		player := &testPlayer{t: t, transport: transport}
+		t.Cleanup(player.disconnect)
+		_, span := tracer.Start(context.Background(), "test")
+		admit(context.Background(), span, httptest.NewRequest("GET", "/ws?"+query, nil), transport)
+		return player
+	}
+	connect("").expect("error", CodeChallengeFailed)
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/challenge", nil))
+	var doc seekChallengeDoc
+	json.NewDecoder(w.Body).Decode(&doc)
+	if doc.Kind != "pow" || doc.Difficulty != 8 || doc.Challenge == "" || doc.Expires.IsZero() {
+		t.Fatalf("got %+v", doc)
+	}
+	games.mu.Lock()
+	seeks := len(games.seeks)
+	games.mu.Unlock()
+	query := url.Values{"challenge": {doc.Challenge}, "solution": {solve(doc.Challenge)}}.Encode()
+	connect(query)
+	waitFor(t, func() bool {
+		games.mu.Lock()
+		defer games.mu.Unlock()
+		return len(games.seeks) == seeks+1
+	})
+	// each solution is good for one connection
+	connect(query).expect("error", CodeChallengeFailed)
+}
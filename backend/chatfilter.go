@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var errRepeatedComment = errors.New("the comment repeats one already left on the game")
+
+// chatFilter is the comment hook keeping profanity and spam out of the
+// comments and kibitz: the words it blocks are masked, comments with more
+// than maxLinks links, unless that is 0, and those repeating one their
+// author already left on the game are refused
+type chatFilter struct {
+	words    map[string]bool
+	maxLinks int
+}
+
+// newChatFilter reads the words to block from the file at path, one a
+// line, leaving out empty lines and those starting with #; it blocks none
+// if path is empty
+func newChatFilter(path string, maxLinks int) (*chatFilter, error) {
+	filter := &chatFilter{words: map[string]bool{}, maxLinks: maxLinks}
+	if path == "" {
+		return filter, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading the chat filter: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word != "" && !strings.HasPrefix(word, "#") {
+			filter.words[word] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading the chat filter: %w", err)
+	}
+	return filter, nil
+}
+
+func (f *chatFilter) hook(game string, comment *Comment) error {
+	comment.Author, comment.Text = f.mask(comment.Author), f.mask(comment.Text)
+	if n := countLinks(comment.Text); f.maxLinks > 0 && n > f.maxLinks {
+		return fmt.Errorf("comments have up to %d links", f.maxLinks)
+	}
+	list, err := comments.Load(game)
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		if !c.Removed && c.Poster == comment.Poster && strings.EqualFold(c.Text, comment.Text) {
+			return errRepeatedComment
+		}
+	}
+	return nil
+}
+
+// mask is text with each letter of the words blocked in it, whatever
+// their case, replaced by an asterisk
+func (f *chatFilter) mask(text string) string {
+	if len(f.words) == 0 {
+		return text
+	}
+	var b strings.Builder
+	for len(text) > 0 {
+		i := strings.IndexFunc(text, isWordRune)
+		if i < 0 {
+			b.WriteString(text)
+			break
+		}
+		b.WriteString(text[:i])
+		text = text[i:]
+		end := strings.IndexFunc(text, func(r rune) bool { return !isWordRune(r) })
+		if end < 0 {
+			end = len(text)
+		}
+		word := text[:end]
+		if f.words[strings.ToLower(word)] {
+			word = strings.Repeat("*", utf8.RuneCountInString(word))
+		}
+		b.WriteString(word)
+		text = text[end:]
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// countLinks is how many links text has, as far as they can be told
+func countLinks(text string) int {
+	n := 0
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		if strings.Contains(field, "http://") || strings.Contains(field, "https://") || strings.HasPrefix(field, "www.") {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChatFilter(t *testing.T) {
+	defer func(s CommentStore) { comments = s }(comments)
+	comments = newMemoryCommentStore()
+	path := filepath.Join(t.TempDir(), "words")
+	os.WriteFile(path, []byte("# blocked\nDarn\n\nheck\n"), 0o644)
+	filter, err := newChatFilter(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newChatFilter(filepath.Join(t.TempDir(), "missing"), 1); err == nil {
+		t.Error("read a missing file")
+	}
+	if got := filter.mask("DARN it, what the heck... darned"); got != "**** it, what the ****... darned" {
+		t.Errorf("got %q", got)
+	}
+
+	ctx := context.Background()
+	recorder := newGameRecorder(newGameID(), "", nil, "")
+	recorder.Record(ctx, GameCreated, "", nil)
+	game := recorder.State().ID
+	comment := Comment{Author: "heck", Text: "darn, see https://a.example and www.b.example", Poster: "ip:192.0.2.1"}
+	if err := filter.hook(game, &comment); err == nil || !strings.Contains(err.Error(), "links") {
+		t.Errorf("got %v for two links", err)
+	}
+	comment = Comment{Author: "heck", Text: "darn, see https://a.example", Poster: "ip:192.0.2.1"}
+	if err := filter.hook(game, &comment); err != nil || comment.Author != "****" || comment.Text != "****, see https://a.example" {
+		t.Fatalf("got %v %+v", err, comment)
+	}
+	comments.Update(game, func(list *[]Comment) error {
+		*list = append(*list, comment)
+		return nil
+	})
+	again := Comment{Author: "bo", Text: "darn, SEE https://a.example", Poster: "ip:192.0.2.1"}
+	if err := filter.hook(game, &again); err != errRepeatedComment {
+		t.Errorf("got %v repeating a comment", err)
+	}
+	other := Comment{Author: "cy", Text: "****, see https://a.example", Poster: "ip:192.0.2.2"}
+	if err := filter.hook(game, &other); err != nil {
+		t.Errorf("got %v for another poster", err)
+	}
+}
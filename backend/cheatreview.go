@@ -0,0 +1,404 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+	"github.com/alvaronaschez/simple-chess/engine"
+)
+
+// how the moves of rated games are reviewed: those of the opening are left
+// out, those after are searched reviewDepth moves deep, for reviewMoveTime
+// at most below. A reply is instant under instantReply, and a position complex if
+// it has complexMoves legal moves at least and no move much better than
+// the next best. Games with fewer than reviewMinMoves moves reviewed say
+// nothing, accounts are scored by their last reviewedGames
+const (
+	reviewOpeningPlies = 10
+	reviewDepth        = 3
+	instantReply       = time.Second
+	complexMoves       = 20
+	complexMargin      = 50
+	reviewMinMoves     = 10
+	reviewedGames      = 10
+)
+
+// reviewThreshold is the score from which accounts are up for review
+var (
+	reviewMoveTime  = 100 * time.Millisecond
+	reviewThreshold = 0.6
+)
+
+// gameReview is how suspicious the moves of the player of Color in a game
+// look. Uniformity is 1 when they all took as long, 0 when how long they
+// took varies as much as it takes on average; Instant is the share of
+// the complex positions answered instantly, EngineMatch that of the moves
+// the engine would have played. Score combines them, the engine matching
+// counting the most, and from 0 to 1 as they do
+type gameReview struct {
+	GameID      string    `json:"gameId"`
+	Color       string    `json:"color"`
+	Moves       int       `json:"moves"`
+	Uniformity  float64   `json:"uniformity"`
+	Instant     float64   `json:"instant"`
+	EngineMatch float64   `json:"engineMatch"`
+	Score       float64   `json:"score"`
+	ReviewedAt  time.Time `json:"reviewedAt"`
+}
+
+// accountReview is an account and its last games reviewed, Score the mean
+// of theirs
+type accountReview struct {
+	Player string       `json:"player"`
+	Score  float64      `json:"score"`
+	Games  []gameReview `json:"games"`
+}
+
+// ReviewStore keeps the reviews of the accounts that played rated games
+type ReviewStore interface {
+	// Update saves the review of the account player as change leaves it,
+	// one without games if it has none yet, unless change fails
+	Update(player string, change func(*accountReview) error) error
+	// List is every account reviewed, in no particular order
+	List() ([]accountReview, error)
+	// Delete forgets the reviews of the account player
+	Delete(player string) error
+}
+
+var accountReviews ReviewStore = newMemoryReviewStore()
+
+func newReviewStore(dataDir string) (ReviewStore, error) {
+	if dataDir == "" {
+		return newMemoryReviewStore(), nil
+	}
+	return newFileReviewStore(filepath.Join(dataDir, "reviews"))
+}
+
+// memoryReviewStore keeps reviews encoded, for those loaded not to share
+// anything with those stored
+type memoryReviewStore struct {
+	mu       sync.Mutex
+	accounts map[string][]byte
+}
+
+func newMemoryReviewStore() *memoryReviewStore {
+	return &memoryReviewStore{accounts: map[string][]byte{}}
+}
+
+func (s *memoryReviewStore) Update(player string, change func(*accountReview) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := accountReview{Player: player}
+	if data, ok := s.accounts[player]; ok {
+		if err := json.Unmarshal(data, &account); err != nil {
+			return err
+		}
+	}
+	if err := change(&account); err != nil {
+		return err
+	}
+	data, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	s.accounts[player] = data
+	return nil
+}
+
+func (s *memoryReviewStore) List() ([]accountReview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	listed := []accountReview{}
+	for _, data := range s.accounts {
+		account := accountReview{}
+		if err := json.Unmarshal(data, &account); err != nil {
+			return nil, err
+		}
+		listed = append(listed, account)
+	}
+	return listed, nil
+}
+
+func (s *memoryReviewStore) Delete(player string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accounts, player)
+	return nil
+}
+
+// fileReviewStore keeps one JSON file per account reviewed, replaced as
+// a whole
+type fileReviewStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newFileReviewStore(dir string) (*fileReviewStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileReviewStore{dir: dir}, nil
+}
+
+func (s *fileReviewStore) path(player string) string {
+	return filepath.Join(s.dir, player+".json")
+}
+
+func (s *fileReviewStore) Update(player string, change func(*accountReview) error) error {
+	if filepath.Base(player) != player {
+		return ErrPlayerNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := accountReview{Player: player}
+	data, err := os.ReadFile(s.path(player))
+	if err == nil {
+		err = json.Unmarshal(data, &account)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := change(&account); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(account); err != nil {
+		return err
+	}
+	tmp := s.path(player) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(player))
+}
+
+func (s *fileReviewStore) List() ([]accountReview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	listed := []accountReview{}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		account := accountReview{}
+		if err := json.Unmarshal(data, &account); err != nil {
+			return nil, err
+		}
+		listed = append(listed, account)
+	}
+	return listed, nil
+}
+
+func (s *fileReviewStore) Delete(player string) error {
+	if filepath.Base(player) != player {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path(player))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// addReview adds review to the last games reviewed of player, scoring
+// the account again
+func addReview(player string, review gameReview) {
+	err := accountReviews.Update(player, func(account *accountReview) error {
+		account.Games = append(account.Games, review)
+		if len(account.Games) > reviewedGames {
+			account.Games = account.Games[len(account.Games)-reviewedGames:]
+		}
+		account.Score = 0
+		for _, game := range account.Games {
+			account.Score += game.Score / float64(len(account.Games))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("cannot review player %s: %v", player, err)
+	}
+}
+
+// listSuspects are the accounts scored reviewThreshold at least, the most
+// suspicious first
+func listSuspects() ([]accountReview, error) {
+	accounts, err := accountReviews.List()
+	if err != nil {
+		return nil, err
+	}
+	listed := slices.DeleteFunc(accounts, func(account accountReview) bool { return account.Score < reviewThreshold })
+	slices.SortFunc(listed, func(a, b accountReview) int {
+		if a.Score != b.Score {
+			return cmp.Compare(b.Score, a.Score)
+		}
+		return cmp.Compare(a.Player, b.Player)
+	})
+	return listed, nil
+}
+
+// reviewQueue reviews the rated games as they finish, one at a time in the
+// background, dropping those finished while too many wait
+type reviewQueue struct {
+	once  sync.Once
+	games chan GameState
+}
+
+var reviews = &reviewQueue{}
+
+func (queue *reviewQueue) submit(state GameState) {
+	queue.once.Do(func() {
+		queue.games = make(chan GameState, 64)
+		go func() {
+			for state := range queue.games {
+				reviewGame(state)
+			}
+		}()
+	})
+	select {
+	case queue.games <- state:
+	default:
+		log.Printf("cannot review game %s: too many waiting", state.ID)
+	}
+}
+
+func init() {
+	bus.subscribe(busGameFinished, func(event busEvent) {
+		if isRated(event.State) && event.State.Variant == "" {
+			reviews.submit(event.State)
+		}
+	})
+}
+
+// reviewGame reviews the moves of both players of the game of state, adding
+// what was found to their accounts
+func reviewGame(state GameState) {
+	for color, review := range reviewMoves(state) {
+		if review.Moves >= reviewMinMoves {
+			addReview(state.Players[color], review)
+		}
+	}
+}
+
+// reviewMoves reviews the moves of each color in the game of state past
+// the opening
+func reviewMoves(state GameState) map[string]gameReview {
+	type tally struct {
+		spent            []float64
+		complex, instant int
+		matched          int
+	}
+	tallies := map[string]*tally{"white": {}, "black": {}}
+	position := startPosition(state.FEN)
+	for ply, m := range state.Moves {
+		parsed, err := chess.ParseMove(m.UCI())
+		if err != nil || !position.IsLegal(parsed) {
+			break
+		}
+		if ply >= reviewOpeningPlies {
+			t := tallies[colorToMove(position)]
+			t.spent = append(t.spent, float64(m.SpentMs))
+			lines := engine.Analyze(context.Background(), position, 2, reviewDepth, reviewMoveTime)
+			if len(lines) > 0 && lines[0].Moves[0] == parsed {
+				t.matched++
+			}
+			if isComplex(position, lines) {
+				t.complex++
+				if time.Duration(m.SpentMs)*time.Millisecond < instantReply {
+					t.instant++
+				}
+			}
+		}
+		position = position.Apply(parsed)
+	}
+	reviewed := map[string]gameReview{}
+	now := time.Now().UTC()
+	for color, t := range tallies {
+		review := gameReview{GameID: state.ID, Color: color, Moves: len(t.spent), Uniformity: uniformity(t.spent), ReviewedAt: now}
+		if review.Moves > 0 {
+			review.EngineMatch = float64(t.matched) / float64(review.Moves)
+		}
+		if t.complex > 0 {
+			review.Instant = float64(t.instant) / float64(t.complex)
+		}
+		// the engine matching alone is how strong players play too, the
+		// timing of the moves tells them from those who look it up
+		review.Score = review.EngineMatch * (0.5 + 0.25*review.Uniformity + 0.25*review.Instant)
+		reviewed[color] = review
+	}
+	return reviewed
+}
+
+// colorToMove is the color of the player to move in position
+func colorToMove(position chess.Position) string {
+	if position.Turn() == chess.Black {
+		return "black"
+	}
+	return "white"
+}
+
+// isComplex tells whether position, whose best lines are lines, leaves much
+// to think about: many moves, none forced or winning outright
+func isComplex(position chess.Position, lines []engine.Line) bool {
+	if len(position.LegalMoves()) < complexMoves || len(lines) < 2 || lines[0].Mate != 0 || lines[1].Mate != 0 {
+		return false
+	}
+	return lines[0].Score-lines[1].Score <= complexMargin
+}
+
+// uniformity is 1 less the coefficient of variation of spent, 0 at least
+func uniformity(spent []float64) float64 {
+	if len(spent) < 2 {
+		return 0
+	}
+	var mean float64
+	for _, s := range spent {
+		mean += s / float64(len(spent))
+	}
+	if mean == 0 {
+		return 1
+	}
+	var variance float64
+	for _, s := range spent {
+		variance += (s - mean) * (s - mean) / float64(len(spent))
+	}
+	return max(0, 1-math.Sqrt(variance)/mean)
+}
+
+func listReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	listed, err := listSuspects()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, listed)
+}
+
+// clearReviewHandler forgets the reviews of the player, once a moderator
+// looked at them
+func clearReviewHandler(w http.ResponseWriter, r *http.Request) {
+	if err := accountReviews.Delete(r.PathValue("player")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+	"github.com/alvaronaschez/simple-chess/engine"
+)
+
+func TestUniformity(t *testing.T) {
+	for _, test := range []struct {
+		spent []float64
+		want  float64
+	}{
+		{nil, 0},
+		{[]float64{2000}, 0},
+		{[]float64{2000, 2000, 2000}, 1},
+		{[]float64{0, 0}, 1},
+		{[]float64{1000, 3000}, 0.5},
+		{[]float64{0, 10000}, 0},
+	} {
+		if got := uniformity(test.spent); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.spent, got, test.want)
+		}
+	}
+}
+
+func TestReviewGame(t *testing.T) {
+	defer func(moveTime time.Duration) { reviewMoveTime = moveTime }(reviewMoveTime)
+	// the engine gets to the bottom of every position, for white to match it
+	reviewMoveTime = time.Minute
+	defer func(s ReviewStore) { accountReviews = s }(accountReviews)
+	accountReviews = newMemoryReviewStore()
+	// white plays what the engine would, every move taking as long; black
+	// anything else, taking all sorts of times
+	state := GameState{ID: newGameID(), Players: map[string]string{"white": "alice", "black": "bob"}}
+	position := chess.NewPosition()
+	for ply := range reviewOpeningPlies + 2*reviewMinMoves {
+		moves := position.LegalMoves()
+		if len(moves) == 0 {
+			break
+		}
+		played := moves[0]
+		if ply >= reviewOpeningPlies {
+			best := engine.Analyze(context.Background(), position, 2, reviewDepth, reviewMoveTime)[0].Moves[0]
+			played = best
+			if position.Turn() == chess.Black {
+				for _, m := range moves {
+					if m != best {
+						played = m
+					}
+				}
+			}
+		}
+		uci := played.String()
+		m := Move{From: uci[:2], To: uci[2:4], Promotion: uci[4:], SpentMs: 2000}
+		if position.Turn() == chess.Black {
+			m.SpentMs = int64(ply*ply*100) % 17000
+		}
+		state.Moves = append(state.Moves, m)
+		position = position.Apply(played)
+	}
+
+	reviewed := reviewMoves(state)
+	white, black := reviewed["white"], reviewed["black"]
+	if white.Moves < reviewMinMoves || white.EngineMatch != 1 || white.Uniformity < 0.99 || white.Score < reviewThreshold {
+		t.Fatalf("got %+v for white", white)
+	}
+	if black.EngineMatch != 0 || black.Uniformity > 0.5 || black.Score != 0 {
+		t.Fatalf("got %+v for black", black)
+	}
+
+	reviewGame(state)
+	r := httptest.NewRequest("GET", "/reviews", nil)
+	r.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+	newAdminMux("admin").ServeHTTP(w, r)
+	var listed []accountReview
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].Player != "alice" || len(listed[0].Games) != 1 || listed[0].Games[0].GameID != state.ID {
+		t.Fatalf("got %+v", listed)
+	}
+
+	r = httptest.NewRequest("DELETE", "/reviews/alice", nil)
+	r.Header.Set("Authorization", "Bearer admin")
+	w = httptest.NewRecorder()
+	newAdminMux("admin").ServeHTTP(w, r)
+	if listed, err := listSuspects(); w.Code != http.StatusNoContent || err != nil || len(listed) != 0 {
+		t.Fatalf("got %d, %v listed once cleared", w.Code, listed)
+	}
+}
@@ -0,0 +1,29 @@
+package chess
+
+import "testing"
+
+// kiwipete has every kind of move, castling, en passant and promotions alike
+const kiwipete = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+
+func BenchmarkLegalMoves(b *testing.B) {
+	position, err := ParseFEN(kiwipete)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for range b.N {
+		position.LegalMoves()
+	}
+}
+
+func BenchmarkAttacked(b *testing.B) {
+	position, err := ParseFEN(kiwipete)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for range b.N {
+		for sq := Square(0); sq < 64; sq++ {
+			position.Attacked(sq, Black)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package chess
+
+import "math/bits"
+
+// bitboard is a set of squares, a bit each with a1 the lowest
+type bitboard uint64
+
+func squareBit(sq Square) bitboard {
+	return 1 << uint(sq)
+}
+
+func (b bitboard) has(sq Square) bool {
+	return b&squareBit(sq) != 0
+}
+
+func (b bitboard) count() int {
+	return bits.OnesCount64(uint64(b))
+}
+
+// pop takes the lowest square out of b, which cannot be empty
+func (b *bitboard) pop() Square {
+	sq := Square(bits.TrailingZeros64(uint64(*b)))
+	*b &= *b - 1
+	return sq
+}
+
+const (
+	firstRank bitboard = 0xff
+	lastRank  bitboard = 0xff << 56
+)
+
+// the squares attacked from every square by the pieces that step, pawns
+// of either color included
+var (
+	knightAttacks [64]bitboard
+	kingAttacks   [64]bitboard
+	pawnAttacks   [2][64]bitboard
+)
+
+// magic looks up the squares a slider attacks from a square, whichever the
+// pieces in the way: multiplying those on its rays by number and keeping
+// the top bits makes a different index for every set of them that gives
+// different attacks, see newMagic
+type magic struct {
+	mask    bitboard
+	number  uint64
+	shift   uint8
+	attacks []bitboard
+}
+
+func (m *magic) index(occupied bitboard) uint64 {
+	return uint64(occupied&m.mask) * m.number >> m.shift
+}
+
+var bishopMagics, rookMagics [64]magic
+
+// between are the squares between two on the same rank, file or diagonal
+var between [64][64]bitboard
+
+func bishopAttacks(sq Square, occupied bitboard) bitboard {
+	m := &bishopMagics[sq]
+	return m.attacks[m.index(occupied)]
+}
+
+func rookAttacks(sq Square, occupied bitboard) bitboard {
+	m := &rookMagics[sq]
+	return m.attacks[m.index(occupied)]
+}
+
+func init() {
+	for sq := Square(0); sq < 64; sq++ {
+		knightAttacks[sq] = stepAttacks(sq, knightSteps)
+		kingAttacks[sq] = stepAttacks(sq, kingSteps)
+		pawnAttacks[White][sq] = stepAttacks(sq, [][2]int{{-1, 1}, {1, 1}})
+		pawnAttacks[Black][sq] = stepAttacks(sq, [][2]int{{-1, -1}, {1, -1}})
+		// the king steps in every direction there is
+		for _, offset := range kingSteps {
+			var ray bitboard
+			for to, ok := step(sq, offset); ok; to, ok = step(to, offset) {
+				between[sq][to] = ray
+				ray |= squareBit(to)
+			}
+		}
+	}
+	for sq := Square(0); sq < 64; sq++ {
+		var ok bool
+		bishopMagics[sq], ok = newMagic(sq, bishopSteps, bishopNumbers[sq])
+		if !ok {
+			panic("bad bishop magic for " + sq.String())
+		}
+		rookMagics[sq], ok = newMagic(sq, rookSteps, rookNumbers[sq])
+		if !ok {
+			panic("bad rook magic for " + sq.String())
+		}
+	}
+}
+
+func stepAttacks(sq Square, steps [][2]int) bitboard {
+	var attacks bitboard
+	for _, offset := range steps {
+		if to, ok := step(sq, offset); ok {
+			attacks |= squareBit(to)
+		}
+	}
+	return attacks
+}
+
+// slideAttacks are the squares a slider on sq attacks along steps, up to
+// the first occupied one on each ray; the magics look them up faster
+func slideAttacks(sq Square, steps [][2]int, occupied bitboard) bitboard {
+	var attacks bitboard
+	for _, offset := range steps {
+		for to, ok := step(sq, offset); ok; to, ok = step(to, offset) {
+			attacks |= squareBit(to)
+			if occupied.has(to) {
+				break
+			}
+		}
+	}
+	return attacks
+}
+
+// newMagic is the magic with number for a slider on sq moving along steps,
+// reporting false if number does not make one. Only the squares on the
+// rays before the edge of the board may block the slider
+func newMagic(sq Square, steps [][2]int, number uint64) (magic, bool) {
+	var mask bitboard
+	for _, offset := range steps {
+		for to, ok := step(sq, offset); ok; to, ok = step(to, offset) {
+			if _, inside := step(to, offset); !inside {
+				break
+			}
+			mask |= squareBit(to)
+		}
+	}
+	m := magic{mask: mask, number: number, shift: uint8(64 - mask.count())}
+	m.attacks = make([]bitboard, 1<<mask.count())
+	filled := make([]bool, len(m.attacks))
+	// every subset of the mask, and what the slider attacks with it
+	for subset := bitboard(0); ; {
+		index, attacks := m.index(subset), slideAttacks(sq, steps, subset)
+		if filled[index] && m.attacks[index] != attacks {
+			return magic{}, false
+		}
+		filled[index], m.attacks[index] = true, attacks
+		if subset = (subset - mask) & mask; subset == 0 {
+			return m, true
+		}
+	}
+}
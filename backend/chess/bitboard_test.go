@@ -0,0 +1,19 @@
+package chess
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestMagicsAgreeWithSlides(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 10000 {
+		sq, occupied := Square(r.IntN(64)), bitboard(r.Uint64()&r.Uint64())
+		if got, want := bishopAttacks(sq, occupied), slideAttacks(sq, bishopSteps, occupied); got != want {
+			t.Fatalf("bishop on %s attacks %#x, want %#x", sq, got, want)
+		}
+		if got, want := rookAttacks(sq, occupied), slideAttacks(sq, rookSteps, occupied); got != want {
+			t.Fatalf("rook on %s attacks %#x, want %#x", sq, got, want)
+		}
+	}
+}
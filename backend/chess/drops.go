@@ -0,0 +1,159 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// String is the lowercase letter of t, as in FEN
+func (t PieceType) String() string {
+	if t == NoPieceType || t > King {
+		return ""
+	}
+	return string(pieceLetters[t])
+}
+
+// ParsePieceType parses the letter of a piece type, like p or N
+func ParsePieceType(s string) (PieceType, error) {
+	if len(s) == 1 {
+		if i := strings.IndexByte(pieceLetters, s[0]|0x20); i >= int(Pawn) {
+			return PieceType(i), nil
+		}
+	}
+	return NoPieceType, fmt.Errorf("invalid piece type %q", s)
+}
+
+// WithDrops is position in a variant where captured pieces go to a pocket
+// and can be dropped back on the board, like crazyhouse or bughouse
+func (position Position) WithDrops() Position {
+	position.drops = true
+	return position
+}
+
+// Drops reports whether pieces can be dropped in position
+func (position Position) Drops() bool {
+	return position.drops
+}
+
+// Pocket is how many pieces of type t c has to drop
+func (position Position) Pocket(c Color, t PieceType) int {
+	if t < Pawn || t >= King {
+		return 0
+	}
+	return int(position.pockets[c][t])
+}
+
+// AddToPocket gives c a piece of type t to drop, which cannot be a king
+func (position Position) AddToPocket(c Color, t PieceType) Position {
+	if t >= Pawn && t < King {
+		position.drops = true
+		position.setPocket(c, t, position.pockets[c][t]+1)
+	}
+	return position
+}
+
+// Captured is the piece type m takes, as it goes to a pocket: promoted
+// pieces go back as pawns
+func (position Position) Captured(m Move) PieceType {
+	switch {
+	case m.Drop != NoPieceType:
+		return NoPieceType
+	case position.board[m.From].Type() == Pawn && m.To == position.enPassant:
+		return Pawn
+	case position.board[m.To] == NoPiece:
+		return NoPieceType
+	case position.promoted&(1<<m.To) != 0:
+		return Pawn
+	}
+	return position.board[m.To].Type()
+}
+
+func (position Position) pocketed(c Color) bool {
+	for _, n := range position.pockets[c] {
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// appendDrops adds a drop of every piece in the pocket of the side to move
+// on every empty square, pawns cannot go on the first or last rank
+func (position Position) appendDrops(moves []Move) []Move {
+	us := position.turn
+	for t := Pawn; t < King; t++ {
+		if position.pockets[us][t] == 0 {
+			continue
+		}
+		empty := ^position.occupied()
+		if t == Pawn {
+			empty &^= firstRank | lastRank
+		}
+		for empty != 0 {
+			moves = append(moves, Move{From: NoSquare, To: empty.pop(), Drop: t})
+		}
+	}
+	return moves
+}
+
+func (position Position) applyDrop(m Move) Position {
+	next := position
+	next.hash ^= position.stateKey()
+	next.put(m.To, NewPiece(position.turn, m.Drop))
+	next.setPocket(position.turn, m.Drop, position.pockets[position.turn][m.Drop]-1)
+	next.enPassant = NoSquare
+	next.halfmoves++
+	if position.turn == Black {
+		next.fullmoves++
+	}
+	next.turn = position.turn.Other()
+	next.hash ^= next.stateKey()
+	return next
+}
+
+// promotedAfter are the squares of promoted pieces once m, which is not a
+// drop, is played and leaves the board of next
+func (position Position) promotedAfter(m Move, next Position) uint64 {
+	promoted := position.promoted &^ (1<<m.From | 1<<m.To)
+	if position.promoted&(1<<m.From) != 0 || m.Promotion != NoPieceType {
+		promoted |= 1 << m.To
+	}
+	// en passant empties a square other than the ones of m
+	for sq, piece := range next.board {
+		if piece == NoPiece {
+			promoted &^= 1 << sq
+		}
+	}
+	return promoted
+}
+
+// pocketFEN is the pocket field of position, white pieces first
+func (position Position) pocketFEN() string {
+	var s strings.Builder
+	s.WriteByte('[')
+	for _, c := range []Color{White, Black} {
+		for t := Queen; t >= Pawn; t-- {
+			for range position.pockets[c][t] {
+				s.WriteByte(NewPiece(c, t).Letter())
+			}
+		}
+	}
+	s.WriteByte(']')
+	return s.String()
+}
+
+func (position *Position) parsePocket(pocket string) error {
+	position.drops = true
+	for _, c := range []byte(pocket) {
+		i := strings.IndexByte(pieceLetters, c|0x20)
+		if i < int(Pawn) || i >= int(King) {
+			return fmt.Errorf("%w: bad pocket %q", ErrInvalidFEN, pocket)
+		}
+		color := Black
+		if c < 'a' {
+			color = White
+		}
+		position.setPocket(color, PieceType(i), position.pockets[color][i]+1)
+	}
+	return nil
+}
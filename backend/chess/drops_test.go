@@ -0,0 +1,81 @@
+package chess
+
+import "testing"
+
+func TestPocketFEN(t *testing.T) {
+	for _, fen := range []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1",
+		"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R[QPnp] w KQkq - 2 3",
+		"4k2Q~/8/8/8/8/8/8/4K3[] b - - 0 1",
+	} {
+		position, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := position.FEN(); got != fen {
+			t.Errorf("%s is written back as %s", fen, got)
+		}
+	}
+	// a promoted piece is only marked where pieces can be dropped
+	if _, err := ParseFEN("4k2Q~/8/8/8/8/8/8/4K3 b - - 0 1"); err == nil {
+		t.Error("a promoted piece was parsed without a pocket")
+	}
+}
+
+func TestDrops(t *testing.T) {
+	position, err := ParseFEN("4k3/8/8/8/8/8/8/4K3[Pn] w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		move  string
+		legal bool
+	}{
+		{"P@e4", true},
+		{"P@e8", false},
+		{"P@a1", false},
+		{"P@e1", false},
+		{"N@f3", false},
+	} {
+		m, err := ParseMove(test.move)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := position.IsLegal(m); got != test.legal {
+			t.Errorf("%s is legal is %v", test.move, got)
+		}
+	}
+	next := position.Apply(Move{From: NoSquare, To: NewSquare(4, 3), Drop: Pawn})
+	if next.Pocket(White, Pawn) != 0 || next.PieceAt(NewSquare(4, 3)) != NewPiece(White, Pawn) {
+		t.Errorf("the dropped pawn is not on the board: %s", next.FEN())
+	}
+}
+
+func TestDropBlocksMate(t *testing.T) {
+	// the rook mates unless a piece is dropped in between
+	position, err := ParseFEN("R5k1/5ppp/8/8/8/8/8/6K1[] b - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position.Status() != Checkmate {
+		t.Fatalf("%s is not mate", position.FEN())
+	}
+	if got := position.AddToPocket(Black, Knight).Status(); got != Ongoing {
+		t.Errorf("with a knight to drop the status is %v", got)
+	}
+}
+
+func TestCapturedPromotedPiece(t *testing.T) {
+	position, err := ParseFEN("3rk3/4P3/8/8/8/8/8/4K3[] w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	position = position.Apply(Move{From: NewSquare(4, 6), To: NewSquare(3, 7), Promotion: Queen})
+	takes := Move{From: NewSquare(4, 7), To: NewSquare(3, 7)}
+	if got := position.Captured(takes); got != Pawn {
+		t.Errorf("the promoted queen goes to the pocket as %v", got)
+	}
+	if position.Apply(takes).FEN() != "3k4/8/8/8/8/8/8/4K3[] w - - 0 2" {
+		t.Errorf("taking the promoted queen leaves %s", position.Apply(takes).FEN())
+	}
+}
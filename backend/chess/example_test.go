@@ -0,0 +1,29 @@
+package chess_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+func ExamplePosition_ApplyMove() {
+	position := chess.NewPosition()
+	for _, s := range []string{"f2f3", "e7e5", "g2g4", "d8h4"} {
+		m, err := chess.ParseMove(s)
+		if err != nil {
+			panic(err)
+		}
+		if position, err = position.ApplyMove(m); err != nil {
+			panic(err)
+		}
+	}
+	fmt.Println(position.Status() == chess.Checkmate, len(position.LegalMoves()))
+
+	m, _ := chess.ParseMove("e1e2")
+	_, err := position.ApplyMove(m)
+	fmt.Println(errors.Is(err, chess.ErrIllegalMove))
+	// Output:
+	// true 0
+	// true
+}
@@ -0,0 +1,72 @@
+package chess
+
+import "testing"
+
+// checkPosition fails if position is not one a game could get to
+func checkPosition(t *testing.T, position Position) {
+	t.Helper()
+	kings := [2]int{}
+	for _, piece := range position.board {
+		if piece.Type() == King {
+			kings[piece.Color()]++
+		}
+	}
+	if kings != [2]int{1, 1} {
+		t.Fatalf("%s: %v kings", position.FEN(), kings)
+	}
+	// the side that just moved cannot be left in check
+	if position.Attacked(position.king(position.turn.Other()), position.turn) {
+		t.Fatalf("%s: the side not to move is in check", position.FEN())
+	}
+	again, err := ParseFEN(position.FEN())
+	if err != nil || again != position {
+		t.Fatalf("%s does not parse back: %v", position.FEN(), err)
+	}
+}
+
+// FuzzMoves plays games where every byte picks the next move among the legal ones
+func FuzzMoves(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{12, 19, 3, 200, 7, 7, 7, 7, 7, 7, 7, 7})
+	f.Fuzz(func(t *testing.T, choices []byte) {
+		position := NewPosition()
+		for _, choice := range choices {
+			moves := position.LegalMoves()
+			if len(moves) == 0 {
+				return
+			}
+			m := moves[int(choice)%len(moves)]
+			if !position.IsLegal(m) {
+				t.Fatalf("%s: generated move %s is not legal", position.FEN(), m)
+			}
+			parsed, err := ParseMove(m.String())
+			if err != nil || parsed != m {
+				t.Fatalf("%s does not parse back: %v", m, err)
+			}
+			position = position.Apply(m)
+			checkPosition(t, position)
+		}
+	})
+}
+
+// FuzzParseFEN feeds arbitrary positions to the parser and the move generator
+func FuzzParseFEN(f *testing.F) {
+	f.Add(StartingFEN)
+	f.Add("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	f.Add("8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1")
+	f.Add("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R[QPnp] w KQkq - 2 3")
+	f.Fuzz(func(t *testing.T, fen string) {
+		position, err := ParseFEN(fen)
+		if err != nil {
+			return
+		}
+		again, err := ParseFEN(position.FEN())
+		if err != nil || again != position {
+			t.Fatalf("%q parsed as %s which does not parse back: %v", fen, position.FEN(), err)
+		}
+		for _, m := range position.LegalMoves() {
+			position.Apply(m).FEN()
+		}
+		position.Status()
+	})
+}
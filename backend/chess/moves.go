@@ -0,0 +1,355 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Move is a move in coordinate notation, Promotion is only set for pawns
+// reaching the last rank and castling is the king moving two squares.
+// Drop is the piece type put on To from a pocket, From is then NoSquare
+type Move struct {
+	From, To  Square
+	Promotion PieceType
+	Drop      PieceType
+}
+
+// String is the move in UCI notation, like e2e4, e7e8q or N@f3
+func (m Move) String() string {
+	if m.Drop != NoPieceType {
+		return string(NewPiece(White, m.Drop).Letter()) + "@" + m.To.String()
+	}
+	s := m.From.String() + m.To.String()
+	if m.Promotion != NoPieceType {
+		s += string(pieceLetters[m.Promotion])
+	}
+	return s
+}
+
+var ErrInvalidMove = errors.New("invalid move")
+
+// ParseMove parses a move in UCI notation, it does not check it is legal
+func ParseMove(s string) (Move, error) {
+	if len(s) == 4 && s[1] == '@' {
+		return parseDrop(s)
+	}
+	if len(s) != 4 && len(s) != 5 {
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidMove, s)
+	}
+	from, err := ParseSquare(s[:2])
+	if err != nil {
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidMove, s)
+	}
+	to, err := ParseSquare(s[2:4])
+	if err != nil {
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidMove, s)
+	}
+	promotion, err := ParsePromotion(s[4:])
+	if err != nil {
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidMove, s)
+	}
+	return Move{From: from, To: to, Promotion: promotion}, nil
+}
+
+func parseDrop(s string) (Move, error) {
+	t, err := ParsePieceType(s[:1])
+	if err != nil || t == King {
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidMove, s)
+	}
+	to, err := ParseSquare(s[2:])
+	if err != nil {
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidMove, s)
+	}
+	return Move{From: NoSquare, To: to, Drop: t}, nil
+}
+
+// ParsePromotion parses one of q, r, b and n, or an empty string for no promotion
+func ParsePromotion(s string) (PieceType, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return NoPieceType, nil
+	case "q":
+		return Queen, nil
+	case "r":
+		return Rook, nil
+	case "b":
+		return Bishop, nil
+	case "n":
+		return Knight, nil
+	}
+	return NoPieceType, fmt.Errorf("%w: bad promotion %q", ErrInvalidMove, s)
+}
+
+// offsets as file and rank steps
+var (
+	knightSteps    = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingSteps      = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	bishopSteps    = [][2]int{{1, 1}, {-1, 1}, {-1, -1}, {1, -1}}
+	rookSteps      = [][2]int{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	promotionTypes = []PieceType{Queen, Rook, Bishop, Knight}
+)
+
+// step is the square at the given offset from sq, if it is on the board
+func step(sq Square, offset [2]int) (Square, bool) {
+	file, rank := sq.File()+offset[0], sq.Rank()+offset[1]
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return NoSquare, false
+	}
+	return NewSquare(file, rank), true
+}
+
+// Attacked reports whether a piece of color by attacks sq
+func (position Position) Attacked(sq Square, by Color) bool {
+	them, occupied := position.byColor[by], position.occupied()
+	// pawns of by attack sq from where a pawn of the other color on sq would
+	return pawnAttacks[by.Other()][sq]&them&position.byType[Pawn] != 0 ||
+		knightAttacks[sq]&them&position.byType[Knight] != 0 ||
+		kingAttacks[sq]&them&position.byType[King] != 0 ||
+		bishopAttacks(sq, occupied)&them&(position.byType[Bishop]|position.byType[Queen]) != 0 ||
+		rookAttacks(sq, occupied)&them&(position.byType[Rook]|position.byType[Queen]) != 0
+}
+
+func (position Position) king(c Color) Square {
+	kings := position.byType[King] & position.byColor[c]
+	if kings == 0 {
+		return NoSquare
+	}
+	return kings.pop()
+}
+
+// InCheck reports whether the side to move is in check
+func (position Position) InCheck() bool {
+	king := position.king(position.turn)
+	return king != NoSquare && position.Attacked(king, position.turn.Other())
+}
+
+// pseudoLegalMoves are the moves of the side to move that may leave its king in check
+func (position Position) pseudoLegalMoves() []Move {
+	moves := make([]Move, 0, 48)
+	us := position.turn
+	ours, occupied := position.byColor[us], position.occupied()
+	for pawns := position.byType[Pawn] & ours; pawns != 0; {
+		moves = position.appendPawnMoves(moves, pawns.pop())
+	}
+	for knights := position.byType[Knight] & ours; knights != 0; {
+		from := knights.pop()
+		moves = appendTargets(moves, from, knightAttacks[from]&^ours)
+	}
+	for diagonal := (position.byType[Bishop] | position.byType[Queen]) & ours; diagonal != 0; {
+		from := diagonal.pop()
+		moves = appendTargets(moves, from, bishopAttacks(from, occupied)&^ours)
+	}
+	for straight := (position.byType[Rook] | position.byType[Queen]) & ours; straight != 0; {
+		from := straight.pop()
+		moves = appendTargets(moves, from, rookAttacks(from, occupied)&^ours)
+	}
+	if from := position.king(us); from != NoSquare {
+		moves = appendTargets(moves, from, kingAttacks[from]&^ours)
+		moves = position.appendCastling(moves, from)
+	}
+	if position.drops {
+		moves = position.appendDrops(moves)
+	}
+	return moves
+}
+
+// appendTargets adds a move from from to every square of targets
+func appendTargets(moves []Move, from Square, targets bitboard) []Move {
+	for targets != 0 {
+		moves = append(moves, Move{From: from, To: targets.pop()})
+	}
+	return moves
+}
+
+func (position Position) appendPawnMoves(moves []Move, from Square) []Move {
+	us := position.turn
+	forward, startRank, lastRank := Square(8), 1, 7
+	if us == Black {
+		forward, startRank, lastRank = -8, 6, 0
+	}
+	add := func(to Square) {
+		if to.Rank() == lastRank {
+			for _, t := range promotionTypes {
+				moves = append(moves, Move{From: from, To: to, Promotion: t})
+			}
+			return
+		}
+		moves = append(moves, Move{From: from, To: to})
+	}
+	// a position parsed from FEN may have pawns on the last rank
+	occupied := position.occupied()
+	if to := from + forward; to >= 0 && to < 64 && !occupied.has(to) {
+		add(to)
+		if to += forward; from.Rank() == startRank && !occupied.has(to) {
+			add(to)
+		}
+	}
+	targets := position.byColor[us.Other()]
+	if position.enPassant != NoSquare {
+		targets |= squareBit(position.enPassant)
+	}
+	for captures := pawnAttacks[us][from] & targets; captures != 0; {
+		add(captures.pop())
+	}
+	return moves
+}
+
+// appendCastling adds the castling moves, the king cannot castle out of,
+// through or into check
+func (position Position) appendCastling(moves []Move, from Square) []Move {
+	us, them := position.turn, position.turn.Other()
+	kingside, queenside, rank := whiteKingside, whiteQueenside, 0
+	if us == Black {
+		kingside, queenside, rank = blackKingside, blackQueenside, 7
+	}
+	if from != NewSquare(4, rank) || position.castling&(kingside|queenside) == 0 || position.Attacked(from, them) {
+		return moves
+	}
+	occupied := position.occupied()
+	empty := func(files ...int) bool {
+		for _, file := range files {
+			if occupied.has(NewSquare(file, rank)) {
+				return false
+			}
+		}
+		return true
+	}
+	rook := NewPiece(us, Rook)
+	if position.castling&kingside != 0 && position.board[NewSquare(7, rank)] == rook && empty(5, 6) &&
+		!position.Attacked(NewSquare(5, rank), them) && !position.Attacked(NewSquare(6, rank), them) {
+		moves = append(moves, Move{From: from, To: NewSquare(6, rank)})
+	}
+	if position.castling&queenside != 0 && position.board[NewSquare(0, rank)] == rook && empty(1, 2, 3) &&
+		!position.Attacked(NewSquare(3, rank), them) && !position.Attacked(NewSquare(2, rank), them) {
+		moves = append(moves, Move{From: from, To: NewSquare(2, rank)})
+	}
+	return moves
+}
+
+// LegalMoves are the moves the side to move can play
+func (position Position) LegalMoves() []Move {
+	moves := position.pseudoLegalMoves()
+	king := position.king(position.turn)
+	if king == NoSquare {
+		return moves
+	}
+	// out of check, only moves of the king or of pinned pieces can leave it
+	// in check, and en passant, which takes two pieces off the same rank
+	inCheck := position.Attacked(king, position.turn.Other())
+	risky := squareBit(king) | position.pinned(king)
+	legal := moves[:0]
+	for _, m := range moves {
+		if inCheck || m.Drop == NoPieceType &&
+			(risky.has(m.From) || m.To == position.enPassant && position.board[m.From].Type() == Pawn) {
+			if next := position.Apply(m); next.Attacked(next.king(position.turn), next.turn) {
+				continue
+			}
+		}
+		legal = append(legal, m)
+	}
+	return legal
+}
+
+// pinned are the pieces of the side to move alone between its king on king
+// and a slider of the opponent
+func (position Position) pinned(king Square) bitboard {
+	them := position.byColor[position.turn.Other()]
+	snipers := bishopAttacks(king, 0)&them&(position.byType[Bishop]|position.byType[Queen]) |
+		rookAttacks(king, 0)&them&(position.byType[Rook]|position.byType[Queen])
+	var pinned bitboard
+	for snipers != 0 {
+		if blockers := between[king][snipers.pop()] & position.occupied(); blockers.count() == 1 {
+			pinned |= blockers & position.byColor[position.turn]
+		}
+	}
+	return pinned
+}
+
+// IsLegal reports whether m can be played in position
+func (position Position) IsLegal(m Move) bool {
+	for _, legal := range position.LegalMoves() {
+		if legal == m {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrIllegalMove = errors.New("illegal move")
+
+// ApplyMove plays m if it is legal, returning the resulting position
+func (position Position) ApplyMove(m Move) (Position, error) {
+	if !position.IsLegal(m) {
+		return position, fmt.Errorf("%w: %s", ErrIllegalMove, m)
+	}
+	return position.Apply(m), nil
+}
+
+// Apply plays m, which has to be legal, and returns the resulting position;
+// ApplyMove checks it first
+func (position Position) Apply(m Move) Position {
+	if m.Drop != NoPieceType {
+		return position.applyDrop(m)
+	}
+	next := position
+	next.hash ^= position.stateKey()
+	piece := next.remove(m.From)
+	captured := next.remove(m.To)
+	next.put(m.To, piece)
+
+	next.enPassant = NoSquare
+	switch piece.Type() {
+	case Pawn:
+		switch {
+		case m.To == position.enPassant:
+			next.remove(NewSquare(m.To.File(), m.From.Rank()))
+		case m.To.Rank()-m.From.Rank() == 2 || m.From.Rank()-m.To.Rank() == 2:
+			next.enPassant = NewSquare(m.From.File(), (m.From.Rank()+m.To.Rank())/2)
+		case m.Promotion != NoPieceType:
+			next.remove(m.To)
+			next.put(m.To, NewPiece(piece.Color(), m.Promotion))
+		}
+	case King:
+		// castling moves the rook too
+		rank := m.From.Rank()
+		switch m.To.File() - m.From.File() {
+		case 2:
+			next.put(NewSquare(5, rank), next.remove(NewSquare(7, rank)))
+		case -2:
+			next.put(NewSquare(3, rank), next.remove(NewSquare(0, rank)))
+		}
+	}
+
+	// moving the king or a rook, or capturing a rook, loses castling rights
+	for _, sq := range []Square{m.From, m.To} {
+		switch sq {
+		case NewSquare(4, 0):
+			next.castling &^= whiteKingside | whiteQueenside
+		case NewSquare(7, 0):
+			next.castling &^= whiteKingside
+		case NewSquare(0, 0):
+			next.castling &^= whiteQueenside
+		case NewSquare(4, 7):
+			next.castling &^= blackKingside | blackQueenside
+		case NewSquare(7, 7):
+			next.castling &^= blackKingside
+		case NewSquare(0, 7):
+			next.castling &^= blackQueenside
+		}
+	}
+
+	next.halfmoves++
+	if piece.Type() == Pawn || captured != NoPiece {
+		next.halfmoves = 0
+	}
+	if position.turn == Black {
+		next.fullmoves++
+	}
+	if position.drops {
+		next.promoted = position.promotedAfter(m, next)
+	}
+	next.turn = position.turn.Other()
+	next.hash ^= next.stateKey()
+	return next
+}
@@ -0,0 +1,18 @@
+package chess
+
+// Perft counts the sequences of depth legal moves that can be played from
+// position, which move generators are checked against with known counts
+func (position Position) Perft(depth int) int {
+	if depth <= 0 {
+		return 1
+	}
+	moves := position.LegalMoves()
+	if depth == 1 {
+		return len(moves)
+	}
+	nodes := 0
+	for _, m := range moves {
+		nodes += position.Apply(m).Perft(depth - 1)
+	}
+	return nodes
+}
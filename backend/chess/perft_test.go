@@ -0,0 +1,52 @@
+package chess
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// maxShortPerft is the most nodes counted with -short
+const maxShortPerft = 100_000
+
+func TestPerft(t *testing.T) {
+	f, err := os.Open("testdata/perft.epd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		line := lines.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ";")
+		fen := strings.TrimSpace(fields[0])
+		position, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, count := range fields[1:] {
+			var depth, want int
+			if d, n, ok := strings.Cut(strings.TrimSpace(count), " "); ok && strings.HasPrefix(d, "D") {
+				depth, _ = strconv.Atoi(d[1:])
+				want, _ = strconv.Atoi(n)
+			}
+			if depth == 0 || want == 0 {
+				t.Fatalf("%s: bad count %q", fen, count)
+			}
+			if testing.Short() && want > maxShortPerft {
+				continue
+			}
+			if got := position.Perft(depth); got != want {
+				t.Errorf("%s: perft %d is %d, want %d", fen, depth, got, want)
+			}
+		}
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,348 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PGN is a game in Portable Game Notation: its tag pairs, the comment
+// before its first move, its main line and its result, 1-0, 0-1, 1/2-1/2
+// or * if unknown. It starts at the position of its FEN tag, if any
+type PGN struct {
+	Tags    []Tag
+	Comment string
+	Moves   []*PGNMove
+	Result  string
+}
+
+type Tag struct {
+	Name, Value string
+}
+
+// PGNMove is a move of a game with its annotations: the numeric annotation
+// glyphs, $1 for !, $2 for ? and so on, and the comment after it.
+// Variations are lines played instead of it; the comment before the first
+// move of a variation is kept as that of the move
+type PGNMove struct {
+	Move       Move
+	NAGs       []int
+	Comment    string
+	Variations [][]*PGNMove
+}
+
+var ErrInvalidPGN = errors.New("invalid PGN")
+
+// suffixNAGs are the glyphs moves can be annotated with right after them
+var suffixNAGs = map[string]int{"!": 1, "?": 2, "!!": 3, "??": 4, "!?": 5, "?!": 6}
+
+// Tag is the value of the tag called name, empty if there is none
+func (game PGN) Tag(name string) string {
+	for _, tag := range game.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// Start is the position the game starts at
+func (game PGN) Start() (Position, error) {
+	if fen := game.Tag("FEN"); fen != "" {
+		return ParseFEN(fen)
+	}
+	return NewPosition(), nil
+}
+
+// ParsePGN parses a game in PGN, the first one there if there are more
+func ParsePGN(text string) (PGN, error) {
+	p := &pgnParser{text: text}
+	game := PGN{Result: "*"}
+	for {
+		p.skipSpace()
+		if !strings.HasPrefix(p.text[p.i:], "[") {
+			break
+		}
+		tag, err := p.tag()
+		if err != nil {
+			return PGN{}, err
+		}
+		game.Tags = append(game.Tags, tag)
+	}
+	start, err := game.Start()
+	if err != nil {
+		return PGN{}, fmt.Errorf("%w: %v", ErrInvalidPGN, err)
+	}
+	game.Moves, game.Comment, err = p.line(start, 0, &game.Result)
+	return game, err
+}
+
+type pgnParser struct {
+	text string
+	i    int
+}
+
+func (p *pgnParser) skipSpace() {
+	for p.i < len(p.text) {
+		switch {
+		case unicode.IsSpace(rune(p.text[p.i])):
+			p.i++
+		// a line starting with % is escaped, left for other programs
+		case p.text[p.i] == '%' && (p.i == 0 || p.text[p.i-1] == '\n'):
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *pgnParser) skipLine() string {
+	start := p.i
+	for p.i < len(p.text) && p.text[p.i] != '\n' {
+		p.i++
+	}
+	return p.text[start:p.i]
+}
+
+// tag parses a tag pair, [Name "Value"]
+func (p *pgnParser) tag() (Tag, error) {
+	p.i++
+	p.skipSpace()
+	start := p.i
+	for p.i < len(p.text) && !unicode.IsSpace(rune(p.text[p.i])) && p.text[p.i] != '"' {
+		p.i++
+	}
+	tag := Tag{Name: p.text[start:p.i]}
+	p.skipSpace()
+	if tag.Name == "" || p.i == len(p.text) || p.text[p.i] != '"' {
+		return Tag{}, fmt.Errorf("%w: bad tag pair", ErrInvalidPGN)
+	}
+	var value strings.Builder
+	for p.i++; p.i < len(p.text) && p.text[p.i] != '"'; p.i++ {
+		if p.text[p.i] == '\\' && p.i+1 < len(p.text) {
+			p.i++
+		}
+		value.WriteByte(p.text[p.i])
+	}
+	p.i++
+	p.skipSpace()
+	if p.i >= len(p.text) || p.text[p.i] != ']' {
+		return Tag{}, fmt.Errorf("%w: tag pair %s not closed", ErrInvalidPGN, tag.Name)
+	}
+	p.i++
+	tag.Value = value.String()
+	return tag, nil
+}
+
+// line parses the moves played from position, up to the end of the
+// variation depth levels deep or of the game, returning the comment before
+// the first move apart; the result is set at the end of a game
+func (p *pgnParser) line(position Position, depth int, result *string) ([]*PGNMove, string, error) {
+	var (
+		moves   []*PGNMove
+		comment string
+		// before is the position before the last move, variations are
+		// played from it
+		before = position
+	)
+	annotate := func(text string) {
+		switch {
+		case len(moves) > 0:
+			moves[len(moves)-1].Comment = joinComments(moves[len(moves)-1].Comment, text)
+		default:
+			comment = joinComments(comment, text)
+		}
+	}
+	for {
+		p.skipSpace()
+		if p.i == len(p.text) {
+			if depth > 0 {
+				return nil, "", fmt.Errorf("%w: variation not closed", ErrInvalidPGN)
+			}
+			return moves, comment, nil
+		}
+		switch c := p.text[p.i]; {
+		case c == '{':
+			end := strings.IndexByte(p.text[p.i:], '}')
+			if end < 0 {
+				return nil, "", fmt.Errorf("%w: comment not closed", ErrInvalidPGN)
+			}
+			annotate(strings.TrimSpace(p.text[p.i+1 : p.i+end]))
+			p.i += end + 1
+		case c == ';':
+			p.i++
+			annotate(strings.TrimSpace(p.skipLine()))
+		case c == '$':
+			p.i++
+			start := p.i
+			for p.i < len(p.text) && p.text[p.i] >= '0' && p.text[p.i] <= '9' {
+				p.i++
+			}
+			nag, err := strconv.Atoi(p.text[start:p.i])
+			if err != nil || nag > 255 || len(moves) == 0 {
+				return nil, "", fmt.Errorf("%w: bad annotation glyph at %d", ErrInvalidPGN, start)
+			}
+			moves[len(moves)-1].NAGs = append(moves[len(moves)-1].NAGs, nag)
+		case c == '(':
+			if len(moves) == 0 {
+				return nil, "", fmt.Errorf("%w: variation before any move", ErrInvalidPGN)
+			}
+			p.i++
+			variation, first, err := p.line(before, depth+1, result)
+			if err != nil {
+				return nil, "", err
+			}
+			if len(variation) > 0 {
+				variation[0].Comment = joinComments(first, variation[0].Comment)
+				last := moves[len(moves)-1]
+				last.Variations = append(last.Variations, variation)
+			}
+		case c == ')':
+			if depth == 0 {
+				return nil, "", fmt.Errorf("%w: unexpected )", ErrInvalidPGN)
+			}
+			p.i++
+			return moves, comment, nil
+		case c == '[' && depth == 0:
+			// the next game starts
+			return moves, comment, nil
+		default:
+			start := p.i
+			for p.i < len(p.text) && !unicode.IsSpace(rune(p.text[p.i])) && !strings.ContainsRune("{};$()[", rune(p.text[p.i])) {
+				p.i++
+			}
+			symbol := p.text[start:p.i]
+			if symbol == "" {
+				return nil, "", fmt.Errorf("%w: unexpected %q at %d", ErrInvalidPGN, c, start)
+			}
+			if symbol == "1-0" || symbol == "0-1" || symbol == "1/2-1/2" || symbol == "*" {
+				*result = symbol
+				continue
+			}
+			// move numbers, 12. for white and 12... for black, may be
+			// written apart from the move or not
+			digits := strings.TrimLeft(symbol, "0123456789")
+			if digits != symbol && strings.HasPrefix(digits, ".") {
+				symbol = strings.TrimLeft(digits, ".")
+			}
+			if symbol == "" || symbol == "e.p." {
+				continue
+			}
+			san, suffix := symbol, ""
+			if i := strings.IndexAny(symbol, "!?"); i > 0 {
+				san, suffix = symbol[:i], symbol[i:]
+			}
+			m, err := position.ParseSAN(san)
+			if err != nil {
+				return nil, "", fmt.Errorf("%w: %v", ErrInvalidPGN, err)
+			}
+			move := &PGNMove{Move: m}
+			if nag, ok := suffixNAGs[suffix]; ok {
+				move.NAGs = append(move.NAGs, nag)
+			}
+			moves = append(moves, move)
+			before, position = position, position.Apply(m)
+		}
+	}
+}
+
+func joinComments(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + " " + b
+}
+
+// String is the game in PGN, its moves wrapped at 80 columns
+func (game PGN) String() string {
+	var b strings.Builder
+	for _, tag := range game.Tags {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(tag.Value)
+		fmt.Fprintf(&b, "[%s \"%s\"]\n", tag.Name, value)
+	}
+	if len(game.Tags) > 0 {
+		b.WriteByte('\n')
+	}
+	var tokens []string
+	if game.Comment != "" {
+		tokens = commentTokens(tokens, game.Comment)
+	}
+	// a game that does not start where it says cannot be written but as
+	// if it started at the starting position
+	start, err := game.Start()
+	if err != nil {
+		start = NewPosition()
+	}
+	tokens = lineTokens(tokens, start, game.Moves)
+	if game.Result == "" {
+		tokens = append(tokens, "*")
+	} else {
+		tokens = append(tokens, game.Result)
+	}
+	column := 0
+	for _, token := range tokens {
+		switch {
+		case column > 0 && column+1+len(token) > 80:
+			b.WriteByte('\n')
+			column = 0
+		case column > 0:
+			b.WriteByte(' ')
+			column++
+		}
+		b.WriteString(token)
+		column += len(token)
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// lineTokens appends the tokens of moves, played from position, to tokens
+func lineTokens(tokens []string, position Position, moves []*PGNMove) []string {
+	// black moves are numbered too at the start of a line, or after what
+	// comes between them and the white move
+	numbered := true
+	for _, m := range moves {
+		number := strconv.Itoa(position.Fullmoves())
+		switch {
+		case position.Turn() == White:
+			tokens = append(tokens, number+".")
+		case numbered:
+			tokens = append(tokens, number+"...")
+		}
+		tokens = append(tokens, position.SAN(m.Move))
+		for _, nag := range m.NAGs {
+			tokens = append(tokens, "$"+strconv.Itoa(nag))
+		}
+		numbered = false
+		if m.Comment != "" {
+			tokens = commentTokens(tokens, m.Comment)
+			numbered = true
+		}
+		for _, variation := range m.Variations {
+			if len(variation) == 0 {
+				continue
+			}
+			inner := lineTokens(nil, position, variation)
+			inner[0] = "(" + inner[0]
+			inner[len(inner)-1] += ")"
+			tokens = append(tokens, inner...)
+			numbered = true
+		}
+		position = position.Apply(m.Move)
+	}
+	return tokens
+}
+
+// commentTokens appends comment to tokens a word at a time, for long ones
+// to be wrapped too
+func commentTokens(tokens []string, comment string) []string {
+	words := strings.Fields(strings.ReplaceAll(comment, "}", ")"))
+	if len(words) == 0 {
+		return tokens
+	}
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+	return append(tokens, words...)
+}
@@ -0,0 +1,82 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePGN(t *testing.T) {
+	game, err := ParsePGN(`[Event "Casual game"]
+[White "An \"amateur\""]
+
+{A quiet start} 1. e4 e5 2. Nf3!? (2. f4 $2 {the King's Gambit} 2... exf4 (2... d5))
+2... Nc6 ; the most played
+3. Bb5 a6 4. Ba4 Nf6 5. O-O 1-0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Tag("White") != `An "amateur"` || game.Result != "1-0" || game.Comment != "A quiet start" {
+		t.Errorf("got %+v", game)
+	}
+	if len(game.Moves) != 9 {
+		t.Fatalf("got %d moves", len(game.Moves))
+	}
+	nf3 := game.Moves[2]
+	if nf3.NAGs[0] != 5 || len(nf3.Variations) != 1 {
+		t.Fatalf("got %+v", nf3)
+	}
+	gambit := nf3.Variations[0]
+	if gambit[0].Move.String() != "f2f4" || gambit[0].NAGs[0] != 2 || gambit[0].Comment != "the King's Gambit" {
+		t.Errorf("got %+v", gambit[0])
+	}
+	if len(gambit) != 2 || gambit[1].Variations[0][0].Move.String() != "d7d5" {
+		t.Errorf("got %+v", gambit)
+	}
+	if game.Moves[3].Comment != "the most played" || game.Moves[8].Move.String() != "e1g1" {
+		t.Errorf("got %+v and %+v", game.Moves[3], game.Moves[8])
+	}
+
+	for _, text := range []string{"1. e4 e4", "1. e4 (e5", "1. e4 )", "[Event", "(1. e4)", "1. e4 {no end", "1. e4 $300"} {
+		if _, err := ParsePGN(text); err == nil {
+			t.Errorf("%q parsed", text)
+		}
+	}
+}
+
+func TestPGNRoundTrip(t *testing.T) {
+	text := `[Event "Study"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 b - - 0 1"]
+
+{Black to move} 1... Kd7 2. e4 $1 {the pawn runs} (2. Kd2 Ke6 3. Ke3
+{opposition}) 2... Ke6 3. Kf2 *
+`
+	game, err := ParsePGN(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := game.String(); got != text {
+		t.Errorf("got\n%s\nwant\n%s", got, text)
+	}
+}
+
+func TestPGNWraps(t *testing.T) {
+	game := PGN{Result: "*"}
+	position := NewPosition()
+	for range 20 {
+		for _, uci := range []string{"g1f3", "g8f6", "f3g1", "f6g8"} {
+			m, _ := ParseMove(uci)
+			game.Moves = append(game.Moves, &PGNMove{Move: m})
+			position = position.Apply(m)
+		}
+	}
+	for _, line := range strings.Split(game.String(), "\n") {
+		if len(line) > 80 {
+			t.Errorf("%q is too long", line)
+		}
+	}
+	again, err := ParsePGN(game.String())
+	if err != nil || len(again.Moves) != 80 {
+		t.Errorf("got %d moves, %v", len(again.Moves), err)
+	}
+}
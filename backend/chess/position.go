@@ -0,0 +1,338 @@
+// Package chess knows the rules of chess: it tracks positions, generates
+// the legal moves and tells when a game is over. It does not depend on the
+// server and its exported API is kept stable for other Go programs to use:
+//
+//	position := chess.NewPosition()
+//	m, _ := chess.ParseMove("e2e4")
+//	position, err := position.ApplyMove(m)
+//	replies := position.LegalMoves()
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Color uint8
+
+const (
+	White Color = iota
+	Black
+)
+
+func (c Color) Other() Color {
+	return c ^ 1
+}
+
+func (c Color) String() string {
+	if c == White {
+		return "white"
+	}
+	return "black"
+}
+
+type PieceType uint8
+
+const (
+	NoPieceType PieceType = iota
+	Pawn
+	Knight
+	Bishop
+	Rook
+	Queen
+	King
+)
+
+// Piece is a piece type and its color, the zero Piece is an empty square
+type Piece uint8
+
+const NoPiece Piece = 0
+
+func NewPiece(c Color, t PieceType) Piece {
+	return Piece(uint8(c)<<3 | uint8(t))
+}
+
+func (p Piece) Type() PieceType {
+	return PieceType(p & 7)
+}
+
+func (p Piece) Color() Color {
+	return Color(p >> 3)
+}
+
+const pieceLetters = " pnbrqk"
+
+// Letter is the FEN letter of p, uppercase for white
+func (p Piece) Letter() byte {
+	letter := pieceLetters[p.Type()]
+	if p.Color() == White {
+		return letter - 'a' + 'A'
+	}
+	return letter
+}
+
+// Square is a square of the board from a1 = 0 to h8 = 63
+type Square int8
+
+const NoSquare Square = -1
+
+func NewSquare(file, rank int) Square {
+	return Square(rank*8 + file)
+}
+
+func (sq Square) File() int {
+	return int(sq) % 8
+}
+
+func (sq Square) Rank() int {
+	return int(sq) / 8
+}
+
+func (sq Square) String() string {
+	if sq == NoSquare {
+		return "-"
+	}
+	return string([]byte{byte('a' + sq.File()), byte('1' + sq.Rank())})
+}
+
+var ErrInvalidSquare = errors.New("invalid square")
+
+func ParseSquare(s string) (Square, error) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return NoSquare, fmt.Errorf("%w: %q", ErrInvalidSquare, s)
+	}
+	return NewSquare(int(s[0]-'a'), int(s[1]-'1')), nil
+}
+
+// castling rights
+const (
+	whiteKingside uint8 = 1 << iota
+	whiteQueenside
+	blackKingside
+	blackQueenside
+)
+
+// Position is the state of a game between two moves, the zero Position is not valid
+type Position struct {
+	// board has the piece on every square, byColor and byType the squares
+	// of the pieces of every color and type as bitboards
+	board    [64]Piece
+	byColor  [2]bitboard
+	byType   [King + 1]bitboard
+	turn     Color
+	castling uint8
+	// enPassant is the square a pawn skipped over in the last move
+	enPassant Square
+	halfmoves int
+	fullmoves int
+	// hash is the Zobrist hash of the position, see Hash
+	hash uint64
+
+	// drops is set in variants where captured pieces can be dropped back,
+	// pockets holds them by type and promoted has the squares of the
+	// promoted pieces, which go back to a pocket as pawns
+	drops    bool
+	pockets  [2][King]uint8
+	promoted uint64
+}
+
+const StartingFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// NewPosition is the starting position
+func NewPosition() Position {
+	position, _ := ParseFEN(StartingFEN)
+	return position
+}
+
+var ErrInvalidFEN = errors.New("invalid FEN")
+
+func ParseFEN(fen string) (Position, error) {
+	fields := strings.Fields(fen)
+	if len(fields) != 6 {
+		return Position{}, fmt.Errorf("%w: expected 6 fields", ErrInvalidFEN)
+	}
+	position := Position{enPassant: NoSquare}
+
+	placement := fields[0]
+	if i := strings.IndexByte(placement, '['); i >= 0 && strings.HasSuffix(placement, "]") {
+		if err := position.parsePocket(placement[i+1 : len(placement)-1]); err != nil {
+			return Position{}, err
+		}
+		placement = placement[:i]
+	}
+
+	ranks := strings.Split(placement, "/")
+	if len(ranks) != 8 {
+		return Position{}, fmt.Errorf("%w: expected 8 ranks", ErrInvalidFEN)
+	}
+	for rankIndex, rank := range ranks {
+		file := 0
+		// a ~ marks the piece before it as promoted
+		afterPiece := false
+		for _, c := range []byte(rank) {
+			if c >= '1' && c <= '8' {
+				file += int(c - '0')
+				afterPiece = false
+				continue
+			}
+			if c == '~' {
+				if !position.drops || !afterPiece {
+					return Position{}, fmt.Errorf("%w: bad rank %q", ErrInvalidFEN, rank)
+				}
+				position.promoted |= 1 << NewSquare(file-1, 7-rankIndex)
+				afterPiece = false
+				continue
+			}
+			i := strings.IndexByte(pieceLetters, c|0x20)
+			if i < int(Pawn) || file > 7 {
+				return Position{}, fmt.Errorf("%w: bad rank %q", ErrInvalidFEN, rank)
+			}
+			color := Black
+			if c < 'a' {
+				color = White
+			}
+			position.put(NewSquare(file, 7-rankIndex), NewPiece(color, PieceType(i)))
+			file++
+			afterPiece = true
+		}
+		if file != 8 {
+			return Position{}, fmt.Errorf("%w: bad rank %q", ErrInvalidFEN, rank)
+		}
+	}
+
+	switch fields[1] {
+	case "w":
+		position.turn = White
+	case "b":
+		position.turn = Black
+	default:
+		return Position{}, fmt.Errorf("%w: bad side to move %q", ErrInvalidFEN, fields[1])
+	}
+
+	if fields[2] != "-" {
+		for _, c := range fields[2] {
+			switch c {
+			case 'K':
+				position.castling |= whiteKingside
+			case 'Q':
+				position.castling |= whiteQueenside
+			case 'k':
+				position.castling |= blackKingside
+			case 'q':
+				position.castling |= blackQueenside
+			default:
+				return Position{}, fmt.Errorf("%w: bad castling rights %q", ErrInvalidFEN, fields[2])
+			}
+		}
+	}
+
+	if fields[3] != "-" {
+		sq, err := ParseSquare(fields[3])
+		if err != nil {
+			return Position{}, fmt.Errorf("%w: bad en passant square %q", ErrInvalidFEN, fields[3])
+		}
+		position.enPassant = sq
+	}
+	position.hash ^= position.stateKey()
+
+	var err error
+	if position.halfmoves, err = strconv.Atoi(fields[4]); err != nil || position.halfmoves < 0 {
+		return Position{}, fmt.Errorf("%w: bad halfmove clock %q", ErrInvalidFEN, fields[4])
+	}
+	if position.fullmoves, err = strconv.Atoi(fields[5]); err != nil || position.fullmoves < 1 {
+		return Position{}, fmt.Errorf("%w: bad fullmove number %q", ErrInvalidFEN, fields[5])
+	}
+	return position, nil
+}
+
+func (position Position) FEN() string {
+	var s strings.Builder
+	for rank := 7; rank >= 0; rank-- {
+		empty := 0
+		for file := 0; file < 8; file++ {
+			piece := position.board[NewSquare(file, rank)]
+			if piece == NoPiece {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				s.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			s.WriteByte(piece.Letter())
+			if position.promoted&(1<<NewSquare(file, rank)) != 0 {
+				s.WriteByte('~')
+			}
+		}
+		if empty > 0 {
+			s.WriteByte(byte('0' + empty))
+		}
+		if rank > 0 {
+			s.WriteByte('/')
+		}
+	}
+	if position.drops {
+		s.WriteString(position.pocketFEN())
+	}
+	if position.turn == White {
+		s.WriteString(" w ")
+	} else {
+		s.WriteString(" b ")
+	}
+	castling := ""
+	for i, c := range "KQkq" {
+		if position.castling&(1<<i) != 0 {
+			castling += string(c)
+		}
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	fmt.Fprintf(&s, "%s %s %d %d", castling, position.enPassant, position.halfmoves, position.fullmoves)
+	return s.String()
+}
+
+// put sets piece on sq, which has to be empty
+func (position *Position) put(sq Square, piece Piece) {
+	position.board[sq] = piece
+	position.hash ^= pieceKeys[piece][sq]
+	position.byColor[piece.Color()] |= squareBit(sq)
+	position.byType[piece.Type()] |= squareBit(sq)
+}
+
+// remove empties sq, returning the piece that was there
+func (position *Position) remove(sq Square) Piece {
+	piece := position.board[sq]
+	if piece != NoPiece {
+		position.board[sq] = NoPiece
+		position.hash ^= pieceKeys[piece][sq]
+		position.byColor[piece.Color()] &^= squareBit(sq)
+		position.byType[piece.Type()] &^= squareBit(sq)
+	}
+	return piece
+}
+
+func (position Position) occupied() bitboard {
+	return position.byColor[White] | position.byColor[Black]
+}
+
+func (position Position) Turn() Color {
+	return position.turn
+}
+
+func (position Position) PieceAt(sq Square) Piece {
+	return position.board[sq]
+}
+
+// Halfmoves is the number of moves since the last capture or pawn move
+func (position Position) Halfmoves() int {
+	return position.halfmoves
+}
+
+// Fullmoves is the number of the move being played, counted from 1 and
+// going up once black moves
+func (position Position) Fullmoves() int {
+	return position.fullmoves
+}
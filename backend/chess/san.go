@@ -0,0 +1,118 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SAN is m, which has to be legal, in standard algebraic notation like Nf3,
+// exd5, O-O, e8=Q+ or N@f3
+func (position Position) SAN(m Move) string {
+	var b strings.Builder
+	if m.Drop != NoPieceType {
+		b.WriteString(m.String())
+		return position.appendCheck(&b, m)
+	}
+	piece := position.board[m.From]
+	switch {
+	case piece.Type() == King && m.To.File()-m.From.File() == 2:
+		b.WriteString("O-O")
+	case piece.Type() == King && m.From.File()-m.To.File() == 2:
+		b.WriteString("O-O-O")
+	case piece.Type() == Pawn:
+		// a pawn moving to another file captures, en passant or not
+		if m.From.File() != m.To.File() {
+			b.WriteByte(m.From.String()[0])
+			b.WriteByte('x')
+		}
+		b.WriteString(m.To.String())
+		if m.Promotion != NoPieceType {
+			b.WriteByte('=')
+			b.WriteByte(NewPiece(White, m.Promotion).Letter())
+		}
+	default:
+		b.WriteByte(NewPiece(White, piece.Type()).Letter())
+		b.WriteString(position.disambiguation(m))
+		if position.board[m.To] != NoPiece {
+			b.WriteByte('x')
+		}
+		b.WriteString(m.To.String())
+	}
+	return position.appendCheck(&b, m)
+}
+
+// appendCheck ends the SAN of m in b with + if it gives check, # if mate
+func (position Position) appendCheck(b *strings.Builder, m Move) string {
+	next := position.Apply(m)
+	if next.InCheck() {
+		if len(next.LegalMoves()) == 0 {
+			b.WriteByte('#')
+		} else {
+			b.WriteByte('+')
+		}
+	}
+	return b.String()
+}
+
+// disambiguation is what tells m apart from the moves of the other pieces
+// of the same type that can go to the same square: the file of the piece
+// moved if that is enough, else its rank, else both
+func (position Position) disambiguation(m Move) string {
+	piece := position.board[m.From]
+	sameFile, sameRank, ambiguous := false, false, false
+	for _, other := range position.LegalMoves() {
+		if other.Drop != NoPieceType || other.To != m.To || other.From == m.From || position.board[other.From] != piece {
+			continue
+		}
+		ambiguous = true
+		sameFile = sameFile || other.From.File() == m.From.File()
+		sameRank = sameRank || other.From.Rank() == m.From.Rank()
+	}
+	from := m.From.String()
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return from[:1]
+	case !sameRank:
+		return from[1:]
+	}
+	return from
+}
+
+// ParseSAN parses a move in standard algebraic notation, the legal move of
+// position written as san. Checks, mates and annotations like ! or ?! may
+// be left out or not, castling written with zeros and promotions without =
+func (position Position) ParseSAN(san string) (Move, error) {
+	want := normalizeSAN(san)
+	for _, m := range position.LegalMoves() {
+		if normalizeSAN(position.SAN(m)) == want {
+			return m, nil
+		}
+	}
+	// a piece that needs no disambiguation may still be given one
+	for _, m := range position.LegalMoves() {
+		if fullSAN(position, m) == want {
+			return m, nil
+		}
+	}
+	return Move{}, fmt.Errorf("%w: %q is not a legal move in %s", ErrInvalidMove, san, position.FEN())
+}
+
+func normalizeSAN(san string) string {
+	san = strings.TrimRight(san, "+#!?")
+	return strings.NewReplacer("0", "O", "=", "").Replace(san)
+}
+
+// fullSAN is the SAN of m with both the file and the rank of the piece moved
+func fullSAN(position Position, m Move) string {
+	piece := position.board[m.From]
+	if m.Drop != NoPieceType || piece.Type() == Pawn || piece.Type() == King {
+		return ""
+	}
+	capture := ""
+	if position.board[m.To] != NoPiece {
+		capture = "x"
+	}
+	return string(NewPiece(White, piece.Type()).Letter()) + m.From.String() + capture + m.To.String()
+}
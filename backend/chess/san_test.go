@@ -0,0 +1,58 @@
+package chess
+
+import "testing"
+
+func TestSAN(t *testing.T) {
+	for _, test := range []struct{ fen, move, want string }{
+		{StartingFEN, "g1f3", "Nf3"},
+		{StartingFEN, "e2e4", "e4"},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", "e4d5", "exd5"},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5f6", "exf6"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1c1", "O-O-O"},
+		{"7k/4P3/8/8/8/8/8/K7 w - - 0 1", "e7e8q", "e8=Q+"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra8#"},
+		// two knights reach d2, from different files
+		{"4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1", "b1d2", "Nbd2"},
+		// two rooks on the same file
+		{"4k3/R7/8/8/8/8/8/R3K3 w - - 0 1", "a1a4", "R1a4"},
+		// queens on the same file and on the same rank
+		{"4k3/8/8/7K/8/Q7/8/Q1Q5 w - - 0 1", "a1b2", "Qa1b2"},
+		{"4k3/8/8/8/8/8/8/4K3[N] w - - 0 1", "N@f6", "N@f6+"},
+	} {
+		position, err := ParseFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := ParseMove(test.move)
+		if err != nil || !position.IsLegal(m) {
+			t.Fatalf("%s is not legal in %s", test.move, test.fen)
+		}
+		if got := position.SAN(m); got != test.want {
+			t.Errorf("%s in %s: got %s, want %s", test.move, test.fen, got, test.want)
+		}
+	}
+}
+
+func TestParseSAN(t *testing.T) {
+	for _, test := range []struct{ fen, san, want string }{
+		{StartingFEN, "Nf3", "g1f3"},
+		{StartingFEN, "e4!?", "e2e4"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "0-0-0", "e1c1"},
+		{"7k/4P3/8/8/8/8/8/K7 w - - 0 1", "e8Q", "e7e8q"},
+		{"4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1", "Nbd2", "b1d2"},
+		{StartingFEN, "Ng1f3", "g1f3"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "Ra8+", "a1a8"},
+	} {
+		position, _ := ParseFEN(test.fen)
+		m, err := position.ParseSAN(test.san)
+		if err != nil || m.String() != test.want {
+			t.Errorf("%s in %s: got %s, %v, want %s", test.san, test.fen, m, err, test.want)
+		}
+	}
+	for _, san := range []string{"Nd2", "e5", "Ke2", "O-O"} {
+		if m, err := NewPosition().ParseSAN(san); err == nil {
+			t.Errorf("%s parsed as %s", san, m)
+		}
+	}
+}
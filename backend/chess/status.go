@@ -0,0 +1,79 @@
+package chess
+
+type Status uint8
+
+const (
+	Ongoing Status = iota
+	Checkmate
+	Stalemate
+	// FiftyMoves can be claimed as a draw, it does not end the game by itself
+	FiftyMoves
+	InsufficientMaterial
+)
+
+// Status tells whether the game is over in position, and how
+func (position Position) Status() Status {
+	if len(position.LegalMoves()) == 0 {
+		if position.InCheck() {
+			return Checkmate
+		}
+		return Stalemate
+	}
+	if position.InsufficientMaterial() {
+		return InsufficientMaterial
+	}
+	if position.halfmoves >= 100 {
+		return FiftyMoves
+	}
+	return Ongoing
+}
+
+// InsufficientMaterial reports whether neither side can mate: only kings
+// are left, with at most one knight or bishops on a single square color
+func (position Position) InsufficientMaterial() bool {
+	if position.pocketed(White) || position.pocketed(Black) {
+		return false
+	}
+	minors := 0
+	knights := 0
+	bishopColors := [2]bool{}
+	for sq, piece := range position.board {
+		switch piece.Type() {
+		case Pawn, Rook, Queen:
+			return false
+		case Knight:
+			knights++
+			minors++
+		case Bishop:
+			bishopColors[(Square(sq).File()+Square(sq).Rank())%2] = true
+			minors++
+		}
+	}
+	switch {
+	case minors <= 1:
+		return true
+	case knights == 0:
+		return !(bishopColors[0] && bishopColors[1])
+	}
+	return false
+}
+
+// CanMate reports whether c has the material to checkmate at all, which
+// decides games lost on time: a lone king cannot, nor can what would be
+// insufficient material against a lone king. Pieces in a pocket count
+// as much as those on the board
+func (position Position) CanMate(c Color) bool {
+	alone := [2]bool{!position.pocketed(White), !position.pocketed(Black)}
+	for _, piece := range position.board {
+		if piece != NoPiece && piece.Type() != King {
+			alone[piece.Color()] = false
+		}
+	}
+	switch {
+	case alone[c]:
+		return false
+	case alone[c.Other()]:
+		return !position.InsufficientMaterial()
+	}
+	return true
+}
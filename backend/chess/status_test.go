@@ -0,0 +1,29 @@
+package chess
+
+import "testing"
+
+func TestCanMate(t *testing.T) {
+	for _, test := range []struct {
+		fen  string
+		c    Color
+		want bool
+	}{
+		{StartingFEN, White, true},
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", White, false},
+		{"4k3/8/8/8/8/8/8/2N1K3 w - - 0 1", White, false},
+		// a knight can mate a king hemmed in by its own pawn
+		{"4k3/4p3/8/8/8/8/8/2N1K3 w - - 0 1", White, true},
+		{"4k3/4p3/8/8/8/8/8/2N1K3 w - - 0 1", Black, true},
+		{"4kq2/8/8/8/8/8/8/4K3 w - - 0 1", White, false},
+		// a pawn in the pocket is as good as one on the board
+		{"4k3/8/8/8/8/8/8/2N1K3[Q] w - - 0 1", White, true},
+	} {
+		position, err := ParseFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := position.CanMate(test.c); got != test.want {
+			t.Errorf("%s: %s can mate is %v", test.fen, test.c, got)
+		}
+	}
+}
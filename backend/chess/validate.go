@@ -0,0 +1,83 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrIllegalPosition is what the errors of Validate wrap, a position that
+// parses but cannot come up in a game
+var ErrIllegalPosition = errors.New("illegal position")
+
+var (
+	ErrKings         = fmt.Errorf("%w: each side must have a single king", ErrIllegalPosition)
+	ErrOppositeCheck = fmt.Errorf("%w: the side not to move is in check", ErrIllegalPosition)
+	ErrPawnRank      = fmt.Errorf("%w: pawns on the first or last rank", ErrIllegalPosition)
+	ErrCastling      = fmt.Errorf("%w: castling rights without the king and rook on their squares", ErrIllegalPosition)
+	ErrEnPassant     = fmt.Errorf("%w: en passant square without a pawn that just moved two squares", ErrIllegalPosition)
+	ErrMaterial      = fmt.Errorf("%w: more pieces than promotions could make", ErrIllegalPosition)
+)
+
+// Validate reports why position cannot come up in a game, nil if it can: it
+// checks what a board set up by hand gets wrong, not that the position can
+// be reached from the starting one. The material is not checked in variants
+// with drops, where captured pieces change sides
+func (position Position) Validate() error {
+	for _, c := range []Color{White, Black} {
+		if (position.byType[King] & position.byColor[c]).count() != 1 {
+			return ErrKings
+		}
+	}
+	them := position.turn.Other()
+	if position.Attacked(position.king(them), position.turn) {
+		return ErrOppositeCheck
+	}
+	const backRanks bitboard = 0xff000000000000ff
+	if position.byType[Pawn]&backRanks != 0 {
+		return ErrPawnRank
+	}
+	for _, castling := range []struct {
+		right      uint8
+		king, rook Piece
+		from, to   Square
+	}{
+		{whiteKingside, NewPiece(White, King), NewPiece(White, Rook), NewSquare(4, 0), NewSquare(7, 0)},
+		{whiteQueenside, NewPiece(White, King), NewPiece(White, Rook), NewSquare(4, 0), NewSquare(0, 0)},
+		{blackKingside, NewPiece(Black, King), NewPiece(Black, Rook), NewSquare(4, 7), NewSquare(7, 7)},
+		{blackQueenside, NewPiece(Black, King), NewPiece(Black, Rook), NewSquare(4, 7), NewSquare(0, 7)},
+	} {
+		if position.castling&castling.right != 0 &&
+			(position.board[castling.from] != castling.king || position.board[castling.to] != castling.rook) {
+			return ErrCastling
+		}
+	}
+	if ep := position.enPassant; ep != NoSquare {
+		// the pawn of them skipped over ep, from the square behind it
+		rank, forward := 5, 8
+		if position.turn == Black {
+			rank, forward = 2, -8
+		}
+		if ep.Rank() != rank || position.board[ep-Square(forward)] != NewPiece(them, Pawn) ||
+			position.board[ep] != NoPiece || position.board[ep+Square(forward)] != NoPiece {
+			return ErrEnPassant
+		}
+	}
+	if !position.drops {
+		for _, c := range []Color{White, Black} {
+			if !position.reachableMaterial(c) {
+				return ErrMaterial
+			}
+		}
+	}
+	return nil
+}
+
+// reachableMaterial reports whether the pieces of c on the board are as
+// many as the pieces it starts with, and the pawns it lacks promoted to,
+// could be
+func (position Position) reachableMaterial(c Color) bool {
+	count := func(t PieceType) int { return (position.byType[t] & position.byColor[c]).count() }
+	pawns := count(Pawn)
+	promoted := max(count(Queen)-1, 0) + max(count(Rook)-2, 0) + max(count(Bishop)-2, 0) + max(count(Knight)-2, 0)
+	return pawns <= 8 && pawns+promoted <= 8
+}
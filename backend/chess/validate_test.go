@@ -0,0 +1,41 @@
+package chess
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for fen, want := range map[string]error{
+		StartingFEN: nil,
+		"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2": nil,
+		"4k3/8/8/8/8/8/8/8 w - - 0 1":                                   ErrKings,
+		"4k3/8/8/8/8/8/8/3KK3 w - - 0 1":                                ErrKings,
+		// black to move cannot be checking white
+		"4k3/8/8/8/8/8/8/4K2r b - - 0 1":          ErrOppositeCheck,
+		"4k3/8/8/8/8/8/8/4K2r w - - 0 1":          nil,
+		"P3k3/8/8/8/8/8/8/4K3 w - - 0 1":          ErrPawnRank,
+		"4k3/8/8/8/8/8/8/p3K3 w - - 0 1":          ErrPawnRank,
+		"4k3/8/8/8/8/8/8/4K3 w K - 0 1":           ErrCastling,
+		"r3k3/8/8/8/8/8/8/4K2R w Kq - 0 1":        nil,
+		"4k3/8/8/8/8/8/8/R4K1R w Q - 0 1":         ErrCastling,
+		"4k3/8/8/8/8/8/8/4K3 w - e6 0 1":          ErrEnPassant,
+		"4k3/8/8/4p3/8/8/8/4K3 w - e3 0 1":        ErrEnPassant,
+		"4k3/4p3/8/4p3/8/8/8/4K3 w - e6 0 1":      ErrEnPassant,
+		"4k3/8/8/8/8/8/PPPPPPPP/QQQQK3 w - - 0 1": ErrMaterial,
+		"4k3/8/8/8/8/8/8/QQQQKQQQ w - - 0 1":      nil,
+		// captured pieces change sides where they are dropped
+		"4k3/8/8/8/8/8/PPPPPPPP/QQQQK3[q] w - - 0 1": nil,
+	} {
+		position, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := position.Validate(); !errors.Is(got, want) || (got == nil) != (want == nil) {
+			t.Errorf("%s: got %v, want %v", fen, got, want)
+		}
+	}
+	if !errors.Is(ErrKings, ErrIllegalPosition) {
+		t.Error("the errors of Validate do not wrap ErrIllegalPosition")
+	}
+}
@@ -0,0 +1,72 @@
+package chess
+
+// the keys the Zobrist hash of a position is made of, XORing together
+// those of every piece on its square, of how many pieces of every type are
+// in the pockets, of the castling rights, of the en passant file and of
+// black to move. They are drawn from a fixed seed for hashes to be the same
+// from one run to the next and kept
+var (
+	pieceKeys     [16][64]uint64
+	pocketKeys    [2][King][64]uint64
+	castlingKeys  [16]uint64
+	enPassantKeys [8]uint64
+	blackKey      uint64
+)
+
+func init() {
+	// splitmix64
+	seed := uint64(0x5eed)
+	random := func() uint64 {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		return z ^ z>>31
+	}
+	for piece := range pieceKeys {
+		for sq := range pieceKeys[piece] {
+			pieceKeys[piece][sq] = random()
+		}
+	}
+	for c := range pocketKeys {
+		for t := range pocketKeys[c] {
+			// an empty pocket changes nothing
+			for n := 1; n < len(pocketKeys[c][t]); n++ {
+				pocketKeys[c][t][n] = random()
+			}
+		}
+	}
+	for rights := range castlingKeys {
+		castlingKeys[rights] = random()
+	}
+	for file := range enPassantKeys {
+		enPassantKeys[file] = random()
+	}
+	blackKey = random()
+}
+
+// Hash is the Zobrist hash of position. Positions that repeat by the rules,
+// with the same pieces, side to move, castling rights and en passant square,
+// hash the same whatever their move counters; it is kept up to date as
+// moves are applied rather than worked out when asked for
+func (position Position) Hash() uint64 {
+	return position.hash
+}
+
+// stateKey is the part of the hash of position for everything but the pieces
+func (position Position) stateKey() uint64 {
+	key := castlingKeys[position.castling]
+	if position.enPassant != NoSquare {
+		key ^= enPassantKeys[position.enPassant.File()]
+	}
+	if position.turn == Black {
+		key ^= blackKey
+	}
+	return key
+}
+
+// setPocket makes n the count of pieces of type t in the pocket of c
+func (position *Position) setPocket(c Color, t PieceType, n uint8) {
+	position.hash ^= pocketKeys[c][t][position.pockets[c][t]%64] ^ pocketKeys[c][t][n%64]
+	position.pockets[c][t] = n
+}
@@ -0,0 +1,61 @@
+package chess
+
+import "testing"
+
+// checkHashes walks the moves depth deep from position, failing if the
+// hash kept as they are applied differs from the one of the parsed FEN
+func checkHashes(t *testing.T, position Position, depth int) {
+	t.Helper()
+	parsed, _ := ParseFEN(position.FEN())
+	if position.Hash() != parsed.Hash() {
+		t.Fatalf("%s: hash %x, parsed %x", position.FEN(), position.Hash(), parsed.Hash())
+	}
+	if depth == 0 {
+		return
+	}
+	for _, m := range position.LegalMoves() {
+		checkHashes(t, position.Apply(m), depth-1)
+	}
+}
+
+func TestHashIsKeptAsMovesAreApplied(t *testing.T) {
+	for _, fen := range []string{
+		StartingFEN,
+		kiwipete,
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R[QPnp] w KQkq - 2 3",
+	} {
+		position, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkHashes(t, position, 3)
+	}
+}
+
+func TestHash(t *testing.T) {
+	play := func(moves ...string) Position {
+		position := NewPosition()
+		for _, s := range moves {
+			m, _ := ParseMove(s)
+			position = position.Apply(m)
+		}
+		return position
+	}
+	start := NewPosition().Hash()
+	if got := play("g1f3", "g8f6", "f3g1", "f6g8").Hash(); got != start {
+		t.Errorf("knights back home hash %x, want %x", got, start)
+	}
+	if play("e2e4").Hash() == play("e2e3", "a7a6", "e3e4", "a6a5").Hash() {
+		t.Error("no en passant square and a set one hash the same")
+	}
+	if play("g1f3", "g8f6", "h1g1", "f6g8", "g1h1", "g8f6", "f3g1", "f6g8").Hash() == start {
+		t.Error("lost castling rights hash as kept ones")
+	}
+	if got := play("e2e4", "e7e5", "g1f3", "b8c6").Hash(); got != play("g1f3", "e7e5", "e2e4", "b8c6").Hash() {
+		t.Error("transposed moves hash differently")
+	}
+	if NewPosition().AddToPocket(White, Knight).Hash() == start {
+		t.Error("a pocketed piece does not change the hash")
+	}
+}
@@ -0,0 +1,446 @@
+// Package client speaks the simple-chess game protocol over WebSocket,
+// so Go programs and bots can play without handling the messages themselves.
+//
+//	c, err := client.Connect(ctx, "ws://localhost:5555/ws")
+//	for event := range c.Events() {
+//		switch event := event.(type) {
+//		case client.Started:
+//			...
+//		case client.Moved:
+//			c.SubmitMove("e7", "e5", "")
+//		}
+//	}
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ProtocolVersion is the version of the protocol the client speaks
+const ProtocolVersion = 1
+
+// Move is a move in coordinate notation, Promotion is one of q, r, b and n.
+// In bughouse Drop is the piece put on To, From is then empty
+type Move struct {
+	ID        string `json:"id,omitempty"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Promotion string `json:"promotion,omitempty"`
+	Drop      string `json:"drop,omitempty"`
+}
+
+// message mirrors the messages of the server
+type message struct {
+	Type       string      `json:"type"`
+	Seq        int         `json:"seq,omitempty"`
+	Version    int         `json:"version,omitempty"`
+	Code       string      `json:"code,omitempty"`
+	Text       string      `json:"text,omitempty"`
+	Field      string      `json:"field,omitempty"`
+	GameID     string      `json:"gameId,omitempty"`
+	Slug       string      `json:"slug,omitempty"`
+	Board      int         `json:"board,omitempty"`
+	Variant    string      `json:"variant,omitempty"`
+	Role       string      `json:"role,omitempty"`
+	Piece      string      `json:"piece,omitempty"`
+	Token      string      `json:"token,omitempty"`
+	Color      string      `json:"color,omitempty"`
+	From       string      `json:"from,omitempty"`
+	To         string      `json:"to,omitempty"`
+	Promotion  string      `json:"promotion,omitempty"`
+	Drop       string      `json:"drop,omitempty"`
+	Moves      []Move      `json:"moves,omitempty"`
+	Key        string      `json:"key,omitempty"`
+	Args       []string    `json:"args,omitempty"`
+	MoveID     string      `json:"moveId,omitempty"`
+	ServerTime int64       `json:"serverTime,omitempty"`
+	ClientTime int64       `json:"clientTime,omitempty"`
+	Result     string      `json:"result,omitempty"`
+	Reason     string      `json:"reason,omitempty"`
+	WhiteTime  int64       `json:"whiteTime,omitempty"`
+	BlackTime  int64       `json:"blackTime,omitempty"`
+	Votes      []VoteTally `json:"votes,omitempty"`
+	Deadline   int64       `json:"deadline,omitempty"`
+	Blindfold  bool        `json:"blindfold,omitempty"`
+	Rated      bool        `json:"rated,omitempty"`
+	Ply        int         `json:"ply,omitempty"`
+	URL        string      `json:"url,omitempty"`
+}
+
+// Event is something that happened in the game, one of Started, Resumed,
+// Moved, Pocketed, PieceNamed, Votes, DrawOffered, PauseOffered, Paused,
+// Unpaused, SpectatorToken, Redirected, GameOver and Error
+type Event interface {
+	event()
+}
+
+// Started is sent once both players are in the game
+type Started struct {
+	GameID string
+	// Slug makes the short link others can watch the game at, /g/{slug}
+	Slug  string
+	Color string
+	// Board is the number of the board in a simul or bughouse match,
+	// 0 for any other game
+	Board int
+	// Variant is bughouse, hand_and_brain, voting or empty for standard chess
+	Variant string
+	// Role is brain for the brains of hand and brain games, who name the
+	// pieces their hands, the other players of their color, have to move
+	Role string
+	// Blindfold is set for players connected with ?blindfold=true, who
+	// are never sent the moves played so far again
+	Blindfold bool
+	// Rated games change the ratings of their players
+	Rated bool
+}
+
+// Resumed is sent after reconnecting with the moves played so far,
+// unless only the messages missed were sent again, and to the voters of
+// a voting game once they join, whichever the moves played
+type Resumed struct {
+	GameID string
+	Color  string
+	Moves  []Move
+	// Ply is how many moves were played in blindfold games, where Moves
+	// only has the last one
+	Ply int
+}
+
+// Moved is a move of the opponent, with the time left on the clocks
+// of timed games
+type Moved struct {
+	Move      Move
+	WhiteTime time.Duration
+	BlackTime time.Duration
+}
+
+// Pocketed is a piece handed to the player of Color in bughouse, taken by
+// their partner on the other board, Piece is one of p, n, b, r and q
+type Pocketed struct {
+	Color string
+	Piece string
+}
+
+// PieceNamed is the piece type the brain named for the hand of Color to
+// move in hand and brain, Piece is one of p, n, b, r, q and k
+type PieceNamed struct {
+	Color string
+	Piece string
+}
+
+// Votes are the moves the crowd of a voting game voted for so far, the
+// one with the most votes is played at Deadline
+type Votes struct {
+	Votes    []VoteTally
+	Deadline time.Time
+}
+
+// VoteTally is how many voters voted for Move, in coordinate notation like e7e5
+type VoteTally struct {
+	Move  string `json:"move"`
+	Count int    `json:"count"`
+}
+
+// DrawOffered means the opponent offers a draw, OfferDraw accepts it
+type DrawOffered struct{}
+
+// PauseOffered means the opponent offers to pause the game, OfferPause accepts it
+type PauseOffered struct{}
+
+// Paused means both players agreed to pause the game, the server hangs up
+// and the game goes on once both reconnect
+type Paused struct{}
+
+// Unpaused means both players are back in a paused game, with the time
+// left on the clocks of timed games
+type Unpaused struct {
+	WhiteTime time.Duration
+	BlackTime time.Duration
+}
+
+// SpectatorToken lets whoever has it watch the game, even if private
+type SpectatorToken struct {
+	Token string
+}
+
+// Redirected means the game is played on another server now, at URL:
+// the connection is closed, Reconnect goes on with the game there
+type Redirected struct {
+	URL string
+}
+
+// GameOver is the last event of a game, Result is 1-0, 0-1 or 1/2-1/2
+type GameOver struct {
+	Result string
+	Reason string
+}
+
+// Error is a message the server refused or could not process
+type Error struct {
+	Code  string
+	Text  string
+	Field string
+}
+
+func (Started) event()        {}
+func (Resumed) event()        {}
+func (Moved) event()          {}
+func (Pocketed) event()       {}
+func (PieceNamed) event()     {}
+func (Votes) event()          {}
+func (DrawOffered) event()    {}
+func (PauseOffered) event()   {}
+func (Paused) event()         {}
+func (Unpaused) event()       {}
+func (SpectatorToken) event() {}
+func (Redirected) event()     {}
+func (GameOver) event()       {}
+func (Error) event()          {}
+
+func (err Error) Error() string {
+	return err.Code + ": " + err.Text
+}
+
+// Client is a player connected to a game
+type Client struct {
+	url    string
+	ws     *websocket.Conn
+	events chan Event
+	// writeMu serializes writes, acks are sent by the reader
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	gameID  string
+	token   string
+	color   string
+	lastSeq int
+	// takeover has the server hand over the seat of a connection it may
+	// not know dropped yet
+	takeover bool
+	err      error
+}
+
+// Connect joins the game waiting for an opponent at url,
+// or creates one if there is none
+func Connect(ctx context.Context, url string) (*Client, error) {
+	return dial(ctx, &Client{url: url, lastSeq: -1})
+}
+
+// Resume connects again to a game with the token that was given when it started
+func Resume(ctx context.Context, url, gameID, token string) (*Client, error) {
+	return dial(ctx, &Client{url: url, gameID: gameID, token: token, lastSeq: -1})
+}
+
+// Reconnect returns a new client for the same game, it is sent the messages
+// c missed. It takes over from c at once, as after a change of network.
+// Events of c should be drained before reconnecting.
+func (c *Client) Reconnect(ctx context.Context) (*Client, error) {
+	c.mu.Lock()
+	next := &Client{url: c.url, gameID: c.gameID, token: c.token, color: c.color, lastSeq: c.lastSeq, takeover: true}
+	c.mu.Unlock()
+	c.Close()
+	return dial(ctx, next)
+}
+
+func dial(ctx context.Context, c *Client) (*Client, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("v", strconv.Itoa(ProtocolVersion))
+	if c.gameID != "" {
+		query.Set("game", c.gameID)
+		query.Set("token", c.token)
+		query.Set("seq", strconv.Itoa(c.lastSeq))
+		if c.takeover {
+			query.Set("takeover", "true")
+		}
+	}
+	u.RawQuery = query.Encode()
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.ws = ws
+	c.events = make(chan Event, 16)
+	go c.read()
+	return c, nil
+}
+
+// Events delivers the events of the game, it is closed with the connection
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Err is the error that closed the connection, if any
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// GameID is the game the client plays, known once it has started
+func (c *Client) GameID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gameID
+}
+
+// Token lets Resume reconnect to the game
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// Color is white or black, known once the game has started
+func (c *Client) Color() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.color
+}
+
+// SubmitMove plays a move, promotion is empty unless a pawn promotes
+func (c *Client) SubmitMove(from, to, promotion string) error {
+	return c.write(message{Type: "move", From: from, To: to, Promotion: promotion, MoveID: newMoveID()})
+}
+
+// SubmitDrop puts a piece from the pocket on to, in bughouse
+func (c *Client) SubmitDrop(piece, to string) error {
+	return c.write(message{Type: "drop", Drop: piece, To: to, MoveID: newMoveID()})
+}
+
+// NamePiece names the type of piece the hand has to move, for brains
+func (c *Client) NamePiece(piece string) error {
+	return c.write(message{Type: "name_piece", Piece: piece})
+}
+
+// Vote votes for the next move of the crowd, for voters of a voting game
+// connected with ?crowd={game id}; a second vote replaces the first
+func (c *Client) Vote(from, to, promotion string) error {
+	return c.write(message{Type: "vote", From: from, To: to, Promotion: promotion})
+}
+
+// OfferDraw offers the opponent a draw, or accepts the opponent's offer
+func (c *Client) OfferDraw() error {
+	return c.write(message{Type: "draw_offer"})
+}
+
+// RequestSpectatorToken asks for a token letting someone else watch
+// a private game, the server answers with a SpectatorToken
+func (c *Client) RequestSpectatorToken() error {
+	return c.write(message{Type: "spectator_token"})
+}
+
+// OfferPause offers the opponent to pause the game, or accepts the opponent's
+// offer; a paused game goes on once both players reconnect with Reconnect
+func (c *Client) OfferPause() error {
+	return c.write(message{Type: "pause_offer"})
+}
+
+// ClaimDraw claims a draw by threefold_repetition or fifty_moves, either
+// if reason is empty; the server answers an invalid claim with an Error
+func (c *Client) ClaimDraw(reason string) error {
+	return c.write(message{Type: "claim_draw", Reason: reason})
+}
+
+// Resign loses the game
+func (c *Client) Resign() error {
+	return c.write(message{Type: "resign"})
+}
+
+func (c *Client) Close() error {
+	return c.ws.Close()
+}
+
+func (c *Client) write(m message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteJSON(m)
+}
+
+func (c *Client) read() {
+	defer close(c.events)
+	for {
+		m := message{}
+		if err := c.ws.ReadJSON(&m); err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			return
+		}
+		if m.Seq > 0 {
+			c.mu.Lock()
+			c.lastSeq = m.Seq
+			c.mu.Unlock()
+			c.write(message{Type: "ack", Seq: m.Seq})
+		}
+		if event := c.handle(m); event != nil {
+			c.events <- event
+		}
+	}
+}
+
+// handle turns m into an event, nil if the application need not know about it
+func (c *Client) handle(m message) Event {
+	switch m.Type {
+	case "start":
+		c.mu.Lock()
+		c.gameID, c.token, c.color = m.GameID, m.Token, m.Color
+		c.mu.Unlock()
+		return Started{GameID: m.GameID, Slug: m.Slug, Color: m.Color, Board: m.Board, Variant: m.Variant, Role: m.Role, Blindfold: m.Blindfold, Rated: m.Rated}
+	case "resume", "crowd":
+		return Resumed{GameID: m.GameID, Color: m.Color, Moves: m.Moves, Ply: m.Ply}
+	case "move", "drop":
+		return Moved{
+			Move:      Move{ID: m.MoveID, From: m.From, To: m.To, Promotion: m.Promotion, Drop: m.Drop},
+			WhiteTime: time.Duration(m.WhiteTime) * time.Millisecond,
+			BlackTime: time.Duration(m.BlackTime) * time.Millisecond,
+		}
+	case "pocket":
+		return Pocketed{Color: m.Color, Piece: m.Drop}
+	case "name_piece":
+		return PieceNamed{Color: m.Color, Piece: m.Piece}
+	case "votes":
+		return Votes{Votes: m.Votes, Deadline: time.UnixMilli(m.Deadline)}
+	case "draw_offer":
+		return DrawOffered{}
+	case "pause_offer":
+		return PauseOffered{}
+	case "paused":
+		return Paused{}
+	case "unpaused":
+		return Unpaused{
+			WhiteTime: time.Duration(m.WhiteTime) * time.Millisecond,
+			BlackTime: time.Duration(m.BlackTime) * time.Millisecond,
+		}
+	case "spectator_token":
+		return SpectatorToken{Token: m.Token}
+	case "redirect":
+		c.mu.Lock()
+		c.url = m.URL
+		c.mu.Unlock()
+		return Redirected{URL: m.URL}
+	case "game_over":
+		return GameOver{Result: m.Result, Reason: m.Reason}
+	case "error":
+		return Error{Code: m.Code, Text: m.Text, Field: m.Field}
+	}
+	return nil
+}
+
+func newMoveID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
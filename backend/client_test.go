@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/client"
+)
+
+// nextEvent waits for the next event of c
+func nextEvent(t *testing.T, c *client.Client) client.Event {
+	t.Helper()
+	select {
+	case event, ok := <-c.Events():
+		if !ok {
+			t.Fatalf("connection closed: %v", c.Err())
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return nil
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(newPublicMux())
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	ctx := context.Background()
+
+	first, err := client.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := client.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	var white, black *client.Client
+	for _, c := range []*client.Client{first, second} {
+		started, ok := nextEvent(t, c).(client.Started)
+		if !ok || started.GameID == "" || started.GameID != c.GameID() || c.Token() == "" {
+			t.Fatalf("got %+v", started)
+		}
+		if started.Color == "white" {
+			white = c
+		} else {
+			black = c
+		}
+	}
+	if white == nil || black == nil {
+		t.Fatal("not paired as white and black")
+	}
+	game, ok := games.Find(white.GameID())
+	if !ok || black.GameID() != game.id {
+		t.Fatal("not paired in one game")
+	}
+
+	if err := white.SubmitMove("e2", "e4", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := nextEvent(t, black).(client.Moved); !ok || got.Move.From != "e2" || got.Move.To != "e4" {
+		t.Fatalf("got %+v", got)
+	}
+	if err := black.OfferDraw(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nextEvent(t, white).(client.DrawOffered); !ok {
+		t.Fatal("draw not offered")
+	}
+
+	// taking over after a change of network, black is only sent the
+	// messages it missed
+	black, err = black.Reconnect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer black.Close()
+	if err := black.SubmitMove("e7", "e5", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := nextEvent(t, white).(client.Moved); !ok || got.Move.From != "e7" {
+		t.Fatalf("got %+v", got)
+	}
+	if err := white.SubmitMove("g1", "f3", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := nextEvent(t, black).(client.Moved); !ok || got.Move.From != "g1" {
+		t.Fatalf("got %+v", got)
+	}
+
+	// every message black was sent is acknowledged by the time it goes,
+	// the loop is idle once it has noticed
+	black.Close()
+	waitFor(t, func() bool {
+		game.mu.Lock()
+		defer game.mu.Unlock()
+		return !game.connected["black"]
+	})
+	if n := len(game.black.unacked); n != 0 {
+		t.Errorf("%d messages not acknowledged", n)
+	}
+
+	black, err = client.Resume(ctx, url, game.id, black.Token())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer black.Close()
+	if got, ok := nextEvent(t, black).(client.Resumed); !ok || got.Color != "black" || len(got.Moves) != 3 {
+		t.Fatalf("got %+v", got)
+	}
+	if err := white.Resign(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*client.Client{white, black} {
+		if got, ok := nextEvent(t, c).(client.GameOver); !ok || got.Result != "0-1" || got.Reason != "resignation" {
+			t.Fatalf("got %+v", got)
+		}
+	}
+	<-game.done
+}
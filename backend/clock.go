@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeControl is how long each player has for the whole game, in
+// milliseconds, and how much is added to their clock after every move
+type TimeControl struct {
+	InitialMs   int64 `json:"initialMs"`
+	IncrementMs int64 `json:"incrementMs,omitempty"`
+}
+
+// timeControl is that of the games created, nil for untimed games
+var timeControl *TimeControl
+
+// maxLagCompensation is the most of the time a turn spent on the network
+// that is given back to the player, none if 0
+var maxLagCompensation = 300 * time.Millisecond
+
+// lag is how long a turn of the player of conn spends on the network, the
+// move of the opponent on its way to them and theirs on its way back: the
+// round trip of its last ping if its transport tells, at most
+// maxLagCompensation
+func (conn *connection) lag() time.Duration {
+	p, ok := conn.transport.(ponger)
+	if !ok {
+		return 0
+	}
+	return min(p.RTT(), maxLagCompensation)
+}
+
+// parseTimeControl parses the initial time and increment as in 5m+3s, the
+// increment can be left out, or the name of one of the timeControlPresets;
+// an empty value is no time control
+func parseTimeControl(value string) (*TimeControl, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if tc, ok := presetTimeControl(value); ok {
+		return tc, nil
+	}
+	initial, increment, _ := strings.Cut(value, "+")
+	tc := &TimeControl{}
+	d, err := time.ParseDuration(initial)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid initial time %q", initial)
+	}
+	tc.InitialMs = d.Milliseconds()
+	if increment != "" {
+		d, err := time.ParseDuration(increment)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid increment %q", increment)
+		}
+		tc.IncrementMs = d.Milliseconds()
+	}
+	return tc, nil
+}
+
+// Clocks are the milliseconds white and black have left at now: what was
+// left as of TurnStarted, less the time the player to move is taking
+// unless the game is paused
+func (state *GameState) Clocks(now time.Time) (white, black int64) {
+	if state.TimeControl == nil {
+		return 0, 0
+	}
+	white, black = state.WhiteTime, state.BlackTime
+	if state.Started && !state.Finished && !state.Paused {
+		thinking := now.Sub(state.TurnStarted).Milliseconds()
+		if state.Turn() == "white" {
+			white -= thinking
+		} else {
+			black -= thinking
+		}
+	}
+	return max(white, 0), max(black, 0)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseTimeControl(t *testing.T) {
+	for value, want := range map[string]*TimeControl{
+		"":      nil,
+		"5m":    {InitialMs: 300000},
+		"3m+2s": {InitialMs: 180000, IncrementMs: 2000},
+	} {
+		got, err := parseTimeControl(value)
+		if err != nil || (got == nil) != (want == nil) || (got != nil && *got != *want) {
+			t.Errorf("%q: got %+v, %v", value, got, err)
+		}
+	}
+	for _, value := range []string{"5", "0s", "5m+x", "5m+-1s"} {
+		if _, err := parseTimeControl(value); err == nil {
+			t.Errorf("%q parsed", value)
+		}
+	}
+}
+
+func TestMovesCarryTheClocks(t *testing.T) {
+	timeControl = &TimeControl{InitialMs: 60000, IncrementMs: 2000}
+	defer func() { timeControl = nil }()
+	_, white, black := startTestGame(t)
+
+	// what the client claims is ignored
+	white.send(Message{Type: "move", MoveID: "1", From: "e2", To: "e4", WhiteTime: 1, BlackTime: 1})
+	got := black.expect("move")
+	if got.WhiteTime > 62000 || got.WhiteTime < 61000 || got.BlackTime != 60000 {
+		t.Errorf("got clocks %d and %d", got.WhiteTime, got.BlackTime)
+	}
+}
+
+func TestServerFlagsTheClock(t *testing.T) {
+	timeControl = &TimeControl{InitialMs: 50}
+	defer func() { timeControl = nil }()
+	game, white, black := startTestGame(t)
+
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("game_over"); got.Result != "0-1" || got.Reason != "timeout" {
+			t.Errorf("got %+v", got)
+		}
+	}
+	if state := game.recorder.State(); !state.Finished || state.Result != "0-1" {
+		t.Errorf("got state %+v", state)
+	}
+}
+
+func TestLateMoveLosesOnTime(t *testing.T) {
+	timeControl = &TimeControl{InitialMs: 60000}
+	defer func() { timeControl = nil }()
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+
+	// as if black had thought for longer than the clock allowed
+	game.recorder.mu.Lock()
+	game.recorder.state.TurnStarted = game.recorder.state.TurnStarted.Add(-time.Minute)
+	game.recorder.mu.Unlock()
+	black.send(move("2", "e7", "e5"))
+	if got := white.expect("game_over"); got.Result != "1-0" || got.Reason != "timeout" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestPausedGameWaitsForBothPlayers(t *testing.T) {
+	timeControl = &TimeControl{InitialMs: 60000}
+	defer func() { timeControl = nil }()
+	game, white, black := startTestGame(t)
+
+	white.send(Message{Type: "pause_offer"})
+	black.expect("pause_offer")
+	black.send(Message{Type: "pause_offer"})
+	for _, player := range []*testPlayer{white, black} {
+		player.expect("paused")
+	}
+	waitFor(t, func() bool {
+		game.mu.Lock()
+		defer game.mu.Unlock()
+		return !game.connected["white"] && !game.connected["black"]
+	})
+	if _, ok := games.unattended.Get(game.id); !ok {
+		t.Error("the paused game left is not waiting for its players")
+	}
+	// the clocks stay stopped however long the players are away
+	paused := game.recorder.State()
+	white1, _ := paused.Clocks(time.Now().Add(time.Hour))
+	if !paused.Paused || white1 < 59000 {
+		t.Fatalf("got paused state %+v", paused)
+	}
+
+	back := map[string]*testPlayer{}
+	resume := func(color string) {
+		back[color] = newTestPlayer(t)
+		if err := game.Resume(context.Background(), back[color].conn, game.tokens[color], -1); err != nil {
+			t.Fatal(err)
+		}
+		back[color].expect("resume")
+	}
+	resume("white")
+	if _, ok := games.unattended.Get(game.id); ok {
+		t.Error("the game resumed is still expiring")
+	}
+	back["white"].send(move("1", "e2", "e4"))
+	back["white"].expect("error", CodeGamePaused)
+	resume("black")
+	for _, player := range back {
+		if got := player.expect("unpaused"); got.WhiteTime < 59000 || got.BlackTime != 60000 {
+			t.Errorf("got clocks %+v", got)
+		}
+	}
+	back["white"].send(move("2", "e2", "e4"))
+	back["black"].expect("move")
+}
+
+func TestGamesLastingTooLongAreEnded(t *testing.T) {
+	defer func(d time.Duration) { maxGameDuration = d }(maxGameDuration)
+	maxGameDuration = 500 * time.Millisecond
+
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.send(move("2", "e7", "e5"))
+	white.expect("move")
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("game_over"); got.Result != "1/2-1/2" || got.Reason != "max_duration" {
+			t.Errorf("got %+v", got)
+		}
+	}
+	events := mustLoad(t, game.id)
+	if doc := newGameDocument(Replay(events), events); doc.Reason != "max_duration" {
+		t.Errorf("got reason %q in the document", doc.Reason)
+	}
+
+	_, white, black = startTestGame(t)
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("game_over"); got.Result != "" || got.Reason != "aborted" {
+			t.Errorf("got %+v before anyone moved", got)
+		}
+	}
+}
+
+// laggedTransport answers pings after rtt
+type laggedTransport struct {
+	*memTransport
+	rtt time.Duration
+}
+
+func (t laggedTransport) LastPong() time.Time {
+	return time.Now()
+}
+
+func (t laggedTransport) RTT() time.Duration {
+	return t.rtt
+}
+
+func TestLagIsCompensated(t *testing.T) {
+	timeControl = &TimeControl{InitialMs: 60000}
+	defer func() { timeControl = nil }()
+	defer func(d time.Duration) { maxLagCompensation = d }(maxLagCompensation)
+	maxLagCompensation = 300 * time.Millisecond
+
+	// the credit is bounded, however slow the network of the player
+	for rtt, credited := range map[time.Duration]int64{200 * time.Millisecond: 200, 2 * time.Second: 300} {
+		white := newTestPlayer(t)
+		transport := newMemTransport()
+		black := &testPlayer{t: t, transport: transport, conn: newConnection(laggedTransport{transport, rtt}, protocolVersion, jsonCodec{}, defaultLanguage)}
+		t.Cleanup(black.disconnect)
+		if err := games.Pair(context.Background(), white.conn); err != nil {
+			t.Fatal(err)
+		}
+		games.mu.Lock()
+		game := games.seeks[len(games.seeks)-1]
+		games.mu.Unlock()
+		if err := games.Pair(context.Background(), black.conn); err != nil {
+			t.Fatal(err)
+		}
+		white.expect("start")
+		black.expect("start")
+		white.send(move("1", "e2", "e4"))
+		black.expect("move")
+
+		// as if black had thought for a second
+		game.recorder.mu.Lock()
+		game.recorder.state.TurnStarted = game.recorder.state.TurnStarted.Add(-time.Second)
+		game.recorder.mu.Unlock()
+		black.send(move("2", "e7", "e5"))
+		got := white.expect("move")
+		if spent := 60000 - got.BlackTime; spent < 1000-credited || spent > 1000-credited+100 {
+			t.Errorf("with a round trip of %v, %dms taken off the clock", rtt, spent)
+		}
+		white.send(Message{Type: "resign"})
+		black.expect("game_over")
+		<-game.done
+	}
+}
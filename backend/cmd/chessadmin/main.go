@@ -0,0 +1,171 @@
+// Command chessadmin manages a running server through its admin API.
+//
+//	chessadmin [-addr url] [-token token] <command> [args]
+//
+// The commands are:
+//
+//	games               list the stored games
+//	audit <game>        dump the event log of a game
+//	kick <game> [color] disconnect the players of a game, or only one of them
+//	abort <game>        end a game without a result
+//	bans                list the banned IP addresses
+//	ban <ip>            refuse the connections from an IP address
+//	unban <ip>          accept the connections from an IP address again
+//	drain [on|off]      show, or turn on or off, drain mode
+//	drain on <deadline> also exit once the games are over, at the latest
+//	                    after deadline, a duration like 10m
+//	exhibition <white> <black> [movetime]
+//	                    start a game between two of the configured UCI
+//	                    engines, thinking movetime, like 2s, about every move
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", envOr("CHESS_ADMIN_URL", "http://localhost:6060"), "URL of the admin server")
+	token := flag.String("token", os.Getenv("CHESS_ADMIN_TOKEN"), "bearer token of the admin server")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: chessadmin [flags] games | audit <game> | kick <game> [color] | abort <game> | bans | ban <ip> | unban <ip> | drain [on [deadline]|off] | exhibition <white> <black> [movetime]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	admin := adminClient{base: strings.TrimSuffix(*addr, "/"), token: *token}
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := args[0], args[1:]; {
+	case command == "games" && len(args) == 0:
+		err = admin.do(http.MethodGet, "/games", printList)
+	case command == "audit" && len(args) == 1:
+		err = admin.do(http.MethodGet, "/games/"+url.PathEscape(args[0])+"/audit", printIndented)
+	case command == "kick" && (len(args) == 1 || len(args) == 2):
+		path := "/games/" + url.PathEscape(args[0]) + "/kick"
+		if len(args) == 2 {
+			path += "?color=" + url.QueryEscape(args[1])
+		}
+		err = admin.do(http.MethodPost, path, nil)
+	case command == "abort" && len(args) == 1:
+		err = admin.do(http.MethodPost, "/games/"+url.PathEscape(args[0])+"/abort", nil)
+	case command == "bans" && len(args) == 0:
+		err = admin.do(http.MethodGet, "/bans", printList)
+	case command == "ban" && len(args) == 1:
+		err = admin.do(http.MethodPut, "/bans/"+url.PathEscape(args[0]), nil)
+	case command == "unban" && len(args) == 1:
+		err = admin.do(http.MethodDelete, "/bans/"+url.PathEscape(args[0]), nil)
+	case command == "drain" && len(args) == 0:
+		err = admin.do(http.MethodGet, "/drain", printDrain)
+	case command == "drain" && len(args) == 1 && args[0] == "on":
+		err = admin.do(http.MethodPut, "/drain", printDrain)
+	case command == "drain" && len(args) == 2 && args[0] == "on":
+		err = admin.do(http.MethodPut, "/drain?deadline="+url.QueryEscape(args[1]), printDrain)
+	case command == "drain" && len(args) == 1 && args[0] == "off":
+		err = admin.do(http.MethodDelete, "/drain", printDrain)
+	case command == "exhibition" && (len(args) == 2 || len(args) == 3):
+		query := url.Values{"white": {args[0]}, "black": {args[1]}}
+		if len(args) == 3 {
+			query.Set("movetime", args[2])
+		}
+		err = admin.do(http.MethodPost, "/exhibitions?"+query.Encode(), printIndented)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+type adminClient struct {
+	base  string
+	token string
+}
+
+// do sends a request to the admin API, handing the body of a successful
+// response to print if there is one
+func (admin adminClient) do(method, path string, print func([]byte) error) error {
+	req, err := http.NewRequest(method, admin.base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+admin.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	if print == nil {
+		return nil
+	}
+	return print(body)
+}
+
+func printList(body []byte) error {
+	var items []string
+	if err := json.Unmarshal(body, &items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		fmt.Println(item)
+	}
+	return nil
+}
+
+func printIndented(body []byte) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		return err
+	}
+	_, err := out.WriteTo(os.Stdout)
+	return err
+}
+
+func printDrain(body []byte) error {
+	var status struct {
+		Draining bool       `json:"draining"`
+		Games    int        `json:"games"`
+		Deadline *time.Time `json:"deadline"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return err
+	}
+	switch {
+	case status.Deadline != nil:
+		fmt.Printf("draining: %d games left, exiting once they are over or at %s\n", status.Games, status.Deadline.Local().Format(time.DateTime))
+	case status.Draining:
+		fmt.Printf("draining: no new games are created, %d games left\n", status.Games)
+	default:
+		fmt.Printf("not draining, %d games\n", status.Games)
+	}
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
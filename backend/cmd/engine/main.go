@@ -0,0 +1,25 @@
+// Command engine is the built-in engine of the server as a UCI engine, for
+// exhibitions against other engines and for any UCI client.
+//
+//	engine [-level name]
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/alvaronaschez/simple-chess/engine"
+)
+
+func main() {
+	name := flag.String("level", "master", "level to play at: beginner, casual, intermediate, advanced or master")
+	flag.Parse()
+	level, ok := engine.LevelNamed(*name)
+	if !ok {
+		log.Fatalf("unknown level %q", *name)
+	}
+	if err := engine.ServeUCI(os.Stdin, os.Stdout, level); err != nil {
+		log.Fatal(err)
+	}
+}
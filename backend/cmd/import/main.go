@@ -0,0 +1,224 @@
+// Command import ingests a PGN archive into the database of a running
+// server through its admin API, which checks the games with the rules in
+// parallel. The games that break them are reported and left out.
+//
+//	import [-addr url] [-token token] [-batch n] [-workers n] <archive.pgn>
+//
+// The archive is sent a batch of games at a time. Once a batch is in, how
+// far the archive was read is written to its checkpoint file; an import
+// interrupted resumes from there when run again, the games of the batch
+// that was being sent that are already stored being left as they are
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", envOr("CHESS_ADMIN_URL", "http://localhost:6060"), "URL of the admin server")
+	token := flag.String("token", os.Getenv("CHESS_ADMIN_TOKEN"), "bearer token of the admin server")
+	batch := flag.Int("batch", 1000, "games sent at a time")
+	workers := flag.Int("workers", 0, "games the server checks at once, as many as its CPUs if 0")
+	checkpoint := flag.String("checkpoint", "", "file keeping how far the archive was imported, the archive's with .import appended by default")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: import [flags] <archive.pgn>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *batch < 1 || *workers < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	archive := flag.Arg(0)
+	if *checkpoint == "" {
+		*checkpoint = archive + ".import"
+	}
+
+	imp := importer{base: strings.TrimSuffix(*addr, "/"), token: *token, workers: *workers}
+	if err := imp.run(archive, *checkpoint, *batch); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d games imported, %d already there, %d invalid\n", imp.imported, imp.existing, imp.invalid)
+}
+
+type importer struct {
+	base    string
+	token   string
+	workers int
+	// the games of the archive so far, by how their import went
+	imported, existing, invalid int
+}
+
+// report is how the import of a game of a batch went, as the admin API
+// answers it
+type report struct {
+	Game   int    `json:"game"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// run imports archive from where checkpoint says the last import got to,
+// batch games at a time
+func (imp *importer) run(archive, checkpoint string, batch int) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, games, err := readCheckpoint(checkpoint)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		fmt.Printf("resuming after game %d\n", games)
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	r := bufio.NewReader(f)
+	var pending bytes.Buffer
+	// the games begun in pending, the last of which may still have lines to
+	// come, and whether it has moves yet
+	inBatch, moves := 0, false
+	send := func() error {
+		if err := imp.send(pending.Bytes(), games); err != nil {
+			return err
+		}
+		offset += int64(pending.Len())
+		games += inBatch
+		pending.Reset()
+		inBatch = 0
+		return writeCheckpoint(checkpoint, offset, games)
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if line == "" && errors.Is(err, io.EOF) {
+			break
+		}
+		trimmed := strings.TrimSpace(line)
+		tag := strings.HasPrefix(trimmed, "[")
+		switch {
+		case tag && moves:
+			// the tags of the next game start, as the server splits games
+			moves = false
+			if inBatch == batch {
+				if err := send(); err != nil {
+					return err
+				}
+			}
+			inBatch++
+		case trimmed != "" && inBatch == 0:
+			inBatch = 1
+		}
+		if trimmed != "" && !tag && !strings.HasPrefix(trimmed, "%") {
+			moves = true
+		}
+		pending.WriteString(line)
+	}
+	if inBatch > 0 {
+		if err := send(); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// send posts the games of batch, the games before which in the archive were
+// done, printing those not imported
+func (imp *importer) send(batch []byte, done int) error {
+	path := "/imports"
+	if imp.workers > 0 {
+		path += "?" + url.Values{"workers": {strconv.Itoa(imp.workers)}}.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPost, imp.base+path, bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+imp.token)
+	req.Header.Set("Content-Type", "application/x-chess-pgn")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var r report
+		if err := decoder.Decode(&r); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch r.Status {
+		case "imported":
+			imp.imported++
+		case "exists":
+			imp.existing++
+		case "invalid":
+			imp.invalid++
+			fmt.Fprintf(os.Stderr, "game %d: %s\n", done+r.Game, r.Error)
+		default:
+			if r.Game == 0 {
+				return fmt.Errorf("after game %d: %s", done, r.Error)
+			}
+			return fmt.Errorf("game %d: %s", done+r.Game, r.Error)
+		}
+	}
+}
+
+// readCheckpoint reads how many bytes and games of the archive were
+// imported, none if there is no checkpoint
+func readCheckpoint(path string) (offset int64, games int, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Sscan(string(data), &offset, &games); err != nil {
+		return 0, 0, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return offset, games, nil
+}
+
+// writeCheckpoint records how far the archive was imported, replacing the
+// checkpoint at once for an interruption not to leave half of it
+func writeCheckpoint(path string, offset int64, games int) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", offset, games)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
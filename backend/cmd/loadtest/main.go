@@ -0,0 +1,170 @@
+// Command loadtest plays games between simulated players over real
+// WebSockets and reports the move throughput and latency percentiles.
+//
+// Players move at random among the legal moves as soon as it is their turn.
+// The server ends the games that are mated or stalemated, in those with
+// too little material to mate a player offers a draw, and the side to move
+// resigns once a game reaches -plies.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+	"github.com/alvaronaschez/simple-chess/client"
+)
+
+func main() {
+	url := flag.String("url", "ws://localhost:5555/ws", "WebSocket URL of the server")
+	pairs := flag.Int("pairs", 10, "number of games played at the same time")
+	games := flag.Int("games", 1, "number of games each player plays")
+	plies := flag.Int("plies", 200, "half-moves after which a game is resigned")
+	timeout := flag.Duration("timeout", 5*time.Minute, "time after which the test is abandoned")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	stats := &stats{}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2**pairs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < *games && ctx.Err() == nil; j++ {
+				if err := play(ctx, *url, *plies, stats); err != nil {
+					stats.errors.Add(1)
+					log.Println(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	stats.report(time.Since(start))
+}
+
+type stats struct {
+	games  atomic.Int64
+	moves  atomic.Int64
+	errors atomic.Int64
+
+	mu sync.Mutex
+	// roundTrips are the times between submitting a move and receiving the reply
+	roundTrips []time.Duration
+}
+
+func (s *stats) addRoundTrip(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roundTrips = append(s.roundTrips, d)
+}
+
+func (s *stats) report(elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	moves := s.moves.Load()
+	fmt.Printf("games:      %d finished, %d errors in %s\n", s.games.Load()/2, s.errors.Load(), elapsed.Round(time.Millisecond))
+	fmt.Printf("throughput: %d moves, %.1f moves/s\n", moves, float64(moves)/elapsed.Seconds())
+	if len(s.roundTrips) == 0 {
+		return
+	}
+	slices.Sort(s.roundTrips)
+	percentile := func(p float64) time.Duration {
+		return s.roundTrips[int(p*float64(len(s.roundTrips)-1))].Round(time.Microsecond)
+	}
+	fmt.Printf("round trip: p50 %s  p90 %s  p99 %s  max %s\n", percentile(0.5), percentile(0.9), percentile(0.99), percentile(1))
+}
+
+// play connects a player and plays one game until it is over
+func play(ctx context.Context, url string, plies int, stats *stats) error {
+	c, err := client.Connect(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	go func() {
+		<-ctx.Done()
+		c.Close()
+	}()
+
+	position := chess.NewPosition()
+	color := chess.White
+	ply := 0
+	var submitted time.Time
+
+	// move plays on our turn
+	move := func() error {
+		if position.Turn() != color {
+			return nil
+		}
+		switch status := position.Status(); {
+		case status == chess.Checkmate || status == chess.Stalemate:
+			return nil
+		case ply >= plies:
+			return c.Resign()
+		case status != chess.Ongoing && status != chess.FiftyMoves:
+			return c.OfferDraw()
+		}
+		moves := position.LegalMoves()
+		m := moves[rand.Intn(len(moves))]
+		promotion := ""
+		if m.Promotion != chess.NoPieceType {
+			promotion = m.String()[4:]
+		}
+		submitted = time.Now()
+		if err := c.SubmitMove(m.From.String(), m.To.String(), promotion); err != nil {
+			return err
+		}
+		position = position.Apply(m)
+		ply++
+		stats.moves.Add(1)
+		return nil
+	}
+
+	for event := range c.Events() {
+		switch event := event.(type) {
+		case client.Started:
+			if event.Color == "black" {
+				color = chess.Black
+			}
+			if err := move(); err != nil {
+				return err
+			}
+		case client.Moved:
+			if !submitted.IsZero() {
+				stats.addRoundTrip(time.Since(submitted))
+			}
+			m, err := chess.ParseMove(event.Move.From + event.Move.To + event.Move.Promotion)
+			if err != nil || !position.IsLegal(m) {
+				return fmt.Errorf("opponent played %s%s%s, which is not legal", event.Move.From, event.Move.To, event.Move.Promotion)
+			}
+			position = position.Apply(m)
+			ply++
+			if err := move(); err != nil {
+				return err
+			}
+		case client.DrawOffered:
+			if err := c.OfferDraw(); err != nil {
+				return err
+			}
+		case client.GameOver:
+			stats.games.Add(1)
+			return nil
+		case client.Error:
+			return event
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Err()
+}
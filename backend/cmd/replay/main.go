@@ -0,0 +1,202 @@
+// Command replay plays a session recorded with -record-dir back
+// against a server, with the original timing, and reports where the
+// messages the players get differ from the recorded ones.
+//
+//	replay [-url url] [-speed n] <game>.session.jsonl
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// message holds the fields of a message worth comparing, the others
+// like sequence numbers, timestamps and tokens change on every run
+type message struct {
+	Type      string `json:"type"`
+	Seq       int    `json:"seq,omitempty"`
+	Code      string `json:"code,omitempty"`
+	GameID    string `json:"gameId,omitempty"`
+	Token     string `json:"token,omitempty"`
+	Color     string `json:"color,omitempty"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	Promotion string `json:"promotion,omitempty"`
+	Result    string `json:"result,omitempty"`
+}
+
+func (m message) String() string {
+	s := m.Type
+	for _, field := range []string{m.Code, m.Color, m.From + m.To + m.Promotion, m.Result} {
+		if field != "" {
+			s += " " + field
+		}
+	}
+	return s
+}
+
+type entry struct {
+	Time    time.Time       `json:"time"`
+	Color   string          `json:"color"`
+	Kind    string          `json:"kind"`
+	Message json.RawMessage `json:"message,omitempty"`
+}
+
+// player is the live connection replaying one color
+type player struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+	// received holds every message the server sent to the color
+	received []message
+	gameID   string
+	token    string
+}
+
+func (p *player) read(ws *websocket.Conn) {
+	for {
+		m := message{}
+		if err := ws.ReadJSON(&m); err != nil {
+			return
+		}
+		p.mu.Lock()
+		p.received = append(p.received, m)
+		if m.Type == "start" {
+			p.gameID, p.token = m.GameID, m.Token
+		}
+		p.mu.Unlock()
+	}
+}
+
+func main() {
+	server := flag.String("url", "ws://localhost:5555/ws", "WebSocket URL of the server to replay against")
+	speed := flag.Float64("speed", 1, "how many times faster than recorded to replay, 0 for no delays")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: replay [flags] <game>.session.jsonl")
+		os.Exit(2)
+	}
+
+	entries, err := load(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	players := map[string]*player{"white": {}, "black": {}}
+	expected := map[string][]message{}
+	var last time.Time
+	for _, e := range entries {
+		if !last.IsZero() && *speed > 0 {
+			time.Sleep(time.Duration(float64(e.Time.Sub(last)) / *speed))
+		}
+		last = e.Time
+		p := players[e.Color]
+		switch e.Kind {
+		case "connect":
+			// the first connection of a color joins, later ones resume the live game
+			u, _ := url.Parse(*server)
+			query := u.Query()
+			p.mu.Lock()
+			if p.gameID != "" {
+				query.Set("game", p.gameID)
+				query.Set("token", p.token)
+				query.Set("seq", strconv.Itoa(lastSeq(p.received)))
+			}
+			p.mu.Unlock()
+			u.RawQuery = query.Encode()
+			ws, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			p.ws = ws
+			go p.read(ws)
+		case "in":
+			if p.ws != nil {
+				p.ws.WriteMessage(websocket.TextMessage, e.Message)
+			}
+		case "out":
+			m := message{}
+			json.Unmarshal(e.Message, &m)
+			expected[e.Color] = append(expected[e.Color], m)
+		case "disconnect":
+			if p.ws != nil {
+				p.ws.Close()
+				p.ws = nil
+			}
+		}
+	}
+	// let the replies to the last messages arrive
+	time.Sleep(500 * time.Millisecond)
+
+	diverged := false
+	for _, color := range []string{"white", "black"} {
+		p := players[color]
+		p.mu.Lock()
+		if i, ok := firstDifference(expected[color], p.received); ok {
+			fmt.Printf("%s: %d messages match the recording\n", color, len(p.received))
+		} else {
+			diverged = true
+			fmt.Printf("%s: diverges at message %d, recorded %s, got %s\n", color, i+1, at(expected[color], i), at(p.received, i))
+		}
+		p.mu.Unlock()
+	}
+	if diverged {
+		os.Exit(1)
+	}
+}
+
+func load(path string) ([]entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		e := entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func lastSeq(messages []message) int {
+	seq := -1
+	for _, m := range messages {
+		if m.Seq > seq {
+			seq = m.Seq
+		}
+	}
+	return seq
+}
+
+// firstDifference compares the messages ignoring what changes on every run,
+// it reports the index of the first that differs, or true if none does
+func firstDifference(expected, got []message) (int, bool) {
+	for i := 0; i < len(expected) || i < len(got); i++ {
+		if i >= len(expected) || i >= len(got) || expected[i].String() != got[i].String() {
+			return i, false
+		}
+	}
+	return 0, true
+}
+
+func at(messages []message, i int) string {
+	if i >= len(messages) {
+		return "nothing"
+	}
+	return messages[i].String()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/alvaronaschez/simple-chess/client"
+)
+
+// board only moves pieces around, the server is the one enforcing the rules
+type board [8][8]byte
+
+var symbols = map[byte]string{
+	'K': "♔", 'Q': "♕", 'R': "♖", 'B': "♗", 'N': "♘", 'P': "♙",
+	'k': "♚", 'q': "♛", 'r': "♜", 'b': "♝", 'n': "♞", 'p': "♟",
+}
+
+func newBoard() *board {
+	b := &board{}
+	rows := []string{"RNBQKBNR", "PPPPPPPP", "", "", "", "", "pppppppp", "rnbqkbnr"}
+	for rank, row := range rows {
+		for file := range row {
+			b[rank][file] = row[file]
+		}
+	}
+	return b
+}
+
+// square parses a square like e4 into its rank and file indexes
+func square(s string) (rank, file int, ok bool) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return 0, 0, false
+	}
+	return int(s[1] - '1'), int(s[0] - 'a'), true
+}
+
+func (b *board) Play(move client.Move) {
+	fromRank, fromFile, ok := square(move.From)
+	if !ok {
+		return
+	}
+	toRank, toFile, ok := square(move.To)
+	if !ok {
+		return
+	}
+	piece := b[fromRank][fromFile]
+	b[fromRank][fromFile] = 0
+	switch {
+	// castling also moves the rook
+	case (piece == 'K' || piece == 'k') && toFile-fromFile == 2:
+		b[toRank][5], b[toRank][7] = b[toRank][7], 0
+	case (piece == 'K' || piece == 'k') && fromFile-toFile == 2:
+		b[toRank][3], b[toRank][0] = b[toRank][0], 0
+	// a pawn moving diagonally to an empty square captures en passant
+	case (piece == 'P' || piece == 'p') && fromFile != toFile && b[toRank][toFile] == 0:
+		b[fromRank][toFile] = 0
+	}
+	if move.Promotion != "" {
+		piece = move.Promotion[0]
+		// white promotes on the eighth rank
+		if toRank == 7 {
+			piece = strings.ToUpper(move.Promotion)[0]
+		}
+	}
+	b[toRank][toFile] = piece
+}
+
+// String draws the board from the side of color
+func (b *board) String(color string) string {
+	var s strings.Builder
+	for i := 7; i >= 0; i-- {
+		rank := i
+		if color == "black" {
+			rank = 7 - i
+		}
+		s.WriteByte(byte('1' + rank))
+		s.WriteString(" ")
+		for j := 0; j < 8; j++ {
+			file := j
+			if color == "black" {
+				file = 7 - j
+			}
+			switch {
+			case b[rank][file] != 0:
+				s.WriteString(symbols[b[rank][file]])
+			case (rank+file)%2 == 0:
+				s.WriteString("·")
+			default:
+				s.WriteString(" ")
+			}
+			s.WriteString(" ")
+		}
+		s.WriteString("\n")
+	}
+	if color == "black" {
+		s.WriteString("  h g f e d c b a\n")
+	} else {
+		s.WriteString("  a b c d e f g h\n")
+	}
+	return s.String()
+}
@@ -0,0 +1,128 @@
+// Command tui plays a game against another client from the terminal.
+// Moves are typed in coordinate notation, like e2e4 or e7e8q,
+// besides the commands draw, resign and quit.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/alvaronaschez/simple-chess/client"
+)
+
+func main() {
+	url := flag.String("url", "ws://localhost:5555/ws", "WebSocket URL of the server")
+	game := flag.String("game", "", "game to resume instead of joining a new one")
+	token := flag.String("token", "", "token of the game to resume")
+	flag.Parse()
+
+	ctx := context.Background()
+	var c *client.Client
+	var err error
+	if *game != "" {
+		c, err = client.Resume(ctx, *url, *game, *token)
+	} else {
+		c, err = client.Connect(ctx, *url)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- strings.TrimSpace(scanner.Text())
+		}
+		close(lines)
+	}()
+
+	fmt.Println("Waiting for an opponent...")
+	b := newBoard()
+	color := ""
+	turn := "white"
+	over := false
+	for {
+		select {
+		case event, ok := <-c.Events():
+			if !ok {
+				// the server hangs up once the game is over
+				if err := c.Err(); err != nil && !over {
+					fmt.Println("Connection closed:", err)
+				}
+				return
+			}
+			switch event := event.(type) {
+			case client.Started:
+				color = event.Color
+				fmt.Printf("Game %s started, you play %s (resume with -game %s -token %s)\n", event.GameID, color, event.GameID, c.Token())
+			case client.Resumed:
+				color = event.Color
+				b = newBoard()
+				turn = "white"
+				for _, move := range event.Moves {
+					b.Play(move)
+					turn = opponent(turn)
+				}
+			case client.Moved:
+				b.Play(event.Move)
+				turn = opponent(turn)
+				fmt.Printf("Opponent played %s%s%s\n", event.Move.From, event.Move.To, event.Move.Promotion)
+			case client.DrawOffered:
+				fmt.Println("Your opponent offers a draw, type draw to accept")
+				continue
+			case client.GameOver:
+				fmt.Printf("Game over: %s by %s\n", event.Result, event.Reason)
+				over = true
+				continue
+			case client.Error:
+				fmt.Println(event.Text)
+				continue
+			}
+			fmt.Print(b.String(color))
+			if turn == color {
+				fmt.Print("Your move: ")
+			}
+		case line, ok := <-lines:
+			if !ok || line == "quit" {
+				return
+			}
+			switch {
+			case line == "":
+			case line == "draw":
+				err = c.OfferDraw()
+			case line == "resign":
+				err = c.Resign()
+			case len(line) == 4 || len(line) == 5:
+				if turn != color {
+					fmt.Println("It is not your turn")
+					continue
+				}
+				from, to, promotion := line[:2], line[2:4], line[4:]
+				if err = c.SubmitMove(from, to, promotion); err == nil {
+					b.Play(client.Move{From: from, To: to, Promotion: promotion})
+					turn = opponent(turn)
+					fmt.Print(b.String(color))
+				}
+			default:
+				fmt.Println("Type a move like e2e4, draw, resign or quit")
+			}
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+func opponent(color string) string {
+	if color == "white" {
+		return "black"
+	}
+	return "white"
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"slices"
+)
+
+var ErrCoachDismissed = errors.New("coach dismissed")
+
+// coachSeat is the seat of the coach of color, who sees the game from
+// there and suggests moves to that player alone
+func coachSeat(color string) string {
+	return color + "_coach"
+}
+
+// coachSeats are those of the coaches of both colors, which every game has
+// whether anyone was invited to them or not
+var coachSeats = []string{coachSeat("white"), coachSeat("black")}
+
+// seatTokens are the tokens of the seats of the game, as they are now
+func (game *ChessGame) seatTokens() map[string]string {
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	return maps.Clone(game.tokens)
+}
+
+// setSeatToken sets the token of seat, for whoever has it to resume the
+// game there, or removes it if token is empty; the tokens are copied for
+// those reading them meanwhile
+func (game *ChessGame) setSeatToken(seat, token string) {
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	game.tokens = maps.Clone(game.tokens)
+	if token == "" {
+		delete(game.tokens, seat)
+		game.connected[seat] = false
+		return
+	}
+	game.tokens[seat] = token
+}
+
+// inviteCoach handles the coach_invite and coach_dismiss of the player of
+// color. Inviting a coach answers the token they resume the game with, as
+// its players do, and Role mover lets them move for the player; inviting
+// again changes what the coach may do, the coach already in staying.
+// Dismissing one disconnects them. Rated games are played alone
+func (game *ChessGame) inviteCoach(color string, boxes map[string]*outbox, message Message) {
+	box, coach := boxes[color], boxes[coachSeat(color)]
+	if message.Type == "coach_dismiss" {
+		game.setSeatToken(coachSeat(color), "")
+		if coach.conn != nil {
+			closeWithError(coach.conn, ErrCoachDismissed)
+			coach.Attach(nil)
+		}
+		game.recorder.Record(game.ctx, CoachDismissed, color, nil)
+		box.Send(Message{Type: "coach_dismiss", Color: color})
+		return
+	}
+	if isRated(game.recorder.State()) {
+		box.SendTransient(errorMessage(CodeCoachingRated))
+		return
+	}
+	if message.Role != "" && message.Role != "mover" {
+		invalid := errorMessage(CodeInvalidMessage, "role", "oneof")
+		invalid.Field = "role"
+		box.SendTransient(invalid)
+		return
+	}
+	token := newToken()
+	game.setSeatToken(coachSeat(color), token)
+	game.recorder.RecordCoachInvited(game.ctx, color, message.Role)
+	box.Send(Message{Type: "coach_invite", Color: color, Token: token, Role: message.Role})
+}
+
+// coach handles what the coach of color sent, reporting whether it is a
+// move they make for the player, which only those let to can
+func (game *ChessGame) coach(color string, boxes map[string]*outbox, message Message) bool {
+	switch message.Type {
+	case "coach_suggest":
+		if len(message.Comment) > maxCommentLength {
+			boxes[coachSeat(color)].SendTransient(errorMessage(CodeInvalidMessage, "comment", "max"))
+			return false
+		}
+		boxes[color].Send(Message{Type: "coach_suggest", Color: color, From: message.From, To: message.To, Promotion: message.Promotion, Drop: message.Drop, Comment: message.Comment})
+		return false
+	case "move", "drop":
+		if slices.Contains(game.recorder.State().CoachesMove, color) {
+			return true
+		}
+	}
+	boxes[coachSeat(color)].SendTransient(errorMessage(CodeWrongRole))
+	return false
+}
+
+// tellCoaches shows the coaches every move, made by color, and the player
+// of color the move their coach made for them if byCoach
+func (game *ChessGame) tellCoaches(boxes map[string]*outbox, color string, message Message, byCoach bool) {
+	for _, coached := range game.recorder.State().Coached {
+		boxes[coachSeat(coached)].Send(message)
+	}
+	if byCoach {
+		boxes[color].Send(message)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestCoach(t *testing.T) {
+	ctx := context.Background()
+	game, white, black := startTestGame(t)
+
+	white.send(Message{Type: "coach_invite", Role: "sleeper"})
+	white.expect("error", CodeInvalidMessage)
+	white.send(Message{Type: "coach_invite", Role: "mover"})
+	invite := white.expect("coach_invite")
+	if invite.Token == "" || invite.Role != "mover" || invite.Color != "white" {
+		t.Fatalf("got %+v", invite)
+	}
+	if err := game.Resume(ctx, newTestPlayer(t).conn, "", -1); err != ErrInvalidResumeToken {
+		t.Fatalf("got %v resuming without a token", err)
+	}
+	coach := newTestPlayer(t)
+	if err := game.Resume(ctx, coach.conn, invite.Token, -1); err != nil {
+		t.Fatal(err)
+	}
+	if got := coach.expect("resume"); got.Role != "coach" || got.Color != "white" {
+		t.Fatalf("got %+v", got)
+	}
+
+	// the coach sees every move and whispers to their player alone
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	coach.expect("move")
+	coach.send(Message{Type: "coach_suggest", From: "g1", To: "f3", Comment: "develop"})
+	if got := white.expect("coach_suggest"); got.From != "g1" || got.To != "f3" || got.Comment != "develop" {
+		t.Fatalf("got %+v", got)
+	}
+	black.send(move("2", "e7", "e5"))
+	white.expect("move")
+	coach.expect("move")
+	// a coach let to moves for their player, who is told
+	coach.send(move("3", "g1", "f3"))
+	if got := black.expect("move"); got.From != "g1" {
+		t.Fatalf("got %+v", got)
+	}
+	white.expect("move")
+	coach.expect("move")
+	coach.send(Message{Type: "resign"})
+	coach.expect("error", CodeWrongRole)
+
+	white.send(Message{Type: "coach_dismiss"})
+	white.expect("coach_dismiss")
+	coach.expect("error", CodeCoachDismissed)
+	if err := game.Resume(ctx, newTestPlayer(t).conn, invite.Token, -1); err != ErrInvalidResumeToken {
+		t.Fatalf("got %v resuming once dismissed", err)
+	}
+
+	// a coach only watching cannot move
+	black.send(Message{Type: "coach_invite"})
+	invite = black.expect("coach_invite")
+	watcher := newTestPlayer(t)
+	if err := game.Resume(ctx, watcher.conn, invite.Token, -1); err != nil {
+		t.Fatal(err)
+	}
+	watcher.expect("resume")
+	watcher.send(move("4", "b8", "c6"))
+	watcher.expect("error", CodeWrongRole)
+	if state := game.recorder.State(); !slices.Equal(state.Coached, []string{"black"}) || len(state.CoachesMove) != 0 {
+		t.Fatalf("got %v coached, %v moved by their coach", state.Coached, state.CoachesMove)
+	}
+}
+
+func TestCoachRated(t *testing.T) {
+	game, white, _ := startTestGame(t)
+	game.recorder.RecordJoin(context.Background(), "white", "alice")
+	game.recorder.RecordJoin(context.Background(), "black", "bob")
+	white.send(Message{Type: "coach_invite"})
+	white.expect("error", CodeCoachingRated)
+}
@@ -0,0 +1,990 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// codec is how messages are framed on a connection, chosen when it is opened
+type codec interface {
+	// Encode appends message to b, which it may grow
+	Encode(b []byte, message Message) (frameType int, data []byte, err error)
+	Decode(data []byte) (Message, error)
+}
+
+var codecs = map[string]codec{
+	"json":     jsonCodec{},
+	"protobuf": protobufCodec{},
+}
+
+var ErrUnsupportedEncoding = errors.New("unsupported encoding")
+
+// parseEncoding reads the encoding requested in the upgrade query,
+// clients that do not ask for one get JSON
+func parseEncoding(value string) (codec, error) {
+	if value == "" {
+		return jsonCodec{}, nil
+	}
+	if c, ok := codecs[value]; ok {
+		return c, nil
+	}
+	return nil, ErrUnsupportedEncoding
+}
+
+type jsonCodec struct{}
+
+// jsonEncoder is reused across Encode calls, unlike json.Marshal
+// it does not allocate the encoding it returns
+type jsonEncoder struct {
+	buf     bytes.Buffer
+	encoder *json.Encoder
+}
+
+var jsonEncoders = sync.Pool{New: func() any {
+	e := &jsonEncoder{}
+	e.encoder = json.NewEncoder(&e.buf)
+	return e
+}}
+
+func (jsonCodec) Encode(b []byte, message Message) (int, []byte, error) {
+	e := jsonEncoders.Get().(*jsonEncoder)
+	defer jsonEncoders.Put(e)
+	e.buf.Reset()
+	if err := e.encoder.Encode(message); err != nil {
+		return websocket.TextMessage, b, err
+	}
+	// without the newline the encoder ends every value with
+	return websocket.TextMessage, append(b, bytes.TrimSuffix(e.buf.Bytes(), []byte("\n"))...), nil
+}
+
+func (jsonCodec) Decode(data []byte) (Message, error) {
+	message := Message{}
+	err := json.Unmarshal(data, &message)
+	return message, err
+}
+
+// protobufCodec frames messages as in protocol.proto, sent as binary frames
+type protobufCodec struct{}
+
+var errMalformedProtobuf = errors.New("malformed protobuf message")
+
+func (protobufCodec) Encode(b []byte, message Message) (int, []byte, error) {
+	b = appendString(b, 1, message.Type)
+	b = appendVarint(b, 2, int64(message.Seq))
+	b = appendVarint(b, 3, int64(message.Version))
+	b = appendString(b, 4, message.Code)
+	b = appendString(b, 5, message.Text)
+	b = appendString(b, 6, message.GameID)
+	b = appendString(b, 7, message.Token)
+	b = appendString(b, 8, message.Color)
+	b = appendString(b, 9, message.From)
+	b = appendString(b, 10, message.To)
+	b = appendString(b, 11, message.Promotion)
+	for _, move := range message.Moves {
+		m := []byte{}
+		m = appendString(m, 1, move.ID)
+		m = appendString(m, 2, move.From)
+		m = appendString(m, 3, move.To)
+		m = appendString(m, 4, move.Promotion)
+		m = appendVarint(m, 5, move.SpentMs)
+		m = appendString(m, 6, move.Drop)
+		b = protowire.AppendTag(b, 12, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+	b = appendString(b, 13, message.MoveID)
+	b = appendVarint(b, 14, message.ServerTime)
+	b = appendVarint(b, 15, message.ClientTime)
+	b = appendString(b, 16, message.Field)
+	b = appendString(b, 17, message.Key)
+	b = appendString(b, 19, message.Result)
+	b = appendString(b, 20, message.Reason)
+	b = appendString(b, 21, message.Slug)
+	b = appendVarint(b, 22, message.WhiteTime)
+	b = appendVarint(b, 23, message.BlackTime)
+	b = appendString(b, 24, message.SimulID)
+	b = appendString(b, 47, message.MatchID)
+	b = appendString(b, 48, message.Score)
+	b = appendVarint(b, 25, int64(message.Board))
+	b = appendString(b, 26, message.Drop)
+	b = appendString(b, 27, message.Variant)
+	b = appendString(b, 28, message.Role)
+	b = appendString(b, 29, message.Piece)
+	for _, tally := range message.Votes {
+		v := []byte{}
+		v = appendString(v, 1, tally.Move)
+		v = appendVarint(v, 2, int64(tally.Count))
+		b = protowire.AppendTag(b, 30, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	b = appendVarint(b, 31, message.Deadline)
+	if message.Blindfold {
+		b = appendVarint(b, 32, 1)
+	}
+	if message.Rated {
+		b = appendVarint(b, 46, 1)
+	}
+	b = appendVarint(b, 33, int64(message.Ply))
+	b = appendString(b, 34, message.BoardID)
+	b = appendVarint(b, 35, int64(message.Rev))
+	b = appendVarint(b, 36, int64(message.Node))
+	b = appendVarint(b, 37, int64(message.Parent))
+	b = appendString(b, 38, message.FEN)
+	for _, node := range message.Nodes {
+		n := []byte{}
+		n = appendVarint(n, 1, int64(node.ID))
+		n = appendVarint(n, 2, int64(node.Parent))
+		n = appendString(n, 3, node.Move)
+		n = appendString(n, 4, node.SAN)
+		n = appendString(n, 5, node.Comment)
+		for _, nag := range node.NAGs {
+			n = protowire.AppendTag(n, 7, protowire.VarintType)
+			n = protowire.AppendVarint(n, uint64(nag))
+		}
+		for _, arrow := range node.Arrows {
+			n = protowire.AppendTag(n, 6, protowire.BytesType)
+			n = protowire.AppendString(n, arrow)
+		}
+		b = protowire.AppendTag(b, 39, protowire.BytesType)
+		b = protowire.AppendBytes(b, n)
+	}
+	b = appendString(b, 40, message.Participant)
+	for _, member := range message.Members {
+		m := []byte{}
+		m = appendString(m, 1, member.ID)
+		m = appendString(m, 2, member.Role)
+		b = protowire.AppendTag(b, 41, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+	b = appendString(b, 42, message.Comment)
+	for _, nag := range message.NAGs {
+		b = protowire.AppendTag(b, 44, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(nag))
+	}
+	for _, arrow := range message.Arrows {
+		b = protowire.AppendTag(b, 43, protowire.BytesType)
+		b = protowire.AppendString(b, arrow)
+	}
+	if p := message.Preferences; p != nil {
+		v := []byte{}
+		if p.AutoQueen {
+			v = appendVarint(v, 1, 1)
+		}
+		if p.Premove {
+			v = appendVarint(v, 2, 1)
+		}
+		if p.ConfirmMoves {
+			v = appendVarint(v, 3, 1)
+		}
+		v = appendString(v, 4, p.Takebacks)
+		for _, tc := range p.TimeControls {
+			v = protowire.AppendTag(v, 5, protowire.BytesType)
+			v = protowire.AppendString(v, tc)
+		}
+		v = appendString(v, 6, p.TimeZone)
+		v = appendVarint(v, 7, int64(p.DailyGoal))
+		b = protowire.AppendTag(b, 45, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	if c := message.HeadToHead; c != nil {
+		v := appendVarint(nil, 1, int64(c.All))
+		v = appendVarint(v, 2, int64(c.Wins))
+		v = appendVarint(v, 3, int64(c.Draws))
+		v = appendVarint(v, 4, int64(c.Losses))
+		b = protowire.AppendTag(b, 49, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	b = appendVarint(b, 50, int64(message.Spectators))
+	b = appendVarint(b, 51, int64(message.Quick))
+	if r := message.Rules; r != nil {
+		v := appendString([]byte{}, 1, r.Variant)
+		v = appendString(v, 2, r.TimeControl)
+		// rated is optional, false is not the same as left out
+		if r.Rated != nil {
+			v = protowire.AppendTag(v, 3, protowire.VarintType)
+			v = protowire.AppendVarint(v, protowire.EncodeBool(*r.Rated))
+		}
+		v = appendString(v, 4, r.Color)
+		v = appendString(v, 5, r.FEN)
+		v = appendString(v, 6, r.Takebacks)
+		v = appendString(v, 7, r.Draws)
+		if r.Private {
+			v = appendVarint(v, 8, 1)
+		}
+		if r.Blindfold {
+			v = appendVarint(v, 9, 1)
+		}
+		b = protowire.AppendTag(b, 52, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	for _, s := range message.Seeks {
+		v := appendString([]byte{}, 1, s.ID)
+		v = appendString(v, 2, s.Player)
+		v = appendVarint(v, 3, int64(s.Rating))
+		v = appendString(v, 4, s.Pool)
+		if tc := s.TimeControl; tc != nil {
+			t := appendVarint([]byte{}, 1, tc.InitialMs)
+			t = appendVarint(t, 2, tc.IncrementMs)
+			v = protowire.AppendTag(v, 5, protowire.BytesType)
+			v = protowire.AppendBytes(v, t)
+		}
+		v = appendVarint(v, 6, int64(s.Band.Min))
+		v = appendVarint(v, 7, int64(s.Band.Max))
+		v = appendString(v, 8, s.Color)
+		b = protowire.AppendTag(b, 53, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	for color, player := range message.Players {
+		v := appendString([]byte{}, 1, color)
+		v = appendString(v, 2, player)
+		b = protowire.AppendTag(b, 54, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	b = appendString(b, 55, message.BracketID)
+	if m := message.BracketMatch; m != nil {
+		v := appendVarint([]byte{}, 1, int64(m.ID))
+		v = appendString(v, 2, m.Section)
+		v = appendVarint(v, 3, int64(m.Round))
+		// players are repeated as they are, empty for those not known
+		for _, player := range m.Players {
+			v = protowire.AppendTag(v, 4, protowire.BytesType)
+			v = protowire.AppendString(v, player)
+		}
+		for _, game := range m.Games {
+			v = appendString(v, 5, game)
+		}
+		if m.Decided {
+			v = appendVarint(v, 6, 1)
+		}
+		v = appendString(v, 7, m.Winner)
+		if m.Bye {
+			v = appendVarint(v, 8, 1)
+		}
+		b = protowire.AppendTag(b, 56, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	if c := message.Chat; c != nil {
+		v := appendVarint([]byte{}, 1, int64(c.ID))
+		v = appendVarint(v, 2, int64(c.Parent))
+		v = appendString(v, 3, c.Author)
+		v = appendString(v, 4, c.Text)
+		if !c.CreatedAt.IsZero() {
+			v = appendVarint(v, 5, c.CreatedAt.UnixMilli())
+		}
+		if c.Removed {
+			v = appendVarint(v, 6, 1)
+		}
+		b = protowire.AppendTag(b, 57, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	if n := message.Notification; n != nil {
+		v := appendString([]byte{}, 1, n.ID)
+		v = appendString(v, 2, n.Kind)
+		v = appendString(v, 3, n.Game)
+		v = appendString(v, 4, n.Bracket)
+		v = appendString(v, 5, n.Achievement)
+		if !n.CreatedAt.IsZero() {
+			v = appendVarint(v, 6, n.CreatedAt.UnixMilli())
+		}
+		if n.Read {
+			v = appendVarint(v, 7, 1)
+		}
+		b = protowire.AppendTag(b, 58, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	b = appendVarint(b, 59, int64(message.Unread))
+	b = appendString(b, 60, message.URL)
+	for _, arg := range message.Args {
+		b = protowire.AppendTag(b, 18, protowire.BytesType)
+		b = protowire.AppendString(b, arg)
+	}
+	return websocket.BinaryMessage, b, nil
+}
+
+func (protobufCodec) Decode(data []byte) (Message, error) {
+	message := Message{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 2:
+				message.Seq = int(v)
+			case 3:
+				message.Version = int(v)
+			case 14:
+				message.ServerTime = int64(v)
+			case 15:
+				message.ClientTime = int64(v)
+			case 22:
+				message.WhiteTime = int64(v)
+			case 23:
+				message.BlackTime = int64(v)
+			case 25:
+				message.Board = int(v)
+			case 31:
+				message.Deadline = int64(v)
+			case 32:
+				message.Blindfold = v != 0
+			case 46:
+				message.Rated = v != 0
+			case 33:
+				message.Ply = int(v)
+			case 35:
+				message.Rev = int(v)
+			case 36:
+				message.Node = int(v)
+			case 37:
+				message.Parent = int(v)
+			case 44:
+				message.NAGs = append(message.NAGs, int(v))
+			case 50:
+				message.Spectators = int(v)
+			case 51:
+				message.Quick = QuickMessage(v)
+			case 59:
+				message.Unread = int(v)
+			}
+			return n
+		case typ == protowire.BytesType && num == 12:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			move, err := decodeMove(v)
+			if err != nil {
+				return -1
+			}
+			message.Moves = append(message.Moves, move)
+			return n
+		case typ == protowire.BytesType && num == 30:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			tally, err := decodeVoteTally(v)
+			if err != nil {
+				return -1
+			}
+			message.Votes = append(message.Votes, tally)
+			return n
+		case typ == protowire.BytesType && num == 39:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			node, err := decodeBoardNode(v)
+			if err != nil {
+				return -1
+			}
+			message.Nodes = append(message.Nodes, node)
+			return n
+		case typ == protowire.BytesType && num == 41:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			member, err := decodeBoardMember(v)
+			if err != nil {
+				return -1
+			}
+			message.Members = append(message.Members, member)
+			return n
+		case typ == protowire.BytesType && num == 45:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			if message.Preferences == nil {
+				message.Preferences = &Preferences{}
+			}
+			if decodePreferences(v, message.Preferences) != nil {
+				return -1
+			}
+			return n
+		case typ == protowire.BytesType && num == 49:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			if message.HeadToHead == nil {
+				message.HeadToHead = &gameCount{}
+			}
+			if decodeGameCount(v, message.HeadToHead) != nil {
+				return -1
+			}
+			return n
+		case typ == protowire.BytesType && num == 53:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			s, err := decodeSeek(v)
+			if err != nil {
+				return -1
+			}
+			message.Seeks = append(message.Seeks, s)
+			return n
+		case typ == protowire.BytesType && num == 56:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			m, err := decodeBracketMatch(v)
+			if err != nil {
+				return -1
+			}
+			message.BracketMatch = &m
+			return n
+		case typ == protowire.BytesType && num == 57:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			c, err := decodeChat(v)
+			if err != nil {
+				return -1
+			}
+			message.Chat = &c
+			return n
+		case typ == protowire.BytesType && num == 58:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			notification, err := decodeNotification(v)
+			if err != nil {
+				return -1
+			}
+			message.Notification = &notification
+			return n
+		case typ == protowire.BytesType && num == 54:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			color, player, err := decodeMapEntry(v)
+			if err != nil {
+				return -1
+			}
+			if message.Players == nil {
+				message.Players = map[string]string{}
+			}
+			message.Players[color] = player
+			return n
+		case typ == protowire.BytesType && num == 52:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			if message.Rules == nil {
+				message.Rules = &GameOptions{}
+			}
+			if decodeGameOptions(v, message.Rules) != nil {
+				return -1
+			}
+			return n
+		case typ == protowire.BytesType && num == 18:
+			v, n := protowire.ConsumeString(b)
+			if n >= 0 {
+				message.Args = append(message.Args, v)
+			}
+			return n
+		case typ == protowire.BytesType && num == 43:
+			v, n := protowire.ConsumeString(b)
+			if n >= 0 {
+				message.Arrows = append(message.Arrows, v)
+			}
+			return n
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			if field := messageStringField(&message, num); field != nil {
+				*field = v
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	return message, err
+}
+
+func messageStringField(message *Message, num protowire.Number) *string {
+	switch num {
+	case 1:
+		return &message.Type
+	case 4:
+		return &message.Code
+	case 5:
+		return &message.Text
+	case 6:
+		return &message.GameID
+	case 7:
+		return &message.Token
+	case 8:
+		return &message.Color
+	case 9:
+		return &message.From
+	case 10:
+		return &message.To
+	case 11:
+		return &message.Promotion
+	case 13:
+		return &message.MoveID
+	case 16:
+		return &message.Field
+	case 17:
+		return &message.Key
+	case 19:
+		return &message.Result
+	case 20:
+		return &message.Reason
+	case 21:
+		return &message.Slug
+	case 24:
+		return &message.SimulID
+	case 47:
+		return &message.MatchID
+	case 48:
+		return &message.Score
+	case 26:
+		return &message.Drop
+	case 27:
+		return &message.Variant
+	case 28:
+		return &message.Role
+	case 29:
+		return &message.Piece
+	case 34:
+		return &message.BoardID
+	case 38:
+		return &message.FEN
+	case 40:
+		return &message.Participant
+	case 42:
+		return &message.Comment
+	case 55:
+		return &message.BracketID
+	case 60:
+		return &message.URL
+	}
+	return nil
+}
+
+func decodeMove(data []byte) (Move, error) {
+	move := Move{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if typ == protowire.VarintType && num == 5 {
+			v, n := protowire.ConsumeVarint(b)
+			move.SpentMs = int64(v)
+			return n
+		}
+		if typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b)
+		}
+		v, n := protowire.ConsumeString(b)
+		switch num {
+		case 1:
+			move.ID = v
+		case 2:
+			move.From = v
+		case 3:
+			move.To = v
+		case 4:
+			move.Promotion = v
+		case 6:
+			move.Drop = v
+		}
+		return n
+	})
+	return move, err
+}
+
+func decodeVoteTally(data []byte) (VoteTally, error) {
+	tally := VoteTally{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType && num == 2:
+			v, n := protowire.ConsumeVarint(b)
+			tally.Count = int(v)
+			return n
+		case typ == protowire.BytesType && num == 1:
+			v, n := protowire.ConsumeString(b)
+			tally.Move = v
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	return tally, err
+}
+
+// decodeGameCount merges the counts in data into c
+func decodeGameCount(data []byte, c *gameCount) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if typ == protowire.VarintType && num >= 1 && num <= 4 {
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 1:
+				c.All = int(v)
+			case 2:
+				c.Wins = int(v)
+			case 3:
+				c.Draws = int(v)
+			case 4:
+				c.Losses = int(v)
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+func decodeBoardNode(data []byte) (BoardNode, error) {
+	node := BoardNode{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType && (num == 1 || num == 2 || num == 7):
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 1:
+				node.ID = int(v)
+			case 2:
+				node.Parent = int(v)
+			case 7:
+				node.NAGs = append(node.NAGs, int(v))
+			}
+			return n
+		case typ == protowire.BytesType && num >= 3 && num <= 6:
+			v, n := protowire.ConsumeString(b)
+			switch {
+			case n < 0:
+			case num == 3:
+				node.Move = v
+			case num == 4:
+				node.SAN = v
+			case num == 5:
+				node.Comment = v
+			case num == 6:
+				node.Arrows = append(node.Arrows, v)
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	return node, err
+}
+
+func decodeBoardMember(data []byte) (BoardMember, error) {
+	member := BoardMember{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b)
+		}
+		v, n := protowire.ConsumeString(b)
+		switch num {
+		case 1:
+			member.ID = v
+		case 2:
+			member.Role = v
+		}
+		return n
+	})
+	return member, err
+}
+
+// decodePreferences merges those in data into p, as protobuf merges
+// a message sent more than once
+func decodePreferences(data []byte, p *Preferences) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType && (num >= 1 && num <= 3 || num == 7):
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 1:
+				p.AutoQueen = v != 0
+			case 2:
+				p.Premove = v != 0
+			case 3:
+				p.ConfirmMoves = v != 0
+			case 7:
+				p.DailyGoal = int(v)
+			}
+			return n
+		case typ == protowire.BytesType && num >= 4 && num <= 6:
+			v, n := protowire.ConsumeString(b)
+			switch {
+			case n < 0:
+			case num == 4:
+				p.Takebacks = v
+			case num == 5:
+				p.TimeControls = append(p.TimeControls, v)
+			case num == 6:
+				p.TimeZone = v
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// decodeGameOptions merges those in data into options, as decodePreferences
+func decodeGameOptions(data []byte, options *GameOptions) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType && (num == 3 || num == 8 || num == 9):
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 3:
+				rated := v != 0
+				options.Rated = &rated
+			case 8:
+				options.Private = v != 0
+			case 9:
+				options.Blindfold = v != 0
+			}
+			return n
+		case typ == protowire.BytesType && num >= 1 && num <= 7 && num != 3:
+			v, n := protowire.ConsumeString(b)
+			switch {
+			case n < 0:
+			case num == 1:
+				options.Variant = v
+			case num == 2:
+				options.TimeControl = v
+			case num == 4:
+				options.Color = v
+			case num == 5:
+				options.FEN = v
+			case num == 6:
+				options.Takebacks = v
+			case num == 7:
+				options.Draws = v
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+func decodeSeek(data []byte) (seek, error) {
+	s := seek{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 3:
+				s.Rating = int(v)
+			case 6:
+				s.Band.Min = int(v)
+			case 7:
+				s.Band.Max = int(v)
+			}
+			return n
+		case typ == protowire.BytesType && num == 5:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			if s.TimeControl == nil {
+				s.TimeControl = &TimeControl{}
+			}
+			err := consumeFields(v, func(num protowire.Number, typ protowire.Type, b []byte) int {
+				if typ != protowire.VarintType {
+					return protowire.ConsumeFieldValue(num, typ, b)
+				}
+				v, n := protowire.ConsumeVarint(b)
+				switch num {
+				case 1:
+					s.TimeControl.InitialMs = int64(v)
+				case 2:
+					s.TimeControl.IncrementMs = int64(v)
+				}
+				return n
+			})
+			if err != nil {
+				return -1
+			}
+			return n
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			switch num {
+			case 1:
+				s.ID = v
+			case 2:
+				s.Player = v
+			case 4:
+				s.Pool = v
+			case 8:
+				s.Color = v
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	return s, err
+}
+
+func decodeBracketMatch(data []byte) (bracketMatch, error) {
+	m := bracketMatch{Players: []string{}, Games: []string{}}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 1:
+				m.ID = int(v)
+			case 3:
+				m.Round = int(v)
+			case 6:
+				m.Decided = v != 0
+			case 8:
+				m.Bye = v != 0
+			}
+			return n
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			switch num {
+			case 2:
+				m.Section = v
+			case 4:
+				m.Players = append(m.Players, v)
+			case 5:
+				m.Games = append(m.Games, v)
+			case 7:
+				m.Winner = v
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	return m, err
+}
+
+func decodeChat(data []byte) (Comment, error) {
+	c := Comment{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 1:
+				c.ID = int(v)
+			case 2:
+				c.Parent = int(v)
+			case 5:
+				// the zero time is left out as it is encoded
+				if t := time.UnixMilli(int64(v)).UTC(); !t.IsZero() {
+					c.CreatedAt = t
+				}
+			case 6:
+				c.Removed = v != 0
+			}
+			return n
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			switch num {
+			case 3:
+				c.Author = v
+			case 4:
+				c.Text = v
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	return c, err
+}
+
+func decodeNotification(data []byte) (Notification, error) {
+	notification := Notification{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 6:
+				// the zero time is left out as it is encoded
+				if t := time.UnixMilli(int64(v)).UTC(); !t.IsZero() {
+					notification.CreatedAt = t
+				}
+			case 7:
+				notification.Read = v != 0
+			}
+			return n
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			switch num {
+			case 1:
+				notification.ID = v
+			case 2:
+				notification.Kind = v
+			case 3:
+				notification.Game = v
+			case 4:
+				notification.Bracket = v
+			case 5:
+				notification.Achievement = v
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	return notification, err
+}
+
+// decodeMapEntry is the key and value of an entry of a map of strings
+func decodeMapEntry(data []byte) (key, value string, err error) {
+	err = consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b)
+		}
+		v, n := protowire.ConsumeString(b)
+		switch num {
+		case 1:
+			key = v
+		case 2:
+			value = v
+		}
+		return n
+	})
+	return key, value, err
+}
+
+// consumeFields calls field for every field in data, field consumes its value
+// and returns its length in bytes, or a negative number if it is malformed
+func consumeFields(data []byte, field func(num protowire.Number, typ protowire.Type, b []byte) int) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errMalformedProtobuf
+		}
+		data = data[n:]
+		n = field(num, typ, data)
+		if n < 0 {
+			return errMalformedProtobuf
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// decoding whatever a client sends must never panic, and what decodes
+// has to survive another trip through the codec unchanged
+func fuzzCodec(f *testing.F, c codec, seeds ...[]byte) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		message, err := c.Decode(data)
+		if err != nil {
+			return
+		}
+		validateMessage(message)
+		_, encoded, err := c.Encode(nil, message)
+		if err != nil {
+			t.Fatalf("encoding %+v: %v", message, err)
+		}
+		again, err := c.Decode(encoded)
+		if err != nil {
+			t.Fatalf("decoding %q: %v", encoded, err)
+		}
+		if !reflect.DeepEqual(normalized(message), normalized(again)) {
+			t.Fatalf("round trip changed %+v into %+v", message, again)
+		}
+	})
+}
+
+// normalized treats empty and nil slices alike, neither codec tells them apart
+func normalized(message Message) Message {
+	if len(message.Moves) == 0 {
+		message.Moves = nil
+	}
+	if len(message.Args) == 0 {
+		message.Args = nil
+	}
+	if len(message.Votes) == 0 {
+		message.Votes = nil
+	}
+	if len(message.Nodes) == 0 {
+		message.Nodes = nil
+	}
+	if len(message.Members) == 0 {
+		message.Members = nil
+	}
+	if len(message.Arrows) == 0 {
+		message.Arrows = nil
+	}
+	if len(message.NAGs) == 0 {
+		message.NAGs = nil
+	}
+	if len(message.Seeks) == 0 {
+		message.Seeks = nil
+	}
+	if len(message.Players) == 0 {
+		message.Players = nil
+	}
+	if m := message.BracketMatch; m != nil {
+		match := *m
+		if len(match.Players) == 0 {
+			match.Players = nil
+		}
+		if len(match.Games) == 0 {
+			match.Games = nil
+		}
+		message.BracketMatch = &match
+	}
+	if message.Preferences != nil && len(message.Preferences.TimeControls) == 0 {
+		preferences := *message.Preferences
+		preferences.TimeControls = nil
+		message.Preferences = &preferences
+	}
+	for i, node := range message.Nodes {
+		if len(node.Arrows) == 0 {
+			message.Nodes[i].Arrows = nil
+		}
+		if len(node.NAGs) == 0 {
+			message.Nodes[i].NAGs = nil
+		}
+	}
+	return message
+}
+
+func FuzzJSONCodec(f *testing.F) {
+	fuzzCodec(f, jsonCodec{},
+		[]byte(`{"type":"move","from":"e2","to":"e4","moveId":"1"}`),
+		[]byte(`{"type":"ack","seq":3}`),
+		[]byte(`{"type":"resume","moves":[{"from":"e2","to":"e4"}],"args":["a"]}`),
+		[]byte(`{"type":"clock_sync","clientTime":1700000000000}`),
+	)
+}
+
+func FuzzProtobufCodec(f *testing.F) {
+	var seeds [][]byte
+	for _, message := range []Message{
+		{Type: "move", From: "e2", To: "e4", Promotion: "q", MoveID: "1"},
+		{Type: "ack", Seq: 3},
+		{Type: "resume", Moves: []Move{{From: "e2", To: "e4"}}, Args: []string{"a"}},
+		{Type: "start", Rules: &GameOptions{TimeControl: "5m+3s", Rated: new(bool), Draws: "never"}},
+		{Type: "lobby", Seeks: []seek{{ID: "g", Pool: "blitz", TimeControl: &TimeControl{InitialMs: 300000}, Band: ratingBand{Min: 1400}}}},
+		{Type: "game_started", GameID: "g", Players: map[string]string{"white": "ana"}},
+		{Type: "bracket_chat", BracketID: "b", Chat: &Comment{ID: 2, Parent: 1, Author: "ana", Text: "good luck", CreatedAt: time.UnixMilli(1700000000000).UTC()}},
+		{Type: "redirect", GameID: "g", URL: "wss://eu.chess.example.com/ws?game=g"},
+		{Type: "notification", Unread: 2, Notification: &Notification{ID: "n", Kind: notificationYourMove, Game: "g", CreatedAt: time.UnixMilli(1700000000000).UTC(), Read: true}},
+		{Type: "bracket_match", BracketID: "b", BracketMatch: &bracketMatch{ID: 3, Section: "losers", Round: 2, Players: []string{"", "ana"}, Games: []string{"g"}, Decided: true, Winner: "ana", Bye: true}},
+	} {
+		_, data, _ := protobufCodec{}.Encode(nil, message)
+		seeds = append(seeds, data)
+	}
+	fuzzCodec(f, protobufCodec{}, seeds...)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxComments bounds the comments on a game, maxAuthorLength the name
+// they are signed with
+const (
+	maxComments     = 1000
+	maxAuthorLength = 40
+)
+
+// Comment is left on a game once it is over, in reply to the comment Parent
+// if any. Its author is who holds its token, the only one who can remove
+// it besides the admins; removed comments keep their place in the thread
+type Comment struct {
+	ID        int       `json:"id"`
+	Parent    int       `json:"parent,omitempty"`
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+	Removed   bool      `json:"removed,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	// Kibitz is a comment of a spectator left while the game was played,
+	// see kibitzHandler
+	Kibitz bool `json:"kibitz,omitempty"`
+	// Poster is the client who left it as rateClient tells it, and
+	// Shadowed whether it was shadow muted then; neither is published
+	Poster   string `json:"poster,omitempty"`
+	Shadowed bool   `json:"shadowed,omitempty"`
+}
+
+// CommentHook moderates a comment before it is published: it may change it
+// or refuse it with an error shown to its author
+type CommentHook func(game string, comment *Comment) error
+
+// commentHooks run in order on every new comment
+var commentHooks []CommentHook
+
+type CommentStore interface {
+	// Load is the comments on game in the order they were left, none if
+	// there are no comments on it
+	Load(game string) ([]Comment, error)
+	// Update saves the comments on game as change leaves them, unless
+	// change fails
+	Update(game string, change func(*[]Comment) error) error
+}
+
+var comments CommentStore = newMemoryCommentStore()
+
+func newCommentStore(dataDir string) (CommentStore, error) {
+	if dataDir == "" {
+		return newMemoryCommentStore(), nil
+	}
+	return newFileCommentStore(filepath.Join(dataDir, "comments"))
+}
+
+type memoryCommentStore struct {
+	mu       sync.Mutex
+	comments map[string][]Comment
+}
+
+func newMemoryCommentStore() *memoryCommentStore {
+	return &memoryCommentStore{comments: map[string][]Comment{}}
+}
+
+func (s *memoryCommentStore) Load(game string) ([]Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Comment{}, s.comments[game]...), nil
+}
+
+func (s *memoryCommentStore) Update(game string, change func(*[]Comment) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := append([]Comment{}, s.comments[game]...)
+	if err := change(&list); err != nil {
+		return err
+	}
+	s.comments[game] = list
+	return nil
+}
+
+// fileCommentStore keeps the comments on a game in a JSON file of its own
+type fileCommentStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newFileCommentStore(dir string) (*fileCommentStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileCommentStore{dir: dir}, nil
+}
+
+func (s *fileCommentStore) path(game string) string {
+	return filepath.Join(s.dir, game+".json")
+}
+
+func (s *fileCommentStore) Load(game string) ([]Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(game)
+}
+
+func (s *fileCommentStore) load(game string) ([]Comment, error) {
+	if filepath.Base(game) != game {
+		return nil, ErrGameNotFound
+	}
+	data, err := os.ReadFile(s.path(game))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Comment{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := []Comment{}
+	err = json.Unmarshal(data, &list)
+	return list, err
+}
+
+func (s *fileCommentStore) Update(game string, change func(*[]Comment) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load(game)
+	if err != nil {
+		return err
+	}
+	if err := change(&list); err != nil {
+		return err
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(game) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(game))
+}
+
+// publicComments are comments as anyone reads them, without their tokens
+// or posters and with nothing left of those removed
+func publicComments(list []Comment) []Comment {
+	for i := range list {
+		list[i].Token, list[i].Poster, list[i].Shadowed = "", "", false
+		if list[i].Removed {
+			list[i].Author, list[i].Text = "", ""
+		}
+	}
+	return list
+}
+
+type commentRequest struct {
+	Author string `json:"author"`
+	Text   string `json:"text"`
+	Parent int    `json:"parent,omitempty"`
+}
+
+var (
+	errGameNotOver     = errors.New("games are commented on once they are over")
+	errInvalidParent   = errors.New("there is no such comment to reply to")
+	errTooManyComments = fmt.Errorf("a game has %d comments at most", maxComments)
+	errCommentNotFound = errors.New("there is no such comment")
+	errNotCommentOwner = errors.New("the token is not that of the comment")
+)
+
+// postCommentHandler leaves a comment posted as a commentRequest on a game
+// that is over, answering it with its token
+func postCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if isBanned(r) {
+		http.Error(w, ErrBanned.Error(), http.StatusForbidden)
+		return
+	}
+	state, _, ok := loadWatchedEvents(w, r)
+	if !ok {
+		return
+	}
+	if !state.Finished {
+		http.Error(w, errGameNotOver.Error(), http.StatusConflict)
+		return
+	}
+	comment, ok := readComment(w, r, state.ID)
+	if ok && addComment(w, state.ID, &comment) {
+		writeJSON(w, postedComment(comment))
+	}
+}
+
+// postedComment is comment as its author is answered with, public but for
+// its token
+func postedComment(comment Comment) Comment {
+	token := comment.Token
+	comment = publicComments([]Comment{comment})[0]
+	comment.Token = token
+	return comment
+}
+
+// readComment is the comment on game posted as a commentRequest, as the
+// comment hooks leave it, or answers why there is none
+func readComment(w http.ResponseWriter, r *http.Request, game string) (Comment, bool) {
+	var req commentRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*maxCommentLength)).Decode(&req); err != nil {
+		http.Error(w, "invalid comment", http.StatusBadRequest)
+		return Comment{}, false
+	}
+	req.Author, req.Text = strings.TrimSpace(req.Author), strings.TrimSpace(req.Text)
+	if req.Author == "" || len(req.Author) > maxAuthorLength || req.Text == "" || len(req.Text) > maxCommentLength {
+		http.Error(w, fmt.Sprintf("comments are signed with up to %d bytes and have up to %d", maxAuthorLength, maxCommentLength), http.StatusBadRequest)
+		return Comment{}, false
+	}
+	comment := Comment{Parent: req.Parent, Author: req.Author, Text: req.Text, CreatedAt: time.Now().UTC(), Token: newToken(), Poster: rateClient(r), Shadowed: isShadowMuted(r)}
+	for _, hook := range commentHooks {
+		if err := hook(game, &comment); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return Comment{}, false
+		}
+	}
+	return comment, true
+}
+
+// addComment appends comment to those on game, numbering it, or answers
+// why it cannot
+func addComment(w http.ResponseWriter, game string, comment *Comment) bool {
+	err := comments.Update(game, func(list *[]Comment) error {
+		if len(*list) >= maxComments {
+			return errTooManyComments
+		}
+		if comment.Parent < 0 || comment.Parent > len(*list) {
+			return errInvalidParent
+		}
+		comment.ID = len(*list) + 1
+		*list = append(*list, *comment)
+		return nil
+	})
+	switch {
+	case errors.Is(err, errTooManyComments), errors.Is(err, errInvalidParent):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// deleteCommentHandler removes a comment for its author, who authenticates
+// with the token of the comment as a bearer token
+func deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	removeComment(w, r, r.PathValue("id"), byAuthor(r))
+}
+
+// moderateCommentHandler removes any comment, for the admins
+func moderateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	removeComment(w, r, r.PathValue("id"), func(Comment) bool { return true })
+}
+
+// byAuthor reports whether r is authenticated with the token of comment
+func byAuthor(r *http.Request) func(comment Comment) bool {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return func(comment Comment) bool {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(comment.Token)) == 1
+	}
+}
+
+// removeComment removes the comment of r from those on game, if allowed,
+// reporting whether it did
+func removeComment(w http.ResponseWriter, r *http.Request, game string, allowed func(Comment) bool) bool {
+	id, err := strconv.Atoi(r.PathValue("comment"))
+	if err != nil {
+		http.NotFound(w, r)
+		return false
+	}
+	err = comments.Update(game, func(list *[]Comment) error {
+		if id < 1 || id > len(*list) {
+			return errCommentNotFound
+		}
+		comment := &(*list)[id-1]
+		if !allowed(*comment) {
+			return errNotCommentOwner
+		}
+		comment.Removed = true
+		return nil
+	})
+	switch {
+	case errors.Is(err, errCommentNotFound), errors.Is(err, ErrGameNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, errNotCommentOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestComments(t *testing.T) {
+	defer func(s CommentStore) { comments = s }(comments)
+	var err error
+	if comments, err = newCommentStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func(hooks []CommentHook) { commentHooks = hooks }(commentHooks)
+	commentHooks = []CommentHook{func(game string, comment *Comment) error {
+		if strings.Contains(comment.Text, "spam") {
+			return errors.New("no spam")
+		}
+		return nil
+	}}
+
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	post := func(body string) (int, Comment) {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("POST", "/games/"+game.id+"/comments", strings.NewReader(body)))
+		comment := Comment{}
+		json.Unmarshal(w.Body.Bytes(), &comment)
+		return w.Code, comment
+	}
+	if code, _ := post(`{"author":"ana","text":"too early"}`); code != http.StatusConflict {
+		t.Errorf("got %d while the game goes on", code)
+	}
+	white.send(Message{Type: "resign"})
+	black.expect("game_over")
+	waitFor(t, func() bool { return game.recorder.State().Finished })
+
+	code, first := post(`{"author":"ana","text":"1. e4 and out"}`)
+	if code != http.StatusOK || first.ID != 1 || first.Token == "" {
+		t.Fatalf("got %d %+v", code, first)
+	}
+	if code, reply := post(`{"author":"bo","text":"fair","parent":1}`); code != http.StatusOK || reply.Parent != 1 {
+		t.Fatalf("got %d %+v", code, reply)
+	}
+	if code, _ := post(`{"author":"bo","text":"spam"}`); code != http.StatusForbidden {
+		t.Errorf("got %d for spam", code)
+	}
+	if code, _ := post(`{"author":"bo","text":"lost","parent":7}`); code != http.StatusBadRequest {
+		t.Errorf("got %d replying to nothing", code)
+	}
+
+	remove := func(id, token string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("DELETE", "/games/"+game.id+"/comments/"+id, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		newPublicMux().ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := remove("2", first.Token); code != http.StatusForbidden {
+		t.Errorf("got %d removing a comment of somebody else", code)
+	}
+	if code := remove("1", first.Token); code != http.StatusNoContent {
+		t.Errorf("got %d removing a comment of its own", code)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("DELETE", "/games/"+game.id+"/comments/2", nil)
+	r.Header.Set("Authorization", "Bearer admin")
+	newAdminMux("admin").ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("got %d moderating", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/games/"+game.id+"/json", nil))
+	doc := gameDocument{}
+	json.Unmarshal(w.Body.Bytes(), &doc)
+	if len(doc.Comments) != 2 || !doc.Comments[0].Removed || doc.Comments[0].Text != "" || doc.Comments[1].Token != "" || doc.Comments[1].Parent != 1 {
+		t.Errorf("got %+v", doc.Comments)
+	}
+}
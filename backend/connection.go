@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sendQueueSize bounds the messages waiting to be written to a connection,
+// a client that lets more pile up cannot keep up with its game
+const sendQueueSize = 64
+
+var errSlowClient = errors.New("client too slow")
+
+// connection is a client transport together with what was negotiated for it
+type connection struct {
+	transport transport
+	version   int
+	codec     codec
+	// lang is the language of the texts sent over the connection
+	lang string
+	// options are the rules asked for the game of the connection; private
+	// games are watched only by those given a spectator token, and the
+	// player of a blindfold connection is not sent the position, only the
+	// moves as they are made
+	options GameOptions
+	// level is the level of the engine asked to play against, if any
+	level string
+	// band is the ratings of the opponents accepted
+	band ratingBand
+
+	// player is the account the connection authenticated as, if any,
+	// preferences those of the player; client is player:ID for them,
+	// ip:address for guests, as rateClient tells
+	player      string
+	preferences *Preferences
+	client      string
+
+	// recording and color are set once the connection plays in a game,
+	// and seated as well, for the reaper to tell
+	recording *sessionRecording
+	color     string
+	seated    atomic.Bool
+	// active is when the client last sent a message, in Unix nanoseconds
+	active atomic.Int64
+
+	// queue holds what the writer goroutine has yet to write, the only
+	// one writing to the transport, so writing never blocks whoever sends
+	// a message and frames are never written concurrently
+	queue     chan outgoing
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// outgoing is a message to write, or the request to close the connection
+// once the messages before it are written
+type outgoing struct {
+	message Message
+	close   bool
+	reason  string
+	// queued is when the message was, for the latency of moves
+	queued time.Time
+}
+
+func newConnection(t transport, version int, codec codec, lang string) *connection {
+	conn := &connection{
+		transport: t,
+		version:   version,
+		codec:     codec,
+		lang:      lang,
+		queue:     make(chan outgoing, sendQueueSize),
+		closed:    make(chan struct{}),
+	}
+	conn.active.Store(time.Now().UnixNano())
+	openConnections.Add(1)
+	trackConnection(conn)
+	go conn.writeQueued()
+	return conn
+}
+
+// Write queues message for the client. When the queue is full transient
+// messages, those without a sequence number, are dropped; any other closes
+// the connection, the client can resume and get what it missed
+func (conn *connection) Write(message Message) error {
+	select {
+	case <-conn.closed:
+		return errTransportClosed
+	default:
+	}
+	select {
+	case conn.queue <- outgoing{message: message, queued: time.Now()}:
+		return nil
+	default:
+	}
+	if message.Seq == 0 {
+		return nil
+	}
+	conn.abort(errSlowClient.Error())
+	return errSlowClient
+}
+
+func (conn *connection) writeQueued() {
+	// a nil channel never delivers, transports that need no pings get none
+	var pings <-chan time.Time
+	p, ok := conn.transport.(pinger)
+	if ok {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+	for {
+		select {
+		case <-pings:
+			p.Ping()
+		case out := <-conn.queue:
+			if !conn.writeOutgoing(out) {
+				return
+			}
+		case <-conn.closed:
+			// a close request was queued last, unless the connection was aborted
+			for {
+				select {
+				case out := <-conn.queue:
+					if !conn.writeOutgoing(out) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeOutgoing reports whether the writer goes on
+func (conn *connection) writeOutgoing(out outgoing) bool {
+	if out.close {
+		conn.transport.Close(out.reason)
+		return false
+	}
+	err := conn.write(out.message)
+	if err == nil && out.message.Type == "move" {
+		moveWrite.since(out.queued)
+	}
+	return !errors.Is(err, errTransportClosed)
+}
+
+// frameBuffers are reused to encode the frames written,
+// those grown too much for a usual message are let go
+var frameBuffers = sync.Pool{New: func() any { return new([]byte) }}
+
+const maxPooledFrameSize = 4 << 10
+
+func (conn *connection) write(message Message) error {
+	if message.Key != "" {
+		message.Text = localize(conn.lang, message.Key, message.Args)
+	}
+	if conn.recording != nil {
+		// a copy, so that message itself does not escape
+		recorded := message
+		conn.recording.record(conn.color, "out", &recorded)
+	}
+	buf := frameBuffers.Get().(*[]byte)
+	frameType, data, err := conn.codec.Encode((*buf)[:0], message)
+	if err == nil {
+		err = conn.transport.WriteFrame(frameType, data)
+	}
+	if cap(data) <= maxPooledFrameSize {
+		*buf = data[:0]
+		frameBuffers.Put(buf)
+	}
+	return err
+}
+
+func (conn *connection) Read() (Message, error) {
+	data, err := conn.transport.ReadFrame()
+	if err != nil {
+		conn.recording.record(conn.color, "disconnect", nil)
+		return Message{}, err
+	}
+	conn.active.Store(time.Now().UnixNano())
+	message, err := conn.codec.Decode(data)
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	conn.recording.record(conn.color, "in", &message)
+	return message, nil
+}
+
+// Close ends the connection once the messages queued so far are written,
+// telling the client why if reason is not empty
+func (conn *connection) Close(reason string) {
+	conn.closeOnce.Do(func() {
+		openConnections.Add(-1)
+		untrackConnection(conn)
+		select {
+		case conn.queue <- outgoing{close: true, reason: reason}:
+			close(conn.closed)
+		default:
+			// the client stopped reading, there is no point in waiting for it
+			close(conn.closed)
+			go conn.transport.Close(reason)
+		}
+	})
+}
+
+// abort ends the connection right away, whatever is still queued
+func (conn *connection) abort(reason string) {
+	conn.closeOnce.Do(func() {
+		openConnections.Add(-1)
+		untrackConnection(conn)
+		close(conn.closed)
+		// closing may wait for the frame being written
+		go conn.transport.Close(reason)
+	})
+}
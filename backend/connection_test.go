@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlowClientIsDisconnected(t *testing.T) {
+	game, white, black := startTestGame(t)
+
+	// black keeps playing but never reads what it is sent, the knights
+	// going back and forth
+	whiteMoves := [][2]string{{"g1", "f3"}, {"f3", "g1"}}
+	blackMoves := [][2]string{{"g8", "f6"}, {"f6", "g8"}}
+	for i := 0; !black.closed(); i++ {
+		if i == 4*sendQueueSize {
+			t.Fatal("black was never disconnected")
+		}
+		w := whiteMoves[i%2]
+		white.send(move(fmt.Sprint("w", i), w[0], w[1]))
+		waitFor(t, func() bool { return len(game.recorder.State().Moves) == 2*i+1 })
+		if black.closed() {
+			break
+		}
+		b := blackMoves[i%2]
+		black.send(move(fmt.Sprint("b", i), b[0], b[1]))
+		white.expect("move")
+	}
+	if reason := <-black.transport.reason; reason != errSlowClient.Error() {
+		t.Fatalf("closed with %q", reason)
+	}
+	waitFor(t, func() bool {
+		game.mu.Lock()
+		defer game.mu.Unlock()
+		return !game.connected["black"]
+	})
+}
+
+func TestTransientMessagesAreDroppedForSlowClients(t *testing.T) {
+	player := newTestPlayer(t)
+	for i := 0; i < 4*sendQueueSize; i++ {
+		if err := player.conn.Write(Message{Type: "clock_sync"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if player.closed() {
+		t.Fatal("closed for transient messages")
+	}
+}
+
+func TestConnectionsBeyondTheLimitAreRefused(t *testing.T) {
+	// the connection stays open until the test is over
+	newTestPlayer(t)
+	maxConnections = 1
+	defer func() { maxConnections = 0 }()
+
+	transport := newMemTransport()
+	player := &testPlayer{t: t, transport: transport}
+	_, span := tracer.Start(context.Background(), "test")
+	admit(context.Background(), span, httptest.NewRequest("GET", "/ws", nil), transport)
+	player.expect("error", CodeServerFull)
+	if reason := <-transport.reason; reason != ErrServerFull.Error() {
+		t.Fatalf("closed with %q", reason)
+	}
+}
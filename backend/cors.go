@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// corsPolicy is which browser origins may call the public endpoints
+// from pages served elsewhere
+type corsPolicy struct {
+	// origins holds "*" when every origin is allowed
+	origins     []string
+	methods     string
+	headers     string
+	credentials bool
+	maxAge      int
+}
+
+// wrap answers the preflight requests and tells browsers which origins
+// may read the responses of next
+func (p corsPolicy) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		switch {
+		case slices.Contains(p.origins, "*") && !p.credentials:
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case slices.Contains(p.origins, origin):
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if p.credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		default:
+			// without the header the browser keeps the response from the page
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", p.methods)
+			w.Header().Set("Access-Control-Allow-Headers", p.headers)
+			if p.maxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(p.maxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// splitList reads a comma separated list, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	request := func(policy corsPolicy, method, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/poll", nil)
+		r.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		w := httptest.NewRecorder()
+		policy.wrap(ok).ServeHTTP(w, r)
+		return w
+	}
+
+	open := corsPolicy{origins: []string{"*"}, methods: "GET, POST", headers: "Content-Type"}
+	if got := request(open, "GET", "https://a.example").Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("any origin: got %q", got)
+	}
+	preflight := request(open, http.MethodOptions, "https://a.example")
+	if preflight.Code != http.StatusNoContent || preflight.Header().Get("Access-Control-Allow-Methods") != "GET, POST" {
+		t.Errorf("preflight: got %d %v", preflight.Code, preflight.Header())
+	}
+
+	listed := corsPolicy{origins: []string{"https://a.example"}, credentials: true}
+	w := request(listed, "GET", "https://a.example")
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://a.example" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("listed origin: got %v", w.Header())
+	}
+	if got := request(listed, "GET", "https://b.example").Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("other origin: got %q", got)
+	}
+}
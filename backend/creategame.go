@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CreateGame creates a standard game with options for players to join
+// later, each with the token of their seat as they resume a game: it waits
+// for both of them, however long it is left unattended, and starts once
+// they are in. Colors are those of the seats, options cannot ask for one
+func (m *gameManager) CreateGame(options GameOptions) (*ChessGame, error) {
+	id := newShardedGameID()
+	tokens := map[string]string{"white": newToken(), "black": newToken()}
+	tc, ok := options.clock()
+	if !ok {
+		tc = timeControl
+	}
+	recorder := newGameRecorder(id, newShortLink(id), tc, "")
+	recorder.state.FEN = options.FEN
+	game := newChessGame(games.ctx, id, recorder, tokens)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.canCreate(); err != nil {
+		game.cancel(nil)
+		return nil, err
+	}
+	game.options = options
+	game.recorder.Record(game.ctx, GameCreated, "", nil)
+	game.recorder.Record(game.ctx, GameReserved, "", nil)
+	game.recordRules(options, "")
+	if options.Private {
+		game.recorder.RecordSpectatorToken(game.ctx, "", newToken())
+	}
+	m.active[game.id] = game
+	m.unattend(game)
+	go superviseGame(game)
+	return game, nil
+}
+
+// takeSeat has conn take the seat of color in the reserved game, starting
+// it once both are taken; game.mu must be held
+func (game *ChessGame) takeSeat(color string, conn *connection) {
+	game.attach(color, conn)
+	if seated := game.recorder.State(); color == "white" && seated.White || color == "black" && seated.Black {
+		game.recorder.Record(game.ctx, PlayerReconnected, color, nil)
+	} else {
+		game.recorder.RecordJoin(game.ctx, color, conn.player)
+		if conn.options.Blindfold {
+			game.recorder.Record(game.ctx, PlayerBlindfolded, color, nil)
+		}
+	}
+	if game.connected["white"] && game.connected["black"] {
+		close(game.joined)
+	}
+	go game.forward(color, conn)
+}
+
+// checkCreated is check for the options of games created for players to
+// join later, which cannot ask for a variant or a color
+func (options GameOptions) checkCreated(player string) string {
+	field := options.check(player)
+	if field == "" && options.Variant != "" {
+		field = "variant"
+	}
+	if field == "" && options.Color != "" {
+		field = "color"
+	}
+	return field
+}
+
+// createdGame answers POST /games: the game, its rules and how to join it
+type createdGame struct {
+	ID    string       `json:"id"`
+	Slug  string       `json:"slug"`
+	Rules *GameOptions `json:"rules"`
+	White gameSeat     `json:"white"`
+	Black gameSeat     `json:"black"`
+	// SpectateURL is where it is watched, with SpectatorToken if private
+	SpectateURL    string `json:"spectateUrl"`
+	SpectatorToken string `json:"spectatorToken,omitempty"`
+}
+
+// gameSeat is the token a player resumes the game with and the URL of the
+// WebSocket they connect to with it
+type gameSeat struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// seat is the seat of color in game, as its player is handed it
+func (game *ChessGame) seat(color string) gameSeat {
+	ws := strings.TrimSuffix(publicURL, "/")
+	if rest, ok := strings.CutPrefix(ws, "http"); ok {
+		ws = "ws" + rest
+	}
+	token := game.tokens[color]
+	return gameSeat{Token: token, URL: ws + "/ws?" + url.Values{"game": {game.id}, "token": {token}}.Encode()}
+}
+
+// createGameHandler creates the game with the options posted for the
+// player authenticated to hand out, as a bot, a tournament or another
+// site would, see CreateGame
+func createGameHandler(w http.ResponseWriter, r *http.Request) {
+	player, err := requestPlayer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	options := GameOptions{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&options); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if field := options.checkCreated(player.ID); field != "" {
+		http.Error(w, ErrInvalidGameOptions.Error()+": "+field, http.StatusBadRequest)
+		return
+	}
+	game, err := games.CreateGame(options)
+	switch {
+	case errors.Is(err, ErrDraining), errors.Is(err, ErrServerFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state := game.recorder.State()
+	created := createdGame{ID: game.id, Slug: game.slug, Rules: gameRules(state), White: game.seat("white"), Black: game.seat("black")}
+	created.SpectateURL = strings.TrimSuffix(publicURL, "/") + "/g/" + game.slug
+	if len(state.SpectatorTokens) > 0 {
+		created.SpectatorToken = state.SpectatorTokens[0]
+		created.SpectateURL += "?" + url.Values{"token": {created.SpectatorToken}}.Encode()
+	}
+	writeJSON(w, created)
+}
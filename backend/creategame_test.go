@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCreateGame(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	host := Player{ID: "host", Name: "host"}
+	startSession(&host, "test")
+	players.Create(host)
+	defer func(u string) { publicURL = u }(publicURL)
+	publicURL = "https://chess.example.com/"
+
+	post := func(token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/games", strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, r)
+		return w
+	}
+	if w := post("", `{}`); w.Code != http.StatusForbidden {
+		t.Errorf("got %d without an account", w.Code)
+	}
+	for _, body := range []string{`{"color":"white"}`, `{"variant":"bughouse"}`, `{"draws":"sometimes"}`, `{"seats":2}`} {
+		if w := post(host.Token, body); w.Code != http.StatusBadRequest {
+			t.Errorf("got %d creating %s", w.Code, body)
+		}
+	}
+
+	w := post(host.Token, `{"timeControl":"untimed","draws":"never","private":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	created := createdGame{}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Rules.TimeControl != untimed || created.Rules.Draws != "never" || !created.Rules.Private {
+		t.Errorf("got rules %+v", created.Rules)
+	}
+	if created.SpectatorToken == "" || created.SpectateURL != "https://chess.example.com/g/"+created.Slug+"?token="+created.SpectatorToken {
+		t.Errorf("got spectate URL %s", created.SpectateURL)
+	}
+	join, err := url.Parse(created.White.URL)
+	if err != nil || join.Scheme != "wss" || join.Path != "/ws" || join.Query().Get("token") != created.White.Token {
+		t.Errorf("got join URL %s", created.White.URL)
+	}
+
+	game, ok := games.Find(created.ID)
+	if !ok {
+		t.Fatal("game not registered")
+	}
+	if err := game.Resume(context.Background(), newTestPlayer(t).conn, "wrong", -1); err != ErrInvalidResumeToken {
+		t.Errorf("got %v with a wrong token", err)
+	}
+	// the first player to come may leave and come back before it starts
+	white := newTestPlayer(t)
+	if err := game.Resume(context.Background(), white.conn, created.White.Token, -1); err != nil {
+		t.Fatal(err)
+	}
+	white.disconnect()
+	waitFor(t, func() bool {
+		game.mu.Lock()
+		defer game.mu.Unlock()
+		return !game.connected["white"]
+	})
+	white = newTestPlayer(t)
+	if err := game.Resume(context.Background(), white.conn, created.White.Token, -1); err != nil {
+		t.Fatal(err)
+	}
+	black := newTestPlayer(t)
+	if err := game.Resume(context.Background(), black.conn, created.Black.Token, -1); err != nil {
+		t.Fatal(err)
+	}
+	for color, player := range map[string]*testPlayer{"white": white, "black": black} {
+		start := player.expect("start")
+		if start.Color != color || start.Rules == nil || start.Rules.Draws != "never" {
+			t.Errorf("got %+v", start)
+		}
+	}
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	if state := game.recorder.State(); !state.Reserved || !state.Started || state.TimeControl != nil {
+		t.Errorf("got %+v", state)
+	}
+}
+
+func TestKickReservedGame(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	host := Player{ID: "host", Name: "host"}
+	startSession(&host, "test")
+	players.Create(host)
+
+	r := httptest.NewRequest("POST", "/games", strings.NewReader(`{"timeControl":"untimed"}`))
+	r.Header.Set("Authorization", "Bearer "+host.Token)
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, r)
+	created := createdGame{}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	game, ok := games.Find(created.ID)
+	if !ok {
+		t.Fatal("game not registered")
+	}
+	kick := func(query string) {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/games/"+game.id+"/kick"+query, nil)
+		r.Header.Set("Authorization", "Bearer admin")
+		w := httptest.NewRecorder()
+		newAdminMux("admin").ServeHTTP(w, r)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("got %d: %s", w.Code, w.Body)
+		}
+	}
+
+	// nobody is in yet
+	kick("")
+	white := newTestPlayer(t)
+	if err := game.Resume(context.Background(), white.conn, created.White.Token, -1); err != nil {
+		t.Fatal(err)
+	}
+	kick("?color=white")
+	white.expect("error", CodeKicked)
+	waitFor(t, func() bool {
+		game.mu.Lock()
+		defer game.mu.Unlock()
+		return !game.connected["white"]
+	})
+
+	// the seat is still reserved for the player
+	white = newTestPlayer(t)
+	if err := game.Resume(context.Background(), white.conn, created.White.Token, -1); err != nil {
+		t.Fatal(err)
+	}
+	black := newTestPlayer(t)
+	if err := game.Resume(context.Background(), black.conn, created.Black.Token, -1); err != nil {
+		t.Fatal(err)
+	}
+	white.expect("start")
+	black.expect("start")
+	white.send(Message{Type: "resign"})
+	white.expect("game_over")
+	<-game.done
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// drainPollInterval is how often a draining server with a deadline
+// checks whether its games are done
+var drainPollInterval = time.Second
+
+// shutdownServer checkpoints the games left and exits the process,
+// as set up by main
+var shutdownServer = func() {}
+
+// drainDeadline is set while the server drains to be replaced: it exits
+// once no game is left, or at the deadline with the games still going
+// checkpointed for another server to resume
+var drainDeadline = struct {
+	sync.Mutex
+	at   time.Time
+	stop chan struct{}
+}{}
+
+// startDrain turns drain mode on, exiting within timeout if positive
+func startDrain(timeout time.Duration) {
+	draining.Store(true)
+	drainDeadline.Lock()
+	defer drainDeadline.Unlock()
+	if drainDeadline.stop != nil {
+		close(drainDeadline.stop)
+		drainDeadline.at, drainDeadline.stop = time.Time{}, nil
+	}
+	if timeout > 0 {
+		drainDeadline.at, drainDeadline.stop = time.Now().Add(timeout), make(chan struct{})
+		go watchDrain(drainDeadline.at, drainDeadline.stop)
+	}
+}
+
+func stopDrain() {
+	draining.Store(false)
+	drainDeadline.Lock()
+	defer drainDeadline.Unlock()
+	if drainDeadline.stop != nil {
+		close(drainDeadline.stop)
+		drainDeadline.at, drainDeadline.stop = time.Time{}, nil
+	}
+}
+
+// drainDeadlineAt is the zero time unless the server is to exit
+func drainDeadlineAt() time.Time {
+	drainDeadline.Lock()
+	defer drainDeadline.Unlock()
+	return drainDeadline.at
+}
+
+func watchDrain(deadline time.Time, stop <-chan struct{}) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+			shutdownServer()
+			return
+		case <-ticker.C:
+			if len(games.List()) == 0 {
+				shutdownServer()
+				return
+			}
+		}
+	}
+}
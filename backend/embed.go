@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// embedView is what an embedded game shows, it holds nothing private
+type embedView struct {
+	ID       string   `json:"id"`
+	Started  bool     `json:"started"`
+	Finished bool     `json:"finished"`
+	Result   string   `json:"result,omitempty"`
+	FEN      string   `json:"fen"`
+	Turn     string   `json:"turn"`
+	Moves    []string `json:"moves"`
+}
+
+// embedRefresh is how often, in seconds, the page of a game being played reloads
+const embedRefresh = 5
+
+// embedHandler serves a page showing a game, meant to be put in an iframe
+// by other sites, or the same as JSON with ?format=json or an Accept header
+// asking for it, for widgets of their own
+func embedHandler(w http.ResponseWriter, r *http.Request) {
+	state, ok := loadWatchedGame(w, r)
+	if !ok {
+		return
+	}
+	position, _ := positionAfter(state.FEN, state.Moves)
+	view := embedView{
+		ID:       state.ID,
+		Started:  state.Started,
+		Finished: state.Finished,
+		Result:   state.Result,
+		FEN:      position.FEN(),
+		Turn:     position.Turn().String(),
+		Moves:    make([]string, 0, len(state.Moves)),
+	}
+	for _, m := range state.Moves {
+		view.Moves = append(view.Moves, m.UCI())
+	}
+
+	// any site may frame the page
+	w.Header().Set("Content-Security-Policy", "frame-ancestors *")
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, view)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := embedPage.Execute(w, embedPageData{
+		embedView: view,
+		Board:     boardRows(position),
+		MoveList:  moveList(view.Moves),
+		Refresh:   embedRefresh,
+	}); err != nil {
+		log.Println("embed:", err)
+	}
+}
+
+type embedPageData struct {
+	embedView
+	Board    [][]string
+	MoveList string
+	Refresh  int
+}
+
+// moveList numbers the moves the way they are written down, 1. e2e4 e7e5 2. ...
+func moveList(moves []string) string {
+	var b strings.Builder
+	for i, m := range moves {
+		if i%2 == 0 {
+			fmt.Fprintf(&b, "%d. ", i/2+1)
+		}
+		b.WriteString(m)
+		b.WriteByte(' ')
+	}
+	return strings.TrimSpace(b.String())
+}
+
+var pieceSymbols = map[byte]string{
+	'K': "♔", 'Q': "♕", 'R': "♖", 'B': "♗", 'N': "♘", 'P': "♙",
+	'k': "♚", 'q': "♛", 'r': "♜", 'b': "♝", 'n': "♞", 'p': "♟",
+}
+
+// boardRows are the symbols of the pieces on every square, rank 8 first
+func boardRows(position chess.Position) [][]string {
+	rows := make([][]string, 8)
+	for rank := 7; rank >= 0; rank-- {
+		row := make([]string, 8)
+		for file := range row {
+			if piece := position.PieceAt(chess.NewSquare(file, rank)); piece != chess.NoPiece {
+				row[file] = pieceSymbols[piece.Letter()]
+			}
+		}
+		rows[7-rank] = row
+	}
+	return rows
+}
+
+var embedPage = template.Must(template.New("embed").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{if not .Finished}}<meta http-equiv="refresh" content="{{.Refresh}}">{{end}}
+<title>Game {{.ID}}</title>
+<style>
+body { margin: 0; font-family: sans-serif; }
+table { border-collapse: collapse; }
+td { width: 2.5em; height: 2.5em; text-align: center; font-size: 1.5em; background: #f0d9b5; }
+tr:nth-child(odd) td:nth-child(even), tr:nth-child(even) td:nth-child(odd) { background: #b58863; }
+p { margin: 0.5em; }
+</style>
+</head>
+<body>
+<table>
+{{range .Board}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+<p>{{if .Finished}}{{with .Result}}{{.}}{{else}}Game over{{end}}{{else if .Started}}{{.Turn}} to move{{else}}Waiting for an opponent{{end}}</p>
+<p>{{.MoveList}}</p>
+</body>
+</html>
+`))
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func embedded(t *testing.T, id, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/embed/"+id, nil)
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, r)
+	return w
+}
+
+func TestEmbedShowsTheGame(t *testing.T) {
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+
+	view := embedView{}
+	waitFor(t, func() bool {
+		json.Unmarshal(embedded(t, game.id, "application/json").Body.Bytes(), &view)
+		return len(view.Moves) == 1
+	})
+	if view.FEN != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1" || view.Turn != "black" {
+		t.Errorf("got %+v", view)
+	}
+
+	w := embedded(t, game.id, "text/html")
+	if !strings.Contains(w.Body.String(), "1. e2e4") || !strings.Contains(w.Body.String(), `http-equiv="refresh"`) {
+		t.Errorf("got page %s", w.Body)
+	}
+	if w.Header().Get("Content-Security-Policy") != "frame-ancestors *" {
+		t.Error("the page cannot be framed")
+	}
+}
+
+func TestEmbedUnknownGame(t *testing.T) {
+	if w := embedded(t, "nope", "text/html"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d", w.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// Line is a line of play the engine found, its Moves from the position
+// analysed and its Score for the side to move there, in centipawns. Mate
+// is the number of moves to mate when it is forced, negative if the side
+// to move is the one mated
+type Line struct {
+	Moves []chess.Move
+	Score int
+	Mate  int
+}
+
+// Analyze is the lines of the best moves of position, as many as lines at
+// most, searched depth moves deep for moveTime at most or until ctx is done
+func Analyze(ctx context.Context, position chess.Position, lines, depth int, moveTime time.Duration) []Line {
+	moves := position.LegalMoves()
+	if len(moves) == 0 {
+		return []Line{}
+	}
+	s := newSearch(ctx, moveTime)
+	// no margin at all, for every move to be scored exactly
+	scores := s.deepen(position, moves, depth, 2*mate)
+	if scores == nil {
+		return []Line{}
+	}
+	found := []Line{}
+	for i, m := range moves[:min(lines, len(moves))] {
+		line := Line{Moves: s.principalVariation(position, m, depth), Score: scores[i]}
+		switch {
+		case scores[i] > mate-100:
+			line.Mate, line.Score = (mate-scores[i]+1)/2, 0
+		case scores[i] < -mate+100:
+			line.Mate, line.Score = -(mate+scores[i])/2, 0
+		}
+		found = append(found, line)
+	}
+	return found
+}
+
+// principalVariation is m and the moves expected to follow it after
+// position, as the search left them in its table, depth of them at most
+func (s *search) principalVariation(position chess.Position, m chess.Move, depth int) []chess.Move {
+	pv := []chess.Move{m}
+	seen := map[uint64]bool{position.Hash(): true}
+	position = position.Apply(m)
+	for len(pv) < depth && !seen[position.Hash()] {
+		seen[position.Hash()] = true
+		e := s.table[position.Hash()%tableSize]
+		if e.hash != position.Hash() || !position.IsLegal(e.move) {
+			break
+		}
+		pv = append(pv, e.move)
+		position = position.Apply(e.move)
+	}
+	return pv
+}
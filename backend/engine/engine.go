@@ -0,0 +1,253 @@
+// Package engine is the built-in chess engine the server plays with: an
+// alpha-beta search over the positions of the chess package, weakened on
+// purpose at the lower of its levels
+package engine
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// Level is how well the engine plays
+type Level struct {
+	Name string
+	// Depth is how many moves ahead the engine looks at most, MoveTime how
+	// long it thinks about a move at most
+	Depth    int
+	MoveTime time.Duration
+	// Margin is how many centipawns worse than the best move the one it
+	// plays may be, picked at random among those; Blunder is the chance it
+	// plays any legal move instead, the mistakes the weaker levels make
+	Margin  int
+	Blunder float64
+}
+
+// Levels are the levels of the engine, from the weakest to the strongest
+var Levels = []Level{
+	{Name: "beginner", Depth: 1, MoveTime: 100 * time.Millisecond, Margin: 150, Blunder: 0.25},
+	{Name: "casual", Depth: 2, MoveTime: 250 * time.Millisecond, Margin: 60, Blunder: 0.1},
+	{Name: "intermediate", Depth: 3, MoveTime: 500 * time.Millisecond, Margin: 25, Blunder: 0.02},
+	{Name: "advanced", Depth: 5, MoveTime: time.Second, Margin: 10},
+	{Name: "master", Depth: 64, MoveTime: 2 * time.Second},
+}
+
+// LevelNamed is the level called name
+func LevelNamed(name string) (Level, bool) {
+	for _, level := range Levels {
+		if level.Name == name {
+			return level, true
+		}
+	}
+	return Level{}, false
+}
+
+// mate is the score of mating right away, mates further away score less
+const mate = 100_000
+
+// Move is the move the engine plays at level in position, which must have
+// a legal move; it is done thinking early once ctx is
+func Move(ctx context.Context, position chess.Position, level Level, rng *rand.Rand) chess.Move {
+	moves := position.LegalMoves()
+	if len(moves) == 1 || rng.Float64() < level.Blunder {
+		return moves[rng.IntN(len(moves))]
+	}
+	s := newSearch(ctx, level.MoveTime)
+	scores := s.deepen(position, moves, level.Depth, level.Margin)
+	if scores == nil {
+		// ctx was done right away
+		return moves[0]
+	}
+	best := slices.Max(scores)
+	var candidates []chess.Move
+	for i, m := range moves {
+		if scores[i] >= best-level.Margin {
+			candidates = append(candidates, m)
+		}
+	}
+	return candidates[rng.IntN(len(candidates))]
+}
+
+// search is the state of the engine while it thinks about a move
+type search struct {
+	ctx context.Context
+	// deadline is when the search stops, it goes on until done if it is
+	// zero; it is until once the first depth is done
+	deadline time.Time
+	until    time.Time
+	nodes    int
+	stopped  bool
+	// table has the best move found in the positions searched before, by
+	// their hash, to search first when they come up again
+	table []entry
+}
+
+const tableSize = 1 << 16
+
+// newSearch is a search thinking for moveTime at most, or until ctx is done
+func newSearch(ctx context.Context, moveTime time.Duration) *search {
+	s := &search{ctx: ctx, table: make([]entry, tableSize), until: time.Now().Add(moveTime)}
+	if d, ok := ctx.Deadline(); ok && d.Before(s.until) {
+		s.until = d
+	}
+	return s
+}
+
+// deepen searches moves, those of position, one move deeper at a time up
+// to depth, returning their scores at the deepest depth searched to the
+// end; the first one always is however long it takes, unless ctx is done.
+// Moves are left best first, scored as root does
+func (s *search) deepen(position chess.Position, moves []chess.Move, depth, margin int) []int {
+	var scores []int
+	for d := 1; d <= max(depth, 1); d++ {
+		searched, ok := s.root(position, moves, d, margin)
+		if !ok {
+			break
+		}
+		scores, s.deadline = searched, s.until
+		// the best moves so far are searched first at the next depth
+		sortByScore(moves, scores)
+		if scores[0] >= mate-d {
+			break
+		}
+	}
+	return scores
+}
+
+// sortByScore sorts moves and their scores, the best first
+func sortByScore(moves []chess.Move, scores []int) {
+	order := make([]int, len(moves))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return scores[b] - scores[a] })
+	sortedMoves, sortedScores := make([]chess.Move, len(moves)), make([]int, len(scores))
+	for i, j := range order {
+		sortedMoves[i], sortedScores[i] = moves[j], scores[j]
+	}
+	copy(moves, sortedMoves)
+	copy(scores, sortedScores)
+}
+
+type entry struct {
+	hash uint64
+	move chess.Move
+}
+
+// root searches moves, those of position, depth moves deep, reporting false
+// if it ran out of time before the end. Only the scores of the moves within
+// margin of the best one are exact, the others are no more than that
+func (s *search) root(position chess.Position, moves []chess.Move, depth, margin int) ([]int, bool) {
+	scores := make([]int, len(moves))
+	best := -mate - 1
+	for i, m := range moves {
+		alpha := max(best-margin-1, -mate-1)
+		scores[i] = -s.negamax(position.Apply(m), depth-1, -mate-1, -alpha, 1)
+		if s.stopped {
+			return nil, false
+		}
+		best = max(best, scores[i])
+	}
+	return scores, true
+}
+
+// negamax is the score of position for the side to move, looking depth
+// moves ahead, ply moves away from the root; it is only exact between
+// alpha and beta
+func (s *search) negamax(position chess.Position, depth, alpha, beta, ply int) int {
+	if s.stop() {
+		return 0
+	}
+	if depth <= 0 {
+		return s.quiesce(position, alpha, beta)
+	}
+	moves := position.LegalMoves()
+	if len(moves) == 0 {
+		if position.InCheck() {
+			return -mate + ply
+		}
+		return 0
+	}
+	if position.Halfmoves() >= 100 {
+		return 0
+	}
+	e := &s.table[position.Hash()%tableSize]
+	order(position, moves, e, position.Hash())
+	var best chess.Move
+	for _, m := range moves {
+		score := -s.negamax(position.Apply(m), depth-1, -beta, -alpha, ply+1)
+		if s.stopped {
+			return 0
+		}
+		if score >= beta {
+			*e = entry{hash: position.Hash(), move: m}
+			return beta
+		}
+		if score > alpha {
+			alpha, best = score, m
+		}
+	}
+	if best != (chess.Move{}) {
+		*e = entry{hash: position.Hash(), move: best}
+	}
+	return alpha
+}
+
+// quiesce plays out the captures of position, for the score of a search
+// not to stop in the middle of an exchange
+func (s *search) quiesce(position chess.Position, alpha, beta int) int {
+	if s.stop() {
+		return 0
+	}
+	standPat := evaluate(position)
+	if standPat >= beta {
+		return beta
+	}
+	alpha = max(alpha, standPat)
+	for _, m := range position.LegalMoves() {
+		if position.Captured(m) == chess.NoPieceType && m.Promotion == chess.NoPieceType {
+			continue
+		}
+		score := -s.quiesce(position.Apply(m), -beta, -alpha)
+		if s.stopped {
+			return 0
+		}
+		if score >= beta {
+			return beta
+		}
+		alpha = max(alpha, score)
+	}
+	return alpha
+}
+
+// stop reports whether the search is out of time, looking at the clock
+// every so many nodes only
+func (s *search) stop() bool {
+	s.nodes++
+	if !s.stopped && s.nodes%1024 == 0 {
+		s.stopped = (!s.deadline.IsZero() && time.Now().After(s.deadline)) || s.ctx.Err() != nil
+	}
+	return s.stopped
+}
+
+// order sorts moves for the best to be searched first: the move in e if
+// it is the one found for hash before, then captures of the most valuable
+// pieces by the least valuable ones, then promotions
+func order(position chess.Position, moves []chess.Move, e *entry, hash uint64) {
+	rank := func(m chess.Move) int {
+		if e.hash == hash && m == e.move {
+			return -1 << 20
+		}
+		r := 0
+		if captured := position.Captured(m); captured != chess.NoPieceType {
+			r -= 10*values[captured] - values[position.PieceAt(m.From).Type()]
+		}
+		return r - values[m.Promotion]
+	}
+	slices.SortStableFunc(moves, func(a, b chess.Move) int {
+		return rank(a) - rank(b)
+	})
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+func TestMove(t *testing.T) {
+	for _, test := range []struct {
+		name, fen, want string
+	}{
+		{"mate in one", "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8"},
+		{"hanging queen", "rnb1kbnr/pppp1ppp/8/4p3/3qP3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 0 1", "f3d4"},
+	} {
+		position, err := chess.ParseFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		level, _ := LevelNamed("advanced")
+		m := Move(context.Background(), position, level, rand.New(rand.NewPCG(1, 2)))
+		if m.String() != test.want {
+			t.Errorf("%s: played %s, want %s", test.name, m, test.want)
+		}
+	}
+}
+
+func TestEveryLevelPlaysLegalMoves(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, level := range Levels {
+		level.MoveTime = 50 * time.Millisecond
+		position := chess.NewPosition()
+		for range 6 {
+			m := Move(context.Background(), position, level, rng)
+			if !position.IsLegal(m) {
+				t.Fatalf("%s played %s in %s", level.Name, m, position.FEN())
+			}
+			position = position.Apply(m)
+		}
+	}
+}
+
+func TestLevelNamed(t *testing.T) {
+	if level, ok := LevelNamed("beginner"); !ok || level.Blunder == 0 {
+		t.Errorf("got %+v, %v", level, ok)
+	}
+	if _, ok := LevelNamed("grandmaster"); ok {
+		t.Error("found a level that is not one")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	position, _ := chess.ParseFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	lines := Analyze(context.Background(), position, 3, 3, time.Second)
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	if best := lines[0]; best.Mate != 1 || best.Moves[0].String() != "a1a8" {
+		t.Errorf("got %+v", best)
+	}
+	if lines[1].Mate != 0 || lines[1].Score < lines[2].Score {
+		t.Errorf("got %+v", lines)
+	}
+	// the side to move is mated right away in the fool's mate
+	position, _ = chess.ParseFEN("rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3")
+	if lines := Analyze(context.Background(), position, 3, 3, time.Second); len(lines) != 0 {
+		t.Errorf("got %+v", lines)
+	}
+}
@@ -0,0 +1,93 @@
+package engine
+
+import "github.com/alvaronaschez/simple-chess/chess"
+
+// values are what the pieces are worth, in centipawns
+var values = [chess.King + 1]int{chess.Pawn: 100, chess.Knight: 320, chess.Bishop: 330, chess.Rook: 500, chess.Queen: 900}
+
+// squareBonus is what a piece of every type is worth on every square on top
+// of its value, for white from a1 to h8; black looks at the board flipped
+var squareBonus = [chess.King + 1][64]int{
+	chess.Pawn: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+	chess.Knight: {
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	},
+	chess.Bishop: {
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	},
+	chess.Rook: {
+		0, 0, 0, 5, 5, 0, 0, 0,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+	chess.Queen: {
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	},
+	// the king stays home behind its pawns
+	chess.King: {
+		20, 30, 10, 0, 0, 10, 30, 20,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+	},
+}
+
+// evaluate is how good position is for the side to move, in centipawns
+func evaluate(position chess.Position) int {
+	score := 0
+	for sq := chess.Square(0); sq < 64; sq++ {
+		piece := position.PieceAt(sq)
+		if piece == chess.NoPiece {
+			continue
+		}
+		bonus := squareBonus[piece.Type()][sq]
+		if piece.Color() == chess.Black {
+			bonus = squareBonus[piece.Type()][sq^56]
+		}
+		if piece.Color() == position.Turn() {
+			score += values[piece.Type()] + bonus
+		} else {
+			score -= values[piece.Type()] + bonus
+		}
+	}
+	return score
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// ServeUCI has the engine play at level for a UCI client reading from r
+// and writing to w, until told to quit or r ends. Of the go command only
+// movetime is followed, the engine otherwise thinks as long as its level does
+func ServeUCI(r io.Reader, w io.Writer, level Level) error {
+	rng := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	position := chess.NewPosition()
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "uci":
+			_, err = fmt.Fprintf(w, "id name simple-chess %s\nuciok\n", level.Name)
+		case "isready":
+			_, err = fmt.Fprintln(w, "readyok")
+		case "position":
+			if p, ok := parsePosition(fields[1:]); ok {
+				position = p
+			}
+		case "go":
+			limited := level
+			for i := 1; i+1 < len(fields); i++ {
+				if ms, parseErr := strconv.Atoi(fields[i+1]); fields[i] == "movetime" && parseErr == nil {
+					limited.MoveTime = time.Duration(ms) * time.Millisecond
+				}
+			}
+			best := "(none)"
+			if len(position.LegalMoves()) > 0 {
+				best = Move(context.Background(), position, limited, rng).String()
+			}
+			_, err = fmt.Fprintln(w, "bestmove", best)
+		case "quit":
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return lines.Err()
+}
+
+// parsePosition parses the arguments of the position command: startpos or
+// fen and its fields, then the moves played from there, if any
+func parsePosition(args []string) (chess.Position, bool) {
+	var position chess.Position
+	switch {
+	case len(args) > 0 && args[0] == "startpos":
+		position, args = chess.NewPosition(), args[1:]
+	case len(args) >= 7 && args[0] == "fen":
+		p, err := chess.ParseFEN(strings.Join(args[1:7], " "))
+		if err != nil {
+			return chess.Position{}, false
+		}
+		position, args = p, args[7:]
+	default:
+		return chess.Position{}, false
+	}
+	if len(args) > 0 && args[0] == "moves" {
+		for _, s := range args[1:] {
+			m, err := chess.ParseMove(s)
+			if err != nil || !position.IsLegal(m) {
+				return chess.Position{}, false
+			}
+			position = position.Apply(m)
+		}
+	}
+	return position, true
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UCI is a chess engine run as a process of its own, talked to in the
+// Universal Chess Interface protocol. It thinks about one move at a time
+type UCI struct {
+	// Name is the name the engine gave, if any
+	Name string
+
+	// mu is held while the engine thinks, for it not to be closed meanwhile
+	mu    sync.Mutex
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines *bufio.Scanner
+}
+
+var ErrUCI = errors.New("UCI engine failed")
+
+// handshakeTimeout is how long an engine has to get ready, and how much
+// longer than asked it may think about a move, before it is killed
+const handshakeTimeout = 10 * time.Second
+
+// StartUCI starts the engine run by command, the path of its binary and its
+// arguments, and waits for it to be ready. It is killed once ctx is done
+func StartUCI(ctx context.Context, command string) (*UCI, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: no command", ErrUCI)
+	}
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUCI, err)
+	}
+	u := &UCI{cmd: cmd, stdin: stdin, lines: bufio.NewScanner(stdout)}
+	err = u.within(handshakeTimeout, func() error {
+		if err := u.send("uci"); err != nil {
+			return err
+		}
+		for {
+			line, err := u.read()
+			if err != nil {
+				return err
+			}
+			if name, ok := strings.CutPrefix(line, "id name "); ok {
+				u.Name = name
+			}
+			if line == "uciok" {
+				break
+			}
+		}
+		if err := u.send("ucinewgame"); err != nil {
+			return err
+		}
+		return u.ready()
+	})
+	if err != nil {
+		u.Close()
+		return nil, err
+	}
+	return u, nil
+}
+
+// BestMove is the move the engine plays after moves, in UCI notation from
+// the starting position, thinking about it for moveTime. It is (none) if
+// the engine has no move to play
+func (u *UCI) BestMove(moves []string, moveTime time.Duration) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var best string
+	err := u.within(moveTime+handshakeTimeout, func() error {
+		position := "position startpos"
+		if len(moves) > 0 {
+			position += " moves " + strings.Join(moves, " ")
+		}
+		if err := u.send(position); err != nil {
+			return err
+		}
+		if err := u.send(fmt.Sprintf("go movetime %d", moveTime.Milliseconds())); err != nil {
+			return err
+		}
+		for {
+			line, err := u.read()
+			if err != nil {
+				return err
+			}
+			if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "bestmove" {
+				best = fields[1]
+				return nil
+			}
+		}
+	})
+	return best, err
+}
+
+// Close asks the engine to quit and waits for it to
+func (u *UCI) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.send("quit")
+	u.stdin.Close()
+	timer := time.AfterFunc(handshakeTimeout, func() { u.cmd.Process.Kill() })
+	defer timer.Stop()
+	return u.cmd.Wait()
+}
+
+func (u *UCI) ready() error {
+	if err := u.send("isready"); err != nil {
+		return err
+	}
+	for {
+		line, err := u.read()
+		if err != nil || line == "readyok" {
+			return err
+		}
+	}
+}
+
+// within runs f, killing the engine if it takes longer than timeout, as
+// nothing else gets a process that stopped answering to stop reading
+func (u *UCI) within(timeout time.Duration, f func() error) error {
+	timer := time.AfterFunc(timeout, func() { u.cmd.Process.Kill() })
+	defer timer.Stop()
+	return f()
+}
+
+func (u *UCI) send(command string) error {
+	if _, err := io.WriteString(u.stdin, command+"\n"); err != nil {
+		return fmt.Errorf("%w: %v", ErrUCI, err)
+	}
+	return nil
+}
+
+func (u *UCI) read() (string, error) {
+	if !u.lines.Scan() {
+		if err := u.lines.Err(); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrUCI, err)
+		}
+		return "", fmt.Errorf("%w: engine exited", ErrUCI)
+	}
+	return strings.TrimSpace(u.lines.Text()), nil
+}
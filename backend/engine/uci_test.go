@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// TestHelperUCIEngine is no test but the engine the others start: the test
+// binary serving the built-in engine over UCI
+func TestHelperUCIEngine(t *testing.T) {
+	if os.Getenv("CHESS_HELPER_UCI_ENGINE") != "1" {
+		t.Skip("only run as an engine")
+	}
+	level, _ := LevelNamed("casual")
+	ServeUCI(os.Stdin, os.Stdout, level)
+	os.Exit(0)
+}
+
+func TestUCI(t *testing.T) {
+	t.Setenv("CHESS_HELPER_UCI_ENGINE", "1")
+	u, err := StartUCI(context.Background(), os.Args[0]+" -test.run=^TestHelperUCIEngine$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "simple-chess casual" {
+		t.Errorf("got name %q", u.Name)
+	}
+	best, err := u.BestMove([]string{"e2e4"}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	position := chess.NewPosition().Apply(chess.Move{From: 12, To: 28})
+	if m, err := chess.ParseMove(best); err != nil || !position.IsLegal(m) {
+		t.Errorf("got best move %q", best)
+	}
+	// fool's mate leaves black nothing to play
+	best, err = u.BestMove([]string{"f2f3", "e7e5", "g2g4", "d8h4"}, 50*time.Millisecond)
+	if err != nil || best != "(none)" {
+		t.Errorf("got best move %q, %v", best, err)
+	}
+	if err := u.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStartUCIFails(t *testing.T) {
+	for _, command := range []string{"", "/nonexistent/engine"} {
+		if _, err := StartUCI(context.Background(), command); !errors.Is(err, ErrUCI) {
+			t.Errorf("%q: got %v", command, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+	"github.com/alvaronaschez/simple-chess/engine"
+)
+
+var ErrUnknownLevel = errors.New("unknown engine level")
+
+// defaultLevel is the level of the engine when none is asked for
+const defaultLevel = "intermediate"
+
+func init() {
+	registerVariant(engineGame, variantKind{
+		pair: (*gameManager).PlayEngine,
+		newGame: func(game *ChessGame) variant {
+			opponent := &engineOpponent{game: game, rng: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))}
+			if game == nil {
+				return opponent
+			}
+			// a restored game goes on where it was left
+			state := game.recorder.State()
+			opponent.level, _ = engine.LevelNamed(state.Engines["black"])
+			if state.Started && !state.Finished && state.Turn() == "black" {
+				go opponent.think()
+			}
+			return opponent
+		},
+	})
+}
+
+// engineOpponent plays black in an engine game at its level, it is the
+// variant of the game
+type engineOpponent struct {
+	standard
+	game  *ChessGame
+	level engine.Level
+	// rng is only used by the one move thought about at a time
+	rng *rand.Rand
+}
+
+// PlayEngine creates an engine game with conn as white, against the engine
+// at the level conn asked for, starting right away
+func (m *gameManager) PlayEngine(ctx context.Context, conn *connection) error {
+	name := conn.level
+	if name == "" {
+		name = defaultLevel
+	}
+	level, ok := engine.LevelNamed(name)
+	if !ok {
+		return ErrUnknownLevel
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.clientLimit(conn.client); err != nil {
+		return err
+	}
+	if err := m.canCreate(); err != nil {
+		return err
+	}
+	game := openGame(ctx, conn, engineGame, nil, nil, 0)
+	m.active[game.id] = game
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	game.variant.(*engineOpponent).level = level
+	game.connected["black"] = true
+	game.recorder.Record(game.ctx, PlayerJoined, "black", nil)
+	game.recorder.RecordEngineJoined(game.ctx, "black", level.Name)
+	close(game.joined)
+	return nil
+}
+
+// check plays engine games by the rules, the engine only plays those
+func (e *engineOpponent) check(state GameState, m *Move) (string, chess.Status) {
+	return standardMove(state, m)
+}
+
+// moved has the engine think about its move once white made one
+func (e *engineOpponent) moved(color string, message Message, before GameState) {
+	if color == "white" {
+		go e.think()
+	}
+}
+
+// think plays the move of the engine through the game loop, as any player
+// does, unless the game is over before it is done thinking
+func (e *engineOpponent) think() {
+	state := e.game.recorder.State()
+	position, played := positionAfter(state.FEN, state.Moves)
+	if played < len(state.Moves) || len(position.LegalMoves()) == 0 {
+		return
+	}
+	level := e.level
+	// the engine does not lose on time, thinking a small part of what it has left
+	if state.TimeControl != nil {
+		_, black := state.Clocks(time.Now())
+		level.MoveTime = min(level.MoveTime, time.Duration(black/30)*time.Millisecond)
+	}
+	m := engine.Move(e.game.ctx, position, level, e.rng)
+	if e.game.ctx.Err() != nil {
+		return
+	}
+	uci := m.String()
+	in := inbounds.Get().(*inbound)
+	*in = inbound{color: "black", message: Message{Type: "move", MoveID: newToken(), From: uci[:2], To: uci[2:4], Promotion: uci[4:]}}
+	e.game.post(in)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEngineGame(t *testing.T) {
+	white := newTestPlayer(t)
+	white.conn.level = "beginner"
+	if err := games.PlayEngine(context.Background(), white.conn); err != nil {
+		t.Fatal(err)
+	}
+	if got := white.expect("start"); got.Color != "white" || got.Variant != engineGame {
+		t.Fatalf("got %+v", got)
+	}
+	white.send(move("1", "e2", "e4"))
+	// the engine answers with a legal move
+	reply := white.expect("move")
+	if code, _ := standardMove(GameState{Moves: []Move{{From: "e2", To: "e4"}}}, reply.Move()); code != "" {
+		t.Fatalf("got %+v", reply)
+	}
+	white.send(move("2", "e4", "e6"))
+	white.expect("error", CodeIllegalMove)
+	white.send(Message{Type: "resign"})
+	if got := white.expect("game_over"); got.Result != "0-1" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestEngineGameRefusesUnknownLevels(t *testing.T) {
+	player := newTestPlayer(t)
+	player.conn.level = "grandmaster"
+	if err := games.PlayEngine(context.Background(), player.conn); err != ErrUnknownLevel {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// codes sent in error messages, for clients to tell errors apart
+const (
+	CodeInvalidPayload      = "INVALID_PAYLOAD"
+	CodeInvalidMessage      = "INVALID_MESSAGE"
+	CodeNotYourTurn         = "NOT_YOUR_TURN"
+	CodeGameNotFound        = "GAME_NOT_FOUND"
+	CodeInvalidResumeToken  = "INVALID_RESUME_TOKEN"
+	CodeAlreadyConnected    = "ALREADY_CONNECTED"
+	CodeTakenOver           = "TAKEN_OVER"
+	CodeUnsupportedVersion  = "UNSUPPORTED_VERSION"
+	CodeUnsupportedEncoding = "UNSUPPORTED_ENCODING"
+	CodeBanned              = "BANNED"
+	CodeServerDraining      = "SERVER_DRAINING"
+	CodeKicked              = "KICKED"
+	CodeServerShuttingDown  = "SERVER_SHUTTING_DOWN"
+	CodeServerFull          = "SERVER_FULL"
+	CodeInvalidDrawClaim    = "INVALID_DRAW_CLAIM"
+	CodeGamePaused          = "GAME_PAUSED"
+	CodeSimulNotFound       = "SIMUL_NOT_FOUND"
+	CodeSimulFull           = "SIMUL_FULL"
+	CodeInvalidSimulSize    = "INVALID_SIMUL_SIZE"
+	CodeHostAtAnotherBoard  = "HOST_AT_ANOTHER_BOARD"
+	CodeIllegalMove         = "ILLEGAL_MOVE"
+	CodeWrongRole           = "WRONG_ROLE"
+	CodePieceNotNamed       = "PIECE_NOT_NAMED"
+	CodeWrongPiece          = "WRONG_PIECE"
+	CodeUnknownLevel        = "UNKNOWN_LEVEL"
+	CodeBoardNotFound       = "BOARD_NOT_FOUND"
+	CodeReadOnlyBoard       = "READ_ONLY_BOARD"
+	CodeBoardConflict       = "BOARD_CONFLICT"
+	CodeBoardFull           = "BOARD_FULL"
+	CodeStudyNotFound       = "STUDY_NOT_FOUND"
+	CodeInvalidPlayerToken  = "INVALID_PLAYER_TOKEN"
+	CodeInvalidRatingBand   = "INVALID_RATING_BAND"
+	CodeMatchNotFound       = "MATCH_NOT_FOUND"
+	CodeMatchFull           = "MATCH_FULL"
+	CodeMatchOver           = "MATCH_OVER"
+	CodeInvalidMatchSize    = "INVALID_MATCH_SIZE"
+	CodeBracketNotFound     = "BRACKET_NOT_FOUND"
+	CodeMissingScope        = "MISSING_SCOPE"
+	CodeOfferTooSoon        = "OFFER_TOO_SOON"
+	CodeOffersRefused       = "OFFERS_REFUSED"
+	CodeInvalidTakebacks    = "INVALID_TAKEBACKS"
+	CodeTakebacksDisabled   = "TAKEBACKS_DISABLED"
+	CodeNothingToTakeBack   = "NOTHING_TO_TAKE_BACK"
+	CodeInvalidGameOptions  = "INVALID_GAME_OPTIONS"
+	CodeDrawOffersDisabled  = "DRAW_OFFERS_DISABLED"
+	CodeGameNotOver         = "GAME_NOT_OVER"
+	CodeCoachingRated       = "COACHING_RATED"
+	CodeCoachDismissed      = "COACH_DISMISSED"
+	CodeChallengeFailed     = "CHALLENGE_FAILED"
+	CodeAuthTimeout         = "AUTH_TIMEOUT"
+	CodeAuthRequired        = "AUTH_REQUIRED"
+	CodeIdle                = "IDLE"
+	CodeTooManyGames        = "TOO_MANY_GAMES"
+	CodeTooManySeeks        = "TOO_MANY_SEEKS"
+	CodeSeekExpired         = "SEEK_EXPIRED"
+	CodeNotSeeking          = "NOT_SEEKING"
+	CodeIllegalPosition     = "ILLEGAL_POSITION"
+)
+
+// errorCodes maps the errors a connection can be refused with to their code
+var errorCodes = map[error]string{
+	ErrGameNotFound:               CodeGameNotFound,
+	ErrInvalidResumeToken:         CodeInvalidResumeToken,
+	ErrAlreadyConnected:           CodeAlreadyConnected,
+	ErrTakenOver:                  CodeTakenOver,
+	ErrUnsupportedProtocolVersion: CodeUnsupportedVersion,
+	ErrUnsupportedEncoding:        CodeUnsupportedEncoding,
+	ErrBanned:                     CodeBanned,
+	ErrDraining:                   CodeServerDraining,
+	ErrKicked:                     CodeKicked,
+	ErrShuttingDown:               CodeServerShuttingDown,
+	ErrServerFull:                 CodeServerFull,
+	ErrSimulNotFound:              CodeSimulNotFound,
+	ErrSimulFull:                  CodeSimulFull,
+	ErrInvalidSimulSize:           CodeInvalidSimulSize,
+	ErrUnknownLevel:               CodeUnknownLevel,
+	ErrBoardNotFound:              CodeBoardNotFound,
+	ErrStudyNotFound:              CodeStudyNotFound,
+	ErrInvalidPlayerToken:         CodeInvalidPlayerToken,
+	ErrInvalidRatingBand:          CodeInvalidRatingBand,
+	ErrMatchNotFound:              CodeMatchNotFound,
+	ErrMatchFull:                  CodeMatchFull,
+	ErrMatchOver:                  CodeMatchOver,
+	ErrInvalidMatchSize:           CodeInvalidMatchSize,
+	ErrBracketNotFound:            CodeBracketNotFound,
+	ErrMissingScope:               CodeMissingScope,
+	ErrInvalidTakebacks:           CodeInvalidTakebacks,
+	ErrInvalidGameOptions:         CodeInvalidGameOptions,
+	ErrGameNotOver:                CodeGameNotOver,
+	ErrCoachDismissed:             CodeCoachDismissed,
+	ErrChallengeFailed:            CodeChallengeFailed,
+	ErrAuthTimeout:                CodeAuthTimeout,
+	ErrAuthRequired:               CodeAuthRequired,
+	ErrIdle:                       CodeIdle,
+	ErrTooManyGames:               CodeTooManyGames,
+	ErrTooManySeeks:               CodeTooManySeeks,
+	ErrSeekExpired:                CodeSeekExpired,
+}
+
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// errorMessage builds the error for code, its text is localized
+// for each connection it is written to
+func errorMessage(code string, args ...string) Message {
+	return Message{Type: "error", Code: code, Key: "error." + strings.ToLower(code), Args: args}
+}
+
+// closeWithError refuses a connection, telling the client why
+// both in an error message and in the close frame
+func closeWithError(conn *connection, err error, args ...string) {
+	conn.Write(errorMessage(errorCodes[err], args...))
+	conn.Close(err.Error())
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// finishedTTL is how long caches keep what is served about a finished
+// game, that never changes
+const finishedTTL = 365 * 24 * 60 * 60
+
+// notModified tags what is served about the finished game of state with
+// an ETag, for clients and CDNs to keep it, reporting whether r has it
+// already, answered with 304 Not Modified then. Those of live games change
+// with every move and go untagged; those of private games are only kept
+// by whoever has a spectator token
+func notModified(w http.ResponseWriter, r *http.Request, state GameState) bool {
+	if !state.Finished {
+		return false
+	}
+	w.Header().Set("Cache-Control", cacheScope(state)+", max-age="+strconv.Itoa(finishedTTL)+", immutable")
+	return tagged(w, r, `"`+state.ID+"-"+strconv.Itoa(state.Seq)+`"`)
+}
+
+// notModifiedBody is notModified for what may still change about a game,
+// its comments say, tagged with a hash of body so clients check it is
+// still the same
+func notModifiedBody(w http.ResponseWriter, r *http.Request, state GameState, body []byte) bool {
+	w.Header().Set("Cache-Control", cacheScope(state)+", no-cache")
+	sum := sha256.Sum256(body)
+	return tagged(w, r, `"`+base64.RawURLEncoding.EncodeToString(sum[:12])+`"`)
+}
+
+func cacheScope(state GameState) string {
+	if state.Private {
+		return "private"
+	}
+	return "public"
+}
+
+// tagged sets the ETag of the answer to etag, answering 304 if it is one
+// of the If-None-Match of r
+func tagged(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		newPublicMux().ServeHTTP(w, r)
+		return w
+	}
+	// live games change with every move
+	if etag := get("/games/"+game.id+"/fen", "").Header().Get("ETag"); etag != "" {
+		t.Errorf("got %s for a live game", etag)
+	}
+
+	white.send(Message{Type: "resign"})
+	black.expect("game_over")
+	waitFor(t, func() bool { return game.recorder.State().Finished })
+	for _, path := range []string{"/fen", "/board.svg?ply=1", "/board.png", "/gif", "/json"} {
+		w := get("/games/"+game.id+path, "")
+		etag := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || etag == "" || !strings.HasPrefix(w.Header().Get("Cache-Control"), "public") {
+			t.Fatalf("%s: got %d, %q, %q", path, w.Code, etag, w.Header().Get("Cache-Control"))
+		}
+		if w := get("/games/"+game.id+path, `"other", W/`+etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("%s: got %d with its ETag", path, w.Code)
+		}
+		if w := get("/games/"+game.id+path, `"other"`); w.Code != http.StatusOK {
+			t.Errorf("%s: got %d with another ETag", path, w.Code)
+		}
+	}
+	// the document of a game changes with the comments left on it
+	before := get("/games/"+game.id+"/json", "").Header().Get("ETag")
+	comments.Update(game.id, func(list *[]Comment) error {
+		*list = append(*list, Comment{ID: 1, Author: "white", Text: "gg"})
+		return nil
+	})
+	if w := get("/games/"+game.id+"/json", before); w.Code != http.StatusOK || w.Header().Get("ETag") == before {
+		t.Errorf("got %d, %s once commented", w.Code, w.Header().Get("ETag"))
+	}
+}
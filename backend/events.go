@@ -0,0 +1,609 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	GameCreated        EventType = "game_created"
+	PlayerJoined       EventType = "player_joined"
+	GameStarted        EventType = "game_started"
+	MoveMade           EventType = "move_made"
+	MoveRejected       EventType = "move_rejected"
+	PlayerDisconnected EventType = "player_disconnected"
+	PlayerReconnected  EventType = "player_reconnected"
+	GameAbandoned      EventType = "game_abandoned"
+	GameResigned       EventType = "game_resigned"
+	DrawOffered        EventType = "draw_offered"
+	DrawAgreed         EventType = "draw_agreed"
+	// GameFlagged is the player of Color losing on time, GameFlaggedDrawn
+	// the same when the opponent could not have mated
+	GameFlagged      EventType = "game_flagged"
+	GameFlaggedDrawn EventType = "game_flagged_drawn"
+	// GameAdjudicated is the game drawn by the server once it had lasted
+	// maxGameDuration
+	GameAdjudicated EventType = "game_adjudicated"
+	// a game is paused once both players offered it, and goes on once both are back
+	PauseOffered EventType = "pause_offered"
+	GamePaused   EventType = "game_paused"
+	GameUnpaused EventType = "game_unpaused"
+	// OffersRefused is the player of Color refusing any further draw or
+	// pause offer of their opponent, declining those pending
+	OffersRefused EventType = "offers_refused"
+	// TakebacksAllowed is the game created with the takeback policy Reason,
+	// TakebackOffered the player of Color asking to take back their last
+	// move and MovesTakenBack their opponent agreeing, the last Plies moves
+	// taken back for them to play it again
+	TakebacksAllowed EventType = "takebacks_allowed"
+	TakebackOffered  EventType = "takeback_offered"
+	MovesTakenBack   EventType = "moves_taken_back"
+	// DrawOffersDisabled is the game created with no draw offers, draws
+	// are still claimed by the rules
+	DrawOffersDisabled EventType = "draw_offers_disabled"
+	// GameReserved is the game created for its players to join with the
+	// tokens of their seats, it starts once both did
+	GameReserved EventType = "game_reserved"
+	// DrawClaimed is a draw the player of Color claimed for Reason,
+	// threefold_repetition or fifty_moves
+	DrawClaimed EventType = "draw_claimed"
+	// GameMadePrivate means only those with a spectator token can watch it
+	GameMadePrivate      EventType = "game_made_private"
+	SpectatorTokenIssued EventType = "spectator_token_issued"
+	// GameMadeCasual means the result of the game changes no rating
+	GameMadeCasual EventType = "game_made_casual"
+	// PlayerBlindfolded means the player of Color plays blindfold, they are
+	// never sent the moves played so far
+	PlayerBlindfolded EventType = "player_blindfolded"
+	// GameCheckmated is the player of Color mated, GameStalemated the
+	// player of Color stalemated and the game drawn
+	GameCheckmated EventType = "game_checkmated"
+	GameStalemated EventType = "game_stalemated"
+	// in bughouse, PiecePocketed is a piece of type Piece handed to the
+	// player of Color by their partner and BughouseDecided the other board
+	// of the match being over, lost here by the player of Color or drawn if
+	// it is empty
+	PiecePocketed   EventType = "piece_pocketed"
+	BughouseDecided EventType = "bughouse_decided"
+	// in hand and brain, BrainJoined is the brain of Color joining and
+	// PieceNamed the brain naming the type of piece its hand has to move
+	BrainJoined EventType = "brain_joined"
+	PieceNamed  EventType = "piece_named"
+	// EngineJoined is an engine playing Color, the built-in one at the level
+	// Engine or, in exhibitions, the UCI engine named Engine
+	EngineJoined EventType = "engine_joined"
+	// CoachInvited is the player of Color letting a coach into their seat,
+	// who may move for them if Reason is mover; CoachDismissed the player
+	// of Color letting their coach go
+	CoachInvited   EventType = "coach_invited"
+	CoachDismissed EventType = "coach_dismissed"
+	// GameImported ends a game read from a PGN archive once its moves are
+	// in, with its Result and the Names of its players
+	GameImported EventType = "game_imported"
+)
+
+// the variants besides standard chess: bughouse matches, hand and brain
+// games where each side is a team of a brain naming the piece to move and
+// a hand choosing the move, voting games where a crowd plays black, engine
+// games where the server does and exhibitions between two engines
+const (
+	bughouse     = "bughouse"
+	handAndBrain = "hand_and_brain"
+	voting       = "voting"
+	engineGame   = "engine"
+	exhibition   = "exhibition"
+)
+
+type Move struct {
+	ID        string `json:"id,omitempty"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Promotion string `json:"promotion,omitempty"`
+	// Drop is the piece put on To from the pocket, From is then empty
+	Drop string `json:"drop,omitempty"`
+	// SpentMs is how long the player thought about the move, in
+	// milliseconds, the lag credited to them left out, see RecordMove
+	SpentMs int64 `json:"spentMs,omitempty"`
+}
+
+// UCI is m in UCI notation, like e2e4, e7e8q or N@f3
+func (m Move) UCI() string {
+	if m.Drop != "" {
+		return strings.ToUpper(m.Drop) + "@" + m.To
+	}
+	return m.From + m.To + m.Promotion
+}
+
+// Event is a single transition of a game, games are never stored
+// in any other form: their state is rebuilt by replaying their events
+type Event struct {
+	GameID string    `json:"gameId"`
+	Seq    int       `json:"seq"`
+	Time   time.Time `json:"time"`
+	Type   EventType `json:"type"`
+	Color  string    `json:"color,omitempty"`
+	Move   *Move     `json:"move,omitempty"`
+	// Slug is the short link of the game, TimeControl its time control,
+	// Variant its variant and FEN the position it starts at, if any, all
+	// set when it is created
+	Slug        string       `json:"slug,omitempty"`
+	TimeControl *TimeControl `json:"timeControl,omitempty"`
+	Variant     string       `json:"variant,omitempty"`
+	FEN         string       `json:"fen,omitempty"`
+	// Token is the spectator token issued
+	Token string `json:"token,omitempty"`
+	// Reason is what a draw was claimed for, the takeback policy, or what
+	// a coach invited may do
+	Reason string `json:"reason,omitempty"`
+	// Plies is how many moves were taken back
+	Plies int `json:"plies,omitempty"`
+	// Piece is the letter of the piece pocketed or named
+	Piece string `json:"piece,omitempty"`
+	// Engine is the engine that joined, see EngineJoined
+	Engine string `json:"engine,omitempty"`
+	// Player is the account a player joined with, if any
+	Player string `json:"player,omitempty"`
+	// Result and Names are those of an imported game, see GameImported
+	Result string            `json:"result,omitempty"`
+	Names  map[string]string `json:"names,omitempty"`
+
+	// lag is left out of the time spent on a move, see RecordMove
+	lag time.Duration
+}
+
+type GameState struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug,omitempty"`
+	// Seq is the sequence number of the last event applied
+	Seq       int       `json:"seq"`
+	CreatedAt time.Time `json:"createdAt"`
+	White     bool      `json:"white"`
+	Black     bool      `json:"black"`
+	Started   bool      `json:"started"`
+	Finished  bool      `json:"finished"`
+	// FEN is the position the game starts at, the starting position if
+	// empty; Moves are played from it
+	FEN   string `json:"fen,omitempty"`
+	Moves []Move `json:"moves"`
+
+	// Result is 1-0, 0-1 or 1/2-1/2 once the game has been decided
+	Result string `json:"result,omitempty"`
+	// DrawOffer is the color whose draw offer is pending, if any
+	DrawOffer string `json:"drawOffer,omitempty"`
+	// PauseOffer is the color whose offer to pause is pending, if any
+	PauseOffer string `json:"pauseOffer,omitempty"`
+	// DrawOfferPlies and PauseOfferPlies are the plies each color last
+	// offered a draw and to pause at, OffersRefused the colors refusing the
+	// offers of their opponent
+	DrawOfferPlies  map[string]int `json:"drawOfferPlies,omitempty"`
+	PauseOfferPlies map[string]int `json:"pauseOfferPlies,omitempty"`
+	OffersRefused   []string       `json:"offersRefused,omitempty"`
+	// Takebacks is the takeback policy of the game, none if empty;
+	// TakebackOffer the color whose request is pending, if any, and
+	// TakenBack the colors who took a move back, once each time
+	Takebacks          string         `json:"takebacks,omitempty"`
+	TakebackOffer      string         `json:"takebackOffer,omitempty"`
+	TakebackOfferPlies map[string]int `json:"takebackOfferPlies,omitempty"`
+	TakenBack          []string       `json:"takenBack,omitempty"`
+	// DrawOffersDisabled games cannot be drawn by agreement
+	DrawOffersDisabled bool `json:"drawOffersDisabled,omitempty"`
+	// Reserved games were created for their players, see GameReserved
+	Reserved bool `json:"reserved,omitempty"`
+	// Paused games keep their clocks stopped
+	Paused bool `json:"paused,omitempty"`
+
+	// TurnStarted is when the clock of the player to move started running:
+	// when the game started, the opponent moved or the game was unpaused
+	TurnStarted time.Time `json:"turnStarted"`
+
+	TimeControl *TimeControl `json:"timeControl,omitempty"`
+	// WhiteTime and BlackTime are the milliseconds left on the clocks
+	// of timed games as of TurnStarted
+	WhiteTime int64 `json:"whiteTime,omitempty"`
+	BlackTime int64 `json:"blackTime,omitempty"`
+
+	Private         bool     `json:"private,omitempty"`
+	Casual          bool     `json:"casual,omitempty"`
+	SpectatorTokens []string `json:"spectatorTokens,omitempty"`
+	// Blindfolded are the colors played blindfold
+	Blindfolded []string `json:"blindfolded,omitempty"`
+
+	// Variant is bughouse, hand_and_brain, voting, engine, exhibition or
+	// empty for standard chess
+	Variant string `json:"variant,omitempty"`
+	// NamedPiece is the letter of the piece the brain of the side to move
+	// named, if it did
+	NamedPiece string `json:"namedPiece,omitempty"`
+	// Pocketed are the pieces handed to the players of a bughouse game,
+	// in the order they got them
+	Pocketed []PocketedPiece `json:"pocketed,omitempty"`
+	// Engines are the engines playing by color, as they joined
+	Engines map[string]string `json:"engines,omitempty"`
+	// Players are the accounts playing by color, of those who have one
+	Players map[string]string `json:"players,omitempty"`
+	// Names are the players of imported games by color, who have no
+	// account here
+	Names map[string]string `json:"names,omitempty"`
+	// Coached are the colors that have a coach, CoachesMove those whose
+	// coach may move for them
+	Coached     []string `json:"coached,omitempty"`
+	CoachesMove []string `json:"coachesMove,omitempty"`
+}
+
+// PocketedPiece is a piece handed to Color before the move number Ply
+// was made, its letter is Piece
+type PocketedPiece struct {
+	Ply   int    `json:"ply"`
+	Color string `json:"color"`
+	Piece string `json:"piece"`
+}
+
+func (state *GameState) Apply(event Event) {
+	state.Seq = event.Seq
+	switch event.Type {
+	case GameCreated:
+		state.ID = event.GameID
+		state.Slug = event.Slug
+		state.TimeControl = event.TimeControl
+		state.Variant = event.Variant
+		state.FEN = event.FEN
+		if tc := event.TimeControl; tc != nil {
+			state.WhiteTime, state.BlackTime = tc.InitialMs, tc.InitialMs
+		}
+		state.CreatedAt = event.Time
+	case PlayerJoined, EngineJoined:
+		if event.Type == EngineJoined {
+			state.Engines = maps.Clone(state.Engines)
+			if state.Engines == nil {
+				state.Engines = map[string]string{}
+			}
+			state.Engines[event.Color] = event.Engine
+		}
+		if event.Player != "" {
+			state.Players = maps.Clone(state.Players)
+			if state.Players == nil {
+				state.Players = map[string]string{}
+			}
+			state.Players[event.Color] = event.Player
+		}
+		if event.Color == "white" {
+			state.White = true
+		} else {
+			state.Black = true
+		}
+	case GameStarted:
+		state.Started = true
+		state.TurnStarted = event.Time
+	case MoveMade:
+		state.Moves = append(state.Moves, *event.Move)
+		state.TurnStarted = event.Time
+		state.NamedPiece = ""
+		if tc := state.TimeControl; tc != nil {
+			clock := &state.WhiteTime
+			if event.Color == "black" {
+				clock = &state.BlackTime
+			}
+			*clock += tc.IncrementMs - event.Move.SpentMs
+		}
+		// the opponent declines a draw or pause offer by moving instead
+		if state.DrawOffer != event.Color {
+			state.DrawOffer = ""
+		}
+		if state.PauseOffer != event.Color {
+			state.PauseOffer = ""
+		}
+		// the move a takeback was asked for is not the last anymore
+		state.TakebackOffer = ""
+	case GameAbandoned:
+		state.Finished = true
+	case GameResigned:
+		state.Finished = true
+		state.Result = "1-0"
+		if event.Color == "white" {
+			state.Result = "0-1"
+		}
+	case DrawOffered:
+		state.DrawOffer = event.Color
+		state.DrawOfferPlies = offeredAt(state.DrawOfferPlies, event.Color, len(state.Moves))
+	case GameFlagged:
+		state.Finished = true
+		state.Result = "1-0"
+		if event.Color == "white" {
+			state.Result = "0-1"
+		}
+	case GameFlaggedDrawn, DrawClaimed, GameAdjudicated:
+		state.Finished = true
+		state.Result = "1/2-1/2"
+		state.DrawOffer = ""
+	case GameImported:
+		state.White, state.Black = true, true
+		state.Started, state.Finished = true, true
+		state.Result = event.Result
+		state.Names = event.Names
+	case PauseOffered:
+		state.PauseOffer = event.Color
+		state.PauseOfferPlies = offeredAt(state.PauseOfferPlies, event.Color, len(state.Moves))
+	case OffersRefused:
+		state.OffersRefused = append(state.OffersRefused, event.Color)
+		if state.DrawOffer != event.Color {
+			state.DrawOffer = ""
+		}
+		if state.PauseOffer != event.Color {
+			state.PauseOffer = ""
+		}
+		if state.TakebackOffer != event.Color {
+			state.TakebackOffer = ""
+		}
+	case TakebacksAllowed:
+		state.Takebacks = event.Reason
+	case DrawOffersDisabled:
+		state.DrawOffersDisabled = true
+	case GameReserved:
+		state.Reserved = true
+	case TakebackOffered:
+		state.TakebackOffer = event.Color
+		state.TakebackOfferPlies = offeredAt(state.TakebackOfferPlies, event.Color, len(state.Moves))
+	case MovesTakenBack:
+		// the time the player to move took so far is off the clock
+		if state.TimeControl != nil {
+			white, black := state.Clocks(event.Time)
+			state.WhiteTime, state.BlackTime = white, black
+		}
+		// clipped for the moves played next not to overwrite those taken
+		// back in the copies of the state
+		state.Moves = slices.Clip(state.Moves[:len(state.Moves)-event.Plies])
+		state.TurnStarted = event.Time
+		state.TakebackOffer, state.DrawOffer = "", ""
+		state.TakenBack = append(state.TakenBack, event.Color)
+	case GamePaused:
+		state.PauseOffer = ""
+		state.Paused = true
+		// the time the player to move took so far is off the clock
+		if state.TimeControl != nil {
+			white, black := state.Clocks(event.Time)
+			state.WhiteTime, state.BlackTime = white, black
+		}
+	case GameUnpaused:
+		state.Paused = false
+		state.TurnStarted = event.Time
+	case GameMadePrivate:
+		state.Private = true
+	case GameMadeCasual:
+		state.Casual = true
+	case PlayerBlindfolded:
+		state.Blindfolded = append(state.Blindfolded, event.Color)
+	case SpectatorTokenIssued:
+		state.SpectatorTokens = append(state.SpectatorTokens, event.Token)
+	case DrawAgreed:
+		state.Finished = true
+		state.Result = "1/2-1/2"
+		state.DrawOffer = ""
+	case PieceNamed:
+		state.NamedPiece = event.Piece
+	case CoachInvited:
+		state.Coached = append(without(state.Coached, event.Color), event.Color)
+		state.CoachesMove = without(state.CoachesMove, event.Color)
+		if event.Reason == "mover" {
+			state.CoachesMove = append(state.CoachesMove, event.Color)
+		}
+	case CoachDismissed:
+		state.Coached = without(state.Coached, event.Color)
+		state.CoachesMove = without(state.CoachesMove, event.Color)
+	case PiecePocketed:
+		state.Pocketed = append(state.Pocketed, PocketedPiece{Ply: len(state.Moves), Color: event.Color, Piece: event.Piece})
+	case GameStalemated:
+		state.Finished = true
+		state.DrawOffer = ""
+		state.Result = "1/2-1/2"
+	case GameCheckmated, BughouseDecided:
+		state.Finished = true
+		state.DrawOffer = ""
+		switch event.Color {
+		case "white":
+			state.Result = "0-1"
+		case "black":
+			state.Result = "1-0"
+		default:
+			state.Result = "1/2-1/2"
+		}
+	}
+}
+
+func (state *GameState) Turn() string {
+	first, second := "white", "black"
+	// the side to move is the second field of a FEN
+	if fields := strings.Fields(state.FEN); len(fields) > 1 && fields[1] == "b" {
+		first, second = second, first
+	}
+	if len(state.Moves)%2 == 0 {
+		return first
+	}
+	return second
+}
+
+// without is colors but color, in a slice of its own
+func without(colors []string, color string) []string {
+	var left []string
+	for _, c := range colors {
+		if c != color {
+			left = append(left, c)
+		}
+	}
+	return left
+}
+
+func opponent(color string) string {
+	if color == "white" {
+		return "black"
+	}
+	return "white"
+}
+
+func Replay(events []Event) GameState {
+	state := GameState{Moves: []Move{}}
+	for _, event := range events {
+		state.Apply(event)
+	}
+	return state
+}
+
+// gameRecorder appends the events of a single game to the store
+// and keeps the state they add up to
+type gameRecorder struct {
+	mu    sync.Mutex
+	state GameState
+}
+
+func newGameRecorder(gameID, slug string, tc *TimeControl, variant string) *gameRecorder {
+	return &gameRecorder{state: GameState{ID: gameID, Slug: slug, TimeControl: tc, Variant: variant, Moves: []Move{}}}
+}
+
+func restoreGameRecorder(state GameState) *gameRecorder {
+	return &gameRecorder{state: state}
+}
+
+func (recorder *gameRecorder) Record(ctx context.Context, eventType EventType, color string, move *Move) {
+	event := Event{Type: eventType, Color: color, Move: move}
+	if eventType == GameCreated {
+		event.Slug, event.TimeControl, event.Variant, event.FEN = recorder.state.Slug, recorder.state.TimeControl, recorder.state.Variant, recorder.state.FEN
+	}
+	recorder.record(ctx, event)
+}
+
+// RecordMove records that color made move, their turn having spent lag on
+// the network; that much less is taken off their clock
+func (recorder *gameRecorder) RecordMove(ctx context.Context, color string, move *Move, lag time.Duration) {
+	recorder.record(ctx, Event{Type: MoveMade, Color: color, Move: move, lag: lag})
+}
+
+// RecordJoin records that a player joined as color, with the account
+// player if it is not empty
+func (recorder *gameRecorder) RecordJoin(ctx context.Context, color, player string) {
+	recorder.record(ctx, Event{Type: PlayerJoined, Color: color, Player: player})
+}
+
+// RecordSpectatorToken records that color issued a spectator token
+func (recorder *gameRecorder) RecordSpectatorToken(ctx context.Context, color, token string) {
+	recorder.record(ctx, Event{Type: SpectatorTokenIssued, Color: color, Token: token})
+}
+
+// RecordDrawClaim records that color claimed a draw for reason
+func (recorder *gameRecorder) RecordDrawClaim(ctx context.Context, color, reason string) {
+	recorder.record(ctx, Event{Type: DrawClaimed, Color: color, Reason: reason})
+}
+
+// RecordPieceNamed records that the brain of color named a piece to move
+func (recorder *gameRecorder) RecordPieceNamed(ctx context.Context, color, piece string) {
+	recorder.record(ctx, Event{Type: PieceNamed, Color: color, Piece: piece})
+}
+
+// RecordPocketed records that color was handed a piece to drop
+func (recorder *gameRecorder) RecordPocketed(ctx context.Context, color, piece string) {
+	recorder.record(ctx, Event{Type: PiecePocketed, Color: color, Piece: piece})
+}
+
+// RecordEngineJoined records that engine joined as color
+func (recorder *gameRecorder) RecordEngineJoined(ctx context.Context, color, engine string) {
+	recorder.record(ctx, Event{Type: EngineJoined, Color: color, Engine: engine})
+}
+
+// RecordTakebacks records that the game allows the takebacks of policy
+func (recorder *gameRecorder) RecordTakebacks(ctx context.Context, policy string) {
+	recorder.record(ctx, Event{Type: TakebacksAllowed, Reason: policy})
+}
+
+// RecordTakenBack records that the last plies moves were taken back for
+// color to play their last one again
+func (recorder *gameRecorder) RecordTakenBack(ctx context.Context, color string, plies int) {
+	recorder.record(ctx, Event{Type: MovesTakenBack, Color: color, Plies: plies})
+}
+
+// RecordCoachInvited records that color let a coach in, with the rights
+// of role: mover, or none to only see the game and suggest moves
+func (recorder *gameRecorder) RecordCoachInvited(ctx context.Context, color, role string) {
+	recorder.record(ctx, Event{Type: CoachInvited, Color: color, Reason: role})
+}
+
+// record numbers event as the next of the game and stores it, moves are
+// published on the bus too
+func (recorder *gameRecorder) record(ctx context.Context, event Event) {
+	event = recorder.append(ctx, event)
+	if event.Type == MoveMade {
+		bus.publish(busEvent{Type: busMovePlayed, Time: event.Time, GameID: event.GameID, Color: event.Color, Move: event.Move})
+	}
+}
+
+// append is event as numbered and stored, once the state is updated with it;
+// the recorder stays locked only that long, for handlers on the bus to
+// get its state
+func (recorder *gameRecorder) append(ctx context.Context, event Event) Event {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	event.GameID = recorder.state.ID
+	event.Seq = recorder.state.Seq + 1
+	event.Time = time.Now().UTC()
+	if event.Type == MoveMade && !recorder.state.TurnStarted.IsZero() {
+		spent := *event.Move
+		spent.SpentMs = max(event.Time.Sub(recorder.state.TurnStarted)-event.lag, 0).Milliseconds()
+		event.Move = &spent
+	}
+	if err := store.Append(ctx, event); err != nil {
+		log.Println(err)
+	}
+	recorder.state.Apply(event)
+	feeds.publish(event.GameID, event)
+	return event
+}
+
+// HasMove reports whether a move with the given client ID has already been played
+func (recorder *gameRecorder) HasMove(id string) bool {
+	if id == "" {
+		return false
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, move := range recorder.state.Moves {
+		if move.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (recorder *gameRecorder) State() GameState {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	state := recorder.state
+	state.Moves = append([]Move{}, state.Moves...)
+	state.SpectatorTokens = append([]string(nil), state.SpectatorTokens...)
+	state.Blindfolded = append([]string(nil), state.Blindfolded...)
+	state.Pocketed = append([]PocketedPiece(nil), state.Pocketed...)
+	state.OffersRefused = append([]string(nil), state.OffersRefused...)
+	state.TakenBack = append([]string(nil), state.TakenBack...)
+	state.Coached = append([]string(nil), state.Coached...)
+	state.CoachesMove = append([]string(nil), state.CoachesMove...)
+	return state
+}
+
+func newGameID() string {
+	return randomHex(8)
+}
+
+func newToken() string {
+	return randomHex(16)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
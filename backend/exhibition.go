@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+	"github.com/alvaronaschez/simple-chess/engine"
+)
+
+// uciEngines are the commands of the UCI engines exhibitions can be played
+// between, by name
+var uciEngines = map[string]string{}
+
+// parseEngines parses a comma separated list of engines as name=command
+func parseEngines(s string) (map[string]string, error) {
+	engines := map[string]string{}
+	for _, spec := range strings.Split(s, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		name, command, ok := strings.Cut(spec, "=")
+		name, command = strings.TrimSpace(name), strings.TrimSpace(command)
+		if !ok || name == "" || command == "" {
+			return nil, fmt.Errorf("invalid engine %q, expected name=command", spec)
+		}
+		engines[name] = command
+	}
+	return engines, nil
+}
+
+// defaultMoveTime is how long the engines of an exhibition think about
+// every move unless scheduled otherwise
+const defaultMoveTime = time.Second
+
+var ErrUnknownEngine = errors.New("unknown engine")
+
+func init() {
+	registerVariant(exhibition, variantKind{
+		// exhibitions are only scheduled by admins, asking to play one
+		// pairs for standard chess
+		pair: (*gameManager).Pair,
+		newGame: func(game *ChessGame) variant {
+			ex := &exhibitionGame{game: game, moveTime: defaultMoveTime, engines: map[string]*engine.UCI{}}
+			if game == nil {
+				return ex
+			}
+			// a restored exhibition starts its engines again, thinking
+			// the default time about every move
+			if state := game.recorder.State(); state.Started && !state.Finished {
+				go ex.think()
+			}
+			return ex
+		},
+	})
+}
+
+// exhibitionGame is the variant of an exhibition, a game between two UCI
+// engines the server runs for spectators to watch
+type exhibitionGame struct {
+	standard
+	game     *ChessGame
+	moveTime time.Duration
+
+	// mu guards engines, started as they are first needed; they think in
+	// turn, but are closed from the game loop
+	mu      sync.Mutex
+	engines map[string]*engine.UCI
+	closed  bool
+}
+
+// OpenExhibition starts a game between the engines named white and black,
+// thinking moveTime about every move
+func (m *gameManager) OpenExhibition(white, black string, moveTime time.Duration) (*ChessGame, error) {
+	for _, name := range []string{white, black} {
+		if _, ok := uciEngines[name]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownEngine, name)
+		}
+	}
+	id := newShardedGameID()
+	tokens := map[string]string{"white": newToken(), "black": newToken()}
+	game := newChessGame(games.ctx, id, newGameRecorder(id, newShortLink(id), nil, exhibition), tokens)
+	ex := game.variant.(*exhibitionGame)
+	ex.moveTime = moveTime
+	drop := func() {
+		ex.finished()
+		game.cancel(nil)
+	}
+	// an engine that does not start keeps the game from being played at
+	// all, they are started before the manager is locked as they take a while
+	for color, name := range map[string]string{"white": white, "black": black} {
+		if _, err := ex.engine(color, name); err != nil {
+			drop()
+			return nil, err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.canCreate(); err != nil {
+		drop()
+		return nil, err
+	}
+	game.recorder.Record(game.ctx, GameCreated, "", nil)
+	for color, name := range map[string]string{"white": white, "black": black} {
+		game.connected[color] = true
+		game.recorder.Record(game.ctx, PlayerJoined, color, nil)
+		game.recorder.RecordEngineJoined(game.ctx, color, name)
+	}
+	close(game.joined)
+	m.active[game.id] = game
+	go superviseGame(game)
+	go ex.think()
+	return game, nil
+}
+
+// engine is the engine of color, started if it was not yet; name is the
+// engine it is, empty for the one that joined the game as color
+func (ex *exhibitionGame) engine(color, name string) (*engine.UCI, error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	if ex.closed {
+		return nil, errGameAborted
+	}
+	if u, ok := ex.engines[color]; ok {
+		return u, nil
+	}
+	if name == "" {
+		name = ex.game.recorder.State().Engines[color]
+	}
+	command, ok := uciEngines[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEngine, name)
+	}
+	u, err := engine.StartUCI(ex.game.ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	ex.engines[color] = u
+	return u, nil
+}
+
+// check plays exhibitions by the rules, whatever the engines play
+func (ex *exhibitionGame) check(state GameState, m *Move) (string, chess.Status) {
+	return standardMove(state, m)
+}
+
+// moved has the other engine think about its move
+func (ex *exhibitionGame) moved(color string, message Message, before GameState) {
+	go ex.think()
+}
+
+// think has the engine to move play its move through the game loop, as any
+// player does. An engine that fails resigns, and in a position where a draw
+// can be claimed the engines agree to one, as the server only ends the
+// games that are mated or stalemated by itself
+func (ex *exhibitionGame) think() {
+	state := ex.game.recorder.State()
+	if state.Finished {
+		return
+	}
+	color := state.Turn()
+	post := func(message Message) {
+		in := inbounds.Get().(*inbound)
+		*in = inbound{color: color, message: message}
+		ex.game.post(in)
+	}
+	if _, ok := drawClaim(state.FEN, state.Moves, ""); ok {
+		post(Message{Type: "claim_draw"})
+		return
+	}
+	u, err := ex.engine(color, "")
+	if errors.Is(err, errGameAborted) {
+		return
+	}
+	var best string
+	if err == nil {
+		moves := make([]string, len(state.Moves))
+		for i, m := range state.Moves {
+			moves[i] = m.UCI()
+		}
+		best, err = u.BestMove(moves, ex.moveTime)
+	}
+	if ex.game.ctx.Err() != nil {
+		return
+	}
+	m := Move{}
+	if len(best) >= 4 {
+		m = Move{From: best[:2], To: best[2:4], Promotion: best[4:]}
+	}
+	switch code, _ := standardMove(state, &m); {
+	case best == "(none)":
+		post(Message{Type: "draw_offer"})
+		color = opponent(color)
+		post(Message{Type: "draw_offer"})
+	case err != nil || code != "":
+		post(Message{Type: "resign"})
+	default:
+		post(Message{Type: "move", MoveID: newToken(), From: m.From, To: m.To, Promotion: m.Promotion})
+	}
+}
+
+// finished quits the engines with the game
+func (ex *exhibitionGame) finished() {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	ex.closed = true
+	for _, u := range ex.engines {
+		u.Close()
+	}
+}
+
+// exhibitionHandler schedules an exhibition between the engines named by
+// ?white= and ?black=, thinking ?movetime= about every move
+func exhibitionHandler(w http.ResponseWriter, r *http.Request) {
+	moveTime := defaultMoveTime
+	if s := r.URL.Query().Get("movetime"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid move time", http.StatusBadRequest)
+			return
+		}
+		moveTime = d
+	}
+	game, err := games.OpenExhibition(r.URL.Query().Get("white"), r.URL.Query().Get("black"), moveTime)
+	switch {
+	case errors.Is(err, ErrUnknownEngine):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrDraining), errors.Is(err, ErrServerFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, Message{Type: "exhibition", GameID: game.id, Slug: game.slug})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/engine"
+)
+
+// TestHelperUCIEngine is no test but the engine exhibitions start: the test
+// binary serving the built-in engine over UCI
+func TestHelperUCIEngine(t *testing.T) {
+	if os.Getenv("CHESS_HELPER_UCI_ENGINE") != "1" {
+		t.Skip("only run as an engine")
+	}
+	level, _ := engine.LevelNamed("beginner")
+	engine.ServeUCI(os.Stdin, os.Stdout, level)
+	os.Exit(0)
+}
+
+func TestExhibition(t *testing.T) {
+	t.Setenv("CHESS_HELPER_UCI_ENGINE", "1")
+	defer func(engines map[string]string) { uciEngines = engines }(uciEngines)
+	uciEngines = map[string]string{"helper": os.Args[0] + " -test.run=^TestHelperUCIEngine$"}
+
+	if _, err := games.OpenExhibition("helper", "stockfish", time.Millisecond); !errors.Is(err, ErrUnknownEngine) {
+		t.Fatalf("got %v", err)
+	}
+	game, err := games.OpenExhibition("helper", "helper", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(game.recorder.State().Moves) >= 4 })
+	state := game.recorder.State()
+	if state.Variant != exhibition || state.Engines["white"] != "helper" || state.Engines["black"] != "helper" {
+		t.Errorf("got %+v", state)
+	}
+	if _, played := positionAfter(state.FEN, state.Moves); played != len(state.Moves) {
+		t.Errorf("illegal moves in %+v", state.Moves)
+	}
+	game.Abort()
+	<-game.done
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// exportQueueSize bounds the events waiting to be exported, those
+// published while the broker cannot keep up are dropped
+const exportQueueSize = 1024
+
+var eventsDropped = expvar.NewInt("events_dropped")
+
+// eventSink is a broker the events of the bus are exported to. Publish is
+// given the subject of the event, as in chess.move_played, and the game or
+// player it is about, for brokers that partition by key
+type eventSink interface {
+	Publish(ctx context.Context, subject, key string, data []byte) error
+	Close() error
+}
+
+// exportedEvent is a bus event as it is exported, as JSON
+type exportedEvent struct {
+	Type   string        `json:"type"`
+	Time   time.Time     `json:"time"`
+	GameID string        `json:"gameId,omitempty"`
+	Color  string        `json:"color,omitempty"`
+	Move   *Move         `json:"move,omitempty"`
+	Player string        `json:"player,omitempty"`
+	Game   *exportedGame `json:"game,omitempty"`
+}
+
+// exportedGame is the game of a game_started or game_finished event, its
+// moves as long as each took for anti-cheat pipelines to look at
+type exportedGame struct {
+	Players     map[string]string `json:"players,omitempty"`
+	Engines     map[string]string `json:"engines,omitempty"`
+	Variant     string            `json:"variant,omitempty"`
+	TimeControl *TimeControl      `json:"timeControl,omitempty"`
+	Pool        string            `json:"pool"`
+	Rated       bool              `json:"rated"`
+	Result      string            `json:"result,omitempty"`
+	Moves       []Move            `json:"moves,omitempty"`
+}
+
+// exportedTypes are the subjects the events of the bus are exported as,
+// after the prefix
+var exportedTypes = map[busEventType]string{
+	busGameStarted:   "game_started",
+	busMovePlayed:    "move_played",
+	busGameFinished:  "game_finished",
+	busUserConnected: "user_connected",
+}
+
+func newExportedEvent(event busEvent) exportedEvent {
+	exported := exportedEvent{Type: exportedTypes[event.Type], Time: event.Time, GameID: event.GameID, Color: event.Color, Move: event.Move, Player: event.Player}
+	if event.Type == busGameStarted || event.Type == busGameFinished {
+		state := event.State
+		exported.Game = &exportedGame{Players: state.Players, Engines: state.Engines, Variant: state.Variant, TimeControl: state.TimeControl, Pool: ratingPool(state), Rated: isRated(state), Result: state.Result, Moves: state.Moves}
+	}
+	return exported
+}
+
+type exportedMessage struct {
+	subject, key string
+	data         []byte
+}
+
+// startEventExport exports every event of the bus to the broker of target
+// until stop is called, which flushes what is queued: nats://host:port/prefix
+// publishes to the subjects prefix.type, kafka://host:port,host:port/topic
+// to the topic, keyed by game or player. Nothing is exported if target is
+// empty
+func startEventExport(target string) (stop func(), err error) {
+	if target == "" {
+		return func() {}, nil
+	}
+	sink, prefix, err := openEventSink(target)
+	if err != nil {
+		return nil, err
+	}
+	return exportEvents(sink, prefix), nil
+}
+
+func openEventSink(target string) (sink eventSink, prefix string, err error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, "", fmt.Errorf("invalid event export URL %q, expected nats://host:port/prefix or kafka://host:port/topic", target)
+	}
+	name := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "nats":
+		if name == "" {
+			name = "chess"
+		}
+		u.Path = ""
+		conn, err := nats.Connect(u.String(), nats.Name("simple-chess"), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, "", fmt.Errorf("connecting to NATS: %w", err)
+		}
+		return natsSink{conn}, name, nil
+	case "kafka":
+		if name == "" {
+			return nil, "", fmt.Errorf("invalid event export URL %q, the topic is missing", target)
+		}
+		writer := &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(u.Host, ",")...),
+			Topic:        name,
+			Balancer:     &kafka.Hash{},
+			BatchTimeout: 50 * time.Millisecond,
+			Async:        true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					eventsDropped.Add(int64(len(messages)))
+					log.Printf("cannot export %d events to Kafka: %v", len(messages), err)
+				}
+			},
+		}
+		return kafkaSink{writer}, "", nil
+	default:
+		return nil, "", fmt.Errorf("invalid event export URL %q, the scheme is nats or kafka", target)
+	}
+}
+
+// exportEvents subscribes to the bus and publishes every event to sink,
+// from a goroutine of its own for the publishers never to wait for it
+func exportEvents(sink eventSink, prefix string) (stop func()) {
+	queue := make(chan exportedMessage, exportQueueSize)
+	var cancels []func()
+	for t, name := range exportedTypes {
+		subject := name
+		if prefix != "" {
+			subject = prefix + "." + name
+		}
+		cancels = append(cancels, bus.subscribe(t, func(event busEvent) {
+			data, err := json.Marshal(newExportedEvent(event))
+			if err != nil {
+				log.Printf("cannot encode a %s event: %v", name, err)
+				return
+			}
+			key := event.GameID
+			if key == "" {
+				key = event.Player
+			}
+			select {
+			case queue <- exportedMessage{subject: subject, key: key, data: data}:
+			default:
+				eventsDropped.Add(1)
+			}
+		}))
+	}
+	stopping, done := make(chan struct{}), make(chan struct{})
+	publish := func(message exportedMessage) {
+		if err := sink.Publish(context.Background(), message.subject, message.key, message.data); err != nil {
+			eventsDropped.Add(1)
+			log.Printf("cannot export a %s event: %v", message.subject, err)
+		}
+	}
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case message := <-queue:
+				publish(message)
+			case <-stopping:
+				for {
+					select {
+					case message := <-queue:
+						publish(message)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+		close(stopping)
+		<-done
+		if err := sink.Close(); err != nil {
+			log.Println("event export:", err)
+		}
+	}
+}
+
+type natsSink struct {
+	conn *nats.Conn
+}
+
+func (s natsSink) Publish(ctx context.Context, subject, key string, data []byte) error {
+	return s.conn.Publish(subject, data)
+}
+
+func (s natsSink) Close() error {
+	return s.conn.Drain()
+}
+
+// kafkaSink writes to the topic of its writer, which ignores the subjects
+// of the events: their type is in them
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func (s kafkaSink) Publish(ctx context.Context, subject, key string, data []byte) error {
+	return s.writer.WriteMessages(ctx, kafka.Message{Key: []byte(key), Value: data})
+}
+
+func (s kafkaSink) Close() error {
+	return s.writer.Close()
+}
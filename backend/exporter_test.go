@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+// sinkRecorder is an eventSink keeping what is published to it
+type sinkRecorder struct {
+	mu       sync.Mutex
+	messages []exportedMessage
+	closed   bool
+}
+
+func (s *sinkRecorder) Publish(ctx context.Context, subject, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, exportedMessage{subject: subject, key: key, data: data})
+	return nil
+}
+
+func (s *sinkRecorder) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestEventsAreExported(t *testing.T) {
+	sink := &sinkRecorder{}
+	stop := exportEvents(sink, "chess")
+	state := GameState{ID: "exported", Players: map[string]string{"white": "ana", "black": "bob"}, Result: "1-0", Moves: []Move{{From: "e2", To: "e4", SpentMs: 1200}}}
+	bus.publish(busEvent{Type: busGameStarted, GameID: "exported", State: GameState{ID: "exported", Players: state.Players}})
+	bus.publish(busEvent{Type: busMovePlayed, GameID: "exported", Color: "white", Move: &state.Moves[0]})
+	bus.publish(busEvent{Type: busGameFinished, GameID: "exported", State: state})
+	bus.publish(busEvent{Type: busUserConnected, Player: "exported-player"})
+	stop()
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if !sink.closed {
+		t.Error("the sink was not closed")
+	}
+	var got []exportedEvent
+	for _, message := range sink.messages {
+		if message.key != "exported" && message.key != "exported-player" {
+			continue
+		}
+		var event exportedEvent
+		if err := json.Unmarshal(message.data, &event); err != nil {
+			t.Fatal(err)
+		}
+		if message.subject != "chess."+event.Type {
+			t.Errorf("got subject %s for a %s event", message.subject, event.Type)
+		}
+		got = append(got, event)
+	}
+	if len(got) != 4 || got[0].Type != "game_started" || got[1].Move.SpentMs != 1200 || got[3].Player != "exported-player" {
+		t.Fatalf("got %+v", got)
+	}
+	if game := got[2].Game; game == nil || game.Result != "1-0" || !game.Rated || len(game.Moves) != 1 || game.Players["black"] != "bob" {
+		t.Errorf("got finished game %+v", game)
+	}
+}
+
+func TestInvalidEventExportTargets(t *testing.T) {
+	for _, target := range []string{"localhost:4222", "amqp://localhost", "kafka://localhost:9092"} {
+		if _, err := startEventExport(target); err == nil {
+			t.Errorf("%s was accepted", target)
+		}
+	}
+	sink, prefix, err := openEventSink("kafka://a:9092,b:9092/games")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if writer := sink.(kafkaSink).writer; writer.Topic != "games" || writer.Addr.String() != "a:9092,b:9092" || prefix != "" {
+		t.Errorf("got topic %s at %s", writer.Topic, writer.Addr)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import "sync"
+
+// feedBufferSize bounds the values waiting for a subscriber, one that lets
+// more pile up is dropped
+const feedBufferSize = 64
+
+// eventFeeds hands what happens in live games, as it does, to those
+// subscribed to them: the events recorded, or the kibitz of spectators
+type eventFeeds[T any] struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan T]struct{}
+}
+
+var feeds = newEventFeeds[Event]()
+
+func newEventFeeds[T any]() *eventFeeds[T] {
+	return &eventFeeds[T]{subscribers: map[string]map[chan T]struct{}{}}
+}
+
+// subscribe is the feed of the game id from now on, until cancel is
+// called; it is closed then, or if the subscriber falls behind
+func (f *eventFeeds[T]) subscribe(id string) (values <-chan T, cancel func()) {
+	ch := make(chan T, feedBufferSize)
+	f.mu.Lock()
+	if f.subscribers[id] == nil {
+		f.subscribers[id] = map[chan T]struct{}{}
+	}
+	f.subscribers[id][ch] = struct{}{}
+	f.mu.Unlock()
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.drop(id, ch)
+	}
+}
+
+func (f *eventFeeds[T]) publish(id string, value T) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers[id] {
+		select {
+		case ch <- value:
+		default:
+			f.drop(id, ch)
+		}
+	}
+}
+
+// drop closes ch, unless it was dropped already
+func (f *eventFeeds[T]) drop(id string, ch chan T) {
+	if _, ok := f.subscribers[id][ch]; !ok {
+		return
+	}
+	delete(f.subscribers[id], ch)
+	if len(f.subscribers[id]) == 0 {
+		delete(f.subscribers, id)
+	}
+	close(ch)
+}
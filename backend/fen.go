@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// fenHandler answers the FEN of a game after ?move=N half-moves,
+// after the last one played if N is not given
+func fenHandler(w http.ResponseWriter, r *http.Request) {
+	state, ok := loadWatchedGame(w, r)
+	if !ok || notModified(w, r, state) {
+		return
+	}
+	moves := state.Moves
+	if value := r.URL.Query().Get("move"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > len(moves) {
+			http.Error(w, "invalid move number", http.StatusBadRequest)
+			return
+		}
+		moves = moves[:n]
+	}
+	position, played := positionAfter(state.FEN, moves)
+	if played < len(moves) {
+		m := moves[played]
+		http.Error(w, fmt.Sprintf("move %d, %s, is not legal", played+1, m.UCI()), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, position.FEN())
+}
+
+// positionProblems name the errors of chess.Position.Validate for clients
+var positionProblems = map[error]string{
+	chess.ErrKings:         "kings",
+	chess.ErrOppositeCheck: "check",
+	chess.ErrPawnRank:      "pawns",
+	chess.ErrCastling:      "castling",
+	chess.ErrEnPassant:     "en_passant",
+	chess.ErrMaterial:      "material",
+}
+
+// fenValidation is whether a FEN sets up a position games and analyses can
+// start at: FEN is it as the server writes it, Problem what is wrong with
+// it otherwise, syntax if it does not parse
+type fenValidation struct {
+	Valid   bool   `json:"valid"`
+	FEN     string `json:"fen,omitempty"`
+	Problem string `json:"problem,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// parseLegalFEN parses fen, refusing the positions that cannot come up in
+// a game
+func parseLegalFEN(fen string) (chess.Position, error) {
+	position, err := chess.ParseFEN(fen)
+	if err != nil {
+		return chess.Position{}, err
+	}
+	if err := position.Validate(); err != nil {
+		return chess.Position{}, err
+	}
+	return position, nil
+}
+
+func validateFEN(fen string) fenValidation {
+	position, err := parseLegalFEN(fen)
+	switch {
+	case err == nil:
+		return fenValidation{Valid: true, FEN: position.FEN()}
+	case errors.Is(err, chess.ErrIllegalPosition):
+		return fenValidation{Problem: positionProblems[err], Error: err.Error()}
+	default:
+		return fenValidation{Problem: "syntax", Error: err.Error()}
+	}
+}
+
+// validateFENMessage answers the validate_fen message asking about fen,
+// with the FEN as the server writes it or ILLEGAL_POSITION
+func validateFENMessage(fen string) Message {
+	v := validateFEN(fen)
+	if !v.Valid {
+		return errorMessage(CodeIllegalPosition, v.Problem)
+	}
+	return Message{Type: "validate_fen", FEN: v.FEN}
+}
+
+// validateFENHandler tells whether the FEN posted as in {"fen": ...} sets
+// up a legal position, answering a fenValidation either way
+func validateFENHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FEN string `json:"fen"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid FEN validation request", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, validateFEN(req.FEN))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFENAtMove(t *testing.T) {
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.send(move("2", "e7", "e5"))
+	white.expect("move")
+	waitFor(t, func() bool { return len(game.recorder.State().Moves) == 2 })
+
+	for query, want := range map[string]string{
+		"?move=0": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1\n",
+		"?move=1": "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1\n",
+		"":        "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2\n",
+	} {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/games/"+game.id+"/fen"+query, nil))
+		if w.Body.String() != want {
+			t.Errorf("%s: got %q, want %q", query, w.Body, want)
+		}
+	}
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/games/"+game.id+"/fen?move=3", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d past the last move", w.Code)
+	}
+}
+
+func TestValidateFEN(t *testing.T) {
+	for body, want := range map[string]fenValidation{
+		`{"fen": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"}`: {Valid: true, FEN: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+		`{"fen": "4k3/8/8/8/8/8/8/4K3 w K - 0 1"}`:                            {Problem: "castling"},
+		`{"fen": "4k3/8/8/8/8/8/8/4K2r b - - 0 1"}`:                           {Problem: "check"},
+		`{"fen": "8/8/8"}`: {Problem: "syntax"},
+	} {
+		w := httptest.NewRecorder()
+		validateFENHandler(w, httptest.NewRequest("POST", "/validate-fen", strings.NewReader(body)))
+		var got fenValidation
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Valid != want.Valid || got.FEN != want.FEN || got.Problem != want.Problem || got.Valid != (got.Error == "") {
+			t.Errorf("%s: got %+v", body, got)
+		}
+	}
+
+	// lobby and game connections ask over the connection
+	viewer := newTestPlayer(t)
+	joinLobby(viewer.conn)
+	viewer.expect("lobby")
+	viewer.send(Message{Type: "validate_fen", FEN: "P3k3/8/8/8/8/8/8/4K3 w - - 0 1"})
+	if got := viewer.expect("error", CodeIllegalPosition); len(got.Args) != 1 || got.Args[0] != "pawns" {
+		t.Fatalf("got %+v", got)
+	}
+	_, white, _ := startTestGame(t)
+	white.send(Message{Type: "validate_fen", FEN: "4k3/8/8/8/8/8/8/4K3 w - - 0 1"})
+	if got := white.expect("validate_fen"); got.FEN != "4k3/8/8/8/8/8/8/4K3 w - - 0 1" {
+		t.Fatalf("got %+v", got)
+	}
+}
@@ -1,85 +1,1169 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/alvaronaschez/simple-chess/chess"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ChessGame struct {
-	whiteWebsocket *websocket.Conn
-	blackWebsocket *websocket.Conn
+	id       string
+	slug     string
+	recorder *gameRecorder
+	// recording is nil unless sessions are recorded
+	recording *sessionRecording
+	// ctx carries the game's trace, it is cancelled with the reason
+	// to stop the game or once the game is over
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	// tokens let each color reconnect to the game
+	tokens map[string]string
+
+	// owned by the game loop once it has started
+	white, black *outbox
+	// mailbox holds what the game loop has yet to handle: *inbound,
+	// reconnection and kick values
+	mailbox chan any
+	// joined is closed once the second player is in the game,
+	// done once the game loop has returned
+	joined, done chan struct{}
+
+	mu        sync.Mutex
+	connected map[string]bool
+	abandoned bool
+	// ended games are over, they cannot be resumed either
+	ended bool
+
+	// variant is the variant of the game, standard chess by default
+	variant variant
+	// coaches are the outboxes of the coaches by seat, owned by the loop
+	coaches map[string]*outbox
+
+	// simul is the simul the game is board number board of, if any,
+	// and match the bughouse match
+	simul *simul
+	match *bughouseMatch
+	board int
+
+	// series is the match the game is game number board of, if any
+	series *series
+
+	// band is the ratings of the opponents the creator of the game
+	// accepts, owned by the manager while the game is a seek
+	band ratingBand
+	// creator is the seat of who created the game, waiting for an
+	// opponent, and options what they asked for it
+	creator string
+	options GameOptions
+
+	// handoff is the instance the game is handed off to, set before its
+	// context is cancelled with errHandedOff
+	handoff string
+}
+
+// mailboxSize bounds the messages waiting for a game loop, readers
+// stop reading their connection while it is full
+const mailboxSize = 16
+
+// maxGameRestarts is how many times a crashed game loop is started
+// again before the game is aborted
+const maxGameRestarts = 3
+
+// kick asks the game loop to disconnect the player of color
+type kick struct {
+	color string
+}
+
+// reconnection is a player coming back to a started game, taking over
+// from the connection still in it if takeover is set
+type reconnection struct {
+	color string
+	conn  *connection
+	// lastSeq is the last message the client saw, -1 if unknown
+	lastSeq  int
+	takeover bool
 }
 
+// the validate tags describe what clients are allowed to send
 type Message struct {
-	Type      string `json:"type" validate:"required,oneof=start move error"`
-	Color     string `json:"color" validate:"oneof=white black,required_if=Type start"`
-	From      string `json:"from" validate:"required_if=Type move"`
-	To        string `json:"to" validate:"required_if=Type move"`
-	Promotion string `json:"promotion" validate:"oneof=q r b k,required_if=Type move"`
+	Type    string `json:"type" validate:"required,oneof=move drop name_piece vote ack resend clock_sync resign draw_offer claim_draw pause_offer refuse_offers takeback_offer spectator_token board_move board_delete board_reset board_grant board_annotate quick replay_next replay_prev replay_jump replay_flip coach_invite coach_dismiss coach_suggest auth cancel_seek validate_fen"`
+	Seq     int    `json:"seq,omitempty"`
+	Version int    `json:"version,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Field   string `json:"field,omitempty"`
+	GameID  string `json:"gameId,omitempty"`
+	// Slug makes the short link of the game, /g/{slug}
+	Slug string `json:"slug,omitempty"`
+	// SimulID is the simul a game is board number Board of, MatchID the
+	// match it is game number Board of; Score is how the match goes for
+	// whoever it is sent to, as in 1.5-0.5, and Result once it is decided
+	// win, loss or draw
+	SimulID string `json:"simulId,omitempty"`
+	MatchID string `json:"matchId,omitempty"`
+	Score   string `json:"score,omitempty"`
+	Board   int    `json:"board,omitempty"`
+	// Variant is bughouse, where Board is the board of the match,
+	// or hand_and_brain, where Role is brain for the brains; on an
+	// analysis board Role is owner, writer or reader
+	Variant   string `json:"variant,omitempty"`
+	Role      string `json:"role,omitempty" validate:"required_if=Type board_grant"`
+	Token     string `json:"token,omitempty"`
+	Color     string `json:"color" validate:"required_if=Type start,omitempty,oneof=white black"`
+	From      string `json:"from" validate:"required_if=Type move,required_if=Type vote,required_if=Type board_move"`
+	To        string `json:"to" validate:"required_if=Type move,required_if=Type drop,required_if=Type vote,required_if=Type board_move,required_if=Type coach_suggest"`
+	Promotion string `json:"promotion" validate:"omitempty,oneof=q r b n"`
+	// Drop is the piece a bughouse player puts on To, or was handed
+	Drop string `json:"drop,omitempty" validate:"required_if=Type drop,omitempty,oneof=p n b r q"`
+	// Piece is the piece a brain names for its hand to move
+	Piece string `json:"piece,omitempty" validate:"required_if=Type name_piece,omitempty,oneof=p n b r q k"`
+	Moves []Move `json:"moves,omitempty"`
+
+	// Key identifies Text, which is Key localized with Args
+	Key  string   `json:"key,omitempty"`
+	Args []string `json:"args,omitempty"`
+	// MoveID is chosen by the client so that resubmitted moves are only played once
+	MoveID string `json:"moveId,omitempty"`
+	// ServerTime and ClientTime are Unix milliseconds
+	ServerTime int64 `json:"serverTime,omitempty"`
+	ClientTime int64 `json:"clientTime,omitempty"`
+	// Result and Reason tell how a game over was decided
+	Result string `json:"result,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// WhiteTime and BlackTime are the milliseconds left on the clocks of
+	// timed games, as the server counts them
+	WhiteTime int64 `json:"whiteTime,omitempty"`
+	BlackTime int64 `json:"blackTime,omitempty"`
+	// Votes are the moves the crowd of a voting game voted for so far,
+	// counted at Deadline, in Unix milliseconds
+	Votes    []VoteTally `json:"votes,omitempty"`
+	Deadline int64       `json:"deadline,omitempty"`
+	// Blindfold tells a player they play blindfold, who when resuming
+	// gets the number of moves played, Ply, and only the last of the Moves
+	Blindfold bool `json:"blindfold,omitempty"`
+	Ply       int  `json:"ply,omitempty"`
+	// BoardID is an analysis board, Rev the revision of it an operation was
+	// made on, or made. Node is a move of its variation tree played after
+	// Parent, 0 for the position the tree starts at, which FEN sets
+	BoardID string      `json:"boardId,omitempty"`
+	Rev     int         `json:"rev,omitempty"`
+	Node    int         `json:"node,omitempty" validate:"required_if=Type board_delete,required_if=Type board_annotate"`
+	Parent  int         `json:"parent,omitempty"`
+	FEN     string      `json:"fen,omitempty" validate:"required_if=Type board_reset"`
+	Nodes   []BoardNode `json:"nodes,omitempty"`
+	// Participant is someone connected to an analysis board, Members
+	// everyone who is
+	Participant string        `json:"participant,omitempty"`
+	Members     []BoardMember `json:"members,omitempty"`
+	// NAGs, Comment and Arrows annotate Node
+	NAGs    []int    `json:"nags,omitempty"`
+	Comment string   `json:"comment,omitempty"`
+	Arrows  []string `json:"arrows,omitempty"`
+	// Preferences are those of the player a game starts for
+	Preferences *Preferences `json:"preferences,omitempty"`
+	// Rated games change the ratings of their players
+	Rated bool `json:"rated,omitempty"`
+	// HeadToHead is the record of a player against their opponent, sent
+	// as the game starts if they played before
+	HeadToHead *gameCount `json:"headToHead,omitempty"`
+	// Spectators is how many watch the game live
+	Spectators int `json:"spectators,omitempty"`
+	// Quick is the quick message a player sent their opponent
+	Quick QuickMessage `json:"quick,omitempty" validate:"required_if=Type quick,omitempty,min=1,max=10"`
+	// Rules are those of a game as it starts, for both players to agree on
+	Rules *GameOptions `json:"rules,omitempty"`
+	// Seeks are those the lobby shows, Players the accounts playing a game
+	// by color
+	Seeks   []seek            `json:"seeks,omitempty"`
+	Players map[string]string `json:"players,omitempty"`
+	// BracketMatch is a match of the bracket BracketID as it changes
+	BracketID    string        `json:"bracketId,omitempty"`
+	BracketMatch *bracketMatch `json:"bracketMatch,omitempty"`
+	// Chat is a message of the chat of a bracket
+	Chat *Comment `json:"chat,omitempty"`
+	// URL is where a client is sent to in a redirect message, the instance
+	// owning the game it asked for
+	URL string `json:"url,omitempty"`
+	// Notification is one just added to the inbox of a player, Unread
+	// how many of theirs are unread
+	Notification *Notification `json:"notification,omitempty"`
+	Unread       int           `json:"unread,omitempty"`
+}
+
+// VoteTally is how many voters voted for the move in UCI notation
+type VoteTally struct {
+	Move  string `json:"move"`
+	Count int    `json:"count"`
+}
+
+func (message Message) Move() *Move {
+	return &Move{ID: message.MoveID, From: message.From, To: message.To, Promotion: message.Promotion, Drop: message.Drop}
+}
+
+func newChessGame(ctx context.Context, id string, recorder *gameRecorder, tokens map[string]string) *ChessGame {
+	ctx, cancel := context.WithCancelCause(ctx)
+	game := &ChessGame{
+		id:        id,
+		slug:      recorder.state.Slug,
+		recorder:  recorder,
+		recording: newSessionRecording(id),
+		ctx:       ctx,
+		cancel:    cancel,
+		tokens:    tokens,
+		white:     newOutbox(nil),
+		black:     newOutbox(nil),
+		mailbox:   make(chan any, mailboxSize),
+		joined:    make(chan struct{}),
+		done:      make(chan struct{}),
+		connected: map[string]bool{},
+		creator:   "white",
+		coaches:   map[string]*outbox{coachSeat("white"): newOutbox(nil), coachSeat("black"): newOutbox(nil)},
+	}
+	game.variant = variantKindOf(recorder.state.Variant).newGame(game)
+	return game
+}
+
+func NewChessGame(ctx context.Context, conn *connection) *ChessGame {
+	return openGame(ctx, conn, "", nil, nil, 0)
+}
+
+// openGame creates a game of variant with conn waiting for an opponent, as
+// board board of simul s or bughouse match b unless they are nil. Only
+// standard games on their own start where conn asks for, with it playing
+// the color it asks for; the others have it play white
+func openGame(ctx context.Context, conn *connection, variant string, s *simul, b *bughouseMatch, board int) *ChessGame {
+	id := newShardedGameID()
+	ctx, span := tracer.Start(ctx, "game.create", trace.WithAttributes(attribute.String("chess.game", id)))
+	defer span.End()
+	tokens := map[string]string{"white": newToken(), "black": newToken()}
+	// the game outlives the request creating it, only the manager stops it
+	slug := newShortLink(id)
+	// the games of simuls and matches are all played alike
+	tc := timeControl
+	if s == nil && b == nil {
+		tc = timeControlFor(conn)
+	}
+	recorder := newGameRecorder(id, slug, tc, variant)
+	options := conn.options
+	if variant != "" || s != nil || b != nil || board != 0 {
+		options.Color, options.FEN = "", ""
+	}
+	recorder.state.FEN = options.FEN
+	game := newChessGame(trace.ContextWithSpan(games.ctx, span), id, recorder, tokens)
+	game.simul, game.match, game.board = s, b, board
+	game.creator, game.options = options.seat(), options
+	creator := game.creator
+	game.attach(creator, conn)
+	game.connected[creator] = true
+	game.recorder.Record(game.ctx, GameCreated, "", nil)
+	game.recorder.RecordJoin(game.ctx, creator, conn.player)
+	game.recordRules(options, creator)
+	if options.Blindfold {
+		game.recorder.Record(game.ctx, PlayerBlindfolded, creator, nil)
+	}
+	// the loop starts right away to notice if the player leaves while waiting
+	go superviseGame(game)
+	go game.forward(creator, conn)
+	return game
 }
 
-func NewChessGame(ws *websocket.Conn) *ChessGame {
-	game := ChessGame{whiteWebsocket: ws}
-	return &game
+// restoreChessGame recreates a game that was in progress before a restart,
+// its players come back to it with Resume
+func restoreChessGame(tokens map[string]string, state GameState) *ChessGame {
+	ctx, span := tracer.Start(games.ctx, "game.restore", trace.WithAttributes(attribute.String("chess.game", state.ID)))
+	defer span.End()
+	game := newChessGame(ctx, state.ID, restoreGameRecorder(state), tokens)
+	// a reserved game still waits for its players to take their seats
+	if !state.Reserved || state.Started {
+		close(game.joined)
+	}
+	games.Register(game)
+	games.unattend(game)
+	go superviseGame(game)
+	return game
 }
 
-var ErrCannotJoinStartedGame = errors.New("cannot join a started game")
+var (
+	ErrCannotJoinStartedGame = errors.New("cannot join a started game")
+	errWaitingPlayerLeft     = errors.New("waiting player left")
+	errGameAborted           = errors.New("game aborted")
+)
 
-func (game *ChessGame) Join(ws *websocket.Conn) error {
+func (game *ChessGame) Join(ctx context.Context, conn *connection) error {
+	_, span := tracer.Start(ctx, "game.join", trace.WithLinks(trace.LinkFromContext(game.ctx)))
+	defer span.End()
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	if game.abandoned {
+		recordError(span, errWaitingPlayerLeft)
+		return errWaitingPlayerLeft
+	}
 	// you cannot join the same game twice
-	if game.blackWebsocket != nil {
+	color := opponent(game.creator)
+	if game.connected[color] {
+		recordError(span, ErrCannotJoinStartedGame)
 		return ErrCannotJoinStartedGame
 	}
-	game.blackWebsocket = ws
-	whiteChannel := make(chan Message)
-	blackChannel := make(chan Message)
-	go playChess(game.whiteWebsocket, game.blackWebsocket, whiteChannel, blackChannel)
-	go forwardFromWebsocketToChannel(game.whiteWebsocket, whiteChannel)
-	go forwardFromWebsocketToChannel(game.blackWebsocket, blackChannel)
+	game.attach(color, conn)
+	game.connected[color] = true
+	game.recorder.RecordJoin(game.ctx, color, conn.player)
+	if conn.options.Private && !game.recorder.State().Private {
+		game.recorder.Record(game.ctx, GameMadePrivate, color, nil)
+	}
+	if conn.options.Rated != nil && !*conn.options.Rated && !game.recorder.State().Casual {
+		game.recorder.Record(game.ctx, GameMadeCasual, color, nil)
+	}
+	if conn.options.Blindfold {
+		game.recorder.Record(game.ctx, PlayerBlindfolded, color, nil)
+	}
+	close(game.joined)
+	go game.forward(color, conn)
+	return nil
+}
+
+var (
+	ErrInvalidResumeToken = errors.New("invalid resume token")
+	ErrAlreadyConnected   = errors.New("player already connected")
+	ErrTakenOver          = errors.New("game resumed on another connection")
+)
+
+func (game *ChessGame) Resume(ctx context.Context, conn *connection, token string, lastSeq int) error {
+	return game.resume(ctx, conn, token, lastSeq, false)
+}
+
+// Takeover is Resume for a client whose network changed: the connection
+// it had may not be known to have dropped yet, a started game hands its
+// seat over to conn then, see the fast reconnect handshake of admit
+func (game *ChessGame) Takeover(ctx context.Context, conn *connection, token string, lastSeq int) error {
+	return game.resume(ctx, conn, token, lastSeq, true)
+}
+
+func (game *ChessGame) resume(ctx context.Context, conn *connection, token string, lastSeq int, takeover bool) error {
+	_, span := tracer.Start(ctx, "game.resume", trace.WithLinks(trace.LinkFromContext(game.ctx)))
+	defer span.End()
+	game.mu.Lock()
+	if game.abandoned || game.ended {
+		game.mu.Unlock()
+		recordError(span, ErrGameNotFound)
+		return ErrGameNotFound
+	}
+	// color is the seat the token is for, a brain's in hand and brain or
+	// a coach's
+	var color string
+	for _, seat := range append(game.seats(), coachSeats...) {
+		if game.tokens[seat] != "" && subtle.ConstantTimeCompare([]byte(game.tokens[seat]), []byte(token)) == 1 {
+			color = seat
+		}
+	}
+	if color == "" {
+		game.mu.Unlock()
+		recordError(span, ErrInvalidResumeToken)
+		return ErrInvalidResumeToken
+	}
+	// only the game loop can hand over a seat
+	takeover = takeover && game.hasJoined()
+	if game.connected[color] && !takeover {
+		game.mu.Unlock()
+		recordError(span, ErrAlreadyConnected)
+		return ErrAlreadyConnected
+	}
+	game.connected[color] = true
+	// the seats of a reserved game are taken as its players come, the
+	// loop only handles them once it started
+	if game.recorder.State().Reserved && !game.hasJoined() {
+		game.takeSeat(color, conn)
+		game.mu.Unlock()
+		games.attend(game)
+		return nil
+	}
+	game.mu.Unlock()
+	games.attend(game)
+	if !game.post(reconnection{color: color, conn: conn, lastSeq: lastSeq, takeover: takeover}) {
+		recordError(span, ErrGameNotFound)
+		return ErrGameNotFound
+	}
 	return nil
 }
 
-func playChess(
-	whiteWebsocket, blackWebsocket *websocket.Conn,
-	whiteChannel, blackChannel <-chan Message,
-) {
-	turnWhite := true
-	whiteWebsocket.WriteJSON(Message{Type: "start", Color: "white"})
-	blackWebsocket.WriteJSON(Message{Type: "start", Color: "black"})
+// Kick disconnects the player of color, who can still resume the game
+func (game *ChessGame) Kick(color string) {
+	game.post(kick{color: color})
+}
+
+// Abort ends the game without a result
+func (game *ChessGame) Abort() {
+	game.cancel(errGameAborted)
+}
+
+// post hands message to the game loop, reporting false if the game is done
+func (game *ChessGame) post(message any) bool {
+	select {
+	case game.mailbox <- message:
+		return true
+	case <-game.done:
+		return false
+	}
+}
+
+// disconnect reports whether the game is left with no player connected,
+// to be abandoned unless one resumes it within reconnectGrace; paused
+// games wait for their players to resume them
+func (game *ChessGame) disconnect(color string) bool {
+	paused := game.recorder.State().Paused
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	game.connected[color] = false
+	left := !game.connected["white"] && !game.connected["black"]
+	if paused && left {
+		games.unattend(game)
+	}
+	return !paused && left
+}
+
+// abandon reports whether the game is abandoned, still left by both
+// players once reconnectGrace is over
+func (game *ChessGame) abandon() bool {
+	paused := game.recorder.State().Paused
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	game.abandoned = !paused && !game.connected["white"] && !game.connected["black"]
+	return game.abandoned
+}
+
+// isAbandoned reports whether white left before an opponent joined
+func (game *ChessGame) isAbandoned() bool {
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	return game.abandoned
+}
+
+// hasJoined reports whether black is or was in the game
+func (game *ChessGame) hasJoined() bool {
+	select {
+	case <-game.joined:
+		return true
+	default:
+		return false
+	}
+}
+
+// bothConnected reports whether both players are in the game
+func (game *ChessGame) bothConnected() bool {
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	return game.connected["white"] && game.connected["black"]
+}
+
+// seats are white, black and those of the variant, like the brains in
+// hand and brain
+func (game *ChessGame) seats() []string {
+	var seats []string
+	for seat := range game.variant.seats() {
+		seats = append(seats, seat)
+	}
+	slices.Sort(seats)
+	return append([]string{"white", "black"}, seats...)
+}
+
+// outboxes are those of every seat of the game, the coaches' among them
+func (game *ChessGame) outboxes() map[string]*outbox {
+	boxes := map[string]*outbox{"white": game.white, "black": game.black}
+	maps.Copy(boxes, game.variant.seats())
+	maps.Copy(boxes, game.coaches)
+	return boxes
+}
+
+// attach connects the player of color, or any other seat, to its outbox,
+// only the game loop may do so once it has started
+func (game *ChessGame) attach(color string, conn *connection) {
+	conn.recording, conn.color = game.recording, color
+	conn.seated.Store(true)
+	if conn.client != "" {
+		seatClient(conn.client, game)
+	}
+	game.recording.record(color, "connect", nil)
+	switch color {
+	case "white":
+		game.white.Attach(conn)
+	case "black":
+		game.black.Attach(conn)
+	case coachSeat("white"), coachSeat("black"):
+		game.coaches[color].Attach(conn)
+	default:
+		game.variant.seats()[color].Attach(conn)
+	}
+}
+
+// superviseGame runs the game loop, starting it again from the recorded
+// state if it panics, and cleans up once the game is over; the instance
+// owns the game meanwhile
+func superviseGame(game *ChessGame) {
+	release := claimGame(game)
+	defer close(game.done)
+	defer game.recording.Close()
+	defer release()
+	defer games.Unregister(game)
+	defer game.cancel(nil)
+	// the other board of a bughouse match is decided along with this one
+	defer game.variant.finished()
+	defer func() {
+		if state := game.recorder.State(); state.Finished {
+			bus.publish(busEvent{Type: busGameFinished, GameID: game.id, State: state})
+		}
+	}()
+	for restarts := 0; runGameLoop(game); restarts++ {
+		if restarts == maxGameRestarts {
+			game.abort()
+			return
+		}
+	}
+}
+
+// runGameLoop reports whether the game loop crashed, dropping whatever
+// it was handling
+func runGameLoop(game *ChessGame) (crashed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("game %s crashed: %v\n%s", game.id, r, debug.Stack())
+			crashed = true
+		}
+	}()
+	playChess(game)
+	return false
+}
+
+// abort ends a game the server cannot go on with
+func (game *ChessGame) abort() {
+	// the context of the game may be cancelled already
+	game.recorder.Record(context.WithoutCancel(game.ctx), GameAbandoned, "", nil)
+	game.end("aborted")
+}
+
+// expire ends a game that lasted maxGameDuration: drawn once both players
+// moved, aborted before
+func (game *ChessGame) expire() {
+	if len(game.recorder.State().Moves) < 2 {
+		game.abort()
+		return
+	}
+	game.recorder.Record(game.ctx, GameAdjudicated, "", nil)
+	game.end("max_duration")
+}
+
+// stop ends the game loop on behalf of whoever cancelled its context:
+// an aborted game is over, while the players of a server shutting down
+// can resume their game once it is back
+func (game *ChessGame) stop() {
+	if errors.Is(context.Cause(game.ctx), errGameAborted) {
+		game.abort()
+		return
+	}
+	if errors.Is(context.Cause(game.ctx), errHandedOff) {
+		game.redirect()
+		return
+	}
+	for _, box := range game.outboxes() {
+		if box.conn != nil {
+			closeWithError(box.conn, ErrShuttingDown)
+		}
+	}
+	game.variant.hangUp(func(conn *connection) { closeWithError(conn, ErrShuttingDown) })
+}
+
+// waitForOpponent runs the game loop until the second player joins,
+// reporting false if the first one left before. Those seeking may withdraw
+// with cancel_seek, and seeks are withdrawn once they waited for seekTTL;
+// the other games waiting ignore both
+func (game *ChessGame) waitForOpponent() bool {
+	boxes := game.outboxes()
+	var expired <-chan time.Time
+	if seekTTL > 0 {
+		timer := time.NewTimer(seekTTL)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		// once joined the mailbox is for the game itself
+		select {
+		case <-game.joined:
+			return true
+		default:
+		}
+		select {
+		case <-game.joined:
+			return true
+		case <-game.ctx.Done():
+			game.stop()
+			return false
+		case <-expired:
+			if game.withdrawSeek(boxes[game.creator], ErrSeekExpired) {
+				return false
+			}
+		case message := <-game.mailbox:
+			// only the creator can be connected, or the players of a
+			// reserved game, and nothing but the connection itself can be
+			// talked about yet
+			var in inbound
+			switch message := message.(type) {
+			case spectatorCount:
+				continue
+			case kick:
+				// the reader then reports the player disconnected, who
+				// leaves the seat; the seats of a reserved game are taken
+				// under game.mu
+				box, ok := boxes[message.color]
+				if !ok {
+					continue
+				}
+				game.mu.Lock()
+				conn := box.conn
+				game.mu.Unlock()
+				if conn != nil {
+					closeWithError(conn, ErrKicked)
+				}
+				continue
+			case *inbound:
+				in = *message
+				inbounds.Put(message)
+			default:
+				log.Printf("game %s: unexpected mailbox message %T before it started", game.id, message)
+				continue
+			}
+			box := boxes[in.color]
+			if in.err == nil && in.message.Type == "cancel_seek" {
+				if game.withdrawSeek(box, nil) {
+					return false
+				}
+				box.SendTransient(errorMessage(CodeNotSeeking))
+				continue
+			}
+			if in.err == nil {
+				handleConnectionMessage(box, in.message)
+				continue
+			}
+			if errors.Is(in.err, ErrInvalidPayload) {
+				box.SendTransient(errorMessage(CodeInvalidPayload))
+				continue
+			}
+			if game.leaveSeat(in.color, box) {
+				return true
+			}
+			if !game.recorder.State().Reserved {
+				return false
+			}
+		}
+	}
+}
+
+// withdrawSeek abandons the game if it is still a seek, reporting whether
+// it was, and disconnects its creator: with err if it expired, telling them
+// it is withdrawn otherwise
+func (game *ChessGame) withdrawSeek(box *outbox, err error) bool {
+	if !games.withdraw(game) {
+		return false
+	}
+	game.mu.Lock()
+	game.abandoned = true
+	game.mu.Unlock()
+	game.recorder.Record(game.ctx, GameAbandoned, "", nil)
+	if box.conn == nil {
+		return true
+	}
+	if err != nil {
+		closeWithError(box.conn, err)
+	} else {
+		box.conn.Write(Message{Type: "cancel_seek", GameID: game.id})
+		box.conn.Close("")
+	}
+	box.Attach(nil)
+	return true
+}
+
+// leaveSeat disconnects the player of color waiting in the game, reporting
+// whether both are in after all, the game starting then. Leaving abandons
+// any game but a reserved one, that waits unattended for its players instead
+func (game *ChessGame) leaveSeat(color string, box *outbox) (started bool) {
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	game.connected[color] = false
+	box.Attach(nil)
+	game.recorder.Record(game.ctx, PlayerDisconnected, color, nil)
+	select {
+	case <-game.joined:
+		// the opponent got in just now, the player can still resume
+		return true
+	default:
+	}
+	switch {
+	case !game.recorder.State().Reserved:
+		game.abandoned = true
+		game.recorder.Record(game.ctx, GameAbandoned, "", nil)
+	case !game.connected["white"] && !game.connected["black"]:
+		games.unattend(game)
+	}
+	return false
+}
+
+// playChess is the game loop, the only goroutine touching the outboxes
+// once started; when the game is over, so are the readers of the connections
+func playChess(game *ChessGame) {
+	if !game.waitForOpponent() {
+		return
+	}
+	ctx, recorder := game.ctx, game.recorder
+	boxes := game.outboxes()
+
+	state := recorder.State()
+	turn := state.Turn()
+	if !state.Started {
+		for _, seat := range game.seats() {
+			box := boxes[seat]
+			color, role := seatRole(seat)
+			start := Message{Type: "start", Version: box.version, GameID: game.id, Slug: game.slug, Token: game.tokens[seat], Color: color, Role: role, Board: game.board, Variant: state.Variant}
+			start.Blindfold = role == "" && slices.Contains(state.Blindfolded, color)
+			start.Rated = isRated(state)
+			start.Rules = gameRules(state)
+			start.WhiteTime, start.BlackTime = state.Clocks(time.Now())
+			if box.conn != nil {
+				start.Preferences = box.conn.preferences
+			}
+			if role == "" {
+				start.HeadToHead = startRecord(state, color)
+			}
+			if game.series != nil {
+				box.Send(game.series.scoreMessage(game, color))
+			}
+			box.Send(start)
+		}
+		recorder.Record(ctx, GameStarted, "", nil)
+		bus.publish(busEvent{Type: busGameStarted, GameID: game.id, State: recorder.State()})
+	}
+
+	// flag fires once the clock of the player to move may have run out,
+	// it never does in untimed games
+	flag := time.NewTimer(0)
+	flag.Stop()
+	defer flag.Stop()
+	armFlag := func() {
+		state := recorder.State()
+		if state.TimeControl == nil || state.Paused {
+			return
+		}
+		white, black := state.Clocks(time.Now())
+		left := white
+		if turn == "black" {
+			left = black
+		}
+		flag.Reset(time.Duration(left) * time.Millisecond)
+	}
+	// flagged reports whether the clock of color ran out, ending the game if so
+	flagged := func(color string) bool {
+		state := recorder.State()
+		if state.TimeControl == nil {
+			return false
+		}
+		white, black := state.Clocks(time.Now())
+		if (color == "white" && white > 0) || (color == "black" && black > 0) {
+			return false
+		}
+		// there is no win on time for a side that could never mate
+		position, _ := game.variant.position(state)
+		winner := chess.White
+		if color == "white" {
+			winner = chess.Black
+		}
+		if position.CanMate(winner) {
+			recorder.Record(ctx, GameFlagged, color, nil)
+			game.end("timeout")
+		} else {
+			recorder.Record(ctx, GameFlaggedDrawn, color, nil)
+			game.end("timeout_vs_insufficient_material")
+		}
+		return true
+	}
+	armFlag()
+
+	// left fires once both players have been gone for reconnectGrace
+	grace := reconnectGrace
+	left := time.NewTimer(0)
+	left.Stop()
+	defer left.Stop()
+
+	// expired fires once the game lasted maxGameDuration, those restored
+	// may have lasted it already
+	var expired <-chan time.Time
+	if maxGameDuration > 0 {
+		timer := time.NewTimer(time.Until(state.CreatedAt.Add(maxGameDuration)))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	// play handles what the reader of color sent, reporting whether the game is over
+	play := func(color string, in inbound) bool {
+		box, other := boxes[color], boxes[opponent(color)]
+		if errors.Is(in.err, ErrInvalidPayload) {
+			box.SendTransient(errorMessage(CodeInvalidPayload))
+			return false
+		}
+		// a connection taken over may still have been reading
+		if in.conn != nil && in.conn != box.conn {
+			return false
+		}
+		if in.err != nil {
+			box.Attach(nil)
+			recorder.Record(ctx, PlayerDisconnected, color, nil)
+			if game.disconnect(color) {
+				left.Reset(grace)
+			}
+			return false
+		}
+		message := in.message
+		if invalid := validateMessage(message); invalid != nil {
+			box.SendTransient(*invalid)
+			return false
+		}
+		if handleConnectionMessage(box, message) {
+			return false
+		}
+		if recorder.State().Paused {
+			box.SendTransient(errorMessage(CodeGamePaused))
+			return false
+		}
+		// the coach moves for the player, if let to, errors going to them
+		side, role := seatRole(color)
+		byCoach := role == "coach"
+		if byCoach {
+			if !game.coach(side, boxes, message) {
+				return false
+			}
+			color, other = side, boxes[opponent(side)]
+		}
+		if handled, over := game.variant.handle(color, message, flagged); handled {
+			return over
+		}
+		switch message.Type {
+		case "resign":
+			recorder.Record(ctx, GameResigned, color, nil)
+			game.end("resignation")
+			return true
+		case "draw_offer":
+			// offering a draw back accepts the pending offer
+			if recorder.State().DrawOffer == opponent(color) {
+				recorder.Record(ctx, DrawAgreed, color, nil)
+				game.end("agreement")
+				return true
+			}
+			if recorder.State().DrawOffersDisabled {
+				box.SendTransient(errorMessage(CodeDrawOffersDisabled))
+				return false
+			}
+			if refused := refuseOffer(recorder.State(), color, recorder.State().DrawOfferPlies); refused != nil {
+				box.SendTransient(*refused)
+				return false
+			}
+			recorder.Record(ctx, DrawOffered, color, nil)
+			other.Send(Message{Type: "draw_offer", Color: color})
+			return false
+		case "pause_offer":
+			// offering to pause back accepts the pending offer, then both
+			// players leave until they resume the game
+			if recorder.State().PauseOffer == opponent(color) {
+				recorder.Record(ctx, GamePaused, color, nil)
+				for _, box := range boxes {
+					box.Send(Message{Type: "paused"})
+					if box.conn != nil {
+						box.conn.Close("")
+					}
+				}
+				return false
+			}
+			if refused := refuseOffer(recorder.State(), color, recorder.State().PauseOfferPlies); refused != nil {
+				box.SendTransient(*refused)
+				return false
+			}
+			recorder.Record(ctx, PauseOffered, color, nil)
+			other.Send(Message{Type: "pause_offer", Color: color})
+			return false
+		case "takeback_offer":
+			state := recorder.State()
+			// asking back agrees to the pending request
+			if state.TakebackOffer == opponent(color) {
+				asker := state.TakebackOffer
+				plies, _ := takebackPlies(state, asker)
+				recorder.RecordTakenBack(ctx, asker, plies)
+				state = recorder.State()
+				turn = state.Turn()
+				takeback := Message{Type: "takeback", Color: asker, Ply: len(state.Moves)}
+				takeback.WhiteTime, takeback.BlackTime = state.Clocks(state.TurnStarted)
+				for _, box := range boxes {
+					box.Send(takeback)
+				}
+				armFlag()
+				return false
+			}
+			if refused := refuseTakeback(state, color); refused != nil {
+				box.SendTransient(*refused)
+				return false
+			}
+			recorder.Record(ctx, TakebackOffered, color, nil)
+			other.Send(Message{Type: "takeback_offer", Color: color})
+			return false
+		case "refuse_offers":
+			if !slices.Contains(recorder.State().OffersRefused, color) {
+				recorder.Record(ctx, OffersRefused, color, nil)
+				other.Send(Message{Type: "offers_refused", Color: color})
+			}
+			return false
+		case "claim_draw":
+			if turn != color {
+				box.SendTransient(errorMessage(CodeNotYourTurn))
+				return false
+			}
+			if flagged(color) {
+				return true
+			}
+			reason, ok := drawClaim(recorder.State().FEN, recorder.State().Moves, message.Reason)
+			if !ok {
+				rejected := errorMessage(CodeInvalidDrawClaim)
+				rejected.Reason = message.Reason
+				box.SendTransient(rejected)
+				return false
+			}
+			recorder.RecordDrawClaim(ctx, color, reason)
+			game.end(reason)
+			return true
+		case "vote":
+			// only the voters of a crowd vote, from their own connections
+			box.SendTransient(errorMessage(CodeWrongRole))
+			return false
+		case "quick":
+			other.SendTransient(Message{Type: "quick", Color: color, Quick: message.Quick})
+			return false
+		case "coach_invite", "coach_dismiss":
+			game.inviteCoach(color, boxes, message)
+			return false
+		case "cancel_seek":
+			box.SendTransient(errorMessage(CodeNotSeeking))
+			return false
+		case "spectator_token":
+			token := newToken()
+			recorder.RecordSpectatorToken(ctx, color, token)
+			box.Send(Message{Type: "spectator_token", Token: token})
+			return false
+		}
+		if recorder.HasMove(message.MoveID) {
+			return false
+		}
+		// a move made once the time is up comes too late
+		if turn == color && flagged(color) {
+			return true
+		}
+		// the host of a simul plays the boards in turn
+		if turn == color && game.simul != nil && color == "white" && !game.simul.hostAt(game) {
+			box.SendTransient(errorMessage(CodeHostAtAnotherBoard))
+			return false
+		}
+		span := startMoveSpan(ctx, color, message)
+		defer span.End()
+		span.SetAttributes(attribute.Bool("chess.forwarded", turn == color))
+		if turn == color {
+			moveQueueing.since(in.read)
+			checking := time.Now()
+			before := recorder.State()
+			if box.conn != nil && box.conn.preferences != nil && box.conn.preferences.AutoQueen {
+				position, _ := game.variant.position(before)
+				autoQueen(position, &message)
+			}
+			rejected, status := game.variant.check(before, message.Move())
+			moveCheck.since(checking)
+			if rejected != "" {
+				box.SendTransient(errorMessage(rejected))
+				recorder.Record(ctx, MoveRejected, color, message.Move())
+				return false
+			}
+			turn = opponent(color)
+			var lag time.Duration
+			if box.conn != nil {
+				lag = box.conn.lag()
+			}
+			recorder.RecordMove(ctx, color, message.Move(), lag)
+			// whatever clocks the client sent, the server keeps the time
+			state := recorder.State()
+			message.WhiteTime, message.BlackTime = state.Clocks(state.TurnStarted)
+			other.Send(message)
+			game.tellCoaches(boxes, color, message, byCoach)
+			game.variant.moved(color, message, before)
+			armFlag()
+			if game.simul != nil && color == "white" {
+				game.simul.hostMoved(game)
+			}
+			switch status {
+			case chess.Checkmate:
+				recorder.Record(ctx, GameCheckmated, opponent(color), nil)
+				game.end("checkmate")
+				return true
+			case chess.Stalemate:
+				recorder.Record(ctx, GameStalemated, opponent(color), nil)
+				game.end("stalemate")
+				return true
+			}
+		} else {
+			box.SendTransient(errorMessage(CodeNotYourTurn))
+			recorder.Record(ctx, MoveRejected, color, message.Move())
+		}
+		return false
+	}
+
 	for {
+		var message any
 		select {
-		case message := <-whiteChannel:
-			if message.Type == "error" {
+		case <-ctx.Done():
+			game.stop()
+			return
+		case <-flag.C:
+			if flagged(turn) {
+				return
+			}
+			// the timer of a clock stopped earlier, or one that fired early
+			armFlag()
+			continue
+		case <-expired:
+			game.expire()
+			return
+		case <-left.C:
+			if game.abandon() {
+				recorder.Record(ctx, GameAbandoned, "", nil)
 				return
 			}
-			if turnWhite {
-				blackWebsocket.WriteJSON(message)
-				turnWhite = false
+			continue
+		case message = <-game.mailbox:
+		}
+		switch message := message.(type) {
+		case reconnection:
+			back := message
+			box := boxes[back.color]
+			if back.takeover && box.conn != nil {
+				closeWithError(box.conn, ErrTakenOver)
+			}
+			game.attach(back.color, back.conn)
+			recorder.Record(ctx, PlayerReconnected, back.color, nil)
+			go game.forward(back.color, back.conn)
+			// a client that only missed a few messages gets just those,
+			// any other gets the whole game again
+			if box.Covers(back.lastSeq) {
+				box.Resend(back.lastSeq)
+			} else {
+				state := recorder.State()
+				color, role := seatRole(back.color)
+				resume := Message{Type: "resume", Version: box.version, GameID: game.id, Color: color, Role: role, Moves: state.Moves}
+				resume.WhiteTime, resume.BlackTime = state.Clocks(time.Now())
+				// a blindfold player is only told the last move, which they
+				// may have missed, out of all those played
+				if role == "" && slices.Contains(state.Blindfolded, color) {
+					resume.Blindfold, resume.Ply = true, len(state.Moves)
+					resume.Moves = state.Moves[max(len(state.Moves)-1, 0):]
+				}
+				box.Send(resume)
 			}
-		case message := <-blackChannel:
-			if message.Type == "error" {
+			// the clocks of a paused game run again once both players are back
+			if recorder.State().Paused && game.bothConnected() {
+				recorder.Record(ctx, GameUnpaused, "", nil)
+				state := recorder.State()
+				unpaused := Message{Type: "unpaused"}
+				unpaused.WhiteTime, unpaused.BlackTime = state.Clocks(state.TurnStarted)
+				for _, box := range boxes {
+					box.Send(unpaused)
+				}
+				armFlag()
+			}
+		case variantMessage:
+			if message.deliver(game) {
 				return
 			}
-			if !turnWhite {
-				whiteWebsocket.WriteJSON(message)
-				turnWhite = true
+		case kick:
+			// the reader then reports the player disconnected
+			if box := boxes[message.color]; box.conn != nil {
+				closeWithError(box.conn, ErrKicked)
+			}
+		case spectatorCount:
+			for _, box := range boxes {
+				box.SendTransient(Message{Type: "spectators", Spectators: int(message)})
+			}
+		case *inbound:
+			over := play(message.color, *message)
+			inbounds.Put(message)
+			if over {
+				return
 			}
+		default:
+			panic(fmt.Sprintf("unexpected mailbox message %T", message))
+		}
+	}
+}
+
+// end announces the result of the game to both players and closes
+// their connections, the game loop returns right after
+func (game *ChessGame) end(reason string) {
+	game.mu.Lock()
+	game.ended = true
+	game.mu.Unlock()
+	result := game.recorder.State().Result
+	for color, box := range game.outboxes() {
+		box.Send(Message{Type: "game_over", Result: result, Reason: reason})
+		if game.series != nil {
+			box.Send(game.series.scoreMessage(game, color))
+		}
+		if box.conn != nil {
+			box.conn.Close("")
 		}
 	}
+	game.variant.hangUp(func(conn *connection) {
+		conn.Write(Message{Type: "game_over", Result: result, Reason: reason})
+		conn.Close("")
+	})
 }
 
-func forwardFromWebsocketToChannel(ws *websocket.Conn, ch chan<- Message) {
-	defer ws.Close()
+// inbound is what the reader of color hands to the game loop: a message,
+// or the error that kept it from reading one, and when it was read
+type inbound struct {
+	color string
+	// conn is the connection read, nil for moves the server makes
+	conn    *connection
+	message Message
+	err     error
+	read    time.Time
+}
+
+// inbounds are reused by the readers, the game loop puts them back
+// once handled
+var inbounds = sync.Pool{New: func() any { return new(inbound) }}
+
+// forward reads the connection of color into the mailbox until it fails
+// or the game is done
+func (game *ChessGame) forward(color string, conn *connection) {
+	defer conn.Close("")
 	for {
-		message := Message{}
-		err := ws.ReadJSON(&message)
+		message, err := conn.Read()
 
-		if err != nil {
-			ch <- Message{Type: "error"}
+		// a payload that cannot be decoded is reported, the connection is still fine
+		in := inbounds.Get().(*inbound)
+		*in = inbound{color: color, conn: conn, message: message, err: err, read: time.Now()}
+		if !game.post(in) {
+			return
+		}
+		if err != nil && !errors.Is(err, ErrInvalidPayload) {
 			return
 		}
-
-		ch <- message
 	}
 }
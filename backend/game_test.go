@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMovesAreForwardedInTurn(t *testing.T) {
+	_, white, black := startTestGame(t)
+
+	white.send(move("1", "e2", "e4"))
+	if got := black.expect("move"); got.From != "e2" || got.To != "e4" {
+		t.Fatalf("black got %+v", got)
+	}
+	black.send(move("2", "e7", "e5"))
+	if got := white.expect("move"); got.From != "e7" || got.To != "e5" {
+		t.Fatalf("white got %+v", got)
+	}
+}
+
+func TestMoveOutOfTurnIsRejected(t *testing.T) {
+	_, white, black := startTestGame(t)
+
+	black.send(move("1", "e7", "e5"))
+	black.expect("error", CodeNotYourTurn)
+
+	white.send(move("2", "e2", "e4"))
+	black.expect("move")
+	white.send(move("3", "d2", "d4"))
+	white.expect("error", CodeNotYourTurn)
+}
+
+func TestIllegalMoveIsRejected(t *testing.T) {
+	game, white, black := startTestGame(t)
+
+	white.send(move("1", "e2", "e6"))
+	white.expect("error", CodeIllegalMove)
+	// white then plays a legal move, which black gets first
+	white.send(move("2", "e2", "e4"))
+	if got := black.expect("move"); got.From != "e2" || got.To != "e4" {
+		t.Fatalf("black got %+v", got)
+	}
+	if moves := game.recorder.State().Moves; len(moves) != 1 {
+		t.Fatalf("got moves %+v", moves)
+	}
+}
+
+func TestCheckmateEndsTheGame(t *testing.T) {
+	game, white, black := startTestGame(t)
+
+	for i, m := range [][2]string{{"f2", "f3"}, {"e7", "e5"}, {"g2", "g4"}, {"d8", "h4"}} {
+		mover, opponent := white, black
+		if i%2 == 1 {
+			mover, opponent = black, white
+		}
+		mover.send(move(strconv.Itoa(i), m[0], m[1]))
+		opponent.expect("move")
+	}
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("game_over"); got.Result != "0-1" || got.Reason != "checkmate" {
+			t.Fatalf("got %+v", got)
+		}
+	}
+	events, err := store.Load(game.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := events[len(events)-1]; last.Type != GameCheckmated || last.Color != "white" {
+		t.Fatalf("got last event %+v", last)
+	}
+}
+
+func TestStalemateDrawsTheGame(t *testing.T) {
+	_, white, black := startOptionsGame(t, GameOptions{FEN: "7k/8/5Q2/8/8/8/8/K7 w - - 0 1"})
+	white.expect("start")
+	black.expect("start")
+
+	white.send(move("1", "f6", "f7"))
+	black.expect("move")
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("game_over"); got.Result != "1/2-1/2" || got.Reason != "stalemate" {
+			t.Fatalf("got %+v", got)
+		}
+	}
+}
+
+func TestResubmittedMoveIsPlayedOnce(t *testing.T) {
+	_, white, black := startTestGame(t)
+
+	white.send(move("1", "e2", "e4"))
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.send(move("2", "e7", "e5"))
+	// had the second copy been played out of turn white would get an error first
+	white.expect("move")
+}
+
+func TestInvalidMessagesAreReported(t *testing.T) {
+	_, white, _ := startTestGame(t)
+
+	white.transport.toServer <- []byte("{")
+	white.expect("error", CodeInvalidPayload)
+	white.send(Message{Type: "move", From: "e2"})
+	if got := white.expect("error", CodeInvalidMessage); got.Field != "to" {
+		t.Fatalf("got field %q, want to", got.Field)
+	}
+}
+
+func TestResignEndsTheGame(t *testing.T) {
+	game, white, black := startTestGame(t)
+
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.send(Message{Type: "resign"})
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("game_over"); got.Result != "1-0" || got.Reason != "resignation" {
+			t.Fatalf("got %+v", got)
+		}
+	}
+	if state := game.recorder.State(); !state.Finished || state.Result != "1-0" {
+		t.Fatalf("got state %+v", state)
+	}
+	if err := game.Resume(context.Background(), newTestPlayer(t).conn, game.tokens["white"], -1); err != ErrGameNotFound {
+		t.Fatalf("resuming an ended game: got %v", err)
+	}
+}
+
+func TestDrawOfferedBackIsAgreed(t *testing.T) {
+	_, white, black := startTestGame(t)
+
+	white.send(Message{Type: "draw_offer"})
+	if got := black.expect("draw_offer"); got.Color != "white" {
+		t.Fatalf("got offer from %q", got.Color)
+	}
+	black.send(Message{Type: "draw_offer"})
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("game_over"); got.Result != "1/2-1/2" || got.Reason != "agreement" {
+			t.Fatalf("got %+v", got)
+		}
+	}
+}
+
+func TestMovingDeclinesADrawOffer(t *testing.T) {
+	game, white, black := startTestGame(t)
+
+	white.send(Message{Type: "draw_offer"})
+	black.expect("draw_offer")
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.send(move("2", "e7", "e5"))
+	white.expect("move")
+	if offer := game.recorder.State().DrawOffer; offer != "" {
+		t.Fatalf("offer of %s still pending", offer)
+	}
+	// offering now is a new offer rather than an acceptance
+	black.send(Message{Type: "draw_offer"})
+	white.expect("draw_offer")
+}
+
+func TestResumeSendsMissedMessages(t *testing.T) {
+	game, white, black := startTestGame(t)
+
+	white.send(move("1", "e2", "e4"))
+	start := black.receive()
+	black.disconnect()
+	waitFor(t, func() bool {
+		game.mu.Lock()
+		defer game.mu.Unlock()
+		return !game.connected["black"]
+	})
+	white.send(move("2", "d2", "d4"))
+	white.expect("error", CodeNotYourTurn)
+
+	back := newTestPlayer(t)
+	if err := game.Resume(context.Background(), back.conn, game.tokens["black"], start.Seq-1); err != nil {
+		t.Fatal(err)
+	}
+	if got := back.expect("move"); got.Seq != start.Seq || got.To != "e4" {
+		t.Fatalf("got %+v", got)
+	}
+	back.send(move("3", "e7", "e5"))
+	white.expect("move")
+}
+
+func TestResumeWithUnknownSeqGetsTheWholeGame(t *testing.T) {
+	game, white, black := startTestGame(t)
+
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.disconnect()
+	waitFor(t, func() bool {
+		game.mu.Lock()
+		defer game.mu.Unlock()
+		return !game.connected["black"]
+	})
+
+	back := newTestPlayer(t)
+	if err := game.Resume(context.Background(), back.conn, game.tokens["black"], -1); err != nil {
+		t.Fatal(err)
+	}
+	if got := back.expect("resume"); got.Color != "black" || len(got.Moves) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestBlindfoldPlayerOnlyResumesWithTheLastMove(t *testing.T) {
+	white, black := newTestPlayer(t), newTestPlayer(t)
+	black.conn.options.Blindfold = true
+	var game *ChessGame
+	for _, player := range []*testPlayer{white, black} {
+		if err := games.Pair(context.Background(), player.conn); err != nil {
+			t.Fatal(err)
+		}
+		games.mu.Lock()
+		if len(games.seeks) > 0 {
+			game = games.seeks[len(games.seeks)-1]
+		}
+		games.mu.Unlock()
+	}
+	if got := white.expect("start"); got.Blindfold {
+		t.Fatalf("got %+v", got)
+	}
+	if got := black.expect("start"); !got.Blindfold {
+		t.Fatalf("got %+v", got)
+	}
+
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.send(move("2", "e7", "e5"))
+	white.expect("move")
+	white.send(move("3", "g1", "f3"))
+	black.expect("move")
+	black.disconnect()
+	waitFor(t, func() bool {
+		game.mu.Lock()
+		defer game.mu.Unlock()
+		return !game.connected["black"]
+	})
+
+	// reconnecting without asking to is still blindfold
+	back := newTestPlayer(t)
+	if err := game.Resume(context.Background(), back.conn, game.tokens["black"], -1); err != nil {
+		t.Fatal(err)
+	}
+	got := back.expect("resume")
+	if !got.Blindfold || got.Ply != 3 || len(got.Moves) != 1 || got.Moves[0].From != "g1" {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestResumeIsRefused(t *testing.T) {
+	game, _, _ := startTestGame(t)
+
+	if err := game.Resume(context.Background(), newTestPlayer(t).conn, "wrong", -1); err != ErrInvalidResumeToken {
+		t.Fatalf("wrong token: got %v", err)
+	}
+	if err := game.Resume(context.Background(), newTestPlayer(t).conn, game.tokens["white"], -1); err != ErrAlreadyConnected {
+		t.Fatalf("connected player: got %v", err)
+	}
+}
+
+func TestTakeover(t *testing.T) {
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+
+	// the new connection of white gets its seat, the one it had is closed
+	back := newTestPlayer(t)
+	if err := game.Takeover(context.Background(), back.conn, game.tokens["white"], -1); err != nil {
+		t.Fatal(err)
+	}
+	white.expect("error", CodeTakenOver)
+	if got := back.expect("resume"); len(got.Moves) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	black.send(move("2", "e7", "e5"))
+	back.expect("move")
+	back.send(move("3", "g1", "f3"))
+	if got := black.expect("move"); got.From != "g1" {
+		t.Fatalf("got %+v", got)
+	}
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	if !game.connected["white"] {
+		t.Error("white dropped as its old connection closed")
+	}
+}
+
+func TestGameIsAbandonedWhenBothLeave(t *testing.T) {
+	defer func(d time.Duration) { reconnectGrace = d }(reconnectGrace)
+	reconnectGrace = 200 * time.Millisecond
+	game, white, black := startTestGame(t)
+
+	// a player back within the grace keeps the game going
+	white.disconnect()
+	black.disconnect()
+	waitFor(t, func() bool {
+		game.mu.Lock()
+		defer game.mu.Unlock()
+		return !game.connected["white"] && !game.connected["black"]
+	})
+	white = newTestPlayer(t)
+	if err := game.Resume(context.Background(), white.conn, game.tokens["white"], -1); err != nil {
+		t.Fatal(err)
+	}
+	white.expect("resume")
+	time.Sleep(2 * reconnectGrace)
+	if game.recorder.State().Finished {
+		t.Fatal("game abandoned with a player back")
+	}
+
+	white.disconnect()
+	black.disconnect()
+	waitFor(t, func() bool {
+		return game.recorder.State().Finished
+	})
+	if _, ok := games.Find(game.id); ok {
+		t.Fatal("abandoned game still active")
+	}
+}
+
+func TestCrashedGameLoopIsRestarted(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	game, white, black := startTestGame(t)
+
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	// anything the loop does not expect makes it panic
+	game.post(struct{}{})
+	black.send(move("2", "e7", "e5"))
+	if got := white.expect("move"); got.From != "e7" {
+		t.Fatalf("white got %+v", got)
+	}
+	if moves := game.recorder.State().Moves; len(moves) != 2 {
+		t.Fatalf("got %d moves, want 2", len(moves))
+	}
+}
+
+func TestGameLoopCrashingAgainIsAborted(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	game, white, black := startTestGame(t)
+
+	for i := 0; i <= maxGameRestarts; i++ {
+		game.post(struct{}{})
+	}
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("game_over"); got.Reason != "aborted" {
+			t.Fatalf("got %+v", got)
+		}
+	}
+	<-game.done
+	if _, ok := games.Find(game.id); ok {
+		t.Fatal("aborted game is still active")
+	}
+}
+
+func TestAbortedGameIsOver(t *testing.T) {
+	game, white, black := startTestGame(t)
+
+	game.Abort()
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("game_over"); got.Reason != "aborted" {
+			t.Fatalf("got %+v", got)
+		}
+	}
+	<-game.done
+	if state := game.recorder.State(); !state.Finished || state.Result != "" {
+		t.Fatalf("got state %+v", state)
+	}
+}
+
+func TestDrawClaimIsChecked(t *testing.T) {
+	_, white, black := startTestGame(t)
+	ply := 0
+	shuffle := func() {
+		for i, m := range [][2]string{{"g1", "f3"}, {"g8", "f6"}, {"f3", "g1"}, {"f6", "g8"}} {
+			mover, opponent := white, black
+			if i%2 == 1 {
+				mover, opponent = black, white
+			}
+			ply++
+			mover.send(move(strconv.Itoa(ply), m[0], m[1]))
+			opponent.expect("move")
+		}
+	}
+	shuffle()
+	black.send(Message{Type: "claim_draw"})
+	black.expect("error", CodeNotYourTurn)
+	// the starting position was only seen twice
+	white.send(Message{Type: "claim_draw", Reason: "threefold_repetition"})
+	white.expect("error", CodeInvalidDrawClaim)
+
+	shuffle()
+	white.send(Message{Type: "claim_draw", Reason: "fifty_moves"})
+	white.expect("error", CodeInvalidDrawClaim)
+	white.send(Message{Type: "claim_draw"})
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("game_over"); got.Result != "1/2-1/2" || got.Reason != "threefold_repetition" {
+			t.Errorf("got %+v", got)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// gameDocument is everything known about a game, for tools working on them
+type gameDocument struct {
+	ID        string                `json:"id"`
+	Slug      string                `json:"slug,omitempty"`
+	CreatedAt time.Time             `json:"createdAt"`
+	Private   bool                  `json:"private,omitempty"`
+	Rated     bool                  `json:"rated"`
+	Players   map[string]gamePlayer `json:"players"`
+	Started   bool                  `json:"started"`
+	Finished  bool                  `json:"finished"`
+	Result    string                `json:"result,omitempty"`
+	// TimeControl is missing for untimed games
+	TimeControl *TimeControl `json:"timeControl,omitempty"`
+	Variant     string       `json:"variant,omitempty"`
+	// Reason is how the game ended: resignation, agreement, timeout,
+	// timeout_vs_insufficient_material, threefold_repetition,
+	// fifty_moves, max_duration, abandoned or imported, and checkmate or
+	// other_board in bughouse
+	Reason string         `json:"reason,omitempty"`
+	Moves  []documentMove `json:"moves"`
+	// Spectators is how many watch the game live, while it is played
+	Spectators int `json:"spectators,omitempty"`
+	// Comments are those left once the game was over, and the kibitz of
+	// its spectators while it was played; replies refer to the comment
+	// they answer
+	Comments []Comment `json:"comments"`
+}
+
+type gamePlayer struct {
+	JoinedAt time.Time `json:"joinedAt"`
+	// Player is the account of the player, if they have one; Name is
+	// theirs in the PGN of imported games
+	Player string `json:"player,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type documentMove struct {
+	Ply   int    `json:"ply"`
+	Color string `json:"color"`
+	UCI   string `json:"uci"`
+	// SAN is missing from the first move that is not legal on
+	SAN     string    `json:"san,omitempty"`
+	Time    time.Time `json:"time"`
+	SpentMs int64     `json:"spentMs"`
+}
+
+// gameDocumentHandler serves the whole of a game as a gameDocument
+func gameDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	state, events, ok := loadWatchedEvents(w, r)
+	if !ok {
+		return
+	}
+	doc := newGameDocument(state, events)
+	// the kibitz of a live game is for its spectators only
+	doc.Comments = []Comment{}
+	if state.Finished {
+		list, err := comments.Load(state.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		doc.Comments = newCommentReader(r).visible(list)
+		// comments may still be left on it, unlike the rest
+		body, err := json.Marshal(doc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if notModifiedBody(w, r, state, body) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(body, '\n'))
+		return
+	}
+	writeJSON(w, doc)
+}
+
+func newGameDocument(state GameState, events []Event) gameDocument {
+	doc := gameDocument{
+		ID:          state.ID,
+		Slug:        state.Slug,
+		CreatedAt:   state.CreatedAt,
+		Private:     state.Private,
+		Rated:       isRated(state),
+		Players:     map[string]gamePlayer{},
+		Started:     state.Started,
+		Finished:    state.Finished,
+		Result:      state.Result,
+		TimeControl: state.TimeControl,
+		Variant:     state.Variant,
+		Moves:       []documentMove{},
+	}
+	if !state.Finished {
+		doc.Spectators = feeds.watchers(state.ID)
+	}
+	// the variant starts from its own position, with no moves played
+	position, _ := variantRules(state.Variant).position(GameState{FEN: state.FEN})
+	legal := true
+	played := []Move{}
+	// a player starts thinking when the game starts or the opponent moves
+	var turnStarted time.Time
+	for _, event := range events {
+		switch event.Type {
+		case PlayerJoined:
+			doc.Players[event.Color] = gamePlayer{JoinedAt: event.Time, Player: event.Player}
+		case BrainJoined:
+			doc.Players[brainSeat(event.Color)] = gamePlayer{JoinedAt: event.Time}
+		case GameStarted:
+			turnStarted = event.Time
+		case MoveMade:
+			m := *event.Move
+			move := documentMove{
+				Ply:     len(doc.Moves) + 1,
+				Color:   event.Color,
+				UCI:     m.UCI(),
+				Time:    event.Time,
+				SpentMs: m.SpentMs,
+			}
+			// moves recorded before their time spent was get it from the events
+			if m.SpentMs == 0 && !turnStarted.IsZero() {
+				move.SpentMs = event.Time.Sub(turnStarted).Milliseconds()
+			}
+			if parsed, err := chess.ParseMove(move.UCI); legal && err == nil && position.IsLegal(parsed) {
+				move.SAN = position.SAN(parsed)
+				position = position.Apply(parsed)
+			} else {
+				legal = false
+			}
+			doc.Moves = append(doc.Moves, move)
+			played = append(played, m)
+			turnStarted = event.Time
+		case MovesTakenBack:
+			// only standard games are played back, from the start position
+			doc.Moves = doc.Moves[:len(doc.Moves)-event.Plies]
+			played = played[:len(played)-event.Plies]
+			var n int
+			position, n = positionAfter(state.FEN, played)
+			legal = n == len(played)
+			turnStarted = event.Time
+		case GameResigned:
+			doc.Reason = "resignation"
+		case DrawAgreed:
+			doc.Reason = "agreement"
+		case GameAbandoned:
+			doc.Reason = "abandoned"
+		case DrawClaimed:
+			doc.Reason = event.Reason
+		case GameFlagged:
+			doc.Reason = "timeout"
+		case GameFlaggedDrawn:
+			doc.Reason = "timeout_vs_insufficient_material"
+		case GameAdjudicated:
+			doc.Reason = "max_duration"
+		case GameImported:
+			doc.Reason = "imported"
+			for color, name := range event.Names {
+				doc.Players[color] = gamePlayer{Name: name}
+			}
+		case PiecePocketed:
+			t, _ := chess.ParsePieceType(event.Piece)
+			position = position.AddToPocket(chessColor(event.Color), t)
+		case GameCheckmated:
+			doc.Reason = "checkmate"
+		case GameStalemated:
+			doc.Reason = "stalemate"
+		case BughouseDecided:
+			doc.Reason = "other_board"
+		}
+	}
+	return doc
+}
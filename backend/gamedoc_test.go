@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGameDocument(t *testing.T) {
+	game, white, black := startTestGame(t)
+	white.send(move("1", "g1", "f3"))
+	black.expect("move")
+	black.send(move("2", "d7", "d5"))
+	white.expect("move")
+	white.send(Message{Type: "resign"})
+	black.expect("game_over")
+	waitFor(t, func() bool { return game.recorder.State().Finished })
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/games/"+game.id+"/json", nil))
+	doc := gameDocument{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Result != "0-1" || doc.Reason != "resignation" || len(doc.Players) != 2 {
+		t.Errorf("got %+v", doc)
+	}
+	if len(doc.Moves) != 2 || doc.Moves[0].SAN != "Nf3" || doc.Moves[1].UCI != "d7d5" || doc.Moves[1].Color != "black" {
+		t.Fatalf("got moves %+v", doc.Moves)
+	}
+	if doc.Moves[1].SpentMs < 0 || doc.Moves[1].Time.Before(doc.Moves[0].Time) {
+		t.Errorf("got times %+v", doc.Moves)
+	}
+}
+
+func TestTimeSpentIsRecorded(t *testing.T) {
+	game, white, black := startTestGame(t)
+	time.Sleep(20 * time.Millisecond)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	waitFor(t, func() bool { return len(game.recorder.State().Moves) == 1 })
+	if spent := game.recorder.State().Moves[0].SpentMs; spent < 20 {
+		t.Errorf("white spent %dms on the move", spent)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// gameEventsHandler streams the event log of a game as Server-Sent Events,
+// each with its sequence number as id and its type as event: the events
+// recorded so far, or those after ?since= or the Last-Event-ID of a client
+// reconnecting, then those of a live game as they are recorded. The stream
+// ends with an end event once the game is over, or a close event if the
+// client fell too far behind, which may reconnect, or a redirect event with
+// where to reconnect if the game is handed off to another instance, see
+// HandOff. Spectator tokens are
+// left out, those of private games are only given to whoever has one.
+// While the game is played, a spectators event tells how many watch it,
+// each time that changed, and kibitz events carry the kibitz left so far
+// then as it is to the spectators with an account, see seesKibitz; those
+// muted by the account, or shadow muted, are left out as with comments. The
+// spectators of rated games are kept behind them, see spectatorDelay
+func gameEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	since, err := strconv.Atoi(r.URL.Query().Get("since"))
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		since, err = strconv.Atoi(id)
+	}
+	if err != nil {
+		since = 0
+	}
+	// subscribing first, not to miss what is recorded while loading
+	live, cancel := feeds.subscribe(r.PathValue("id"))
+	defer cancel()
+	said, stopKibitz := kibitz.subscribe(r.PathValue("id"))
+	defer stopKibitz()
+	handedOff, stopHandoff := handoffFeed.subscribe(r.PathValue("id"))
+	defer stopHandoff()
+	// a game handed off here is played once anyone comes to it
+	findGame(r.PathValue("id"))
+	state, events, ok := loadLiveEvents(w, r)
+	if !ok {
+		return
+	}
+	playing := playsIn(r, state)
+	held := newHeldEvents(events, playing)
+	var saidSoFar []Comment
+	reader := newCommentReader(r)
+	if state.Finished || !seesKibitz(r, state) {
+		stopKibitz()
+		said = nil
+	} else if saidSoFar, err = kibitzSoFar(reader, state.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	keepOpen(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range held.release(time.Now()) {
+		if event.Seq > since {
+			writeGameEvent(w, event)
+		}
+	}
+	// what is left while loading comes again from the feed
+	lastSaid := 0
+	for _, comment := range saidSoFar {
+		writeKibitz(w, comment)
+		lastSaid = comment.ID
+	}
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	spectators := time.NewTicker(spectatorsEvery)
+	defer spectators.Stop()
+	told := 0
+	tell := func() {
+		if n := feeds.watchers(state.ID); n != told && !held.state.Finished {
+			fmt.Fprintf(w, "event: spectators\ndata: %d\n\n", n)
+			told = n
+		}
+	}
+	tell()
+	flusher.Flush()
+
+	release := func() {
+		for _, event := range held.release(time.Now()) {
+			writeGameEvent(w, event)
+		}
+	}
+	for !held.over() {
+		select {
+		case event, ok := <-live:
+			if !ok {
+				fmt.Fprint(w, "event: close\ndata: too far behind\n\n")
+				flusher.Flush()
+				return
+			}
+			if held.add(event) {
+				release()
+			}
+		case <-held.wake(time.Now()):
+			release()
+		case comment, ok := <-said:
+			// those falling behind miss kibitz rather than the game
+			if !ok {
+				said = nil
+				continue
+			}
+			if comment.ID > lastSaid && reader.sees(comment) {
+				writeKibitz(w, publicComments([]Comment{comment})[0])
+			}
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case to, ok := <-handedOff:
+			if !ok {
+				handedOff = nil
+				continue
+			}
+			since := url.Values{"since": {strconv.Itoa(held.shownSeq())}}
+			fmt.Fprintf(w, "event: redirect\ndata: %s\n\n", remoteLocation(to, r.URL.Path, since.Encode(), false))
+			flusher.Flush()
+			return
+		case <-spectators.C:
+			tell()
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+	fmt.Fprintf(w, "event: end\ndata: %s\n\n", held.state.Result)
+	flusher.Flush()
+}
+
+func writeKibitz(w http.ResponseWriter, comment Comment) {
+	data, _ := json.Marshal(comment)
+	fmt.Fprintf(w, "event: kibitz\ndata: %s\n\n", data)
+}
+
+func writeGameEvent(w http.ResponseWriter, event Event) {
+	event.Token = ""
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGameEventsStream(t *testing.T) {
+	server := httptest.NewServer(newPublicMux())
+	defer server.Close()
+	ctx := context.Background()
+	recorder := newGameRecorder(newGameID(), "", nil, "")
+	recorder.Record(ctx, GameCreated, "", nil)
+	recorder.Record(ctx, GameMadePrivate, "white", nil)
+	recorder.RecordSpectatorToken(ctx, "white", "watch")
+	id := recorder.State().ID
+
+	if resp, err := http.Get(server.URL + "/games/" + id + "/events"); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("got %v %v without a spectator token", resp.Status, err)
+	}
+	r, _ := http.NewRequest("GET", server.URL+"/games/"+id+"/events?token=watch", nil)
+	r.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got %s", resp.Header.Get("Content-Type"))
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	// raw is the data of the last event, as sent
+	var raw string
+	next := func() (id, event string, data Event) {
+		t.Helper()
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" && event != "" {
+				return id, event, data
+			}
+			if value, ok := strings.CutPrefix(line, "id: "); ok {
+				id = value
+			}
+			if value, ok := strings.CutPrefix(line, "event: "); ok {
+				event = value
+			}
+			if value, ok := strings.CutPrefix(line, "data: "); ok {
+				raw = value
+			}
+			if value, ok := strings.CutPrefix(line, "data: "); ok && event != "end" && event != "spectators" {
+				if err := json.Unmarshal([]byte(value), &data); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		t.Fatal("the stream ended")
+		return
+	}
+
+	// the events after the one last seen come first, without tokens
+	if id, event, data := next(); id != "2" || event != "game_made_private" {
+		t.Fatalf("got %s %s %+v", id, event, data)
+	}
+	if _, event, data := next(); event != "spectator_token_issued" || data.Token != "" {
+		t.Fatalf("got %s %+v", event, data)
+	}
+	// then how many watch, with the stream itself
+	if _, event, _ := next(); event != "spectators" || raw != "1" {
+		t.Fatalf("got %s %s", event, raw)
+	}
+	waitFor(t, func() bool {
+		feeds.mu.Lock()
+		defer feeds.mu.Unlock()
+		return len(feeds.subscribers[id]) > 0
+	})
+	recorder.Record(ctx, MoveMade, "white", &Move{From: "e2", To: "e4"})
+	recorder.Record(ctx, GameResigned, "black", nil)
+	if id, event, data := next(); id != "4" || event != "move_made" || data.Move.To != "e4" {
+		t.Fatalf("got %s %s %+v", id, event, data)
+	}
+	if _, event, _ := next(); event != "game_resigned" {
+		t.Fatalf("got %s", event)
+	}
+	if _, event, _ := next(); event != "end" {
+		t.Fatalf("got %s", event)
+	}
+}
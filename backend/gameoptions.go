@@ -0,0 +1,237 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrInvalidGameOptions = errors.New("invalid game options")
+
+// untimed is the time control of games without clocks
+const untimed = "untimed"
+
+// GameOptions are the rules a player asks for the game they create, or
+// the game they join: all of them are left to the server if empty. The
+// rules a game ends up with are echoed the same way in its start message
+type GameOptions struct {
+	// Variant is the name of a variant, standard chess if empty
+	Variant string `json:"variant,omitempty"`
+	// TimeControl is written as in 5m+3s, or untimed
+	TimeControl string `json:"timeControl,omitempty"`
+	// Rated asks for the game to change the ratings of its players or not,
+	// rated games need an account
+	Rated *bool `json:"rated,omitempty"`
+	// Color is the color asked to play with; FEN the position to start at
+	// and Takebacks the takeback policy, see parseTakebacks; all three for
+	// standard games only
+	Color     string `json:"color,omitempty" validate:"omitempty,oneof=white black random"`
+	FEN       string `json:"fen,omitempty"`
+	Takebacks string `json:"takebacks,omitempty" validate:"omitempty,oneof=none once unlimited"`
+	// Draws never lets the players agree to a draw
+	Draws     string `json:"draws,omitempty" validate:"omitempty,oneof=allowed never"`
+	Private   bool   `json:"private,omitempty"`
+	Blindfold bool   `json:"blindfold,omitempty"`
+}
+
+// parseGameOptions reads the options of query: the JSON of ?options= over
+// the query parameters of the same names, casual=true being rated=false as
+// it was asked for before, checked for player, who may have no account.
+// It returns the name of the option at fault if they are not valid
+func parseGameOptions(query url.Values, player string) (options GameOptions, field string, err error) {
+	options = GameOptions{
+		Variant:     query.Get("variant"),
+		TimeControl: query.Get("timeControl"),
+		Color:       query.Get("color"),
+		FEN:         query.Get("fen"),
+		Takebacks:   query.Get("takebacks"),
+		Draws:       query.Get("draws"),
+	}
+	options.Private, _ = strconv.ParseBool(query.Get("private"))
+	options.Blindfold, _ = strconv.ParseBool(query.Get("blindfold"))
+	if rated, err := strconv.ParseBool(query.Get("rated")); err == nil {
+		options.Rated = &rated
+	}
+	if casual, _ := strconv.ParseBool(query.Get("casual")); casual {
+		options.Rated = new(bool)
+	}
+	if raw := query.Get("options"); raw != "" {
+		decoder := json.NewDecoder(strings.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&options); err != nil {
+			return GameOptions{}, "options", ErrInvalidGameOptions
+		}
+	}
+	if field := options.check(player); field != "" {
+		return GameOptions{}, field, ErrInvalidGameOptions
+	}
+	return options, "", nil
+}
+
+// check is the name of the option options are not valid for, asked for by
+// player, empty if they are
+func (options GameOptions) check(player string) string {
+	if err := validate.Struct(options); err != nil {
+		var fieldErrors validator.ValidationErrors
+		if errors.As(err, &fieldErrors) {
+			return fieldErrors[0].Field()
+		}
+		return "options"
+	}
+	if _, ok := variants[options.Variant]; !ok {
+		return "variant"
+	}
+	if options.TimeControl != "" && options.TimeControl != untimed {
+		if _, err := parseTimeControl(options.TimeControl); err != nil {
+			return "timeControl"
+		}
+	}
+	standard := options.Variant == ""
+	switch {
+	case options.Color != "" && !standard:
+		return "color"
+	case options.Takebacks != "" && !standard:
+		return "takebacks"
+	case options.FEN != "" && (!standard || !playableFEN(options.FEN)):
+		return "fen"
+	}
+	// nobody's rating is left to games played back or not started as usual
+	if options.Rated != nil && *options.Rated &&
+		(player == "" || options.FEN != "" || options.Takebacks == takebacksUnlimited) {
+		return "rated"
+	}
+	return ""
+}
+
+// playableFEN reports whether a game can start at fen
+func playableFEN(fen string) bool {
+	position, err := parseLegalFEN(fen)
+	return err == nil && position.Status() == chess.Ongoing
+}
+
+// casual reports whether options ask for a game rating nobody
+func (options GameOptions) casual() bool {
+	return options.Rated != nil && !*options.Rated ||
+		options.FEN != "" || options.Takebacks == takebacksUnlimited
+}
+
+// clock is the time control options ask for, nil if untimed, and whether
+// they ask for one; they were checked
+func (options GameOptions) clock() (*TimeControl, bool) {
+	if options.TimeControl == untimed {
+		return nil, true
+	}
+	tc, err := parseTimeControl(options.TimeControl)
+	return tc, err == nil && tc != nil
+}
+
+// seat is the color the creator of a game with options plays with
+func (options GameOptions) seat() string {
+	switch options.Color {
+	case "black":
+		return "black"
+	case "random":
+		if rand.IntN(2) == 1 {
+			return "black"
+		}
+	}
+	return "white"
+}
+
+// admits reports whether the rules of the seek game suit what conn asks
+// for, only those it asks for explicitly count
+func (options GameOptions) admits(game *ChessGame, conn *connection) bool {
+	state, asked := game.recorder.State(), conn.options
+	rules := gameRules(state)
+	// the time control asked for may be written otherwise, as a preset
+	clock, askedClock := asked.clock()
+	switch {
+	case asked.Color != "" && asked.Color != "random" && asked.Color != opponent(game.creator):
+		return false
+	case askedClock && formatTimeControl(clock) != rules.TimeControl:
+		return false
+	case asked.FEN != "" && asked.FEN != rules.FEN:
+		return false
+	case asked.Takebacks != "" && asked.Takebacks != rules.Takebacks:
+		return false
+	case asked.Draws != "" && asked.Draws != rules.Draws:
+		return false
+	// asking for a rated game, or creating one, is asking for a rated
+	// opponent
+	case options.Rated != nil && *options.Rated && (conn.player == "" || asked.casual()):
+		return false
+	case asked.Rated != nil && *asked.Rated && (state.Casual || state.Players[game.creator] == ""):
+		return false
+	}
+	return true
+}
+
+// recordRules records the rules options ask for game, as color asked for
+// them: only standard games can be played back, and unlimited takebacks
+// leave the rating of nobody to them, nor do games started elsewhere
+func (game *ChessGame) recordRules(options GameOptions, color string) {
+	if options.Private {
+		game.recorder.Record(game.ctx, GameMadePrivate, color, nil)
+	}
+	if takebacks, _ := parseTakebacks(options.Takebacks); takebacks != "" && game.recorder.State().Variant == "" {
+		game.recorder.RecordTakebacks(game.ctx, takebacks)
+	}
+	if options.Draws == "never" {
+		game.recorder.Record(game.ctx, DrawOffersDisabled, color, nil)
+	}
+	if options.casual() {
+		game.recorder.Record(game.ctx, GameMadeCasual, color, nil)
+	}
+}
+
+// gameRules are the rules of the game of state as its start message
+// echoes them, but the color and blindfold which tell each player apart
+func gameRules(state GameState) *GameOptions {
+	rated := isRated(state)
+	rules := &GameOptions{
+		Variant:     state.Variant,
+		TimeControl: formatTimeControl(state.TimeControl),
+		Rated:       &rated,
+		FEN:         state.FEN,
+		Takebacks:   cmp.Or(state.Takebacks, takebacksNone),
+		Draws:       "allowed",
+		Private:     state.Private,
+	}
+	if state.DrawOffersDisabled {
+		rules.Draws = "never"
+	}
+	return rules
+}
+
+// formatTimeControl writes tc as parseTimeControl reads it, untimed if nil
+func formatTimeControl(tc *TimeControl) string {
+	if tc == nil {
+		return untimed
+	}
+	s := shortDuration(time.Duration(tc.InitialMs) * time.Millisecond)
+	if tc.IncrementMs > 0 {
+		s += "+" + shortDuration(time.Duration(tc.IncrementMs)*time.Millisecond)
+	}
+	return s
+}
+
+// shortDuration is d as time.Duration writes it, without the units left
+// at zero at its end: 5m rather than 5m0s
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+// startOptionsGame is startTestGame for a game created with options, the
+// players returned by the colors they play with
+func startOptionsGame(t *testing.T, options GameOptions) (game *ChessGame, white, black *testPlayer) {
+	t.Helper()
+	creator, joiner := newTestPlayer(t), newTestPlayer(t)
+	creator.conn.options = options
+	if err := games.Pair(context.Background(), creator.conn); err != nil {
+		t.Fatal(err)
+	}
+	games.mu.Lock()
+	game = games.seeks[len(games.seeks)-1]
+	games.mu.Unlock()
+	if err := games.Pair(context.Background(), joiner.conn); err != nil {
+		t.Fatal(err)
+	}
+	white, black = creator, joiner
+	if game.creator == "black" {
+		white, black = joiner, creator
+	}
+	return game, white, black
+}
+
+func TestParseGameOptions(t *testing.T) {
+	const fen = "4k3/8/8/8/8/8/4P3/4K3 b - - 0 1"
+	tests := []struct {
+		query  string
+		player string
+		want   string
+	}{
+		{query: "", want: ""},
+		{query: "color=black&takebacks=once&draws=never", want: ""},
+		{query: "timeControl=untimed", want: ""},
+		{query: "timeControl=5m%2B3s&rated=true", player: "p1", want: ""},
+		{query: "fen=" + url.QueryEscape(fen), want: ""},
+		{query: `options={"variant":"chess960"}`, want: "variant"},
+		{query: `options={"color":"green"}`, want: "color"},
+		{query: `options={"timeControl":"soon"}`, want: "timeControl"},
+		{query: `options={"draws":"always"}`, want: "draws"},
+		{query: `options={"fen":"not a position"}`, want: "fen"},
+		{query: `options={"unknown":true}`, want: "options"},
+		{query: "rated=true", want: "rated"},
+		{query: "rated=true&takebacks=unlimited", player: "p1", want: "rated"},
+		{query: "rated=true&fen=" + url.QueryEscape(fen), player: "p1", want: "rated"},
+		{query: "variant=bughouse&color=white", want: "color"},
+		{query: "variant=bughouse&takebacks=once", want: "takebacks"},
+	}
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, field, err := parseGameOptions(query, test.player)
+		if field != test.want || (err == nil) != (test.want == "") {
+			t.Errorf("%s: got %q, %v, want %q", test.query, field, err, test.want)
+		}
+	}
+
+	// casual is what asking for an unrated game was before
+	options, _, _ := parseGameOptions(url.Values{"casual": {"true"}, "options": {`{"private":true}`}}, "")
+	if options.Rated == nil || *options.Rated || !options.Private {
+		t.Errorf("got %+v", options)
+	}
+}
+
+func TestFormatTimeControl(t *testing.T) {
+	for _, want := range []string{untimed, "5m+3s", "1h", "1h30m+30s", "1m30s", "2.5s"} {
+		tc, _ := parseTimeControl(want)
+		if want == untimed {
+			tc = nil
+		}
+		if got := formatTimeControl(tc); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestGameOptionsColorAndFEN(t *testing.T) {
+	const fen = "4k3/8/8/8/8/8/4P3/4K3 b - - 0 1"
+	game, white, black := startOptionsGame(t, GameOptions{Color: "black", FEN: fen, Draws: "never"})
+	if game.creator != "black" {
+		t.Fatalf("creator plays %s", game.creator)
+	}
+	for _, player := range []*testPlayer{white, black} {
+		start := player.expect("start")
+		rules := start.Rules
+		if rules == nil || rules.FEN != fen || rules.Draws != "never" || rules.Rated == nil || *rules.Rated {
+			t.Errorf("got rules %+v", rules)
+		}
+		if player == black && start.Color != "black" {
+			t.Errorf("creator got color %s", start.Color)
+		}
+	}
+	if state := game.recorder.State(); !state.Casual || state.Turn() != "black" {
+		t.Errorf("got %+v", state)
+	}
+
+	// black moves first from the position
+	black.send(move("1", "e8", "d8"))
+	white.expect("move")
+	white.send(Message{Type: "draw_offer"})
+	if got := white.expect("error"); got.Code != CodeDrawOffersDisabled {
+		t.Errorf("got %+v offering a draw", got)
+	}
+}
+
+func TestGameOptionsMatchSeeks(t *testing.T) {
+	// a seek of its own, not one the other tests could be paired with
+	recorder := newGameRecorder("seek", "", timeControl, "")
+	recorder.RecordTakebacks(context.Background(), takebacksOnce)
+	game := newChessGame(context.Background(), "seek", recorder, nil)
+	game.options = GameOptions{Color: "white", Takebacks: takebacksOnce}
+
+	tests := []struct {
+		options GameOptions
+		want    bool
+	}{
+		{options: GameOptions{}, want: true},
+		{options: GameOptions{Color: "black", Takebacks: takebacksOnce}, want: true},
+		{options: GameOptions{Color: "random"}, want: true},
+		{options: GameOptions{Color: "white"}, want: false},
+		{options: GameOptions{Takebacks: takebacksNone}, want: false},
+		{options: GameOptions{Draws: "never"}, want: false},
+		{options: GameOptions{TimeControl: "1h"}, want: false},
+		{options: GameOptions{Rated: new(bool)}, want: true},
+	}
+	for _, test := range tests {
+		joiner := &connection{options: test.options}
+		if got := eligible(game, joiner); got != test.want {
+			t.Errorf("%+v: got %v", test.options, got)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+var errInvalidGameFilter = errors.New("games are filtered by color=white|black, result=win|draw|loss, pool, rated=true|false, opponent, and since and until as in 2024-01-31")
+
+// gameFilter picks some of the games of a player, those of the fields
+// left empty are not picked by them
+type gameFilter struct {
+	Color    string
+	Result   string
+	Pool     string
+	Rated    *bool
+	Opponent string
+	// Since and Until bound when the games ended, Until excluded
+	Since, Until time.Time
+}
+
+func parseGameFilter(query url.Values) (gameFilter, error) {
+	f := gameFilter{
+		Color:    query.Get("color"),
+		Result:   query.Get("result"),
+		Pool:     query.Get("pool"),
+		Opponent: query.Get("opponent"),
+	}
+	if f.Color != "" && f.Color != "white" && f.Color != "black" {
+		return gameFilter{}, errInvalidGameFilter
+	}
+	if f.Result != "" && f.Result != "win" && f.Result != "draw" && f.Result != "loss" {
+		return gameFilter{}, errInvalidGameFilter
+	}
+	switch query.Get("rated") {
+	case "":
+	case "true", "false":
+		rated := query.Get("rated") == "true"
+		f.Rated = &rated
+	default:
+		return gameFilter{}, errInvalidGameFilter
+	}
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return gameFilter{}, errInvalidGameFilter
+		}
+		*bound.t = t
+	}
+	return f, nil
+}
+
+func (f gameFilter) matches(game PlayerGame) bool {
+	return (f.Color == "" || game.Color == f.Color) &&
+		(f.Result == "" || game.Result == f.Result) &&
+		(f.Pool == "" || game.Pool == f.Pool) &&
+		(f.Rated == nil || game.Rated == *f.Rated) &&
+		(f.Opponent == "" || game.Opponent == f.Opponent) &&
+		(f.Since.IsZero() || !game.EndedAt.Before(f.Since)) &&
+		(f.Until.IsZero() || game.EndedAt.Before(f.Until))
+}
+
+// filteredGames answers the request itself with the games of the player of
+// the path the filter of the query picks, unless it is not ok
+func filteredGames(w http.ResponseWriter, r *http.Request) (games []PlayerGame, ok bool) {
+	f, err := parseGameFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	player, err := players.Load(r.PathValue("id"))
+	if errors.Is(err, ErrPlayerNotFound) {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	for _, game := range player.Games {
+		if f.matches(game) {
+			games = append(games, game)
+		}
+	}
+	return games, true
+}
+
+// playerNames are the names of the accounts loaded so far, by ID
+type playerNames map[string]string
+
+func (names playerNames) of(id string) string {
+	name, ok := names[id]
+	if !ok {
+		name = "?"
+		if player, err := players.Load(id); err == nil {
+			name = player.Name
+		}
+		names[id] = name
+	}
+	return name
+}
+
+// gamePGN is the game of state in PGN, not ok unless it was played on a
+// board of standard chess
+func gamePGN(state GameState, names playerNames) (game chess.PGN, ok bool) {
+	event := "Casual game"
+	if isRated(state) {
+		event = "Rated game"
+	}
+	result := state.Result
+	if result == "" {
+		result = "*"
+	}
+	game = chess.PGN{Result: result, Tags: []chess.Tag{
+		{Name: "Event", Value: event},
+		{Name: "Site", Value: strings.TrimSuffix(publicURL, "/") + "/g/" + state.Slug},
+		{Name: "Date", Value: state.CreatedAt.Format("2006.01.02")},
+		{Name: "White", Value: seatName(state, "white", names)},
+		{Name: "Black", Value: seatName(state, "black", names)},
+		{Name: "Result", Value: result},
+	}}
+	tc := "-"
+	if state.TimeControl != nil {
+		tc = fmt.Sprintf("%d+%d", state.TimeControl.InitialMs/1000, state.TimeControl.IncrementMs/1000)
+	}
+	game.Tags = append(game.Tags, chess.Tag{Name: "TimeControl", Value: tc})
+	if state.Variant != "" {
+		game.Tags = append(game.Tags, chess.Tag{Name: "Variant", Value: state.Variant})
+	}
+	if state.FEN != "" {
+		game.Tags = append(game.Tags, chess.Tag{Name: "SetUp", Value: "1"}, chess.Tag{Name: "FEN", Value: state.FEN})
+	}
+	position := startPosition(state.FEN)
+	for _, m := range state.Moves {
+		parsed, err := chess.ParseMove(m.UCI())
+		if err != nil || !position.IsLegal(parsed) {
+			return chess.PGN{}, false
+		}
+		game.Moves = append(game.Moves, &chess.PGNMove{Move: parsed})
+		position = position.Apply(parsed)
+	}
+	return game, true
+}
+
+// seatName is the name of who played color in state: their account's,
+// the engine's, the one imported games give, or ? for those who played
+// without an account
+func seatName(state GameState, color string, names playerNames) string {
+	if name := state.Names[color]; name != "" {
+		return name
+	}
+	if engine := state.Engines[color]; engine != "" {
+		return engine
+	}
+	if id := state.Players[color]; id != "" {
+		return names.of(id)
+	}
+	return "?"
+}
+
+// gamesPGNHandler serves the games of a player the filter of the query
+// picks in PGN, one after another as they are loaded from the archive;
+// the games not played on a board of standard chess are left out
+func gamesPGNHandler(w http.ResponseWriter, r *http.Request) {
+	games, ok := filteredGames(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-chess-pgn")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+r.PathValue("id")+`.pgn"`)
+	rc := http.NewResponseController(w)
+	names := playerNames{}
+	written := 0
+	for _, game := range games {
+		state, ok, err := archivedGameIn(archiveStore, game.ID)
+		if err != nil {
+			// the games so far have been sent, the file can only be cut short
+			log.Printf("cannot export game %s of player %s: %v", game.ID, r.PathValue("id"), err)
+			return
+		}
+		pgn, standard := gamePGN(state, names)
+		if !ok || !standard {
+			continue
+		}
+		if written > 0 {
+			io.WriteString(w, "\n")
+		}
+		if _, err := io.WriteString(w, pgn.String()); err != nil {
+			return
+		}
+		rc.Flush()
+		written++
+	}
+}
+
+// gamesNDJSONHandler serves the documents of the games of a player the
+// filter of the query picks, one JSON object a line, as they are loaded
+// from the archive
+func gamesNDJSONHandler(w http.ResponseWriter, r *http.Request) {
+	games, ok := filteredGames(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	rc := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	for _, game := range games {
+		events, err := archiveStore.Load(game.ID)
+		if errors.Is(err, ErrGameNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("cannot export game %s of player %s: %v", game.ID, r.PathValue("id"), err)
+			return
+		}
+		if err := encoder.Encode(newGameDocument(Replay(events), events)); err != nil {
+			return
+		}
+		rc.Flush()
+	}
+}
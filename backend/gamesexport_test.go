@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+func TestGamesPGN(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana, bo := newPlayer("ana"), newPlayer("bo")
+	players.Create(bo)
+	ctx := context.Background()
+	archive := func(id, variant, moves string) {
+		recorder := newGameRecorder(id, "s"+id, &TimeControl{InitialMs: 180000, IncrementMs: 2000}, variant)
+		recorder.Record(ctx, GameCreated, "", nil)
+		recorder.RecordJoin(ctx, "white", ana.ID)
+		recorder.RecordJoin(ctx, "black", bo.ID)
+		for _, m := range strings.Fields(moves) {
+			recorder.Record(ctx, MoveMade, "", &Move{From: m[:2], To: m[2:]})
+		}
+		recorder.Record(ctx, GameResigned, "black", nil)
+	}
+	archive("pgn-1", "", "e2e4 e7e5 g1f3")
+	archive("pgn-2", "", "d2d4")
+	archive("pgn-3", "bughouse", "e2e4")
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ana.Games = []PlayerGame{
+		{ID: "pgn-1", Color: "white", Result: "win", Opponent: bo.ID, EndedAt: day},
+		{ID: "pgn-2", Color: "white", Result: "win", Opponent: bo.ID, EndedAt: day.AddDate(0, 0, 1)},
+		{ID: "pgn-3", Color: "white", Result: "win", Opponent: bo.ID, EndedAt: day.AddDate(0, 0, 2)},
+		{ID: "pgn-gone", Color: "white", Result: "win", EndedAt: day.AddDate(0, 0, 3)},
+	}
+	players.Create(ana)
+
+	get := func(query string) (int, []chess.PGN) {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/"+ana.ID+"/games.pgn"+query, nil))
+		var list []chess.PGN
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		for _, text := range strings.SplitAfter(w.Body.String(), "1-0\n") {
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			game, err := chess.ParsePGN(text)
+			if err != nil {
+				t.Fatalf("%v in %q", err, text)
+			}
+			list = append(list, game)
+		}
+		return w.Code, list
+	}
+	code, list := get("")
+	if code != http.StatusOK || len(list) != 3 {
+		t.Fatalf("got %d %+v", code, list)
+	}
+	if game := list[0]; game.Tag("White") != "ana" || game.Tag("Black") != "bo" || game.Tag("TimeControl") != "180+2" || game.Result != "1-0" || len(game.Moves) != 3 {
+		t.Errorf("got %+v", game)
+	}
+	if list[2].Tag("Variant") != "bughouse" {
+		t.Errorf("got %+v", list[2])
+	}
+	if _, list := get("?since=2024-03-02&until=2024-03-03"); len(list) != 1 || len(list[0].Moves) != 1 {
+		t.Errorf("got %+v since march 2", list)
+	}
+	if _, list := get("?result=loss"); len(list) != 0 {
+		t.Errorf("got %+v lost", list)
+	}
+	if code, _ := get("?color=red"); code != http.StatusBadRequest {
+		t.Errorf("got %d for a wrong color", code)
+	}
+}
+
+func TestGamesNDJSON(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana := newPlayer("ana")
+	ctx := context.Background()
+	for _, id := range []string{"ndjson-1", "ndjson-2", "ndjson-3"} {
+		recorder := newGameRecorder(id, "", nil, "")
+		recorder.Record(ctx, GameCreated, "", nil)
+		recorder.Record(ctx, MoveMade, "", &Move{From: "e2", To: "e4"})
+	}
+	ana.Games = []PlayerGame{
+		{ID: "ndjson-1", Color: "white", Result: "win", Pool: "blitz"},
+		{ID: "ndjson-2", Color: "black", Result: "draw", Pool: "rapid"},
+		{ID: "ndjson-3", Color: "white", Result: "loss", Pool: "blitz"},
+	}
+	players.Create(ana)
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/"+ana.ID+"/games.ndjson?pool=blitz", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if lines := strings.Count(w.Body.String(), "\n"); lines != 2 {
+		t.Errorf("got %d lines", lines)
+	}
+	decoder := json.NewDecoder(w.Body)
+	var ids []string
+	for decoder.More() {
+		var doc gameDocument
+		if err := decoder.Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		if len(doc.Moves) != 1 || doc.Moves[0].SAN != "e4" {
+			t.Errorf("got %+v", doc)
+		}
+		ids = append(ids, doc.ID)
+	}
+	if strings.Join(ids, ",") != "ndjson-1,ndjson-3" {
+		t.Errorf("got %v", ids)
+	}
+}
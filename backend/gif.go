@@ -0,0 +1,75 @@
+package main
+
+import (
+	"image/gif"
+	"net/http"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+const (
+	defaultGIFDelay = time.Second
+	maxGIFDelay     = 10 * time.Second
+	// the last frame stays this much longer than the others
+	gifFinalPause = 3
+	// maxGIFPixels bounds the frames of an animation, long games get smaller ones
+	maxGIFPixels = 64 << 20
+)
+
+// gameGIFHandler animates the moves of a finished game, one frame each
+// ?delay=1s apart, seen from ?orientation=white or black and ?size pixels wide
+func gameGIFHandler(w http.ResponseWriter, r *http.Request) {
+	size, ok := boardSize(w, r)
+	if !ok {
+		return
+	}
+	flipped, ok := boardFlipped(w, r)
+	if !ok {
+		return
+	}
+	delay := defaultGIFDelay
+	if value := r.URL.Query().Get("delay"); value != "" {
+		var err error
+		// gif delays are counted in hundredths of a second
+		if delay, err = time.ParseDuration(value); err != nil || delay < 10*time.Millisecond || delay > maxGIFDelay {
+			http.Error(w, "invalid delay", http.StatusBadRequest)
+			return
+		}
+	}
+	state, ok := loadWatchedGame(w, r)
+	if !ok {
+		return
+	}
+	if !state.Finished {
+		http.Error(w, "the game is not over yet", http.StatusConflict)
+		return
+	}
+	if notModified(w, r, state) {
+		return
+	}
+
+	_, played := positionAfter(state.FEN, state.Moves)
+	// every frame is kept until the whole animation is encoded
+	scale := size / (8 * maskSize)
+	for scale > 1 && (played+1)*(8*maskSize*scale)*(8*maskSize*scale) > maxGIFPixels {
+		scale--
+	}
+	view := boardView{position: startPosition(state.FEN), flipped: flipped}
+	animation := &gif.GIF{}
+	centiseconds := int(delay / (10 * time.Millisecond))
+	animation.Image = append(animation.Image, view.image(scale))
+	animation.Delay = append(animation.Delay, centiseconds)
+	for _, m := range state.Moves[:played] {
+		// positionAfter checked every move played
+		parsed, _ := chess.ParseMove(m.UCI())
+		view.position, view.last = view.position.Apply(parsed), &parsed
+		animation.Image = append(animation.Image, view.image(scale))
+		animation.Delay = append(animation.Delay, centiseconds)
+	}
+	animation.Delay[len(animation.Delay)-1] *= gifFinalPause
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Content-Disposition", `inline; filename="`+state.ID+`.gif"`)
+	gif.EncodeAll(w, animation)
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// graphQLSchema covers the players and the games archived, and the events
+// of live games as they are played
+const graphQLSchema = `
+schema {
+	query: Query
+	subscription: Subscription
+}
+
+type Query {
+	player(id: ID!): Player
+	# token is a spectator token, for private games
+	game(id: ID!, token: String): Game
+}
+
+type Subscription {
+	gameEvents(id: ID!, token: String): GameEvent!
+}
+
+type Player {
+	id: ID!
+	name: String!
+	country: String
+	createdAt: String!
+	deleted: Boolean!
+	ratings: [Rating!]!
+	# games are the last ones the player finished, the latest first
+	games(last: Int = 10): [PlayerGame!]!
+	stats: Stats!
+}
+
+type Rating {
+	pool: String!
+	rating: Int!
+	games: Int!
+}
+
+type PlayerGame {
+	game: Game
+	color: String!
+	result: String!
+	opponent: Player
+	pool: String!
+	rated: Boolean!
+	endedAt: String!
+}
+
+type Record {
+	games: Int!
+	wins: Int!
+	draws: Int!
+	losses: Int!
+}
+
+type Stats {
+	white: Record!
+	black: Record!
+	averageMoves: Float!
+	openings: [OpeningRecord!]!
+}
+
+type OpeningRecord {
+	eco: String!
+	name: String!
+	record: Record!
+	score: Float!
+}
+
+type Game {
+	id: ID!
+	slug: String
+	createdAt: String!
+	rated: Boolean!
+	finished: Boolean!
+	result: String
+	reason: String
+	variant: String
+	white: Player
+	black: Player
+	moves: [Move!]!
+	# spectators is how many watch the game live, 0 once it is over
+	spectators: Int!
+}
+
+type Move {
+	ply: Int!
+	color: String!
+	uci: String!
+	san: String
+}
+
+type GameEvent {
+	seq: Int!
+	type: String!
+	color: String
+	move: String
+	time: String!
+}
+`
+
+// maxGraphQLGames bounds the games of a player asked for at once
+const maxGraphQLGames = 100
+
+var errPrivateGame = errors.New("the game is private, a spectator token is needed to watch it")
+
+var graphQL = graphql.MustParseSchema(graphQLSchema, &graphQLResolver{}, graphql.MaxDepth(8))
+
+type graphQLResolver struct{}
+
+func (*graphQLResolver) Player(args struct{ ID graphql.ID }) (*playerResolver, error) {
+	return loadPlayerResolver(string(args.ID))
+}
+
+func (*graphQLResolver) Game(args struct {
+	ID    graphql.ID
+	Token *string
+}) (*gameResolver, error) {
+	return loadGameResolver(string(args.ID), deref(args.Token))
+}
+
+// GameEvents are the events of a live game from now on, until it ends or
+// the subscriber goes away; those of rated games are kept behind, see
+// spectatorDelay
+func (*graphQLResolver) GameEvents(ctx context.Context, args struct {
+	ID    graphql.ID
+	Token *string
+}) (<-chan *gameEventResolver, error) {
+	// subscribing first, not to miss what is recorded while loading
+	events, cancel := feeds.subscribe(string(args.ID))
+	recorded, err := store.Load(string(args.ID))
+	held := newHeldEvents(recorded, false)
+	state := held.state
+	// the events from now on are those spectators are not shown yet
+	held.release(time.Now())
+	if err == nil && !canWatchWith(deref(args.Token), state) {
+		err = errPrivateGame
+	}
+	if err == nil && state.Finished {
+		err = errGameFinished
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	out := make(chan *gameEventResolver)
+	go func() {
+		defer close(out)
+		defer cancel()
+		for !held.over() {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				held.add(event)
+			case <-held.wake(time.Now()):
+			case <-ctx.Done():
+				return
+			}
+			for _, event := range held.release(time.Now()) {
+				select {
+				case out <- &gameEventResolver{event}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+var errGameFinished = errors.New("the game is over")
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// loadPlayerResolver is nil for players that do not exist
+func loadPlayerResolver(id string) (*playerResolver, error) {
+	player, err := players.Load(id)
+	if errors.Is(err, ErrPlayerNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &playerResolver{player}, nil
+}
+
+// loadGameResolver is nil for games not archived
+func loadGameResolver(id, token string) (*gameResolver, error) {
+	events, err := store.Load(id)
+	if errors.Is(err, ErrGameNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := Replay(events)
+	if !canWatchWith(token, state) {
+		return nil, errPrivateGame
+	}
+	if n := spectatorCutoff(state, events, time.Now()); n < len(events) {
+		events = events[:n]
+		state = Replay(events)
+	}
+	return &gameResolver{newGameDocument(state, events)}, nil
+}
+
+type playerResolver struct{ player Player }
+
+func (r *playerResolver) ID() graphql.ID    { return graphql.ID(r.player.ID) }
+func (r *playerResolver) Name() string      { return r.player.Name }
+func (r *playerResolver) Country() *string  { return optional(r.player.Country) }
+func (r *playerResolver) CreatedAt() string { return r.player.CreatedAt.Format(time.RFC3339) }
+func (r *playerResolver) Deleted() bool     { return r.player.Deleted }
+
+// Ratings are by pool, in the order of their names
+func (r *playerResolver) Ratings() []graphQLRating {
+	list := []graphQLRating{}
+	for pool, rating := range r.player.Ratings {
+		list = append(list, graphQLRating{pool, int32(rating.Rating), int32(rating.Games)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].pool < list[j].pool })
+	return list
+}
+
+func (r *playerResolver) Games(args struct{ Last int32 }) []*playerGameResolver {
+	list := []*playerGameResolver{}
+	games := r.player.Games
+	for i := len(games) - 1; i >= 0 && len(list) < int(min(args.Last, maxGraphQLGames)); i-- {
+		list = append(list, &playerGameResolver{games[i]})
+	}
+	return list
+}
+
+func (r *playerResolver) Stats() (*statsResolver, error) {
+	stats, err := newPlayerStats(r.player)
+	if err != nil {
+		return nil, err
+	}
+	return &statsResolver{stats}, nil
+}
+
+type graphQLRating struct {
+	pool          string
+	rating, games int32
+}
+
+func (r graphQLRating) Pool() string  { return r.pool }
+func (r graphQLRating) Rating() int32 { return r.rating }
+func (r graphQLRating) Games() int32  { return r.games }
+
+type playerGameResolver struct{ game PlayerGame }
+
+// Game is nil for games no longer archived, or private
+func (r *playerGameResolver) Game() (*gameResolver, error) {
+	game, err := loadGameResolver(r.game.ID, "")
+	if errors.Is(err, errPrivateGame) {
+		return nil, nil
+	}
+	return game, err
+}
+
+func (r *playerGameResolver) Color() string   { return r.game.Color }
+func (r *playerGameResolver) Result() string  { return r.game.Result }
+func (r *playerGameResolver) Pool() string    { return r.game.Pool }
+func (r *playerGameResolver) Rated() bool     { return r.game.Rated }
+func (r *playerGameResolver) EndedAt() string { return r.game.EndedAt.Format(time.RFC3339) }
+
+func (r *playerGameResolver) Opponent() (*playerResolver, error) {
+	if r.game.Opponent == "" {
+		return nil, nil
+	}
+	return loadPlayerResolver(r.game.Opponent)
+}
+
+type recordResolver struct{ count gameCount }
+
+func (r recordResolver) Games() int32  { return int32(r.count.All) }
+func (r recordResolver) Wins() int32   { return int32(r.count.Wins) }
+func (r recordResolver) Draws() int32  { return int32(r.count.Draws) }
+func (r recordResolver) Losses() int32 { return int32(r.count.Losses) }
+
+type statsResolver struct{ stats playerStats }
+
+func (r *statsResolver) White() recordResolver { return recordResolver{r.stats.ByColor["white"]} }
+func (r *statsResolver) Black() recordResolver { return recordResolver{r.stats.ByColor["black"]} }
+func (r *statsResolver) AverageMoves() float64 { return r.stats.AverageMoves }
+
+func (r *statsResolver) Openings() []openingResolver {
+	list := make([]openingResolver, len(r.stats.Openings))
+	for i, o := range r.stats.Openings {
+		list[i] = openingResolver{o}
+	}
+	return list
+}
+
+type openingResolver struct{ stats openingStats }
+
+func (r openingResolver) ECO() string            { return r.stats.ECO }
+func (r openingResolver) Name() string           { return r.stats.Name }
+func (r openingResolver) Record() recordResolver { return recordResolver{r.stats.Count} }
+func (r openingResolver) Score() float64         { return r.stats.Score }
+
+type gameResolver struct{ doc gameDocument }
+
+func (r *gameResolver) ID() graphql.ID    { return graphql.ID(r.doc.ID) }
+func (r *gameResolver) Slug() *string     { return optional(r.doc.Slug) }
+func (r *gameResolver) CreatedAt() string { return r.doc.CreatedAt.Format(time.RFC3339) }
+func (r *gameResolver) Rated() bool       { return r.doc.Rated }
+func (r *gameResolver) Finished() bool    { return r.doc.Finished }
+func (r *gameResolver) Result() *string   { return optional(r.doc.Result) }
+func (r *gameResolver) Reason() *string   { return optional(r.doc.Reason) }
+func (r *gameResolver) Variant() *string  { return optional(r.doc.Variant) }
+func (r *gameResolver) Spectators() int32 { return int32(r.doc.Spectators) }
+
+func (r *gameResolver) White() (*playerResolver, error) { return r.seat("white") }
+func (r *gameResolver) Black() (*playerResolver, error) { return r.seat("black") }
+
+// seat is the account that played color, nil for those who had none
+func (r *gameResolver) seat(color string) (*playerResolver, error) {
+	id := r.doc.Players[color].Player
+	if id == "" {
+		return nil, nil
+	}
+	return loadPlayerResolver(id)
+}
+
+func (r *gameResolver) Moves() []moveResolver {
+	list := make([]moveResolver, len(r.doc.Moves))
+	for i, m := range r.doc.Moves {
+		list[i] = moveResolver{m}
+	}
+	return list
+}
+
+type moveResolver struct{ move documentMove }
+
+func (r moveResolver) Ply() int32    { return int32(r.move.Ply) }
+func (r moveResolver) Color() string { return r.move.Color }
+func (r moveResolver) UCI() string   { return r.move.UCI }
+func (r moveResolver) SAN() *string  { return optional(r.move.SAN) }
+
+type gameEventResolver struct{ event Event }
+
+func (r *gameEventResolver) Seq() int32     { return int32(r.event.Seq) }
+func (r *gameEventResolver) Type() string   { return string(r.event.Type) }
+func (r *gameEventResolver) Color() *string { return optional(r.event.Color) }
+func (r *gameEventResolver) Time() string   { return r.event.Time.Format(time.RFC3339Nano) }
+
+func (r *gameEventResolver) Move() *string {
+	if r.event.Move == nil {
+		return nil
+	}
+	return optional(r.event.Move.UCI())
+}
+
+// graphQLRequest is a query posted, or given in the URL of a GET request
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphQLHandler runs the query of the request. Subscriptions are served
+// as Server-Sent Events to those who accept them, a next event a result
+// and a complete event once there are no more
+func graphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	if r.Method == http.MethodGet {
+		req.Query, req.OperationName = r.URL.Query().Get("query"), r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				http.Error(w, "invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid GraphQL request", http.StatusBadRequest)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		writeJSON(w, graphQL.Exec(r.Context(), req.Query, req.OperationName, req.Variables))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	results, err := graphQL.Subscribe(r.Context(), req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	keepOpen(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for result := range results {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+	fmt.Fprint(w, "event: complete\ndata:\n\n")
+	flusher.Flush()
+}
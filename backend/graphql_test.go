@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// graphQLQuery posts query to the GraphQL endpoint, decoding the data
+// of the answer into data
+func graphQLQuery(t *testing.T, query string, variables map[string]any, data any) []string {
+	t.Helper()
+	body, _ := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body))))
+	var answer struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+		t.Fatalf("%v in %s", err, w.Body)
+	}
+	json.Unmarshal(answer.Data, data)
+	var errs []string
+	for _, err := range answer.Errors {
+		errs = append(errs, err.Message)
+	}
+	return errs
+}
+
+func TestGraphQLQueries(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana, bo := newPlayer("ana"), newPlayer("bo")
+	ana.Ratings = map[string]Rating{"blitz": {Rating: 1550, Games: 3}}
+	ctx := context.Background()
+	recorder := newGameRecorder("graphql-1", "", nil, "")
+	recorder.Record(ctx, GameCreated, "", nil)
+	recorder.RecordJoin(ctx, "white", ana.ID)
+	recorder.RecordJoin(ctx, "black", bo.ID)
+	recorder.Record(ctx, MoveMade, "white", &Move{From: "e2", To: "e4"})
+	recorder.Record(ctx, GameResigned, "black", nil)
+	private := newGameRecorder("graphql-2", "", nil, "")
+	private.Record(ctx, GameCreated, "", nil)
+	private.Record(ctx, GameMadePrivate, "white", nil)
+	ana.Games = []PlayerGame{
+		{ID: "graphql-2", Color: "white", Result: "draw", Pool: "blitz"},
+		{ID: "graphql-1", Color: "white", Result: "win", Opponent: bo.ID, Pool: "blitz"},
+	}
+	players.Create(ana)
+	players.Create(bo)
+
+	var data struct {
+		Player struct {
+			Name    string
+			Ratings []struct {
+				Pool   string
+				Rating int
+			}
+			Games []struct {
+				Result   string
+				Opponent *struct{ Name string }
+				Game     *struct {
+					Result string
+					Black  struct{ Name string }
+					Moves  []struct{ SAN string }
+				}
+			}
+			Stats struct {
+				White struct{ Games, Wins int }
+			}
+		}
+	}
+	errs := graphQLQuery(t, `query($id: ID!) {
+		player(id: $id) {
+			name
+			ratings { pool rating }
+			games(last: 5) { result opponent { name } game { result black { name } moves { san } } }
+			stats { white { games wins } }
+		}
+	}`, map[string]any{"id": ana.ID}, &data)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	p := data.Player
+	if p.Name != "ana" || len(p.Ratings) != 1 || p.Ratings[0].Rating != 1550 || p.Stats.White.Games != 2 || p.Stats.White.Wins != 1 {
+		t.Errorf("got %+v", p)
+	}
+	if len(p.Games) != 2 || p.Games[0].Opponent == nil || p.Games[0].Opponent.Name != "bo" || p.Games[0].Game == nil {
+		t.Fatalf("got %+v", p.Games)
+	}
+	if game := p.Games[0].Game; game.Result != "1-0" || game.Black.Name != "bo" || len(game.Moves) != 1 || game.Moves[0].SAN != "e4" {
+		t.Errorf("got %+v", game)
+	}
+	// the private game is left out, without a spectator token
+	if p.Games[1].Game != nil {
+		t.Errorf("got %+v", p.Games[1].Game)
+	}
+	if errs := graphQLQuery(t, `{ game(id: "graphql-2") { id } }`, nil, &data); len(errs) != 1 {
+		t.Errorf("got %v for a private game", errs)
+	}
+	var missing struct{ Player *struct{ Name string } }
+	if errs := graphQLQuery(t, `{ player(id: "nobody") { name } }`, nil, &missing); errs != nil || missing.Player != nil {
+		t.Errorf("got %v %+v for a missing player", errs, missing)
+	}
+}
+
+func TestGraphQLSubscription(t *testing.T) {
+	server := httptest.NewServer(newPublicMux())
+	defer server.Close()
+	ctx := context.Background()
+	recorder := newGameRecorder(newGameID(), "", nil, "")
+	recorder.Record(ctx, GameCreated, "", nil)
+	id := recorder.State().ID
+
+	body, _ := json.Marshal(graphQLRequest{Query: `subscription($id: ID!) { gameEvents(id: $id) { type color move } }`, Variables: map[string]any{"id": id}})
+	r, _ := http.NewRequest("POST", server.URL+"/graphql", strings.NewReader(string(body)))
+	r.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	waitFor(t, func() bool {
+		feeds.mu.Lock()
+		defer feeds.mu.Unlock()
+		return len(feeds.subscribers[id]) > 0
+	})
+	recorder.Record(ctx, MoveMade, "white", &Move{From: "e2", To: "e4"})
+	recorder.Record(ctx, GameResigned, "black", nil)
+
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			events = append(events, data)
+		}
+		if line == "event: complete" {
+			break
+		}
+	}
+	want := []string{
+		`{"data":{"gameEvents":{"type":"move_made","color":"white","move":"e2e4"}}}`,
+		`{"data":{"gameEvents":{"type":"game_resigned","color":"black","move":null}}}`,
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %v", events)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+func init() {
+	registerVariant(handAndBrain, variantKind{
+		pair: (*gameManager).PairHandAndBrain,
+		newGame: func(game *ChessGame) variant {
+			brains := map[string]*outbox{brainSeat("white"): newOutbox(nil), brainSeat("black"): newOutbox(nil)}
+			return handAndBrainGame{game: game, brains: brains}
+		},
+	})
+}
+
+// handAndBrainGame is the variant of a hand and brain game, brains are the
+// outboxes of its brains by seat; like the rest they are owned by the loop
+type handAndBrainGame struct {
+	standard
+	game   *ChessGame
+	brains map[string]*outbox
+}
+
+func (hb handAndBrainGame) seats() map[string]*outbox {
+	return hb.brains
+}
+
+// handle lets the brains name the pieces their hands move, which is all
+// they do
+func (hb handAndBrainGame) handle(seat string, message Message, flagged func(string) bool) (bool, bool) {
+	side, role := seatRole(seat)
+	if role != "brain" && message.Type != "name_piece" {
+		return false, false
+	}
+	game := hb.game
+	box := game.outboxes()[seat]
+	if role != "brain" || message.Type != "name_piece" {
+		box.SendTransient(errorMessage(CodeWrongRole))
+		return true, false
+	}
+	state := game.recorder.State()
+	if state.Turn() != side {
+		box.SendTransient(errorMessage(CodeNotYourTurn))
+		return true, false
+	}
+	if flagged(side) {
+		return true, true
+	}
+	if state.NamedPiece != "" || !canMovePiece(state, message.Piece) {
+		box.SendTransient(errorMessage(CodeWrongPiece))
+		return true, false
+	}
+	game.recorder.RecordPieceNamed(game.ctx, side, message.Piece)
+	game.outboxes()[side].Send(Message{Type: "name_piece", Color: side, Piece: message.Piece})
+	return true, false
+}
+
+// check makes sure the hand moves the piece its brain named
+func (hb handAndBrainGame) check(state GameState, m *Move) (string, chess.Status) {
+	return handMove(state, m)
+}
+
+// moved shows the brains every move
+func (hb handAndBrainGame) moved(color string, message Message, before GameState) {
+	for _, brain := range hb.brains {
+		brain.Send(message)
+	}
+}
+
+// brainSeat is the seat of the brain of color in hand and brain, the hand
+// sits at the seat named after the color as any other player
+func brainSeat(color string) string {
+	return color + "_brain"
+}
+
+// seatRole is the color seat plays and its role, brain, coach or empty
+func seatRole(seat string) (color, role string) {
+	if color, ok := strings.CutSuffix(seat, "_brain"); ok {
+		return color, "brain"
+	}
+	if color, ok := strings.CutSuffix(seat, "_coach"); ok {
+		return color, "coach"
+	}
+	return seat, ""
+}
+
+// PairHandAndBrain puts conn in the queue for a hand and brain game, which
+// starts once four players are in it
+func (m *gameManager) PairHandAndBrain(ctx context.Context, conn *connection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.canCreate(); err != nil {
+		return err
+	}
+	players, err := m.enqueue(handAndBrain, conn)
+	if players == nil {
+		return err
+	}
+
+	// the first two players are the hand and brain of white, the others of black
+	game := openGame(ctx, players[0], handAndBrain, nil, nil, 0)
+	game.seatBrain("white", players[1])
+	game.seatBrain("black", players[3])
+	// registered first, as paired games are
+	m.active[game.id] = game
+	if err := game.Join(ctx, players[2]); err != nil {
+		delete(m.active, game.id)
+		// white left while queued, the others wait for the next game
+		m.queues[handAndBrain] = append(m.queues[handAndBrain], players[1:]...)
+		return nil
+	}
+	go game.forward(brainSeat("white"), players[1])
+	go game.forward(brainSeat("black"), players[3])
+	return nil
+}
+
+// seatBrain puts conn in the game as the brain of color, before black joins
+func (game *ChessGame) seatBrain(color string, conn *connection) {
+	seat := brainSeat(color)
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	game.tokens[seat] = newToken()
+	game.attach(seat, conn)
+	game.connected[seat] = true
+	game.recorder.Record(game.ctx, BrainJoined, color, nil)
+}
+
+// canMovePiece reports whether the side to move in state has a legal move
+// of a piece of type piece, the letter a brain names
+func canMovePiece(state GameState, piece string) bool {
+	position, played := positionAfter(state.FEN, state.Moves)
+	if played < len(state.Moves) {
+		return false
+	}
+	for _, m := range position.LegalMoves() {
+		if position.PieceAt(m.From).Type().String() == piece {
+			return true
+		}
+	}
+	return false
+}
+
+// handMove checks m, played by a hand in the hand and brain game state got
+// to, returning the code to refuse it with, if any, and the status of the
+// position it leads to
+func handMove(state GameState, m *Move) (string, chess.Status) {
+	if state.NamedPiece == "" {
+		return CodePieceNotNamed, chess.Ongoing
+	}
+	code, status := standardMove(state, m)
+	if code != "" {
+		return code, chess.Ongoing
+	}
+	// the move is legal, so its from square is one
+	position, _ := positionAfter(state.FEN, state.Moves)
+	from, _ := chess.ParseSquare(m.From)
+	if position.PieceAt(from).Type().String() != state.NamedPiece {
+		return CodeWrongPiece, chess.Ongoing
+	}
+	return "", status
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHandAndBrain(t *testing.T) {
+	players := [4]*testPlayer{}
+	for i := range players {
+		players[i] = newTestPlayer(t)
+		if err := games.PairHandAndBrain(context.Background(), players[i].conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range []struct{ color, role string }{{"white", ""}, {"white", "brain"}, {"black", ""}, {"black", "brain"}} {
+		got := players[i].expect("start")
+		if got.Color != want.color || got.Role != want.role || got.Variant != handAndBrain || got.Token == "" {
+			t.Fatalf("player %d got %+v", i, got)
+		}
+	}
+	whiteHand, whiteBrain, blackHand, blackBrain := players[0], players[1], players[2], players[3]
+
+	whiteHand.send(move("1", "e2", "e4"))
+	whiteHand.expect("error", CodePieceNotNamed)
+	whiteBrain.send(move("2", "e2", "e4"))
+	whiteBrain.expect("error", CodeWrongRole)
+	whiteHand.send(Message{Type: "name_piece", Piece: "p"})
+	whiteHand.expect("error", CodeWrongRole)
+	blackBrain.send(Message{Type: "name_piece", Piece: "p"})
+	blackBrain.expect("error", CodeNotYourTurn)
+	// no bishop can move yet
+	whiteBrain.send(Message{Type: "name_piece", Piece: "b"})
+	whiteBrain.expect("error", CodeWrongPiece)
+
+	whiteBrain.send(Message{Type: "name_piece", Piece: "n"})
+	if got := whiteHand.expect("name_piece"); got.Piece != "n" || got.Color != "white" {
+		t.Fatalf("got %+v", got)
+	}
+	whiteHand.send(move("3", "e2", "e4"))
+	whiteHand.expect("error", CodeWrongPiece)
+	whiteHand.send(move("4", "g1", "f3"))
+	for _, player := range []*testPlayer{blackHand, whiteBrain, blackBrain} {
+		if got := player.expect("move"); got.From != "g1" || got.To != "f3" {
+			t.Errorf("got %+v", got)
+		}
+	}
+
+	blackHand.send(Message{Type: "resign"})
+	for _, player := range players {
+		if got := player.expect("game_over"); got.Result != "1-0" {
+			t.Errorf("got %+v", got)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+var (
+	errHandedOff     = errors.New("game handed off")
+	errCannotHandOff = errors.New("only games being played on their own are handed off")
+	errNoInstance    = errors.New("no other instance to hand the game off to")
+)
+
+// handoffFeed tells the spectators of a game the instance it is handed
+// off to, keyed by its ID
+var handoffFeed = newEventFeeds[string]()
+
+// handoffTarget is the instance the game id goes to once this one leaves,
+// the one it hashes to on the ring of the others
+func handoffTarget(id string) (string, error) {
+	var others []string
+	for _, member := range currentRing().members {
+		if member != instanceURL {
+			others = append(others, member)
+		}
+	}
+	if instanceURL == "" || len(others) == 0 {
+		return "", errNoInstance
+	}
+	return newHashRing(others).owner(id), nil
+}
+
+// HandOff moves the game to the instance to while it is being played: it
+// is snapshot for to to adopt, then its players and spectators are sent
+// there to resume it. The games of simuls and matches are left alone,
+// they are played along with others
+func (game *ChessGame) HandOff(to string) error {
+	if game.simul != nil || game.match != nil || game.series != nil || !game.hasJoined() {
+		return errCannotHandOff
+	}
+	snapshot, err := json.Marshal(gameSnapshot{Tokens: game.seatTokens(), State: game.recorder.State()})
+	if err != nil {
+		return err
+	}
+	// what is recorded from now on is replayed by to on top of the snapshot
+	if err := registry.HandOff(game.id, to, snapshot); err != nil {
+		return err
+	}
+	game.handoff = to
+	game.cancel(errHandedOff)
+	<-game.done
+	return nil
+}
+
+// redirect ends the game loop of a game handed off, sending everyone in
+// it to the instance it went to
+func (game *ChessGame) redirect() {
+	to := game.handoff
+	for seat, box := range game.outboxes() {
+		if box.conn != nil {
+			query := url.Values{"game": {game.id}, "token": {game.tokens[seat]}}
+			redirectTo(box.conn, game.id, remoteLocation(to, "/ws", query.Encode(), true))
+		}
+	}
+	crowd := url.Values{"crowd": {game.id}}
+	game.variant.hangUp(func(conn *connection) {
+		redirectTo(conn, game.id, remoteLocation(to, "/ws", crowd.Encode(), true))
+	})
+	handoffFeed.publish(game.id, to)
+}
+
+func redirectTo(conn *connection, id, location string) {
+	conn.Write(Message{Type: "redirect", GameID: id, URL: location})
+	conn.Close("")
+}
+
+// handOffGames hands off every game being played to the instances they go
+// to, returning how many were
+func handOffGames() int {
+	handed := 0
+	for _, game := range games.List() {
+		to, err := handoffTarget(game.id)
+		if err == nil {
+			err = game.HandOff(to)
+		}
+		if err != nil {
+			if !errors.Is(err, errCannotHandOff) {
+				log.Printf("cannot hand off game %s: %v", game.id, err)
+			}
+			continue
+		}
+		handed++
+	}
+	return handed
+}
+
+// adopting serializes adoptGame, for a game to be restored only once
+var adopting sync.Mutex
+
+// findGame is the game id being played here, adopting it if it was handed
+// off to this instance
+func findGame(id string) (*ChessGame, bool) {
+	if game, ok := games.Find(id); ok || instanceURL == "" {
+		return game, ok
+	}
+	return adoptGame(id)
+}
+
+func adoptGame(id string) (*ChessGame, bool) {
+	adopting.Lock()
+	defer adopting.Unlock()
+	if game, ok := games.Find(id); ok {
+		return game, true
+	}
+	data, err := registry.Adopt(id, instanceURL)
+	if err != nil {
+		log.Printf("cannot adopt game %s: %v", id, err)
+	}
+	if data == nil {
+		return nil, false
+	}
+	snapshot := gameSnapshot{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		log.Printf("cannot adopt game %s: %v", id, err)
+		return nil, false
+	}
+	state := catchUp(snapshot.State)
+	if state.Finished {
+		return nil, false
+	}
+	return restoreChessGame(snapshot.Tokens, state), true
+}
+
+// adoptHandedOff adopts the games handed off to this instance nobody came
+// to yet, for them to end if nobody does
+func adoptHandedOff(registry GameRegistry) {
+	handed, err := registry.HandedOff(instanceURL)
+	if err != nil {
+		log.Printf("cannot find the games handed off: %v", err)
+		return
+	}
+	for _, id := range handed {
+		adoptGame(id)
+	}
+}
+
+// handoffHandler hands the game off to the instance at ?to=, the one it
+// goes to once this one leaves by default
+func handoffHandler(w http.ResponseWriter, r *http.Request) {
+	game, ok := games.Find(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		var err error
+		if to, err = handoffTarget(game.id); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+	if err := game.HandOff(to); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errCannotHandOff) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
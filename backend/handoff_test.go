@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandOff(t *testing.T) {
+	defer func(u string, r GameRegistry) { instanceURL, registry = u, r }(instanceURL, registry)
+	defer ring.Store(ring.Load())
+	instanceURL, registry = "http://a.example.com", newMemoryRegistry()
+	ring.Store(newHashRing([]string{instanceURL, "http://b.example.com"}))
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/games/"+game.id+"/handoff", nil)
+	r.Header.Set("Authorization", "Bearer admin")
+	newAdminMux("admin").ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	want := "ws://b.example.com/ws?game=" + game.id + "&token=" + game.tokens["white"]
+	if got := white.expect("redirect"); got.URL != want {
+		t.Errorf("got %s, want %s", got.URL, want)
+	}
+	black.expect("redirect")
+	if _, ok := games.Find(game.id); ok {
+		t.Fatal("game still played here")
+	}
+	if owner, _ := registry.Owner(game.id); owner != "http://b.example.com" {
+		t.Errorf("owned by %q", owner)
+	}
+	// the instance it was handed off to goes on with it as the players come
+	if _, elsewhere := gameElsewhere(game.id); !elsewhere {
+		t.Error("game not sent to the instance it was handed off to")
+	}
+	instanceURL = "http://b.example.com"
+	adopted, ok := findGame(game.id)
+	if !ok {
+		t.Fatal("game not adopted")
+	}
+	if again, _ := findGame(game.id); again != adopted {
+		t.Error("game adopted twice")
+	}
+	white, black = newTestPlayer(t), newTestPlayer(t)
+	if err := adopted.Resume(context.Background(), white.conn, game.tokens["white"], -1); err != nil {
+		t.Fatal(err)
+	}
+	if got := white.expect("resume"); len(got.Moves) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	if err := adopted.Resume(context.Background(), black.conn, game.tokens["black"], -1); err != nil {
+		t.Fatal(err)
+	}
+	black.expect("resume")
+	black.send(move("2", "e7", "e5"))
+	if got := white.expect("move"); got.From != "e7" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestHandOffNeedsAnotherInstance(t *testing.T) {
+	defer func(u string) { instanceURL = u }(instanceURL)
+	defer ring.Store(ring.Load())
+	instanceURL = "http://a.example.com"
+	ring.Store(newHashRing([]string{instanceURL}))
+	game, _, _ := startTestGame(t)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/games/"+game.id+"/handoff", nil)
+	r.Header.Set("Authorization", "Bearer admin")
+	newAdminMux("admin").ServeHTTP(w, r)
+	if w.Code != http.StatusConflict {
+		t.Errorf("got %d", w.Code)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrAuthTimeout  = errors.New("authentication timed out")
+	ErrAuthRequired = errors.New("authentication required")
+)
+
+// authTimeout is how long a connection asking for ?handshake=true has to
+// send its auth message; requireAccounts refuses those without an account
+var (
+	authTimeout     = 10 * time.Second
+	requireAccounts bool
+)
+
+// readAuth waits for the auth message conn is to start with, answering the
+// token it authenticates with, empty for those coming as guests. Any other
+// message is refused, as is waiting longer than authTimeout; the errors of
+// the transport are answered as they are, the client being gone
+func readAuth(conn *connection) (string, error) {
+	type read struct {
+		message Message
+		err     error
+	}
+	first := make(chan read, 1)
+	go func() {
+		message, err := conn.Read()
+		first <- read{message, err}
+	}()
+	select {
+	case <-time.After(authTimeout):
+		return "", ErrAuthTimeout
+	case r := <-first:
+		if r.err != nil && !errors.Is(r.err, ErrInvalidPayload) {
+			return "", r.err
+		}
+		if r.err != nil || r.message.Type != "auth" {
+			return "", ErrAuthRequired
+		}
+		return r.message.Token, nil
+	}
+}
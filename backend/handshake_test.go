@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthHandshake(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana := newPlayer("ana")
+	startSession(&ana, "phone")
+	players.Create(ana)
+	defer func(timeout time.Duration, required bool) {
+		authTimeout, requireAccounts = timeout, required
+	}(authTimeout, requireAccounts)
+
+	connect := func() *testPlayer {
+		t.Helper()
+		transport := newMemTransport()
+		player := &testPlayer{t: t, transport: transport}
+		t.Cleanup(player.disconnect)
+		_, span := tracer.Start(context.Background(), "test")
+		go admit(context.Background(), span, httptest.NewRequest("GET", "/ws?handshake=true&lobby=true", nil), transport)
+		return player
+	}
+
+	player := connect()
+	player.send(Message{Type: "auth", Token: ana.Token})
+	if got := player.expect("auth"); got.Role != "player" {
+		t.Fatalf("got %+v", got)
+	}
+	player.expect("lobby")
+	waitFor(t, func() bool { return isOnline(ana.ID) })
+
+	guest := connect()
+	guest.send(Message{Type: "auth"})
+	if got := guest.expect("auth"); got.Role != "guest" {
+		t.Fatalf("got %+v", got)
+	}
+	guest.expect("lobby")
+
+	impostor := connect()
+	impostor.send(Message{Type: "auth", Token: "nobody.secret"})
+	impostor.expect("error", CodeInvalidPlayerToken)
+
+	eager := connect()
+	eager.send(Message{Type: "resign"})
+	eager.expect("error", CodeAuthRequired)
+
+	authTimeout = 10 * time.Millisecond
+	connect().expect("error", CodeAuthTimeout)
+
+	authTimeout, requireAccounts = time.Second, true
+	guest = connect()
+	guest.send(Message{Type: "auth"})
+	guest.expect("error", CodeAuthRequired)
+}
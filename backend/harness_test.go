@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memTransport connects a game to a test player in memory,
+// frames are buffered so neither side blocks the other
+type memTransport struct {
+	toServer chan []byte
+	toClient chan []byte
+	done     chan struct{}
+	once     sync.Once
+	// reason is what the connection was closed with
+	reason chan string
+}
+
+func newMemTransport() *memTransport {
+	return &memTransport{
+		toServer: make(chan []byte, 64),
+		toClient: make(chan []byte, 64),
+		done:     make(chan struct{}),
+		reason:   make(chan string, 1),
+	}
+}
+
+func (t *memTransport) WriteFrame(frameType int, data []byte) error {
+	select {
+	case <-t.done:
+		return errTransportClosed
+	default:
+	}
+	select {
+	case t.toClient <- bytes.Clone(data):
+		return nil
+	case <-t.done:
+		return errTransportClosed
+	}
+}
+
+func (t *memTransport) ReadFrame() ([]byte, error) {
+	select {
+	case data := <-t.toServer:
+		return data, nil
+	case <-t.done:
+		return nil, errTransportClosed
+	}
+}
+
+func (t *memTransport) Close(reason string) error {
+	t.once.Do(func() {
+		t.reason <- reason
+		close(t.done)
+	})
+	return nil
+}
+
+func (t *memTransport) SupportsBinary() bool {
+	return true
+}
+
+// testPlayer is the client end of a memTransport
+type testPlayer struct {
+	t         testing.TB
+	transport *memTransport
+	conn      *connection
+}
+
+func newTestPlayer(t testing.TB) *testPlayer {
+	transport := newMemTransport()
+	player := &testPlayer{
+		t:         t,
+		transport: transport,
+		conn:      newConnection(transport, protocolVersion, jsonCodec{}, defaultLanguage),
+	}
+	// ending every connection lets the game loops of finished tests return
+	t.Cleanup(player.disconnect)
+	return player
+}
+
+func (player *testPlayer) send(message Message) {
+	player.t.Helper()
+	data, err := json.Marshal(message)
+	if err != nil {
+		player.t.Fatal(err)
+	}
+	player.transport.toServer <- data
+}
+
+// receive waits for the next message sent to the player
+func (player *testPlayer) receive() Message {
+	player.t.Helper()
+	select {
+	case data := <-player.transport.toClient:
+		message := Message{}
+		if err := json.Unmarshal(data, &message); err != nil {
+			player.t.Fatal(err)
+		}
+		return message
+	case <-time.After(time.Second):
+		player.t.Fatal("no message received")
+	}
+	return Message{}
+}
+
+// expect receives the next message and checks its type, and code for errors
+func (player *testPlayer) expect(messageType string, code ...string) Message {
+	player.t.Helper()
+	message := player.receive()
+	if message.Type != messageType {
+		player.t.Fatalf("got %s message %+v, want %s", message.Type, message, messageType)
+	}
+	if len(code) > 0 && message.Code != code[0] {
+		player.t.Fatalf("got error %s, want %s", message.Code, code[0])
+	}
+	return message
+}
+
+// disconnect drops the connection as a client going away would
+func (player *testPlayer) disconnect() {
+	player.transport.Close("")
+}
+
+// startTestGame pairs two test players in a game, recorded in the default
+// in-memory store, it returns once both have been sent the start message
+func startTestGame(t testing.TB) (game *ChessGame, white, black *testPlayer) {
+	t.Helper()
+	white, black = newTestPlayer(t), newTestPlayer(t)
+	if err := games.Pair(context.Background(), white.conn); err != nil {
+		t.Fatal(err)
+	}
+	games.mu.Lock()
+	game = games.seeks[len(games.seeks)-1]
+	games.mu.Unlock()
+	if err := games.Pair(context.Background(), black.conn); err != nil {
+		t.Fatal(err)
+	}
+	white.expect("start")
+	black.expect("start")
+	return game, white, black
+}
+
+// waitFor polls cond until it holds, for state the game loop changes
+// without telling the players
+func waitFor(t testing.TB, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func move(id, from, to string) Message {
+	return Message{Type: "move", MoveID: id, From: from, To: to}
+}
+
+// closed reports whether the server closed the connection of the player
+func (player *testPlayer) closed() bool {
+	select {
+	case <-player.transport.done:
+		return true
+	default:
+		return false
+	}
+}
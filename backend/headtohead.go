@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// headToHead is the record of a player against an opponent, as they see it
+type headToHead struct {
+	Player   string       `json:"player"`
+	Opponent string       `json:"opponent"`
+	Count    gameCount    `json:"count"`
+	Recent   []PlayerGame `json:"recent"`
+}
+
+func newHeadToHead(player Player, opponent string) headToHead {
+	var against []PlayerGame
+	for _, game := range player.Games {
+		if game.Opponent == opponent {
+			against = append(against, game)
+		}
+	}
+	return headToHead{Player: player.ID, Opponent: opponent, Count: countGames(against), Recent: recent(against)}
+}
+
+// countGames counts games by their result
+func countGames(games []PlayerGame) gameCount {
+	var count gameCount
+	for _, game := range games {
+		count.All++
+		switch game.Result {
+		case "win":
+			count.Wins++
+		case "draw":
+			count.Draws++
+		case "loss":
+			count.Losses++
+		}
+	}
+	return count
+}
+
+// recent is the last recentGames of games, the latest first
+func recent(games []PlayerGame) []PlayerGame {
+	list := []PlayerGame{}
+	for i := len(games) - 1; i >= 0 && len(list) < recentGames; i-- {
+		list = append(list, games[i])
+	}
+	return list
+}
+
+// startRecord is the record of the player at color of state against their
+// opponent, told as the game starts if they met before
+func startRecord(state GameState, color string) *gameCount {
+	id, opponentID := state.Players[color], state.Players[opponent(color)]
+	if id == "" || opponentID == "" || id == opponentID {
+		return nil
+	}
+	player, err := players.Load(id)
+	if err != nil {
+		return nil
+	}
+	count := newHeadToHead(player, opponentID).Count
+	if count.All == 0 {
+		return nil
+	}
+	return &count
+}
+
+// headToHeadHandler serves the record of a player against another
+func headToHeadHandler(w http.ResponseWriter, r *http.Request) {
+	player, err := players.Load(r.PathValue("id"))
+	if err == nil {
+		_, err = players.Load(r.PathValue("opponent"))
+	}
+	if errors.Is(err, ErrPlayerNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, newHeadToHead(player, r.PathValue("opponent")))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeadToHead(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana, bo := newPlayer("ana"), newPlayer("bo")
+	players.Create(ana)
+	players.Create(bo)
+
+	// play pairs ana as white with bo, and the loser resigns
+	play := func(loser string) (Message, Message) {
+		white, black := newTestPlayer(t), newTestPlayer(t)
+		goOnline(white.conn, ana.ID)
+		goOnline(black.conn, bo.ID)
+		for _, player := range []*testPlayer{white, black} {
+			if err := games.Pair(context.Background(), player.conn); err != nil {
+				t.Fatal(err)
+			}
+		}
+		whiteStart, blackStart := white.expect("start"), black.expect("start")
+		map[string]*testPlayer{"white": white, "black": black}[loser].send(Message{Type: "resign"})
+		black.expect("game_over")
+		white.expect("game_over")
+		return whiteStart, blackStart
+	}
+	if start, _ := play("white"); start.HeadToHead != nil {
+		t.Errorf("got %+v before they met", start.HeadToHead)
+	}
+	waitFor(t, func() bool {
+		player, _ := players.Load(ana.ID)
+		return len(player.Games) == 1
+	})
+	whiteStart, blackStart := play("black")
+	if got := whiteStart.HeadToHead; got == nil || *got != (gameCount{All: 1, Losses: 1}) {
+		t.Errorf("ana got %+v", got)
+	}
+	if got := blackStart.HeadToHead; got == nil || *got != (gameCount{All: 1, Wins: 1}) {
+		t.Errorf("bo got %+v", got)
+	}
+	waitFor(t, func() bool {
+		player, _ := players.Load(ana.ID)
+		return len(player.Games) == 2
+	})
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/"+bo.ID+"/versus/"+ana.ID, nil))
+	record := headToHead{}
+	json.Unmarshal(w.Body.Bytes(), &record)
+	if w.Code != http.StatusOK || record.Count != (gameCount{All: 2, Wins: 1, Losses: 1}) || len(record.Recent) != 2 || record.Recent[0].Result != "loss" {
+		t.Errorf("got %d %+v", w.Code, record)
+	}
+	w = httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/"+bo.ID+"/versus/nobody", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got %d against nobody", w.Code)
+	}
+}
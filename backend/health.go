@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// healthzHandler answers as long as the process serves requests at all
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler tells whether the server should be sent new clients,
+// naming what keeps it from being ready otherwise
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if err := ready(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func ready() error {
+	if games.ctx.Err() != nil {
+		return ErrShuttingDown
+	}
+	if draining.Load() {
+		return ErrDraining
+	}
+	if checker, ok := store.(interface{ Check() error }); ok {
+		if err := checker.Check(); err != nil {
+			return fmt.Errorf("event store: %w", err)
+		}
+	}
+	return nil
+}
+
+// Check reports whether the directory of the store can still be written to
+func (s *fileStore) Check() error {
+	f, err := os.CreateTemp(s.dir, ".check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyzFailsWhileDraining(t *testing.T) {
+	check := func(want int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		readyzHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != want {
+			t.Fatalf("got %d, want %d", w.Code, want)
+		}
+	}
+	check(http.StatusOK)
+	draining.Store(true)
+	defer draining.Store(false)
+	check(http.StatusServiceUnavailable)
+}
+
+func TestFileStoreCheck(t *testing.T) {
+	s, err := newFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Check(); err != nil {
+		t.Fatal(err)
+	}
+	s.dir += "/missing"
+	if err := s.Check(); err == nil {
+		t.Fatal("missing directory passed the check")
+	}
+}
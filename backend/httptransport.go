@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxPostedMessageSize bounds the body of a message posted to an HTTP session
+const maxPostedMessageSize = 64 << 10
+
+// httpTransport backs the fallbacks for clients that cannot open a WebSocket:
+// frames to the client are queued until they are streamed or polled,
+// and the client posts its messages to /{sse,poll}/{session}
+type httpTransport struct {
+	id      string
+	frames  chan []byte
+	inbound chan []byte
+	done    chan struct{}
+	// polling sessions expire once not polled for pollIdleTimeout
+	polling  bool
+	once     sync.Once
+	reason   string
+	reasonMu sync.Mutex
+}
+
+func newHTTPTransport(polling bool) *httpTransport {
+	t := &httpTransport{
+		id:      newToken(),
+		frames:  make(chan []byte, 64),
+		inbound: make(chan []byte),
+		done:    make(chan struct{}),
+		polling: polling,
+	}
+	// streams are closed as the client goes away, polls as it stops polling
+	var ttl time.Duration
+	if polling {
+		ttl = pollIdleTimeout
+	}
+	httpSessions.Put(t.id, t, ttl)
+	return t
+}
+
+func (t *httpTransport) WriteFrame(frameType int, data []byte) error {
+	select {
+	case t.frames <- bytes.Clone(data):
+		return nil
+	case <-t.done:
+		return errTransportClosed
+	}
+}
+
+func (t *httpTransport) ReadFrame() ([]byte, error) {
+	select {
+	case data := <-t.inbound:
+		return data, nil
+	case <-t.done:
+		return nil, errTransportClosed
+	}
+}
+
+func (t *httpTransport) Close(reason string) error {
+	t.once.Do(func() {
+		t.reasonMu.Lock()
+		t.reason = reason
+		t.reasonMu.Unlock()
+		close(t.done)
+	})
+	return nil
+}
+
+func (t *httpTransport) SupportsBinary() bool {
+	return false
+}
+
+func (t *httpTransport) closeReason() string {
+	t.reasonMu.Lock()
+	defer t.reasonMu.Unlock()
+	return t.reason
+}
+
+// pending takes the frames queued so far without waiting for more
+func (t *httpTransport) pending() [][]byte {
+	var frames [][]byte
+	for {
+		select {
+		case data := <-t.frames:
+			frames = append(frames, data)
+		default:
+			return frames
+		}
+	}
+}
+
+// httpSessions are the sessions of the clients on HTTP fallbacks, those
+// expired are closed and their players disconnected
+var httpSessions = newTTLStore(func(_ string, t *httpTransport) { t.Close("") })
+
+func findHTTPSession(id string) (*httpTransport, bool) {
+	return httpSessions.Get(id)
+}
+
+func removeHTTPSession(t *httpTransport) {
+	httpSessions.Delete(t.id)
+}
+
+func postMessageHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := findHTTPSession(r.PathValue("session"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPostedMessageSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	select {
+	case t.inbound <- data:
+		w.WriteHeader(http.StatusAccepted)
+	case <-t.done:
+		http.NotFound(w, r)
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+// catalogs hold the text of every message key, as fmt formats of its args
+var catalogs = map[string]map[string]string{
+	"en": {
+		"error.invalid_payload":       "The message could not be decoded.",
+		"error.invalid_message":       "The field %[1]q is not valid, it failed the %[2]q check.",
+		"error.not_your_turn":         "It is not your turn.",
+		"error.game_not_found":        "There is no game %[1]s to resume.",
+		"error.invalid_resume_token":  "The resume token is not valid for this game.",
+		"error.already_connected":     "You are already connected to this game.",
+		"error.taken_over":            "You resumed this game on another connection.",
+		"error.unsupported_version":   "Protocol version %[1]q is not supported, use one of %[2]s.",
+		"error.unsupported_encoding":  "Encoding %[1]q is not supported, use json or protobuf.",
+		"error.banned":                "You are banned from this server.",
+		"error.server_draining":       "The server is not starting new games, try again later.",
+		"error.kicked":                "You were disconnected by an administrator.",
+		"error.server_shutting_down":  "The server is restarting, resume your game once it is back.",
+		"error.server_full":           "The server is full right now, try again in a few minutes.",
+		"error.invalid_draw_claim":    "A draw cannot be claimed in this position.",
+		"error.game_paused":           "The game is paused until both players are back.",
+		"error.simul_not_found":       "There is no simul %[1]s.",
+		"error.simul_full":            "Every board of the simul is taken.",
+		"error.invalid_simul_size":    "A simul has from 1 to %[2]s boards, not %[1]q.",
+		"error.host_at_another_board": "You are at another board of the simul, play the boards in turn.",
+		"error.illegal_move":          "That move is not legal in this position.",
+		"error.wrong_role":            "Only the brain names pieces, and only the hand moves them.",
+		"error.piece_not_named":       "Wait for your brain to name the piece to move.",
+		"error.wrong_piece":           "That piece cannot be played now.",
+		"error.unknown_level":         "There is no such engine level, pick beginner, casual, intermediate, advanced or master.",
+		"error.board_not_found":       "There is no analysis board %[1]s.",
+		"error.read_only_board":       "Only those the owner lets can change this board.",
+		"error.board_conflict":        "The board changed meanwhile, here is how it is now.",
+		"error.board_full":            "A board can hold %[1]s moves at most.",
+		"error.study_not_found":       "There is no such chapter of the study %[1]s.",
+		"error.invalid_player_token":  "The player token is not valid.",
+		"error.invalid_rating_band":   "The rating band %[1]q is not valid, use min-max as in 1400-1800.",
+		"error.match_not_found":       "There is no match %[1]s.",
+		"error.match_full":            "The match has both its players already.",
+		"error.match_over":            "The match is over.",
+		"error.invalid_match_size":    "A match has from 1 to %[2]s games, not %[1]q.",
+		"error.bracket_not_found":     "There is no bracket %[1]s.",
+		"error.missing_scope":         "The access token cannot be used to %[1]s.",
+		"error.offer_too_soon":        "Wait %[1]s more moves before offering again.",
+		"error.offers_refused":        "Your opponent refuses any further offer.",
+		"error.invalid_takebacks":     "The takeback policy %[1]q is not valid, use none, once or unlimited.",
+		"error.takebacks_disabled":    "No more takebacks are allowed in this game.",
+		"error.invalid_game_options":  "The game option %[1]s is not valid, or does not go with the others.",
+		"error.draw_offers_disabled":  "Draws cannot be agreed in this game.",
+		"error.nothing_to_take_back":  "You have no move to take back.",
+		"error.game_not_over":         "The game %[1]s is still being played, watch it instead.",
+		"error.coaching_rated":        "Rated games are played without a coach.",
+		"error.coach_dismissed":       "The player you coach let you go.",
+		"error.challenge_failed":      "Solve the challenge of GET /challenge to play without an account, or sign in.",
+		"error.auth_timeout":          "Authenticate with the first message, it did not come in time.",
+		"error.auth_required":         "Sign in to connect: start with an auth message carrying your token.",
+		"error.idle":                  "You were disconnected for being idle, reconnect to go on.",
+		"error.too_many_games":        "You already play the most games at once you may, %[1]s; finish one first.",
+		"error.too_many_seeks":        "You already seek the most games at once you may, %[1]s; wait for an opponent there.",
+		"error.seek_expired":          "Nobody took your seek in time, seek again to go on waiting.",
+		"error.not_seeking":           "The game is not a seek waiting for an opponent anymore.",
+		"error.illegal_position":      "The position cannot come up in a game (%[1]s).",
+		"quick.good_luck":             "Good luck!",
+		"quick.good_game":             "Good game!",
+		"quick.nice_move":             "Nice move!",
+		"quick.well_played":           "Well played!",
+		"quick.thanks":                "Thanks!",
+		"quick.oops":                  "Oops!",
+		"quick.smile":                 "🙂",
+		"quick.thumbs_up":             "👍",
+		"quick.surprised":             "😮",
+		"quick.thinking":              "🤔",
+	},
+	"es": {
+		"error.invalid_payload":       "No se ha podido descodificar el mensaje.",
+		"error.invalid_message":       "El campo %[1]q no es válido, no ha pasado la comprobación %[2]q.",
+		"error.not_your_turn":         "No es tu turno.",
+		"error.game_not_found":        "No hay ninguna partida %[1]s que reanudar.",
+		"error.invalid_resume_token":  "El token de reanudación no es válido para esta partida.",
+		"error.already_connected":     "Ya estás conectado a esta partida.",
+		"error.taken_over":            "Has reanudado esta partida en otra conexión.",
+		"error.unsupported_version":   "La versión %[1]q del protocolo no está soportada, usa una de %[2]s.",
+		"error.unsupported_encoding":  "La codificación %[1]q no está soportada, usa json o protobuf.",
+		"error.banned":                "Tienes prohibido el acceso a este servidor.",
+		"error.server_draining":       "El servidor no está empezando partidas nuevas, inténtalo más tarde.",
+		"error.kicked":                "Un administrador te ha desconectado.",
+		"error.server_shutting_down":  "El servidor se está reiniciando, reanuda tu partida cuando vuelva.",
+		"error.server_full":           "El servidor está lleno ahora mismo, inténtalo dentro de unos minutos.",
+		"error.invalid_draw_claim":    "No se pueden reclamar tablas en esta posición.",
+		"error.game_paused":           "La partida está en pausa hasta que vuelvan los dos jugadores.",
+		"error.simul_not_found":       "No hay ninguna simultánea %[1]s.",
+		"error.simul_full":            "Todos los tableros de la simultánea están ocupados.",
+		"error.invalid_simul_size":    "Una simultánea tiene de 1 a %[2]s tableros, no %[1]q.",
+		"error.host_at_another_board": "Estás en otro tablero de la simultánea, juega los tableros por turno.",
+		"error.illegal_move":          "Esa jugada no es legal en esta posición.",
+		"error.wrong_role":            "Solo el cerebro nombra piezas, y solo la mano las mueve.",
+		"error.piece_not_named":       "Espera a que tu cerebro nombre la pieza que mover.",
+		"error.wrong_piece":           "Esa pieza no se puede jugar ahora.",
+		"error.unknown_level":         "No existe ese nivel del motor, elige beginner, casual, intermediate, advanced o master.",
+		"error.board_not_found":       "No hay ningún tablero de análisis %[1]s.",
+		"error.read_only_board":       "Solo pueden cambiar este tablero aquellos a los que deje el propietario.",
+		"error.board_conflict":        "El tablero ha cambiado mientras tanto, así es como está ahora.",
+		"error.board_full":            "Un tablero puede tener %[1]s jugadas como mucho.",
+		"error.study_not_found":       "No existe ese capítulo del estudio %[1]s.",
+		"error.invalid_player_token":  "El token del jugador no es válido.",
+		"error.invalid_rating_band":   "La horquilla de puntuación %[1]q no es válida, usa mín-máx como en 1400-1800.",
+		"error.match_not_found":       "No hay ningún match %[1]s.",
+		"error.match_full":            "El match ya tiene sus dos jugadores.",
+		"error.match_over":            "El match ha terminado.",
+		"error.invalid_match_size":    "Un match tiene de 1 a %[2]s partidas, no %[1]q.",
+		"error.bracket_not_found":     "No hay ningún cuadro %[1]s.",
+		"error.missing_scope":         "El token de acceso no se puede usar para %[1]s.",
+		"error.offer_too_soon":        "Espera %[1]s jugadas más antes de volver a ofrecer.",
+		"error.offers_refused":        "Tu rival rechaza cualquier otra oferta.",
+		"error.invalid_takebacks":     "La política de devolución de jugadas %[1]q no es válida, usa none, once o unlimited.",
+		"error.takebacks_disabled":    "No se permiten más devoluciones de jugadas en esta partida.",
+		"error.invalid_game_options":  "La opción de partida %[1]s no es válida, o no casa con las demás.",
+		"error.draw_offers_disabled":  "En esta partida no se pueden acordar tablas.",
+		"error.nothing_to_take_back":  "No tienes ninguna jugada que devolver.",
+		"error.game_not_over":         "La partida %[1]s aún se está jugando, mírala en directo.",
+		"error.coaching_rated":        "Las partidas puntuadas se juegan sin entrenador.",
+		"error.coach_dismissed":       "El jugador al que entrenas ha prescindido de ti.",
+		"error.challenge_failed":      "Resuelve el reto de GET /challenge para jugar sin cuenta, o inicia sesión.",
+		"error.auth_timeout":          "Autentícate con el primer mensaje, no ha llegado a tiempo.",
+		"error.auth_required":         "Inicia sesión para conectarte: empieza con un mensaje auth con tu token.",
+		"error.idle":                  "Te hemos desconectado por inactividad, vuelve a conectarte para seguir.",
+		"error.too_many_games":        "Ya juegas todas las partidas a la vez que puedes, %[1]s; termina una antes.",
+		"error.too_many_seeks":        "Ya buscas todas las partidas a la vez que puedes, %[1]s; espera allí a un rival.",
+		"error.seek_expired":          "Nadie ha aceptado tu búsqueda a tiempo, vuelve a buscar para seguir esperando.",
+		"error.not_seeking":           "La partida ya no es una búsqueda que espera rival.",
+		"error.illegal_position":      "La posición no puede darse en una partida (%[1]s).",
+		"quick.good_luck":             "¡Suerte!",
+		"quick.good_game":             "¡Buena partida!",
+		"quick.nice_move":             "¡Buena jugada!",
+		"quick.well_played":           "¡Bien jugado!",
+		"quick.thanks":                "¡Gracias!",
+		"quick.oops":                  "¡Ups!",
+		"quick.smile":                 "🙂",
+		"quick.thumbs_up":             "👍",
+		"quick.surprised":             "😮",
+		"quick.thinking":              "🤔",
+	},
+}
+
+const defaultLanguage = "en"
+
+var languageMatcher = language.NewMatcher([]language.Tag{language.English, language.Spanish})
+
+// negotiateLanguage picks the catalog that best fits the client preferences,
+// each one a language tag or a whole Accept-Language header
+func negotiateLanguage(preferences ...string) string {
+	tag, _ := language.MatchStrings(languageMatcher, preferences...)
+	base, _ := tag.Base()
+	if _, ok := catalogs[base.String()]; !ok {
+		return defaultLanguage
+	}
+	return base.String()
+}
+
+func localize(lang, key string, args []string) string {
+	format, ok := catalogs[lang][key]
+	if !ok {
+		format, ok = catalogs[defaultLanguage][key]
+	}
+	if !ok {
+		return key
+	}
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return fmt.Sprintf(format, values...)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// maxImportedGameSize bounds a game of an archive, its tags, moves and
+// comments
+const maxImportedGameSize = 1 << 20
+
+// importReport is how the import of a game of an archive went, Game its
+// number there from 1. Status is imported, exists if an earlier import of
+// the archive stored it, invalid if it breaks the rules and failed if the
+// storage did, Error telling how
+type importReport struct {
+	Game   int    `json:"game"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// splitPGN reads the games of an archive one after another, a game ending
+// where the tags of the next start once it had moves
+func splitPGN(r io.Reader, game func(text string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxImportedGameSize)
+	var text strings.Builder
+	moves := false
+	flush := func() error {
+		defer func() { text.Reset(); moves = false }()
+		if strings.TrimSpace(text.String()) == "" {
+			return nil
+		}
+		return game(text.String())
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && moves {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if trimmed != "" && !strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, "%") {
+			moves = true
+		}
+		text.WriteString(line)
+		text.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// importedGameID names a game by its text, for importing an archive again
+// to leave the games already there as they are
+func importedGameID(text string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(text)))
+	return "pgn-" + hex.EncodeToString(sum[:8])
+}
+
+// importedEvents are the events of the game of an archive written in text,
+// if it is one of standard chess, played by the rules from a legal position
+func importedEvents(text string) ([]Event, error) {
+	game, err := chess.ParsePGN(text)
+	if err != nil {
+		return nil, err
+	}
+	if variant := game.Tag("Variant"); variant != "" && !strings.EqualFold(variant, "standard") {
+		return nil, fmt.Errorf("variant %s is not standard chess", variant)
+	}
+	position, err := game.Start()
+	if err != nil {
+		return nil, err
+	}
+	if err := position.Validate(); err != nil {
+		return nil, err
+	}
+	id := importedGameID(text)
+	played := time.Now().UTC().Truncate(time.Second)
+	if date, err := time.Parse("2006.01.02", game.Tag("Date")); err == nil {
+		played = date
+	}
+	events := []Event{{Type: GameCreated, FEN: game.Tag("FEN")}}
+	for _, m := range game.Moves {
+		move := Move{From: m.Move.From.String(), To: m.Move.To.String(), Promotion: m.Move.Promotion.String()}
+		events = append(events, Event{Type: MoveMade, Color: position.Turn().String(), Move: &move})
+		position = position.Apply(m.Move)
+	}
+	result := game.Result
+	if result == "*" {
+		result = ""
+	}
+	names := map[string]string{}
+	for color, tag := range map[string]string{"white": "White", "black": "Black"} {
+		if name := game.Tag(tag); name != "" && name != "?" {
+			names[color] = name
+		}
+	}
+	events = append(events, Event{Type: GameImported, Result: result, Names: names})
+	for i := range events {
+		events[i].GameID, events[i].Seq, events[i].Time = id, i+1, played
+	}
+	return events, nil
+}
+
+// importGame stores the game of an archive written in text, what an earlier
+// import left of it made whole
+func importGame(ctx context.Context, game int, text string) importReport {
+	events, err := importedEvents(text)
+	if err != nil {
+		return importReport{Game: game, Status: "invalid", Error: err.Error()}
+	}
+	report := importReport{Game: game, ID: events[0].GameID, Status: "imported"}
+	stored, err := store.Load(report.ID)
+	if err != nil && !errors.Is(err, ErrGameNotFound) {
+		return importReport{Game: game, ID: report.ID, Status: "failed", Error: err.Error()}
+	}
+	if len(stored) == len(events) {
+		report.Status = "exists"
+		return report
+	}
+	for _, event := range events[len(stored):] {
+		if err := store.Append(ctx, event); err != nil {
+			return importReport{Game: game, ID: report.ID, Status: "failed", Error: err.Error()}
+		}
+	}
+	return report
+}
+
+// importGamesHandler imports the games of the PGN archive posted, checking
+// them with ?workers= at once, as many as there are CPUs by default. It
+// answers the importReport of every game in the order of the archive as
+// newline-delimited JSON, reading the archive as far ahead of the reports
+// as twice the workers
+func importGamesHandler(w http.ResponseWriter, r *http.Request) {
+	workers := runtime.GOMAXPROCS(0)
+	if value := r.URL.Query().Get("workers"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid workers", http.StatusBadRequest)
+			return
+		}
+		workers = n
+	}
+	// the reports are written while the archive is still being read
+	rc := http.NewResponseController(w)
+	rc.EnableFullDuplex()
+	ctx := r.Context()
+	type job struct {
+		game int
+		text string
+		done chan importReport
+	}
+	jobs := make(chan job)
+	// pending keeps the reports in order, and bounds the games read ahead
+	pending := make(chan chan importReport, 2*workers)
+	for range workers {
+		go func() {
+			for j := range jobs {
+				j.done <- importGame(ctx, j.game, j.text)
+			}
+		}()
+	}
+	split := make(chan error, 1)
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		game := 0
+		split <- splitPGN(r.Body, func(text string) error {
+			game++
+			done := make(chan importReport, 1)
+			select {
+			case pending <- done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			jobs <- job{game, text, done}
+			return nil
+		})
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	for done := range pending {
+		if err := encoder.Encode(<-done); err != nil {
+			return
+		}
+		rc.Flush()
+	}
+	if err := <-split; err != nil {
+		encoder.Encode(importReport{Status: "failed", Error: err.Error()})
+	}
+}
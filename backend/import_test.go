@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const importArchive = `[Event "Casual"]
+[Date "2024.03.01"]
+[White "Ana"]
+[Black "Bo"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+
+[Event "Broken"]
+[Result "*"]
+
+1. e4 e5 2. Ke3 *
+
+[Event "Set up"]
+[SetUp "1"]
+[FEN "4k3/P7/8/8/8/8/8/4K3 w - - 0 1"]
+[Result "*"]
+
+1. a8=Q+ *
+`
+
+func TestImportGames(t *testing.T) {
+	server := httptest.NewServer(newAdminMux("admin"))
+	defer server.Close()
+	post := func(archive string) []importReport {
+		t.Helper()
+		req, _ := http.NewRequest("POST", server.URL+"/imports?workers=2", strings.NewReader(archive))
+		req.Header.Set("Authorization", "Bearer admin")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var reports []importReport
+		for decoder := json.NewDecoder(resp.Body); decoder.More(); {
+			var report importReport
+			if err := decoder.Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			reports = append(reports, report)
+		}
+		return reports
+	}
+
+	reports := post(importArchive)
+	if len(reports) != 3 {
+		t.Fatalf("got %+v", reports)
+	}
+	for i, want := range []string{"imported", "invalid", "imported"} {
+		if reports[i].Game != i+1 || reports[i].Status != want {
+			t.Errorf("game %d: got %+v, want %s", i+1, reports[i], want)
+		}
+	}
+	events, err := store.Load(reports[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := Replay(events)
+	if !state.Finished || state.Result != "1-0" || len(state.Moves) != 7 || state.Names["white"] != "Ana" || state.CreatedAt.Year() != 2024 {
+		t.Fatalf("got %+v", state)
+	}
+	if doc := newGameDocument(state, events); doc.Reason != "imported" || doc.Players["black"].Name != "Bo" || doc.Moves[6].SAN != "Qxf7#" {
+		t.Fatalf("got %+v", doc)
+	}
+	if events, _ := store.Load(reports[2].ID); Replay(events).Moves[0].Promotion != "q" {
+		t.Fatalf("got %+v", events)
+	}
+
+	// importing again completes what an interrupted import left
+	events, _ = store.Load(reports[2].ID)
+	interrupted := newMemoryStore()
+	for _, event := range events[:1] {
+		interrupted.Append(context.Background(), event)
+	}
+	defer func(s EventStore) { store = s }(store)
+	store = interrupted
+	reports = post(importArchive)
+	if reports[0].Status != "imported" || reports[2].Status != "imported" {
+		t.Fatalf("got %+v", reports)
+	}
+	if got, _ := store.Load(reports[2].ID); len(got) != len(events) {
+		t.Fatalf("got %d events, want %d", len(got), len(events))
+	}
+	if reports = post(importArchive); reports[0].Status != "exists" || reports[2].Status != "exists" {
+		t.Fatalf("got %+v", reports)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import "time"
+
+// janitorEvery is how often the janitor sweeps the manager, and
+// finishedGrace how long simuls, matches and brackets stay in it once over, for
+// their players and spectators to see how they ended
+var (
+	janitorEvery  = time.Minute
+	finishedGrace = 10 * time.Minute
+)
+
+// janitorReport is what a sweep reclaimed: the games dropped from memory,
+// whose events are all in the store by then, the simuls, matches and
+// brackets removed and the connections still open that it closed
+type janitorReport struct {
+	Games       int
+	Simuls      int
+	Matches     int
+	Brackets    int
+	Connections int
+}
+
+// runJanitor sweeps the manager every janitorEvery until it shuts down
+func (m *gameManager) runJanitor() {
+	ticker := time.NewTicker(janitorEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			report := m.sweep(now)
+			janitorGames.Add(int64(report.Games))
+			janitorSimuls.Add(int64(report.Simuls))
+			janitorMatches.Add(int64(report.Matches))
+			janitorBrackets.Add(int64(report.Brackets))
+			janitorConnections.Add(int64(report.Connections))
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// sweep moves what is over at now out of the manager, leaving the games
+// to the archive of the store: games whose loops are done but are still
+// registered, and the simuls, matches and brackets over for finishedGrace
+func (m *gameManager) sweep(now time.Time) janitorReport {
+	var report janitorReport
+	// simuls and brackets take the lock of the manager holding theirs,
+	// they are swept without it
+	for _, s := range m.Simuls() {
+		if over, boards := s.sweep(now); over {
+			m.mu.Lock()
+			delete(m.simuls, s.id)
+			m.mu.Unlock()
+			report.Simuls++
+			report.Games += boards
+		}
+	}
+	for _, b := range m.Brackets() {
+		if over, played := b.sweep(now); over {
+			m.mu.Lock()
+			delete(m.brackets, b.id)
+			m.mu.Unlock()
+			report.Brackets++
+			report.Games += played
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, game := range m.active {
+		if isDone(game) {
+			delete(m.active, id)
+			m.unattended.Delete(id)
+			report.Games++
+			// the loop is done, nothing else touches the outboxes
+			for _, box := range game.outboxes() {
+				report.Connections += closeLingering(box.conn)
+			}
+		}
+	}
+	for id, s := range m.series {
+		if over, played, lingering := s.sweep(now); over {
+			delete(m.series, id)
+			report.Matches++
+			report.Games += played
+			report.Connections += closeLingering(lingering)
+		}
+	}
+	return report
+}
+
+// sweep reports whether s has been over for finishedGrace at now, every
+// board of it done, and how many boards it has
+func (s *simul) sweep(now time.Time) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, board := range s.boards {
+		if !isDone(board) {
+			s.over = time.Time{}
+			return false, 0
+		}
+	}
+	if s.over.IsZero() {
+		s.over = now
+	}
+	return now.Sub(s.over) >= finishedGrace, len(s.boards)
+}
+
+// sweep reports whether s has been over for finishedGrace at now, decided
+// or every game of it played, how many were, and the connection of a
+// player still waiting in it to close
+func (s *series) sweep(now time.Time) (bool, int, *connection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.games)
+	if n == 0 || !isDone(s.games[n-1]) || !s.score().Decided && n < s.size {
+		s.over = time.Time{}
+		return false, 0, nil
+	}
+	if s.over.IsZero() {
+		s.over = now
+	}
+	if now.Sub(s.over) < finishedGrace {
+		return false, 0, nil
+	}
+	waiting := s.waiting
+	s.waiting = nil
+	return true, n, waiting
+}
+
+// isDone reports whether the loop of game has returned
+func isDone(game *ChessGame) bool {
+	select {
+	case <-game.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeLingering closes conn unless it is nil or closed already,
+// reporting how many it closed
+func closeLingering(conn *connection) int {
+	if conn == nil {
+		return 0
+	}
+	select {
+	case <-conn.closed:
+		return 0
+	default:
+		conn.Close("")
+		return 1
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJanitorRemovesMatchesOver(t *testing.T) {
+	ctx := context.Background()
+	first, second := newTestPlayer(t), newTestPlayer(t)
+	joinMatch(ctx, first.conn, "new", "", "1")
+	created := first.expect("match")
+	joinMatch(ctx, second.conn, created.MatchID, "", "")
+	first.expect("match")
+	first.expect("start")
+	first.send(Message{Type: "resign"})
+	first.expect("game_over")
+	s, _ := games.FindMatch(created.MatchID)
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return isDone(s.games[0])
+	})
+
+	now := time.Now()
+	if report := games.sweep(now); report.Matches != 0 {
+		t.Fatalf("got %+v before the match was over for long", report)
+	}
+	if report := games.sweep(now.Add(finishedGrace)); report.Matches != 1 || report.Games != 1 {
+		t.Errorf("got %+v", report)
+	}
+	if _, ok := games.FindMatch(created.MatchID); ok {
+		t.Error("the match over is still there")
+	}
+}
+
+func TestJanitorRemovesSimulsOver(t *testing.T) {
+	host := newTestPlayer(t)
+	s, err := games.OpenSimul(context.Background(), host.conn, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host.expect("simul")
+	now := time.Now()
+	if report := games.sweep(now.Add(finishedGrace)); report.Simuls != 0 {
+		t.Fatalf("got %+v with a board open", report)
+	}
+	host.conn.Close("")
+	waitFor(t, func() bool { return isDone(s.boards[0]) })
+	games.sweep(now)
+	if report := games.sweep(now.Add(finishedGrace)); report.Simuls != 1 || report.Games != 1 {
+		t.Errorf("got %+v", report)
+	}
+	if _, ok := games.FindSimul(s.id); ok {
+		t.Error("the simul over is still there")
+	}
+}
+
+func TestJanitorClosesLingeringConnections(t *testing.T) {
+	game, white, _ := startTestGame(t)
+	white.send(Message{Type: "resign"})
+	white.expect("game_over")
+	<-game.done
+	// as if the game had been left registered, with a player attached
+	lingering := newTestPlayer(t)
+	game.white.Attach(lingering.conn)
+	games.Register(game)
+	if report := games.sweep(time.Now()); report.Games != 1 || report.Connections != 1 {
+		t.Errorf("got %+v", report)
+	}
+	if _, ok := games.Find(game.id); ok {
+		t.Error("the game over is still registered")
+	}
+	if closeLingering(lingering.conn) != 0 {
+		t.Error("the lingering connection is still open")
+	}
+}
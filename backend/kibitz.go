@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+)
+
+// kibitz hands the kibitz of the spectators of live games, as it is left,
+// to those watching them
+var kibitz = newEventFeeds[Comment]()
+
+var (
+	errKibitzOver     = errors.New("the game is over, comment on it instead")
+	errPlayerKibitzes = errors.New("the players of a game cannot kibitz on it")
+	errKibitzAccount  = errors.New("only spectators with an account kibitz")
+)
+
+// kibitzHandler leaves a comment posted as a commentRequest on a live game,
+// for its spectators only: the players of the game are not shown it for
+// nobody to help them, it joins the comments on the game once it is over.
+// It is answered with its token, which removes it as that of any comment.
+// Only spectators authenticated as an account kibitz, see seesKibitz
+func kibitzHandler(w http.ResponseWriter, r *http.Request) {
+	if isBanned(r) {
+		http.Error(w, ErrBanned.Error(), http.StatusForbidden)
+		return
+	}
+	state, _, ok := loadWatchedEvents(w, r)
+	if !ok {
+		return
+	}
+	if state.Finished {
+		http.Error(w, errKibitzOver.Error(), http.StatusConflict)
+		return
+	}
+	player, err := requestPlayer(r)
+	if err != nil && !errors.Is(err, ErrInvalidPlayerToken) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		http.Error(w, errKibitzAccount.Error(), http.StatusUnauthorized)
+		return
+	}
+	if playedBy(state, player.ID) {
+		http.Error(w, errPlayerKibitzes.Error(), http.StatusForbidden)
+		return
+	}
+	comment, ok := readComment(w, r, state.ID)
+	if !ok {
+		return
+	}
+	comment.Kibitz = true
+	if addComment(w, state.ID, &comment) {
+		// published with its poster, for each spectator to be shown it or not
+		published := comment
+		published.Token = ""
+		kibitz.publish(state.ID, published)
+		writeJSON(w, postedComment(comment))
+	}
+}
+
+// playsIn reports whether the account r is authenticated as plays the game
+// of state, as far as can be told: players without one are not known
+func playsIn(r *http.Request, state GameState) bool {
+	player, err := requestPlayer(r)
+	return err == nil && playedBy(state, player.ID)
+}
+
+// playedBy reports whether the account id plays the game of state
+func playedBy(state GameState, id string) bool {
+	for _, player := range state.Players {
+		if player == id {
+			return true
+		}
+	}
+	return false
+}
+
+// seesKibitz reports whether r is shown the kibitz of the game of state:
+// spectators are, once authenticated as an account that does not play it.
+// A player without an account cannot be told apart from a spectator
+// without one, which is why neither is
+func seesKibitz(r *http.Request, state GameState) bool {
+	player, err := requestPlayer(r)
+	return err == nil && !playedBy(state, player.ID)
+}
+
+// kibitzSoFar is the kibitz left on the game id reader is shown, without
+// the removed
+func kibitzSoFar(reader commentReader, id string) ([]Comment, error) {
+	list, err := comments.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	list = slices.DeleteFunc(list, func(c Comment) bool { return !c.Kibitz || c.Removed })
+	return reader.visible(list), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKibitz(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana, bo := Player{ID: "ana", Name: "ana"}, Player{ID: "bo", Name: "bo"}
+	for _, player := range []*Player{&ana, &bo} {
+		startSession(player, "test")
+		players.Create(*player)
+	}
+
+	server := httptest.NewServer(newPublicMux())
+	defer server.Close()
+	ctx := context.Background()
+	recorder := newGameRecorder(newGameID(), "", nil, "")
+	recorder.Record(ctx, GameCreated, "", nil)
+	recorder.RecordJoin(ctx, "white", "ana")
+	// black plays as a guest
+	recorder.RecordJoin(ctx, "black", "")
+	id := recorder.State().ID
+
+	post := func(token, body string) (int, Comment) {
+		r := httptest.NewRequest("POST", "/games/"+id+"/kibitz", strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, r)
+		comment := Comment{}
+		json.Unmarshal(w.Body.Bytes(), &comment)
+		return w.Code, comment
+	}
+	if code, first := post(bo.Token, `{"author":"bo","text":"white is lost"}`); code != http.StatusOK || !first.Kibitz || first.ID != 1 {
+		t.Fatalf("got %d %+v", code, first)
+	}
+	if code, _ := post(ana.Token, `{"author":"ana","text":"am I?"}`); code != http.StatusForbidden {
+		t.Errorf("got %d kibitzing on their own game", code)
+	}
+	// the guest playing black is not told apart from a spectator without an
+	// account, neither kibitzes nor is shown the kibitz
+	if code, _ := post("", `{"author":"guest","text":"is white lost?"}`); code != http.StatusUnauthorized {
+		t.Errorf("got %d kibitzing without an account", code)
+	}
+	guest, err := http.Get(server.URL + "/games/" + id + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the stream is under way once it starts sending the game
+	bufio.NewScanner(guest.Body).Scan()
+	if n := kibitz.watchers(id); n != 0 {
+		t.Errorf("the guest playing black follows the kibitz, %d watching", n)
+	}
+	guest.Body.Close()
+	document := func() gameDocument {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/games/"+id+"/json", nil))
+		doc := gameDocument{}
+		json.Unmarshal(w.Body.Bytes(), &doc)
+		return doc
+	}
+	if doc := document(); len(doc.Comments) != 0 {
+		t.Errorf("got %+v while the game is played", doc.Comments)
+	}
+
+	r, _ := http.NewRequest("GET", server.URL+"/games/"+id+"/events", nil)
+	r.Header.Set("Authorization", "Bearer "+bo.Token)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	// nextKibitz is the next kibitz the stream sends, skipping the rest
+	nextKibitz := func() Comment {
+		t.Helper()
+		event := ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			if value, ok := strings.CutPrefix(line, "event: "); ok {
+				event = value
+			}
+			if value, ok := strings.CutPrefix(line, "data: "); ok && event == "kibitz" {
+				comment := Comment{}
+				if err := json.Unmarshal([]byte(value), &comment); err != nil {
+					t.Fatal(err)
+				}
+				return comment
+			}
+		}
+		t.Fatal("the stream ended")
+		return Comment{}
+	}
+	if got := nextKibitz(); got.ID != 1 || got.Text != "white is lost" || got.Token != "" {
+		t.Fatalf("got %+v so far", got)
+	}
+	waitFor(t, func() bool { return kibitz.watchers(id) > 0 })
+	post(bo.Token, `{"author":"bo","text":"not yet","parent":1}`)
+	if got := nextKibitz(); got.ID != 2 || got.Parent != 1 {
+		t.Fatalf("got %+v", got)
+	}
+
+	recorder.Record(ctx, GameResigned, "white", nil)
+	if code, _ := post(bo.Token, `{"author":"bo","text":"told you"}`); code != http.StatusConflict {
+		t.Errorf("got %d once the game is over", code)
+	}
+	if doc := document(); len(doc.Comments) != 2 || !doc.Comments[1].Kibitz {
+		t.Errorf("got %+v once the game is over", doc.Comments)
+	}
+}
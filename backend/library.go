@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// the most games a player labels and collections they keep
+const (
+	maxLabeledGames = 1000
+	maxCollections  = 100
+)
+
+var (
+	errCollectionNotFound = errors.New("collection not found")
+	errTooManyLabeled     = errors.New("too many games labeled")
+	errTooManyCollections = errors.New("too many collections")
+)
+
+// Library is how a player organizes the games archived, theirs or not:
+// the labels they gave games, by game, and their collections
+type Library struct {
+	Games       map[string]GameLabels `json:"games,omitempty"`
+	Collections []Collection          `json:"collections,omitempty"`
+}
+
+// GameLabels are the tags a player gave a game, and whether they starred it
+type GameLabels struct {
+	Tags    []string `json:"tags" validate:"max=20,dive,min=1,max=30"`
+	Starred bool     `json:"starred,omitempty"`
+}
+
+// Collection is a named list of games, in the order the player put them
+type Collection struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name" validate:"required,max=40"`
+	Games []string `json:"games" validate:"max=500,dive,required"`
+}
+
+// labeledGame is a game of a library with its labels
+type labeledGame struct {
+	ID string `json:"id"`
+	GameLabels
+}
+
+// normalizeTags are tags trimmed and in lowercase, for the same tag to be
+// found however it is written, without repeating any
+func normalizeTags(tags []string) []string {
+	list := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !slices.Contains(list, tag) {
+			list = append(list, tag)
+		}
+	}
+	return list
+}
+
+// archived reports whether every one of ids is the ID of a game archived
+func archived(ids ...string) (bool, error) {
+	for _, id := range ids {
+		_, ok, err := archivedGame(id)
+		if !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// readLibraryBody decodes and validates what is posted into v, answering
+// the request itself unless ok
+func readLibraryBody(w http.ResponseWriter, r *http.Request, v any) (ok bool) {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(v); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return false
+	}
+	if err := validate.Struct(v); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// libraryGamesHandler serves the games the player authenticated labeled,
+// only those tagged ?tag= if any, or starred with ?starred=true
+func libraryGamesHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	tag := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag")))
+	starred := r.URL.Query().Get("starred") == "true"
+	list := []labeledGame{}
+	for id, labels := range player.Library.Games {
+		if (tag == "" || slices.Contains(labels.Tags, tag)) && (!starred || labels.Starred) {
+			list = append(list, labeledGame{ID: id, GameLabels: labels})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	writeJSON(w, list)
+}
+
+// labelGameHandler sets the labels the player authenticated gives the game
+// of the path; a game neither tagged nor starred is no longer labeled
+func labelGameHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	var labels GameLabels
+	if !readLibraryBody(w, r, &labels) {
+		return
+	}
+	labels.Tags = normalizeTags(labels.Tags)
+	if slices.Contains(labels.Tags, "") {
+		http.Error(w, "invalid body: empty tag", http.StatusBadRequest)
+		return
+	}
+	game := r.PathValue("game")
+	if ok, err := archived(game); !ok {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			http.Error(w, ErrGameNotFound.Error(), http.StatusNotFound)
+		}
+		return
+	}
+	err := players.Update(player.ID, func(player *Player) error {
+		if len(labels.Tags) == 0 && !labels.Starred {
+			delete(player.Library.Games, game)
+			return nil
+		}
+		if player.Library.Games == nil {
+			player.Library.Games = map[string]GameLabels{}
+		}
+		if _, ok := player.Library.Games[game]; !ok && len(player.Library.Games) >= maxLabeledGames {
+			return errTooManyLabeled
+		}
+		player.Library.Games[game] = labels
+		return nil
+	})
+	if errors.Is(err, errTooManyLabeled) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, labeledGame{ID: game, GameLabels: labels})
+}
+
+// collectionsHandler serves the collections of the player authenticated
+func collectionsHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	list := player.Library.Collections
+	if list == nil {
+		list = []Collection{}
+	}
+	writeJSON(w, list)
+}
+
+// collectionHandler serves a collection of the player authenticated
+func collectionHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(player.Library.Collections, func(c Collection) bool { return c.ID == r.PathValue("collection") })
+	if i < 0 {
+		http.Error(w, errCollectionNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, player.Library.Collections[i])
+}
+
+// readCollection is the collection posted, of games archived, answering the
+// request itself unless ok
+func readCollection(w http.ResponseWriter, r *http.Request) (c Collection, ok bool) {
+	if !readLibraryBody(w, r, &c) {
+		return Collection{}, false
+	}
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Games == nil {
+		c.Games = []string{}
+	}
+	ok, err := archived(c.Games...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return Collection{}, false
+	}
+	if !ok || c.Name == "" {
+		http.Error(w, "a collection is named and of games archived", http.StatusBadRequest)
+		return Collection{}, false
+	}
+	return c, true
+}
+
+// createCollectionHandler adds the collection posted to those of the
+// player authenticated
+func createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	c, ok := readCollection(w, r)
+	if !ok {
+		return
+	}
+	c.ID = newGameID()
+	err := players.Update(player.ID, func(player *Player) error {
+		if len(player.Library.Collections) >= maxCollections {
+			return errTooManyCollections
+		}
+		player.Library.Collections = append(player.Library.Collections, c)
+		return nil
+	})
+	if errors.Is(err, errTooManyCollections) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, c)
+}
+
+// putCollectionHandler replaces the name and games of a collection of the
+// player authenticated with those posted
+func putCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	c, ok := readCollection(w, r)
+	if !ok {
+		return
+	}
+	c.ID = r.PathValue("collection")
+	err := updateCollections(player.ID, c.ID, func(list []Collection, i int) []Collection {
+		list[i] = c
+		return list
+	})
+	if errors.Is(err, errCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, c)
+}
+
+// deleteCollectionHandler deletes a collection of the player authenticated,
+// not the games in it
+func deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	err := updateCollections(player.ID, r.PathValue("collection"), func(list []Collection, i int) []Collection {
+		return slices.Delete(list, i, i+1)
+	})
+	if errors.Is(err, errCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateCollections saves the collections of the player id as change leaves
+// them, given the index of the collection of that ID
+func updateCollections(id, collection string, change func(list []Collection, i int) []Collection) error {
+	return players.Update(id, func(player *Player) error {
+		i := slices.IndexFunc(player.Library.Collections, func(c Collection) bool { return c.ID == collection })
+		if i < 0 {
+			return errCollectionNotFound
+		}
+		player.Library.Collections = change(player.Library.Collections, i)
+		return nil
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLibrary(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana := Player{ID: "ana", Name: "ana"}
+	startSession(&ana, "test")
+	players.Create(ana)
+	for _, id := range []string{"library-1", "library-2"} {
+		newGameRecorder(id, "", nil, "").Record(context.Background(), GameCreated, "", nil)
+	}
+	do := func(method, path, body string, v any) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+ana.Token)
+		newPublicMux().ServeHTTP(w, r)
+		json.Unmarshal(w.Body.Bytes(), v)
+		return w.Code
+	}
+
+	var labeled labeledGame
+	if code := do("PUT", "/players/ana/library/games/library-1", `{"tags":[" Endgame","endgame","rook"],"starred":true}`, &labeled); code != http.StatusOK || strings.Join(labeled.Tags, ",") != "endgame,rook" {
+		t.Fatalf("got %d %+v", code, labeled)
+	}
+	do("PUT", "/players/ana/library/games/library-2", `{"tags":["rook"]}`, &labeled)
+	if code := do("PUT", "/players/ana/library/games/nowhere", `{"tags":["rook"]}`, nil); code != http.StatusNotFound {
+		t.Errorf("got %d tagging a game not archived", code)
+	}
+	if code := do("PUT", "/players/ana/library/games/library-1", `{"tags":[" "]}`, nil); code != http.StatusBadRequest {
+		t.Errorf("got %d for an empty tag", code)
+	}
+	var list []labeledGame
+	if do("GET", "/players/ana/library/games?tag=ROOK", "", &list); len(list) != 2 || list[0].ID != "library-1" {
+		t.Errorf("got %+v tagged rook", list)
+	}
+	if do("GET", "/players/ana/library/games?starred=true", "", &list); len(list) != 1 || list[0].ID != "library-1" {
+		t.Errorf("got %+v starred", list)
+	}
+	// clearing the labels of a game forgets it
+	do("PUT", "/players/ana/library/games/library-2", `{"tags":[]}`, nil)
+	if do("GET", "/players/ana/library/games", "", &list); len(list) != 1 {
+		t.Errorf("got %+v", list)
+	}
+
+	var c Collection
+	if code := do("POST", "/players/ana/collections", `{"name":"Rook endings","games":["library-2","library-1"]}`, &c); code != http.StatusOK || c.ID == "" || len(c.Games) != 2 {
+		t.Fatalf("got %d %+v", code, c)
+	}
+	if code := do("POST", "/players/ana/collections", `{"name":"Lost","games":["nowhere"]}`, nil); code != http.StatusBadRequest {
+		t.Errorf("got %d for a game not archived", code)
+	}
+	if code := do("PUT", "/players/ana/collections/"+c.ID, `{"name":"Rook endgames","games":["library-1"]}`, &c); code != http.StatusOK {
+		t.Errorf("got %d renaming", code)
+	}
+	var got Collection
+	if do("GET", "/players/ana/collections/"+c.ID, "", &got); got.Name != "Rook endgames" || len(got.Games) != 1 {
+		t.Errorf("got %+v", got)
+	}
+	var collections []Collection
+	if do("GET", "/players/ana/collections", "", &collections); len(collections) != 1 {
+		t.Errorf("got %+v", collections)
+	}
+	if code := do("DELETE", "/players/ana/collections/"+c.ID, "", nil); code != http.StatusNoContent {
+		t.Errorf("got %d deleting", code)
+	}
+	if code := do("GET", "/players/ana/collections/"+c.ID, "", nil); code != http.StatusNotFound {
+		t.Errorf("got %d for a deleted collection", code)
+	}
+
+	// the library is only the player's
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/ana/library/games", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got %d unauthenticated", w.Code)
+	}
+}
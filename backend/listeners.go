@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// listenerSpec is an address the server listens on and what it serves there
+type listenerSpec struct {
+	// Kind is public, for the clients, or admin
+	Kind string
+	// Network is tcp, or unix for a socket at the path in Addr
+	Network string
+	Addr    string
+	TLS     bool
+}
+
+// parseListener reads a listener written kind[+tls]=address, like
+// public+tls=:443, admin=127.0.0.1:6060 or public=unix:/run/chess.sock
+func parseListener(value string) (listenerSpec, error) {
+	kind, addr, ok := strings.Cut(value, "=")
+	if !ok || addr == "" {
+		return listenerSpec{}, fmt.Errorf("listener %q is not kind=address", value)
+	}
+	spec := listenerSpec{Network: "tcp", Addr: addr}
+	kind, spec.TLS = strings.CutSuffix(kind, "+tls")
+	if kind != "public" && kind != "admin" {
+		return listenerSpec{}, fmt.Errorf("listener %q is neither public nor admin", value)
+	}
+	spec.Kind = kind
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if spec.TLS {
+			return listenerSpec{}, fmt.Errorf("listener %q: Unix sockets are served without TLS", value)
+		}
+		spec.Network, spec.Addr = "unix", path
+	}
+	return spec, nil
+}
+
+func (spec listenerSpec) String() string {
+	kind := spec.Kind
+	if spec.TLS {
+		kind += "+tls"
+	}
+	if spec.Network == "unix" {
+		return kind + "=unix:" + spec.Addr
+	}
+	return kind + "=" + spec.Addr
+}
+
+// listenersFlag collects every -listen flag
+type listenersFlag []listenerSpec
+
+func (f *listenersFlag) String() string {
+	specs := make([]string, len(*f))
+	for i, spec := range *f {
+		specs[i] = spec.String()
+	}
+	return strings.Join(specs, " ")
+}
+
+func (f *listenersFlag) Set(value string) error {
+	spec, err := parseListener(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, spec)
+	return nil
+}
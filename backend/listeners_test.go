@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestParseListener(t *testing.T) {
+	for value, want := range map[string]listenerSpec{
+		"public=:5555":                {Kind: "public", Network: "tcp", Addr: ":5555"},
+		"public+tls=:443":             {Kind: "public", Network: "tcp", Addr: ":443", TLS: true},
+		"admin=127.0.0.1:6060":        {Kind: "admin", Network: "tcp", Addr: "127.0.0.1:6060"},
+		"public=unix:/run/chess.sock": {Kind: "public", Network: "unix", Addr: "/run/chess.sock"},
+	} {
+		got, err := parseListener(value)
+		if err != nil || got != want {
+			t.Errorf("parseListener(%q) = %+v, %v, want %+v", value, got, err, want)
+		}
+		if got.String() != value {
+			t.Errorf("%+v is written %q, want %q", got, got.String(), value)
+		}
+	}
+	for _, value := range []string{"", ":5555", "public=", "metrics=:9090", "public+tls=unix:/run/chess.sock"} {
+		if _, err := parseListener(value); err == nil {
+			t.Errorf("parseListener(%q) did not fail", value)
+		}
+	}
+}
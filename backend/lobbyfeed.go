@@ -0,0 +1,99 @@
+package main
+
+import "errors"
+
+// lobbyFeed hands what goes on in the lobby to the connections following
+// it live, all under the same key
+var lobbyFeed = newEventFeeds[lobbyNews]()
+
+// lobbyNews is a message for the lobby; one about seek is only sent to
+// those shown the seek, with it filled in as they are
+type lobbyNews struct {
+	message Message
+	seek    *ChessGame
+}
+
+func init() {
+	bus.subscribe(busGameStarted, func(event busEvent) {
+		if !event.State.Private {
+			lobbyFeed.publish("", lobbyNews{message: lobbyGame("game_started", event.State)})
+		}
+	})
+	// the results featured are those of rated games
+	bus.subscribe(busGameFinished, func(event busEvent) {
+		if !event.State.Private && isRated(event.State) {
+			message := lobbyGame("featured_result", event.State)
+			message.Result = event.State.Result
+			lobbyFeed.publish("", lobbyNews{message: message})
+		}
+	})
+}
+
+// lobbyGame is the message of type about the game of state
+func lobbyGame(messageType string, state GameState) Message {
+	return Message{Type: messageType, GameID: state.ID, Slug: state.Slug, Players: state.Players, Rules: gameRules(state)}
+}
+
+// announceSeek tells the lobby about the seek game just created, and
+// withdrawSeek that it is gone, taken or left
+func announceSeek(game *ChessGame) {
+	lobbyFeed.publish("", lobbyNews{message: Message{Type: "seek"}, seek: game})
+}
+
+func withdrawSeek(game *ChessGame) {
+	lobbyFeed.publish("", lobbyNews{message: Message{Type: "seek_removed", GameID: game.id}})
+}
+
+// joinLobby has conn follow the lobby: it is sent the seeks it is shown, as
+// GET /lobby lists them for its player and ?rating=, then every seek created
+// it is shown, every one removed, the games starting and featured results.
+// A connection falling behind is closed, to reconnect and start over
+func joinLobby(conn *connection) {
+	news, cancel := lobbyFeed.subscribe("")
+	conn.Write(Message{Type: "lobby", Seeks: listSeeks(conn.player, conn.band)})
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case item, ok := <-news:
+				if !ok {
+					conn.Close(errSlowClient.Error())
+					return
+				}
+				if item.seek != nil {
+					s, shown := listedSeek(item.seek, conn.player, conn.band)
+					if !shown {
+						continue
+					}
+					item.message.Seeks = []seek{s}
+				}
+				conn.Write(item.message)
+			case <-conn.closed:
+				return
+			}
+		}
+	}()
+	go listenOnly(conn)
+}
+
+// listenOnly reads from conn, a connection only listening, to notice the
+// client leaving, answering anything it sends but validate_fen with
+// WRONG_ROLE
+func listenOnly(conn *connection) {
+	for {
+		message, err := conn.Read()
+		if errors.Is(err, ErrInvalidPayload) {
+			conn.Write(errorMessage(CodeInvalidPayload))
+			continue
+		}
+		if err != nil {
+			conn.Close("")
+			return
+		}
+		if message.Type == "validate_fen" {
+			conn.Write(validateFENMessage(message.FEN))
+			continue
+		}
+		conn.Write(errorMessage(CodeWrongRole))
+	}
+}
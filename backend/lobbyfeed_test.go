@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLobbyFeed(t *testing.T) {
+	viewer := newTestPlayer(t)
+	joinLobby(viewer.conn)
+	viewer.expect("lobby")
+
+	creator := newTestPlayer(t)
+	creator.conn.options = GameOptions{Color: "black"}
+	if err := games.Pair(context.Background(), creator.conn); err != nil {
+		t.Fatal(err)
+	}
+	seek := viewer.expect("seek")
+	if len(seek.Seeks) != 1 || seek.Seeks[0].Color != "black" {
+		t.Fatalf("got %+v", seek)
+	}
+	id := seek.Seeks[0].ID
+
+	// a seek viewer is not in the band of is not shown to them
+	picky := newTestPlayer(t)
+	picky.conn.band = ratingBand{Min: 2000}
+	picky.conn.options = GameOptions{Takebacks: takebacksOnce}
+	if err := games.Pair(context.Background(), picky.conn); err != nil {
+		t.Fatal(err)
+	}
+
+	joiner := newTestPlayer(t)
+	if err := games.Pair(context.Background(), joiner.conn); err != nil {
+		t.Fatal(err)
+	}
+	if got := viewer.expect("seek_removed"); got.GameID != id {
+		t.Errorf("got %+v, want %s removed", got, id)
+	}
+	if got := viewer.expect("game_started"); got.GameID != id || got.Rules == nil {
+		t.Errorf("got %+v", got)
+	}
+
+	viewer.send(Message{Type: "move", From: "e2", To: "e4"})
+	viewer.expect("error", CodeWrongRole)
+	picky.disconnect()
+	viewer.expect("seek_removed")
+}
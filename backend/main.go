@@ -1,37 +1,635 @@
 package main
 
 import (
+	"compress/flate"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var upgrader = websocket.Upgrader{
-	ReadBufferSize:  2048,
-	WriteBufferSize: 2048,
+	CheckOrigin:  func(r *http.Request) bool { return true },
+	Subprotocols: subprotocols(),
 }
 
-var game *ChessGame
-
 func wsHandler(w http.ResponseWriter, r *http.Request) {
-	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "ws.upgrade")
+	defer span.End()
+
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
+		recordError(span, err)
+		return
+	}
+	ws.SetCompressionLevel(compressionLevel)
+
+	admit(ctx, span, r, newWSTransport(ws))
+}
+
+// admit negotiates the connection requested by r over t, its ?v= and
+// ?encoding= or the WebSocket subprotocol agreed, see subprotocols, then
+// either resumes the game it asks for or pairs it with a player seeking an
+// opponent in the ?rating= band it accepts, see parseRatingBand,
+// or with the closest in rating for ?quick=true, see QuickPair,
+// or with three others for ?variant=bughouse or hand_and_brain, or against
+// the engine at ?level= for ?variant=engine. Those seeking without an
+// account prove first what seekChallenge asks, see passesChallenge, and
+// none seeks beyond clientLimit, told by the pairing itself. ?board= connects to an
+// analysis board instead, a new one for ?board=new, and ?study= to the
+// board of its ?chapter=; ?match= plays the games of a match, see joinMatch,
+// ?bracket= follows a bracket, see joinBracket, and ?inbox=true the inbox
+// of the player authenticated, see joinInbox.
+//
+// With ?handshake=true the connection authenticates with its first message
+// instead of ?auth=, an auth message with the Token of the player or none
+// for guests, sent within authTimeout; it is answered an auth message with
+// Role player or guest. Where requireAccounts, guests are refused either way.
+//
+// ?game= resumes a game with the ?token= of a seat, sent in the start
+// message, and ?seq=, the last message the client saw. A client whose
+// network changed, from wifi to a mobile network say, reconnects at once
+// with ?takeover=true as well: the connection it had is closed with
+// TAKEN_OVER if the server still thinks it open, and the client is sent
+// only the messages it missed if the server still has them, the whole
+// game in a resume message otherwise. The clock of the player runs in
+// between; a game both players dropped from waits reconnectGrace for them.
+//
+// In a deployment of instances sharing a database, ?game= and ?crowd= for
+// a game another instance owns are sent a redirect message with the URL of
+// that instance to connect to instead, see gameElsewhere. So are the
+// players and voters of a game handed off to another instance while it is
+// played, see HandOff
+func admit(ctx context.Context, span trace.Span, r *http.Request, t transport) {
+	// refused connections are answered in version 1 JSON, the only thing
+	// every client can be expected to understand
+	span.SetAttributes(attribute.String("client.address", clientIP(r)))
+	lang := negotiateLanguage(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+	refuse := func(err error, args ...string) {
+		recordError(span, err)
+		closeWithError(newConnection(t, 1, jsonCodec{}, lang), err, args...)
+	}
+
+	if isBanned(r) {
+		refuse(ErrBanned)
+		return
+	}
+	if connectionsFull() {
+		refuse(ErrServerFull)
+		return
+	}
+
+	v, encoding := r.URL.Query().Get("v"), r.URL.Query().Get("encoding")
+	if s, ok := t.(subprotocoller); ok && s.Subprotocol() != "" {
+		v, encoding = parseSubprotocol(s.Subprotocol())
+	}
+	version, err := parseProtocolVersion(v)
+	if err != nil {
+		refuse(err, v, fmt.Sprint(supportedProtocolVersions))
+		return
+	}
+
+	codec, err := parseEncoding(encoding)
+	if err == nil && codec == (protobufCodec{}) && !t.SupportsBinary() {
+		err = ErrUnsupportedEncoding
+	}
+	if err != nil {
+		refuse(err, encoding)
+		return
+	}
+	conn := newConnection(t, version, codec, lang)
+	token := r.URL.Query().Get("auth")
+	handshake, _ := strconv.ParseBool(r.URL.Query().Get("handshake"))
+	if handshake {
+		if token, err = readAuth(conn); err != nil {
+			recordError(span, err)
+			if _, ok := errorCodes[err]; !ok {
+				conn.Close(err.Error())
+				return
+			}
+			closeWithError(conn, err)
+			return
+		}
+	}
+	if token != "" {
+		player, err := authenticate(token)
+		if err != nil {
+			recordError(span, err)
+			closeWithError(conn, ErrInvalidPlayerToken)
+			return
+		}
+		if !allows(player, token, scopePlay, scopeBot) {
+			recordError(span, ErrMissingScope)
+			closeWithError(conn, ErrMissingScope, scopePlay)
+			return
+		}
+		goOnline(conn, player.ID)
+		conn.preferences = &player.Preferences
+	}
+	conn.client = "ip:" + clientIP(r)
+	if conn.player != "" {
+		conn.client = "player:" + conn.player
+	}
+	if requireAccounts && conn.player == "" {
+		recordError(span, ErrAuthRequired)
+		closeWithError(conn, ErrAuthRequired)
+		return
+	}
+	if handshake {
+		role := "guest"
+		if conn.player != "" {
+			role = "player"
+		}
+		conn.Write(Message{Type: "auth", Role: role})
+	}
+	conn.level = r.URL.Query().Get("level")
+	var field string
+	if conn.options, field, err = parseGameOptions(r.URL.Query(), conn.player); err != nil {
+		recordError(span, err)
+		closeWithError(conn, err, field)
+		return
+	}
+	if conn.band, err = parseRatingBand(r.URL.Query().Get("rating")); err != nil {
+		recordError(span, err)
+		closeWithError(conn, err, r.URL.Query().Get("rating"))
+		return
+	}
+
+	if id := r.URL.Query().Get("match"); id != "" {
+		joinMatch(ctx, conn, id, r.URL.Query().Get("token"), r.URL.Query().Get("games"))
+		return
+	}
+
+	if id := r.URL.Query().Get("simul"); id != "" {
+		joinSimul(ctx, conn, id, r.URL.Query().Get("token"), r.URL.Query().Get("boards"))
+		return
+	}
+
+	if id := r.URL.Query().Get("game"); id != "" {
+		if redirectGame(conn, r, id) {
+			return
+		}
+		lastSeq, err := strconv.Atoi(r.URL.Query().Get("seq"))
+		if err != nil {
+			lastSeq = -1
+		}
+		takeover, _ := strconv.ParseBool(r.URL.Query().Get("takeover"))
+		resumeGame(ctx, conn, id, r.URL.Query().Get("token"), lastSeq, takeover)
+		return
 	}
 
-	if game == nil {
-		game = NewChessGame(ws)
-	} else {
-		game.Join(ws)
-		game = nil
+	if id := r.URL.Query().Get("replay"); id != "" {
+		joinReplay(conn, id, r.URL.Query().Get("token"))
+		return
+	}
+
+	if id := r.URL.Query().Get("board"); id != "" {
+		joinAnalysisBoard(conn, id, r.URL.Query().Get("token"))
+		return
+	}
+
+	if id := r.URL.Query().Get("study"); id != "" {
+		joinStudy(conn, id, r.URL.Query().Get("chapter"), r.URL.Query().Get("token"))
+		return
+	}
+
+	if lobby, _ := strconv.ParseBool(r.URL.Query().Get("lobby")); lobby {
+		joinLobby(conn)
+		return
+	}
+
+	if inbox, _ := strconv.ParseBool(r.URL.Query().Get("inbox")); inbox {
+		joinInbox(conn)
+		return
+	}
+
+	if id := r.URL.Query().Get("bracket"); id != "" {
+		joinBracket(conn, id, connectionReader(r, conn))
+		return
+	}
+
+	if id := r.URL.Query().Get("crowd"); id != "" {
+		if redirectGame(conn, r, id) {
+			return
+		}
+		joinCrowd(conn, id)
+		return
+	}
+
+	if conn.player == "" && !passesChallenge(r) {
+		recordError(span, ErrChallengeFailed)
+		closeWithError(conn, ErrChallengeFailed)
+		return
+	}
+	pair := variantKindOf(conn.options.Variant).pair
+	if quick, _ := strconv.ParseBool(r.URL.Query().Get("quick")); quick {
+		pair = (*gameManager).QuickPair
+	}
+	if err := pair(games, ctx, conn); err != nil {
+		recordError(span, err)
+		closeWithError(conn, err, clientLimitArgs(err)...)
+	}
+}
+
+func resumeGame(ctx context.Context, conn *connection, id, token string, lastSeq int, takeover bool) {
+	game, ok := findGame(id)
+	if !ok {
+		closeWithError(conn, ErrGameNotFound, id)
+		return
+	}
+	resume := game.Resume
+	if takeover {
+		resume = game.Takeover
+	}
+	if err := resume(ctx, conn, token, lastSeq); err != nil {
+		closeWithError(conn, err)
 	}
 }
 
 func main() {
-	fmt.Println("Listening at port 5555")
-	http.HandleFunc("/ws", wsHandler)
-	log.Fatal(http.ListenAndServe(":5555", nil))
+	// simple-chess migrate [flags] migrates the data directory and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		runMigrate(LoadConfig())
+		return
+	}
+	cfg := LoadConfig()
+
+	shutdownTracing, err := setupTracing(context.Background(), cfg.OTelEndpoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	stopEventExport, err := startEventExport(cfg.EventExport)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	storage, err := openStorage(cfg.Storage, cfg.DataDir, cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer storage.Close()
+	if err := checkMigrations(storage, cfg.AutoMigrate); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.DatabaseReplica != "" {
+		if err := useReplica(storage, cfg.DatabaseReplica); err != nil {
+			log.Fatal(err)
+		}
+	}
+	store, players, comments, studies = storage.Games(), invalidatingPlayerStore{storage.Players()}, storage.Comments(), storage.Studies()
+	accountReviews = storage.Reviews()
+	archiveStore = storage.Archive()
+	registry = storage.Registry()
+
+	if err := indexShortLinks(); err != nil {
+		log.Fatal(err)
+	}
+
+	snapshotPath := ""
+	if cfg.DataDir != "" {
+		snapshotPath = filepath.Join(cfg.DataDir, "snapshot.json")
+		restored, err := restoreGames(snapshotPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Restored", restored, "games")
+		go checkpointGames(snapshotPath, cfg.CheckpointInterval)
+	}
+
+	recordDir = cfg.RecordDir
+
+	// games are checkpointed before they are stopped, so that their
+	// players can resume them once the server is back
+	shutdownServer = func() {
+		if snapshotPath != "" {
+			if err := writeSnapshot(snapshotPath); err != nil {
+				log.Println("checkpoint:", err)
+			}
+		}
+		games.Shutdown()
+		stopEventExport()
+		os.Exit(0)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		shutdownServer()
+	}()
+
+	upgrader.EnableCompression = cfg.Compression
+	if cfg.CompressionLevel < flate.HuffmanOnly || cfg.CompressionLevel > flate.BestCompression {
+		log.Fatal("invalid compression level ", cfg.CompressionLevel)
+	}
+	compressionLevel, compressionThreshold = cfg.CompressionLevel, cfg.CompressionThreshold
+
+	upgrader.ReadBufferSize, upgrader.WriteBufferSize = cfg.ReadBufferSize, cfg.WriteBufferSize
+	upgrader.HandshakeTimeout = cfg.HandshakeTimeout
+	if cfg.PingInterval <= 0 || cfg.PingInterval >= cfg.PongWait {
+		log.Fatal("the ping interval must be positive and shorter than the pong wait")
+	}
+	pingInterval, pongWait = cfg.PingInterval, cfg.PongWait
+	maxConnections, maxGames = cfg.MaxConnections, cfg.MaxGames
+	if cfg.MaxGamesPerClient < 0 || cfg.MaxSeeksPerClient < 0 {
+		log.Fatal("the games and seeks of a client cannot be limited to less than none")
+	}
+	maxGamesPerClient, maxSeeksPerClient = cfg.MaxGamesPerClient, cfg.MaxSeeksPerClient
+	if cfg.SeekTTL < 0 {
+		log.Fatal("the seek TTL cannot be negative")
+	}
+	seekTTL = cfg.SeekTTL
+	if cfg.ResultSigningKey != "" {
+		seed, err := hex.DecodeString(cfg.ResultSigningKey)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			log.Fatalf("the result signing key is a seed of %d bytes in hex", ed25519.SeedSize)
+		}
+		resultKey = ed25519.NewKeyFromSeed(seed)
+	}
+	if cfg.OffersEvery < 0 {
+		log.Fatal("the moves between two offers cannot be negative")
+	}
+	offersEvery = cfg.OffersEvery
+	if cfg.SpectatorDelayMoves < 0 || cfg.SpectatorDelay < 0 {
+		log.Fatal("the spectator delay cannot be negative")
+	}
+	spectatorDelayMoves, spectatorDelay = cfg.SpectatorDelayMoves, cfg.SpectatorDelay
+	if cfg.UnattendedGameTTL < 0 {
+		log.Fatal("the unattended game TTL cannot be negative")
+	}
+	unattendedGameTTL = cfg.UnattendedGameTTL
+	if cfg.ReconnectGrace < 0 {
+		log.Fatal("the reconnect grace cannot be negative")
+	}
+	reconnectGrace = cfg.ReconnectGrace
+	if cfg.MaxLagCompensation < 0 {
+		log.Fatal("the lag compensation cannot be negative")
+	}
+	maxLagCompensation = cfg.MaxLagCompensation
+	if cfg.AuthTimeout <= 0 {
+		log.Fatal("the auth timeout must be positive")
+	}
+	authTimeout, requireAccounts = cfg.AuthTimeout, cfg.RequireAccounts
+	webhookPrivateNetworks = cfg.WebhookPrivateNetworks
+	if cfg.CacheTTL <= 0 {
+		log.Fatal("the cache TTL must be positive")
+	}
+	cacheTTL = cfg.CacheTTL
+	if cache, err = openCache(cfg.Cache); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.MaxGameDuration < 0 {
+		log.Fatal("the maximum game duration cannot be negative")
+	}
+	maxGameDuration = cfg.MaxGameDuration
+	if cfg.JanitorInterval <= 0 {
+		log.Fatal("the janitor interval must be positive")
+	}
+	janitorEvery = cfg.JanitorInterval
+	go games.runJanitor()
+	if cfg.ConnectionIdleTimeout < 0 {
+		log.Fatal("the connection idle timeout cannot be negative")
+	}
+	connectionIdleTimeout = cfg.ConnectionIdleTimeout
+	go runReaper(games.ctx)
+	go games.broadcastSpectators()
+	if cfg.ChatMaxLinks < 0 {
+		log.Fatal("the most links of a comment cannot be negative")
+	}
+	filter, err := newChatFilter(cfg.ChatFilter, cfg.ChatMaxLinks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	commentHooks = append(commentHooks, filter.hook)
+	if timeControlPresets, err = parseTimeControlPresets(cfg.TimeControlPresets); err != nil {
+		log.Fatal(err)
+	}
+	if timeControl, err = parseTimeControl(cfg.TimeControl); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.VoteWindow <= 0 {
+		log.Fatal("the vote window must be positive")
+	}
+	voteWindow = cfg.VoteWindow
+	if cfg.AnalysisWorkers <= 0 {
+		log.Fatal("there must be an analysis worker at least")
+	}
+	analysisWorkers, analysisRate, apiRate = cfg.AnalysisWorkers, cfg.AnalysisRate, cfg.APIRate
+	switch cfg.SeekChallenge {
+	case "", "pow":
+	case "captcha":
+		if cfg.CaptchaVerifyURL == "" || cfg.CaptchaSecret == "" {
+			log.Fatal("a CAPTCHA challenge needs the verify URL and secret of the provider")
+		}
+	default:
+		log.Fatalf("unknown seek challenge %q, use pow or captcha", cfg.SeekChallenge)
+	}
+	if cfg.PoWDifficulty < 1 || cfg.PoWDifficulty > 32 {
+		log.Fatal("the proof of work difficulty goes from 1 to 32 bits")
+	}
+	seekChallenge, powDifficulty = cfg.SeekChallenge, cfg.PoWDifficulty
+	captchaVerifyURL, captchaSecret, captchaSiteKey = cfg.CaptchaVerifyURL, cfg.CaptchaSecret, cfg.CaptchaSiteKey
+	if cfg.ChallengeSecret != "" {
+		challengeKey = []byte(cfg.ChallengeSecret)
+	}
+	if uciEngines, err = parseEngines(cfg.UCIEngines); err != nil {
+		log.Fatal(err)
+	}
+	if oauthProviders, err = parseOAuthProviders(cfg.OAuthProviders); err != nil {
+		log.Fatal(err)
+	}
+	if len(oauthProviders) > 0 && cfg.PublicURL == "" {
+		log.Fatal("logging in with OAuth providers needs the public URL of the server")
+	}
+	publicURL = cfg.PublicURL
+	instanceURL = cfg.InstanceURL
+	if instanceURL != "" {
+		go watchMembership(registry)
+	}
+	if cfg.SMTPURL != "" {
+		if sendMail, err = smtpMailer(cfg.SMTPURL, cfg.MailFrom); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cfg.ServeFrontend {
+		frontendFiles = embeddedFrontend()
+	}
+	if trustedProxies, err = parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("invalid trusted proxies: ", err)
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		log.Fatal("a TLS certificate needs its key and the other way around")
+	}
+
+	if cfg.WebTransportAddr != "" {
+		if cfg.TLSCert == "" || cfg.TLSKey == "" {
+			log.Fatal("a TLS certificate and key are required to enable WebTransport")
+		}
+		go func() {
+			fmt.Println("WebTransport listening at", cfg.WebTransportAddr)
+			log.Fatal(serveWebTransport(cfg.WebTransportAddr, cfg.TLSCert, cfg.TLSKey))
+		}()
+	}
+
+	cors := corsPolicy{
+		origins:     splitList(cfg.CORSOrigins),
+		methods:     cfg.CORSMethods,
+		headers:     cfg.CORSHeaders,
+		credentials: cfg.CORSCredentials,
+		maxAge:      cfg.CORSMaxAge,
+	}
+	if cors.credentials && slices.Contains(cors.origins, "*") {
+		log.Fatal("cross-origin requests with credentials need the allowed origins listed")
+	}
+
+	// every listener gets a server and handler of its own
+	errs := make(chan error)
+	for _, spec := range cfg.Listeners {
+		serverCfg, handler := cfg, cors.wrap(withRateLimit(newPublicMux()))
+		switch {
+		case spec.TLS && cfg.TLSCert == "":
+			log.Fatal("a TLS certificate and key are required by ", spec)
+		case spec.Kind == "admin" && cfg.AdminToken == "":
+			log.Fatal("an admin token is required to enable the admin server")
+		case spec.Kind == "admin":
+			handler = newAdminMux(cfg.AdminToken)
+			// profiles are written for as long as they were asked for
+			serverCfg.WriteTimeout = 0
+		}
+		server, err := newServer(serverCfg, spec.Addr, handler)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			fmt.Println("Listening at", spec)
+			errs <- serve(cfg, spec, server)
+		}()
+	}
+	log.Fatal(<-errs)
+}
+
+// newPublicMux routes the requests of the clients
+func newPublicMux() *http.ServeMux {
+	// importing net/http/pprof registers its handlers on http.DefaultServeMux,
+	// so the public server must never use it
+	mux := http.NewServeMux()
+	publicRoutes(mux)
+	return mux
+}
+
+// publicRoutes registers the routes of the public server on mux, see
+// openAPI for those of the REST API
+func publicRoutes(mux routes) {
+	mux.HandleFunc("/ws", wsHandler)
+	mux.HandleFunc("GET /sse", sseHandler)
+	mux.HandleFunc("/sse/{session}", postMessageHandler)
+	mux.HandleFunc("/poll", pollConnectHandler)
+	mux.HandleFunc("GET /poll/{session}", pollHandler)
+	mux.HandleFunc("/poll/{session}", postMessageHandler)
+	mux.HandleFunc("GET /healthz", healthzHandler)
+	mux.HandleFunc("GET /readyz", readyzHandler)
+	mux.HandleFunc("GET /embed/{id}", embedHandler)
+	mux.HandleFunc("GET /g/{slug}", shortLinkHandler)
+	mux.HandleFunc("GET /simuls/{id}", simulHandler)
+	mux.HandleFunc("GET /matches/{id}", matchHandler)
+	mux.HandleFunc("POST /brackets", withScope(scopePlay, createBracketHandler))
+	mux.HandleFunc("GET /brackets/{id}", bracketHandler)
+	mux.HandleFunc("GET /brackets/{id}/seat", withScope(scopePlay, bracketSeatHandler))
+	mux.HandleFunc("POST /brackets/{id}/players", withScope(scopePlay, bracketRegisterHandler))
+	mux.HandleFunc("DELETE /brackets/{id}/players", withScope(scopePlay, bracketWithdrawHandler))
+	mux.HandleFunc("POST /brackets/{id}/chat", bracketChatHandler)
+	mux.HandleFunc("DELETE /brackets/{id}/chat/{comment}", deleteBracketChatHandler)
+	mux.HandleFunc("POST /games", withScope(scopePlay, createGameHandler))
+	mux.HandleFunc("GET /games/{id}/board.svg", boardSVGHandler)
+	mux.HandleFunc("GET /games/{id}/board.png", boardPNGHandler)
+	mux.HandleFunc("GET /games/{id}/gif", gameGIFHandler)
+	mux.HandleFunc("GET /games/{id}/fen", fenHandler)
+	mux.HandleFunc("GET /games/{id}/json", gameDocumentHandler)
+	mux.HandleFunc("GET /games/{id}/certificate", certificateHandler)
+	mux.HandleFunc("GET /certificates/key", resultKeyHandler)
+	mux.HandleFunc("POST /certificates/verify", verifyCertificateHandler)
+	mux.HandleFunc("GET /games/{id}/events", withGameAffinity(gameEventsHandler))
+	mux.HandleFunc("GET /games/{id}/replay", replayHandler)
+	mux.HandleFunc("POST /games/{id}/comments", postCommentHandler)
+	mux.HandleFunc("POST /games/{id}/kibitz", kibitzHandler)
+	mux.HandleFunc("DELETE /games/{id}/comments/{comment}", deleteCommentHandler)
+	mux.HandleFunc("POST /analyze", analyzeHandler)
+	mux.HandleFunc("POST /validate-fen", validateFENHandler)
+	mux.HandleFunc("GET /graphql", graphQLHandler)
+	mux.HandleFunc("POST /graphql", graphQLHandler)
+	mux.HandleFunc("POST /players", createPlayerHandler)
+	mux.HandleFunc("GET /players/{id}", playerHandler)
+	mux.HandleFunc("PATCH /players/{id}", withScope(scopeAdmin, editPlayerHandler))
+	mux.HandleFunc("DELETE /players/{id}", withScope(scopeAdmin, deletePlayerHandler))
+	mux.HandleFunc("GET /players/{id}/export", withScope(scopeReadArchive, exportHandler))
+	mux.HandleFunc("POST /accounts", registerHandler)
+	mux.HandleFunc("GET /accounts/verify", verifyEmailHandler)
+	mux.HandleFunc("POST /accounts/login", loginHandler)
+	mux.HandleFunc("POST /accounts/reset", resetPasswordHandler)
+	mux.HandleFunc("POST /accounts/reset/confirm", confirmResetHandler)
+	mux.HandleFunc("GET /auth/{provider}/login", oauthLoginHandler)
+	mux.HandleFunc("GET /auth/{provider}/callback", oauthCallbackHandler)
+	mux.HandleFunc("GET /players/{id}/preferences", withScope(scopeReadArchive, preferencesHandler))
+	mux.HandleFunc("PUT /players/{id}/preferences", withScope(scopeAdmin, putPreferencesHandler))
+	mux.HandleFunc("GET /players/{id}/notifications", withScope(scopePlay, notificationsHandler))
+	mux.HandleFunc("POST /players/{id}/notifications/read", withScope(scopePlay, readNotificationsHandler))
+	mux.HandleFunc("GET /players/{id}/mutes", withScope(scopeReadArchive, mutesHandler))
+	mux.HandleFunc("PUT /players/{id}/mutes/{player}", withScope(scopeAdmin, muteHandler))
+	mux.HandleFunc("DELETE /players/{id}/mutes/{player}", withScope(scopeAdmin, unmuteHandler))
+	mux.HandleFunc("GET /lobby", lobbyHandler)
+	mux.HandleFunc("GET /challenge", challengeHandler)
+	mux.HandleFunc("GET /quick-messages", quickMessagesHandler)
+	mux.HandleFunc("GET /time-controls", timeControlPresetsHandler)
+	mux.HandleFunc("GET /account/quota", quotaHandler)
+	mux.HandleFunc("GET /players/{id}/versus/{opponent}", headToHeadHandler)
+	mux.HandleFunc("GET /players/{id}/stats", statsHandler)
+	mux.HandleFunc("GET /players/{id}/repertoire", repertoireHandler)
+	mux.HandleFunc("GET /players/{id}/games.pgn", gamesPGNHandler)
+	mux.HandleFunc("GET /players/{id}/games.ndjson", gamesNDJSONHandler)
+	mux.HandleFunc("GET /players/{id}/library/games", withScope(scopeReadArchive, libraryGamesHandler))
+	mux.HandleFunc("PUT /players/{id}/library/games/{game}", withScope(scopeAdmin, labelGameHandler))
+	mux.HandleFunc("GET /players/{id}/collections", withScope(scopeReadArchive, collectionsHandler))
+	mux.HandleFunc("POST /players/{id}/collections", withScope(scopeAdmin, createCollectionHandler))
+	mux.HandleFunc("GET /players/{id}/collections/{collection}", withScope(scopeReadArchive, collectionHandler))
+	mux.HandleFunc("PUT /players/{id}/collections/{collection}", withScope(scopeAdmin, putCollectionHandler))
+	mux.HandleFunc("DELETE /players/{id}/collections/{collection}", withScope(scopeAdmin, deleteCollectionHandler))
+	mux.HandleFunc("GET /players/{id}/sessions", withScope(scopeAdmin, sessionsHandler))
+	mux.HandleFunc("DELETE /players/{id}/sessions", withScope(scopeAdmin, revokeOtherSessionsHandler))
+	mux.HandleFunc("DELETE /players/{id}/sessions/{session}", withScope(scopeAdmin, revokeSessionHandler))
+	mux.HandleFunc("GET /players/{id}/tokens", withScope(scopeAdmin, accessTokensHandler))
+	mux.HandleFunc("POST /players/{id}/tokens", withScope(scopeAdmin, createAccessTokenHandler))
+	mux.HandleFunc("DELETE /players/{id}/tokens/{token}", withScope(scopeAdmin, revokeAccessTokenHandler))
+	mux.HandleFunc("GET /players/{id}/webhooks", withScope(scopeAdmin, webhooksHandler))
+	mux.HandleFunc("POST /players/{id}/webhooks", withScope(scopeAdmin, createWebhookHandler))
+	mux.HandleFunc("DELETE /players/{id}/webhooks/{webhook}", withScope(scopeAdmin, deleteWebhookHandler))
+	mux.HandleFunc("GET /players/{id}/webhooks/{webhook}/deliveries", withScope(scopeAdmin, deliveriesHandler))
+	mux.HandleFunc("POST /studies", createStudyHandler)
+	mux.HandleFunc("GET /studies/{id}", studyHandler)
+	mux.HandleFunc("POST /studies/{id}/chapters", addChapterHandler)
+	mux.HandleFunc("GET /studies/{id}/pgn", studyPGNHandler)
+	mux.HandleFunc("GET /schema/messages.json", messageSchemaHandler)
+	mux.HandleFunc("GET /schema/protocol.proto", protocolProtoHandler)
+	mux.HandleFunc("GET /openapi.json", openAPIHandler)
+	if frontendFiles != nil {
+		mux.Handle("/", frontendHandler(frontendFiles))
+	}
 }
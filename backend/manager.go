@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// gameManager owns the lifecycle of games: it pairs players into new games
+// and keeps the active ones, those that have both players or had them
+// before a restart, for players to resume
+type gameManager struct {
+	// ctx is the parent of the contexts of every game
+	ctx  context.Context
+	stop context.CancelCauseFunc
+
+	mu sync.Mutex
+	// seeks are the games created by players still alone in them, the
+	// oldest first
+	seeks  []*ChessGame
+	active map[string]*ChessGame
+	simuls map[string]*simul
+	series map[string]*series
+	// brackets hold no games of their own, those they create are active
+	brackets map[string]*bracket
+	boards   map[string]*analysisBoard
+	// queues hold the players waiting for the games of four players,
+	// by variant
+	queues map[string][]*connection
+	// quick is the quick pair queue, the longest waiting first, matched
+	// every quickMatchEvery while quickTicking
+	quick        []quickSeeker
+	quickTicking bool
+	// unattended are the active games nobody is connected to, restored or
+	// paused ones waiting for their players, aborted once they have waited
+	// for unattendedGameTTL
+	unattended *ttlStore[*ChessGame]
+}
+
+// maxGameDuration is how long a game may last from its creation before the
+// server ends it, see expire; games are never ended if 0
+var maxGameDuration = 24 * time.Hour
+
+// reconnectGrace is how long a game both players dropped from waits for
+// either to resume it before it is abandoned
+var reconnectGrace = 10 * time.Second
+
+// unattendedGameTTL is how long a game nobody is connected to waits for its
+// players, for ever if 0
+var unattendedGameTTL = 24 * time.Hour
+
+var games = newGameManager()
+
+var ErrShuttingDown = errors.New("server shutting down")
+
+func newGameManager() *gameManager {
+	ctx, stop := context.WithCancelCause(context.Background())
+	unattended := newTTLStore(func(_ string, game *ChessGame) { game.Abort() })
+	return &gameManager{ctx: ctx, stop: stop, active: map[string]*ChessGame{}, simuls: map[string]*simul{}, series: map[string]*series{}, brackets: map[string]*bracket{}, boards: map[string]*analysisBoard{}, queues: map[string][]*connection{}, unattended: unattended}
+}
+
+// Pair puts conn in the oldest seek it and its creator accept each other
+// in, see eligible, or in a new seek that waits for the next player
+func (m *gameManager) Pair(ctx context.Context, conn *connection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.clientLimit(conn.client); err != nil {
+		return err
+	}
+	for {
+		i := slices.IndexFunc(m.seeks, func(game *ChessGame) bool { return eligible(game, conn) })
+		if i < 0 {
+			if err := m.canCreate(); err != nil {
+				return err
+			}
+			game := NewChessGame(ctx, conn)
+			game.band = conn.band
+			m.seeks = append(m.seeks, game)
+			announceSeek(game)
+			return nil
+		}
+		game := m.seeks[i]
+		m.seeks = slices.Delete(m.seeks, i, i+1)
+		withdrawSeek(game)
+		// registered first, a game that ends right away is still unregistered
+		m.active[game.id] = game
+		err := game.Join(ctx, conn)
+		if err != nil {
+			delete(m.active, game.id)
+		}
+		// the player seeking left just before, conn looks for another seek
+		if !errors.Is(err, errWaitingPlayerLeft) {
+			return err
+		}
+	}
+}
+
+// withdraw takes game out of the seeks, telling the lobby, reporting false
+// if it is not one of them, as once an opponent is joining it
+func (m *gameManager) withdraw(game *ChessGame) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.Index(m.seeks, game)
+	if i < 0 {
+		return false
+	}
+	m.seeks = slices.Delete(m.seeks, i, i+1)
+	withdrawSeek(game)
+	return true
+}
+
+// Seeks are the games waiting for an opponent, the oldest first
+func (m *gameManager) Seeks() []*ChessGame {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.seeks)
+}
+
+// enqueue puts conn in the queue of variant, returning the four players
+// to start a game with once they are in, unless clientLimit refuses it;
+// m.mu must be held. The players queued are not read from, one leaving is
+// only noticed once the game started
+func (m *gameManager) enqueue(variant string, conn *connection) ([]*connection, error) {
+	if err := m.clientLimit(conn.client); err != nil {
+		return nil, err
+	}
+	m.queues[variant] = append(m.queues[variant], conn)
+	if len(m.queues[variant]) < 4 {
+		return nil, nil
+	}
+	players := m.queues[variant]
+	delete(m.queues, variant)
+	return players, nil
+}
+
+// canCreate tells why no new game can be created, if so;
+// m.mu must be held
+func (m *gameManager) canCreate() error {
+	if draining.Load() {
+		return ErrDraining
+	}
+	if maxGames > 0 && len(m.active) >= maxGames {
+		return ErrServerFull
+	}
+	return nil
+}
+
+func (m *gameManager) Register(game *ChessGame) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active[game.id] = game
+}
+
+func (m *gameManager) Unregister(game *ChessGame) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.active, game.id)
+	m.unattended.Delete(game.id)
+	unseatClients(game)
+	if i := slices.Index(m.seeks, game); i >= 0 {
+		m.seeks = slices.Delete(m.seeks, i, i+1)
+		withdrawSeek(game)
+	}
+}
+
+// unattend registers game as waiting for its players to come back, and
+// attend as having one back
+func (m *gameManager) unattend(game *ChessGame) {
+	if unattendedGameTTL > 0 {
+		m.unattended.Put(game.id, game, unattendedGameTTL)
+	}
+}
+
+func (m *gameManager) attend(game *ChessGame) {
+	m.unattended.Delete(game.id)
+}
+
+func (m *gameManager) Find(id string) (*ChessGame, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	game, ok := m.active[id]
+	return game, ok
+}
+
+func (m *gameManager) List() []*ChessGame {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]*ChessGame, 0, len(m.active))
+	for _, game := range m.active {
+		list = append(list, game)
+	}
+	return list
+}
+
+// Shutdown stops every game, returning once their loops are done
+func (m *gameManager) Shutdown() {
+	m.mu.Lock()
+	m.stop(ErrShuttingDown)
+	stopped := make([]*ChessGame, 0, len(m.active)+len(m.seeks))
+	for _, game := range m.active {
+		stopped = append(stopped, game)
+	}
+	stopped = append(stopped, m.seeks...)
+	simuls := make([]*simul, 0, len(m.simuls))
+	for _, s := range m.simuls {
+		simuls = append(simuls, s)
+	}
+	boards := make([]*analysisBoard, 0, len(m.boards))
+	for _, b := range m.boards {
+		boards = append(boards, b)
+	}
+	clear(m.boards)
+	for variant, queue := range m.queues {
+		for _, conn := range queue {
+			closeWithError(conn, ErrShuttingDown)
+		}
+		delete(m.queues, variant)
+	}
+	for _, seeker := range m.quick {
+		closeWithError(seeker.conn, ErrShuttingDown)
+	}
+	m.quick = nil
+	for _, s := range m.series {
+		s.mu.Lock()
+		if s.open != nil {
+			stopped = append(stopped, s.open)
+		}
+		if s.waiting != nil {
+			closeWithError(s.waiting, ErrShuttingDown)
+			s.waiting = nil
+		}
+		s.mu.Unlock()
+	}
+	m.mu.Unlock()
+	for _, b := range boards {
+		b.hangUp(ErrShuttingDown)
+	}
+	// the boards of simuls still waiting for opponents are nowhere else
+	for _, s := range simuls {
+		s.mu.Lock()
+		for _, board := range s.boards {
+			if !board.hasJoined() {
+				stopped = append(stopped, board)
+			}
+		}
+		s.mu.Unlock()
+	}
+	for _, game := range stopped {
+		<-game.done
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentPlayersArePairedOnce(t *testing.T) {
+	const pairs = 50
+	players := make([]*testPlayer, 2*pairs)
+	var wg sync.WaitGroup
+	for i := range players {
+		players[i] = newTestPlayer(t)
+		wg.Add(1)
+		go func(player *testPlayer) {
+			defer wg.Done()
+			if err := games.Pair(context.Background(), player.conn); err != nil {
+				t.Error(err)
+			}
+		}(players[i])
+	}
+	wg.Wait()
+
+	colors := map[string][]string{}
+	for _, player := range players {
+		start := player.expect("start")
+		colors[start.GameID] = append(colors[start.GameID], start.Color)
+	}
+	if len(colors) != pairs {
+		t.Fatalf("got %d games, want %d", len(colors), pairs)
+	}
+	for id, got := range colors {
+		if len(got) != 2 || got[0] == got[1] {
+			t.Errorf("game %s has players %v", id, got)
+		}
+		if _, ok := games.Find(id); !ok {
+			t.Errorf("game %s is not active", id)
+		}
+	}
+}
+
+func TestDrainingRefusesNewGamesOnly(t *testing.T) {
+	white := newTestPlayer(t)
+	if err := games.Pair(context.Background(), white.conn); err != nil {
+		t.Fatal(err)
+	}
+	draining.Store(true)
+	defer draining.Store(false)
+
+	// the waiting game can still start
+	black := newTestPlayer(t)
+	if err := games.Pair(context.Background(), black.conn); err != nil {
+		t.Fatal(err)
+	}
+	white.expect("start")
+	black.expect("start")
+	if err := games.Pair(context.Background(), newTestPlayer(t).conn); err != ErrDraining {
+		t.Fatalf("got %v, want %v", err, ErrDraining)
+	}
+}
+
+func TestWaitingPlayerLeaving(t *testing.T) {
+	left := newTestPlayer(t)
+	if err := games.Pair(context.Background(), left.conn); err != nil {
+		t.Fatal(err)
+	}
+	games.mu.Lock()
+	abandoned := games.seeks[len(games.seeks)-1]
+	games.mu.Unlock()
+	left.disconnect()
+	<-abandoned.done
+
+	white, black := newTestPlayer(t), newTestPlayer(t)
+	for _, player := range []*testPlayer{white, black} {
+		if err := games.Pair(context.Background(), player.conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if start := white.expect("start"); start.GameID == abandoned.id {
+		t.Fatal("paired into the abandoned game")
+	}
+	black.expect("start")
+}
+
+func TestFinishedGameLeavesNoGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	game, white, black := startTestGame(t)
+	white.send(Message{Type: "resign"})
+	white.expect("game_over")
+	black.expect("game_over")
+	<-game.done
+	waitFor(t, func() bool { return runtime.NumGoroutine() <= before })
+}
+
+func TestGamesBeyondTheLimitAreRefused(t *testing.T) {
+	// the game stays active until the test is over
+	startTestGame(t)
+	maxGames = 1
+	defer func() { maxGames = 0 }()
+
+	if err := games.Pair(context.Background(), newTestPlayer(t).conn); err != ErrServerFull {
+		t.Fatalf("got %v, want %v", err, ErrServerFull)
+	}
+}
+
+func TestDrainingServerExitsAtTheDeadline(t *testing.T) {
+	// the game stays active until the test is over
+	startTestGame(t)
+	exited := make(chan struct{})
+	shutdownServer = func() { close(exited) }
+	defer func() { shutdownServer = func() {} }()
+	defer stopDrain()
+
+	startDrain(10 * time.Millisecond)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("the server did not exit")
+	}
+}
+
+func TestStoppingDrainKeepsTheServerRunning(t *testing.T) {
+	shutdownServer = func() { t.Error("the server exited") }
+	defer func() { shutdownServer = func() {} }()
+
+	startDrain(100 * time.Millisecond)
+	stopDrain()
+	time.Sleep(200 * time.Millisecond)
+	if draining.Load() {
+		t.Fatal("still draining")
+	}
+}
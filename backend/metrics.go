@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// the counters of what the bus publishes, served with the rest of expvar
+// at /metrics of the admin listener
+var (
+	gamesStarted   = expvar.NewInt("games_started")
+	movesPlayed    = expvar.NewInt("moves_played")
+	gamesFinished  = expvar.NewInt("games_finished")
+	usersConnected = expvar.NewInt("users_connected")
+)
+
+// what the janitor reclaimed from the manager, see janitorReport
+var (
+	janitorGames       = expvar.NewInt("janitor_games_removed")
+	janitorSimuls      = expvar.NewInt("janitor_simuls_removed")
+	janitorMatches     = expvar.NewInt("janitor_matches_removed")
+	janitorBrackets    = expvar.NewInt("janitor_brackets_removed")
+	janitorConnections = expvar.NewInt("janitor_connections_closed")
+)
+
+// reapedConnections counts the idle connections the reaper closed
+var reapedConnections = expvar.NewInt("reaper_connections_closed")
+
+// the latencies of the moves, from the frame read to the opponent written:
+// how long a move waited for the game loop to get to it, how long checking
+// it took, and how long the move forwarded waited for and took to be
+// written to the connection of the opponent
+var (
+	moveQueueing  = newHistogram("move_queueing_ms")
+	moveCheck     = newHistogram("move_validation_ms")
+	moveWrite     = newHistogram("move_write_ms")
+	latencyBounds = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000}
+)
+
+func init() {
+	expvar.Publish("open_connections", expvar.Func(func() any { return openConnections.Load() }))
+	for t, counter := range map[busEventType]*expvar.Int{
+		busGameStarted:   gamesStarted,
+		busMovePlayed:    movesPlayed,
+		busGameFinished:  gamesFinished,
+		busUserConnected: usersConnected,
+	} {
+		bus.subscribe(t, func(busEvent) { counter.Add(1) })
+	}
+}
+
+// histogram counts durations in the buckets of latencyBounds, in
+// milliseconds, and one more for those beyond. It is served as JSON with
+// the counts of each bucket up to its bound, as Prometheus does, their
+// total count and sum
+type histogram struct {
+	counts []atomic.Int64
+	count  atomic.Int64
+	sumNs  atomic.Int64
+}
+
+func newHistogram(name string) *histogram {
+	h := &histogram{counts: make([]atomic.Int64, len(latencyBounds)+1)}
+	expvar.Publish(name, h)
+	return h
+}
+
+func (h *histogram) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	i := 0
+	for i < len(latencyBounds) && ms > latencyBounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sumNs.Add(int64(d))
+}
+
+// since observes the time since start, unless it is unknown
+func (h *histogram) since(start time.Time) {
+	if !start.IsZero() {
+		h.observe(time.Since(start))
+	}
+}
+
+func (h *histogram) String() string {
+	buckets := map[string]int64{}
+	var cumulative int64
+	for i := range h.counts {
+		cumulative += h.counts[i].Load()
+		bound := "+Inf"
+		if i < len(latencyBounds) {
+			bound = strconv.FormatFloat(latencyBounds[i], 'f', -1, 64)
+		}
+		buckets[bound] = cumulative
+	}
+	data, _ := json.Marshal(struct {
+		Buckets map[string]int64 `json:"buckets"`
+		Count   int64            `json:"count"`
+		SumMs   float64          `json:"sumMs"`
+	}{buckets, h.count.Load(), float64(h.sumNs.Load()) / float64(time.Millisecond)})
+	return string(data)
+}
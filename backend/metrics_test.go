@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := &histogram{counts: make([]atomic.Int64, len(latencyBounds)+1)}
+	for _, d := range []time.Duration{20 * time.Microsecond, 3 * time.Millisecond, 5 * time.Millisecond, 2 * time.Second} {
+		h.observe(d)
+	}
+	var got struct {
+		Buckets map[string]int64
+		Count   int64
+		SumMs   float64
+	}
+	if err := json.Unmarshal([]byte(h.String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 4 || got.Buckets["0.05"] != 1 || got.Buckets["2.5"] != 1 || got.Buckets["5"] != 3 || got.Buckets["1000"] != 3 || got.Buckets["+Inf"] != 4 || got.SumMs != 2008.02 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestMoveLatenciesAreMeasured(t *testing.T) {
+	queued, checked, written := moveQueueing.count.Load(), moveCheck.count.Load(), moveWrite.count.Load()
+	checking := moveCheck.sumNs.Load()
+	_, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	if moveQueueing.count.Load() == queued || moveCheck.count.Load() != checked+1 {
+		t.Error("the move was not measured")
+	}
+	// the move of a standard game is checked by the rules, which takes time
+	if moveCheck.sumNs.Load() <= checking {
+		t.Error("checking the move took no time")
+	}
+	// and a move the check refuses is measured as well
+	black.send(move("2", "e7", "e4"))
+	black.expect("error", CodeIllegalMove)
+	if moveCheck.count.Load() != checked+2 {
+		t.Error("the illegal move was not measured")
+	}
+	// the write is measured once the frame is written, maybe after it is read
+	waitFor(t, func() bool { return moveWrite.count.Load() > written })
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	newAdminMux("secret").ServeHTTP(w, r)
+	var metrics map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"move_queueing_ms", "move_validation_ms", "move_write_ms", "moves_played"} {
+		if metrics[name] == nil {
+			t.Errorf("%s is missing", name)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// schemaVersionFile holds the version of the layout of the data directory,
+// that of the last migration applied to it
+const schemaVersionFile = "schema_version"
+
+var errPendingMigrations = errors.New("the storage needs migrating, run the migrate subcommand or start with -auto-migrate")
+
+// migration changes the layout of a data directory from the version before
+// it to its own. Once released a migration is never changed, the next
+// change is a new one; those interrupted are run again, so they have to
+// pick up where they stopped
+type migration struct {
+	version int
+	name    string
+	up      func(dataDir string) error
+}
+
+// migrations are every one there is, in the order of their versions
+var migrations = []migration{
+	{1, "move the event logs of games to games/", moveGameLogs},
+}
+
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// schemaVersion is the version of dataDir, 0 if it has none yet as with
+// directories older than migrations or new ones
+func schemaVersion(dataDir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, schemaVersionFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", schemaVersionFile, err)
+	}
+	return version, nil
+}
+
+func setSchemaVersion(dataDir string, version int) error {
+	path := filepath.Join(dataDir, schemaVersionFile)
+	if err := os.WriteFile(path+".tmp", []byte(strconv.Itoa(version)+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// pendingMigrations are those dataDir is yet to have applied
+func pendingMigrations(dataDir string) ([]migration, error) {
+	version, err := schemaVersion(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if version > latestSchemaVersion() {
+		return nil, fmt.Errorf("the data directory is at version %d, written by a later release than this one, which knows up to %d", version, latestSchemaVersion())
+	}
+	i := 0
+	for i < len(migrations) && migrations[i].version <= version {
+		i++
+	}
+	return migrations[i:], nil
+}
+
+// migrate applies the pending migrations of dataDir in order, recording
+// the version of each once it is done
+func migrate(dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return err
+	}
+	pending, err := pendingMigrations(dataDir)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		log.Printf("migrating the data directory to version %d: %s", m.version, m.name)
+		if err := m.up(dataDir); err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+		if err := setSchemaVersion(dataDir, m.version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMigrations migrates storage if auto, or refuses to go on with
+// migrations pending otherwise
+func checkMigrations(storage Storage, auto bool) error {
+	if auto {
+		return storage.Migrate()
+	}
+	pending, err := storage.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return errPendingMigrations
+	}
+	return nil
+}
+
+// runMigrate is the migrate subcommand: it applies the migrations pending
+// in the storage of cfg, the data directory or the database
+func runMigrate(cfg Config) {
+	storage, err := openStorage(cfg.Storage, cfg.DataDir, cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer storage.Close()
+	if err := storage.Migrate(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("The storage is up to date")
+}
+
+// moveGameLogs moves the event logs of games, first kept in the data
+// directory itself alongside everything else, to a directory of their own
+func moveGameLogs(dataDir string) error {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(dataDir, "games")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".jsonl") {
+			if err := os.Rename(filepath.Join(dataDir, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
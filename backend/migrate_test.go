@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	dir := t.TempDir()
+	// a data directory from before migrations, game logs at the top
+	os.WriteFile(filepath.Join(dir, "abc.jsonl"), []byte(`{"gameId":"abc","seq":1,"type":"game_created"}`+"\n"), 0o644)
+	os.MkdirAll(filepath.Join(dir, "players"), 0o755)
+
+	storage, err := newFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkMigrations(storage, false); !errors.Is(err, errPendingMigrations) {
+		t.Fatalf("got %v with migrations pending", err)
+	}
+	if err := checkMigrations(storage, true); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := schemaVersion(dir); err != nil || version != latestSchemaVersion() {
+		t.Fatalf("got version %d, %v", version, err)
+	}
+	if events, err := storage.Games().Load("abc"); err != nil || len(events) != 1 {
+		t.Errorf("got %v, %v after migrating", events, err)
+	}
+	if err := checkMigrations(storage, false); err != nil {
+		t.Errorf("got %v once migrated", err)
+	}
+
+	setSchemaVersion(dir, latestSchemaVersion()+1)
+	if err := checkMigrations(storage, true); err == nil {
+		t.Error("a data directory of a later release was migrated")
+	}
+}
@@ -0,0 +1,30 @@
+-- the event log of every game, one row per event
+CREATE TABLE events (
+	game_id TEXT NOT NULL,
+	seq INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (game_id, seq)
+);
+
+-- players as JSON documents, their ratings and games included
+CREATE TABLE players (
+	id TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+
+-- the accounts elsewhere players log in with, as in github:1234
+CREATE TABLE identities (
+	identity TEXT PRIMARY KEY,
+	player_id TEXT NOT NULL
+);
+
+-- the comments on every game, the whole thread as a JSON array
+CREATE TABLE comments (
+	game_id TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+
+CREATE TABLE studies (
+	id TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
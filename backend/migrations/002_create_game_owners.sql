@@ -0,0 +1,6 @@
+-- the instance playing every game, for the others to send its players
+-- and spectators there
+CREATE TABLE game_owners (
+	game_id TEXT PRIMARY KEY,
+	instance TEXT NOT NULL
+);
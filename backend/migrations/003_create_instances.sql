@@ -0,0 +1,6 @@
+-- the instances up, each seen last when it told the others, for them to
+-- share the games out
+CREATE TABLE instances (
+	url TEXT PRIMARY KEY,
+	seen_at BIGINT NOT NULL
+);
@@ -0,0 +1,2 @@
+-- the snapshot of a game handed off to its owner, until it picks it up
+ALTER TABLE game_owners ADD COLUMN handoff TEXT;
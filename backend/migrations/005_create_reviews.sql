@@ -0,0 +1,5 @@
+-- the reviews of the accounts that played rated games, see reviewGame
+CREATE TABLE reviews (
+	player_id TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrBanned   = errors.New("banned")
+	ErrDraining = errors.New("server draining")
+	ErrKicked   = errors.New("kicked")
+)
+
+// bans holds the IP addresses refused by the server
+var bans = struct {
+	sync.Mutex
+	ips map[string]bool
+}{ips: map[string]bool{}}
+
+func ban(ip string) {
+	bans.Lock()
+	defer bans.Unlock()
+	bans.ips[ip] = true
+}
+
+func unban(ip string) {
+	bans.Lock()
+	defer bans.Unlock()
+	delete(bans.ips, ip)
+}
+
+func listBans() []string {
+	bans.Lock()
+	defer bans.Unlock()
+	ips := make([]string, 0, len(bans.ips))
+	for ip := range bans.ips {
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// shadowMutes holds the clients, as rateClient tells them, whose comments
+// nobody is shown but themselves, for them not to know to come back under
+// another name
+var shadowMutes = struct {
+	sync.Mutex
+	clients map[string]bool
+}{clients: map[string]bool{}}
+
+func shadowMute(client string) {
+	shadowMutes.Lock()
+	defer shadowMutes.Unlock()
+	shadowMutes.clients[client] = true
+}
+
+func unshadowMute(client string) {
+	shadowMutes.Lock()
+	defer shadowMutes.Unlock()
+	delete(shadowMutes.clients, client)
+}
+
+func listShadowMutes() []string {
+	shadowMutes.Lock()
+	defer shadowMutes.Unlock()
+	clients := make([]string, 0, len(shadowMutes.clients))
+	for client := range shadowMutes.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// isShadowMuted reports whether r comes from a client shadow muted, by its
+// account or, whether it has one or not, its IP address
+func isShadowMuted(r *http.Request) bool {
+	client, ip := rateClient(r), "ip:"+clientIP(r)
+	shadowMutes.Lock()
+	defer shadowMutes.Unlock()
+	return shadowMutes.clients[client] || shadowMutes.clients[ip]
+}
+
+func isBanned(r *http.Request) bool {
+	ip := clientIP(r)
+	bans.Lock()
+	defer bans.Unlock()
+	return bans.ips[ip]
+}
+
+// draining servers create no new games, the ones in progress
+// and the one waiting for an opponent are still played
+var draining atomic.Bool
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// maxMutes bounds the accounts a player mutes
+const maxMutes = 500
+
+var (
+	errMuteSelf     = errors.New("players cannot mute themselves")
+	errTooManyMutes = fmt.Errorf("players mute up to %d accounts", maxMutes)
+)
+
+// mutesHandler lists the accounts the player authenticated mutes
+func mutesHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, append([]string{}, player.Muted...))
+}
+
+// muteHandler mutes an account for the player authenticated, who is not
+// shown its comments and kibitz anymore, like those of an opponent
+func muteHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	muted := r.PathValue("player")
+	if muted == player.ID {
+		http.Error(w, errMuteSelf.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := players.Load(muted); errors.Is(err, ErrPlayerNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err := players.Update(player.ID, func(player *Player) error {
+		if slices.Contains(player.Muted, muted) {
+			return nil
+		}
+		if len(player.Muted) >= maxMutes {
+			return errTooManyMutes
+		}
+		player.Muted = append(player.Muted, muted)
+		return nil
+	})
+	switch {
+	case errors.Is(err, errTooManyMutes):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// unmuteHandler shows the player authenticated an account muted again
+func unmuteHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	err := players.Update(player.ID, func(player *Player) error {
+		player.Muted = slices.DeleteFunc(player.Muted, func(id string) bool { return id == r.PathValue("player") })
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commentReader is who reads comments: the client they are, as rateClient
+// tells it, and the accounts they mute if they have one
+type commentReader struct {
+	client string
+	muted  []string
+}
+
+func newCommentReader(r *http.Request) commentReader {
+	reader := commentReader{client: "ip:" + clientIP(r)}
+	if player, err := requestPlayer(r); err == nil {
+		reader.client, reader.muted = "player:"+player.ID, player.Muted
+	}
+	return reader
+}
+
+// connectionReader is the comment reader of conn, connected by r: the
+// player it authenticated as, if any
+func connectionReader(r *http.Request, conn *connection) commentReader {
+	reader := newCommentReader(r)
+	if conn.player != "" {
+		reader.client, reader.muted = "player:"+conn.player, nil
+		if player, err := players.Load(conn.player); err == nil {
+			reader.muted = player.Muted
+		}
+	}
+	return reader
+}
+
+// sees reports whether the reader is shown comment: those shadow muted are
+// only shown to who left them, and those of the accounts muted to nobody
+// muting them
+func (reader commentReader) sees(comment Comment) bool {
+	if comment.Shadowed && comment.Poster != reader.client {
+		return false
+	}
+	id, ok := strings.CutPrefix(comment.Poster, "player:")
+	return !ok || !slices.Contains(reader.muted, id)
+}
+
+// visible are the comments of list the reader is shown, as publicComments
+// leaves them
+func (reader commentReader) visible(list []Comment) []Comment {
+	return publicComments(slices.DeleteFunc(list, func(c Comment) bool { return !reader.sees(c) }))
+}
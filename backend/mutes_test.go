@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMutes(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	accounts := map[string]*Player{}
+	for _, id := range []string{"ana", "bo", "cy"} {
+		player := Player{ID: id, Name: id}
+		startSession(&player, "test")
+		players.Create(player)
+		accounts[id] = &player
+	}
+	ctx := context.Background()
+	recorder := newGameRecorder(newGameID(), "", nil, "")
+	recorder.Record(ctx, GameCreated, "", nil)
+	recorder.RecordJoin(ctx, "white", "ana")
+	recorder.RecordJoin(ctx, "black", "bo")
+	recorder.Record(ctx, GameResigned, "white", nil)
+	id := recorder.State().ID
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, r)
+		return w
+	}
+	do("POST", "/games/"+id+"/comments", accounts["bo"].Token, `{"author":"bo","text":"good game"}`)
+	do("POST", "/games/"+id+"/comments", "", `{"author":"dee","text":"well played"}`)
+	// who reads the comments, as their authors
+	authors := func(token string) string {
+		doc := gameDocument{}
+		json.Unmarshal(do("GET", "/games/"+id+"/json", token, "").Body.Bytes(), &doc)
+		names := []string{}
+		for _, comment := range doc.Comments {
+			if comment.Poster != "" || comment.Shadowed {
+				t.Errorf("got %+v published", comment)
+			}
+			names = append(names, comment.Author)
+		}
+		return strings.Join(names, ",")
+	}
+
+	if w := do("PUT", "/players/ana/mutes/ana", accounts["ana"].Token, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d muting themselves", w.Code)
+	}
+	if w := do("PUT", "/players/ana/mutes/nobody", accounts["ana"].Token, ""); w.Code != http.StatusNotFound {
+		t.Errorf("got %d muting nobody", w.Code)
+	}
+	if w := do("PUT", "/players/ana/mutes/bo", accounts["bo"].Token, ""); w.Code != http.StatusForbidden {
+		t.Errorf("got %d muting for another player", w.Code)
+	}
+	do("PUT", "/players/ana/mutes/bo", accounts["ana"].Token, "")
+	do("PUT", "/players/ana/mutes/bo", accounts["ana"].Token, "")
+	if w := do("GET", "/players/ana/mutes", accounts["ana"].Token, ""); strings.TrimSpace(w.Body.String()) != `["bo"]` {
+		t.Errorf("got %s muted", w.Body)
+	}
+	if got := authors(accounts["ana"].Token); got != "dee" {
+		t.Errorf("got %s muting bo", got)
+	}
+	if got := authors(""); got != "bo,dee" {
+		t.Errorf("got %s for others", got)
+	}
+
+	defer unshadowMute("player:cy")
+	for client, code := range map[string]int{"player:cy": http.StatusNoContent, "ip:nowhere": http.StatusBadRequest, "cy": http.StatusBadRequest} {
+		r := httptest.NewRequest("PUT", "/shadow-mutes/"+client, nil)
+		r.Header.Set("Authorization", "Bearer admin")
+		w := httptest.NewRecorder()
+		newAdminMux("admin").ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("got %d shadow muting %s", w.Code, client)
+		}
+	}
+	w := do("POST", "/games/"+id+"/comments", accounts["cy"].Token, `{"author":"cy","text":"buy followers"}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "shadowed") {
+		t.Errorf("got %d %s shadow muted", w.Code, w.Body)
+	}
+	if got := authors(accounts["cy"].Token); got != "bo,dee,cy" {
+		t.Errorf("got %s for the one shadow muted", got)
+	}
+	if got := authors(""); got != "bo,dee" {
+		t.Errorf("got %s with cy shadow muted", got)
+	}
+
+	do("DELETE", "/players/ana/mutes/bo", accounts["ana"].Token, "")
+	if got := authors(accounts["ana"].Token); got != "bo,dee" {
+		t.Errorf("got %s unmuting bo", got)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// the kinds of notifications
+const (
+	// your_move tells a player of an untimed game their opponent moved
+	// while they were away from it
+	notificationYourMove        = "your_move"
+	notificationBracketStarting = "bracket_starting"
+	notificationAchievement     = "achievement_unlocked"
+)
+
+// maxNotifications is how many notifications an inbox keeps, the oldest
+// dropped first
+const maxNotifications = 100
+
+// Notification is one in the inbox of a player, about the game, bracket
+// or achievement of its kind
+type Notification struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"`
+	Game        string    `json:"game,omitempty"`
+	Bracket     string    `json:"bracket,omitempty"`
+	Achievement string    `json:"achievement,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Read        bool      `json:"read,omitempty"`
+}
+
+// inboxFeed hands what changes in the inbox of a player to the connections
+// following it live, keyed by their ID
+var inboxFeed = newEventFeeds[Message]()
+
+func init() {
+	bus.subscribe(busMovePlayed, func(event busEvent) {
+		game, ok := games.Find(event.GameID)
+		if !ok {
+			return
+		}
+		state := game.recorder.State()
+		color := opponent(event.Color)
+		if state.TimeControl != nil || state.Finished || game.isConnected(color) {
+			return
+		}
+		// the inbox is stored, not updated on the game loop
+		go notifyYourMove(players, state.Players[color], state.ID)
+	})
+}
+
+func (game *ChessGame) isConnected(color string) bool {
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	return game.connected[color]
+}
+
+func unread(notifications []Notification) int {
+	n := 0
+	for _, notification := range notifications {
+		if !notification.Read {
+			n++
+		}
+	}
+	return n
+}
+
+// notify adds n to the inbox of the player id of accounts and pushes it to
+// their connections following it; a your_move is not added while an
+// unread one tells of the same game
+func notify(accounts PlayerStore, id string, n Notification) {
+	if id == "" {
+		return
+	}
+	n.ID, n.CreatedAt = newGameID(), time.Now().UTC()
+	added, count := false, 0
+	err := accounts.Update(id, func(player *Player) error {
+		if player.Deleted {
+			return nil
+		}
+		if n.Kind == notificationYourMove && slices.ContainsFunc(player.Notifications, func(other Notification) bool {
+			return !other.Read && other.Kind == notificationYourMove && other.Game == n.Game
+		}) {
+			return nil
+		}
+		player.Notifications = append(player.Notifications, n)
+		if len(player.Notifications) > maxNotifications {
+			player.Notifications = player.Notifications[len(player.Notifications)-maxNotifications:]
+		}
+		added, count = true, unread(player.Notifications)
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrPlayerNotFound) {
+			log.Printf("cannot notify player %s: %v", id, err)
+		}
+		return
+	}
+	if added {
+		inboxFeed.publish(id, Message{Type: "notification", Notification: &n, Unread: count})
+	}
+}
+
+// notifyYourMove tells the player id of accounts it is their move in game,
+// unless an unread notification already does
+func notifyYourMove(accounts PlayerStore, id, game string) {
+	notify(accounts, id, Notification{Kind: notificationYourMove, Game: game})
+}
+
+// markRead marks those of ids in the inbox of the player id read, all of
+// them if there are none, returning the inbox
+func markRead(id string, ids []string) (inbox, error) {
+	var marked inbox
+	err := players.Update(id, func(player *Player) error {
+		for i, n := range player.Notifications {
+			if len(ids) == 0 || slices.Contains(ids, n.ID) {
+				player.Notifications[i].Read = true
+			}
+		}
+		marked = newInbox(player.Notifications, false)
+		return nil
+	})
+	if err != nil {
+		return inbox{}, err
+	}
+	inboxFeed.publish(id, Message{Type: "notifications_read", Unread: marked.Unread})
+	return marked, nil
+}
+
+// inbox is what GET /players/{id}/notifications answers, the newest first
+type inbox struct {
+	Unread        int            `json:"unread"`
+	Notifications []Notification `json:"notifications"`
+}
+
+func newInbox(notifications []Notification, unreadOnly bool) inbox {
+	in := inbox{Unread: unread(notifications), Notifications: []Notification{}}
+	for i := len(notifications) - 1; i >= 0; i-- {
+		if !unreadOnly || !notifications[i].Read {
+			in.Notifications = append(in.Notifications, notifications[i])
+		}
+	}
+	return in
+}
+
+// notificationsHandler serves the inbox of the player authenticated, only
+// what they did not read for ?unread=true
+func notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, newInbox(player.Notifications, r.URL.Query().Get("unread") == "true"))
+}
+
+// readNotificationsHandler marks the notifications whose ids are posted
+// read, all of them if none is
+func readNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	var read struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16384)).Decode(&read); err != nil {
+		http.Error(w, "invalid notifications", http.StatusBadRequest)
+		return
+	}
+	marked, err := markRead(player.ID, read.IDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, marked)
+}
+
+// joinInbox has conn, authenticated, follow the inbox of its player: it
+// is sent how many notifications are unread, then every notification as it
+// comes and the unread count as they are read, on any device
+func joinInbox(conn *connection) {
+	if conn.player == "" {
+		closeWithError(conn, ErrInvalidPlayerToken)
+		return
+	}
+	news, cancel := inboxFeed.subscribe(conn.player)
+	player, err := players.Load(conn.player)
+	if err != nil {
+		cancel()
+		closeWithError(conn, ErrInvalidPlayerToken)
+		return
+	}
+	conn.Write(Message{Type: "inbox", Unread: unread(player.Notifications)})
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case message, ok := <-news:
+				if !ok {
+					conn.Close(errSlowClient.Error())
+					return
+				}
+				conn.Write(message)
+			case <-conn.closed:
+				return
+			}
+		}
+	}()
+	go listenOnly(conn)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotifications(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana := Player{ID: "ana", Name: "ana"}
+	startSession(&ana, "test")
+	players.Create(ana)
+
+	follower := newTestPlayer(t)
+	follower.conn.player = ana.ID
+	joinInbox(follower.conn)
+	follower.expect("inbox")
+
+	notify(players, ana.ID, Notification{Kind: notificationBracketStarting, Bracket: "b"})
+	if got := follower.expect("notification"); got.Unread != 1 || got.Notification.Bracket != "b" || got.Notification.ID == "" {
+		t.Errorf("got %+v", got)
+	}
+	// it is only their move once until they read it
+	notifyYourMove(players, ana.ID, "g")
+	follower.expect("notification")
+	notifyYourMove(players, ana.ID, "g")
+
+	request := func(method, path, body string) inbox {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+ana.Token)
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, r)
+		got := inbox{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("got %d: %s", w.Code, w.Body)
+		}
+		return got
+	}
+	got := request("GET", "/players/ana/notifications", "")
+	if got.Unread != 2 || len(got.Notifications) != 2 || got.Notifications[0].Kind != notificationYourMove {
+		t.Errorf("got %+v", got)
+	}
+	read := request("POST", "/players/ana/notifications/read", `{"ids":["`+got.Notifications[1].ID+`"]}`)
+	if read.Unread != 1 || !read.Notifications[1].Read {
+		t.Errorf("got %+v", read)
+	}
+	if got := follower.expect("notifications_read"); got.Unread != 1 {
+		t.Errorf("got %+v", got)
+	}
+	request("POST", "/players/ana/notifications/read", `{}`)
+	follower.expect("notifications_read")
+	if got := request("GET", "/players/ana/notifications?unread=true", ""); got.Unread != 0 || len(got.Notifications) != 0 {
+		t.Errorf("got %+v", got)
+	}
+
+	// an inbox is only followed by its player
+	stranger := newTestPlayer(t)
+	joinInbox(stranger.conn)
+	stranger.expect("error", CodeInvalidPlayerToken)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauthProvider is an identity provider players log in with, through the
+// OAuth 2.0 authorization code flow. The user at userURL is known by the
+// field idField of its JSON and called by nameField
+type oauthProvider struct {
+	authURL, tokenURL, userURL string
+	scope                      string
+	idField, nameField         string
+	clientID, clientSecret     string
+}
+
+// knownProviders are the providers that can be configured
+var knownProviders = map[string]oauthProvider{
+	"google": {
+		authURL:   "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL:  "https://oauth2.googleapis.com/token",
+		userURL:   "https://openidconnect.googleapis.com/v1/userinfo",
+		scope:     "openid profile",
+		idField:   "sub",
+		nameField: "name",
+	},
+	"github": {
+		authURL:   "https://github.com/login/oauth/authorize",
+		tokenURL:  "https://github.com/login/oauth/access_token",
+		userURL:   "https://api.github.com/user",
+		scope:     "read:user",
+		idField:   "id",
+		nameField: "login",
+	},
+	"lichess": {
+		authURL:   "https://lichess.org/oauth",
+		tokenURL:  "https://lichess.org/api/token",
+		userURL:   "https://lichess.org/api/account",
+		idField:   "id",
+		nameField: "username",
+	},
+}
+
+// oauthProviders are those configured, publicURL is where the server is
+// reached, the providers send players back to it
+var (
+	oauthProviders = map[string]oauthProvider{}
+	publicURL      string
+)
+
+// parseOAuthProviders parses a comma separated list of
+// name=clientID:clientSecret of known providers, Lichess needs no secret
+func parseOAuthProviders(s string) (map[string]oauthProvider, error) {
+	providers := map[string]oauthProvider{}
+	for _, spec := range strings.Split(s, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		name, credentials, _ := strings.Cut(strings.TrimSpace(spec), "=")
+		id, secret, _ := strings.Cut(credentials, ":")
+		provider, known := knownProviders[name]
+		if !known {
+			return nil, fmt.Errorf("unknown OAuth provider %q", name)
+		}
+		if id == "" {
+			return nil, fmt.Errorf("invalid OAuth provider %q, expected name=clientID:clientSecret", spec)
+		}
+		provider.clientID, provider.clientSecret = id, secret
+		providers[name] = provider
+	}
+	return providers, nil
+}
+
+// loginTimeout is how long players have to log in with a provider, and
+// maxLogins bounds the logins going on at once
+const (
+	loginTimeout = 10 * time.Minute
+	maxLogins    = 10_000
+)
+
+// login is a player logging in with provider, known by the state sent to
+// it; the code it answers with is only good with verifier. Once logged in,
+// the player is sent to redirect, or linked to the account link if any
+type login struct {
+	provider string
+	verifier string
+	redirect string
+	link     string
+	expires  time.Time
+}
+
+var logins = struct {
+	sync.Mutex
+	pending map[string]login
+}{pending: map[string]login{}}
+
+var oauthClient = &http.Client{Timeout: 10 * time.Second}
+
+var errLoginFailed = errors.New("logging in with the provider failed")
+
+// oauthLoginHandler sends the player to log in with the provider of the
+// path. To add it to an account of theirs instead, they show its token as
+// ?auth=; ?redirect= is the path of this server they are sent back to,
+// with the token of their account in the fragment, or the account is
+// answered as JSON
+func oauthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	provider, ok := oauthProviders[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	attempt := login{provider: name, verifier: newToken(), redirect: r.URL.Query().Get("redirect"), expires: time.Now().Add(loginTimeout)}
+	// only paths of this server, not to send tokens anywhere else
+	if attempt.redirect != "" && (!strings.HasPrefix(attempt.redirect, "/") || strings.HasPrefix(attempt.redirect, "//")) {
+		http.Error(w, "redirect must be a path of this server", http.StatusBadRequest)
+		return
+	}
+	if token := r.URL.Query().Get("auth"); token != "" {
+		player, err := authenticate(token)
+		if err == nil && !allows(player, token, scopeAdmin) {
+			err = ErrMissingScope
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		attempt.link = player.ID
+	}
+	state := newToken()
+	logins.Lock()
+	now := time.Now()
+	for key, pending := range logins.pending {
+		if now.After(pending.expires) {
+			delete(logins.pending, key)
+		}
+	}
+	if len(logins.pending) >= maxLogins {
+		logins.Unlock()
+		http.Error(w, "too many logins, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	logins.pending[state] = attempt
+	logins.Unlock()
+
+	challenge := sha256.Sum256([]byte(attempt.verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.clientID},
+		"redirect_uri":          {callbackURL(name)},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if provider.scope != "" {
+		query.Set("scope", provider.scope)
+	}
+	http.Redirect(w, r, provider.authURL+"?"+query.Encode(), http.StatusFound)
+}
+
+func callbackURL(provider string) string {
+	return strings.TrimSuffix(publicURL, "/") + "/auth/" + provider + "/callback"
+}
+
+// oauthCallbackHandler is where providers send players back, with the
+// code to get who they are with. The account linked to who they are is
+// logged in, or a new one is made for them
+func oauthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	logins.Lock()
+	attempt, ok := logins.pending[r.URL.Query().Get("state")]
+	delete(logins.pending, r.URL.Query().Get("state"))
+	logins.Unlock()
+	if !ok || attempt.provider != name || time.Now().After(attempt.expires) {
+		http.Error(w, "the login expired, try again", http.StatusBadRequest)
+		return
+	}
+	provider := oauthProviders[name]
+	if r.URL.Query().Get("error") != "" || r.URL.Query().Get("code") == "" {
+		http.Error(w, errLoginFailed.Error(), http.StatusForbidden)
+		return
+	}
+	id, displayName, err := provider.identify(r.URL.Query().Get("code"), attempt.verifier, callbackURL(name))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%v: %v", errLoginFailed, err), http.StatusBadGateway)
+		return
+	}
+	player, err := loginIdentity(name+":"+id, displayName, attempt.link)
+	if err == nil {
+		player, err = openSession(player.ID, r)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if attempt.redirect != "" {
+		fragment := url.Values{"player": {player.ID}, "token": {player.Token}}
+		http.Redirect(w, r, attempt.redirect+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+	writeAccount(w, player)
+}
+
+// loginIdentity is the player identity logs in as: the one linked to it,
+// or link, or a new player called name
+func loginIdentity(identity, name, link string) (Player, error) {
+	id, err := players.Linked(identity)
+	if err == nil {
+		return players.Load(id)
+	}
+	if !errors.Is(err, ErrPlayerNotFound) {
+		return Player{}, err
+	}
+	if link != "" {
+		if err := players.Link(identity, link); err != nil {
+			return Player{}, err
+		}
+		var linked Player
+		err := players.Update(link, func(player *Player) error {
+			player.Identities = append(player.Identities, identity)
+			linked = *player
+			return nil
+		})
+		return linked, err
+	}
+	if name = strings.TrimSpace(name); len(name) > maxNameLength {
+		name = strings.ToValidUTF8(name[:maxNameLength], "")
+	}
+	if name == "" {
+		name = "anonymous"
+	}
+	player := newPlayer(name)
+	player.Identities = []string{identity}
+	if err := players.Create(player); err != nil {
+		return Player{}, err
+	}
+	return player, players.Link(identity, player.ID)
+}
+
+// identify exchanges code for an access token, the user of which it
+// returns the ID and name of
+func (provider oauthProvider) identify(code, verifier, redirect string) (string, string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirect},
+		"client_id":     {provider.clientID},
+		"client_secret": {provider.clientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest("POST", provider.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := fetchJSON(req, &token); err != nil {
+		return "", "", err
+	}
+	if token.AccessToken == "" {
+		return "", "", errors.New("no access token")
+	}
+	req, err = http.NewRequest("GET", provider.userURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+	user := map[string]any{}
+	if err := fetchJSON(req, &user); err != nil {
+		return "", "", err
+	}
+	id, ok := user[provider.idField]
+	if !ok || id == nil || fmt.Sprint(id) == "" {
+		return "", "", errors.New("the user has no ID")
+	}
+	name, _ := user[provider.nameField].(string)
+	return fmt.Sprint(id), name, nil
+}
+
+func fetchJSON(req *http.Request, v any) error {
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, 1<<20))
+	// numeric IDs are kept as written, not as floats
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
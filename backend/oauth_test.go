@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOAuthLogin(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	var err error
+	if players, err = newPlayerStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	// the provider checks the code was asked for with the verifier
+	var challenge string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+			if r.FormValue("code") != "good" || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+				http.Error(w, "bad code", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"access_token":"access"}`))
+		case "/user":
+			if r.Header.Get("Authorization") != "Bearer access" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"id":12345678901,"login":"octocat"}`))
+		}
+	}))
+	defer provider.Close()
+	defer func(p map[string]oauthProvider) { oauthProviders = p }(oauthProviders)
+	oauthProviders = map[string]oauthProvider{"github": {
+		authURL: provider.URL + "/authorize", tokenURL: provider.URL + "/token", userURL: provider.URL + "/user",
+		idField: "id", nameField: "login", clientID: "client",
+	}}
+
+	// login logs in as the provider sends the player back with code
+	login := func(query, code string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/auth/github/login?"+query, nil))
+		location, err := url.Parse(w.Header().Get("Location"))
+		if w.Code != http.StatusFound || err != nil || !strings.HasPrefix(location.String(), provider.URL+"/authorize") {
+			t.Fatalf("got %d to %q", w.Code, w.Header().Get("Location"))
+		}
+		challenge = location.Query().Get("code_challenge")
+		back := url.Values{"code": {code}, "state": {location.Query().Get("state")}}
+		w = httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/auth/github/callback?"+back.Encode(), nil))
+		return w
+	}
+	w := login("", "good")
+	first := Player{}
+	json.Unmarshal(w.Body.Bytes(), &first)
+	if w.Code != http.StatusOK || first.Name != "octocat" || first.Token == "" {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	w = login("redirect=/play", "good")
+	fragment, _ := url.ParseQuery(strings.TrimPrefix(w.Header().Get("Location"), "/play#"))
+	if w.Code != http.StatusFound || fragment.Get("player") != first.ID || fragment.Get("token") == first.Token {
+		t.Fatalf("got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := login("", "bad"); w.Code != http.StatusBadGateway {
+		t.Errorf("got %d for a bad code", w.Code)
+	}
+
+	// the identity of somebody else is linked to their own account
+	other := newPlayer("ana")
+	players.Create(other)
+	players.Link("github:1", other.ID)
+	if _, err := loginIdentity("github:1", "ana", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := loginIdentity("lichess:ana", "", other.ID); got.ID != other.ID {
+		t.Errorf("linked to %+v", got)
+	}
+	w = httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/auth/github/login?redirect=https://evil.example", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d redirecting elsewhere", w.Code)
+	}
+}
+
+func TestParseOAuthProviders(t *testing.T) {
+	providers, err := parseOAuthProviders("github=id:secret, lichess=id")
+	if err != nil || providers["github"].clientSecret != "secret" || providers["lichess"].clientID != "id" {
+		t.Fatalf("got %+v, %v", providers, err)
+	}
+	for _, invalid := range []string{"facebook=id:secret", "github"} {
+		if _, err := parseOAuthProviders(invalid); err == nil {
+			t.Errorf("parsed %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// offersEvery is how many moves a player waits between two draw offers,
+// or two offers to pause, for them not to harass their opponent with;
+// unlimited if 0
+var offersEvery = 5
+
+// refuseOffer is the error the player of color offering again in state is
+// refused with, nil if they may offer: not once their opponent refused
+// their offers, nor before offersEvery moves went by since the last they
+// made, at the plies of last
+func refuseOffer(state GameState, color string, last map[string]int) *Message {
+	if slices.Contains(state.OffersRefused, opponent(color)) {
+		refused := errorMessage(CodeOffersRefused)
+		return &refused
+	}
+	ply, offered := last[color]
+	if !offered || offersEvery == 0 {
+		return nil
+	}
+	if left := offersEvery - (len(state.Moves)-ply)/2; left > 0 {
+		refused := errorMessage(CodeOfferTooSoon, strconv.Itoa(left))
+		return &refused
+	}
+	return nil
+}
+
+// offeredAt is plies with that of the offer of color at ply, plies are
+// shared by the copies of a state so they are never changed in place
+func offeredAt(plies map[string]int, color string, ply int) map[string]int {
+	plies = maps.Clone(plies)
+	if plies == nil {
+		plies = map[string]int{}
+	}
+	plies[color] = ply
+	return plies
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestOffersAreThrottled(t *testing.T) {
+	defer func(n int) { offersEvery = n }(offersEvery)
+	offersEvery = 2
+	game, white, black := startTestGame(t)
+
+	white.send(Message{Type: "draw_offer"})
+	black.expect("draw_offer")
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.send(move("2", "e7", "e5"))
+	white.expect("move")
+	white.send(Message{Type: "draw_offer"})
+	if got := white.expect("error"); got.Code != CodeOfferTooSoon || len(got.Args) != 1 || got.Args[0] != "1" {
+		t.Fatalf("got %+v offering again", got)
+	}
+	// offering to pause is counted apart
+	white.send(Message{Type: "pause_offer"})
+	black.expect("pause_offer")
+	white.send(move("3", "g1", "f3"))
+	black.expect("move")
+	black.send(move("4", "b8", "c6"))
+	white.expect("move")
+	white.send(Message{Type: "draw_offer"})
+	black.expect("draw_offer")
+
+	black.send(Message{Type: "refuse_offers"})
+	if got := white.expect("offers_refused"); got.Color != "black" {
+		t.Fatalf("got %+v", got)
+	}
+	if state := game.recorder.State(); state.DrawOffer != "" || len(state.OffersRefused) != 1 {
+		t.Fatalf("got %+v once refused", state)
+	}
+	for _, offer := range []string{"draw_offer", "pause_offer"} {
+		white.send(Message{Type: offer})
+		if got := white.expect("error"); got.Code != CodeOffersRefused {
+			t.Errorf("got %+v for a %s", got, offer)
+		}
+	}
+	// black may still offer, and white accept
+	black.send(Message{Type: "draw_offer"})
+	white.expect("draw_offer")
+	white.send(Message{Type: "draw_offer"})
+	if got := black.expect("game_over"); got.Reason != "agreement" {
+		t.Errorf("got %+v", got)
+	}
+}
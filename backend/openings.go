@@ -0,0 +1,97 @@
+package main
+
+import "strings"
+
+// opening is a named opening by its ECO code, reached by playing Moves, in
+// UCI notation and separated by spaces, from the starting position
+type opening struct {
+	ECO   string `json:"eco"`
+	Name  string `json:"name"`
+	Moves string `json:"-"`
+}
+
+// uncommonOpening names the games that start with none of openings
+var uncommonOpening = opening{ECO: "A00", Name: "Uncommon Opening"}
+
+// openings are the most played, a game is of the one with the most of
+// its first moves in common with it
+var openings = []opening{
+	{"B00", "King's Pawn Opening", "e2e4"},
+	{"B01", "Scandinavian Defense", "e2e4 d7d5"},
+	{"B02", "Alekhine's Defense", "e2e4 g8f6"},
+	{"B06", "Modern Defense", "e2e4 g7g6"},
+	{"B07", "Pirc Defense", "e2e4 d7d6 d2d4 g8f6"},
+	{"B10", "Caro-Kann Defense", "e2e4 c7c6"},
+	{"B20", "Sicilian Defense", "e2e4 c7c5"},
+	{"B22", "Sicilian Defense: Alapin Variation", "e2e4 c7c5 c2c3"},
+	{"B23", "Sicilian Defense: Closed", "e2e4 c7c5 b1c3"},
+	{"B27", "Sicilian Defense", "e2e4 c7c5 g1f3"},
+	{"B30", "Sicilian Defense: Old Sicilian", "e2e4 c7c5 g1f3 b8c6"},
+	{"B40", "Sicilian Defense: French Variation", "e2e4 c7c5 g1f3 e7e6"},
+	{"B50", "Sicilian Defense: Modern Variations", "e2e4 c7c5 g1f3 d7d6"},
+	{"B90", "Sicilian Defense: Najdorf Variation", "e2e4 c7c5 g1f3 d7d6 d2d4 c5d4 f3d4 g8f6 b1c3 a7a6"},
+	{"C00", "French Defense", "e2e4 e7e6"},
+	{"C02", "French Defense: Advance Variation", "e2e4 e7e6 d2d4 d7d5 e4e5"},
+	{"C20", "King's Pawn Game", "e2e4 e7e5"},
+	{"C23", "Bishop's Opening", "e2e4 e7e5 f1c4"},
+	{"C25", "Vienna Game", "e2e4 e7e5 b1c3"},
+	{"C30", "King's Gambit", "e2e4 e7e5 f2f4"},
+	{"C40", "King's Knight Opening", "e2e4 e7e5 g1f3"},
+	{"C41", "Philidor Defense", "e2e4 e7e5 g1f3 d7d6"},
+	{"C42", "Petrov's Defense", "e2e4 e7e5 g1f3 g8f6"},
+	{"C44", "King's Knight Opening: Normal Variation", "e2e4 e7e5 g1f3 b8c6"},
+	{"C45", "Scotch Game", "e2e4 e7e5 g1f3 b8c6 d2d4"},
+	{"C47", "Four Knights Game", "e2e4 e7e5 g1f3 b8c6 b1c3 g8f6"},
+	{"C50", "Italian Game", "e2e4 e7e5 g1f3 b8c6 f1c4"},
+	{"C51", "Italian Game: Evans Gambit", "e2e4 e7e5 g1f3 b8c6 f1c4 f8c5 b2b4"},
+	{"C53", "Italian Game: Giuoco Piano", "e2e4 e7e5 g1f3 b8c6 f1c4 f8c5"},
+	{"C55", "Italian Game: Two Knights Defense", "e2e4 e7e5 g1f3 b8c6 f1c4 g8f6"},
+	{"C60", "Ruy Lopez", "e2e4 e7e5 g1f3 b8c6 f1b5"},
+	{"C65", "Ruy Lopez: Berlin Defense", "e2e4 e7e5 g1f3 b8c6 f1b5 g8f6"},
+	{"C68", "Ruy Lopez: Exchange Variation", "e2e4 e7e5 g1f3 b8c6 f1b5 a7a6 b5c6"},
+	{"C70", "Ruy Lopez: Morphy Defense", "e2e4 e7e5 g1f3 b8c6 f1b5 a7a6"},
+	{"A40", "Queen's Pawn Game", "d2d4"},
+	{"D00", "Queen's Pawn Game", "d2d4 d7d5"},
+	{"D02", "Queen's Pawn Game: London System", "d2d4 d7d5 c1f4"},
+	{"D06", "Queen's Gambit", "d2d4 d7d5 c2c4"},
+	{"D10", "Slav Defense", "d2d4 d7d5 c2c4 c7c6"},
+	{"D20", "Queen's Gambit Accepted", "d2d4 d7d5 c2c4 d5c4"},
+	{"D30", "Queen's Gambit Declined", "d2d4 d7d5 c2c4 e7e6"},
+	{"A45", "Indian Defense", "d2d4 g8f6"},
+	{"A56", "Benoni Defense", "d2d4 g8f6 c2c4 c7c5"},
+	{"A57", "Benko Gambit", "d2d4 g8f6 c2c4 c7c5 d4d5 b7b5"},
+	{"E00", "Catalan Opening", "d2d4 g8f6 c2c4 e7e6 g2g3"},
+	{"E12", "Queen's Indian Defense", "d2d4 g8f6 c2c4 e7e6 g1f3 b7b6"},
+	{"E20", "Nimzo-Indian Defense", "d2d4 g8f6 c2c4 e7e6 b1c3 f8b4"},
+	{"E60", "King's Indian Defense", "d2d4 g8f6 c2c4 g7g6"},
+	{"D80", "Grünfeld Defense", "d2d4 g8f6 c2c4 g7g6 b1c3 d7d5"},
+	{"A80", "Dutch Defense", "d2d4 f7f5"},
+	{"A10", "English Opening", "c2c4"},
+	{"A04", "Zukertort Opening", "g1f3"},
+	{"A09", "Réti Opening", "g1f3 d7d5 c2c4"},
+	{"A02", "Bird's Opening", "f2f4"},
+	{"A01", "Nimzo-Larsen Attack", "b2b3"},
+}
+
+// classifyOpening is the opening of a game of standard chess played from
+// the starting position with moves, in UCI notation
+func classifyOpening(moves []string) opening {
+	best, longest := uncommonOpening, 0
+	for _, o := range openings {
+		line := strings.Fields(o.Moves)
+		if len(line) <= longest || len(line) > len(moves) {
+			continue
+		}
+		matches := true
+		for i, move := range line {
+			if moves[i] != move {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			best, longest = o, len(line)
+		}
+	}
+	return best
+}
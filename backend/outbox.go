@@ -0,0 +1,105 @@
+package main
+
+import "time"
+
+// maxUnacked bounds how many unacknowledged messages are kept for retransmission
+const maxUnacked = 256
+
+// outbox numbers every message sent to a player and keeps the ones not yet
+// acknowledged, so the client can detect gaps and ask for them again.
+// It outlives the player's connections: while conn is nil messages are only kept
+// and a reconnecting client is sent the ones it missed.
+type outbox struct {
+	conn *connection
+	// version is the protocol version of the last connection attached
+	version int
+	seq     int
+	unacked []Message
+}
+
+func newOutbox(conn *connection) *outbox {
+	return &outbox{conn: conn, version: protocolVersion}
+}
+
+func (box *outbox) Attach(conn *connection) {
+	box.conn = conn
+	if conn != nil {
+		box.version = conn.version
+	}
+}
+
+func (box *outbox) Send(message Message) error {
+	box.seq++
+	message.Seq = box.seq
+	message.ServerTime = time.Now().UnixMilli()
+	if len(box.unacked) == maxUnacked {
+		box.unacked = box.unacked[1:]
+	}
+	box.unacked = append(box.unacked, message)
+	if box.conn == nil {
+		return nil
+	}
+	return box.conn.Write(message)
+}
+
+// Ack forgets every message up to seq
+func (box *outbox) Ack(seq int) {
+	i := 0
+	for i < len(box.unacked) && box.unacked[i].Seq <= seq {
+		i++
+	}
+	box.unacked = box.unacked[i:]
+}
+
+// Covers reports whether every message after seq is still kept
+func (box *outbox) Covers(seq int) bool {
+	if seq < 0 || seq > box.seq {
+		return false
+	}
+	return seq == box.seq || len(box.unacked) > 0 && box.unacked[0].Seq <= seq+1
+}
+
+// Resend sends again every unacknowledged message after seq
+func (box *outbox) Resend(seq int) error {
+	if box.conn == nil {
+		return nil
+	}
+	for _, message := range box.unacked {
+		if message.Seq > seq {
+			if err := box.conn.Write(message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SendTransient sends a message that is neither numbered nor kept,
+// only meaningful to the connection it is sent on
+func (box *outbox) SendTransient(message Message) error {
+	if box.conn == nil {
+		return nil
+	}
+	message.ServerTime = time.Now().UnixMilli()
+	return box.conn.Write(message)
+}
+
+// handleConnectionMessage processes the messages about the connection itself
+// rather than the game, reporting whether message was one of them
+func handleConnectionMessage(box *outbox, message Message) bool {
+	switch message.Type {
+	case "ack":
+		box.Ack(message.Seq)
+	case "resend":
+		box.Resend(message.Seq)
+	case "clock_sync":
+		// echoing the client time lets the client measure the round trip
+		// and estimate its offset from the server clock
+		box.SendTransient(Message{Type: "clock_sync", ClientTime: message.ClientTime})
+	case "validate_fen":
+		box.SendTransient(validateFENMessage(message.FEN))
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,649 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrPlayerNotFound     = errors.New("player not found")
+	ErrInvalidPlayerToken = errors.New("invalid player token")
+)
+
+// the longest a display name and a bio can be, and how many games a
+// profile lists as recent
+const (
+	maxNameLength = 40
+	maxBioLength  = 500
+	recentGames   = 10
+)
+
+// the rating players start at, and how much a game can change it
+const (
+	initialRating = 1500
+	ratingK       = 32
+)
+
+// Player is an account games are played with. Its token authenticates it,
+// as ?auth= when connecting or as a bearer token over HTTP
+type Player struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Bio       string    `json:"bio,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Token is that of the session just started, see startSession, and
+	// never stored
+	Token string `json:"token,omitempty"`
+	// Email is where the password of the player, a bcrypt hash, can be
+	// reset; Verification and Reset are the tokens of the links sent to it
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"emailVerified,omitempty"`
+	Password      string    `json:"password,omitempty"`
+	Verification  string    `json:"verification,omitempty"`
+	Reset         string    `json:"reset,omitempty"`
+	ResetExpires  time.Time `json:"resetExpires,omitempty"`
+	// Ratings are by pool, see ratingPool
+	Ratings map[string]Rating `json:"ratings"`
+	// Games are those the player finished, in the order they ended
+	Games       []PlayerGame `json:"games"`
+	Preferences Preferences  `json:"preferences"`
+	Sessions    []Session    `json:"sessions,omitempty"`
+	// AccessTokens are those the player created for their scripts and bots
+	AccessTokens []AccessToken `json:"accessTokens,omitempty"`
+	Library      Library       `json:"library"`
+	// Webhooks are where the events of the player are posted to
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+	// Identities are those linked to the player, see PlayerStore.Link
+	Identities []string `json:"identities,omitempty"`
+	// Muted are the accounts whose comments and kibitz the player is not
+	// shown, see muteHandler
+	Muted []string `json:"muted,omitempty"`
+	// Trophies are those awarded to the player, in the order they were
+	Trophies []Trophy `json:"trophies,omitempty"`
+	// Achievements are those unlocked by the player, in the order they were
+	Achievements []Achievement `json:"achievements,omitempty"`
+	Activity     Activity      `json:"activity,omitempty"`
+	// Notifications are the inbox of the player, the oldest first, see
+	// notify
+	Notifications []Notification `json:"notifications,omitempty"`
+	// Deleted players are kept with nothing but their ID, for the games
+	// they played not to refer to a player missing
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+type Rating struct {
+	Rating int `json:"rating"`
+	Games  int `json:"games"`
+}
+
+// PlayerGame is a game as a player finished it: Result is win, loss or
+// draw, Opponent the account of the other player if they had one
+type PlayerGame struct {
+	ID       string    `json:"id"`
+	Color    string    `json:"color"`
+	Result   string    `json:"result"`
+	Opponent string    `json:"opponent,omitempty"`
+	Pool     string    `json:"pool"`
+	Rated    bool      `json:"rated"`
+	EndedAt  time.Time `json:"endedAt"`
+}
+
+type PlayerStore interface {
+	Create(player Player) error
+	Load(id string) (Player, error)
+	// Update saves the player id as change leaves it, unless change fails
+	Update(id string, change func(*Player) error) error
+	// Link makes identity, an account elsewhere as in github:1234, log in
+	// as the player id; Linked is the player identity is linked to
+	Link(identity, id string) error
+	Linked(identity string) (string, error)
+	Unlink(identity string) error
+}
+
+var players PlayerStore = newMemoryPlayerStore()
+
+func newPlayerStore(dataDir string) (PlayerStore, error) {
+	if dataDir == "" {
+		return newMemoryPlayerStore(), nil
+	}
+	return newFilePlayerStore(filepath.Join(dataDir, "players"))
+}
+
+// memoryPlayerStore keeps players encoded, for those loaded not to share
+// anything with those stored
+type memoryPlayerStore struct {
+	mu         sync.Mutex
+	players    map[string][]byte
+	identities map[string]string
+}
+
+func newMemoryPlayerStore() *memoryPlayerStore {
+	return &memoryPlayerStore{players: map[string][]byte{}, identities: map[string]string{}}
+}
+
+// encodePlayer encodes player to be stored, without its token
+func encodePlayer(player Player) ([]byte, error) {
+	player.Token = ""
+	return json.Marshal(player)
+}
+
+func (s *memoryPlayerStore) Create(player Player) error {
+	data, err := encodePlayer(player)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.players[player.ID] = data
+	return nil
+}
+
+func (s *memoryPlayerStore) Load(id string) (Player, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+func (s *memoryPlayerStore) load(id string) (Player, error) {
+	data, ok := s.players[id]
+	if !ok {
+		return Player{}, ErrPlayerNotFound
+	}
+	player := Player{}
+	err := json.Unmarshal(data, &player)
+	return player, err
+}
+
+func (s *memoryPlayerStore) Update(id string, change func(*Player) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	player, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	if err := change(&player); err != nil {
+		return err
+	}
+	data, err := encodePlayer(player)
+	if err != nil {
+		return err
+	}
+	s.players[id] = data
+	return nil
+}
+
+func (s *memoryPlayerStore) Link(identity, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identities[identity] = id
+	return nil
+}
+
+func (s *memoryPlayerStore) Unlink(identity string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.identities, identity)
+	return nil
+}
+
+func (s *memoryPlayerStore) Linked(identity string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.identities[identity]
+	if !ok {
+		return "", ErrPlayerNotFound
+	}
+	return id, nil
+}
+
+// filePlayerStore keeps one JSON file per player, replaced as a whole, and
+// the player of every identity in a file named after its hash
+type filePlayerStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newFilePlayerStore(dir string) (*filePlayerStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "identities"), 0o755); err != nil {
+		return nil, err
+	}
+	return &filePlayerStore{dir: dir}, nil
+}
+
+func (s *filePlayerStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *filePlayerStore) Create(player Player) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(player)
+}
+
+// save writes player to a file of its own first, for a crash not to leave
+// half of it; s.mu must be held
+func (s *filePlayerStore) save(player Player) error {
+	data, err := encodePlayer(player)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(player.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(player.ID))
+}
+
+func (s *filePlayerStore) Load(id string) (Player, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+func (s *filePlayerStore) load(id string) (Player, error) {
+	if filepath.Base(id) != id {
+		return Player{}, ErrPlayerNotFound
+	}
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Player{}, ErrPlayerNotFound
+	}
+	if err != nil {
+		return Player{}, err
+	}
+	player := Player{}
+	err = json.Unmarshal(data, &player)
+	return player, err
+}
+
+func (s *filePlayerStore) Update(id string, change func(*Player) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	player, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	if err := change(&player); err != nil {
+		return err
+	}
+	return s.save(player)
+}
+
+func (s *filePlayerStore) identityPath(identity string) string {
+	sum := sha256.Sum256([]byte(identity))
+	return filepath.Join(s.dir, "identities", hex.EncodeToString(sum[:]))
+}
+
+func (s *filePlayerStore) Link(identity, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp := s.identityPath(identity) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(id), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.identityPath(identity))
+}
+
+func (s *filePlayerStore) Linked(identity string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := os.ReadFile(s.identityPath(identity))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrPlayerNotFound
+	}
+	return string(id), err
+}
+
+func (s *filePlayerStore) Unlink(identity string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.identityPath(identity)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// newPlayerToken is a token of the player id, the id comes first for the
+// player to be found without looking through them all
+func newPlayerToken(id string) string {
+	return id + "." + newToken()
+}
+
+// authenticate finds the player token belongs to, if its session was not
+// revoked; access tokens authenticate too, until they expire
+func authenticate(token string) (Player, error) {
+	id, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return Player{}, ErrInvalidPlayerToken
+	}
+	player, err := players.Load(id)
+	if errors.Is(err, ErrPlayerNotFound) || err == nil && session(player, token) < 0 && accessToken(player, token) < 0 {
+		return Player{}, ErrInvalidPlayerToken
+	}
+	return player, err
+}
+
+// requestPlayer is the player authenticated by the bearer token of r
+func requestPlayer(r *http.Request) (Player, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Player{}, ErrInvalidPlayerToken
+	}
+	return authenticate(token)
+}
+
+// online counts the open connections of every player connected
+var online = struct {
+	sync.Mutex
+	connections map[string]int
+}{connections: map[string]int{}}
+
+// goOnline counts conn as a connection of player until it is closed
+func goOnline(conn *connection, player string) {
+	conn.player = player
+	online.Lock()
+	if online.connections[player]++; online.connections[player] == 1 {
+		cache.Delete("profile:" + player)
+	}
+	online.Unlock()
+	bus.publish(busEvent{Type: busUserConnected, Player: player})
+	go func() {
+		<-conn.closed
+		online.Lock()
+		defer online.Unlock()
+		if online.connections[player]--; online.connections[player] == 0 {
+			delete(online.connections, player)
+			cache.Delete("profile:" + player)
+		}
+	}()
+}
+
+func isOnline(player string) bool {
+	online.Lock()
+	defer online.Unlock()
+	return online.connections[player] > 0
+}
+
+// ratingPool is the pool the games of state are rated in: their variant,
+// or for standard chess bullet, blitz, rapid or classical by how long a
+// game of 40 moves lasts, and correspondence for untimed games
+func ratingPool(state GameState) string {
+	if state.Variant != "" {
+		return state.Variant
+	}
+	tc := state.TimeControl
+	if tc == nil {
+		return "correspondence"
+	}
+	switch estimated := time.Duration(tc.InitialMs+40*tc.IncrementMs) * time.Millisecond; {
+	case estimated < 3*time.Minute:
+		return "bullet"
+	case estimated < 8*time.Minute:
+		return "blitz"
+	case estimated < 25*time.Minute:
+		return "rapid"
+	default:
+		return "classical"
+	}
+}
+
+// isRated tells whether the result of state changes the ratings of its
+// players: both have to have accounts, and neither asked for a casual game
+func isRated(state GameState) bool {
+	white, black := state.Players["white"], state.Players["black"]
+	return !state.Casual && white != "" && black != "" && white != black
+}
+
+func init() {
+	bus.subscribe(busGameFinished, func(event busEvent) { recordPlayerGames(event.State) })
+}
+
+// playerGame is the finished game of state as the player of color sees it
+func playerGame(state GameState, color string, rated bool, endedAt time.Time) PlayerGame {
+	score := map[string]float64{"1-0": 1, "0-1": 0, "1/2-1/2": 0.5}[state.Result]
+	result := map[float64]string{1: "win", 0: "loss", 0.5: "draw"}[score]
+	if color == "black" {
+		result = map[float64]string{1: "loss", 0: "win", 0.5: "draw"}[score]
+	}
+	return PlayerGame{ID: state.ID, Color: color, Result: result, Opponent: state.Players[opponent(color)], Pool: ratingPool(state), Rated: rated, EndedAt: endedAt}
+}
+
+// recordPlayerGames adds a finished game to the games of its players, rates
+// it if it is rated and tells them of the achievements it unlocks
+func recordPlayerGames(state GameState) {
+	if !state.Finished || state.Result == "" || len(state.Players) == 0 {
+		return
+	}
+	pool, now := ratingPool(state), time.Now().UTC()
+	white, black := state.Players["white"], state.Players["black"]
+	score := map[string]float64{"1-0": 1, "0-1": 0, "1/2-1/2": 0.5}[state.Result]
+	rated := isRated(state)
+	var change float64
+	if rated {
+		whiteRating, errWhite := playerRating(white, pool)
+		blackRating, errBlack := playerRating(black, pool)
+		if err := errors.Join(errWhite, errBlack); err != nil {
+			log.Printf("cannot rate game %s: %v", state.ID, err)
+			rated = false
+		}
+		expected := 1 / (1 + math.Pow(10, float64(blackRating-whiteRating)/400))
+		change = ratingK * (score - expected)
+	}
+	for color, id := range state.Players {
+		delta := change
+		if color == "black" {
+			delta = -change
+		}
+		game := playerGame(state, color, rated, now)
+		var unlocked []Achievement
+		err := players.Update(id, func(player *Player) error {
+			if player.Deleted {
+				return nil
+			}
+			player.Games = append(player.Games, game)
+			player.Activity.played(now, player.Preferences.location())
+			unlocked = unlockAchievements(player, state, color, now)
+			if rated {
+				if player.Ratings == nil {
+					player.Ratings = map[string]Rating{}
+				}
+				r, ok := player.Ratings[pool]
+				if !ok {
+					r.Rating = initialRating
+				}
+				r.Rating += int(math.Round(delta))
+				r.Games++
+				player.Ratings[pool] = r
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("cannot record game %s for player %s: %v", state.ID, id, err)
+			continue
+		}
+		for _, a := range unlocked {
+			notifyWebhooks(id, webhookAchievementUnlocked, a)
+			notify(players, id, Notification{Kind: notificationAchievement, Game: a.Game, Achievement: a.ID})
+		}
+	}
+}
+
+func playerRating(id, pool string) (int, error) {
+	player, err := players.Load(id)
+	if err != nil {
+		return 0, err
+	}
+	if r, ok := player.Ratings[pool]; ok {
+		return r.Rating, nil
+	}
+	return initialRating, nil
+}
+
+// profile is a player as anyone sees them
+type profile struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Bio          string            `json:"bio,omitempty"`
+	Country      string            `json:"country,omitempty"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	Online       bool              `json:"online"`
+	Ratings      map[string]Rating `json:"ratings"`
+	Count        gameCount         `json:"count"`
+	Recent       []PlayerGame      `json:"recent"`
+	Trophies     []Trophy          `json:"trophies"`
+	Achievements []Achievement     `json:"achievements"`
+	Streak       streak            `json:"streak"`
+	Deleted      bool              `json:"deleted,omitempty"`
+}
+
+type gameCount struct {
+	All    int `json:"all"`
+	Wins   int `json:"wins"`
+	Draws  int `json:"draws"`
+	Losses int `json:"losses"`
+}
+
+func newProfile(player Player) profile {
+	p := profile{
+		ID:           player.ID,
+		Name:         player.Name,
+		Bio:          player.Bio,
+		Country:      player.Country,
+		CreatedAt:    player.CreatedAt,
+		Online:       isOnline(player.ID),
+		Ratings:      player.Ratings,
+		Trophies:     player.Trophies,
+		Achievements: player.Achievements,
+		Streak:       player.Activity.view(player.Preferences, time.Now()),
+		Deleted:      player.Deleted,
+	}
+	if p.Ratings == nil {
+		p.Ratings = map[string]Rating{}
+	}
+	if p.Trophies == nil {
+		p.Trophies = []Trophy{}
+	}
+	if p.Achievements == nil {
+		p.Achievements = []Achievement{}
+	}
+	p.Count, p.Recent = countGames(player.Games), recent(player.Games)
+	return p
+}
+
+func newPlayer(name string) Player {
+	return Player{ID: newGameID(), Name: name, CreatedAt: time.Now().UTC(), Ratings: map[string]Rating{}, Games: []PlayerGame{}}
+}
+
+// createPlayerHandler creates the player ?name=, answering it with its
+// token, the only way to play as the player
+func createPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" || len(name) > maxNameLength {
+		http.Error(w, "a player is called by a name of up to 40 bytes", http.StatusBadRequest)
+		return
+	}
+	player := newPlayer(name)
+	startSession(&player, r.UserAgent())
+	if err := players.Create(player); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeAccount(w, player)
+}
+
+// playerHandler serves the profile of a player
+func playerHandler(w http.ResponseWriter, r *http.Request) {
+	serveCached(w, r, "profile:"+r.PathValue("id"), func() (any, error) {
+		player, err := players.Load(r.PathValue("id"))
+		if err != nil {
+			return nil, err
+		}
+		return newProfile(player), nil
+	})
+}
+
+// profileChange is what players can edit of their profile, the fields
+// left out stay as they are
+type profileChange struct {
+	Bio     *string `json:"bio"`
+	Country *string `json:"country"`
+}
+
+var errInvalidCountry = errors.New("countries are ISO 3166-1 alpha-2 codes, like ES")
+
+// ownPlayer is the player of the path of r, if r is authenticated as them
+func ownPlayer(w http.ResponseWriter, r *http.Request) (Player, bool) {
+	player, err := requestPlayer(r)
+	if err != nil && !errors.Is(err, ErrInvalidPlayerToken) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return Player{}, false
+	}
+	if err != nil || player.ID != r.PathValue("id") {
+		http.Error(w, "only the player can do that", http.StatusForbidden)
+		return Player{}, false
+	}
+	return player, true
+}
+
+// editPlayerHandler edits the profile of the player authenticated with
+// a profileChange
+func editPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	var change profileChange
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*maxBioLength)).Decode(&change); err != nil {
+		http.Error(w, "invalid profile", http.StatusBadRequest)
+		return
+	}
+	if change.Bio != nil && len(*change.Bio) > maxBioLength {
+		http.Error(w, "a bio has 500 bytes at most", http.StatusBadRequest)
+		return
+	}
+	if change.Country != nil && !validCountry(*change.Country) {
+		http.Error(w, errInvalidCountry.Error(), http.StatusBadRequest)
+		return
+	}
+	err := players.Update(player.ID, func(player *Player) error {
+		if change.Bio != nil {
+			player.Bio = strings.TrimSpace(*change.Bio)
+		}
+		if change.Country != nil {
+			player.Country = strings.ToUpper(*change.Country)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	playerHandler(w, r)
+}
+
+// validCountry accepts the shape of a country code, or none to clear it
+func validCountry(country string) bool {
+	if country == "" {
+		return true
+	}
+	if len(country) != 2 {
+		return false
+	}
+	for _, c := range strings.ToUpper(country) {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPlayerProfile(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	var err error
+	if players, err = newPlayerStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	create := func(name string) Player {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("POST", "/players?name="+name, nil))
+		player := Player{}
+		json.Unmarshal(w.Body.Bytes(), &player)
+		return player
+	}
+	ana, bo := create("ana"), create("bo")
+	if ana.Token == "" || ana.Name != "ana" {
+		t.Fatalf("got %+v", ana)
+	}
+
+	white, black := newTestPlayer(t), newTestPlayer(t)
+	goOnline(white.conn, ana.ID)
+	goOnline(black.conn, bo.ID)
+	for _, player := range []*testPlayer{white, black} {
+		if err := games.Pair(context.Background(), player.conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := white.expect("start"); !got.Rated {
+		t.Errorf("got %+v", got)
+	}
+	black.expect("start")
+	white.send(Message{Type: "resign"})
+	black.expect("game_over")
+
+	get := func(id string) profile {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/"+id, nil))
+		p := profile{}
+		json.Unmarshal(w.Body.Bytes(), &p)
+		return p
+	}
+	waitFor(t, func() bool { return get(bo.ID).Count.All == 1 })
+	p := get(bo.ID)
+	if p.Count.Wins != 1 || p.Ratings["correspondence"] != (Rating{Rating: 1516, Games: 1}) || len(p.Recent) != 1 || p.Recent[0].Opponent != ana.ID {
+		t.Fatalf("got %+v", p)
+	}
+	waitFor(t, func() bool { return !get(ana.ID).Online })
+	if p := get(ana.ID); p.Count.Losses != 1 || p.Ratings["correspondence"].Rating != 1484 {
+		t.Fatalf("got %+v", p)
+	}
+
+	patch := func(id, token, body string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PATCH", "/players/"+id, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		newPublicMux().ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := patch(ana.ID, bo.Token, `{"bio":"mine"}`); code != http.StatusForbidden {
+		t.Errorf("got %d editing somebody else", code)
+	}
+	if code := patch(ana.ID, ana.Token, `{"country":"Spain"}`); code != http.StatusBadRequest {
+		t.Errorf("got %d for a country name", code)
+	}
+	if code := patch(ana.ID, ana.Token, `{"bio":"1. e4!","country":"es"}`); code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+	if p := get(ana.ID); p.Bio != "1. e4!" || p.Country != "ES" || p.Name != "ana" {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestCasualGamesAreNotRated(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana, bo := newPlayer("ana"), newPlayer("bo")
+	players.Create(ana)
+	players.Create(bo)
+	white, black := newTestPlayer(t), newTestPlayer(t)
+	goOnline(white.conn, ana.ID)
+	goOnline(black.conn, bo.ID)
+	black.conn.options.Rated = new(bool)
+	for _, player := range []*testPlayer{white, black} {
+		if err := games.Pair(context.Background(), player.conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var id string
+	for _, player := range []*testPlayer{white, black} {
+		got := player.expect("start")
+		if got.Rated {
+			t.Errorf("got %+v", got)
+		}
+		id = got.GameID
+	}
+	game, _ := games.Find(id)
+	white.send(Message{Type: "resign"})
+	black.expect("game_over")
+	// the game loop is done with the accounts before the store is put back
+	<-game.done
+	waitFor(t, func() bool {
+		player, _ := players.Load(bo.ID)
+		return len(player.Games) == 1
+	})
+	if player, _ := players.Load(bo.ID); len(player.Ratings) != 0 || player.Games[0].Rated {
+		t.Errorf("got %+v", player)
+	}
+}
+
+func TestRatedGamesArePlayedByTheRules(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana, bo := newPlayer("ana"), newPlayer("bo")
+	players.Create(ana)
+	players.Create(bo)
+	white, black := newTestPlayer(t), newTestPlayer(t)
+	goOnline(white.conn, ana.ID)
+	goOnline(black.conn, bo.ID)
+	for _, player := range []*testPlayer{white, black} {
+		if err := games.Pair(context.Background(), player.conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var id string
+	for _, player := range []*testPlayer{white, black} {
+		got := player.expect("start")
+		if !got.Rated {
+			t.Errorf("got %+v", got)
+		}
+		id = got.GameID
+	}
+	game, _ := games.Find(id)
+	white.send(move("0", "e2", "e5"))
+	white.expect("error", CodeIllegalMove)
+	for i, m := range [][2]string{{"f2", "f3"}, {"e7", "e5"}, {"g2", "g4"}, {"d8", "h4"}} {
+		mover, opponent := white, black
+		if i%2 == 1 {
+			mover, opponent = black, white
+		}
+		mover.send(move(strconv.Itoa(i+1), m[0], m[1]))
+		opponent.expect("move")
+	}
+	if got := white.expect("game_over"); got.Result != "0-1" || got.Reason != "checkmate" {
+		t.Fatalf("got %+v", got)
+	}
+	// the ratings are updated by the time the game loop returns
+	<-game.done
+	for id, want := range map[string]Rating{ana.ID: {Rating: 1484, Games: 1}, bo.ID: {Rating: 1516, Games: 1}} {
+		if player, _ := players.Load(id); player.Ratings["correspondence"] != want {
+			t.Errorf("got ratings %+v for %s", player.Ratings, id)
+		}
+	}
+}
+
+func TestInvalidPlayerTokenIsRefused(t *testing.T) {
+	transport := newMemTransport()
+	player := &testPlayer{t: t, transport: transport}
+	_, span := tracer.Start(context.Background(), "test")
+	admit(context.Background(), span, httptest.NewRequest("GET", "/ws?auth=nobody.secret", nil), transport)
+	player.expect("error", CodeInvalidPlayerToken)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// a poll is answered as soon as there are frames or after pollTimeout,
+// which stays below the idle timeouts of common proxies; a session that
+// is not polled for pollIdleTimeout is closed and the player disconnected,
+// it can come back through the resume token like any other client
+const (
+	pollTimeout     = 25 * time.Second
+	pollIdleTimeout = 2 * pollTimeout
+)
+
+// pollConnectHandler opens a long-polling session, it takes the same
+// query parameters as /ws and answers with the session to poll
+func pollConnectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "poll.connect")
+	defer span.End()
+
+	t := newHTTPTransport(true)
+
+	// the game outlives this request
+	admit(context.WithoutCancel(ctx), span, r, t)
+	writeJSON(w, map[string]string{"session": t.id})
+}
+
+// pollHandler answers with the JSON array of the frames queued for the session,
+// waiting up to pollTimeout for one; once the session is closed and drained
+// it answers 410 Gone with the close reason
+func pollHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := findHTTPSession(r.PathValue("session"))
+	if !ok || !t.polling {
+		http.NotFound(w, r)
+		return
+	}
+	// the session is idle from the end of the poll on, not its start
+	httpSessions.Touch(t.id)
+	defer httpSessions.Touch(t.id)
+	keepOpen(w)
+
+	frames := t.pending()
+	if len(frames) == 0 {
+		timer := time.NewTimer(pollTimeout)
+		defer timer.Stop()
+		select {
+		case data := <-t.frames:
+			frames = append([][]byte{data}, t.pending()...)
+		case <-t.done:
+			frames = t.pending()
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if len(frames) == 0 {
+		select {
+		case <-t.done:
+			removeHTTPSession(t)
+			http.Error(w, t.closeReason(), http.StatusGone)
+			return
+		default:
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte("["))
+	w.Write(bytes.Join(frames, []byte(",")))
+	w.Write([]byte("]"))
+}
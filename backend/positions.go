@@ -0,0 +1,75 @@
+package main
+
+import "github.com/alvaronaschez/simple-chess/chess"
+
+// startPosition is the position a game created at fen starts at, the
+// starting position if fen is empty; fen was checked then
+func startPosition(fen string) chess.Position {
+	if fen == "" {
+		return chess.NewPosition()
+	}
+	position, err := chess.ParseFEN(fen)
+	if err != nil {
+		return chess.NewPosition()
+	}
+	return position
+}
+
+// positionAfter plays moves from the position at fen, see startPosition.
+// Moves are relayed without being checked, so it stops at the first one
+// that is not legal, returning how many were played
+func positionAfter(fen string, moves []Move) (chess.Position, int) {
+	position := startPosition(fen)
+	for i, m := range moves {
+		parsed, err := chess.ParseMove(m.UCI())
+		if err != nil || !position.IsLegal(parsed) {
+			return position, i
+		}
+		position = position.Apply(parsed)
+	}
+	return position, len(moves)
+}
+
+// standardMove checks m, played in the game state got to, returning the
+// code to refuse it with, if any, and the status of the position it leads to
+func standardMove(state GameState, m *Move) (string, chess.Status) {
+	position, played := positionAfter(state.FEN, state.Moves)
+	parsed, err := chess.ParseMove(m.UCI())
+	if played < len(state.Moves) || err != nil || !position.IsLegal(parsed) {
+		return CodeIllegalMove, chess.Ongoing
+	}
+	return "", position.Apply(parsed).Status()
+}
+
+// chessColor is color, white or black, as the chess package knows it
+func chessColor(color string) chess.Color {
+	if color == "black" {
+		return chess.Black
+	}
+	return chess.White
+}
+
+// drawClaim checks a draw claimed after moves from fen for reason,
+// threefold_repetition or fifty_moves, or for either if reason is empty,
+// returning what it is granted for
+func drawClaim(fen string, moves []Move, reason string) (string, bool) {
+	position := startPosition(fen)
+	// positions that repeat hash the same
+	seen := map[uint64]int{position.Hash(): 1}
+	for _, m := range moves {
+		parsed, err := chess.ParseMove(m.UCI())
+		if err != nil || !position.IsLegal(parsed) {
+			// a game that strayed from the rules cannot be checked
+			return "", false
+		}
+		position = position.Apply(parsed)
+		seen[position.Hash()]++
+	}
+	if (reason == "" || reason == "threefold_repetition") && seen[position.Hash()] >= 3 {
+		return "threefold_repetition", true
+	}
+	if (reason == "" || reason == "fifty_moves") && position.Halfmoves() >= 100 {
+		return "fifty_moves", true
+	}
+	return "", false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// Preferences are how a player likes to play, loaded when they connect
+// with their token. The server promotes to a queen for those who want it
+// and creates their games with the first of their time controls; clients
+// are told the rest in the start message, to apply on any device
+type Preferences struct {
+	AutoQueen    bool `json:"autoQueen,omitempty"`
+	Premove      bool `json:"premove,omitempty"`
+	ConfirmMoves bool `json:"confirmMoves,omitempty"`
+	// Takebacks are those the player accepts: never, casual, in unrated
+	// games only, or always
+	Takebacks string `json:"takebacks,omitempty" validate:"omitempty,oneof=never casual always"`
+	// TimeControls are the time controls the player prefers, the first
+	// one first, as in 5m+3s
+	TimeControls []string `json:"timeControls,omitempty" validate:"max=8,dive,required"`
+	// TimeZone is where the days of the streaks of the player start, as in
+	// Europe/Madrid, UTC if empty; DailyGoal how many games a day they
+	// mean to play
+	TimeZone  string `json:"timeZone,omitempty"`
+	DailyGoal int    `json:"dailyGoal,omitempty" validate:"min=0,max=50"`
+}
+
+var errInvalidTimeControls = errors.New("time controls are written as in 5m+3s, 8 of them at most")
+
+// timeControlFor is the time control of the games conn creates: the one
+// it asks for, the first one its player prefers, or the server's
+func timeControlFor(conn *connection) *TimeControl {
+	if tc, ok := conn.options.clock(); ok {
+		return tc
+	}
+	if conn.preferences == nil || len(conn.preferences.TimeControls) == 0 {
+		return timeControl
+	}
+	tc, err := parseTimeControl(conn.preferences.TimeControls[0])
+	if err != nil {
+		return timeControl
+	}
+	return tc
+}
+
+// autoQueen promotes the move of m to a queen if it is a pawn reaching
+// the last rank in position without saying what it promotes to
+func autoQueen(position chess.Position, m *Message) {
+	if m.Type != "move" || m.Promotion != "" {
+		return
+	}
+	from, errFrom := chess.ParseSquare(m.From)
+	to, errTo := chess.ParseSquare(m.To)
+	if errFrom != nil || errTo != nil || position.PieceAt(from).Type() != chess.Pawn {
+		return
+	}
+	if to.Rank() == 0 || to.Rank() == 7 {
+		m.Promotion = "q"
+	}
+}
+
+// preferencesHandler serves the preferences of the player authenticated
+func preferencesHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, player.Preferences)
+}
+
+// putPreferencesHandler replaces the preferences of the player
+// authenticated with those posted
+func putPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	var preferences Preferences
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&preferences); err != nil {
+		http.Error(w, "invalid preferences", http.StatusBadRequest)
+		return
+	}
+	if err := validate.Struct(preferences); err != nil {
+		http.Error(w, "invalid preferences: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, tc := range preferences.TimeControls {
+		if _, err := parseTimeControl(tc); err != nil {
+			http.Error(w, errInvalidTimeControls.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := checkTimeZone(preferences.TimeZone); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := players.Update(player.ID, func(player *Player) error {
+		player.Preferences = preferences
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, preferences)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+func TestPreferences(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana := Player{ID: "ana", Name: "ana"}
+	startSession(&ana, "test")
+	players.Create(ana)
+
+	put := func(token, body string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/players/ana/preferences", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		newPublicMux().ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := put("ana.wrong", `{"premove":true}`); code != http.StatusForbidden {
+		t.Errorf("got %d with a wrong token", code)
+	}
+	for _, invalid := range []string{`{"takebacks":"sometimes"}`, `{"timeControls":["soon"]}`, `{"timeZone":"Mars/Olympus"}`, `{"dailyGoal":-1}`} {
+		if code := put(ana.Token, invalid); code != http.StatusBadRequest {
+			t.Errorf("got %d for %s", code, invalid)
+		}
+	}
+	if code := put(ana.Token, `{"autoQueen":true,"premove":true,"takebacks":"casual","timeControls":["3m+2s","10m"]}`); code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+
+	// the first player creates the game with their time control
+	player, _ := players.Load("ana")
+	white, black := newTestPlayer(t), newTestPlayer(t)
+	goOnline(white.conn, player.ID)
+	white.conn.preferences = &player.Preferences
+	if err := games.Pair(context.Background(), white.conn); err != nil {
+		t.Fatal(err)
+	}
+	games.mu.Lock()
+	game := games.seeks[len(games.seeks)-1]
+	games.mu.Unlock()
+	if err := games.Pair(context.Background(), black.conn); err != nil {
+		t.Fatal(err)
+	}
+	if got := white.expect("start"); got.Preferences == nil || !got.Preferences.Premove || got.WhiteTime != 180_000 {
+		t.Fatalf("got %+v", got)
+	}
+	if got := black.expect("start"); got.Preferences != nil {
+		t.Errorf("got %+v for the player without an account", got.Preferences)
+	}
+	if tc := game.recorder.State().TimeControl; tc == nil || tc.IncrementMs != 2000 {
+		t.Errorf("got %+v", tc)
+	}
+}
+
+func TestAutoQueen(t *testing.T) {
+	position, _ := chess.ParseFEN("8/4P1k1/8/8/8/8/8/4K3 w - - 0 1")
+	for _, test := range []struct {
+		move Message
+		want string
+	}{
+		{Message{Type: "move", From: "e7", To: "e8"}, "q"},
+		{Message{Type: "move", From: "e7", To: "e8", Promotion: "n"}, "n"},
+		{Message{Type: "move", From: "e1", To: "e2"}, ""},
+	} {
+		autoQueen(position, &test.move)
+		if test.move.Promotion != test.want {
+			t.Errorf("%s%s promotes to %q", test.move.From, test.move.To, test.move.Promotion)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTimeControlPresets are the presets served unless configured, as
+// parseTimeControlPresets reads them
+const defaultTimeControlPresets = "1+0,2+1,3+0,3+2,5+0,5+3,10+0,10+5,15+10,30+0,30+20"
+
+// timeControlPreset is one of the time controls clients offer to pick at
+// game creation. Name is its usual notation, the minutes and the seconds of
+// increment as in 3+2, which parseTimeControl takes as well; Category is
+// the rating pool of its games
+type timeControlPreset struct {
+	Name        string      `json:"name"`
+	Category    string      `json:"category"`
+	TimeControl TimeControl `json:"timeControl"`
+}
+
+// timeControlPresets are the presets served, in the order configured
+var timeControlPresets, _ = parseTimeControlPresets(defaultTimeControlPresets)
+
+// parseTimeControlPresets parses a comma-separated list of presets in their
+// usual notation, like 3+2 or 0.5+0
+func parseTimeControlPresets(list string) ([]timeControlPreset, error) {
+	var presets []timeControlPreset
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		minutes, seconds, _ := strings.Cut(name, "+")
+		m, err := strconv.ParseFloat(minutes, 64)
+		if err != nil || m <= 0 {
+			return nil, fmt.Errorf("invalid time control preset %q", name)
+		}
+		s := 0
+		if seconds != "" {
+			if s, err = strconv.Atoi(seconds); err != nil || s < 0 {
+				return nil, fmt.Errorf("invalid time control preset %q", name)
+			}
+		}
+		tc := TimeControl{
+			InitialMs:   int64(m * float64(time.Minute.Milliseconds())),
+			IncrementMs: int64(s) * time.Second.Milliseconds(),
+		}
+		presets = append(presets, timeControlPreset{Name: name, Category: ratingPool(GameState{TimeControl: &tc}), TimeControl: tc})
+	}
+	return presets, nil
+}
+
+// presetTimeControl is the time control of the preset named name
+func presetTimeControl(name string) (*TimeControl, bool) {
+	for _, preset := range timeControlPresets {
+		if preset.Name == name {
+			tc := preset.TimeControl
+			return &tc, true
+		}
+	}
+	return nil, false
+}
+
+// timeControlPresetsHandler serves the presets, those of the rating pool
+// ?category= names if any
+func timeControlPresetsHandler(w http.ResponseWriter, r *http.Request) {
+	category := r.URL.Query().Get("category")
+	list := []timeControlPreset{}
+	for _, preset := range timeControlPresets {
+		if category == "" || preset.Category == category {
+			list = append(list, preset)
+		}
+	}
+	writeJSON(w, list)
+}
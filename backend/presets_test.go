@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTimeControlPresets(t *testing.T) {
+	presets, err := parseTimeControlPresets("0.5+0, 3+2,10+0,30+20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []timeControlPreset{
+		{"0.5+0", "bullet", TimeControl{InitialMs: 30000}},
+		{"3+2", "blitz", TimeControl{180000, 2000}},
+		{"10+0", "rapid", TimeControl{InitialMs: 600000}},
+		{"30+20", "classical", TimeControl{1800000, 20000}},
+	}
+	if len(presets) != len(want) {
+		t.Fatalf("got %+v", presets)
+	}
+	for i := range want {
+		if presets[i] != want[i] {
+			t.Errorf("got %+v, want %+v", presets[i], want[i])
+		}
+	}
+	for _, invalid := range []string{"0+2", "3+-1", "a+b", "3m+2s"} {
+		if _, err := parseTimeControlPresets(invalid); err == nil {
+			t.Errorf("parsed %q", invalid)
+		}
+	}
+}
+
+func TestTimeControlPresets(t *testing.T) {
+	w := httptest.NewRecorder()
+	timeControlPresetsHandler(w, httptest.NewRequest("GET", "/time-controls?category=blitz", nil))
+	var got []timeControlPreset
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 || got[0].Name != "3+0" || got[1].Name != "3+2" {
+		t.Fatalf("got %+v", got)
+	}
+
+	// presets are taken wherever time controls are, matching seeks asking
+	// for the same written otherwise
+	if tc, err := parseTimeControl("3+2"); err != nil || *tc != (TimeControl{180000, 2000}) {
+		t.Fatalf("got %+v, %v", tc, err)
+	}
+	white, black := newTestPlayer(t), newTestPlayer(t)
+	white.conn.options = GameOptions{TimeControl: "3+2"}
+	black.conn.options = GameOptions{TimeControl: "3m+2s"}
+	for _, player := range []*testPlayer{white, black} {
+		if err := games.Pair(context.Background(), player.conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	white.expect("start")
+	black.expect("start")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const protocolVersion = 1
+
+// supportedProtocolVersions lists every version of the message schema
+// the server still speaks, oldest first
+var supportedProtocolVersions = []int{1}
+
+var ErrUnsupportedProtocolVersion = errors.New("unsupported protocol version")
+
+// parseProtocolVersion reads the version requested in the upgrade query,
+// clients that do not send one are assumed to speak version 1
+func parseProtocolVersion(value string) (int, error) {
+	if value == "" {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || !slices.Contains(supportedProtocolVersions, version) {
+		return 0, ErrUnsupportedProtocolVersion
+	}
+	return version, nil
+}
+
+// subprotocolEncodings are the encodings of the messages by the name they
+// go by in subprotocols
+var subprotocolEncodings = map[string]string{"json": "json", "proto": "protobuf"}
+
+// subprotocols are the WebSocket subprotocols the server speaks, one for
+// each version and encoding, chess.v1.json or chess.v1.proto say, newest
+// first. Clients listing them in Sec-WebSocket-Protocol get the first of
+// theirs the server speaks, and then ?v= and ?encoding= do not apply
+func subprotocols() []string {
+	var names []string
+	for i := len(supportedProtocolVersions) - 1; i >= 0; i-- {
+		version := supportedProtocolVersions[i]
+		for _, flavor := range []string{"json", "proto"} {
+			names = append(names, fmt.Sprintf("chess.v%d.%s", version, flavor))
+		}
+	}
+	return names
+}
+
+// parseSubprotocol is the version and encoding of the subprotocol name,
+// as ?v= and ?encoding= ask for them
+func parseSubprotocol(name string) (version, encoding string) {
+	name = strings.TrimPrefix(name, "chess.v")
+	version, flavor, _ := strings.Cut(name, ".")
+	return version, subprotocolEncodings[flavor]
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestParseSubprotocol(t *testing.T) {
+	if got := subprotocols(); !slices.Equal(got, []string{"chess.v1.json", "chess.v1.proto"}) {
+		t.Errorf("got %v", got)
+	}
+	for name, want := range map[string][2]string{
+		"chess.v1.json":  {"1", "json"},
+		"chess.v1.proto": {"1", "protobuf"},
+		"chess.v2.proto": {"2", "protobuf"},
+	} {
+		if version, encoding := parseSubprotocol(name); version != want[0] || encoding != want[1] {
+			t.Errorf("%s: got %s %s", name, version, encoding)
+		}
+	}
+}
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	server := httptest.NewServer(newPublicMux())
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?lobby=true&encoding=json"
+
+	// the first the client lists that the server speaks is agreed, and
+	// overrides the query
+	dialer := websocket.Dialer{Subprotocols: []string{"chess.v2.proto", "chess.v1.proto", "chess.v1.json"}}
+	ws, resp, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if ws.Subprotocol() != "chess.v1.proto" {
+		t.Fatalf("got %q agreed", resp.Header.Get("Sec-WebSocket-Protocol"))
+	}
+	frameType, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message, err := (protobufCodec{}).Decode(data); frameType != websocket.BinaryMessage || err != nil || message.Type != "lobby" {
+		t.Fatalf("got %v %+v %v", frameType, message, err)
+	}
+
+	// clients listing none are answered as the query asks
+	plain, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if frameType, _, err := plain.ReadMessage(); frameType != websocket.TextMessage || err != nil {
+		t.Fatalf("got %v %v", frameType, err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	var err error
+	if trustedProxies, err = parseTrustedProxies("10.0.0.0/8, 192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { trustedProxies = nil }()
+
+	for _, c := range []struct {
+		remote, forwarded, realIP, want string
+	}{
+		{"198.51.100.7:1234", "", "", "198.51.100.7"},
+		// only trusted proxies are believed
+		{"198.51.100.7:1234", "203.0.113.9", "203.0.113.9", "198.51.100.7"},
+		{"10.1.2.3:1234", "203.0.113.9", "", "203.0.113.9"},
+		{"192.0.2.1:1234", "", "203.0.113.9", "203.0.113.9"},
+		// what the client claimed before the first trusted hop is ignored
+		{"10.1.2.3:1234", "6.6.6.6, 203.0.113.9, 10.4.5.6", "", "203.0.113.9"},
+		{"10.1.2.3:1234", "junk, 10.4.5.6", "", "10.4.5.6"},
+		{"@", "203.0.113.9", "", "203.0.113.9"},
+	} {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if c.realIP != "" {
+			r.Header.Set("X-Real-IP", c.realIP)
+		}
+		if got := clientIP(r); got != c.want {
+			t.Errorf("%+v: got %s", c, got)
+		}
+	}
+}
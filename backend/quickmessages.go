@@ -0,0 +1,55 @@
+package main
+
+import "net/http"
+
+// QuickMessage is one of the messages players send their opponents during
+// a game, as its code: clients expand it with the catalog of
+// quickMessagesHandler, the server only relays it
+type QuickMessage int
+
+const (
+	QuickGoodLuck QuickMessage = iota + 1
+	QuickGoodGame
+	QuickNiceMove
+	QuickWellPlayed
+	QuickThanks
+	QuickOops
+	QuickSmile
+	QuickThumbsUp
+	QuickSurprised
+	QuickThinking
+)
+
+// quickMessageKeys are the catalog keys of the quick messages, by code;
+// the validation of Message.Quick is up to the last of them
+var quickMessageKeys = map[QuickMessage]string{
+	QuickGoodLuck:   "quick.good_luck",
+	QuickGoodGame:   "quick.good_game",
+	QuickNiceMove:   "quick.nice_move",
+	QuickWellPlayed: "quick.well_played",
+	QuickThanks:     "quick.thanks",
+	QuickOops:       "quick.oops",
+	QuickSmile:      "quick.smile",
+	QuickThumbsUp:   "quick.thumbs_up",
+	QuickSurprised:  "quick.surprised",
+	QuickThinking:   "quick.thinking",
+}
+
+// quickMessageEntry is a quick message as clients expand it
+type quickMessageEntry struct {
+	Code QuickMessage `json:"code"`
+	Key  string       `json:"key"`
+	Text string       `json:"text"`
+}
+
+// quickMessagesHandler serves the quick messages in the order of their
+// codes, in the language of ?lang= or Accept-Language
+func quickMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	lang := negotiateLanguage(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+	list := make([]quickMessageEntry, 0, len(quickMessageKeys))
+	for code := QuickGoodLuck; code <= QuickThinking; code++ {
+		key := quickMessageKeys[code]
+		list = append(list, quickMessageEntry{Code: code, Key: key, Text: localize(lang, key, nil)})
+	}
+	writeJSON(w, list)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQuickMessages(t *testing.T) {
+	_, white, black := startTestGame(t)
+	white.send(Message{Type: "quick", Quick: QuickGoodLuck})
+	if got := black.expect("quick"); got.Quick != QuickGoodLuck || got.Color != "white" {
+		t.Errorf("got %+v", got)
+	}
+	black.send(Message{Type: "quick", Quick: QuickThinking + 1})
+	if got := black.expect("error"); got.Code != CodeInvalidMessage || got.Field != "quick" {
+		t.Errorf("got %+v for an unknown quick message", got)
+	}
+	black.send(Message{Type: "quick", Quick: QuickThumbsUp})
+	if got := white.expect("quick"); got.Quick != QuickThumbsUp || got.Color != "black" {
+		t.Errorf("got %+v", got)
+	}
+
+	w := httptest.NewRecorder()
+	quickMessagesHandler(w, httptest.NewRequest("GET", "/quick-messages?lang=es", nil))
+	list := []quickMessageEntry{}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != len(quickMessageKeys) || list[1].Code != QuickGoodGame || list[1].Text != "¡Buena partida!" {
+		t.Errorf("got %+v", list)
+	}
+	for _, entry := range list {
+		if entry.Text == entry.Key {
+			t.Errorf("%s has no text", entry.Key)
+		}
+	}
+}
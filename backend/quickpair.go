@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// the rating difference the quick pair queue accepts at first, how much
+// more it accepts for every quickWideningEvery a player waits, and how
+// often the queue is matched
+const (
+	quickWindow        = 100
+	quickWidening      = 50
+	quickWideningEvery = 5 * time.Second
+	quickMatchEvery    = time.Second
+)
+
+// quickSeeker is a player in the quick pair queue, rated in the pool of
+// the time control they play; those without a rating there count as
+// starting players
+type quickSeeker struct {
+	conn   *connection
+	pool   string
+	rating int
+	since  time.Time
+}
+
+// window is the rating difference seeker accepts as of now
+func (seeker quickSeeker) window(now time.Time) int {
+	return quickWindow + quickWidening*int(now.Sub(seeker.since)/quickWideningEvery)
+}
+
+// QuickPair puts conn in the quick pair queue, where players are paired
+// by how close their ratings are rather than in the order they came, see
+// matchQuick. The players queued are not read from, one leaving is only
+// noticed once the game started
+func (m *gameManager) QuickPair(ctx context.Context, conn *connection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.clientLimit(conn.client); err != nil {
+		return err
+	}
+	if err := m.canCreate(); err != nil {
+		return err
+	}
+	pool := ratingPool(GameState{TimeControl: timeControlFor(conn)})
+	rating, rated := poolRating(conn.player, pool)
+	if !rated {
+		rating = initialRating
+	}
+	now := time.Now()
+	m.quick = append(m.quick, quickSeeker{conn: conn, pool: pool, rating: rating, since: now})
+	m.matchQuick(ctx, now)
+	if len(m.quick) > 0 && !m.quickTicking {
+		m.quickTicking = true
+		go m.tickQuick()
+	}
+	return nil
+}
+
+// tickQuick matches the queue as the windows of the players waiting
+// widen, until nobody is left in it
+func (m *gameManager) tickQuick() {
+	ticker := time.NewTicker(quickMatchEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			m.matchQuick(m.ctx, now)
+			if len(m.quick) == 0 {
+				m.quickTicking = false
+				m.mu.Unlock()
+				return
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// matchQuick pairs the two players of the queue closest in rating, in the
+// same pool and within the window of whoever waited longer, for as long
+// as there are such players. Whoever waited longer plays white; m.mu
+// must be held
+func (m *gameManager) matchQuick(ctx context.Context, now time.Time) {
+	for m.canCreate() == nil {
+		closest, first, second := -1, 0, 0
+		for i, a := range m.quick {
+			for j := i + 1; j < len(m.quick); j++ {
+				b := m.quick[j]
+				difference := max(a.rating-b.rating, b.rating-a.rating)
+				if a.pool != b.pool || difference > a.window(now) {
+					continue
+				}
+				if closest < 0 || difference < closest {
+					closest, first, second = difference, i, j
+				}
+			}
+		}
+		if closest < 0 {
+			return
+		}
+		white, black := m.quick[first], m.quick[second]
+		m.quick = slices.Delete(m.quick, second, second+1)
+		m.quick = slices.Delete(m.quick, first, first+1)
+		game := NewChessGame(ctx, white.conn)
+		// registered first, as paired games are
+		m.active[game.id] = game
+		if err := game.Join(ctx, black.conn); err != nil {
+			delete(m.active, game.id)
+			// white left meanwhile, black waits for somebody else
+			m.quick = append(m.quick, black)
+			slices.SortStableFunc(m.quick, func(a, b quickSeeker) int { return a.since.Compare(b.since) })
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQuickPairByRating(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	rated := func(name string, rating int) *testPlayer {
+		player := newPlayer(name)
+		player.Ratings["correspondence"] = Rating{Rating: rating, Games: 20}
+		players.Create(player)
+		tp := newTestPlayer(t)
+		goOnline(tp.conn, player.ID)
+		return tp
+	}
+	// players without an account count as rated 1500
+	anonymous, strong, near := newTestPlayer(t), rated("bo", 1900), rated("carl", 1560)
+	for _, player := range []*testPlayer{anonymous, strong, near} {
+		if err := games.QuickPair(context.Background(), player.conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	white, black := anonymous.expect("start"), near.expect("start")
+	if white.GameID != black.GameID || white.Color != "white" {
+		t.Fatalf("got %+v and %+v", white, black)
+	}
+
+	// bo waited long enough to accept a player 200 points weaker
+	games.mu.Lock()
+	if len(games.quick) != 1 {
+		t.Fatalf("%d players queued", len(games.quick))
+	}
+	games.quick[0].since = time.Now().Add(-2 * quickWideningEvery)
+	games.mu.Unlock()
+	weaker := rated("dan", 1700)
+	if err := games.QuickPair(context.Background(), weaker.conn); err != nil {
+		t.Fatal(err)
+	}
+	second := strong.expect("start")
+	if second.Color != "white" {
+		t.Errorf("got %+v", second)
+	}
+	weaker.expect("start")
+
+	// both games are over before the player store is put back, for their
+	// loops to be done with the accounts
+	for player, id := range map[*testPlayer]string{anonymous: white.GameID, strong: second.GameID} {
+		game, ok := games.Find(id)
+		if !ok {
+			t.Fatalf("game %s not found", id)
+		}
+		player.send(Message{Type: "resign"})
+		<-game.done
+	}
+}
+
+func TestQuickPairWindowWidens(t *testing.T) {
+	seeker := quickSeeker{since: time.Now()}
+	if got := seeker.window(seeker.since.Add(12 * time.Second)); got != quickWindow+2*quickWidening {
+		t.Errorf("got %d", got)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// apiRate is how many requests a minute a client may make to the REST API,
+// in a burst if it likes
+var apiRate = 300
+
+// rateLimiter lets every client make rate requests a minute, and as many
+// at once, refilling what it used as the minute goes on
+type rateLimiter struct {
+	// rate is read as requests are made, for it to be configured after
+	rate    *int
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+}
+
+// maxRateBuckets bounds the clients kept track of, the full buckets are
+// forgotten beyond
+const maxRateBuckets = 10_000
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var (
+	analysisLimiter = &rateLimiter{rate: &analysisRate, buckets: map[string]*rateBucket{}}
+	apiLimiter      = &rateLimiter{rate: &apiRate, buckets: map[string]*rateBucket{}}
+)
+
+// rateQuota is what a client has left of its allowance: Remaining of Limit
+// requests, all of them again in Reset seconds
+type rateQuota struct {
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+	Reset     int `json:"reset"`
+	// RetryAfter is how many seconds to wait for a request refused
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
+
+// allow reports whether client may make a request at now, or how long it
+// has to wait for one otherwise; there is no limit if the rate is 0
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	quota, ok := l.quota(client, now, true)
+	return ok, time.Duration(quota.RetryAfter) * time.Second
+}
+
+// quota is the quota of client at now, once it makes a request if take;
+// ok is whether the request may be made. Limit is 0 with no limit
+func (l *rateLimiter) quota(client string, now time.Time, take bool) (quota rateQuota, ok bool) {
+	rate := float64(*l.rate)
+	if rate <= 0 {
+		return rateQuota{}, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	refill := func(b *rateBucket) {
+		b.tokens = min(rate, b.tokens+now.Sub(b.last).Minutes()*rate)
+		b.last = now
+	}
+	if len(l.buckets) >= maxRateBuckets {
+		for key, b := range l.buckets {
+			if refill(b); b.tokens == rate {
+				delete(l.buckets, key)
+			}
+		}
+	}
+	b, found := l.buckets[client]
+	if !found {
+		b = &rateBucket{tokens: rate, last: now}
+		l.buckets[client] = b
+	}
+	refill(b)
+	ok = b.tokens >= 1
+	if ok && take {
+		b.tokens--
+	}
+	quota = rateQuota{
+		Limit:     int(rate),
+		Remaining: int(b.tokens),
+		Reset:     int(math.Ceil((rate - b.tokens) / rate * 60)),
+	}
+	if !ok {
+		quota.RetryAfter = int(math.Ceil((1 - b.tokens) / rate * 60))
+	}
+	return quota, ok
+}
+
+// unlimitedPatterns are the routes left out of the API rate limit: the
+// transports of the game protocol, health checks, the frontend, and the
+// quota itself, which is told without using any
+var unlimitedPatterns = map[string]bool{
+	"/ws":                 true,
+	"GET /sse":            true,
+	"/sse/{session}":      true,
+	"/poll":               true,
+	"GET /poll/{session}": true,
+	"/poll/{session}":     true,
+	"GET /healthz":        true,
+	"GET /readyz":         true,
+	"/":                   true,
+	"GET /account/quota":  true,
+}
+
+// rateClient is who the requests of r count against: the player of its
+// bearer token, or its address
+func rateClient(r *http.Request) string {
+	if player, err := requestPlayer(r); err == nil {
+		return "player:" + player.ID
+	}
+	return "ip:" + clientIP(r)
+}
+
+func setRateHeaders(w http.ResponseWriter, quota rateQuota) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(quota.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(quota.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(quota.Reset))
+}
+
+// withRateLimit limits the requests to the REST API of mux by apiLimiter,
+// telling clients how much they have left in RateLimit headers
+func withRateLimit(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == "" || unlimitedPatterns[pattern] {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		quota, ok := apiLimiter.quota(rateClient(r), time.Now(), true)
+		if quota.Limit > 0 {
+			setRateHeaders(w, quota)
+		}
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(quota.RetryAfter))
+			http.Error(w, "too many requests, try again later", http.StatusTooManyRequests)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// quotaHandler tells the client what it has left of its allowance of
+// requests to the API, without using any
+func quotaHandler(w http.ResponseWriter, r *http.Request) {
+	quota, _ := apiLimiter.quota(rateClient(r), time.Now(), false)
+	if quota.Limit > 0 {
+		setRateHeaders(w, quota)
+	}
+	writeJSON(w, quota)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterQuota(t *testing.T) {
+	rate := 60
+	l := &rateLimiter{rate: &rate, buckets: map[string]*rateBucket{}}
+	now := time.Now()
+	for range 60 {
+		if _, ok := l.quota("a", now, true); !ok {
+			t.Fatal("refused within the burst")
+		}
+	}
+	quota, ok := l.quota("a", now, true)
+	if ok || quota != (rateQuota{Limit: 60, Remaining: 0, Reset: 60, RetryAfter: 1}) {
+		t.Errorf("got %v %+v", ok, quota)
+	}
+	// a second later it has one request back, looking does not use it
+	quota, _ = l.quota("a", now.Add(time.Second), false)
+	if quota != (rateQuota{Limit: 60, Remaining: 1, Reset: 59}) {
+		t.Errorf("got %+v", quota)
+	}
+	if quota, _ := l.quota("b", now, false); quota.Remaining != 60 {
+		t.Errorf("got %+v for another client", quota)
+	}
+}
+
+func TestAPIRateLimit(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	defer func(rate int) { apiRate = rate }(apiRate)
+	apiRate = 2
+	defer func(buckets map[string]*rateBucket) { apiLimiter.buckets = buckets }(apiLimiter.buckets)
+	apiLimiter.buckets = map[string]*rateBucket{}
+	ana := Player{ID: "ana", Name: "ana"}
+	startSession(&ana, "test")
+	players.Create(ana)
+	handler := withRateLimit(newPublicMux())
+	get := func(path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := get("/players/ana", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("got %d %v", w.Code, w.Header())
+	}
+	get("/players/ana", "")
+	w := get("/players/ana", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("got %d %v", w.Code, w.Header())
+	}
+	// the transports and health checks are not limited
+	if w := get("/healthz", ""); w.Code == http.StatusTooManyRequests || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("got %d for the health check", w.Code)
+	}
+	var quota rateQuota
+	json.Unmarshal(get("/account/quota", "").Body.Bytes(), &quota)
+	if quota.Limit != 2 || quota.Remaining != 0 {
+		t.Errorf("got %+v", quota)
+	}
+	// players authenticated have an allowance of their own
+	if w := get("/players/ana", ana.Token); w.Code != http.StatusOK {
+		t.Errorf("got %d authenticated", w.Code)
+	}
+	json.Unmarshal(get("/account/quota", ana.Token).Body.Bytes(), &quota)
+	if quota.Remaining != 1 {
+		t.Errorf("got %+v authenticated", quota)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrIdle = errors.New("connection idle")
+
+// connectionIdleTimeout is how long a connection seated in no game may go
+// without sending a message or answering a ping before the reaper closes
+// it, for ever if 0
+var connectionIdleTimeout = 30 * time.Minute
+
+// liveConnections are those not closed yet, for the reaper to go through
+var liveConnections = struct {
+	sync.Mutex
+	conns map[*connection]struct{}
+}{conns: map[*connection]struct{}{}}
+
+func trackConnection(conn *connection) {
+	liveConnections.Lock()
+	defer liveConnections.Unlock()
+	liveConnections.conns[conn] = struct{}{}
+}
+
+func untrackConnection(conn *connection) {
+	liveConnections.Lock()
+	defer liveConnections.Unlock()
+	delete(liveConnections.conns, conn)
+}
+
+// lastActive is when the client of conn was last heard from: the message
+// it last sent, or the pong, whichever came last
+func (conn *connection) lastActive() time.Time {
+	active := time.Unix(0, conn.active.Load())
+	if p, ok := conn.transport.(ponger); ok && p.LastPong().After(active) {
+		return p.LastPong()
+	}
+	return active
+}
+
+// reapIdle closes the connections idle for connectionIdleTimeout at now,
+// those seated in a game aside, answering how many it closed
+func reapIdle(now time.Time) int {
+	liveConnections.Lock()
+	var idle []*connection
+	for conn := range liveConnections.conns {
+		if !conn.seated.Load() && now.Sub(conn.lastActive()) > connectionIdleTimeout {
+			idle = append(idle, conn)
+		}
+	}
+	liveConnections.Unlock()
+	// closing untracks them, it cannot be done holding the lock
+	for _, conn := range idle {
+		closeWithError(conn, ErrIdle)
+	}
+	return len(idle)
+}
+
+// runReaper reaps the idle connections every connectionIdleTimeout/2, a
+// minute at most, until ctx is done
+func runReaper(ctx context.Context) {
+	if connectionIdleTimeout == 0 {
+		return
+	}
+	ticker := time.NewTicker(min(connectionIdleTimeout/2, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			reapedConnections.Add(int64(reapIdle(now)))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReapIdle(t *testing.T) {
+	_, white, _ := startTestGame(t)
+	lobby := newTestPlayer(t)
+	joinLobby(lobby.conn)
+	lobby.expect("lobby")
+	chatty := newTestPlayer(t)
+	joinLobby(chatty.conn)
+	chatty.expect("lobby")
+
+	// the players of the game are never idle, the one who spoke lately not
+	// yet
+	now := time.Now()
+	long := now.Add(-2 * connectionIdleTimeout).UnixNano()
+	white.conn.active.Store(long)
+	lobby.conn.active.Store(long)
+	chatty.conn.active.Store(now.Add(-connectionIdleTimeout / 2).UnixNano())
+	reapIdle(now)
+	lobby.expect("error", CodeIdle)
+	if reason := <-lobby.transport.reason; reason != ErrIdle.Error() {
+		t.Fatalf("closed with %q", reason)
+	}
+	select {
+	case reason := <-chatty.transport.reason:
+		t.Fatalf("the client who spoke closed with %q", reason)
+	case reason := <-white.transport.reason:
+		t.Fatalf("the player closed with %q", reason)
+	default:
+	}
+	liveConnections.Lock()
+	_, tracked := liveConnections.conns[lobby.conn]
+	liveConnections.Unlock()
+	if tracked {
+		t.Error("the connection reaped is still tracked")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// recordDir is where the sessions of every game are recorded, none are if empty
+var recordDir string
+
+// recordedEntry is a line of a session recording: a message a player sent
+// or was sent, or a player connecting or going away
+type recordedEntry struct {
+	Time  time.Time `json:"time"`
+	Color string    `json:"color"`
+	// Kind is connect, in, out or disconnect
+	Kind    string   `json:"kind"`
+	Message *Message `json:"message,omitempty"`
+}
+
+// sessionRecording writes all that goes through the connections of a game
+// to <recordDir>/<game>.session.jsonl, for cmd/replay to play it back
+type sessionRecording struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// newSessionRecording is nil when sessions are not recorded,
+// recording to nil does nothing
+func newSessionRecording(gameID string) *sessionRecording {
+	if recordDir == "" {
+		return nil
+	}
+	path := filepath.Join(recordDir, filepath.Base(gameID)+".session.jsonl")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return &sessionRecording{file: file, encoder: json.NewEncoder(file)}
+}
+
+func (recording *sessionRecording) record(color, kind string, message *Message) {
+	if recording == nil {
+		return
+	}
+	recording.mu.Lock()
+	defer recording.mu.Unlock()
+	if recording.file == nil {
+		return
+	}
+	entry := recordedEntry{Time: time.Now().UTC(), Color: color, Kind: kind, Message: message}
+	if err := recording.encoder.Encode(entry); err != nil {
+		log.Println(err)
+	}
+}
+
+func (recording *sessionRecording) Close() error {
+	if recording == nil {
+		return nil
+	}
+	recording.mu.Lock()
+	defer recording.mu.Unlock()
+	err := recording.file.Close()
+	recording.file = nil
+	return err
+}
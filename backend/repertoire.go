@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+)
+
+// repertoire is what a player opens with as white and answers with as
+// black, the openings played most first
+type repertoire struct {
+	Player string         `json:"player"`
+	White  []openingStats `json:"white"`
+	Black  []openingStats `json:"black"`
+}
+
+func newRepertoire(player Player) (repertoire, error) {
+	byColor := map[string]map[opening][]PlayerGame{"white": {}, "black": {}}
+	for _, game := range player.Games {
+		byOpening, ok := byColor[game.Color]
+		if !ok {
+			continue
+		}
+		state, ok, err := archivedGameIn(archiveStore, game.ID)
+		if err != nil {
+			return repertoire{}, err
+		}
+		// the openings are those played from the starting position
+		if !ok || state.Variant != "" || state.FEN != "" {
+			continue
+		}
+		o := classifyOpening(uciMoves(state.Moves))
+		byOpening[o] = append(byOpening[o], game)
+	}
+	return repertoire{
+		Player: player.ID,
+		White:  openingRecords(byColor["white"]),
+		Black:  openingRecords(byColor["black"]),
+	}, nil
+}
+
+// repertoireHandler serves the repertoire of a player
+func repertoireHandler(w http.ResponseWriter, r *http.Request) {
+	serveCached(w, r, "repertoire:"+r.PathValue("id"), func() (any, error) {
+		player, err := players.Load(r.PathValue("id"))
+		if err != nil {
+			return nil, err
+		}
+		return newRepertoire(player)
+	})
+}
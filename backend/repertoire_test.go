@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRepertoire(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	archive := func(id, variant, moves string) {
+		recorder := newGameRecorder(id, "", nil, variant)
+		recorder.Record(context.Background(), GameCreated, "", nil)
+		for _, m := range strings.Fields(moves) {
+			recorder.Record(context.Background(), MoveMade, "", &Move{From: m[:2], To: m[2:]})
+		}
+	}
+	archive("repertoire-1", "", "e2e4 c7c5")
+	archive("repertoire-2", "", "e2e4 c7c5 g1f3")
+	archive("repertoire-3", "", "e2e4 c7c5 b1c3")
+	archive("repertoire-4", "", "d2d4 d7d5 c2c4")
+	archive("repertoire-5", "voting", "e2e4 e7e5")
+	player := newPlayer("ana")
+	player.Games = []PlayerGame{
+		{ID: "repertoire-1", Color: "black", Result: "win"},
+		{ID: "repertoire-2", Color: "black", Result: "draw"},
+		{ID: "repertoire-3", Color: "black", Result: "loss"},
+		{ID: "repertoire-4", Color: "white", Result: "draw"},
+		{ID: "repertoire-5", Color: "white", Result: "win"},
+	}
+	players.Create(player)
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/"+player.ID+"/repertoire", nil))
+	rep := repertoire{}
+	json.Unmarshal(w.Body.Bytes(), &rep)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+	// the game of a variant has no opening
+	if len(rep.White) != 1 || rep.White[0].ECO != "D06" || rep.White[0].Score != 0.5 {
+		t.Errorf("got %+v as white", rep.White)
+	}
+	if len(rep.Black) != 3 {
+		t.Fatalf("got %+v as black", rep.Black)
+	}
+	for _, o := range rep.Black {
+		if want := map[string]float64{"B20": 1, "B27": 0.5, "B23": 0}[o.ECO]; o.Score != want || o.Count.All != 1 {
+			t.Errorf("got %+v", o)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/nobody/repertoire", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got %d for an unknown player", w.Code)
+	}
+}
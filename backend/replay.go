@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxReplaySpeed is the fastest a game is replayed at, times its original
+// speed
+const maxReplaySpeed = 100
+
+// replayMaxPause is the longest a replay waits between two events, as
+// played: the days an untimed game may be left for are not watched
+var replayMaxPause = 30 * time.Second
+
+var errInvalidReplaySpeed = errors.New("invalid speed, expected a number above 0 and up to 100")
+
+// parseReplaySpeed reads how many times faster than played a game is
+// replayed, 1 if value is empty
+func parseReplaySpeed(value string) (float64, error) {
+	if value == "" {
+		return 1, nil
+	}
+	speed, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(speed > 0 && speed <= maxReplaySpeed) {
+		return 0, errInvalidReplaySpeed
+	}
+	return speed, nil
+}
+
+// replayTimeline is when each of events happened after the game started:
+// a move as long after the turn started as its player thought about it,
+// the rest when they were recorded, what came before the start at 0
+func replayTimeline(events []Event) []time.Duration {
+	timeline := make([]time.Duration, len(events))
+	var started time.Time
+	// a turn starts when the game does, a move is made or taken back
+	var at, turnStarted time.Duration
+	for i, event := range events {
+		if event.Type == GameStarted {
+			started = event.Time
+		}
+		if !started.IsZero() {
+			recorded := event.Time.Sub(started)
+			if event.Type == MoveMade && event.Move.SpentMs > 0 {
+				recorded = turnStarted + time.Duration(event.Move.SpentMs)*time.Millisecond
+			}
+			at = max(at, recorded)
+		}
+		switch event.Type {
+		case MoveMade, MovesTakenBack:
+			turnStarted = at
+		}
+		timeline[i] = at
+	}
+	return timeline
+}
+
+// replayHandler streams the events of a game over as Server-Sent Events,
+// as gameEventsHandler does, but as they happened: each once as long after
+// the one before as it was played, ?speed= times faster, or slower below 1.
+// The waits are capped to replayMaxPause as played, the stream ends with an
+// end event. The events of games being played are at /games/{id}/events
+func replayHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	speed, err := parseReplaySpeed(r.URL.Query().Get("speed"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	state, events, ok := loadWatchedEvents(w, r)
+	if !ok {
+		return
+	}
+	if !state.Finished {
+		http.Error(w, "the game is still being played, follow it at /games/"+state.ID+"/events", http.StatusConflict)
+		return
+	}
+
+	keepOpen(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	timeline := replayTimeline(events)
+	var at time.Duration
+	for i, event := range events {
+		wait := min(timeline[i]-at, replayMaxPause)
+		at = timeline[i]
+		next := time.After(time.Duration(float64(wait) / speed))
+	waiting:
+		for {
+			select {
+			case <-next:
+				break waiting
+			case <-ping.C:
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+		writeGameEvent(w, event)
+		flusher.Flush()
+	}
+	fmt.Fprintf(w, "event: end\ndata: %s\n\n", state.Result)
+	flusher.Flush()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayTimeline(t *testing.T) {
+	start := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	events := []Event{
+		{Type: GameCreated, Time: at(-time.Minute)},
+		{Type: GameStarted, Time: at(0)},
+		{Type: MoveMade, Time: at(2 * time.Second), Move: &Move{SpentMs: 1500}},
+		// recorded before the time spent was
+		{Type: MoveMade, Time: at(5 * time.Second), Move: &Move{}},
+		{Type: DrawOffered, Time: at(6 * time.Second)},
+		{Type: MoveMade, Time: at(9 * time.Second), Move: &Move{SpentMs: 3000}},
+		{Type: GameResigned, Time: at(10 * time.Second)},
+	}
+	want := []time.Duration{0, 0, 1500 * time.Millisecond, 5 * time.Second, 6 * time.Second, 8 * time.Second, 10 * time.Second}
+	if got := replayTimeline(events); !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	defer func(d time.Duration) { replayMaxPause = d }(replayMaxPause)
+	replayMaxPause = 2 * time.Second
+	server := httptest.NewServer(newPublicMux())
+	defer server.Close()
+	ctx := context.Background()
+	id := newGameID()
+	start := time.Now().UTC()
+	for i, event := range []Event{
+		{Type: GameCreated},
+		{Type: GameStarted},
+		{Type: MoveMade, Color: "white", Move: &Move{From: "e2", To: "e4", SpentMs: 1000}},
+		// an hour is waited as replayMaxPause
+		{Type: MoveMade, Color: "black", Move: &Move{From: "e7", To: "e5", SpentMs: 3600 * 1000}},
+		{Type: GameResigned, Color: "white"},
+	} {
+		event.GameID, event.Seq = id, i+1
+		event.Time = start.Add(time.Duration(i) * time.Hour)
+		if err := store.Append(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if resp, _ := http.Get(server.URL + "/games/" + id + "/replay?speed=0"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got %s for a speed of 0", resp.Status)
+	}
+	began := time.Now()
+	resp, err := http.Get(server.URL + "/games/" + id + "/replay?speed=50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if event, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			got = append(got, event)
+		}
+	}
+	want := []string{"game_created", "game_started", "move_made", "move_made", "game_resigned", "end"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// 1s, then 2s twice as replayMaxPause, 50 times faster
+	if took := time.Since(began); took < 100*time.Millisecond || took > 2*time.Second {
+		t.Fatalf("took %v", took)
+	}
+
+	live := newGameRecorder(newGameID(), "", nil, "")
+	live.Record(ctx, GameCreated, "", nil)
+	if resp, _ := http.Get(server.URL + "/games/" + live.State().ID + "/replay"); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("got %s for a game being played", resp.Status)
+	}
+}
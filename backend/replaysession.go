@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+var ErrGameNotOver = errors.New("game not over")
+
+// replayStep is how a game stood after a number of its moves
+type replayStep struct {
+	fen                  string
+	whiteTime, blackTime int64
+}
+
+// replaySession is a finished game browsed a move at a time by one
+// connection, the server telling it every position: clients need not know
+// the rules of the game to show it
+type replaySession struct {
+	conn  *connection
+	state GameState
+	// steps are how the game stood after none of its moves, then each
+	steps  []replayStep
+	reason string
+	ply    int
+	// color is the side the board is shown from
+	color string
+}
+
+// replaySteps are the steps of the game of events, as positioned by the
+// rules of its variant; a move taken back is replaced by the one played
+// instead, the clocks left as they were after either
+func replaySteps(events []Event) []replayStep {
+	var state GameState
+	steps := []replayStep{{}}
+	for _, event := range events {
+		state.Apply(event)
+		switch event.Type {
+		case GameCreated, MoveMade, MovesTakenBack, PiecePocketed:
+		default:
+			continue
+		}
+		position, _ := variantRules(state.Variant).position(state)
+		steps = append(steps[:len(state.Moves)], replayStep{fen: position.FEN(), whiteTime: state.WhiteTime, blackTime: state.BlackTime})
+	}
+	return steps
+}
+
+// joinReplay has conn browse the finished game id, given a spectator token
+// if it is private. It is sent the game and its start position in a replay
+// message, then the position at each step it asks for: replay_next and
+// replay_prev, replay_jump to Ply, replay_flip to see the board from the
+// other side. Accounts playing black see it from their side first
+func joinReplay(conn *connection, id, token string) {
+	events, err := store.Load(id)
+	if err != nil && !errors.Is(err, ErrGameNotFound) {
+		conn.Close(err.Error())
+		return
+	}
+	state := Replay(events)
+	if err != nil || !canWatchWith(token, state) {
+		closeWithError(conn, ErrGameNotFound, id)
+		return
+	}
+	if !state.Finished {
+		closeWithError(conn, ErrGameNotOver, id)
+		return
+	}
+	session := &replaySession{conn: conn, state: state, steps: replaySteps(events), reason: newGameDocument(state, events).Reason, color: "white"}
+	if conn.player != "" && conn.player == state.Players["black"] {
+		session.color = "black"
+	}
+	welcome := session.position()
+	welcome.Moves, welcome.Variant, welcome.Players = state.Moves, state.Variant, state.Players
+	welcome.Result, welcome.Reason = state.Result, session.reason
+	conn.Write(welcome)
+	go session.listen()
+}
+
+// position is the replay message of where the session is
+func (s *replaySession) position() Message {
+	step := s.steps[s.ply]
+	return Message{Type: "replay", GameID: s.state.ID, Ply: s.ply, FEN: step.fen, Color: s.color, WhiteTime: step.whiteTime, BlackTime: step.blackTime}
+}
+
+// listen reads the steps conn asks for until it leaves
+func (s *replaySession) listen() {
+	for {
+		message, err := s.conn.Read()
+		if errors.Is(err, ErrInvalidPayload) {
+			s.conn.Write(errorMessage(CodeInvalidPayload))
+			continue
+		}
+		if err != nil {
+			s.conn.Close("")
+			return
+		}
+		if invalid := validateMessage(message); invalid != nil {
+			s.conn.Write(*invalid)
+			continue
+		}
+		last := len(s.steps) - 1
+		switch message.Type {
+		case "replay_next":
+			s.ply = min(s.ply+1, last)
+		case "replay_prev":
+			s.ply = max(s.ply-1, 0)
+		case "replay_jump":
+			if message.Ply < 0 || message.Ply > last {
+				invalid := errorMessage(CodeInvalidMessage, "ply", "max="+strconv.Itoa(last))
+				invalid.Field = "ply"
+				s.conn.Write(invalid)
+				continue
+			}
+			s.ply = message.Ply
+		case "replay_flip":
+			s.color = opponent(s.color)
+		default:
+			s.conn.Write(errorMessage(CodeWrongRole))
+			continue
+		}
+		s.conn.Write(s.position())
+	}
+}
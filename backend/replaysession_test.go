@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+func TestReplaySession(t *testing.T) {
+	ctx := context.Background()
+	recorder := newGameRecorder(newGameID(), "", nil, "")
+	recorder.Record(ctx, GameCreated, "", nil)
+	recorder.Record(ctx, GameStarted, "", nil)
+	recorder.Record(ctx, MoveMade, "white", &Move{From: "e2", To: "e4"})
+	recorder.Record(ctx, MoveMade, "black", &Move{From: "e7", To: "e6"})
+	// the move taken back is not replayed, the one played instead is
+	recorder.append(ctx, Event{Type: MovesTakenBack, Color: "black", Plies: 1})
+	recorder.Record(ctx, MoveMade, "black", &Move{From: "e7", To: "e5"})
+	id := recorder.State().ID
+
+	player := newTestPlayer(t)
+	joinReplay(player.conn, id, "")
+	player.expect("error", CodeGameNotOver)
+
+	recorder.Record(ctx, GameResigned, "white", nil)
+	player = newTestPlayer(t)
+	joinReplay(player.conn, id, "")
+	welcome := player.expect("replay")
+	if welcome.Ply != 0 || welcome.FEN != chess.NewPosition().FEN() || len(welcome.Moves) != 2 || welcome.Result != "0-1" || welcome.Reason != "resignation" || welcome.Color != "white" {
+		t.Fatalf("got %+v", welcome)
+	}
+	e4, _ := chess.ParseMove("e2e4")
+	afterE4 := chess.NewPosition().Apply(e4)
+	player.send(Message{Type: "replay_next"})
+	if got := player.expect("replay"); got.Ply != 1 || got.FEN != afterE4.FEN() {
+		t.Fatalf("got %+v", got)
+	}
+	player.send(Message{Type: "replay_jump", Ply: 3})
+	if got := player.expect("error", CodeInvalidMessage); got.Field != "ply" {
+		t.Fatalf("got %+v", got)
+	}
+	player.send(Message{Type: "replay_flip"})
+	if got := player.expect("replay"); got.Ply != 1 || got.Color != "black" {
+		t.Fatalf("got %+v", got)
+	}
+	player.send(Message{Type: "replay_jump", Ply: 2})
+	last := player.expect("replay")
+	e5, _ := chess.ParseMove("e7e5")
+	if last.Ply != 2 || last.FEN != afterE4.Apply(e5).FEN() {
+		t.Fatalf("got %+v", last)
+	}
+	// past the last move there is nothing more to see
+	player.send(Message{Type: "replay_next"})
+	if got := player.expect("replay"); got.Ply != 2 || got.FEN != last.FEN {
+		t.Fatalf("got %+v", got)
+	}
+	player.send(Message{Type: "replay_jump"})
+	player.send(Message{Type: "replay_prev"})
+	if got := player.expect("replay"); got.Ply != 0 {
+		t.Fatalf("got %+v", got)
+	}
+	if got := player.expect("replay"); got.Ply != 0 {
+		t.Fatalf("got %+v", got)
+	}
+	player.send(Message{Type: "move", From: "e2", To: "e4"})
+	player.expect("error", CodeWrongRole)
+
+	private := newTestPlayer(t)
+	recorder.Record(ctx, GameMadePrivate, "white", nil)
+	joinReplay(private.conn, id, "")
+	private.expect("error", CodeGameNotFound)
+}
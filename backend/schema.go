@@ -0,0 +1,238 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// routes is where the routes of a server are registered: a ServeMux, or
+// routeList to describe them
+type routes interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+	Handle(pattern string, handler http.Handler)
+}
+
+// routeList lists the patterns of the routes registered on it
+type routeList []string
+
+func (l *routeList) HandleFunc(pattern string, _ func(http.ResponseWriter, *http.Request)) {
+	*l = append(*l, pattern)
+}
+
+func (l *routeList) Handle(pattern string, _ http.Handler) { *l = append(*l, pattern) }
+
+// responseTypes are what the routes answering JSON answer, in the OpenAPI
+// description of the API
+var responseTypes = map[string]any{
+	"GET /players/{id}":                     profile{},
+	"GET /players/{id}/stats":               playerStats{},
+	"GET /players/{id}/repertoire":          repertoire{},
+	"GET /players/{id}/versus/{opponent}":   headToHead{},
+	"GET /players/{id}/preferences":         Preferences{},
+	"GET /players/{id}/notifications":       inbox{},
+	"POST /players/{id}/notifications/read": inbox{},
+	"GET /games/{id}/json":                  gameDocument{},
+	"GET /games/{id}/certificate":           resultCertificate{},
+	"GET /certificates/key":                 resultKeyDoc{},
+	"POST /certificates/verify":             resultRecord{},
+	"GET /lobby":                            []seek{},
+	"GET /brackets/{id}":                    bracketView{},
+	"GET /simuls/{id}":                      simulView{},
+	"GET /matches/{id}":                     matchView{},
+	"GET /studies/{id}":                     Study{},
+	"GET /account/quota":                    rateQuota{},
+	"GET /challenge":                        seekChallengeDoc{},
+	"GET /time-controls":                    []timeControlPreset{},
+	"POST /validate-fen":                    fenValidation{},
+}
+
+// jsonSchema builds the JSON Schemas of Go types as encoding/json encodes
+// them, every named struct once among defs, referred to under ref
+type jsonSchema struct {
+	ref  string
+	defs map[string]any
+}
+
+func newJSONSchema(ref string) *jsonSchema {
+	return &jsonSchema{ref: ref, defs: map[string]any{}}
+}
+
+var (
+	timeType      = reflect.TypeFor[time.Time]()
+	durationType  = reflect.TypeFor[time.Duration]()
+	rawType       = reflect.TypeFor[json.RawMessage]()
+	marshalerType = reflect.TypeFor[json.Marshaler]()
+)
+
+func (s *jsonSchema) of(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]any{"type": "integer", "description": "nanoseconds"}
+	case t == rawType || t.Implements(marshalerType):
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s.defs[t.Name()]; !ok {
+			// set first, for types referring to themselves
+			s.defs[t.Name()] = nil
+			s.defs[t.Name()] = s.object(t)
+		}
+		return map[string]any{"$ref": s.ref + t.Name()}
+	}
+	return map[string]any{}
+}
+
+func (s *jsonSchema) object(t reflect.Type) map[string]any {
+	properties, required := map[string]any{}, []string{}
+	s.fields(t, properties, &required)
+	object := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		slices.Sort(required)
+		object["required"] = required
+	}
+	return object
+}
+
+// fields adds the fields of t as encoded to properties, those of its
+// embedded structs among them, the ones never left out to required
+func (s *jsonSchema) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.fields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.of(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// messageSchema is the JSON Schema of the messages of the WebSocket
+// protocol, both ways
+var messageSchema = sync.OnceValue(func() map[string]any {
+	s := newJSONSchema("#/$defs/")
+	message := s.of(reflect.TypeFor[Message]())
+	// what the server leaves in is not for clients to send
+	s.defs["Message"].(map[string]any)["required"] = []string{"type"}
+	return map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         "/schema/messages.json",
+		"title":       "Message",
+		"description": "every message of the WebSocket protocol at /ws, whichever way, in version " + strconv.Itoa(slices.Max(supportedProtocolVersions)) + " of it; type says what it is about. Those encoded as protobuf are described in /schema/protocol.proto",
+		"$ref":        message["$ref"],
+		"$defs":       s.defs,
+	}
+})
+
+// pathParameter is a wildcard of a route pattern, as in {id}
+var pathParameter = regexp.MustCompile(`\{(\w+)(\.\.\.)?\}`)
+
+// openAPI is the OpenAPI description of the routes of the public server
+func openAPI() map[string]any {
+	var list routeList
+	publicRoutes(&list)
+	s := newJSONSchema("#/components/schemas/")
+	paths := map[string]map[string]any{}
+	for _, pattern := range list {
+		method, path, found := strings.Cut(pattern, " ")
+		if !found {
+			method, path = "", pattern
+		}
+		// the websocket, SSE and polling transports are described in
+		// /schema/messages.json, the frontend is no API
+		if method == "" {
+			continue
+		}
+		operation := map[string]any{"responses": map[string]any{"default": map[string]any{"description": "see the documentation of the route"}}}
+		var parameters []any
+		for _, match := range pathParameter.FindAllStringSubmatch(path, -1) {
+			parameters = append(parameters, map[string]any{"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+		if v, ok := responseTypes[pattern]; ok {
+			operation["responses"] = map[string]any{"200": map[string]any{
+				"description": "OK",
+				"content":     map[string]any{"application/json": map[string]any{"schema": s.of(reflect.TypeOf(v))}},
+			}}
+		}
+		path = pathParameter.ReplaceAllString(path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(method)] = operation
+	}
+	return map[string]any{
+		"openapi":    "3.1.0",
+		"info":       map[string]any{"title": "simple-chess", "version": "1"},
+		"paths":      paths,
+		"components": map[string]any{"schemas": s.defs},
+	}
+}
+
+// messageSchemaHandler serves the JSON Schema of the messages of the
+// WebSocket protocol, for clients to generate their bindings from
+func messageSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(messageSchema())
+}
+
+//go:embed protocol.proto
+var protocolProto []byte
+
+// protocolProtoHandler serves the protobuf encoding of the messages
+func protocolProtoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(protocolProto)
+}
+
+// openAPIHandler serves the OpenAPI description of the REST API
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, openAPI())
+}
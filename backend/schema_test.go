@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSchemas(t *testing.T) {
+	get := func(path string, v any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+	type schema struct {
+		Ref        string         `json:"$ref"`
+		Required   []string       `json:"required"`
+		Properties map[string]any `json:"properties"`
+	}
+
+	var messages struct {
+		Ref  string            `json:"$ref"`
+		Defs map[string]schema `json:"$defs"`
+	}
+	get("/schema/messages.json", &messages)
+	message := messages.Defs[strings.TrimPrefix(messages.Ref, "#/$defs/")]
+	if _, ok := message.Properties["gameId"]; !ok || len(message.Required) != 1 {
+		t.Errorf("got %+v", message)
+	}
+	// the types of the fields are there as well, as the fields are encoded
+	if _, ok := messages.Defs["Notification"].Properties["createdAt"]; !ok {
+		t.Errorf("got %+v", messages.Defs["Notification"])
+	}
+
+	var api struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]schema `json:"schemas"`
+		} `json:"components"`
+	}
+	get("/openapi.json", &api)
+	if _, ok := api.Paths["/players/{id}/stats"]["get"]; !ok {
+		t.Errorf("got paths %v", api.Paths)
+	}
+	if _, ok := api.Paths["/ws"]; ok {
+		t.Error("the websocket described as REST")
+	}
+	var stats struct {
+		Responses map[string]struct {
+			Content map[string]struct {
+				Schema schema `json:"schema"`
+			} `json:"content"`
+		} `json:"responses"`
+	}
+	json.Unmarshal(api.Paths["/players/{id}/stats"]["get"], &stats)
+	if ref := stats.Responses["200"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/playerStats" {
+		t.Errorf("got %q", ref)
+	}
+	if _, ok := api.Components.Schemas["playerStats"].Properties["averageMoves"]; !ok {
+		t.Errorf("got %+v", api.Components.Schemas["playerStats"])
+	}
+	for pattern := range responseTypes {
+		method, path, _ := strings.Cut(pattern, " ")
+		if _, ok := api.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("%s is no route", pattern)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRatingBand = errors.New("invalid rating band")
+	ErrSeekExpired       = errors.New("seek expired")
+)
+
+// seekTTL is how long a seek waits for an opponent before it is withdrawn
+// from the lobby, for ever if 0
+var seekTTL = 15 * time.Minute
+
+// ratingBand is the ratings from Min to Max an opponent may have, either
+// left at 0 for no bound. Players without an account have no rating, only
+// the band with no bounds at all accepts them
+type ratingBand struct {
+	Min int `json:"min,omitempty"`
+	Max int `json:"max,omitempty"`
+}
+
+// parseRatingBand parses min-max, as in 1400-1800, 1400- or -1800
+func parseRatingBand(s string) (ratingBand, error) {
+	if s == "" {
+		return ratingBand{}, nil
+	}
+	low, high, ok := strings.Cut(s, "-")
+	if !ok || low == "" && high == "" {
+		return ratingBand{}, ErrInvalidRatingBand
+	}
+	var band ratingBand
+	var err error
+	if low != "" {
+		if band.Min, err = strconv.Atoi(low); err != nil || band.Min <= 0 {
+			return ratingBand{}, ErrInvalidRatingBand
+		}
+	}
+	if high != "" {
+		if band.Max, err = strconv.Atoi(high); err != nil || band.Max <= 0 || band.Max < band.Min {
+			return ratingBand{}, ErrInvalidRatingBand
+		}
+	}
+	return band, nil
+}
+
+// accepts tells whether an opponent of rating, if rated, is in band
+func (band ratingBand) accepts(rating int, rated bool) bool {
+	if band == (ratingBand{}) {
+		return true
+	}
+	return rated && rating >= band.Min && (band.Max == 0 || rating <= band.Max)
+}
+
+// poolRating is the rating in pool of the player id, if they have an
+// account
+func poolRating(id, pool string) (int, bool) {
+	if id == "" {
+		return 0, false
+	}
+	rating, err := playerRating(id, pool)
+	return rating, err == nil
+}
+
+// eligible tells whether conn and the creator of the seek game are in the
+// bands of each other, rated in the pool of the game, and whether the rules
+// of the game are those conn asks for
+func eligible(game *ChessGame, conn *connection) bool {
+	state := game.recorder.State()
+	pool := ratingPool(state)
+	seeker, seekerRated := poolRating(state.Players[game.creator], pool)
+	joiner, joinerRated := poolRating(conn.player, pool)
+	return game.band.accepts(joiner, joinerRated) && conn.band.accepts(seeker, seekerRated) &&
+		game.options.admits(game, conn)
+}
+
+// seek is a game waiting for an opponent as the lobby lists it; Player and
+// Rating are those of its creator if they have an account, Color the one
+// they play with
+type seek struct {
+	ID          string       `json:"id"`
+	Player      string       `json:"player,omitempty"`
+	Rating      int          `json:"rating,omitempty"`
+	Color       string       `json:"color"`
+	Pool        string       `json:"pool"`
+	TimeControl *TimeControl `json:"timeControl,omitempty"`
+	Band        ratingBand   `json:"band"`
+}
+
+// lobbyHandler lists the seeks the player of the bearer token, if any, can
+// join: those with a band they are in, and whose creator is in ?rating=
+func lobbyHandler(w http.ResponseWriter, r *http.Request) {
+	var viewer string
+	if r.Header.Get("Authorization") != "" {
+		player, err := requestPlayer(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		viewer = player.ID
+	}
+	band, err := parseRatingBand(r.URL.Query().Get("rating"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, listSeeks(viewer, band))
+}
+
+// listSeeks are the seeks the player viewer, if any, is shown by the lobby
+// asking for the creators in band
+func listSeeks(viewer string, band ratingBand) []seek {
+	list := []seek{}
+	for _, game := range games.Seeks() {
+		if s, ok := listedSeek(game, viewer, band); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// listedSeek is the seek game as the lobby lists it, reporting whether the
+// player viewer can join it and its creator is in band
+func listedSeek(game *ChessGame, viewer string, band ratingBand) (seek, bool) {
+	state := game.recorder.State()
+	s := seek{ID: game.id, Player: state.Players[game.creator], Color: game.creator, Pool: ratingPool(state), TimeControl: state.TimeControl, Band: game.band}
+	rating, rated := poolRating(s.Player, s.Pool)
+	if rated {
+		s.Rating = rating
+	}
+	return s, band.accepts(rating, rated) && game.band.accepts(poolRating(viewer, s.Pool))
+}
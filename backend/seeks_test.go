@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRatingBand(t *testing.T) {
+	for s, want := range map[string]ratingBand{"": {}, "1400-1800": {1400, 1800}, "1400-": {Min: 1400}, "-1800": {Max: 1800}} {
+		if got, err := parseRatingBand(s); err != nil || got != want {
+			t.Errorf("parsed %q as %+v, %v", s, got, err)
+		}
+	}
+	for _, invalid := range []string{"-", "1400", "1800-1400", "a-b", "0-100"} {
+		if _, err := parseRatingBand(invalid); err == nil {
+			t.Errorf("parsed %q", invalid)
+		}
+	}
+}
+
+func TestSeeksInRatingBands(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana, bo, carl := newPlayer("ana"), newPlayer("bo"), newPlayer("carl")
+	bo.Ratings["correspondence"] = Rating{Rating: 1900, Games: 20}
+	carl.Ratings["correspondence"] = Rating{Rating: 1550, Games: 20}
+	for _, player := range []*Player{&ana, &bo, &carl} {
+		startSession(player, "test")
+		players.Create(*player)
+	}
+	seeker, strong, near := newTestPlayer(t), newTestPlayer(t), newTestPlayer(t)
+	goOnline(seeker.conn, ana.ID)
+	goOnline(strong.conn, bo.ID)
+	goOnline(near.conn, carl.ID)
+	seeker.conn.band = ratingBand{1400, 1600}
+	for _, player := range []*testPlayer{seeker, strong} {
+		if err := games.Pair(context.Background(), player.conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seeks := games.Seeks()
+	if len(seeks) != 2 {
+		t.Fatalf("got %d seeks, bo must not have joined the one of ana", len(seeks))
+	}
+
+	lobby := func(token string) []seek {
+		r := httptest.NewRequest("GET", "/lobby", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, r)
+		list := []seek{}
+		json.Unmarshal(w.Body.Bytes(), &list)
+		return list
+	}
+	if list := lobby(bo.Token); len(list) != 1 || list[0].Player != bo.ID || list[0].Rating != 1900 {
+		t.Errorf("bo sees %+v", list)
+	}
+	if list := lobby(""); len(list) != 1 || list[0].ID != seeks[1].id {
+		t.Errorf("players without an account see %+v", list)
+	}
+	if list := lobby(carl.Token); len(list) != 2 || list[0].Band != (ratingBand{1400, 1600}) {
+		t.Errorf("carl sees %+v", list)
+	}
+
+	if err := games.Pair(context.Background(), near.conn); err != nil {
+		t.Fatal(err)
+	}
+	if got := near.expect("start"); got.GameID != seeks[0].id {
+		t.Errorf("carl joined %s, not the seek of ana", got.GameID)
+	}
+	seeker.expect("start")
+	strong.disconnect()
+	<-seeks[1].done
+	// the game is over before the player store is put back, for its loop
+	// to be done with the accounts
+	seeker.send(Message{Type: "resign"})
+	near.expect("game_over")
+	<-seeks[0].done
+	if seeks := games.Seeks(); len(seeks) != 0 {
+		t.Errorf("%d seeks left", len(seeks))
+	}
+}
+
+func TestSeekWithdrawal(t *testing.T) {
+	defer func(ttl time.Duration) { seekTTL = ttl }(seekTTL)
+	viewer := newTestPlayer(t)
+	joinLobby(viewer.conn)
+	viewer.expect("lobby")
+
+	seeker := newTestPlayer(t)
+	if err := games.Pair(context.Background(), seeker.conn); err != nil {
+		t.Fatal(err)
+	}
+	id := viewer.expect("seek").Seeks[0].ID
+	seeker.send(Message{Type: "cancel_seek"})
+	if got := seeker.expect("cancel_seek"); got.GameID != id {
+		t.Fatalf("got %+v", got)
+	}
+	if got := viewer.expect("seek_removed"); got.GameID != id {
+		t.Fatalf("got %+v, want %s removed", got, id)
+	}
+
+	seekTTL = 10 * time.Millisecond
+	seeker = newTestPlayer(t)
+	if err := games.Pair(context.Background(), seeker.conn); err != nil {
+		t.Fatal(err)
+	}
+	id = viewer.expect("seek").Seeks[0].ID
+	seeker.expect("error", CodeSeekExpired)
+	if got := viewer.expect("seek_removed"); got.GameID != id {
+		t.Fatalf("got %+v, want %s removed", got, id)
+	}
+
+	// once playing there is no seek to cancel
+	seekTTL = time.Minute
+	_, white, _ := startTestGame(t)
+	white.send(Message{Type: "cancel_seek"})
+	white.expect("error", CodeNotSeeking)
+}
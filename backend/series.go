@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMatchNotFound    = errors.New("match not found")
+	ErrMatchFull        = errors.New("match full")
+	ErrMatchOver        = errors.New("match over")
+	ErrInvalidMatchSize = errors.New("invalid match size")
+)
+
+// maxMatchGames bounds the games of a match
+const maxMatchGames = 20
+
+// series is a match of size games between the same two players, first who
+// created it and second who joined it. First plays white in the odd games
+// and black in the even ones. The match is decided once a player scored
+// more than half the games, or every game was played
+type series struct {
+	id   string
+	size int
+	// tokens let each player come back for the next game
+	tokens map[string]string
+
+	mu sync.Mutex
+	// joined is set once the second player is in
+	joined bool
+	games  []*ChessGame
+	// open is the next game, its white player waiting in it; waiting is
+	// its black player if back first, not read from until the game opens
+	open    *ChessGame
+	waiting *connection
+	// over is when the janitor found the match over, zero until then
+	over time.Time
+}
+
+// OpenMatch starts a match of size games, conn is its first player, white
+// in the first game
+func (m *gameManager) OpenMatch(ctx context.Context, conn *connection, size int) (*series, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.canCreate(); err != nil {
+		return nil, err
+	}
+	s := &series{id: newGameID(), size: size, tokens: map[string]string{"first": newToken(), "second": newToken()}}
+	m.series[s.id] = s
+	s.open = openGame(ctx, conn, "", nil, nil, 1)
+	s.open.series = s
+	conn.Write(Message{Type: "match", MatchID: s.id, Token: s.tokens["first"], Board: 1})
+	return s, nil
+}
+
+func (m *gameManager) FindMatch(id string) (*series, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[id]
+	return s, ok
+}
+
+// Join seats conn as the second player, or as the player token is of back
+// for the next game, which starts once both are. White waits in the game,
+// and is told so, black is not read from until white is there
+func (s *series) Join(ctx context.Context, conn *connection, token string) error {
+	games.mu.Lock()
+	defer games.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	player := ""
+	for p, t := range s.tokens {
+		if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			player = p
+		}
+	}
+	if player == "" {
+		if s.joined {
+			return ErrMatchFull
+		}
+		s.joined, player = true, "second"
+	}
+	if s.score().Decided {
+		return ErrMatchOver
+	}
+	if n := len(s.games); n > 0 && !s.games[n-1].recorder.State().Finished {
+		return ErrAlreadyConnected
+	}
+	if err := games.canCreate(); err != nil {
+		return err
+	}
+	next := len(s.games) + 1
+	// the white player left the game they waited in
+	if s.open != nil && s.open.isAbandoned() {
+		s.open = nil
+	}
+	if colorOf(player, next) == "white" {
+		if s.open != nil {
+			return ErrAlreadyConnected
+		}
+		s.open = openGame(ctx, conn, "", nil, nil, next)
+		s.open.series = s
+		conn.Write(Message{Type: "match", MatchID: s.id, Token: s.tokens[player], Board: next})
+		if s.waiting == nil {
+			return nil
+		}
+		conn, s.waiting = s.waiting, nil
+	} else if s.open == nil {
+		if s.waiting != nil {
+			closeWithError(s.waiting, ErrAlreadyConnected)
+		}
+		s.waiting = conn
+		return nil
+	}
+	game := s.open
+	s.open = nil
+	// registered first, as paired games are
+	games.active[game.id] = game
+	if err := game.Join(ctx, conn); err != nil {
+		delete(games.active, game.id)
+		return err
+	}
+	s.games = append(s.games, game)
+	return nil
+}
+
+// colorOf is the color player plays in game number n
+func colorOf(player string, n int) string {
+	if (player == "first") == (n%2 == 1) {
+		return "white"
+	}
+	return "black"
+}
+
+// matchScore is the points of each player, and who won once the match is
+// decided: first, second or nobody for a draw
+type matchScore struct {
+	First   float64 `json:"first"`
+	Second  float64 `json:"second"`
+	Decided bool    `json:"decided"`
+	Winner  string  `json:"winner,omitempty"`
+}
+
+// score counts the games finished; s.mu must be held
+func (s *series) score() matchScore {
+	var score matchScore
+	played := 0
+	for i, game := range s.games {
+		state := game.recorder.State()
+		if !state.Finished {
+			continue
+		}
+		played++
+		white := map[string]float64{"1-0": 1, "1/2-1/2": 0.5}[state.Result]
+		black := map[string]float64{"0-1": 1, "1/2-1/2": 0.5}[state.Result]
+		if colorOf("first", i+1) == "black" {
+			white, black = black, white
+		}
+		score.First += white
+		score.Second += black
+	}
+	half := float64(s.size) / 2
+	score.Decided = played == s.size || score.First > half || score.Second > half
+	switch {
+	case !score.Decided || score.First == score.Second:
+	case score.First > score.Second:
+		score.Winner = "first"
+	default:
+		score.Winner = "second"
+	}
+	return score
+}
+
+// scoreMessage tells the player at color of game how the match goes, with
+// the token to come back for the next game; they are sent it as the game
+// starts and once it is over
+func (s *series) scoreMessage(game *ChessGame, color string) Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	score := s.score()
+	player, mine, theirs := "first", score.First, score.Second
+	if colorOf("first", game.board) != color {
+		player, mine, theirs = "second", score.Second, score.First
+	}
+	message := Message{Type: "match", MatchID: s.id, Token: s.tokens[player], Board: game.board, Score: fmt.Sprintf("%g-%g", mine, theirs)}
+	if score.Decided {
+		switch score.Winner {
+		case "":
+			message.Result = "draw"
+		case player:
+			message.Result = "win"
+		default:
+			message.Result = "loss"
+		}
+	}
+	return message
+}
+
+// matchView is how a match is going, for anyone to follow
+type matchView struct {
+	ID     string      `json:"id"`
+	Games  int         `json:"games"`
+	Score  matchScore  `json:"score"`
+	Boards []matchGame `json:"boards"`
+}
+
+type matchGame struct {
+	Game   int    `json:"game"`
+	GameID string `json:"gameId"`
+	Slug   string `json:"slug,omitempty"`
+	// White is the player playing white, first or second
+	White    string `json:"white"`
+	Finished bool   `json:"finished"`
+	Result   string `json:"result,omitempty"`
+}
+
+func (s *series) view() matchView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	view := matchView{ID: s.id, Games: s.size, Score: s.score(), Boards: []matchGame{}}
+	for i, game := range s.games {
+		state := game.recorder.State()
+		white := "first"
+		if colorOf("first", i+1) == "black" {
+			white = "second"
+		}
+		view.Boards = append(view.Boards, matchGame{Game: i + 1, GameID: state.ID, Slug: state.Slug, White: white, Finished: state.Finished, Result: state.Result})
+	}
+	return view
+}
+
+func matchHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := games.FindMatch(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, s.view())
+}
+
+// joinMatch handles the connections asking for a match: ?match=new&games=N
+// creates one, the first connection with no token to it is the second
+// player, and both come back with the token they were sent for every next
+// game
+func joinMatch(ctx context.Context, conn *connection, id, token, size string) {
+	if id == "new" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 || n > maxMatchGames {
+			closeWithError(conn, ErrInvalidMatchSize, size, fmt.Sprint(maxMatchGames))
+			return
+		}
+		if _, err := games.OpenMatch(ctx, conn, n); err != nil {
+			closeWithError(conn, err)
+		}
+		return
+	}
+	s, ok := games.FindMatch(id)
+	if !ok {
+		closeWithError(conn, ErrMatchNotFound, id)
+		return
+	}
+	if err := s.Join(ctx, conn, token); err != nil {
+		closeWithError(conn, err)
+	}
+}
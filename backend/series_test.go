@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	ctx := context.Background()
+	first, second := newTestPlayer(t), newTestPlayer(t)
+	joinMatch(ctx, first.conn, "new", "", "3")
+	created := first.expect("match")
+	joinMatch(ctx, second.conn, created.MatchID, "", "")
+	first.expect("match")
+	joined := second.expect("match")
+	if joined.Token == "" || joined.Token == created.Token || joined.Board != 1 || joined.Score != "0-0" {
+		t.Fatalf("got %+v", joined)
+	}
+	intruder := newTestPlayer(t)
+	joinMatch(ctx, intruder.conn, created.MatchID, "", "")
+	intruder.expect("error", CodeMatchFull)
+
+	// play plays game number n of the match, where resigning loses it
+	play := func(n int, resigning string) (Message, Message) {
+		t.Helper()
+		if n > 1 {
+			first, second = newTestPlayer(t), newTestPlayer(t)
+			joinMatch(ctx, first.conn, created.MatchID, created.Token, "")
+			joinMatch(ctx, second.conn, created.MatchID, joined.Token, "")
+		}
+		white, black := first, second
+		if n%2 == 0 {
+			white, black = second, first
+		}
+		// white is told it waits for black, then both how the match goes
+		if n > 1 {
+			white.expect("match")
+			white.expect("match")
+			black.expect("match")
+		}
+		if got := white.expect("start"); got.Color != "white" || got.Board != n {
+			t.Fatalf("got %+v as white in game %d", got, n)
+		}
+		black.expect("start")
+		map[string]*testPlayer{"first": first, "second": second}[resigning].send(Message{Type: "resign"})
+		first.expect("game_over")
+		second.expect("game_over")
+		return first.expect("match"), second.expect("match")
+	}
+	if got, _ := play(1, "first"); got.Score != "0-1" || got.Result != "" {
+		t.Fatalf("got %+v after the first game", got)
+	}
+	if got, _ := play(2, "second"); got.Score != "1-1" {
+		t.Fatalf("got %+v after the second game", got)
+	}
+	lost, won := play(3, "first")
+	if lost.Score != "1-2" || lost.Result != "loss" || won.Score != "2-1" || won.Result != "win" {
+		t.Fatalf("got %+v and %+v once decided", lost, won)
+	}
+
+	late := newTestPlayer(t)
+	joinMatch(ctx, late.conn, created.MatchID, created.Token, "")
+	late.expect("error", CodeMatchOver)
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/matches/"+created.MatchID, nil))
+	view := matchView{}
+	json.Unmarshal(w.Body.Bytes(), &view)
+	if view.Score != (matchScore{First: 1, Second: 2, Decided: true, Winner: "second"}) || len(view.Boards) != 3 || view.Boards[1].White != "second" {
+		t.Errorf("got %+v", view)
+	}
+}
+
+func TestInvalidMatchSize(t *testing.T) {
+	player := newTestPlayer(t)
+	joinMatch(context.Background(), player.conn, "new", "", "100")
+	player.expect("error", CodeInvalidMatchSize)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// newServer configures an http.Server for addr from cfg, HTTP/2 is only
+// negotiated when it is served over TLS
+func newServer(cfg Config, addr string, handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	err := http2.ConfigureServer(server, &http2.Server{
+		MaxConcurrentStreams: cfg.HTTP2MaxConcurrentStreams,
+		MaxReadFrameSize:     cfg.HTTP2MaxReadFrameSize,
+		IdleTimeout:          cfg.IdleTimeout,
+	})
+	return server, err
+}
+
+// serve listens as spec says and serves server there
+func serve(cfg Config, spec listenerSpec, server *http.Server) error {
+	listener, err := listen(cfg, spec)
+	if err != nil {
+		return err
+	}
+	if spec.TLS {
+		return server.ServeTLS(listener, cfg.TLSCert, cfg.TLSKey)
+	}
+	return server.Serve(listener)
+}
+
+func listen(cfg Config, spec listenerSpec) (net.Listener, error) {
+	if spec.Network == "unix" {
+		return listenUnix(spec.Addr)
+	}
+	listenConfig := net.ListenConfig{KeepAlive: cfg.TCPKeepAlive}
+	return listenConfig.Listen(context.Background(), "tcp", spec.Addr)
+}
+
+// listenUnix listens on the Unix socket at path, for a reverse proxy on the
+// same host; a socket left behind by a previous run is replaced
+func listenUnix(path string) (net.Listener, error) {
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil && info.Mode().Type() != fs.ModeSocket:
+		return nil, fmt.Errorf("%s exists and is not a socket", path)
+	case err == nil:
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// keepOpen lifts the write timeout of a response that stays open longer
+// than the server allows, like an event stream or a long poll
+func keepOpen(w http.ResponseWriter) {
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// the most sessions a player keeps, logging in once more logs out the
+// oldest, and how much of the client of a session is kept
+const (
+	maxSessions     = 20
+	maxClientLength = 200
+)
+
+var errSessionNotFound = errors.New("session not found")
+
+// Session is a login of a player, as on one of their devices. Its token is
+// only answered to whoever logged in, the session keeps its hash
+type Session struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Current marks, when listing them, the session asking
+	Current bool `json:"current,omitempty"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// startSession starts a session of player on client, the User-Agent it
+// logged in with, setting its token as that of player
+func startSession(player *Player, client string) {
+	if len(client) > maxClientLength {
+		client = strings.ToValidUTF8(client[:maxClientLength], "")
+	}
+	token := newPlayerToken(player.ID)
+	player.Sessions = append(player.Sessions, Session{ID: newGameID(), Hash: hashToken(token), Client: client, CreatedAt: time.Now().UTC()})
+	if len(player.Sessions) > maxSessions {
+		player.Sessions = player.Sessions[len(player.Sessions)-maxSessions:]
+	}
+	player.Token = token
+}
+
+// openSession logs in as the player id from the client of r
+func openSession(id string, r *http.Request) (Player, error) {
+	var opened Player
+	err := players.Update(id, func(player *Player) error {
+		startSession(player, r.UserAgent())
+		opened = *player
+		return nil
+	})
+	return opened, err
+}
+
+// session is the index of the session of player token is of, or -1
+func session(player Player, token string) int {
+	hash := []byte(hashToken(token))
+	for i, s := range player.Sessions {
+		if subtle.ConstantTimeCompare(hash, []byte(s.Hash)) == 1 {
+			return i
+		}
+	}
+	return -1
+}
+
+func requestToken(r *http.Request) string {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+// sessionsHandler lists the sessions of the player authenticated, the
+// devices they are logged in on
+func sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	current := session(player, requestToken(r))
+	list := []Session{}
+	for i, s := range player.Sessions {
+		s.Hash, s.Current = "", i == current
+		list = append(list, s)
+	}
+	writeJSON(w, list)
+}
+
+// revokeSessionHandler logs out the session of the path, whose token is
+// refused from then on
+func revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	err := revokeSessions(player.ID, func(s Session) bool { return s.ID == r.PathValue("session") })
+	if errors.Is(err, errSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeOtherSessionsHandler logs out every session of the player but the
+// one asking, as in logging out of other devices
+func revokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	// asking with an access token logs out every session
+	current := ""
+	if i := session(player, requestToken(r)); i >= 0 {
+		current = player.Sessions[i].ID
+	}
+	err := revokeSessions(player.ID, func(s Session) bool { return s.ID != current })
+	if err != nil && !errors.Is(err, errSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeSessions logs out the sessions of the player id revoked is true
+// of, errSessionNotFound if none
+func revokeSessions(id string, revoked func(Session) bool) error {
+	return players.Update(id, func(player *Player) error {
+		kept := []Session{}
+		for _, s := range player.Sessions {
+			if !revoked(s) {
+				kept = append(kept, s)
+			}
+		}
+		if len(kept) == len(player.Sessions) {
+			return errSessionNotFound
+		}
+		player.Sessions = kept
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSessions(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana := newPlayer("ana")
+	startSession(&ana, "phone")
+	phone := ana.Token
+	startSession(&ana, "laptop")
+	laptop := ana.Token
+	startSession(&ana, "tablet")
+	tablet := ana.Token
+	players.Create(ana)
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		newPublicMux().ServeHTTP(w, r)
+		return w
+	}
+	w := do("GET", "/players/"+ana.ID+"/sessions", laptop)
+	var list []Session
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list) != 3 || list[0].Client != "phone" || !list[1].Current || list[0].Current || list[1].Hash != "" {
+		t.Fatalf("got %d %+v", w.Code, list)
+	}
+	if w := do("DELETE", "/players/"+ana.ID+"/sessions/"+list[0].ID, laptop); w.Code != http.StatusNoContent {
+		t.Fatalf("got %d revoking the phone", w.Code)
+	}
+	if _, err := authenticate(phone); err == nil {
+		t.Error("the phone is still logged in")
+	}
+	if w := do("DELETE", "/players/"+ana.ID+"/sessions/"+list[0].ID, laptop); w.Code != http.StatusNotFound {
+		t.Errorf("got %d revoking the phone again", w.Code)
+	}
+
+	// logging out of other devices
+	if w := do("DELETE", "/players/"+ana.ID+"/sessions", laptop); w.Code != http.StatusNoContent {
+		t.Fatalf("got %d", w.Code)
+	}
+	if _, err := authenticate(laptop); err != nil {
+		t.Errorf("the laptop was logged out: %v", err)
+	}
+	transport := newMemTransport()
+	player := &testPlayer{t: t, transport: transport}
+	_, span := tracer.Start(context.Background(), "test")
+	admit(context.Background(), span, httptest.NewRequest("GET", "/ws?auth="+url.QueryEscape(tablet), nil), transport)
+	player.expect("error", CodeInvalidPlayerToken)
+
+	if stored, _ := players.Load(ana.ID); stored.Token != "" || len(stored.Sessions) != 1 {
+		t.Errorf("stored %+v", stored)
+	}
+}
+
+func TestOldestSessionIsLoggedOut(t *testing.T) {
+	player := newPlayer("ana")
+	startSession(&player, "first")
+	first := player.Token
+	for range maxSessions {
+		startSession(&player, "")
+	}
+	if len(player.Sessions) != maxSessions || session(player, first) >= 0 || session(player, player.Token) != maxSessions-1 {
+		t.Errorf("got %d sessions", len(player.Sessions))
+	}
+}
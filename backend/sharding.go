@@ -0,0 +1,138 @@
+package main
+
+import (
+	"hash/crc32"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ringReplicas is how many points every instance has on the ring, for the
+// games to be shared out evenly
+const ringReplicas = 128
+
+// membershipEvery is how often an instance tells the others it is up and
+// learns who they are, membershipTTL how long one that stopped is still
+// thought up
+var (
+	membershipEvery = 5 * time.Second
+	membershipTTL   = 15 * time.Second
+)
+
+// hashRing shares the game IDs out among instances by consistent hashing:
+// an instance joining or leaving only changes the owner of the games
+// between its points and those before them
+type hashRing struct {
+	members []string
+	points  []uint32
+	owners  map[uint32]string
+}
+
+func newHashRing(members []string) *hashRing {
+	ring := &hashRing{members: slices.Clone(members), owners: map[uint32]string{}}
+	sort.Strings(ring.members)
+	for _, member := range ring.members {
+		for i := range ringReplicas {
+			point := crc32.ChecksumIEEE([]byte(member + "#" + strconv.Itoa(i)))
+			ring.points = append(ring.points, point)
+			ring.owners[point] = member
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	return ring
+}
+
+// owner is the instance the game id hashes to, empty on an empty ring
+func (ring *hashRing) owner(id string) string {
+	if len(ring.points) == 0 {
+		return ""
+	}
+	hash := crc32.ChecksumIEEE([]byte(id))
+	i := sort.Search(len(ring.points), func(i int) bool { return ring.points[i] >= hash })
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.owners[ring.points[i]]
+}
+
+func (ring *hashRing) has(member string) bool {
+	_, found := slices.BinarySearch(ring.members, member)
+	return found
+}
+
+// ring is the one of the instances of the deployment up, as learnt last
+var ring atomic.Pointer[hashRing]
+
+// currentRing is ring, with this instance alone until it learns the others
+func currentRing() *hashRing {
+	if r := ring.Load(); r != nil {
+		return r
+	}
+	return newHashRing([]string{instanceURL})
+}
+
+// newShardedGameID is a game ID this instance owns on the ring, the games
+// it creates being found there; one it happens not to own is claimed
+func newShardedGameID() string {
+	id := newGameID()
+	if instanceURL == "" {
+		return id
+	}
+	r := currentRing()
+	for try := 0; try < 16*len(r.members) && r.owner(id) != instanceURL; try++ {
+		id = newGameID()
+	}
+	return id
+}
+
+// watchMembership has the instance tell the others it is up, then learn
+// who they are, every membershipEvery, rebalancing as they come and go;
+// it adopts the games handed off to it nobody came to meanwhile
+func watchMembership(registry GameRegistry) {
+	for {
+		now := time.Now()
+		if err := registry.Heartbeat(instanceURL, now); err != nil {
+			log.Printf("cannot tell the other instances this one is up: %v", err)
+		}
+		members, err := registry.Members(now.Add(-membershipTTL))
+		if err != nil {
+			log.Printf("cannot find the other instances: %v", err)
+		} else {
+			if !slices.Contains(members, instanceURL) {
+				members = append(members, instanceURL)
+			}
+			next := newHashRing(members)
+			if previous := currentRing(); !slices.Equal(previous.members, next.members) {
+				log.Printf("instances up: %v", next.members)
+				ring.Store(next)
+				rebalance(registry, next)
+			}
+		}
+		adoptHandedOff(registry)
+		time.Sleep(membershipEvery)
+	}
+}
+
+// rebalance claims the games this instance plays that hash to another one
+// on ring, for them to still be found here. The others are left alone,
+// only the games between the points of an instance joining and those
+// before them change owner
+func rebalance(registry GameRegistry, ring *hashRing) {
+	moved := 0
+	for _, game := range games.List() {
+		if ring.owner(game.id) == instanceURL {
+			continue
+		}
+		if err := registry.Claim(game.id, instanceURL); err != nil {
+			log.Printf("cannot claim game %s: %v", game.id, err)
+			continue
+		}
+		moved++
+	}
+	if moved > 0 {
+		log.Printf("%d games now hash to other instances, claimed to be found here", moved)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHashRing(t *testing.T) {
+	three := newHashRing([]string{"https://a", "https://b", "https://c"})
+	four := newHashRing([]string{"https://d", "https://c", "https://b", "https://a"})
+	owned, moved := map[string]int{}, 0
+	for i := range 3000 {
+		id := fmt.Sprint("game", i)
+		owned[three.owner(id)]++
+		if before, after := three.owner(id), four.owner(id); before != after {
+			if after != "https://d" {
+				t.Fatalf("game %s moved from %s to %s", id, before, after)
+			}
+			moved++
+		}
+	}
+	for member, n := range owned {
+		if n < 600 || n > 1400 {
+			t.Errorf("%s owns %d of 3000 games", member, n)
+		}
+	}
+	// only the games of the instance joining change owner, about a quarter
+	if moved < 400 || moved > 1200 {
+		t.Errorf("%d of 3000 games moved", moved)
+	}
+	if got := newHashRing(nil).owner("game"); got != "" {
+		t.Errorf("got %s on an empty ring", got)
+	}
+}
+
+func TestShardedGameIDs(t *testing.T) {
+	defer func(u string) { instanceURL = u }(instanceURL)
+	defer ring.Store(ring.Load())
+	instanceURL = "https://a"
+	ring.Store(newHashRing([]string{"https://a", "https://b", "https://c"}))
+	for range 20 {
+		if id := newShardedGameID(); ring.Load().owner(id) != instanceURL {
+			t.Errorf("game %s hashes to %s", id, ring.Load().owner(id))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// shortLinks maps the slugs of the games to their IDs, slugs are short
+// enough to share and random enough that games cannot be found by guessing
+var shortLinks = struct {
+	mu  sync.Mutex
+	ids map[string]string
+}{ids: map[string]string{}}
+
+// slugSize is in random bytes, 6 give slugs of 8 characters
+const slugSize = 6
+
+// newShortLink picks an unused slug for the game id
+func newShortLink(id string) string {
+	shortLinks.mu.Lock()
+	defer shortLinks.mu.Unlock()
+	for {
+		b := make([]byte, slugSize)
+		rand.Read(b)
+		slug := base64.RawURLEncoding.EncodeToString(b)
+		if _, taken := shortLinks.ids[slug]; !taken {
+			shortLinks.ids[slug] = id
+			return slug
+		}
+	}
+}
+
+// indexShortLinks learns the slugs of the games in the store,
+// those created before the server started
+func indexShortLinks() error {
+	ids, err := store.GameIDs()
+	if err != nil {
+		return err
+	}
+	shortLinks.mu.Lock()
+	defer shortLinks.mu.Unlock()
+	for _, id := range ids {
+		events, err := store.Load(id)
+		if err != nil {
+			return err
+		}
+		// games recorded before there were slugs have none
+		if len(events) > 0 && events[0].Slug != "" {
+			shortLinks.ids[events[0].Slug] = id
+		}
+	}
+	return nil
+}
+
+// shortLinkHandler sends whoever follows the short link of a game to watch
+// it live while it is played, and to its replay once it is over
+func shortLinkHandler(w http.ResponseWriter, r *http.Request) {
+	shortLinks.mu.Lock()
+	id, ok := shortLinks.ids[r.PathValue("slug")]
+	shortLinks.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	r.SetPathValue("id", id)
+	state, ok := loadWatchedGame(w, r)
+	if !ok {
+		return
+	}
+	target := "/embed/" + id
+	if state.Finished {
+		target = "/games/" + id + "/gif"
+	}
+	// the spectator token of a private game goes along
+	if token := r.URL.Query().Get("token"); token != "" {
+		target += "?token=" + url.QueryEscape(token)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
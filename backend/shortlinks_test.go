@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func followShortLink(t *testing.T, slug string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/g/"+slug, nil))
+	return w
+}
+
+func TestShortLinkFollowsTheGame(t *testing.T) {
+	game, white, black := startTestGame(t)
+	if len(game.slug) != 8 || Replay(mustLoad(t, game.id)).Slug != game.slug {
+		t.Fatalf("got slug %q", game.slug)
+	}
+	if w := followShortLink(t, game.slug); w.Code != http.StatusFound || w.Header().Get("Location") != "/embed/"+game.id {
+		t.Errorf("got %d to %s while playing", w.Code, w.Header().Get("Location"))
+	}
+	black.send(Message{Type: "resign"})
+	white.expect("game_over")
+	waitFor(t, func() bool { return game.recorder.State().Finished })
+	if w := followShortLink(t, game.slug); w.Header().Get("Location") != "/games/"+game.id+"/gif" {
+		t.Errorf("got %d to %s once over", w.Code, w.Header().Get("Location"))
+	}
+	if w := followShortLink(t, "nope"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for an unknown slug", w.Code)
+	}
+}
+
+func mustLoad(t *testing.T, id string) []Event {
+	t.Helper()
+	events, err := store.Load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSimulNotFound = errors.New("simul not found")
+	ErrSimulFull     = errors.New("simul full")
+)
+
+// maxSimulBoards bounds the boards of a simul
+const maxSimulBoards = 50
+
+// simul is a simultaneous exhibition: a host playing white on every board,
+// each against an opponent of its own, moving on one board after the other
+type simul struct {
+	id string
+	// token lets the host open the boards of the simul
+	token string
+	size  int
+
+	mu     sync.Mutex
+	boards []*ChessGame
+	// current is the board the host is at
+	current int
+	// over is when the janitor found every board done, zero until then
+	over time.Time
+}
+
+// OpenSimul starts a simul of size boards, conn is the host at the first one
+func (m *gameManager) OpenSimul(ctx context.Context, conn *connection, size int) (*simul, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.canCreate(); err != nil {
+		return nil, err
+	}
+	s := &simul{id: newGameID(), token: newToken(), size: size}
+	m.simuls[s.id] = s
+	s.boards = append(s.boards, newSimulBoard(ctx, conn, s, 1))
+	conn.Write(Message{Type: "simul", SimulID: s.id, Token: s.token, Board: 1})
+	return s, nil
+}
+
+func (m *gameManager) FindSimul(id string) (*simul, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.simuls[id]
+	return s, ok
+}
+
+// newSimulBoard opens board number board of s with the host at it, the
+// host is told about it once the board is set up
+// Simuls are the simuls going on, and those over the janitor is yet to remove
+func (m *gameManager) Simuls() []*simul {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]*simul, 0, len(m.simuls))
+	for _, s := range m.simuls {
+		list = append(list, s)
+	}
+	return list
+}
+
+func newSimulBoard(ctx context.Context, conn *connection, s *simul, board int) *ChessGame {
+	return openGame(ctx, conn, "", s, nil, board)
+}
+
+// OpenBoard puts the host, connected over conn, at the next board nobody
+// sits at, replacing those the host left before an opponent came
+func (s *simul) OpenBoard(ctx context.Context, conn *connection) error {
+	games.mu.Lock()
+	defer games.mu.Unlock()
+	if err := games.canCreate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, board := range s.boards {
+		if board.isAbandoned() && !board.hasJoined() {
+			s.boards[i] = newSimulBoard(ctx, conn, s, i+1)
+			conn.Write(Message{Type: "simul", SimulID: s.id, Board: i + 1})
+			return nil
+		}
+	}
+	if len(s.boards) == s.size {
+		return ErrSimulFull
+	}
+	s.boards = append(s.boards, newSimulBoard(ctx, conn, s, len(s.boards)+1))
+	conn.Write(Message{Type: "simul", SimulID: s.id, Board: len(s.boards)})
+	return nil
+}
+
+// Join seats conn as the opponent at the first board open for one
+func (s *simul) Join(ctx context.Context, conn *connection) error {
+	// one opponent at a time, a board is never registered twice
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, board := range s.boards {
+		if board.hasJoined() {
+			continue
+		}
+		// registered first, as paired games are
+		games.Register(board)
+		err := board.Join(ctx, conn)
+		if err == nil {
+			return nil
+		}
+		games.Unregister(board)
+		if !errors.Is(err, errWaitingPlayerLeft) && !errors.Is(err, ErrCannotJoinStartedGame) {
+			return err
+		}
+	}
+	return ErrSimulFull
+}
+
+// hostAt reports whether the host is at game, the host moves on the
+// boards being played one after the other
+func (s *simul) hostAt(game *ChessGame) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.boards {
+		n := (s.current + i) % len(s.boards)
+		if state := s.boards[n].recorder.State(); state.Started && !state.Finished {
+			s.current = n
+			return s.boards[n] == game
+		}
+	}
+	return false
+}
+
+// hostMoved sends the host on to the next board once it moved at game
+func (s *simul) hostMoved(game *ChessGame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.boards[s.current] == game {
+		s.current = (s.current + 1) % len(s.boards)
+	}
+}
+
+// simulView is how a simul is going, for spectators
+type simulView struct {
+	ID     string       `json:"id"`
+	Boards []simulBoard `json:"boards"`
+	// Current is the board the host is at
+	Current int `json:"current"`
+	// Wins, Draws and Losses are the results of the host so far
+	Wins   int `json:"wins"`
+	Draws  int `json:"draws"`
+	Losses int `json:"losses"`
+}
+
+type simulBoard struct {
+	Board    int    `json:"board"`
+	GameID   string `json:"gameId"`
+	Slug     string `json:"slug,omitempty"`
+	Started  bool   `json:"started"`
+	Finished bool   `json:"finished"`
+	Result   string `json:"result,omitempty"`
+	Moves    int    `json:"moves"`
+	Turn     string `json:"turn"`
+}
+
+func (s *simul) view() simulView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	view := simulView{ID: s.id, Boards: []simulBoard{}, Current: s.current + 1}
+	for i, board := range s.boards {
+		state := board.recorder.State()
+		view.Boards = append(view.Boards, simulBoard{
+			Board:    i + 1,
+			GameID:   state.ID,
+			Slug:     state.Slug,
+			Started:  state.Started,
+			Finished: state.Finished,
+			Result:   state.Result,
+			Moves:    len(state.Moves),
+			Turn:     state.Turn(),
+		})
+		switch state.Result {
+		case "1-0":
+			view.Wins++
+		case "1/2-1/2":
+			view.Draws++
+		case "0-1":
+			view.Losses++
+		}
+	}
+	return view
+}
+
+func simulHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := games.FindSimul(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, s.view())
+}
+
+// joinSimul handles the connections asking for a simul: ?simul=new&boards=N
+// opens one with its host at the first board, the host opens the others
+// with the token it was sent and any other connection takes a free board
+func joinSimul(ctx context.Context, conn *connection, id, token, boards string) {
+	if id == "new" {
+		size, err := strconv.Atoi(boards)
+		if err != nil || size < 1 || size > maxSimulBoards {
+			closeWithError(conn, ErrInvalidSimulSize, boards, fmt.Sprint(maxSimulBoards))
+			return
+		}
+		if _, err := games.OpenSimul(ctx, conn, size); err != nil {
+			closeWithError(conn, err)
+		}
+		return
+	}
+	s, ok := games.FindSimul(id)
+	if !ok {
+		closeWithError(conn, ErrSimulNotFound, id)
+		return
+	}
+	var err error
+	if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1 {
+		err = s.OpenBoard(ctx, conn)
+	} else {
+		err = s.Join(ctx, conn)
+	}
+	if err != nil {
+		closeWithError(conn, err)
+	}
+}
+
+var ErrInvalidSimulSize = errors.New("invalid simul size")
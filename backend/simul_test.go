@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimulHostPlaysTheBoardsInTurn(t *testing.T) {
+	host := []*testPlayer{newTestPlayer(t), newTestPlayer(t)}
+	s, err := games.OpenSimul(context.Background(), host[0].conn, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := host[0].expect("simul")
+	if err := s.OpenBoard(context.Background(), host[1].conn); err != nil {
+		t.Fatal(err)
+	}
+	if got := host[1].expect("simul"); got.Board != 2 || got.SimulID != opened.SimulID {
+		t.Fatalf("got %+v", got)
+	}
+	if err := s.OpenBoard(context.Background(), newTestPlayer(t).conn); err != ErrSimulFull {
+		t.Errorf("got %v opening a third board", err)
+	}
+
+	opponents := []*testPlayer{newTestPlayer(t), newTestPlayer(t)}
+	for i, opponent := range opponents {
+		if err := s.Join(context.Background(), opponent.conn); err != nil {
+			t.Fatal(err)
+		}
+		if got := opponent.expect("start"); got.Color != "black" || got.Board != i+1 {
+			t.Errorf("opponent %d got %+v", i, got)
+		}
+		host[i].expect("start")
+	}
+	if err := s.Join(context.Background(), newTestPlayer(t).conn); err != ErrSimulFull {
+		t.Errorf("got %v joining a full simul", err)
+	}
+
+	// the host starts at the first board, then goes on to the second
+	host[1].send(move("1", "e2", "e4"))
+	host[1].expect("error", CodeHostAtAnotherBoard)
+	host[0].send(move("2", "e2", "e4"))
+	opponents[0].expect("move")
+	host[1].send(move("3", "d2", "d4"))
+	opponents[1].expect("move")
+
+	opponents[0].send(Message{Type: "resign"})
+	host[0].expect("game_over")
+	waitFor(t, func() bool { return s.view().Wins == 1 })
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/simuls/"+s.id, nil))
+	view := simulView{}
+	json.Unmarshal(w.Body.Bytes(), &view)
+	if len(view.Boards) != 2 || view.Wins != 1 || view.Boards[1].Moves != 1 {
+		t.Errorf("got %+v", view)
+	}
+}
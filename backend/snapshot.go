@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+type gameSnapshot struct {
+	Tokens map[string]string `json:"tokens"`
+	State  GameState         `json:"state"`
+}
+
+func checkpointGames(path string, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := writeSnapshot(path); err != nil {
+			log.Println("checkpoint:", err)
+		}
+	}
+}
+
+func writeSnapshot(path string) error {
+	snapshots := []gameSnapshot{}
+	for _, game := range games.List() {
+		snapshots = append(snapshots, gameSnapshot{Tokens: game.seatTokens(), State: game.recorder.State()})
+	}
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		return err
+	}
+	// the snapshot holds resume tokens, keep it private
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// restoreGames registers again every unfinished game of the last snapshot,
+// returning how many were restored
+func restoreGames(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	snapshots := []gameSnapshot{}
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return 0, err
+	}
+	restored := 0
+	for _, snapshot := range snapshots {
+		state := catchUp(snapshot.State)
+		if state.Finished {
+			continue
+		}
+		restoreChessGame(snapshot.Tokens, state)
+		restored++
+	}
+	return restored, nil
+}
+
+// catchUp is state with the events recorded after it was snapshot replayed
+// on top of it
+func catchUp(state GameState) GameState {
+	if events, err := store.Load(state.ID); err == nil {
+		for _, event := range events {
+			if event.Seq > state.Seq {
+				state.Apply(event)
+			}
+		}
+	}
+	return state
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+)
+
+// canWatch reports whether r may see the game of state: anyone can watch a
+// public game, a private one needs ?token= set to one of its spectator
+// tokens. Resume tokens are not accepted, links get shared and would let
+// whoever follows them play
+func canWatch(r *http.Request, state GameState) bool {
+	return canWatchWith(r.URL.Query().Get("token"), state)
+}
+
+// canWatchWith is canWatch given the spectator token
+func canWatchWith(spectatorToken string, state GameState) bool {
+	if !state.Private {
+		return true
+	}
+	token := []byte(spectatorToken)
+	for _, issued := range state.SpectatorTokens {
+		if subtle.ConstantTimeCompare(token, []byte(issued)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// loadWatchedGame rebuilds the state of the game of r if r may watch it
+func loadWatchedGame(w http.ResponseWriter, r *http.Request) (GameState, bool) {
+	state, _, ok := loadWatchedEvents(w, r)
+	return state, ok
+}
+
+// loadWatchedEvents is loadWatchedGame keeping the events too, as far as
+// spectators are shown them: those of a rated game being played are kept
+// behind unless r plays it, see spectatorCutoff
+func loadWatchedEvents(w http.ResponseWriter, r *http.Request) (GameState, []Event, bool) {
+	state, events, ok := loadLiveEvents(w, r)
+	if !ok {
+		return GameState{}, nil, false
+	}
+	if n := spectatorCutoff(state, events, time.Now()); n < len(events) && !playsIn(r, state) {
+		events = events[:n]
+		state = Replay(events)
+	}
+	return state, events, true
+}
+
+// loadLiveEvents is loadWatchedEvents with every event, for the streams
+// holding them back as they go, see heldEvents
+func loadLiveEvents(w http.ResponseWriter, r *http.Request) (GameState, []Event, bool) {
+	events, ok := loadEvents(w, r)
+	if !ok {
+		return GameState{}, nil, false
+	}
+	state := Replay(events)
+	if !canWatch(r, state) {
+		http.Error(w, "the game is private, a spectator token is needed to watch it", http.StatusForbidden)
+		return GameState{}, nil, false
+	}
+	return state, events, true
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestPrivateGameNeedsSpectatorToken(t *testing.T) {
+	white, black := newTestPlayer(t), newTestPlayer(t)
+	black.conn.options.Private = true
+	for _, player := range []*testPlayer{white, black} {
+		if err := games.Pair(context.Background(), player.conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id := white.expect("start").GameID
+	black.expect("start")
+
+	if w := embedded(t, id, "text/html"); w.Code != http.StatusForbidden {
+		t.Fatalf("got %d without a token", w.Code)
+	}
+	white.send(Message{Type: "spectator_token"})
+	token := white.expect("spectator_token").Token
+	if w := embedded(t, id+"?token=nope", "text/html"); w.Code != http.StatusForbidden {
+		t.Errorf("got %d with a wrong token", w.Code)
+	}
+	if w := embedded(t, id+"?token="+token, "text/html"); w.Code != http.StatusOK {
+		t.Errorf("got %d with a spectator token", w.Code)
+	}
+}
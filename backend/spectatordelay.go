@@ -0,0 +1,112 @@
+package main
+
+import "time"
+
+// spectatorDelayMoves and spectatorDelay are how far behind the game the
+// spectators of rated games being played are kept, for nobody watching to
+// pass the moves on to a player: they are not shown its last
+// spectatorDelayMoves moves, nor what was recorded less than
+// spectatorDelay ago. Neither holds anything back if 0, and everything is
+// shown once the game is over
+var (
+	spectatorDelayMoves int
+	spectatorDelay      time.Duration
+)
+
+// spectatorCutoff is how many of events, those of the game of state so
+// far, its spectators are shown at now
+func spectatorCutoff(state GameState, events []Event, now time.Time) int {
+	cutoff := len(events)
+	if state.Finished || !isRated(state) {
+		return cutoff
+	}
+	if spectatorDelayMoves > 0 {
+		held := 0
+		for i := len(events) - 1; i >= 0 && held < spectatorDelayMoves; i-- {
+			if events[i].Type == MoveMade {
+				held++
+				cutoff = i
+			}
+		}
+	}
+	if spectatorDelay > 0 {
+		for i := range cutoff {
+			if events[i].Time.After(now.Add(-spectatorDelay)) {
+				cutoff = i
+				break
+			}
+		}
+	}
+	return cutoff
+}
+
+// heldEvents are the events of a game followed live, as they are recorded,
+// handed to its spectators as spectatorCutoff lets
+type heldEvents struct {
+	// state is that of the game with every event, shown or not
+	state  GameState
+	events []Event
+	shown  int
+	// playing is set for the players of the game, who are shown what
+	// they play as it is
+	playing bool
+}
+
+func newHeldEvents(events []Event, playing bool) *heldEvents {
+	return &heldEvents{state: Replay(events), events: events, playing: playing}
+}
+
+// add holds the event just recorded, reporting false if it already was
+func (h *heldEvents) add(event Event) bool {
+	if event.Seq <= h.state.Seq {
+		return false
+	}
+	h.state.Apply(event)
+	h.events = append(h.events, event)
+	return true
+}
+
+// release is what is shown at now that was not yet
+func (h *heldEvents) release(now time.Time) []Event {
+	cutoff := len(h.events)
+	if !h.playing {
+		cutoff = spectatorCutoff(h.state, h.events, now)
+	}
+	if cutoff <= h.shown {
+		return nil
+	}
+	released := h.events[h.shown:cutoff]
+	h.shown = cutoff
+	return released
+}
+
+// nextRelease is when what is held may be shown, as far as spectatorDelay
+// goes; zero if it does not hold anything
+func (h *heldEvents) nextRelease() time.Time {
+	if h.shown == len(h.events) || spectatorDelay == 0 || h.playing {
+		return time.Time{}
+	}
+	return h.events[h.shown].Time.Add(spectatorDelay)
+}
+
+// wake fires at nextRelease, if it is still to come; moves held back are
+// released as the next ones are made instead
+func (h *heldEvents) wake(now time.Time) <-chan time.Time {
+	if at := h.nextRelease(); at.After(now) {
+		return time.After(at.Sub(now))
+	}
+	return nil
+}
+
+// shownSeq is the sequence number of the last event shown, 0 for none
+func (h *heldEvents) shownSeq() int {
+	if h.shown == 0 {
+		return 0
+	}
+	return h.events[h.shown-1].Seq
+}
+
+// over reports whether the game is over and all of it shown
+func (h *heldEvents) over() bool {
+	return h.state.Finished && h.shown == len(h.events)
+}
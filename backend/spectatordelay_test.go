@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpectatorCutoff(t *testing.T) {
+	defer func(moves int, delay time.Duration) {
+		spectatorDelayMoves, spectatorDelay = moves, delay
+	}(spectatorDelayMoves, spectatorDelay)
+	now := time.Now()
+	events := []Event{
+		{Type: GameCreated, Time: now.Add(-time.Minute)},
+		{Type: PlayerJoined, Color: "white", Player: "alice", Time: now.Add(-time.Minute)},
+		{Type: PlayerJoined, Color: "black", Player: "bob", Time: now.Add(-time.Minute)},
+		{Type: GameStarted, Time: now.Add(-time.Minute)},
+		{Type: MoveMade, Color: "white", Move: &Move{From: "e2", To: "e4"}, Time: now.Add(-30 * time.Second)},
+		{Type: DrawOffered, Color: "white", Time: now.Add(-20 * time.Second)},
+		{Type: MoveMade, Color: "black", Move: &Move{From: "e7", To: "e5"}, Time: now.Add(-10 * time.Second)},
+		{Type: MoveMade, Color: "white", Move: &Move{From: "g1", To: "f3"}, Time: now.Add(-time.Second)},
+	}
+	rated := Replay(events)
+	for _, test := range []struct {
+		moves int
+		delay time.Duration
+		state GameState
+		want  int
+	}{
+		{0, 0, rated, 8},
+		{1, 0, rated, 7},
+		{2, 0, rated, 6},
+		{5, 0, rated, 4},
+		{0, 15 * time.Second, rated, 6},
+		{1, 25 * time.Second, rated, 5},
+		{2, 0, GameState{Players: rated.Players, Casual: true}, 8},
+		{2, 0, GameState{Players: rated.Players, Finished: true}, 8},
+	} {
+		spectatorDelayMoves, spectatorDelay = test.moves, test.delay
+		if got := spectatorCutoff(test.state, events, now); got != test.want {
+			t.Errorf("%d moves %v: got %d, want %d", test.moves, test.delay, got, test.want)
+		}
+	}
+}
+
+func TestDelayedGameEvents(t *testing.T) {
+	defer func(moves int) { spectatorDelayMoves = moves }(spectatorDelayMoves)
+	spectatorDelayMoves = 1
+	server := httptest.NewServer(newPublicMux())
+	defer server.Close()
+	ctx := context.Background()
+	recorder := newGameRecorder(newGameID(), "", nil, "")
+	recorder.Record(ctx, GameCreated, "", nil)
+	recorder.RecordJoin(ctx, "white", "alice")
+	recorder.RecordJoin(ctx, "black", "bob")
+	recorder.Record(ctx, GameStarted, "", nil)
+	recorder.Record(ctx, MoveMade, "white", &Move{From: "e2", To: "e4"})
+	id := recorder.State().ID
+
+	resp, err := http.Get(server.URL + "/games/" + id + "/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc gameDocument
+	json.NewDecoder(resp.Body).Decode(&doc)
+	resp.Body.Close()
+	if len(doc.Moves) != 0 {
+		t.Fatalf("got %v shown", doc.Moves)
+	}
+
+	resp, err = http.Get(server.URL + "/games/" + id + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	next := func() (event, data string) {
+		t.Helper()
+		for scanner.Scan() {
+			line := scanner.Text()
+			if value, ok := strings.CutPrefix(line, "event: "); ok {
+				event = value
+			}
+			if value, ok := strings.CutPrefix(line, "data: "); ok {
+				data = value
+			}
+			if line == "" && event != "" && event != "spectators" {
+				return event, data
+			}
+			if line == "" {
+				event = ""
+			}
+		}
+		t.Fatal("the stream ended")
+		return
+	}
+	for _, want := range []string{"game_created", "player_joined", "player_joined", "game_started"} {
+		if event, _ := next(); event != want {
+			t.Fatalf("got %s, want %s", event, want)
+		}
+	}
+	waitFor(t, func() bool { return feeds.watchers(id) > 0 })
+	// e4 is shown once e5 is played, e5 once the game is over
+	recorder.Record(ctx, MoveMade, "black", &Move{From: "e7", To: "e5"})
+	if event, data := next(); event != "move_made" || !strings.Contains(data, `"to":"e4"`) {
+		t.Fatalf("got %s %s", event, data)
+	}
+	recorder.Record(ctx, GameResigned, "black", nil)
+	for _, want := range []string{"move_made", "game_resigned", "end"} {
+		if event, _ := next(); event != want {
+			t.Fatalf("got %s, want %s", event, want)
+		}
+	}
+}
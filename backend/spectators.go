@@ -0,0 +1,52 @@
+package main
+
+import "time"
+
+// spectatorsEvery is how often the players of the games watched are told
+// how many watch, when that changed
+var spectatorsEvery = 10 * time.Second
+
+// spectatorCount asks the game loop to tell its players how many watch
+type spectatorCount int
+
+// watchers is how many watch the game id live, following its events over
+// /games/{id}/events or a GraphQL subscription
+func (f *eventFeeds[T]) watchers(id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subscribers[id])
+}
+
+// broadcastSpectators tells the players of every game how many watch it,
+// each time that changed, until the manager shuts down
+func (m *gameManager) broadcastSpectators() {
+	ticker := time.NewTicker(spectatorsEvery)
+	defer ticker.Stop()
+	told := map[string]int{}
+	for {
+		select {
+		case <-ticker.C:
+			told = m.tellSpectators(told)
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// tellSpectators posts to the loop of every game started the number of its
+// watchers unless told already, returning what it told each game
+func (m *gameManager) tellSpectators(told map[string]int) map[string]int {
+	now := map[string]int{}
+	for _, game := range m.List() {
+		// only the loops of started games take anything but their players
+		if !game.hasJoined() {
+			continue
+		}
+		n := feeds.watchers(game.id)
+		if n != told[game.id] && !game.post(spectatorCount(n)) {
+			continue
+		}
+		now[game.id] = n
+	}
+	return now
+}
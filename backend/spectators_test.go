@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestPlayersAreToldHowManyWatch(t *testing.T) {
+	game, white, black := startTestGame(t)
+	_, cancel := feeds.subscribe(game.id)
+	defer cancel()
+	_, cancelOther := feeds.subscribe(game.id)
+
+	told := games.tellSpectators(map[string]int{})
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("spectators"); got.Spectators != 2 {
+			t.Errorf("got %+v", got)
+		}
+	}
+	if told[game.id] != 2 {
+		t.Errorf("got %v told", told)
+	}
+	events := mustLoad(t, game.id)
+	if doc := newGameDocument(Replay(events), events); doc.Spectators != 2 {
+		t.Errorf("got %d spectators in the document", doc.Spectators)
+	}
+
+	// nothing is told again until the count changes
+	games.tellSpectators(told)
+	cancelOther()
+	games.tellSpectators(told)
+	if got := white.expect("spectators"); got.Spectators != 1 {
+		t.Errorf("got %+v once one left", got)
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// sqlMigrations are the versioned migrations of the database, named
+// version_name.sql and applied in the order of their versions; as with
+// those of the data directory, released ones are never changed
+//
+//go:embed migrations/*.sql
+var sqlMigrations embed.FS
+
+// sqlStorage keeps everything in a SQLite or Postgres database, documents
+// as JSON text the way the other stores encode them. Updates are
+// serialized within the server, and lock the rows they change in Postgres
+// for servers sharing a database not to overwrite each other
+type sqlStorage struct {
+	db *sql.DB
+	// replica is the one the archive is read from, if not db
+	replica *sql.DB
+	kind    string
+	// mu serializes the updates of the server
+	mu sync.Mutex
+}
+
+func openSQLStorage(kind, dsn string) (*sqlStorage, error) {
+	db, err := openSQLDB(kind, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStorage{db: db, kind: kind}, nil
+}
+
+func openSQLDB(kind, dsn string) (*sql.DB, error) {
+	driver := "pgx"
+	if kind == sqliteStorageKind {
+		driver = "sqlite"
+		// transactions take the write lock as they begin, waiting for it
+		// rather than failing to take it halfway through
+		dsn = "file:" + dsn + "?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to the %s database: %w", kind, err)
+	}
+	return db, nil
+}
+
+func (s *sqlStorage) Games() EventStore      { return sqlEventStore{s, s.db} }
+func (s *sqlStorage) Players() PlayerStore   { return sqlPlayerStore{s} }
+func (s *sqlStorage) Comments() CommentStore { return sqlCommentStore{s} }
+func (s *sqlStorage) Studies() StudyStore    { return sqlStudyStore{s} }
+func (s *sqlStorage) Reviews() ReviewStore   { return sqlReviewStore{s} }
+func (s *sqlStorage) Registry() GameRegistry { return sqlRegistry{s} }
+
+func (s *sqlStorage) Archive() EventStore {
+	if s.replica == nil {
+		return s.Games()
+	}
+	return sqlEventStore{s, s.replica}
+}
+
+func (s *sqlStorage) Close() error {
+	if s.replica != nil {
+		s.replica.Close()
+	}
+	return s.db.Close()
+}
+
+// Check reports whether the database can still be reached
+func (s *sqlStorage) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+// query is q with the placeholders of the database, q has them as ?
+func (s *sqlStorage) query(q string) string {
+	if s.kind != postgresStorageKind {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// forUpdate locks the rows selected until the transaction ends, SQLite
+// locks the whole database when it writes instead
+func (s *sqlStorage) forUpdate() string {
+	if s.kind == postgresStorageKind {
+		return " FOR UPDATE"
+	}
+	return ""
+}
+
+type sqlMigration struct {
+	version int
+	name    string
+	sql     string
+}
+
+func readSQLMigrations() ([]sqlMigration, error) {
+	names, err := fs.Glob(sqlMigrations, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	list := []sqlMigration{}
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(path.Base(name), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s is not named version_name.sql", name)
+		}
+		data, err := sqlMigrations.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, sqlMigration{version: version, name: strings.TrimSuffix(path.Base(name), ".sql"), sql: string(data)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+	return list, nil
+}
+
+// pending are the migrations not applied to the database yet
+func (s *sqlStorage) pending() ([]sqlMigration, error) {
+	if _, err := s.db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)"); err != nil {
+		return nil, err
+	}
+	var version int
+	if err := s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return nil, err
+	}
+	all, err := readSQLMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if len(all) > 0 && version > all[len(all)-1].version {
+		return nil, fmt.Errorf("the database is at version %d, migrated by a later release than this one, which knows up to %d", version, all[len(all)-1].version)
+	}
+	i := 0
+	for i < len(all) && all[i].version <= version {
+		i++
+	}
+	return all[i:], nil
+}
+
+func (s *sqlStorage) PendingMigrations() (int, error) {
+	pending, err := s.pending()
+	return len(pending), err
+}
+
+// Migrate applies every pending migration in a transaction of its own,
+// recording its version along with it
+func (s *sqlStorage) Migrate() error {
+	pending, err := s.pending()
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		log.Printf("migrating the database to version %d: %s", m.version, m.name)
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(m.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		if _, err := tx.Exec(s.query("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)"), m.version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadDocument decodes into v the data of the row of table with key, in
+// tx if it is not nil; it reports whether there is one
+func (s *sqlStorage) loadDocument(tx *sql.Tx, table, key, id string, v any) (bool, error) {
+	q := s.query("SELECT data FROM " + table + " WHERE " + key + " = ?")
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRow(q+s.forUpdate(), id)
+	} else {
+		row = s.db.QueryRow(q, id)
+	}
+	var data string
+	err := row.Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(data), v)
+}
+
+// saveDocument writes v as the data of the row of table with key,
+// replacing the one there may be
+func (s *sqlStorage) saveDocument(db interface {
+	Exec(string, ...any) (sql.Result, error)
+}, table, key, id string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(s.query("INSERT INTO "+table+" ("+key+", data) VALUES (?, ?) ON CONFLICT ("+key+") DO UPDATE SET data = excluded.data"), id, string(data))
+	return err
+}
+
+// updateDocument saves the document of table with key as change leaves
+// it, unless change fails; found tells change whether there was one
+func (s *sqlStorage) updateDocument(table, key, id string, v any, change func(found bool) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	found, err := s.loadDocument(tx, table, key, id, v)
+	if err != nil {
+		return err
+	}
+	if err := change(found); err != nil {
+		return err
+	}
+	if err := s.saveDocument(tx, table, key, id, v); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlEventStore appends to the database of s, and reads from read
+type sqlEventStore struct {
+	s    *sqlStorage
+	read *sql.DB
+}
+
+func (e sqlEventStore) Append(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = e.s.db.ExecContext(ctx, e.s.query("INSERT INTO events (game_id, seq, data) VALUES (?, ?, ?)"), event.GameID, event.Seq, string(data))
+	return err
+}
+
+func (e sqlEventStore) Load(gameID string) ([]Event, error) {
+	rows, err := e.read.Query(e.s.query("SELECT data FROM events WHERE game_id = ? ORDER BY seq"), gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []Event{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		event := Event{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ErrGameNotFound
+	}
+	return events, nil
+}
+
+func (e sqlEventStore) GameIDs() ([]string, error) {
+	rows, err := e.read.Query("SELECT DISTINCT game_id FROM events")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (e sqlEventStore) Check() error {
+	return e.s.Check()
+}
+
+type sqlPlayerStore struct{ s *sqlStorage }
+
+func (p sqlPlayerStore) Create(player Player) error {
+	player.Token = ""
+	return p.s.saveDocument(p.s.db, "players", "id", player.ID, player)
+}
+
+func (p sqlPlayerStore) Load(id string) (Player, error) {
+	player := Player{}
+	found, err := p.s.loadDocument(nil, "players", "id", id, &player)
+	if err == nil && !found {
+		err = ErrPlayerNotFound
+	}
+	return player, err
+}
+
+func (p sqlPlayerStore) Update(id string, change func(*Player) error) error {
+	player := Player{}
+	return p.s.updateDocument("players", "id", id, &player, func(found bool) error {
+		if !found {
+			return ErrPlayerNotFound
+		}
+		if err := change(&player); err != nil {
+			return err
+		}
+		player.Token = ""
+		return nil
+	})
+}
+
+func (p sqlPlayerStore) Link(identity, id string) error {
+	_, err := p.s.db.Exec(p.s.query("INSERT INTO identities (identity, player_id) VALUES (?, ?) ON CONFLICT (identity) DO UPDATE SET player_id = excluded.player_id"), identity, id)
+	return err
+}
+
+func (p sqlPlayerStore) Linked(identity string) (string, error) {
+	var id string
+	err := p.s.db.QueryRow(p.s.query("SELECT player_id FROM identities WHERE identity = ?"), identity).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrPlayerNotFound
+	}
+	return id, err
+}
+
+func (p sqlPlayerStore) Unlink(identity string) error {
+	_, err := p.s.db.Exec(p.s.query("DELETE FROM identities WHERE identity = ?"), identity)
+	return err
+}
+
+type sqlCommentStore struct{ s *sqlStorage }
+
+func (c sqlCommentStore) Load(game string) ([]Comment, error) {
+	list := []Comment{}
+	_, err := c.s.loadDocument(nil, "comments", "game_id", game, &list)
+	return list, err
+}
+
+func (c sqlCommentStore) Update(game string, change func(*[]Comment) error) error {
+	list := []Comment{}
+	return c.s.updateDocument("comments", "game_id", game, &list, func(bool) error {
+		return change(&list)
+	})
+}
+
+type sqlStudyStore struct{ s *sqlStorage }
+
+func (t sqlStudyStore) Create(study Study) error {
+	return t.s.saveDocument(t.s.db, "studies", "id", study.ID, study)
+}
+
+func (t sqlStudyStore) Load(id string) (Study, error) {
+	study := Study{}
+	found, err := t.s.loadDocument(nil, "studies", "id", id, &study)
+	if err == nil && !found {
+		err = ErrStudyNotFound
+	}
+	return study, err
+}
+
+func (t sqlStudyStore) Update(id string, change func(*Study) error) error {
+	study := Study{}
+	return t.s.updateDocument("studies", "id", id, &study, func(found bool) error {
+		if !found {
+			return ErrStudyNotFound
+		}
+		return change(&study)
+	})
+}
+
+type sqlRegistry struct{ s *sqlStorage }
+
+func (g sqlRegistry) Claim(game, instance string) error {
+	_, err := g.s.db.Exec(g.s.query("INSERT INTO game_owners (game_id, instance) VALUES (?, ?) ON CONFLICT (game_id) DO UPDATE SET instance = excluded.instance, handoff = NULL"), game, instance)
+	return err
+}
+
+func (g sqlRegistry) Owner(game string) (string, error) {
+	var instance string
+	err := g.s.db.QueryRow(g.s.query("SELECT instance FROM game_owners WHERE game_id = ?"), game).Scan(&instance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return instance, err
+}
+
+func (g sqlRegistry) Release(game, instance string) error {
+	_, err := g.s.db.Exec(g.s.query("DELETE FROM game_owners WHERE game_id = ? AND instance = ?"), game, instance)
+	return err
+}
+
+func (g sqlRegistry) Heartbeat(instance string, at time.Time) error {
+	_, err := g.s.db.Exec(g.s.query("INSERT INTO instances (url, seen_at) VALUES (?, ?) ON CONFLICT (url) DO UPDATE SET seen_at = excluded.seen_at"), instance, at.UnixMilli())
+	return err
+}
+
+func (g sqlRegistry) Members(since time.Time) ([]string, error) {
+	rows, err := g.s.db.Query(g.s.query("SELECT url FROM instances WHERE seen_at >= ? ORDER BY url"), since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		members = append(members, url)
+	}
+	return members, rows.Err()
+}
+
+func (g sqlRegistry) HandOff(game, instance string, snapshot []byte) error {
+	_, err := g.s.db.Exec(g.s.query("INSERT INTO game_owners (game_id, instance, handoff) VALUES (?, ?, ?) ON CONFLICT (game_id) DO UPDATE SET instance = excluded.instance, handoff = excluded.handoff"), game, instance, string(snapshot))
+	return err
+}
+
+// Adopt clears the snapshot only if it is still there, for another
+// adopting it at the same time to find none
+func (g sqlRegistry) Adopt(game, instance string) ([]byte, error) {
+	var snapshot string
+	err := g.s.db.QueryRow(g.s.query("SELECT handoff FROM game_owners WHERE game_id = ? AND instance = ? AND handoff IS NOT NULL"), game, instance).Scan(&snapshot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result, err := g.s.db.Exec(g.s.query("UPDATE game_owners SET handoff = NULL WHERE game_id = ? AND instance = ? AND handoff = ?"), game, instance, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+	return []byte(snapshot), nil
+}
+
+func (g sqlRegistry) HandedOff(instance string) ([]string, error) {
+	rows, err := g.s.db.Query(g.s.query("SELECT game_id FROM game_owners WHERE instance = ? AND handoff IS NOT NULL ORDER BY game_id"), instance)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var handed []string
+	for rows.Next() {
+		var game string
+		if err := rows.Scan(&game); err != nil {
+			return nil, err
+		}
+		handed = append(handed, game)
+	}
+	return handed, rows.Err()
+}
+
+type sqlReviewStore struct{ s *sqlStorage }
+
+func (v sqlReviewStore) Update(player string, change func(*accountReview) error) error {
+	account := accountReview{Player: player}
+	return v.s.updateDocument("reviews", "player_id", player, &account, func(bool) error {
+		return change(&account)
+	})
+}
+
+func (v sqlReviewStore) List() ([]accountReview, error) {
+	rows, err := v.s.db.Query("SELECT data FROM reviews")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	listed := []accountReview{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		account := accountReview{}
+		if err := json.Unmarshal([]byte(data), &account); err != nil {
+			return nil, err
+		}
+		listed = append(listed, account)
+	}
+	return listed, rows.Err()
+}
+
+func (v sqlReviewStore) Delete(player string) error {
+	_, err := v.s.db.Exec(v.s.query("DELETE FROM reviews WHERE player_id = ?"), player)
+	return err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// serveEvents streams the frames of t to the client as Server-Sent Events
+// until the transport is closed or the client goes away
+func serveEvents(w http.ResponseWriter, flusher http.Flusher, r *http.Request, t *httpTransport) {
+	// the first event tells the client where to post its messages
+	fmt.Fprintf(w, "event: session\ndata: %s\n\n", t.id)
+	flusher.Flush()
+	for {
+		select {
+		case data := <-t.frames:
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-t.done:
+			// frames written right before closing are still delivered
+			for _, data := range t.pending() {
+				fmt.Fprintf(w, "data: %s\n\n", data)
+			}
+			if reason := t.closeReason(); reason != "" {
+				fmt.Fprintf(w, "event: close\ndata: %s\n\n", reason)
+			}
+			flusher.Flush()
+			return
+		case <-r.Context().Done():
+			t.Close("")
+			return
+		}
+	}
+}
+
+func sseHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "sse.connect")
+	defer span.End()
+
+	keepOpen(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+
+	t := newHTTPTransport(false)
+	defer removeHTTPSession(t)
+
+	admit(ctx, span, r, t)
+	serveEvents(w, flusher, r, t)
+}
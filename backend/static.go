@@ -0,0 +1,58 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// static holds the built frontend, copied there by make dist
+//
+//go:embed all:static
+var static embed.FS
+
+// frontendFiles are served at / when the frontend is enabled, nil otherwise
+var frontendFiles fs.FS
+
+func embeddedFrontend() fs.FS {
+	files, _ := fs.Sub(static, "static")
+	return files
+}
+
+// frontendHandler serves files, falling back to index.html for the paths
+// that name no file, which are routes of the single page app
+func frontendHandler(files fs.FS) http.Handler {
+	fileServer := http.FileServerFS(files)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		info, err := fs.Stat(files, name)
+		if err == nil && !info.IsDir() {
+			// vite puts a hash of their content in the names of the assets
+			if strings.HasPrefix(name, "assets/") {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			}
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		// a missing asset is not a page of the app
+		if path.Ext(name) != "" && path.Ext(name) != ".html" {
+			http.NotFound(w, r)
+			return
+		}
+		index, err := fs.ReadFile(files, "index.html")
+		if err != nil {
+			http.Error(w, "the frontend was not built into this server", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(index)
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFrontendFallsBackToIndex(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":       {Data: []byte("<div id=app></div>")},
+		"assets/app-1a.js": {Data: []byte("app()")},
+	}
+	for path, want := range map[string]int{
+		"/":                 http.StatusOK,
+		"/games/4f2a":       http.StatusOK,
+		"/assets/app-1a.js": http.StatusOK,
+		"/assets/app-2b.js": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		frontendHandler(files).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestFrontendRoutedBelowTheEndpoints(t *testing.T) {
+	frontendFiles = fstest.MapFS{"index.html": {Data: []byte("<div id=app></div>")}}
+	defer func() { frontendFiles = nil }()
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() == "<div id=app></div>" {
+		t.Errorf("got %d %q from /healthz", w.Code, w.Body)
+	}
+}
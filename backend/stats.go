@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+)
+
+// topOpenings is how many of the openings a player played most are in
+// their statistics
+const topOpenings = 10
+
+// playerStats is what the games of a player add up to: Player.Games by
+// color and by pool, and from the archive how long they last and how they
+// open
+type playerStats struct {
+	Player  string               `json:"player"`
+	ByColor map[string]gameCount `json:"byColor"`
+	ByPool  map[string]gameCount `json:"byPool"`
+	// AverageMoves is the average of the full moves of the games archived
+	AverageMoves float64        `json:"averageMoves"`
+	Openings     []openingStats `json:"openings"`
+}
+
+// openingStats is the record of a player in the games of an opening,
+// WinRate the share of them they won and Score the points they made per
+// game, half a point a draw
+type openingStats struct {
+	opening
+	Count   gameCount `json:"count"`
+	WinRate float64   `json:"winRate"`
+	Score   float64   `json:"score"`
+}
+
+func newPlayerStats(player Player) (playerStats, error) {
+	byColor, byPool := map[string][]PlayerGame{}, map[string][]PlayerGame{}
+	byOpening := map[opening][]PlayerGame{}
+	archived, moves := 0, 0
+	for _, game := range player.Games {
+		byColor[game.Color] = append(byColor[game.Color], game)
+		byPool[game.Pool] = append(byPool[game.Pool], game)
+		state, ok, err := archivedGameIn(archiveStore, game.ID)
+		if err != nil {
+			return playerStats{}, err
+		}
+		if !ok {
+			continue
+		}
+		archived++
+		moves += (len(state.Moves) + 1) / 2
+		// the openings are those of standard chess
+		if state.Variant == "" {
+			o := classifyOpening(uciMoves(state.Moves))
+			byOpening[o] = append(byOpening[o], game)
+		}
+	}
+	stats := playerStats{
+		Player:   player.ID,
+		ByColor:  countGamesBy(byColor),
+		ByPool:   countGamesBy(byPool),
+		Openings: openingRecords(byOpening),
+	}
+	if archived > 0 {
+		stats.AverageMoves = float64(moves) / float64(archived)
+	}
+	return stats, nil
+}
+
+// archivedGame is the state of the game id, ok unless it is no longer
+// archived
+func archivedGame(id string) (state GameState, ok bool, err error) {
+	return archivedGameIn(store, id)
+}
+
+// archivedGameIn is archivedGame as kept in events
+func archivedGameIn(events EventStore, id string) (state GameState, ok bool, err error) {
+	recorded, err := events.Load(id)
+	if errors.Is(err, ErrGameNotFound) {
+		return GameState{}, false, nil
+	}
+	if err != nil {
+		return GameState{}, false, err
+	}
+	return Replay(recorded), true, nil
+}
+
+func countGamesBy(groups map[string][]PlayerGame) map[string]gameCount {
+	counts := map[string]gameCount{}
+	for key, games := range groups {
+		counts[key] = countGames(games)
+	}
+	return counts
+}
+
+// openingRecords are the records of the topOpenings played most, those
+// played as many times by name
+func openingRecords(byOpening map[opening][]PlayerGame) []openingStats {
+	records := []openingStats{}
+	for o, games := range byOpening {
+		count := countGames(games)
+		records = append(records, openingStats{
+			opening: o,
+			Count:   count,
+			WinRate: float64(count.Wins) / float64(count.All),
+			Score:   (float64(count.Wins) + float64(count.Draws)/2) / float64(count.All),
+		})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Count.All != records[j].Count.All {
+			return records[i].Count.All > records[j].Count.All
+		}
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return records[i].ECO < records[j].ECO
+	})
+	return records[:min(len(records), topOpenings)]
+}
+
+func uciMoves(moves []Move) []string {
+	list := make([]string, len(moves))
+	for i, move := range moves {
+		list[i] = move.UCI()
+	}
+	return list
+}
+
+// statsHandler serves the statistics of a player
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	serveCached(w, r, "stats:"+r.PathValue("id"), func() (any, error) {
+		player, err := players.Load(r.PathValue("id"))
+		if err != nil {
+			return nil, err
+		}
+		return newPlayerStats(player)
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClassifyOpening(t *testing.T) {
+	for moves, want := range map[string]string{
+		"":                              "A00",
+		"a2a3":                          "A00",
+		"e2e4":                          "B00",
+		"e2e4 c7c5 g1f3 d7d6 d2d4 c5d4": "B50",
+		"e2e4 e7e5 g1f3 b8c6 f1b5 a7a6": "C70",
+		"e2e4 e7e5 g1f3 b8c6 f1b5 a7a6 b5c6 d7c6": "C68",
+		"d2d4 g8f6 c2c4 g7g6 b1c3 d7d5":           "D80",
+	} {
+		if got := classifyOpening(strings.Fields(moves)); got.ECO != want {
+			t.Errorf("%q is %s %s, want %s", moves, got.ECO, got.Name, want)
+		}
+	}
+}
+
+func TestPlayerStats(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	// archive records a standard game of moves
+	archive := func(id, moves string) {
+		recorder := newGameRecorder(id, "", nil, "")
+		recorder.Record(context.Background(), GameCreated, "", nil)
+		for _, m := range strings.Fields(moves) {
+			recorder.Record(context.Background(), MoveMade, "", &Move{From: m[:2], To: m[2:]})
+		}
+	}
+	archive("stats-ruy", "e2e4 e7e5 g1f3 b8c6 f1b5")
+	archive("stats-najdorf", "e2e4 c7c5 g1f3 d7d6 d2d4 c5d4 f3d4 g8f6 b1c3 a7a6")
+	archive("stats-ruy2", "e2e4 e7e5 g1f3 b8c6 f1b5 g8f6")
+	player := newPlayer("ana")
+	player.Games = []PlayerGame{
+		{ID: "stats-ruy", Color: "white", Result: "win", Pool: "blitz"},
+		{ID: "stats-najdorf", Color: "black", Result: "loss", Pool: "blitz"},
+		{ID: "stats-ruy2", Color: "white", Result: "draw", Pool: "rapid"},
+		// no longer archived, it is only counted by color and pool
+		{ID: "stats-lost", Color: "black", Result: "win", Pool: "rapid"},
+	}
+	players.Create(player)
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/"+player.ID+"/stats", nil))
+	stats := playerStats{}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+	if stats.ByColor["white"] != (gameCount{All: 2, Wins: 1, Draws: 1}) || stats.ByColor["black"] != (gameCount{All: 2, Wins: 1, Losses: 1}) {
+		t.Errorf("got %+v by color", stats.ByColor)
+	}
+	if stats.ByPool["blitz"] != (gameCount{All: 2, Wins: 1, Losses: 1}) || stats.ByPool["rapid"] != (gameCount{All: 2, Wins: 1, Draws: 1}) {
+		t.Errorf("got %+v by pool", stats.ByPool)
+	}
+	// 3, 5 and 3 full moves
+	if stats.AverageMoves < 3.66 || stats.AverageMoves > 3.67 {
+		t.Errorf("got %v moves on average", stats.AverageMoves)
+	}
+	if len(stats.Openings) != 3 {
+		t.Fatalf("got %+v", stats.Openings)
+	}
+	// played as many times, by name
+	want := []openingStats{
+		{opening: opening{ECO: "C60", Name: "Ruy Lopez"}, Count: gameCount{All: 1, Wins: 1}, WinRate: 1, Score: 1},
+		{opening: opening{ECO: "C65", Name: "Ruy Lopez: Berlin Defense"}, Count: gameCount{All: 1, Draws: 1}, Score: 0.5},
+		{opening: opening{ECO: "B90", Name: "Sicilian Defense: Najdorf Variation"}, Count: gameCount{All: 1, Losses: 1}},
+	}
+	for i, o := range stats.Openings {
+		if o != want[i] {
+			t.Errorf("got %+v, want %+v", o, want[i])
+		}
+	}
+
+	w = httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/nobody/stats", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got %d for an unknown player", w.Code)
+	}
+}
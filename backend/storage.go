@@ -0,0 +1,151 @@
+package main
+
+import "fmt"
+
+// Storage is everything the server keeps: the event logs of games, the
+// players with their ratings, comments, studies and the reviews of
+// accounts. It is chosen with
+// -storage, see openStorage
+type Storage interface {
+	Games() EventStore
+	// Archive is Games read from the replica of the database, if it was
+	// given one with useReplica
+	Archive() EventStore
+	Players() PlayerStore
+	Comments() CommentStore
+	Studies() StudyStore
+	Reviews() ReviewStore
+	// Registry is shared by the instances of a database only
+	Registry() GameRegistry
+	// PendingMigrations is how many migrations Migrate would apply
+	PendingMigrations() (int, error)
+	Migrate() error
+	Close() error
+}
+
+// the kinds of storage: memory, lost when the server stops and what tests
+// use, files in the data directory, or a database
+const (
+	memoryStorageKind   = "memory"
+	fileStorageKind     = "file"
+	sqliteStorageKind   = "sqlite"
+	postgresStorageKind = "postgres"
+)
+
+// openStorage opens the storage of kind: files in dataDir, or the database
+// of dsn, a path for SQLite or a postgres:// URL. With no kind, the data
+// directory is used if there is one and memory otherwise
+func openStorage(kind, dataDir, dsn string) (Storage, error) {
+	if kind == "" {
+		kind = memoryStorageKind
+		if dataDir != "" {
+			kind = fileStorageKind
+		}
+	}
+	switch kind {
+	case memoryStorageKind:
+		return newMemoryStorage(), nil
+	case fileStorageKind:
+		if dataDir == "" {
+			return nil, fmt.Errorf("the file storage needs -data-dir")
+		}
+		return newFileStorage(dataDir)
+	case sqliteStorageKind, postgresStorageKind:
+		if dsn == "" {
+			return nil, fmt.Errorf("the %s storage needs -database", kind)
+		}
+		return openSQLStorage(kind, dsn)
+	default:
+		return nil, fmt.Errorf("unknown storage %q, expected memory, file, sqlite or postgres", kind)
+	}
+}
+
+// useReplica has the archive of storage read from the replica of dsn,
+// only databases have one
+func useReplica(storage Storage, dsn string) error {
+	s, ok := storage.(*sqlStorage)
+	if !ok {
+		return fmt.Errorf("a read replica needs the sqlite or postgres storage")
+	}
+	replica, err := openSQLDB(s.kind, dsn)
+	if err != nil {
+		return fmt.Errorf("replica: %w", err)
+	}
+	s.replica = replica
+	return nil
+}
+
+type memoryStorage struct {
+	games    *memoryStore
+	players  *memoryPlayerStore
+	comments *memoryCommentStore
+	studies  *memoryStudyStore
+	reviews  *memoryReviewStore
+	registry *memoryRegistry
+}
+
+func newMemoryStorage() memoryStorage {
+	return memoryStorage{newMemoryStore(), newMemoryPlayerStore(), newMemoryCommentStore(), newMemoryStudyStore(), newMemoryReviewStore(), newMemoryRegistry()}
+}
+
+func (s memoryStorage) Games() EventStore               { return s.games }
+func (s memoryStorage) Archive() EventStore             { return s.games }
+func (s memoryStorage) Players() PlayerStore            { return s.players }
+func (s memoryStorage) Comments() CommentStore          { return s.comments }
+func (s memoryStorage) Studies() StudyStore             { return s.studies }
+func (s memoryStorage) Reviews() ReviewStore            { return s.reviews }
+func (s memoryStorage) Registry() GameRegistry          { return s.registry }
+func (s memoryStorage) PendingMigrations() (int, error) { return 0, nil }
+func (s memoryStorage) Migrate() error                  { return nil }
+func (s memoryStorage) Close() error                    { return nil }
+
+// fileStorage keeps everything in the data directory, see migrations for
+// its layout
+type fileStorage struct {
+	dataDir  string
+	games    EventStore
+	players  PlayerStore
+	comments CommentStore
+	studies  StudyStore
+	reviews  ReviewStore
+	registry GameRegistry
+}
+
+func newFileStorage(dataDir string) (*fileStorage, error) {
+	s := &fileStorage{dataDir: dataDir, registry: newMemoryRegistry()}
+	var err error
+	if s.games, err = newEventStore(dataDir); err != nil {
+		return nil, err
+	}
+	if s.players, err = newPlayerStore(dataDir); err != nil {
+		return nil, err
+	}
+	if s.comments, err = newCommentStore(dataDir); err != nil {
+		return nil, err
+	}
+	if s.studies, err = newStudyStore(dataDir); err != nil {
+		return nil, err
+	}
+	if s.reviews, err = newReviewStore(dataDir); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileStorage) Games() EventStore      { return s.games }
+func (s *fileStorage) Archive() EventStore    { return s.games }
+func (s *fileStorage) Players() PlayerStore   { return s.players }
+func (s *fileStorage) Comments() CommentStore { return s.comments }
+func (s *fileStorage) Studies() StudyStore    { return s.studies }
+func (s *fileStorage) Reviews() ReviewStore   { return s.reviews }
+func (s *fileStorage) Registry() GameRegistry { return s.registry }
+func (s *fileStorage) Close() error           { return nil }
+
+func (s *fileStorage) PendingMigrations() (int, error) {
+	pending, err := pendingMigrations(s.dataDir)
+	return len(pending), err
+}
+
+func (s *fileStorage) Migrate() error {
+	return migrate(s.dataDir)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testStorages are the storages every test of Storage runs against,
+// Postgres only given a database to test with in CHESS_TEST_POSTGRES
+func testStorages(t *testing.T) map[string]Storage {
+	t.Helper()
+	storages := map[string]Storage{"memory": newMemoryStorage()}
+	file, err := openStorage("", t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storages["file"] = file
+	sqlite, err := openStorage(sqliteStorageKind, "", filepath.Join(t.TempDir(), "chess.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storages["sqlite"] = sqlite
+	if dsn := os.Getenv("CHESS_TEST_POSTGRES"); dsn != "" {
+		postgres, err := openStorage(postgresStorageKind, "", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		storages["postgres"] = postgres
+	}
+	for name, storage := range storages {
+		if err := storage.Migrate(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		t.Cleanup(func() { storage.Close() })
+	}
+	return storages
+}
+
+func TestRegistries(t *testing.T) {
+	for name, storage := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			registry := storage.Registry()
+			id := newGameID()
+			if owner, err := registry.Owner(id); err != nil || owner != "" {
+				t.Fatalf("got %q, %v for a game nobody owns", owner, err)
+			}
+			registry.Claim(id, "a")
+			registry.Claim(id, "b")
+			// only its owner releases a game
+			if err := registry.Release(id, "a"); err != nil {
+				t.Fatal(err)
+			}
+			if owner, err := registry.Owner(id); err != nil || owner != "b" {
+				t.Errorf("got %q, %v", owner, err)
+			}
+			registry.Release(id, "b")
+			if owner, _ := registry.Owner(id); owner != "" {
+				t.Errorf("got %q once released", owner)
+			}
+
+			// a game handed off is adopted once, by the instance it went to
+			if err := registry.HandOff(id, "b", []byte(`{"state":{}}`)); err != nil {
+				t.Fatal(err)
+			}
+			if handed, err := registry.HandedOff("b"); err != nil || !slices.Contains(handed, id) {
+				t.Errorf("got %v, %v", handed, err)
+			}
+			if snapshot, _ := registry.Adopt(id, "a"); snapshot != nil {
+				t.Errorf("adopted %s by another instance", snapshot)
+			}
+			if snapshot, err := registry.Adopt(id, "b"); err != nil || string(snapshot) != `{"state":{}}` {
+				t.Errorf("got %s, %v", snapshot, err)
+			}
+			if snapshot, _ := registry.Adopt(id, "b"); snapshot != nil {
+				t.Errorf("adopted %s twice", snapshot)
+			}
+			if owner, _ := registry.Owner(id); owner != "b" {
+				t.Errorf("got %q once adopted", owner)
+			}
+			registry.Release(id, "b")
+
+			// the instances up are those seen since
+			now := time.Now()
+			registry.Heartbeat(id+"/up", now)
+			registry.Heartbeat(id+"/down", now.Add(-time.Hour))
+			registry.Heartbeat(id+"/down", now.Add(-time.Minute))
+			members, err := registry.Members(now.Add(-time.Second))
+			if err != nil || !slices.Contains(members, id+"/up") || slices.Contains(members, id+"/down") {
+				t.Errorf("got %v, %v", members, err)
+			}
+		})
+	}
+}
+
+func TestStorages(t *testing.T) {
+	for name, storage := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			if pending, err := storage.PendingMigrations(); err != nil || pending != 0 {
+				t.Fatalf("got %d migrations pending, %v", pending, err)
+			}
+			id := newGameID()
+
+			games := storage.Games()
+			if _, err := games.Load(id); !errors.Is(err, ErrGameNotFound) {
+				t.Errorf("got %v loading a game missing", err)
+			}
+			for seq, kind := range []EventType{GameCreated, MoveMade} {
+				if err := games.Append(context.Background(), Event{GameID: id, Seq: seq + 1, Type: kind}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			games.Append(ctx, Event{GameID: id, Seq: 3, Type: GameResigned})
+			if events, err := games.Load(id); err != nil || len(events) != 2 || events[1].Type != MoveMade {
+				t.Errorf("got %+v, %v", events, err)
+			}
+			if ids, err := games.GameIDs(); err != nil || len(ids) != 1 || ids[0] != id {
+				t.Errorf("got %v, %v", ids, err)
+			}
+
+			players := storage.Players()
+			ana := Player{ID: id, Name: "ana", Token: "never stored", Ratings: map[string]Rating{"blitz": {Rating: 1500}}}
+			if err := players.Create(ana); err != nil {
+				t.Fatal(err)
+			}
+			errRefused := errors.New("refused")
+			if err := players.Update(id, func(player *Player) error { player.Name = "lost"; return errRefused }); !errors.Is(err, errRefused) {
+				t.Errorf("got %v", err)
+			}
+			if err := players.Update(id, func(player *Player) error { player.Ratings["blitz"] = Rating{Rating: 1516, Games: 1}; return nil }); err != nil {
+				t.Fatal(err)
+			}
+			if player, err := players.Load(id); err != nil || player.Name != "ana" || player.Token != "" || player.Ratings["blitz"].Rating != 1516 {
+				t.Errorf("got %+v, %v", player, err)
+			}
+			if err := players.Update("nobody", func(*Player) error { return nil }); !errors.Is(err, ErrPlayerNotFound) {
+				t.Errorf("got %v updating a player missing", err)
+			}
+			players.Link("github:1", id)
+			if linked, err := players.Linked("github:1"); err != nil || linked != id {
+				t.Errorf("got %s, %v", linked, err)
+			}
+			players.Unlink("github:1")
+			if _, err := players.Linked("github:1"); !errors.Is(err, ErrPlayerNotFound) {
+				t.Errorf("got %v once unlinked", err)
+			}
+
+			comments := storage.Comments()
+			if list, err := comments.Load(id); err != nil || len(list) != 0 {
+				t.Errorf("got %v, %v", list, err)
+			}
+			comments.Update(id, func(list *[]Comment) error {
+				*list = append(*list, Comment{ID: 1, Text: "good game"})
+				return nil
+			})
+			if list, err := comments.Load(id); err != nil || len(list) != 1 || list[0].Text != "good game" {
+				t.Errorf("got %v, %v", list, err)
+			}
+
+			studies := storage.Studies()
+			if err := studies.Create(Study{ID: id, Name: "openings"}); err != nil {
+				t.Fatal(err)
+			}
+			studies.Update(id, func(study *Study) error { study.Name = "endgames"; return nil })
+			if study, err := studies.Load(id); err != nil || study.Name != "endgames" {
+				t.Errorf("got %+v, %v", study, err)
+			}
+			if _, err := studies.Load("nothing"); !errors.Is(err, ErrStudyNotFound) {
+				t.Errorf("got %v loading a study missing", err)
+			}
+
+			reviews := storage.Reviews()
+			for _, score := range []float64{0.2, 0.8} {
+				reviews.Update(id, func(account *accountReview) error {
+					account.Games = append(account.Games, gameReview{GameID: id, Score: score})
+					account.Score = score
+					return nil
+				})
+			}
+			if listed, err := reviews.List(); err != nil || len(listed) != 1 || listed[0].Player != id || len(listed[0].Games) != 2 || listed[0].Score != 0.8 {
+				t.Errorf("got %+v, %v", listed, err)
+			}
+			reviews.Delete(id)
+			if listed, err := reviews.List(); err != nil || len(listed) != 0 {
+				t.Errorf("got %+v, %v once deleted", listed, err)
+			}
+		})
+	}
+}
+
+func TestDatabaseMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chess.db")
+	storage, err := openStorage(sqliteStorageKind, "", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	if err := checkMigrations(storage, false); !errors.Is(err, errPendingMigrations) {
+		t.Fatalf("got %v with migrations pending", err)
+	}
+	if err := checkMigrations(storage, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Migrate(); err != nil {
+		t.Errorf("got %v migrating again", err)
+	}
+	db := storage.(*sqlStorage).db
+	db.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (1000, '')")
+	if err := checkMigrations(storage, true); err == nil {
+		t.Error("a database of a later release was migrated")
+	}
+}
+
+func TestReplica(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := openStorage(sqliteStorageKind, "", filepath.Join(dir, "chess.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	replica, err := openStorage(sqliteStorageKind, "", filepath.Join(dir, "replica.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+	if err := storage.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := useReplica(storage, filepath.Join(dir, "replica.db")); err != nil {
+		t.Fatal(err)
+	}
+	// what is recorded goes to the database, the archive is read from the
+	// replica, that did not catch up here
+	storage.Games().Append(context.Background(), Event{GameID: "replicated", Seq: 1, Type: GameCreated})
+	if _, err := storage.Games().Load("replicated"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Archive().Load("replicated"); !errors.Is(err, ErrGameNotFound) {
+		t.Errorf("got %v from the replica", err)
+	}
+	replica.Games().Append(context.Background(), Event{GameID: "replicated", Seq: 1, Type: GameCreated})
+	if ids, err := storage.Archive().GameIDs(); err != nil || !slices.Equal(ids, []string{"replicated"}) {
+		t.Errorf("got %v, %v", ids, err)
+	}
+
+	if err := useReplica(newMemoryStorage(), filepath.Join(dir, "replica.db")); err == nil {
+		t.Error("a replica was used without a database")
+	}
+}
+
+func TestUnknownStorage(t *testing.T) {
+	for _, args := range [][3]string{{"redis", "", ""}, {"file", "", ""}, {"sqlite", "", ""}} {
+		if _, err := openStorage(args[0], args[1], args[2]); err == nil {
+			t.Errorf("%v was opened", args)
+		}
+	}
+}
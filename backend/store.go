@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrGameNotFound = errors.New("game not found")
+
+type EventStore interface {
+	// Append writes nothing once ctx is done
+	Append(ctx context.Context, event Event) error
+	Load(gameID string) ([]Event, error)
+	GameIDs() ([]string, error)
+}
+
+var store EventStore = newMemoryStore()
+
+// archiveStore is store for the queries going through the games of
+// players, read from a replica of the database if there is one, see
+// Storage.Archive; what was just recorded may not be there yet
+var archiveStore = store
+
+func newEventStore(dataDir string) (EventStore, error) {
+	if dataDir == "" {
+		return newMemoryStore(), nil
+	}
+	return newFileStore(filepath.Join(dataDir, "games"))
+}
+
+type memoryStore struct {
+	mu     sync.Mutex
+	byGame map[string][]Event
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{byGame: map[string][]Event{}}
+}
+
+func (s *memoryStore) Append(ctx context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.byGame[event.GameID] = append(s.byGame[event.GameID], event)
+	return nil
+}
+
+func (s *memoryStore) Load(gameID string) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events, ok := s.byGame[gameID]
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+	return append([]Event(nil), events...), nil
+}
+
+func (s *memoryStore) GameIDs() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.byGame))
+	for id := range s.byGame {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// fileStore keeps one JSON Lines file per game, only ever appended to
+type fileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newFileStore(dir string) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) path(gameID string) string {
+	return filepath.Join(s.dir, gameID+".jsonl")
+}
+
+func (s *fileStore) Append(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// other games may have kept the lock for a while
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path(event.GameID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileStore) Load(gameID string) ([]Event, error) {
+	if filepath.Base(gameID) != gameID {
+		return nil, ErrGameNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path(gameID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrGameNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	events := []Event{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		event := Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+func (s *fileStore) GameIDs() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".jsonl"); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"time"
+	// the time zones players are in are known without the system's
+	_ "time/tzdata"
+)
+
+const dayLayout = "2006-01-02"
+
+var errInvalidTimeZone = errors.New("a time zone is named as in Europe/Madrid")
+
+// Activity is how many days in a row a player has played games, days
+// starting at midnight in their time zone
+type Activity struct {
+	// Day is the last day they played on, Today how many games they
+	// finished that day
+	Day    string `json:"day,omitempty"`
+	Today  int    `json:"today,omitempty"`
+	Streak int    `json:"streak,omitempty"`
+	Best   int    `json:"best,omitempty"`
+}
+
+// location is the time zone of the player, UTC unless they said
+func (p Preferences) location() *time.Location {
+	if loc, err := time.LoadLocation(p.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// checkTimeZone checks name, a time zone players may be in
+func checkTimeZone(name string) error {
+	if name == "Local" {
+		return errInvalidTimeZone
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return errInvalidTimeZone
+	}
+	return nil
+}
+
+// yesterday is the day before day
+func yesterday(day string) string {
+	t, err := time.Parse(dayLayout, day)
+	if err != nil {
+		return ""
+	}
+	return t.AddDate(0, 0, -1).Format(dayLayout)
+}
+
+// played counts a game finished at t, in loc, towards the activity
+func (a *Activity) played(t time.Time, loc *time.Location) {
+	day := t.In(loc).Format(dayLayout)
+	switch a.Day {
+	case day:
+		a.Today++
+		return
+	case yesterday(day):
+		a.Streak++
+	default:
+		a.Streak = 1
+	}
+	a.Day, a.Today = day, 1
+	a.Best = max(a.Best, a.Streak)
+}
+
+// streak is the activity of a player as of a time, on their profile.
+// AtRisk streaks end unless they play today; GoalMet is set once they
+// finished their daily goal of games, if they have one
+type streak struct {
+	Current   int  `json:"current"`
+	Best      int  `json:"best"`
+	Today     int  `json:"today"`
+	DailyGoal int  `json:"dailyGoal,omitempty"`
+	GoalMet   bool `json:"goalMet"`
+	AtRisk    bool `json:"atRisk"`
+}
+
+func (a Activity) view(preferences Preferences, now time.Time) streak {
+	s := streak{Best: a.Best, DailyGoal: preferences.DailyGoal}
+	today := now.In(preferences.location()).Format(dayLayout)
+	switch a.Day {
+	case today:
+		s.Current, s.Today = a.Streak, a.Today
+	case yesterday(today):
+		s.Current, s.AtRisk = a.Streak, true
+	}
+	s.GoalMet = s.DailyGoal > 0 && s.Today >= s.DailyGoal
+	return s
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActivityStreak(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	var a Activity
+	// 23:30 UTC is already the next day in Madrid
+	a.played(at("2026-03-01T12:00:00Z"), madrid)
+	a.played(at("2026-03-01T23:30:00Z"), madrid)
+	a.played(at("2026-03-02T10:00:00Z"), madrid)
+	if a.Streak != 2 || a.Today != 2 || a.Day != "2026-03-02" {
+		t.Errorf("got %+v", a)
+	}
+
+	preferences := Preferences{TimeZone: "Europe/Madrid", DailyGoal: 2}
+	if got := a.view(preferences, at("2026-03-02T20:00:00Z")); got.Current != 2 || !got.GoalMet || got.AtRisk {
+		t.Errorf("got %+v the same day", got)
+	}
+	if got := a.view(preferences, at("2026-03-03T20:00:00Z")); got.Current != 2 || got.Today != 0 || got.GoalMet || !got.AtRisk {
+		t.Errorf("got %+v the day after", got)
+	}
+	if got := a.view(preferences, at("2026-03-04T20:00:00Z")); got.Current != 0 || got.Best != 2 {
+		t.Errorf("got %+v once broken", got)
+	}
+
+	// a day missed starts over
+	a.played(at("2026-03-04T10:00:00Z"), madrid)
+	if a.Streak != 1 || a.Best != 2 {
+		t.Errorf("got %+v", a)
+	}
+}
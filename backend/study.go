@@ -0,0 +1,363 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+var ErrStudyNotFound = errors.New("study not found")
+
+// maxStudyChapters bounds the chapters of a study
+const maxStudyChapters = 64
+
+// Study is a collection of chapters to analyse and annotate, a position or
+// a game each, edited together on an analysis board of its own. Anyone can
+// read a study, editing it takes its token
+type Study struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Chapters  []Chapter `json:"chapters"`
+}
+
+// Chapter is a variation tree from FEN, made of the moves of Game if any.
+// Comment comes before its first move
+type Chapter struct {
+	Name    string      `json:"name"`
+	FEN     string      `json:"fen"`
+	Game    string      `json:"game,omitempty"`
+	Comment string      `json:"comment,omitempty"`
+	Nodes   []BoardNode `json:"nodes"`
+}
+
+type StudyStore interface {
+	Create(study Study) error
+	Load(id string) (Study, error)
+	// Update saves the study id as change leaves it, unless change fails
+	Update(id string, change func(*Study) error) error
+}
+
+var studies StudyStore = newMemoryStudyStore()
+
+func newStudyStore(dataDir string) (StudyStore, error) {
+	if dataDir == "" {
+		return newMemoryStudyStore(), nil
+	}
+	return newFileStudyStore(filepath.Join(dataDir, "studies"))
+}
+
+// memoryStudyStore keeps studies encoded, for those loaded not to share
+// anything with those stored
+type memoryStudyStore struct {
+	mu      sync.Mutex
+	studies map[string][]byte
+}
+
+func newMemoryStudyStore() *memoryStudyStore {
+	return &memoryStudyStore{studies: map[string][]byte{}}
+}
+
+func (s *memoryStudyStore) Create(study Study) error {
+	data, err := json.Marshal(study)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.studies[study.ID] = data
+	return nil
+}
+
+func (s *memoryStudyStore) Load(id string) (Study, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+func (s *memoryStudyStore) load(id string) (Study, error) {
+	data, ok := s.studies[id]
+	if !ok {
+		return Study{}, ErrStudyNotFound
+	}
+	study := Study{}
+	err := json.Unmarshal(data, &study)
+	return study, err
+}
+
+func (s *memoryStudyStore) Update(id string, change func(*Study) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	study, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	if err := change(&study); err != nil {
+		return err
+	}
+	data, err := json.Marshal(study)
+	if err != nil {
+		return err
+	}
+	s.studies[id] = data
+	return nil
+}
+
+// fileStudyStore keeps one JSON file per study, replaced as a whole
+type fileStudyStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newFileStudyStore(dir string) (*fileStudyStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileStudyStore{dir: dir}, nil
+}
+
+func (s *fileStudyStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *fileStudyStore) Create(study Study) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(study)
+}
+
+// save writes study to a file of its own first, for a crash not to leave
+// half of it; s.mu must be held
+func (s *fileStudyStore) save(study Study) error {
+	data, err := json.Marshal(study)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(study.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(study.ID))
+}
+
+func (s *fileStudyStore) Load(id string) (Study, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+func (s *fileStudyStore) load(id string) (Study, error) {
+	if filepath.Base(id) != id {
+		return Study{}, ErrStudyNotFound
+	}
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Study{}, ErrStudyNotFound
+	}
+	if err != nil {
+		return Study{}, err
+	}
+	study := Study{}
+	err = json.Unmarshal(data, &study)
+	return study, err
+}
+
+func (s *fileStudyStore) Update(id string, change func(*Study) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	study, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	if err := change(&study); err != nil {
+		return err
+	}
+	return s.save(study)
+}
+
+// openStudyChapter is the analysis board of chapter number chapter of the
+// study id, loaded from the study unless somebody has it open already
+func (m *gameManager) openStudyChapter(id string, chapter int) (*analysisBoard, error) {
+	key := fmt.Sprintf("%s/%d", id, chapter)
+	if b, ok := m.FindAnalysisBoard(key); ok {
+		return b, nil
+	}
+	study, err := studies.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	if chapter < 1 || chapter > len(study.Chapters) {
+		return nil, ErrStudyNotFound
+	}
+	c := study.Chapters[chapter-1]
+	root, err := chess.ParseFEN(c.FEN)
+	if err != nil {
+		return nil, err
+	}
+	b := newAnalysisBoard(key, study.Token, root)
+	b.study, b.chapter = id, chapter
+	if !b.restore(c.Nodes) {
+		return nil, fmt.Errorf("chapter %d of study %s does not follow the rules", chapter, id)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// somebody else may have opened it meanwhile
+	if open, ok := m.boards[key]; ok {
+		return open, nil
+	}
+	m.boards[key] = b
+	return b, nil
+}
+
+// joinStudy handles the connections to chapter number chapter of the study
+// id, those with its token own the board of the chapter
+func joinStudy(conn *connection, id, chapter, token string) {
+	n, err := strconv.Atoi(chapter)
+	if chapter == "" {
+		n, err = 1, nil
+	}
+	for err == nil {
+		var b *analysisBoard
+		if b, err = games.openStudyChapter(id, n); err == nil && b.join(conn, token) {
+			go b.listen(conn)
+			return
+		}
+		// everyone left the board just before, it is loaded again
+	}
+	closeWithError(conn, ErrStudyNotFound, id)
+}
+
+// createStudyHandler creates a study called ?name=, answering it with its
+// token, not to be lost: it is the only way to edit the study
+func createStudyHandler(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		http.Error(w, ErrDraining.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	study := Study{ID: newGameID(), Name: r.URL.Query().Get("name"), Token: newToken(), CreatedAt: time.Now().UTC(), Chapters: []Chapter{}}
+	if err := studies.Create(study); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, study)
+}
+
+// studyHandler serves a study to read, without its token
+func studyHandler(w http.ResponseWriter, r *http.Request) {
+	study, err := studies.Load(r.PathValue("id"))
+	if errors.Is(err, ErrStudyNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	study.Token = ""
+	writeJSON(w, study)
+}
+
+// addChapterHandler adds the chapter ?name= to a study, given its ?token=,
+// starting at position ?fen= or made of the moves of the public ?game=,
+// the starting position if neither is given. A game in PGN posted instead
+// is the chapter, with its variations and annotations
+func addChapterHandler(w http.ResponseWriter, r *http.Request) {
+	chapter := Chapter{Name: r.URL.Query().Get("name"), FEN: chess.NewPosition().FEN(), Nodes: []BoardNode{}}
+	imported, ok, err := readPGNChapter(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok {
+		if chapter.Name != "" {
+			imported.Name = chapter.Name
+		}
+		chapter = imported
+	}
+	if fen := r.URL.Query().Get("fen"); fen != "" && !ok {
+		position, err := chess.ParseFEN(fen)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		chapter.FEN = position.FEN()
+	}
+	if id := r.URL.Query().Get("game"); id != "" && !ok {
+		events, err := store.Load(id)
+		if errors.Is(err, ErrGameNotFound) {
+			http.Error(w, "there is no such game", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		state := Replay(events)
+		// the token is that of the study, spectator tokens are not asked for
+		if state.Private {
+			http.Error(w, "private games cannot be studied", http.StatusForbidden)
+			return
+		}
+		chapter.Game, chapter.Nodes = id, gameNodes(state.FEN, state.Moves)
+		if state.FEN != "" {
+			chapter.FEN = state.FEN
+		}
+	}
+
+	err = studies.Update(r.PathValue("id"), func(study *Study) error {
+		if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(study.Token)) != 1 {
+			return errInvalidStudyToken
+		}
+		if len(study.Chapters) >= maxStudyChapters {
+			return errStudyFull
+		}
+		study.Chapters = append(study.Chapters, chapter)
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrStudyNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, errInvalidStudyToken):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, errStudyFull):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	studyHandler(w, r)
+}
+
+var (
+	errInvalidStudyToken = errors.New("the token is not that of the study")
+	errStudyFull         = fmt.Errorf("a study has %d chapters at most", maxStudyChapters)
+)
+
+// gameNodes is the main line of a chapter made of moves, those of a game
+// from the position at fen, up to the first that is not legal
+func gameNodes(fen string, moves []Move) []BoardNode {
+	nodes := []BoardNode{}
+	position := startPosition(fen)
+	for i, m := range moves {
+		parsed, err := chess.ParseMove(m.UCI())
+		if err != nil || !position.IsLegal(parsed) {
+			break
+		}
+		nodes = append(nodes, BoardNode{ID: i + 1, Parent: i, Move: parsed.String(), SAN: position.SAN(parsed)})
+		position = position.Apply(parsed)
+	}
+	return nodes
+}
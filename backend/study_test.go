@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestStudy(t *testing.T) {
+	defer func(s StudyStore) { studies = s }(studies)
+	var err error
+	if studies, err = newStudyStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	game, white, black := startTestGame(t)
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.send(move("2", "e7", "e5"))
+	white.expect("move")
+	waitFor(t, func() bool { return len(game.recorder.State().Moves) == 2 })
+
+	post := func(path string, query url.Values) (int, Study) {
+		w := httptest.NewRecorder()
+		newPublicMux().ServeHTTP(w, httptest.NewRequest("POST", path+"?"+query.Encode(), nil))
+		study := Study{}
+		json.Unmarshal(w.Body.Bytes(), &study)
+		return w.Code, study
+	}
+	_, created := post("/studies", url.Values{"name": {"Open games"}})
+	if created.Token == "" || created.Name != "Open games" {
+		t.Fatalf("got %+v", created)
+	}
+	chapters := "/studies/" + created.ID + "/chapters"
+	if code, _ := post(chapters, url.Values{"game": {game.id}}); code != http.StatusForbidden {
+		t.Errorf("got %d without the token", code)
+	}
+	post(chapters, url.Values{"token": {created.Token}, "name": {"The game"}, "game": {game.id}})
+	code, study := post(chapters, url.Values{"token": {created.Token}, "fen": {"8/8/8/8/8/8/8/K6k w - - 0 1"}})
+	if code != http.StatusOK || study.Token != "" || len(study.Chapters) != 2 {
+		t.Fatalf("got %d %+v", code, study)
+	}
+	if nodes := study.Chapters[0].Nodes; len(nodes) != 2 || nodes[1].SAN != "e5" || nodes[1].Parent != nodes[0].ID {
+		t.Fatalf("got %+v", nodes)
+	}
+
+	// the owner annotates the chapter, the readers see it as it changes
+	owner, reader := newTestPlayer(t), newTestPlayer(t)
+	joinStudy(owner.conn, created.ID, "1", created.Token)
+	if got := owner.expect("board"); got.Role != "owner" || len(got.Nodes) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	joinStudy(reader.conn, created.ID, "1", "")
+	reader.expect("board")
+	owner.expect("board_joined")
+	reader.send(Message{Type: "board_annotate", Node: 2, Comment: "mine"})
+	reader.expect("error", CodeReadOnlyBoard)
+	owner.send(Message{Type: "board_annotate", Node: 2, Comment: "The open game", Arrows: []string{"g1f3", "b8c6"}})
+	owner.expect("board_annotate")
+	if got := reader.expect("board_annotate"); got.Nodes[0].Comment != "The open game" || len(got.Nodes[0].Arrows) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	owner.send(Message{Type: "board_annotate", Node: 2, Arrows: []string{"g1g1"}, Rev: 1})
+	owner.expect("error", CodeInvalidMessage)
+	owner.send(Message{Type: "board_move", Parent: 2, From: "g1", To: "f3", Rev: 1})
+	owner.expect("board_move")
+	reader.expect("board_move")
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/studies/"+created.ID, nil))
+	json.Unmarshal(w.Body.Bytes(), &study)
+	if nodes := study.Chapters[0].Nodes; len(nodes) != 3 || nodes[1].Comment != "The open game" || nodes[2].SAN != "Nf3" {
+		t.Fatalf("got %+v", nodes)
+	}
+
+	// once everyone left, the chapter is loaded again from the study
+	owner.disconnect()
+	reader.disconnect()
+	waitFor(t, func() bool {
+		_, ok := games.FindAnalysisBoard(created.ID + "/1")
+		return !ok
+	})
+	again := newTestPlayer(t)
+	joinStudy(again.conn, created.ID, "1", "")
+	if got := again.expect("board"); len(got.Nodes) != 3 || got.Nodes[1].Arrows[0] != "g1f3" {
+		t.Fatalf("got %+v", got)
+	}
+	missing := newTestPlayer(t)
+	joinStudy(missing.conn, created.ID, "3", "")
+	missing.expect("error", CodeStudyNotFound)
+}
+
+func TestStudyPGN(t *testing.T) {
+	defer func(s StudyStore) { studies = s }(studies)
+	studies = newMemoryStudyStore()
+	study := Study{ID: "pgn", Name: "Endgames", Token: "secret"}
+	studies.Create(study)
+
+	pgn := `[Event "Endgames: Opposition"]
+[Result "*"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"]
+
+{Take the opposition} 1. Kd2 $1 {[%cal Ge1d2,Ge8d7]} (1. Kf2 Kf7 $6) (1. e4 $2
+{too early}) 1... Kd7 2. Kd3 Kd6 *
+`
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("POST", "/studies/pgn/chapters?token=secret&name=Opposition", strings.NewReader(pgn)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	study, _ = studies.Load("pgn")
+	nodes := study.Chapters[0].Nodes
+	if len(nodes) != 7 || nodes[0].NAGs[0] != 1 || nodes[0].Comment != "" || len(nodes[0].Arrows) != 2 {
+		t.Fatalf("got %+v", nodes)
+	}
+	if nodes[3].SAN != "e4" || nodes[3].Parent != 0 || nodes[3].Comment != "too early" {
+		t.Errorf("got %+v", nodes[3])
+	}
+
+	w = httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/studies/pgn/pgn", nil))
+	if w.Body.String() != pgn {
+		t.Errorf("got\n%s\nwant\n%s", w.Body, pgn)
+	}
+
+	w = httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("POST", "/studies/pgn/chapters?token=secret", strings.NewReader("1. e4 e4")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for an illegal move", w.Code)
+	}
+}
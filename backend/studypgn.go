@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// maxPGNSize bounds the PGN of a chapter
+const maxPGNSize = 1 << 20
+
+// arrowCommand is how arrows are kept in PGN comments, as other programs
+// do: [%cal Ge2e4,Rg1f3], colored green or red and so on
+var arrowCommand = regexp.MustCompile(`\[%cal ([^\]]*)\]`)
+
+// chapterPGN is chapter number n of study in PGN, its main line first and
+// every other line of its tree as a variation
+func chapterPGN(study Study, n int) chess.PGN {
+	chapter := study.Chapters[n-1]
+	game := chess.PGN{
+		Tags:    []chess.Tag{{Name: "Event", Value: fmt.Sprintf("%s: %s", study.Name, chapter.Name)}, {Name: "Result", Value: "*"}},
+		Comment: chapter.Comment,
+		Result:  "*",
+	}
+	if chapter.FEN != chess.StartingFEN {
+		game.Tags = append(game.Tags, chess.Tag{Name: "SetUp", Value: "1"}, chess.Tag{Name: "FEN", Value: chapter.FEN})
+	}
+	children := map[int][]BoardNode{}
+	for _, node := range chapter.Nodes {
+		children[node.Parent] = append(children[node.Parent], node)
+	}
+	var line func(parent int) []*chess.PGNMove
+	line = func(parent int) []*chess.PGNMove {
+		var moves []*chess.PGNMove
+		for next := children[parent]; len(next) > 0; next = children[next[0].ID] {
+			main := pgnMove(next[0])
+			for _, other := range next[1:] {
+				main.Variations = append(main.Variations, append([]*chess.PGNMove{pgnMove(other)}, line(other.ID)...))
+			}
+			moves = append(moves, main)
+		}
+		return moves
+	}
+	game.Moves = line(0)
+	return game
+}
+
+func pgnMove(node BoardNode) *chess.PGNMove {
+	m, _ := chess.ParseMove(node.Move)
+	move := &chess.PGNMove{Move: m, NAGs: node.NAGs, Comment: node.Comment}
+	if len(node.Arrows) > 0 {
+		arrows := make([]string, len(node.Arrows))
+		for i, arrow := range node.Arrows {
+			arrows[i] = "G" + arrow
+		}
+		move.Comment = joinComment(move.Comment, "[%cal "+strings.Join(arrows, ",")+"]")
+	}
+	return move
+}
+
+func joinComment(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + " " + b
+}
+
+// pgnChapter is the chapter of game, its variations made lines of the tree
+// after the main line; moves beyond maxBoardNodes are left out
+func pgnChapter(game chess.PGN) (Chapter, error) {
+	start, err := game.Start()
+	if err != nil {
+		return Chapter{}, err
+	}
+	chapter := Chapter{Name: game.Tag("Event"), FEN: start.FEN(), Comment: game.Comment, Nodes: []BoardNode{}}
+	var add func(parent int, position chess.Position, moves []*chess.PGNMove)
+	add = func(parent int, position chess.Position, moves []*chess.PGNMove) {
+		for _, m := range moves {
+			if len(chapter.Nodes) == maxBoardNodes {
+				return
+			}
+			node := BoardNode{ID: len(chapter.Nodes) + 1, Parent: parent, Move: m.Move.String(), SAN: position.SAN(m.Move), NAGs: m.NAGs[:min(len(m.NAGs), maxNAGs)]}
+			node.Comment, node.Arrows = splitArrows(m.Comment)
+			chapter.Nodes = append(chapter.Nodes, node)
+			// the main line is made first, for it to stay the first child
+			for _, variation := range m.Variations {
+				add(parent, position, variation)
+			}
+			parent, position = node.ID, position.Apply(m.Move)
+		}
+	}
+	add(0, start, game.Moves)
+	return chapter, nil
+}
+
+// splitArrows takes the arrows out of comment, whatever their colors
+func splitArrows(comment string) (string, []string) {
+	var arrows []string
+	for _, command := range arrowCommand.FindAllStringSubmatch(comment, -1) {
+		for _, arrow := range strings.Split(command[1], ",") {
+			arrow = strings.TrimSpace(arrow)
+			if len(arrow) == 5 {
+				arrow = arrow[1:]
+			}
+			if validArrow(arrow) && len(arrows) < maxArrows {
+				arrows = append(arrows, arrow)
+			}
+		}
+	}
+	comment = strings.Join(strings.Fields(arrowCommand.ReplaceAllString(comment, "")), " ")
+	if len(comment) > maxCommentLength {
+		comment = strings.ToValidUTF8(comment[:maxCommentLength], "")
+	}
+	return comment, arrows
+}
+
+// readPGNChapter reads the chapter in PGN posted as the body of r, if any
+func readPGNChapter(w http.ResponseWriter, r *http.Request) (Chapter, bool, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPGNSize))
+	if err != nil {
+		return Chapter{}, false, err
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		return Chapter{}, false, nil
+	}
+	game, err := chess.ParsePGN(string(body))
+	if err != nil {
+		return Chapter{}, false, err
+	}
+	chapter, err := pgnChapter(game)
+	return chapter, true, err
+}
+
+// studyPGNHandler serves every chapter of a study in PGN, one game each
+func studyPGNHandler(w http.ResponseWriter, r *http.Request) {
+	study, err := studies.Load(r.PathValue("id"))
+	if errors.Is(err, ErrStudyNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-chess-pgn")
+	for n := range study.Chapters {
+		if n > 0 {
+			io.WriteString(w, "\n")
+		}
+		io.WriteString(w, chapterPGN(study, n+1).String())
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"slices"
+)
+
+// the takeback policies a game is created with, asked for with
+// ?takebacks=: none by default, each player once, or as many as the
+// players agree to in casual games, which such games are made
+const (
+	takebacksNone      = "none"
+	takebacksOnce      = "once"
+	takebacksUnlimited = "unlimited"
+)
+
+var ErrInvalidTakebacks = errors.New("invalid takeback policy")
+
+func parseTakebacks(s string) (string, error) {
+	switch s {
+	case "", takebacksNone:
+		return "", nil
+	case takebacksOnce, takebacksUnlimited:
+		return s, nil
+	}
+	return "", ErrInvalidTakebacks
+}
+
+// refuseTakeback is the error the player of color asking to take back
+// their last move in state is refused with, nil if they may ask: the
+// policy of the game has to allow them one, and they have to have moved,
+// besides what refuseOffer checks
+func refuseTakeback(state GameState, color string) *Message {
+	allowed := state.Takebacks == takebacksUnlimited ||
+		state.Takebacks == takebacksOnce && !slices.Contains(state.TakenBack, color)
+	if !allowed || state.Variant != "" {
+		refused := errorMessage(CodeTakebacksDisabled)
+		return &refused
+	}
+	if _, ok := takebackPlies(state, color); !ok {
+		refused := errorMessage(CodeNothingToTakeBack)
+		return &refused
+	}
+	return refuseOffer(state, color, state.TakebackOfferPlies)
+}
+
+// takebackPlies is how many moves are taken back for the player of color
+// to play their last one again: theirs, and the reply of their opponent if
+// they made it; it reports whether they made a move yet
+func takebackPlies(state GameState, color string) (int, bool) {
+	plies := 1
+	if state.Turn() == color {
+		plies = 2
+	}
+	return plies, len(state.Moves) >= plies
+}
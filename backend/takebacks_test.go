@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// startTakebackGame is startTestGame for a game created with the
+// takeback policy
+func startTakebackGame(t *testing.T, policy string) (game *ChessGame, white, black *testPlayer) {
+	t.Helper()
+	white, black = newTestPlayer(t), newTestPlayer(t)
+	white.conn.options.Takebacks = policy
+	if err := games.Pair(context.Background(), white.conn); err != nil {
+		t.Fatal(err)
+	}
+	games.mu.Lock()
+	game = games.seeks[len(games.seeks)-1]
+	games.mu.Unlock()
+	if err := games.Pair(context.Background(), black.conn); err != nil {
+		t.Fatal(err)
+	}
+	white.expect("start")
+	black.expect("start")
+	return game, white, black
+}
+
+func TestTakebacks(t *testing.T) {
+	_, white, _ := startTestGame(t)
+	white.send(Message{Type: "takeback_offer"})
+	if got := white.expect("error"); got.Code != CodeTakebacksDisabled {
+		t.Errorf("got %+v without takebacks", got)
+	}
+
+	game, white, black := startTakebackGame(t, takebacksOnce)
+	white.send(Message{Type: "takeback_offer"})
+	if got := white.expect("error"); got.Code != CodeNothingToTakeBack {
+		t.Errorf("got %+v before moving", got)
+	}
+	white.send(move("1", "e2", "e4"))
+	black.expect("move")
+	black.send(move("2", "e7", "e5"))
+	white.expect("move")
+	white.send(Message{Type: "takeback_offer"})
+	if got := black.expect("takeback_offer"); got.Color != "white" {
+		t.Fatalf("got %+v", got)
+	}
+	black.send(Message{Type: "takeback_offer"})
+	for _, player := range []*testPlayer{white, black} {
+		if got := player.expect("takeback"); got.Color != "white" || got.Ply != 0 {
+			t.Errorf("got %+v", got)
+		}
+	}
+	if state := game.recorder.State(); len(state.Moves) != 0 || state.Turn() != "white" {
+		t.Fatalf("got %+v once taken back", state)
+	}
+	white.send(move("3", "d2", "d4"))
+	black.expect("move")
+	white.send(Message{Type: "takeback_offer"})
+	if got := white.expect("error"); got.Code != CodeTakebacksDisabled {
+		t.Errorf("got %+v taking back twice", got)
+	}
+	// black has theirs still, white declines it by moving
+	black.send(move("4", "d7", "d5"))
+	white.expect("move")
+	black.send(Message{Type: "takeback_offer"})
+	white.expect("takeback_offer")
+	white.send(move("5", "c2", "c4"))
+	black.expect("move")
+	if state := game.recorder.State(); state.TakebackOffer != "" || len(state.Moves) != 3 {
+		t.Fatalf("got %+v once declined", state)
+	}
+
+	events, err := store.Load(game.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := newGameDocument(Replay(events), events)
+	if len(doc.Moves) != 3 || doc.Moves[0].SAN != "d4" || doc.Moves[2].SAN != "c4" {
+		t.Errorf("got %+v", doc.Moves)
+	}
+
+	game, _, _ = startTakebackGame(t, takebacksUnlimited)
+	if state := game.recorder.State(); state.Takebacks != takebacksUnlimited || !state.Casual {
+		t.Errorf("got %+v with unlimited takebacks", state)
+	}
+	if _, err := parseTakebacks("twice"); err != ErrInvalidTakebacks {
+		t.Errorf("got %v", err)
+	}
+}
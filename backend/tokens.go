@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxAccessTokens is the most access tokens a player keeps
+const maxAccessTokens = 50
+
+// the scopes of access tokens: playing games, reading the archive of the
+// player, managing their account, and playing as a bot
+const (
+	scopePlay        = "play"
+	scopeReadArchive = "read-archive"
+	scopeAdmin       = "admin"
+	scopeBot         = "bot"
+)
+
+var accessScopes = []string{scopePlay, scopeReadArchive, scopeAdmin, scopeBot}
+
+var ErrMissingScope = errors.New("missing scope")
+
+var (
+	errAccessTokenNotFound = errors.New("access token not found")
+	errTooManyAccessTokens = errors.New("too many access tokens, revoke some first")
+	errInvalidAccessToken  = errors.New("an access token has a name of up to 40 bytes, scopes among play, read-archive, admin and bot, and expires in the future if ever")
+)
+
+// AccessToken is a long-lived token a player created for a script or a
+// bot, it authenticates as they do until it expires or is revoked. As with
+// sessions, only its hash is kept, the token is answered once
+type AccessToken struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Expires is when the token stops working, never if it is zero
+	Expires time.Time `json:"expires,omitempty"`
+	// Scopes are what the token may be used for, see accessScopes
+	Scopes []string `json:"scopes"`
+	// Token is set only when the token is created
+	Token string `json:"token,omitempty"`
+}
+
+func (t AccessToken) expired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+// accessToken is the index of the access token of player token is, or -1
+// if it is none or it expired
+func accessToken(player Player, token string) int {
+	hash := []byte(hashToken(token))
+	now := time.Now()
+	for i, t := range player.AccessTokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 && !t.expired(now) {
+			return i
+		}
+	}
+	return -1
+}
+
+// allows reports whether token, of player, may be used for one of scopes:
+// sessions may be used for anything, access tokens for their scopes
+func allows(player Player, token string, scopes ...string) bool {
+	if session(player, token) >= 0 {
+		return true
+	}
+	i := accessToken(player, token)
+	if i < 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		if slices.Contains(player.AccessTokens[i].Scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// withScope refuses the requests of an access token without scope; the
+// rest go on to h, which authenticates them as it does
+func withScope(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if player, err := requestPlayer(r); err == nil && !allows(player, requestToken(r), scope) {
+			http.Error(w, "the access token lacks the "+scope+" scope", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// validScopes reports whether scopes are some of accessScopes, leaving them
+// without repeats
+func validScopes(scopes *[]string) bool {
+	valid := []string{}
+	for _, scope := range *scopes {
+		if !slices.Contains(accessScopes, scope) {
+			return false
+		}
+		if !slices.Contains(valid, scope) {
+			valid = append(valid, scope)
+		}
+	}
+	*scopes = valid
+	return len(valid) > 0
+}
+
+// accessTokensHandler lists the access tokens of the player authenticated,
+// expired ones too
+func accessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	list := []AccessToken{}
+	for _, t := range player.AccessTokens {
+		t.Hash = ""
+		list = append(list, t)
+	}
+	writeJSON(w, list)
+}
+
+// createAccessTokenHandler creates an access token of the player
+// authenticated with the name and expiration posted, answering its token
+func createAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	var t AccessToken
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&t); err != nil {
+		http.Error(w, "invalid access token", http.StatusBadRequest)
+		return
+	}
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" || len(t.Name) > maxNameLength || t.expired(time.Now()) || !validScopes(&t.Scopes) {
+		http.Error(w, errInvalidAccessToken.Error(), http.StatusBadRequest)
+		return
+	}
+	token := newPlayerToken(player.ID)
+	t.ID, t.Hash, t.CreatedAt, t.Token = newGameID(), hashToken(token), time.Now().UTC(), ""
+	err := players.Update(player.ID, func(player *Player) error {
+		if len(player.AccessTokens) >= maxAccessTokens {
+			return errTooManyAccessTokens
+		}
+		player.AccessTokens = append(player.AccessTokens, t)
+		return nil
+	})
+	if errors.Is(err, errTooManyAccessTokens) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t.Hash, t.Token = "", token
+	writeJSON(w, t)
+}
+
+// revokeAccessTokenHandler revokes the access token of the path, which
+// is refused from then on
+func revokeAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	err := players.Update(player.ID, func(player *Player) error {
+		for i, t := range player.AccessTokens {
+			if t.ID == r.PathValue("token") {
+				player.AccessTokens = append(player.AccessTokens[:i], player.AccessTokens[i+1:]...)
+				return nil
+			}
+		}
+		return errAccessTokenNotFound
+	})
+	if errors.Is(err, errAccessTokenNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
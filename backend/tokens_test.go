@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessTokens(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana := Player{ID: "ana", Name: "ana"}
+	startSession(&ana, "test")
+	players.Create(ana)
+	do := func(method, path, token, body string, v any) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		newPublicMux().ServeHTTP(w, r)
+		json.Unmarshal(w.Body.Bytes(), v)
+		return w.Code
+	}
+
+	var bot AccessToken
+	if code := do("POST", "/players/ana/tokens", ana.Token, `{"name":"my bot","scopes":["admin","read-archive","admin"]}`, &bot); code != http.StatusOK || bot.Token == "" || bot.Hash != "" {
+		t.Fatalf("got %d %+v", code, bot)
+	}
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	if code := do("POST", "/players/ana/tokens", ana.Token, `{"name":"late","expires":"`+past+`"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("got %d for a token already expired", code)
+	}
+	if code := do("POST", "/players/ana/tokens", ana.Token, `{"name":" "}`, nil); code != http.StatusBadRequest {
+		t.Errorf("got %d for a token without a name", code)
+	}
+	for _, scopes := range []string{`[]`, `["resign"]`} {
+		if code := do("POST", "/players/ana/tokens", ana.Token, `{"name":"x","scopes":`+scopes+`}`, nil); code != http.StatusBadRequest {
+			t.Errorf("got %d for scopes %s", code, scopes)
+		}
+	}
+	// the token authenticates on REST, and the WebSocket through authenticate
+	if code := do("GET", "/players/ana/preferences", bot.Token, "", nil); code != http.StatusOK {
+		t.Errorf("got %d with the access token", code)
+	}
+	if player, err := authenticate(bot.Token); err != nil || player.ID != "ana" {
+		t.Errorf("got %v authenticating", err)
+	}
+	var list []AccessToken
+	if do("GET", "/players/ana/tokens", ana.Token, "", &list); len(list) != 1 || list[0].Name != "my bot" || list[0].Hash != "" || list[0].Token != "" || len(list[0].Scopes) != 2 {
+		t.Errorf("got %+v", list)
+	}
+	// logging out the other sessions with it logs out every one
+	if code := do("DELETE", "/players/ana/sessions", bot.Token, "", nil); code != http.StatusNoContent {
+		t.Errorf("got %d logging out", code)
+	}
+	if _, err := authenticate(ana.Token); err == nil {
+		t.Error("the session was not logged out")
+	}
+
+	players.Update("ana", func(player *Player) error {
+		player.AccessTokens[0].Expires = time.Now().Add(-time.Second)
+		return nil
+	})
+	if _, err := authenticate(bot.Token); err == nil {
+		t.Error("an expired token authenticates")
+	}
+	players.Update("ana", func(player *Player) error {
+		player.AccessTokens[0].Expires = time.Time{}
+		return nil
+	})
+	if code := do("DELETE", "/players/ana/tokens/"+bot.ID, bot.Token, "", nil); code != http.StatusNoContent {
+		t.Errorf("got %d revoking", code)
+	}
+	if _, err := authenticate(bot.Token); err == nil {
+		t.Error("a revoked token authenticates")
+	}
+	if code := do("DELETE", "/players/ana/tokens/"+bot.ID, bot.Token, "", nil); code != http.StatusForbidden {
+		t.Errorf("got %d with the revoked token", code)
+	}
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	ana := Player{ID: "ana", Name: "ana"}
+	startSession(&ana, "test")
+	players.Create(ana)
+	do := func(method, path, token, body string, v any) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		newPublicMux().ServeHTTP(w, r)
+		json.Unmarshal(w.Body.Bytes(), v)
+		return w.Code
+	}
+	var reader AccessToken
+	do("POST", "/players/ana/tokens", ana.Token, `{"name":"reader","scopes":["read-archive"]}`, &reader)
+
+	if code := do("GET", "/players/ana/preferences", reader.Token, "", nil); code != http.StatusOK {
+		t.Errorf("got %d reading", code)
+	}
+	for _, path := range []string{"/players/ana/preferences", "/players/ana/library/games/any"} {
+		if code := do("PUT", path, reader.Token, `{}`, nil); code != http.StatusForbidden {
+			t.Errorf("got %d writing %s", code, path)
+		}
+	}
+	if code := do("POST", "/players/ana/tokens", reader.Token, `{"name":"more","scopes":["admin"]}`, nil); code != http.StatusForbidden {
+		t.Errorf("got %d creating a token", code)
+	}
+
+	// playing needs the play or bot scope
+	transport := newMemTransport()
+	player := &testPlayer{t: t, transport: transport}
+	_, span := tracer.Start(context.Background(), "test")
+	admit(context.Background(), span, httptest.NewRequest("GET", "/ws?auth="+url.QueryEscape(reader.Token), nil), transport)
+	player.expect("error", CodeMissingScope)
+
+	var bot AccessToken
+	do("POST", "/players/ana/tokens", ana.Token, `{"name":"bot","scopes":["bot"]}`, &bot)
+	if player, err := authenticate(bot.Token); err != nil || !allows(player, bot.Token, scopePlay, scopeBot) {
+		t.Errorf("the bot cannot play: %v", err)
+	}
+}
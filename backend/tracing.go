@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/alvaronaschez/simple-chess")
+
+// setupTracing exports spans to the OTLP/HTTP collector at endpoint.
+// With an empty endpoint spans are still created but never exported.
+func setupTracing(ctx context.Context, endpoint string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "simple-chess"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+func startMoveSpan(ctx context.Context, color string, message Message) trace.Span {
+	_, span := tracer.Start(ctx, "game.move", trace.WithAttributes(
+		attribute.String("chess.color", color),
+		attribute.String("chess.type", message.Type),
+		attribute.String("chess.from", message.From),
+		attribute.String("chess.to", message.To),
+	))
+	return span
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// transport carries the encoded frames of a connection
+type transport interface {
+	// WriteFrame must not keep data once it returns, it is reused
+	WriteFrame(frameType int, data []byte) error
+	ReadFrame() ([]byte, error)
+	// Close ends the connection, telling the client why if reason is not empty;
+	// unlike the other methods it may be called while a frame is written
+	Close(reason string) error
+	// SupportsBinary reports whether binary frames can be written
+	SupportsBinary() bool
+}
+
+var errTransportClosed = errors.New("transport closed")
+
+// pinger is implemented by the transports that have to ping the client
+// to keep the connection alive and tell when it is gone
+type pinger interface {
+	Ping() error
+}
+
+// ponger is implemented by the transports whose clients answer the pings,
+// LastPong being when they last did and RTT how long they took to answer
+// the last ping, 0 until they have
+type ponger interface {
+	LastPong() time.Time
+	RTT() time.Duration
+}
+
+// subprotocoller is implemented by the transports that negotiate the
+// protocol of the connection as they are opened, see subprotocols
+type subprotocoller interface {
+	Subprotocol() string
+}
+
+// a WebSocket client that takes longer than pongWait to answer
+// a ping is considered gone
+var (
+	pingInterval = 30 * time.Second
+	pongWait     = 60 * time.Second
+)
+
+// compression settings for the connections that negotiated permessage-deflate,
+// frames smaller than compressionThreshold bytes cost more to deflate than they save
+var (
+	compressionLevel     = 1
+	compressionThreshold = 512
+)
+
+type wsTransport struct {
+	ws *websocket.Conn
+	// lastPing is when the client was last pinged and lastPong when it
+	// last answered, in Unix nanoseconds, rtt how long it took to
+	lastPing atomic.Int64
+	lastPong atomic.Int64
+	rtt      atomic.Int64
+}
+
+func newWSTransport(ws *websocket.Conn) *wsTransport {
+	t := &wsTransport{ws: ws}
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error {
+		now := time.Now().UnixNano()
+		t.lastPong.Store(now)
+		if pinged := t.lastPing.Load(); pinged != 0 {
+			t.rtt.Store(now - pinged)
+		}
+		return ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	return t
+}
+
+func (t *wsTransport) LastPong() time.Time {
+	return time.Unix(0, t.lastPong.Load())
+}
+
+func (t *wsTransport) RTT() time.Duration {
+	return time.Duration(t.rtt.Load())
+}
+
+func (t *wsTransport) WriteFrame(frameType int, data []byte) error {
+	t.ws.EnableWriteCompression(len(data) >= compressionThreshold)
+	return t.ws.WriteMessage(frameType, data)
+}
+
+func (t *wsTransport) ReadFrame() ([]byte, error) {
+	_, data, err := t.ws.ReadMessage()
+	return data, err
+}
+
+func (t *wsTransport) Close(reason string) error {
+	if reason != "" {
+		message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+		t.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	}
+	return t.ws.Close()
+}
+
+func (t *wsTransport) SupportsBinary() bool {
+	return true
+}
+
+func (t *wsTransport) Subprotocol() string {
+	return t.ws.Subprotocol()
+}
+
+func (t *wsTransport) Ping() error {
+	t.lastPing.Store(time.Now().UnixNano())
+	return t.ws.WriteMessage(websocket.PingMessage, nil)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Trophy is what a player is awarded finishing on the podium of a bracket:
+// place 1 as its champion, 2 as the runner-up and 3 losing to either of
+// them last, shared by both semifinalists of a single elimination bracket
+type Trophy struct {
+	Bracket   string    `json:"bracket"`
+	Format    string    `json:"format"`
+	Place     int       `json:"place"`
+	Players   int       `json:"players"`
+	AwardedAt time.Time `json:"awardedAt"`
+}
+
+// podium is the place of each player on the podium of b, once it is over
+func (b *bracket) podium() map[string]int {
+	places := map[string]int{}
+	place := func(player string, n int) {
+		if _, placed := places[player]; player != "" && !placed {
+			places[player] = n
+		}
+	}
+	final := b.matches[len(b.matches)-1]
+	if final.reset && final.Bye {
+		final = final.from[0].winner
+	}
+	place(final.Winner, 1)
+	place(final.loser, 2)
+	switch {
+	case b.format == singleElimination:
+		for _, slot := range final.from {
+			if slot.winner != nil {
+				place(slot.winner.loser, 3)
+			}
+		}
+	default:
+		// the winner of the losers section played the grand final, the
+		// third is who they beat last
+		if grand := b.matches[len(b.matches)-2]; grand.from[1].winner != nil {
+			place(grand.from[1].winner.loser, 3)
+		}
+	}
+	return places
+}
+
+// award gives the players on the podium of b their trophies; b.mu must be
+// held
+func (b *bracket) award() {
+	now := time.Now().UTC()
+	for player, place := range b.podium() {
+		trophy := Trophy{Bracket: b.id, Format: b.format, Place: place, Players: len(b.seeds), AwardedAt: now}
+		err := players.Update(player, func(p *Player) error {
+			if !p.Deleted {
+				p.Trophies = append(p.Trophies, trophy)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrPlayerNotFound) {
+			log.Printf("cannot award the trophy of bracket %s to player %s: %v", b.id, player, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http/httptest"
+	"testing"
+)
+
+// decideBracket decides the matches of b in order, the first player of
+// each winning it
+func decideBracket(b *bracket) {
+	for _, m := range b.matches {
+		b.known(m)
+		if m.reset && m.from[0].winner.Winner == m.from[0].winner.Players[0] {
+			m.decide(m.Players[0])
+			m.Bye = true
+			continue
+		}
+		m.decide(m.Players[0])
+	}
+}
+
+func TestBracketPodium(t *testing.T) {
+	single := newBracket(singleElimination, []string{"a", "b", "c", "d"}, GameOptions{})
+	single.layout()
+	decideBracket(single)
+	if got, want := single.podium(), map[string]int{"a": 1, "b": 2, "d": 3, "c": 3}; !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	double := newBracket(doubleElimination, []string{"a", "b", "c", "d"}, GameOptions{})
+	double.layout()
+	decideBracket(double)
+	// b loses the winners final to a, then to d in the losers section
+	if got, want := double.podium(), map[string]int{"a": 1, "d": 2, "b": 3}; !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTrophiesOnProfiles(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	for _, id := range []string{"a", "b"} {
+		players.Create(Player{ID: id, Name: id})
+	}
+	b := newBracket(singleElimination, []string{"a", "b"}, GameOptions{})
+	b.layout()
+	decideBracket(b)
+	b.award()
+
+	w := httptest.NewRecorder()
+	newPublicMux().ServeHTTP(w, httptest.NewRequest("GET", "/players/b", nil))
+	got := profile{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Trophies) != 1 || got.Trophies[0].Place != 2 || got.Trophies[0].Bracket != b.id || got.Trophies[0].Players != 2 {
+		t.Errorf("got %+v", got.Trophies)
+	}
+}
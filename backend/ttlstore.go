@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ttlSweepEvery is how often the entries of a ttlStore are checked for
+// expiry, while it has any that may expire
+var ttlSweepEvery = 5 * time.Second
+
+// ttlStore is a registry whose entries expire once they go untouched for
+// their ttl, those put with none are kept until deleted. The entries
+// expired are removed and handed to expired, outside the lock, by a sweep
+// every ttlSweepEvery while sweeping
+type ttlStore[V any] struct {
+	expired func(key string, value V)
+
+	mu       sync.Mutex
+	entries  map[string]*ttlEntry[V]
+	sweeping bool
+}
+
+type ttlEntry[V any] struct {
+	value    V
+	ttl      time.Duration
+	deadline time.Time
+}
+
+func newTTLStore[V any](expired func(key string, value V)) *ttlStore[V] {
+	return &ttlStore[V]{expired: expired, entries: map[string]*ttlEntry[V]{}}
+}
+
+// Put sets the entry of key to value, expiring ttl after it is last
+// touched unless ttl is 0
+func (s *ttlStore[V]) Put(key string, value V, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &ttlEntry[V]{value: value, ttl: ttl, deadline: time.Now().Add(ttl)}
+	if ttl > 0 && !s.sweeping {
+		s.sweeping = true
+		time.AfterFunc(ttlSweepEvery, s.tick)
+	}
+}
+
+// Get is the entry of key, those past their deadline are already gone
+func (s *ttlStore[V]) Get(key string) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || entry.ttl > 0 && time.Now().After(entry.deadline) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// Touch puts off the expiry of the entry of key by its ttl, reporting
+// whether there is one
+func (s *ttlStore[V]) Touch(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if ok {
+		entry.deadline = time.Now().Add(entry.ttl)
+	}
+	return ok
+}
+
+func (s *ttlStore[V]) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+func (s *ttlStore[V]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// sweep removes the entries past their deadline at now, handing them to
+// expired
+func (s *ttlStore[V]) sweep(now time.Time) {
+	s.mu.Lock()
+	expired := map[string]V{}
+	for key, entry := range s.entries {
+		if entry.ttl > 0 && now.After(entry.deadline) {
+			expired[key] = entry.value
+			delete(s.entries, key)
+		}
+	}
+	s.mu.Unlock()
+	for key, value := range expired {
+		s.expired(key, value)
+	}
+}
+
+// tick sweeps the store, again ttlSweepEvery later while entries may
+// still expire
+func (s *ttlStore[V]) tick() {
+	s.sweep(time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if entry.ttl > 0 {
+			time.AfterFunc(ttlSweepEvery, s.tick)
+			return
+		}
+	}
+	s.sweeping = false
+}
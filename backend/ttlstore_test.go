@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLStoreExpiresUntouchedEntries(t *testing.T) {
+	expired := map[string]int{}
+	s := newTTLStore(func(key string, value int) { expired[key] = value })
+	s.Put("kept", 1, 0)
+	s.Put("touched", 2, time.Minute)
+	s.Put("stale", 3, time.Minute)
+
+	now := time.Now()
+	s.sweep(now.Add(30 * time.Second))
+	// as if a minute went by since they were put
+	for _, entry := range s.entries {
+		entry.deadline = now.Add(-time.Second)
+	}
+	s.Touch("touched")
+	s.sweep(now)
+	if len(expired) != 1 || expired["stale"] != 3 {
+		t.Fatalf("got %v expired", expired)
+	}
+	if _, ok := s.Get("stale"); ok {
+		t.Error("an expired entry is still there")
+	}
+	for _, key := range []string{"kept", "touched"} {
+		if _, ok := s.Get(key); !ok {
+			t.Errorf("%s expired", key)
+		}
+	}
+	s.sweep(now.Add(24 * time.Hour))
+	if value, ok := s.Get("kept"); !ok || value != 1 || s.Len() != 1 {
+		t.Errorf("got %d, %v of %d entries once the rest expired", value, ok, s.Len())
+	}
+}
+
+func TestTTLStoreSweepsItself(t *testing.T) {
+	defer func(d time.Duration) { ttlSweepEvery = d }(ttlSweepEvery)
+	ttlSweepEvery = 10 * time.Millisecond
+	expired := make(chan string, 1)
+	s := newTTLStore(func(key string, _ bool) { expired <- key })
+	s.Put("a", true, 20*time.Millisecond)
+	select {
+	case key := <-expired:
+		if key != "a" {
+			t.Errorf("got %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the entry never expired")
+	}
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return !s.sweeping
+	})
+}
+
+func TestIdlePollSessionsExpire(t *testing.T) {
+	session := newHTTPTransport(true)
+	stream := newHTTPTransport(false)
+	defer removeHTTPSession(stream)
+	httpSessions.sweep(time.Now().Add(pollIdleTimeout + time.Second))
+	if _, ok := findHTTPSession(session.id); ok {
+		t.Error("the idle poll session is still there")
+	}
+	select {
+	case <-session.done:
+	default:
+		t.Error("the idle poll session is still open")
+	}
+	if _, ok := findHTTPSession(stream.id); !ok {
+		t.Error("the stream expired")
+	}
+}
+
+func TestUnattendedGamesAreAborted(t *testing.T) {
+	game, white, black := startTestGame(t)
+	white.send(Message{Type: "pause_offer"})
+	black.expect("pause_offer")
+	black.send(Message{Type: "pause_offer"})
+	for _, player := range []*testPlayer{white, black} {
+		player.expect("paused")
+		player.conn.Close("")
+	}
+	waitFor(t, func() bool {
+		_, ok := games.unattended.Get(game.id)
+		return ok
+	})
+	games.unattended.sweep(time.Now().Add(unattendedGameTTL + time.Second))
+	select {
+	case <-game.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the game left was never aborted")
+	}
+	if state := game.recorder.State(); !state.Finished || state.Result != "" {
+		t.Errorf("got %+v", state)
+	}
+	if _, ok := games.Find(game.id); ok {
+		t.Error("the game aborted is still active")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// report fields the way clients know them
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		return name
+	})
+	return v
+}
+
+// validateMessage checks an inbound message against the validate tags of Message,
+// returning the error to send back if it is invalid
+func validateMessage(message Message) *Message {
+	err := validate.Struct(message)
+	if err == nil {
+		return nil
+	}
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		invalid := errorMessage(CodeInvalidPayload)
+		return &invalid
+	}
+	invalid := errorMessage(CodeInvalidMessage, fieldErrors[0].Field(), fieldErrors[0].Tag())
+	invalid.Field = fieldErrors[0].Field()
+	return &invalid
+}
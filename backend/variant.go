@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// variant is what sets the games of a variant apart from those of standard
+// chess. The game loop asks it about every move and hands it whatever only
+// the variant knows about.
+//
+// Variants live in this package, each in its own file registering itself
+// with registerVariant, for they reach into the game loop: its outboxes,
+// messages and recorded state. Simuls, series and coaches are not variants
+// but what any game may be played as part of, or with, and the game loop
+// tells them about its moves itself
+type variant interface {
+	// seats are the outboxes of the seats besides white and black
+	seats() map[string]*outbox
+	// position is the position state got to and how many of its moves
+	// were played, as positionAfter
+	position(state GameState) (chess.Position, int)
+	// check checks m, about to be played in state, returning the code to
+	// refuse it with, if any, and the status of the position it leads to
+	check(state GameState, m *Move) (code string, status chess.Status)
+	// handle handles what seat sent if it is for the variant, reporting
+	// whether it was and whether the game is over
+	handle(seat string, message Message, flagged func(color string) bool) (handled, over bool)
+	// moved is told about the move color made after the game got to
+	// before, once forwarded to the opponent
+	moved(color string, message Message, before GameState)
+	// hangUp disconnects with hangUp whoever the variant talks to besides
+	// the seats, as the game ends or the server shuts down
+	hangUp(hangUp func(*connection))
+	// finished is told when the game loop is done, the game over or stopped
+	finished()
+}
+
+// variantMessage is what a variant posts to the game loop to handle there,
+// reporting whether the game is over
+type variantMessage interface {
+	deliver(game *ChessGame) bool
+}
+
+// variantKind is how a variant registered
+type variantKind struct {
+	// pair puts conn in a game of the variant, or in the queue for one
+	pair func(m *gameManager, ctx context.Context, conn *connection) error
+	// newGame makes the variant of game, which is nil when only the rules
+	// of the variant are asked about: position and check
+	newGame func(game *ChessGame) variant
+}
+
+// variants are the variants by name, standard chess is the empty one
+var variants = map[string]variantKind{}
+
+// registerVariant makes the variant name known, each one registers itself
+// from the file it lives in
+func registerVariant(name string, kind variantKind) {
+	if _, ok := variants[name]; ok {
+		panic("variant registered twice: " + name)
+	}
+	variants[name] = kind
+}
+
+// variantKindOf is the registered variant name, standard chess if there is none
+func variantKindOf(name string) variantKind {
+	if kind, ok := variants[name]; ok {
+		return kind
+	}
+	return variants[""]
+}
+
+// variantRules is variant name for its rules alone
+func variantRules(name string) variant {
+	return variantKindOf(name).newGame(nil)
+}
+
+func init() {
+	registerVariant("", variantKind{
+		pair:    (*gameManager).Pair,
+		newGame: func(*ChessGame) variant { return standard{} },
+	})
+}
+
+// standard is standard chess, the variants embed it for what they do alike
+type standard struct{}
+
+func (standard) seats() map[string]*outbox { return nil }
+
+func (standard) position(state GameState) (chess.Position, int) {
+	return positionAfter(state.FEN, state.Moves)
+}
+
+// check plays m by the rules, there are no drops in standard chess
+func (standard) check(state GameState, m *Move) (string, chess.Status) {
+	if m.Drop != "" {
+		return CodeIllegalMove, chess.Ongoing
+	}
+	return standardMove(state, m)
+}
+
+func (standard) handle(string, Message, func(string) bool) (bool, bool) { return false, false }
+
+func (standard) moved(string, Message, GameState) {}
+
+func (standard) hangUp(func(*connection)) {}
+
+func (standard) finished() {}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestUnknownVariantIsStandardChess(t *testing.T) {
+	if _, ok := variantRules("nope").(standard); !ok {
+		t.Fatal("unknown variant is not standard chess")
+	}
+	for name := range variants {
+		if variants[name].pair == nil || variants[name].newGame == nil {
+			t.Errorf("variant %q registered incomplete", name)
+		}
+	}
+}
+
+func TestDropIsRefusedInStandardGames(t *testing.T) {
+	_, white, _ := startTestGame(t)
+	white.send(Message{Type: "drop", MoveID: "1", Drop: "n", To: "e4"})
+	white.expect("error", CodeIllegalMove)
+}
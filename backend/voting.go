@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/alvaronaschez/simple-chess/chess"
+)
+
+// voteWindow is how long the crowd of a voting game has to vote on each
+// move, a window nobody voted in is opened again
+var voteWindow = 10 * time.Second
+
+func init() {
+	registerVariant(voting, variantKind{
+		pair:    (*gameManager).OpenVoting,
+		newGame: func(game *ChessGame) variant { return newCrowd(game) },
+	})
+}
+
+// crowd plays black in a voting game: its voters vote on every move and
+// the one with the most votes is played, the first voted for among ties.
+// It is the variant of the game
+type crowd struct {
+	standard
+	game *ChessGame
+
+	mu     sync.Mutex
+	voters map[*connection]bool
+	// votes are the moves voted for by voter, in UCI notation, for the
+	// move the crowd is to make; moves has them in the order first voted for
+	votes map[*connection]string
+	moves []*Move
+	// deadline is when the votes are counted, zero unless the crowd is to move
+	deadline time.Time
+	timer    *time.Timer
+}
+
+func newCrowd(game *ChessGame) *crowd {
+	return &crowd{game: game, voters: map[*connection]bool{}, votes: map[*connection]string{}}
+}
+
+// OpenVoting creates a voting game with conn as white against the crowd,
+// it starts once the first voter joins with ?crowd={id}
+func (m *gameManager) OpenVoting(ctx context.Context, conn *connection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.clientLimit(conn.client); err != nil {
+		return err
+	}
+	if err := m.canCreate(); err != nil {
+		return err
+	}
+	game := openGame(ctx, conn, voting, nil, nil, 0)
+	// registered right away for voters to find it
+	m.active[game.id] = game
+	conn.Write(Message{Type: "voting", GameID: game.id, Slug: game.slug})
+	return nil
+}
+
+// joinCrowd handles the connections asking to vote in the game id
+func joinCrowd(conn *connection, id string) {
+	game, ok := findGame(id)
+	if !ok {
+		closeWithError(conn, ErrGameNotFound, id)
+		return
+	}
+	if err := game.JoinCrowd(conn); err != nil {
+		closeWithError(conn, err, id)
+	}
+}
+
+// JoinCrowd adds conn to the voters of a voting game, starting the game if
+// it is the first one
+func (game *ChessGame) JoinCrowd(conn *connection) error {
+	c, ok := game.variant.(*crowd)
+	if !ok {
+		return ErrGameNotFound
+	}
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	if game.abandoned || game.ended {
+		return ErrGameNotFound
+	}
+	// the crowd never leaves, voters come and go
+	if !game.hasJoined() {
+		game.recorder.Record(game.ctx, PlayerJoined, "black", nil)
+		close(game.joined)
+	}
+	game.connected["black"] = true
+	c.join(conn)
+	go c.listen(conn)
+	return nil
+}
+
+func (c *crowd) join(conn *connection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.voters[conn] = true
+	state := c.game.recorder.State()
+	conn.Write(Message{Type: "crowd", GameID: c.game.id, Color: "black", Variant: voting, Moves: state.Moves})
+	// the vote of a game restored with the crowd to move opens again
+	if c.deadline.IsZero() && state.Turn() == "black" {
+		c.open()
+		return
+	}
+	if !c.deadline.IsZero() {
+		conn.Write(c.tally())
+	}
+}
+
+// listen reads the votes of conn until it leaves
+func (c *crowd) listen(conn *connection) {
+	defer c.leave(conn)
+	for {
+		message, err := conn.Read()
+		if errors.Is(err, ErrInvalidPayload) {
+			conn.Write(errorMessage(CodeInvalidPayload))
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if invalid := validateMessage(message); invalid != nil {
+			conn.Write(*invalid)
+			continue
+		}
+		if message.Type != "vote" {
+			conn.Write(errorMessage(CodeWrongRole))
+			continue
+		}
+		if code := c.vote(conn, message.Move()); code != "" {
+			conn.Write(errorMessage(code))
+		}
+	}
+}
+
+func (c *crowd) leave(conn *connection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.voters, conn)
+	conn.Close("")
+}
+
+// vote records m as the vote of conn, replacing any other it made for
+// the same move, returning the code to refuse it with, if any
+func (c *crowd) vote(conn *connection, m *Move) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.deadline.IsZero() {
+		return CodeNotYourTurn
+	}
+	if code, _ := standardMove(c.game.recorder.State(), m); code != "" {
+		return code
+	}
+	voted := false
+	for _, other := range c.moves {
+		voted = voted || other.UCI() == m.UCI()
+	}
+	if !voted {
+		c.moves = append(c.moves, &Move{From: m.From, To: m.To, Promotion: m.Promotion})
+	}
+	c.votes[conn] = m.UCI()
+	c.broadcast(c.tally())
+	return ""
+}
+
+// tally is the message with the votes so far; c.mu must be held
+func (c *crowd) tally() Message {
+	tally := Message{Type: "votes", Votes: []VoteTally{}, Deadline: c.deadline.UnixMilli()}
+	for _, m := range c.moves {
+		count := 0
+		for _, uci := range c.votes {
+			if uci == m.UCI() {
+				count++
+			}
+		}
+		tally.Votes = append(tally.Votes, VoteTally{Move: m.UCI(), Count: count})
+	}
+	return tally
+}
+
+// broadcast writes message to every voter; c.mu must be held
+func (c *crowd) broadcast(message Message) {
+	for conn := range c.voters {
+		conn.Write(message)
+	}
+}
+
+// check plays voting games by the rules, for the crowd to vote on legal moves
+func (c *crowd) check(state GameState, m *Move) (string, chess.Status) {
+	return standardMove(state, m)
+}
+
+// moved tells the voters about the move color made, opening the vote
+// on the next one once it is the turn of the crowd
+func (c *crowd) moved(color string, message Message, before GameState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	message.Seq = 0
+	c.broadcast(message)
+	if color == "white" {
+		c.open()
+	}
+}
+
+// open starts the vote on the next move of the crowd; c.mu must be held
+func (c *crowd) open() {
+	c.votes, c.moves = map[*connection]string{}, nil
+	c.deadline = time.Now().Add(voteWindow)
+	c.timer = time.AfterFunc(voteWindow, c.count)
+	c.broadcast(c.tally())
+}
+
+// count plays the move with the most votes once the vote is over
+func (c *crowd) count() {
+	c.mu.Lock()
+	if c.deadline.IsZero() {
+		c.mu.Unlock()
+		return
+	}
+	tally := c.tally()
+	if len(tally.Votes) == 0 {
+		c.deadline = time.Now().Add(voteWindow)
+		c.timer.Reset(voteWindow)
+		c.broadcast(c.tally())
+		c.mu.Unlock()
+		return
+	}
+	chosen := 0
+	for i, votes := range tally.Votes {
+		if votes.Count > tally.Votes[chosen].Count {
+			chosen = i
+		}
+	}
+	m := c.moves[chosen]
+	c.deadline = time.Time{}
+	c.mu.Unlock()
+
+	// the crowd plays as any player does, through the game loop
+	in := inbounds.Get().(*inbound)
+	*in = inbound{color: "black", message: Message{Type: "move", MoveID: newToken(), From: m.From, To: m.To, Promotion: m.Promotion}}
+	c.game.post(in)
+}
+
+// hangUp ends the vote and hangs up on every voter
+func (c *crowd) hangUp(hangUp func(*connection)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = time.Time{}
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	for conn := range c.voters {
+		hangUp(conn)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVoting(t *testing.T) {
+	defer func(window time.Duration) { voteWindow = window }(voteWindow)
+	voteWindow = 300 * time.Millisecond
+
+	host := newTestPlayer(t)
+	if err := games.OpenVoting(context.Background(), host.conn); err != nil {
+		t.Fatal(err)
+	}
+	id := host.expect("voting").GameID
+	voters := [2]*testPlayer{newTestPlayer(t), newTestPlayer(t)}
+	joinCrowd(voters[0].conn, id)
+	if got := voters[0].expect("crowd"); got.Color != "black" || got.GameID != id {
+		t.Fatalf("got %+v", got)
+	}
+	if got := host.expect("start"); got.Color != "white" || got.Variant != voting {
+		t.Fatalf("got %+v", got)
+	}
+	voters[0].send(Message{Type: "vote", From: "e7", To: "e5"})
+	voters[0].expect("error", CodeNotYourTurn)
+	joinCrowd(voters[1].conn, id)
+	voters[1].expect("crowd")
+	host.send(Message{Type: "vote", From: "e2", To: "e4"})
+	host.expect("error", CodeWrongRole)
+
+	host.send(move("1", "e2", "e4"))
+	for _, voter := range voters {
+		if got := voter.expect("move"); got.From != "e2" || got.To != "e4" {
+			t.Fatalf("got %+v", got)
+		}
+		if got := voter.expect("votes"); len(got.Votes) != 0 || got.Deadline == 0 {
+			t.Fatalf("got %+v", got)
+		}
+	}
+	voters[0].send(Message{Type: "vote", From: "e7", To: "e4"})
+	voters[0].expect("error", CodeIllegalMove)
+	// the second vote of a voter replaces the first
+	var tally Message
+	for _, vote := range []struct {
+		voter    int
+		from, to string
+	}{{0, "e7", "e5"}, {1, "d7", "d5"}, {0, "d7", "d5"}} {
+		voters[vote.voter].send(Message{Type: "vote", From: vote.from, To: vote.to})
+		for _, voter := range voters {
+			tally = voter.expect("votes")
+		}
+	}
+	if want := []VoteTally{{"e7e5", 0}, {"d7d5", 2}}; !reflect.DeepEqual(tally.Votes, want) {
+		t.Fatalf("got %+v, want %+v", tally.Votes, want)
+	}
+
+	if got := host.expect("move"); got.From != "d7" || got.To != "d5" {
+		t.Fatalf("got %+v", got)
+	}
+	for _, voter := range voters {
+		voter.expect("move")
+	}
+	host.send(Message{Type: "resign"})
+	host.expect("game_over")
+	for _, voter := range voters {
+		if got := voter.expect("game_over"); got.Result != "0-1" {
+			t.Errorf("got %+v", got)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// the most webhooks a player keeps, the deliveries the log of each player
+// keeps, and how many times a delivery is attempted
+const (
+	maxWebhooks       = 10
+	maxDeliveries     = 50
+	maxWebhookAttempt = 5
+)
+
+// the events webhooks are delivered for
+const (
+	webhookGameStarted  = "game_started"
+	webhookGameFinished = "game_finished"
+	// bracket_starting reminds the players of a bracket it is about to
+	// start, see bracketReminder
+	webhookBracketStarting = "bracket_starting"
+	// achievement_unlocked is delivered with the Achievement unlocked
+	webhookAchievementUnlocked = "achievement_unlocked"
+)
+
+var webhookEvents = []string{webhookGameStarted, webhookGameFinished, webhookBracketStarting, webhookAchievementUnlocked}
+
+// webhookBackoff is how long the first retry of a delivery waits, every
+// other one waits twice as long as the one before
+var webhookBackoff = 10 * time.Second
+
+// webhookPrivateNetworks lets webhooks be delivered to the addresses
+// webhookAddressAllowed refuses otherwise
+var webhookPrivateNetworks = false
+
+// webhookClient delivers the webhooks. It checks the address it connects
+// to once the host of the URL is resolved, for a name resolving to another
+// address than it did when the webhook was created not to get past the
+// check, and follows no redirect; nor does it go through a proxy, whose
+// address would be the one checked
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: webhookDialControl}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+var (
+	errWebhookNotFound = errors.New("webhook not found")
+	errTooManyWebhooks = errors.New("too many webhooks, delete some first")
+	errInvalidWebhook  = errors.New("a webhook has an http or https URL of a public address, and events among game_started, game_finished, bracket_starting and achievement_unlocked")
+	errWebhookAddress  = errors.New("webhooks are not delivered to loopback, private or link-local addresses")
+)
+
+// Webhook is an URL the events of a player are posted to. Every delivery
+// is signed with its secret, answered once when it is created, see sign
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// webhookPayload is the body of a delivery, data depends on the event
+type webhookPayload struct {
+	ID        string `json:"id"`
+	Event     string `json:"event"`
+	Timestamp int64  `json:"timestamp"`
+	Data      any    `json:"data"`
+}
+
+// delivery is a payload posted to a webhook, as the log keeps it
+type delivery struct {
+	ID        string            `json:"id"`
+	Webhook   string            `json:"webhook"`
+	Event     string            `json:"event"`
+	Payload   json.RawMessage   `json:"payload"`
+	Attempts  []deliveryAttempt `json:"attempts"`
+	Delivered bool              `json:"delivered"`
+}
+
+// deliveryAttempt is a post of a delivery: the status answered, or the
+// error it failed with
+type deliveryAttempt struct {
+	Time   time.Time `json:"time"`
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// deliveryLog keeps the latest deliveries of each player, in memory
+type deliveryLog struct {
+	mu         sync.Mutex
+	deliveries map[string][]*delivery
+}
+
+var deliveries = &deliveryLog{deliveries: map[string][]*delivery{}}
+
+func (l *deliveryLog) add(player string, d *delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := append(l.deliveries[player], d)
+	if len(list) > maxDeliveries {
+		list = list[len(list)-maxDeliveries:]
+	}
+	l.deliveries[player] = list
+}
+
+// attempted records an attempt of d, and whether it was delivered
+func (l *deliveryLog) attempted(d *delivery, attempt deliveryAttempt, delivered bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	d.Attempts = append(d.Attempts, attempt)
+	d.Delivered = delivered
+}
+
+// of is a copy of the deliveries of player to webhook, the latest first
+func (l *deliveryLog) of(player, webhook string) []delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := []delivery{}
+	for i := len(l.deliveries[player]) - 1; i >= 0; i-- {
+		if d := l.deliveries[player][i]; d.Webhook == webhook {
+			copied := *d
+			copied.Attempts = slices.Clone(d.Attempts)
+			list = append(list, copied)
+		}
+	}
+	return list
+}
+
+// sign is the signature of a delivery of body at timestamp, sent as the
+// X-Chess-Signature header: the hex HMAC-SHA256 of "timestamp.body" keyed
+// with the secret of the webhook. Signing the timestamp along with the
+// body lets receivers refuse deliveries replayed later on
+func sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// notifyWebhooks delivers event to the webhooks of the player id that
+// subscribed to it, in the background, where they are looked up as well
+func notifyWebhooks(id, event string, data any) {
+	if id == "" {
+		return
+	}
+	go postWebhooks(players, id, event, data)
+}
+
+// postWebhooks delivers event to the webhooks of the player id of accounts
+// that subscribed to it, each delivery in the background
+func postWebhooks(accounts PlayerStore, id, event string, data any) {
+	player, err := accounts.Load(id)
+	if err != nil {
+		if !errors.Is(err, ErrPlayerNotFound) {
+			log.Printf("cannot load the webhooks of player %s: %v", id, err)
+		}
+		return
+	}
+	for _, hook := range player.Webhooks {
+		if !slices.Contains(hook.Events, event) {
+			continue
+		}
+		payload := webhookPayload{ID: newGameID(), Event: event, Timestamp: time.Now().Unix(), Data: data}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("cannot encode webhook %s of player %s: %v", hook.ID, id, err)
+			continue
+		}
+		d := &delivery{ID: payload.ID, Webhook: hook.ID, Event: event, Payload: body}
+		deliveries.add(id, d)
+		go deliver(hook, d)
+	}
+}
+
+// deliver posts d to hook until it answers with a 2xx status, attempting
+// up to maxWebhookAttempt times with an exponential backoff. Every attempt
+// is signed anew, for its timestamp to be that it was sent at
+func deliver(hook Webhook, d *delivery) {
+	wait := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		now := time.Now()
+		result := deliveryAttempt{Time: now.UTC()}
+		r, err := http.NewRequest("POST", hook.URL, bytes.NewReader(d.Payload))
+		if err == nil {
+			timestamp := now.Unix()
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("User-Agent", "simple-chess-webhooks")
+			r.Header.Set("X-Chess-Event", d.Event)
+			r.Header.Set("X-Chess-Delivery", d.ID)
+			r.Header.Set("X-Chess-Timestamp", strconv.FormatInt(timestamp, 10))
+			r.Header.Set("X-Chess-Signature", sign(hook.Secret, timestamp, d.Payload))
+			var resp *http.Response
+			resp, err = webhookClient.Do(r)
+			if err == nil {
+				resp.Body.Close()
+				result.Status = resp.StatusCode
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		delivered := result.Status >= 200 && result.Status < 300
+		deliveries.attempted(d, result, delivered)
+		if delivered || attempt == maxWebhookAttempt {
+			return
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// webhookAddressAllowed reports whether webhooks may be delivered to ip,
+// which is not the case of the addresses of the server itself and of the
+// networks it is in, unless webhookPrivateNetworks
+func webhookAddressAllowed(ip net.IP) bool {
+	return webhookPrivateNetworks ||
+		!(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+			ip.IsInterfaceLocalMulticast() || ip.IsUnspecified())
+}
+
+// webhookDialControl refuses the connections of webhookClient to the
+// addresses webhookAddressAllowed refuses
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !webhookAddressAllowed(ip) {
+		return errWebhookAddress
+	}
+	return nil
+}
+
+// validWebhook reports whether hook has an http or https URL, not of an
+// address webhooks are refused to, and events among webhookEvents, leaving
+// them without repeats. Names are only checked once resolved, as webhooks
+// are delivered
+func validWebhook(hook *Webhook) bool {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(hook.URL) > 2048 {
+		return false
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !webhookAddressAllowed(ip) {
+		return false
+	}
+	events := []string{}
+	for _, event := range hook.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return false
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	hook.Events = events
+	return len(events) > 0
+}
+
+// webhooksHandler lists the webhooks of the player authenticated, without
+// their secrets
+func webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	list := []Webhook{}
+	for _, hook := range player.Webhooks {
+		hook.Secret = ""
+		list = append(list, hook)
+	}
+	writeJSON(w, list)
+}
+
+// createWebhookHandler creates a webhook of the player authenticated with
+// the URL and events posted, answering its secret
+func createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	var hook Webhook
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&hook); err != nil {
+		http.Error(w, "invalid webhook", http.StatusBadRequest)
+		return
+	}
+	if !validWebhook(&hook) {
+		http.Error(w, errInvalidWebhook.Error(), http.StatusBadRequest)
+		return
+	}
+	hook.ID, hook.Secret, hook.CreatedAt = newGameID(), newWebhookSecret(), time.Now().UTC()
+	err := players.Update(player.ID, func(player *Player) error {
+		if len(player.Webhooks) >= maxWebhooks {
+			return errTooManyWebhooks
+		}
+		player.Webhooks = append(player.Webhooks, hook)
+		return nil
+	})
+	if errors.Is(err, errTooManyWebhooks) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, hook)
+}
+
+// deleteWebhookHandler deletes the webhook of the path, deliveries already
+// under way go on
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	err := players.Update(player.ID, func(player *Player) error {
+		for i, hook := range player.Webhooks {
+			if hook.ID == r.PathValue("webhook") {
+				player.Webhooks = append(player.Webhooks[:i], player.Webhooks[i+1:]...)
+				return nil
+			}
+		}
+		return errWebhookNotFound
+	})
+	if errors.Is(err, errWebhookNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deliveriesHandler answers the latest deliveries to the webhook of the
+// path with every attempt of each, for integrations to be debugged
+func deliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	player, ok := ownPlayer(w, r)
+	if !ok {
+		return
+	}
+	if !slices.ContainsFunc(player.Webhooks, func(hook Webhook) bool { return hook.ID == r.PathValue("webhook") }) {
+		http.Error(w, errWebhookNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, deliveries.of(player.ID, r.PathValue("webhook")))
+}
+
+// startedGame is the data of a game_started delivery
+type startedGame struct {
+	ID       string `json:"id"`
+	Color    string `json:"color"`
+	Opponent string `json:"opponent,omitempty"`
+	Pool     string `json:"pool"`
+	Rated    bool   `json:"rated"`
+}
+
+// finishedGame is the data of a game_finished delivery, with the result
+// certificate of rated games
+type finishedGame struct {
+	PlayerGame
+	Certificate *resultCertificate `json:"certificate,omitempty"`
+}
+
+// startingBracket is the data of a bracket_starting delivery
+type startingBracket struct {
+	ID       string    `json:"id"`
+	StartsAt time.Time `json:"startsAt"`
+}
+
+// the handlers of the bus run on the game loop, the webhooks of the players
+// are looked up and the certificates made in the background, with the
+// stores the handlers were called with
+func init() {
+	bus.subscribe(busGameStarted, func(event busEvent) {
+		state := event.State
+		pool, rated := ratingPool(state), isRated(state)
+		for color, id := range state.Players {
+			notifyWebhooks(id, webhookGameStarted, startedGame{ID: state.ID, Color: color, Opponent: state.Players[opponent(color)], Pool: pool, Rated: rated})
+		}
+	})
+	bus.subscribe(busGameFinished, func(event busEvent) {
+		state := event.State
+		if state.Result == "" || len(state.Players) == 0 {
+			return
+		}
+		go finishedWebhooks(store, players, state, event.Time)
+	})
+}
+
+// finishedWebhooks delivers game_finished to the webhooks of the players
+// of the game of state, which ended at endedAt, with its certificate if
+// the events of eventStore make one
+func finishedWebhooks(eventStore EventStore, accounts PlayerStore, state GameState, endedAt time.Time) {
+	var cert *resultCertificate
+	if events, err := eventStore.Load(state.ID); err == nil {
+		if record, ok := resultRecordOf(events); ok {
+			c := certify(record)
+			cert = &c
+		}
+	}
+	for color, id := range state.Players {
+		if id == "" {
+			continue
+		}
+		postWebhooks(accounts, id, webhookGameFinished, finishedGame{playerGame(state, color, isRated(state), endedAt), cert})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	defer func(d time.Duration) { webhookBackoff = d }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+	// the receiver listens on loopback
+	defer func(allowed bool) { webhookPrivateNetworks = allowed }(webhookPrivateNetworks)
+	webhookPrivateNetworks = true
+	ana := Player{ID: "ana", Name: "ana"}
+	startSession(&ana, "test")
+	players.Create(ana)
+	do := func(method, path, body string, v any) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+ana.Token)
+		newPublicMux().ServeHTTP(w, r)
+		json.Unmarshal(w.Body.Bytes(), v)
+		return w.Code
+	}
+
+	// the receiver fails the first attempt, and checks the signature of each
+	var attempts atomic.Int32
+	var secret atomic.Value
+	signed := make(chan bool, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get("X-Chess-Timestamp"), 10, 64)
+		signed <- r.Header.Get("X-Chess-Signature") == sign(secret.Load().(string), timestamp, body) && r.Header.Get("X-Chess-Event") == webhookGameFinished
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	for _, body := range []string{`{"url":"ftp://example.com","events":["game_finished"]}`, `{"url":"` + receiver.URL + `","events":[]}`, `{"url":"` + receiver.URL + `","events":["move"]}`} {
+		if code := do("POST", "/players/ana/webhooks", body, nil); code != http.StatusBadRequest {
+			t.Errorf("got %d for %s", code, body)
+		}
+	}
+	var hook Webhook
+	if code := do("POST", "/players/ana/webhooks", `{"url":"`+receiver.URL+`","events":["game_finished","game_finished"]}`, &hook); code != http.StatusOK || hook.Secret == "" || len(hook.Events) != 1 {
+		t.Fatalf("got %d %+v", code, hook)
+	}
+	secret.Store(hook.Secret)
+	var list []Webhook
+	if do("GET", "/players/ana/webhooks", "", &list); len(list) != 1 || list[0].Secret != "" {
+		t.Errorf("got %+v", list)
+	}
+
+	// game_started is not subscribed to, game_finished is retried once
+	notifyWebhooks("ana", webhookGameStarted, startedGame{ID: "g1"})
+	notifyWebhooks("ana", webhookGameFinished, PlayerGame{ID: "g1", Result: "win"})
+	for range 2 {
+		select {
+		case ok := <-signed:
+			if !ok {
+				t.Error("the delivery is not signed")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no delivery")
+		}
+	}
+	var log []delivery
+	waitFor(t, func() bool {
+		do("GET", "/players/ana/webhooks/"+hook.ID+"/deliveries", "", &log)
+		return len(log) == 1 && log[0].Delivered
+	})
+	if a := log[0].Attempts; len(a) != 2 || a[0].Status != http.StatusInternalServerError || a[1].Status != http.StatusOK {
+		t.Errorf("got attempts %+v", a)
+	}
+
+	if code := do("DELETE", "/players/ana/webhooks/"+hook.ID, "", nil); code != http.StatusNoContent {
+		t.Errorf("got %d deleting", code)
+	}
+	if code := do("GET", "/players/ana/webhooks/"+hook.ID+"/deliveries", "", nil); code != http.StatusNotFound {
+		t.Errorf("got %d for the deliveries of a deleted webhook", code)
+	}
+}
+
+func TestWebhooksToLocalAddressesAreRefused(t *testing.T) {
+	defer func(s PlayerStore) { players = s }(players)
+	players = newMemoryPlayerStore()
+	defer func(d time.Duration) { webhookBackoff = d }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+	ana := Player{ID: "ana", Name: "ana"}
+	startSession(&ana, "test")
+	players.Create(ana)
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer receiver.Close()
+	create := func(url string) (int, Webhook) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/players/ana/webhooks", strings.NewReader(`{"url":"`+url+`","events":["game_finished"]}`))
+		r.Header.Set("Authorization", "Bearer "+ana.Token)
+		newPublicMux().ServeHTTP(w, r)
+		var hook Webhook
+		json.Unmarshal(w.Body.Bytes(), &hook)
+		return w.Code, hook
+	}
+
+	for _, url := range []string{receiver.URL, "http://[::1]/", "http://10.0.0.1/", "http://169.254.169.254/latest", "http://0.0.0.0/"} {
+		if code, _ := create(url); code != http.StatusBadRequest {
+			t.Errorf("got %d creating a webhook to %s", code, url)
+		}
+	}
+	// a name is only checked once resolved
+	_, port, _ := strings.Cut(receiver.URL, "127.0.0.1:")
+	code, hook := create("http://localhost:" + port)
+	if code != http.StatusOK {
+		t.Fatalf("got %d creating a webhook to localhost", code)
+	}
+	notifyWebhooks("ana", webhookGameFinished, PlayerGame{ID: "g1", Result: "win"})
+	var log []delivery
+	waitFor(t, func() bool {
+		log = deliveries.of("ana", hook.ID)
+		return len(log) == 1 && len(log[0].Attempts) == maxWebhookAttempt
+	})
+	if a := log[0].Attempts[0]; log[0].Delivered || !strings.Contains(a.Error, errWebhookAddress.Error()) || hits.Load() != 0 {
+		t.Fatalf("got attempt %+v and %d requests", a, hits.Load())
+	}
+
+	// nor are redirects followed where they are allowed
+	defer func(allowed bool) { webhookPrivateNetworks = allowed }(webhookPrivateNetworks)
+	webhookPrivateNetworks = true
+	d := &delivery{ID: "d1", Event: webhookGameFinished, Payload: []byte("{}")}
+	deliver(Webhook{URL: receiver.URL + "/hook"}, d)
+	if a := d.Attempts[0]; a.Status != http.StatusFound || d.Delivered || hits.Load() != maxWebhookAttempt {
+		t.Fatalf("got attempt %+v and %d requests", a, hits.Load())
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// maxWebTransportFrameSize bounds the frames read from a WebTransport stream
+const maxWebTransportFrameSize = 64 << 10
+
+// wtTransport is an experimental transport for lossy mobile networks:
+// the client opens one bidirectional stream on its WebTransport session
+// and messages are sent over it prefixed by their length as a uvarint
+type wtTransport struct {
+	session *webtransport.Session
+	stream  webtransport.Stream
+	reader  *bufio.Reader
+}
+
+func (t *wtTransport) WriteFrame(frameType int, data []byte) error {
+	_, err := t.stream.Write(append(binary.AppendUvarint(nil, uint64(len(data))), data...))
+	return err
+}
+
+func (t *wtTransport) ReadFrame() ([]byte, error) {
+	size, err := binary.ReadUvarint(t.reader)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxWebTransportFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the limit", size)
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(t.reader, data)
+	return data, err
+}
+
+func (t *wtTransport) Close(reason string) error {
+	code := webtransport.SessionErrorCode(0)
+	if reason != "" {
+		// the same code a WebSocket would be closed with
+		code = websocket.ClosePolicyViolation
+	}
+	return t.session.CloseWithError(code, reason)
+}
+
+func (t *wtTransport) SupportsBinary() bool {
+	return true
+}
+
+var webTransportServer = &webtransport.Server{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+func webTransportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "webtransport.upgrade")
+	defer span.End()
+
+	session, err := webTransportServer.Upgrade(w, r)
+	if err != nil {
+		recordError(span, err)
+		log.Printf("webtransport upgrade: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	acceptCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	stream, err := session.AcceptStream(acceptCtx)
+	if err != nil {
+		recordError(span, err)
+		log.Printf("webtransport accept stream: %v", err)
+		session.CloseWithError(0, "")
+		return
+	}
+
+	admit(context.WithoutCancel(ctx), span, r, &wtTransport{session: session, stream: stream, reader: bufio.NewReader(stream)})
+}
+
+// serveWebTransport listens for WebTransport sessions over HTTP/3 on addr,
+// which has to be a UDP address reachable with the given TLS certificate
+func serveWebTransport(addr, certFile, keyFile string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wt", webTransportHandler)
+	webTransportServer.H3 = http3.Server{Addr: addr, Handler: mux}
+	return webTransportServer.ListenAndServeTLS(certFile, keyFile)
+}